@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS coin_campaign_grants;
+DROP TABLE IF EXISTS coin_campaigns;
\ No newline at end of file
@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS coin_campaigns (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    filter JSONB NOT NULL DEFAULT '{}',
+    amount BIGINT NOT NULL CHECK (amount > 0),
+    reason TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'running',
+    total BIGINT NOT NULL DEFAULT 0,
+    processed BIGINT NOT NULL DEFAULT 0,
+    failed BIGINT NOT NULL DEFAULT 0,
+    last_user_id UUID,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_coin_campaigns_status ON coin_campaigns (status);
+
+CREATE TABLE IF NOT EXISTS coin_campaign_grants (
+    campaign_id UUID NOT NULL REFERENCES coin_campaigns(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    amount BIGINT NOT NULL CHECK (amount > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (campaign_id, user_id)
+);
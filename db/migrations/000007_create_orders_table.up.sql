@@ -0,0 +1,22 @@
+ALTER TABLE products ADD COLUMN IF NOT EXISTS stock BIGINT CHECK (stock >= 0);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    total_coins BIGINT NOT NULL CHECK (total_coins > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_user_id ON orders (user_id, created_at);
+
+CREATE TABLE IF NOT EXISTS order_items (
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    line_no INTEGER NOT NULL,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE RESTRICT,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    unit_price_coins BIGINT NOT NULL CHECK (unit_price_coins > 0),
+    total_coins BIGINT NOT NULL CHECK (total_coins > 0),
+    PRIMARY KEY (order_id, line_no)
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_items_product_id ON order_items (product_id);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS slug_reservations;
\ No newline at end of file
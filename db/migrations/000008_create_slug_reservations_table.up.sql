@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS slug_reservations (
+    slug TEXT PRIMARY KEY,
+    owner TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_slug_reservations_expires_at ON slug_reservations (expires_at);
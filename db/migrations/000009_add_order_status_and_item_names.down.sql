@@ -0,0 +1,2 @@
+ALTER TABLE order_items DROP COLUMN IF EXISTS product_name;
+ALTER TABLE orders DROP COLUMN IF EXISTS status;
\ No newline at end of file
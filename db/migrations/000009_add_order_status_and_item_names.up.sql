@@ -0,0 +1,9 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'completed'
+    CHECK (status IN ('completed', 'refunded', 'partially_refunded'));
+
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS product_name TEXT NOT NULL DEFAULT '';
+
+UPDATE order_items oi
+SET product_name = p.name
+FROM products p
+WHERE p.id = oi.product_id AND oi.product_name = '';
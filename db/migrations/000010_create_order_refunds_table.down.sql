@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_order_items_id;
+ALTER TABLE order_items DROP COLUMN IF EXISTS refunded_at;
+ALTER TABLE order_items DROP COLUMN IF EXISTS refund_id;
+ALTER TABLE order_items DROP COLUMN IF EXISTS id;
+DROP TABLE IF EXISTS order_refunds;
\ No newline at end of file
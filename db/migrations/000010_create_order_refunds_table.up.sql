@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS order_refunds (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    amount_coins BIGINT NOT NULL CHECK (amount_coins > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_refunds_order_id ON order_refunds (order_id);
+
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS id UUID NOT NULL DEFAULT gen_random_uuid();
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS refund_id UUID REFERENCES order_refunds(id);
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS refunded_at TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_order_items_id ON order_items (id);
@@ -0,0 +1,9 @@
+UPDATE users SET status = 'active' WHERE status IS NULL;
+
+ALTER TABLE users ALTER COLUMN status SET DEFAULT 'active';
+ALTER TABLE users ALTER COLUMN status SET NOT NULL;
+
+-- NOT VALID enforces the constraint for new writes without failing the
+-- migration on legacy rows; run VALIDATE CONSTRAINT once those are fixed.
+ALTER TABLE users ADD CONSTRAINT users_status_check
+    CHECK (status IN ('active', 'inactive', 'suspended', 'deleted')) NOT VALID;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS job_checkpoints (
+    name TEXT PRIMARY KEY,
+    status TEXT NOT NULL,
+    checkpoint TEXT NOT NULL DEFAULT '',
+    processed BIGINT NOT NULL DEFAULT 0,
+    error TEXT,
+    started_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ
+);
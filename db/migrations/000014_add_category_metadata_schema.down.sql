@@ -0,0 +1 @@
+ALTER TABLE product_categories DROP COLUMN IF EXISTS metadata_schema;
\ No newline at end of file
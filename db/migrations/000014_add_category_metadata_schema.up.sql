@@ -0,0 +1 @@
+ALTER TABLE product_categories ADD COLUMN IF NOT EXISTS metadata_schema JSONB;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_users_deletion_scheduled_for;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS status_before_deletion,
+    DROP COLUMN IF EXISTS deletion_scheduled_for,
+    DROP COLUMN IF EXISTS deletion_requested_at;
\ No newline at end of file
@@ -0,0 +1,7 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS deletion_requested_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS deletion_scheduled_for TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS status_before_deletion TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_users_deletion_scheduled_for ON users (deletion_scheduled_for)
+    WHERE deletion_scheduled_for IS NOT NULL;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS coin_transactions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    amount BIGINT NOT NULL,
+    direction TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    balance_after BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_coin_transactions_user_id ON coin_transactions (user_id, created_at DESC, id DESC);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS user_admin_actions;
\ No newline at end of file
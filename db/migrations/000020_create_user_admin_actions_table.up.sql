@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS user_admin_actions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_admin_actions_user_id ON user_admin_actions (user_id, created_at DESC, id DESC);
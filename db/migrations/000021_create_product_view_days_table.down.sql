@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_orders_created_at;
+DROP TABLE IF EXISTS product_view_days;
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS product_view_days (
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    views BIGINT NOT NULL CHECK (views > 0),
+    PRIMARY KEY (product_id, day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_view_days_day ON product_view_days (day);
+
+CREATE INDEX IF NOT EXISTS idx_orders_created_at ON orders (created_at);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS purchases;
\ No newline at end of file
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_coin_transactions_order_id;
+ALTER TABLE coin_transactions DROP COLUMN IF EXISTS reverses_id;
+ALTER TABLE coin_transactions DROP COLUMN IF EXISTS refund_id;
+ALTER TABLE coin_transactions DROP COLUMN IF EXISTS order_id;
\ No newline at end of file
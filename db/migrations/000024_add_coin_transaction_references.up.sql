@@ -0,0 +1,5 @@
+ALTER TABLE coin_transactions ADD COLUMN IF NOT EXISTS order_id UUID REFERENCES orders(id) ON DELETE SET NULL;
+ALTER TABLE coin_transactions ADD COLUMN IF NOT EXISTS refund_id UUID REFERENCES order_refunds(id) ON DELETE SET NULL;
+ALTER TABLE coin_transactions ADD COLUMN IF NOT EXISTS reverses_id BIGINT REFERENCES coin_transactions(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_coin_transactions_order_id ON coin_transactions (order_id) WHERE order_id IS NOT NULL;
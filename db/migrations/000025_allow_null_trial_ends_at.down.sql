@@ -0,0 +1,2 @@
+UPDATE users SET trial_ends_at = created_at + INTERVAL '3 days' WHERE trial_ends_at IS NULL;
+ALTER TABLE users ALTER COLUMN trial_ends_at SET NOT NULL;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE users ALTER COLUMN trial_ends_at DROP NOT NULL;
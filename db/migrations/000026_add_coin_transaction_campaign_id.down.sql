@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_coin_transactions_campaign_id;
+ALTER TABLE coin_transactions DROP COLUMN IF EXISTS campaign_id;
\ No newline at end of file
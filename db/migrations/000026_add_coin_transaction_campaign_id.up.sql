@@ -0,0 +1,3 @@
+ALTER TABLE coin_transactions ADD COLUMN IF NOT EXISTS campaign_id UUID REFERENCES coin_campaigns(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_coin_transactions_campaign_id ON coin_transactions (campaign_id) WHERE campaign_id IS NOT NULL;
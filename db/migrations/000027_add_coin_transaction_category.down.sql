@@ -0,0 +1 @@
+ALTER TABLE coin_transactions DROP COLUMN IF EXISTS category;
@@ -0,0 +1 @@
+ALTER TABLE coin_transactions ADD COLUMN IF NOT EXISTS category TEXT;
@@ -0,0 +1,6 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS erased_at TIMESTAMPTZ;
+
+-- Rows the deletion worker already anonymized
+UPDATE users SET erased_at = COALESCE(deleted_at, updated_at)
+WHERE erased_at IS NULL
+  AND email = 'deleted-' || id || '@deleted.invalid';
@@ -0,0 +1,228 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// State is the current mode of a Breaker.
+type State int
+
+const (
+	// StateClosed lets all requests through and tracks their outcome.
+	StateClosed State = iota
+	// StateOpen rejects requests until the cool-down has elapsed.
+	StateOpen
+	// StateHalfOpen lets a limited number of probe requests through.
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+// bucketCount is the number of slots the rolling window is divided into.
+const bucketCount = 10
+
+type Config struct {
+	// Window is the rolling period over which the error rate is computed.
+	Window time.Duration
+	// MinRequests is the number of requests in the window below which the
+	// breaker never opens, so a single failure at low traffic doesn't trip it.
+	MinRequests int
+	// ErrorRateThreshold is the failure ratio (0..1) at which the breaker opens.
+	ErrorRateThreshold float64
+	// CoolDown is how long the breaker stays open before probing.
+	CoolDown time.Duration
+	// HalfOpenProbes is how many requests may run concurrently while half-open.
+	HalfOpenProbes int
+}
+
+type bucket struct {
+	start    time.Time
+	total    int
+	failures int
+}
+
+// Ticket identifies a request admitted by Allow, so Record can tell a
+// half-open probe from a request admitted before the breaker last changed
+// state.
+type Ticket struct {
+	generation uint64
+	probe      bool
+}
+
+// Breaker is a rolling error-rate circuit breaker. It is safe for concurrent use.
+type Breaker struct {
+	cfg Config
+	now func() time.Time
+
+	mu    sync.Mutex
+	state State
+	// generation counts state changes; outcomes of requests admitted under
+	// an earlier one are ignored
+	generation     uint64
+	openedAt       time.Time
+	probesInFlight int
+	buckets        [bucketCount]bucket
+}
+
+// New creates a Breaker. now may be nil, in which case time.Now is used;
+// tests pass a fake clock.
+func New(cfg Config, now func() time.Time) *Breaker {
+	if now == nil {
+		now = time.Now
+	}
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = 1
+	}
+	return &Breaker{cfg: cfg, now: now}
+}
+
+// SetConfig replaces the thresholds without resetting the current state.
+func (b *Breaker) SetConfig(cfg Config) {
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = 1
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.cfg = cfg
+}
+
+// Allow reports whether a request may proceed and, if so, returns the
+// ticket to pass to Record with its outcome. When it may not, it also
+// returns how long the caller should wait before retrying.
+func (b *Breaker) Allow() (Ticket, bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+
+	if b.state == StateOpen {
+		elapsed := now.Sub(b.openedAt)
+		if elapsed < b.cfg.CoolDown {
+			return Ticket{}, false, b.cfg.CoolDown - elapsed
+		}
+		b.halfOpen()
+	}
+
+	if b.state == StateHalfOpen {
+		if b.probesInFlight >= b.cfg.HalfOpenProbes {
+			return Ticket{}, false, b.cfg.CoolDown
+		}
+		b.probesInFlight++
+		return Ticket{generation: b.generation, probe: true}, true, 0
+	}
+
+	return Ticket{generation: b.generation}, true, 0
+}
+
+// Record reports the outcome of the request Allow issued t for. It returns
+// true when this outcome opened the breaker. Outcomes of requests admitted
+// before the breaker last changed state are ignored, so a slow request let
+// through while closed can't decide a half-open probe.
+func (b *Breaker) Record(t Ticket, success bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if t.generation != b.generation {
+		return false
+	}
+
+	now := b.now()
+
+	if t.probe {
+		if b.probesInFlight > 0 {
+			b.probesInFlight--
+		}
+		if success {
+			b.state = StateClosed
+			b.generation++
+			b.buckets = [bucketCount]bucket{}
+			return false
+		}
+		b.trip(now)
+		return true
+	}
+
+	cur := b.bucketFor(now)
+	cur.total++
+	if !success {
+		cur.failures++
+	}
+
+	total, failures := b.totals(now)
+	if total >= b.cfg.MinRequests && total > 0 && float64(failures)/float64(total) >= b.cfg.ErrorRateThreshold {
+		b.trip(now)
+		return true
+	}
+	return false
+}
+
+// State returns the current state, moving an expired open breaker to half-open.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.cfg.CoolDown {
+		b.halfOpen()
+	}
+	return b.state
+}
+
+func (b *Breaker) halfOpen() {
+	b.state = StateHalfOpen
+	b.generation++
+	b.probesInFlight = 0
+}
+
+func (b *Breaker) trip(now time.Time) {
+	b.state = StateOpen
+	b.generation++
+	b.openedAt = now
+	b.probesInFlight = 0
+	b.buckets = [bucketCount]bucket{}
+}
+
+func (b *Breaker) bucketWidth() time.Duration {
+	width := b.cfg.Window / bucketCount
+	if width <= 0 {
+		width = time.Second
+	}
+	return width
+}
+
+// bucketFor returns the slot for now, resetting it if it holds stale data.
+func (b *Breaker) bucketFor(now time.Time) *bucket {
+	width := b.bucketWidth()
+	start := now.Truncate(width)
+	idx := int((start.UnixNano() / int64(width)) % bucketCount)
+
+	cur := &b.buckets[idx]
+	if !cur.start.Equal(start) {
+		*cur = bucket{start: start}
+	}
+	return cur
+}
+
+func (b *Breaker) totals(now time.Time) (int, int) {
+	cutoff := now.Add(-b.cfg.Window)
+	total, failures := 0, 0
+	for _, bk := range b.buckets {
+		if bk.start.After(cutoff) {
+			total += bk.total
+			failures += bk.failures
+		}
+	}
+	return total, failures
+}
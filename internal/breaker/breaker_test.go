@@ -0,0 +1,158 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock tests move by hand.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(clock *fakeClock) *Breaker {
+	return New(Config{
+		Window:             10 * time.Second,
+		MinRequests:        2,
+		ErrorRateThreshold: 0.5,
+		CoolDown:           5 * time.Second,
+		HalfOpenProbes:     1,
+	}, clock.now)
+}
+
+func mustAllow(t *testing.T, b *Breaker) Ticket {
+	t.Helper()
+	ticket, ok, _ := b.Allow()
+	if !ok {
+		t.Fatalf("Allow rejected a request in state %s", b.State())
+	}
+	return ticket
+}
+
+// trip opens b with two failures.
+func trip(t *testing.T, b *Breaker) {
+	t.Helper()
+	b.Record(mustAllow(t, b), false)
+	if !b.Record(mustAllow(t, b), false) {
+		t.Fatal("second failure did not trip the breaker")
+	}
+}
+
+func TestOpensAtErrorRateAndRejectsDuringCoolDown(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	b := newTestBreaker(clock)
+
+	trip(t, b)
+	if b.State() != StateOpen {
+		t.Fatalf("state %s, want open", b.State())
+	}
+
+	clock.advance(2 * time.Second)
+	_, ok, retryAfter := b.Allow()
+	if ok {
+		t.Fatal("Allow admitted a request while open")
+	}
+	if retryAfter != 3*time.Second {
+		t.Errorf("retry after %s, want 3s", retryAfter)
+	}
+}
+
+func TestProbeSuccessCloses(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	b := newTestBreaker(clock)
+	trip(t, b)
+
+	clock.advance(5 * time.Second)
+	probe := mustAllow(t, b)
+	if _, ok, _ := b.Allow(); ok {
+		t.Fatal("Allow admitted a second probe beyond HalfOpenProbes")
+	}
+	b.Record(probe, true)
+	if b.State() != StateClosed {
+		t.Fatalf("state %s after a successful probe, want closed", b.State())
+	}
+}
+
+func TestProbeFailureReopens(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	b := newTestBreaker(clock)
+	trip(t, b)
+
+	clock.advance(5 * time.Second)
+	if !b.Record(mustAllow(t, b), false) {
+		t.Fatal("failed probe did not report reopening the breaker")
+	}
+	if b.State() != StateOpen {
+		t.Fatalf("state %s after a failed probe, want open", b.State())
+	}
+}
+
+func TestStaleOutcomesDoNotDecideProbe(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	b := newTestBreaker(clock)
+
+	// Slow requests admitted while closed, still running when it trips
+	slowSuccess := mustAllow(t, b)
+	slowFailure := mustAllow(t, b)
+	trip(t, b)
+
+	clock.advance(5 * time.Second)
+	probe := mustAllow(t, b)
+
+	if b.Record(slowFailure, false) {
+		t.Fatal("a stale failure reopened the breaker")
+	}
+	b.Record(slowSuccess, true)
+	if b.State() != StateHalfOpen {
+		t.Fatalf("state %s after stale outcomes, want half_open", b.State())
+	}
+	if _, ok, _ := b.Allow(); ok {
+		t.Fatal("a stale outcome freed the probe slot")
+	}
+
+	b.Record(probe, true)
+	if b.State() != StateClosed {
+		t.Fatalf("state %s after the probe succeeded, want closed", b.State())
+	}
+}
+
+func TestStaleProbeIgnoredAfterReopen(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	b := New(Config{
+		Window:             10 * time.Second,
+		MinRequests:        2,
+		ErrorRateThreshold: 0.5,
+		CoolDown:           5 * time.Second,
+		HalfOpenProbes:     2,
+	}, clock.now)
+	trip(t, b)
+
+	clock.advance(5 * time.Second)
+	failing := mustAllow(t, b)
+	late := mustAllow(t, b)
+	b.Record(failing, false)
+
+	// The second probe of the failed round finishing must not close it
+	b.Record(late, true)
+	if b.State() != StateOpen {
+		t.Fatalf("state %s after a stale probe succeeded, want open", b.State())
+	}
+}
+
+func TestClosedWindowForgetsOldFailures(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	b := newTestBreaker(clock)
+
+	b.Record(mustAllow(t, b), false)
+	clock.advance(11 * time.Second)
+	if b.Record(mustAllow(t, b), false) {
+		t.Fatal("a failure outside the window counted toward tripping")
+	}
+	if b.State() != StateClosed {
+		t.Fatalf("state %s, want closed", b.State())
+	}
+}
@@ -0,0 +1,275 @@
+// Package cache provides in-memory read caches in front of repositories.
+package cache
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"user-service/internal/domain"
+	"user-service/internal/metrics"
+	"user-service/internal/service"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type Config struct {
+	// TTL bounds how long a user is served from memory.
+	TTL time.Duration
+	// MaxEntries caps the number of cached users. It is fixed when the
+	// repository is created.
+	MaxEntries int
+	// ShadowMode always reads from the database and serves that result,
+	// comparing it against the cached copy to measure staleness.
+	ShadowMode bool
+	// ShadowSampleRate is the fraction (0..1) of shadow reads that are compared.
+	ShadowSampleRate float64
+	// UpdatedAtTolerance is the updated_at skew not reported as a mismatch.
+	UpdatedAtTolerance time.Duration
+}
+
+type entry struct {
+	user      domain.User
+	expiresAt time.Time
+}
+
+// UserRepository caches GetByID in front of another UserRepository. Writes
+// made through it invalidate the user's entry; writes made elsewhere, such as
+// checkout, refunds, campaigns or another replica, are only picked up once the
+// entry expires. Every other method is passed through.
+type UserRepository struct {
+	service.UserRepository
+	maxEntries int
+	cfg        atomic.Pointer[Config]
+
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+func NewUserRepository(next service.UserRepository, cfg Config) *UserRepository {
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = 10000
+	}
+	r := &UserRepository{
+		UserRepository: next,
+		maxEntries:     cfg.MaxEntries,
+		entries:        make(map[string]entry),
+	}
+	r.SetConfig(cfg)
+	return r
+}
+
+// SetConfig replaces the TTL and shadow settings; it is safe to call while
+// serving requests. Users already cached keep the expiry they were stored
+// with, and MaxEntries is ignored.
+func (r *UserRepository) SetConfig(cfg Config) {
+	cfg.MaxEntries = r.maxEntries
+	r.cfg.Store(&cfg)
+}
+
+func (r *UserRepository) config() Config {
+	return *r.cfg.Load()
+}
+
+// GetByID serves users that aren't soft-deleted from the cache. Reads that
+// include soft-deleted users always go to the database.
+func (r *UserRepository) GetByID(ctx context.Context, id string, includeDeleted bool) (*domain.User, error) {
+	if includeDeleted {
+		return r.UserRepository.GetByID(ctx, id, true)
+	}
+
+	cfg := r.config()
+	cached, hit := r.get(id)
+
+	if hit && !cfg.ShadowMode {
+		return cached, nil
+	}
+
+	user, err := r.UserRepository.GetByID(ctx, id, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if hit && rand.Float64() < cfg.ShadowSampleRate {
+		r.compare(cached, user, cfg.UpdatedAtTolerance)
+	}
+	if !hit {
+		r.put(user, cfg.TTL)
+	}
+
+	return user, nil
+}
+
+// compare reports fields where the cached copy differs from the database.
+func (r *UserRepository) compare(cached, fresh *domain.User, updatedAtTolerance time.Duration) {
+	metrics.CacheShadowComparisons.Add(1)
+
+	fields := diffUsers(cached, fresh, updatedAtTolerance)
+	if len(fields) == 0 {
+		return
+	}
+
+	for _, field := range fields {
+		metrics.CacheShadowMismatches.Add(field, 1)
+	}
+	log.WithFields(log.Fields{
+		"user_id": fresh.ID,
+		"fields":  fields,
+	}).Warn("User cache shadow read mismatch")
+}
+
+func diffUsers(a, b *domain.User, updatedAtTolerance time.Duration) []string {
+	var fields []string
+	if a.Email != b.Email {
+		fields = append(fields, "email")
+	}
+	if a.Name != b.Name {
+		fields = append(fields, "name")
+	}
+	if a.CoinsBalance != b.CoinsBalance {
+		fields = append(fields, "coins_balance")
+	}
+	if a.TotalCoinsPurchased != b.TotalCoinsPurchased {
+		fields = append(fields, "total_coins_purchased")
+	}
+	if a.IsTrial != b.IsTrial {
+		fields = append(fields, "is_trial")
+	}
+	if !equalTimes(a.TrialEndsAt, b.TrialEndsAt) {
+		fields = append(fields, "trial_ends_at")
+	}
+	if a.HasSubscription != b.HasSubscription {
+		fields = append(fields, "has_subscription")
+	}
+	if !equalTimes(a.SubscriptionEndsAt, b.SubscriptionEndsAt) {
+		fields = append(fields, "subscription_ends_at")
+	}
+	if a.Status != b.Status {
+		fields = append(fields, "status")
+	}
+	if a.EmailVerified != b.EmailVerified {
+		fields = append(fields, "email_verified")
+	}
+	if !equalTimes(a.DeletionScheduledFor, b.DeletionScheduledFor) {
+		fields = append(fields, "deletion_scheduled_for")
+	}
+	if skew := a.UpdatedAt.Sub(b.UpdatedAt); skew > updatedAtTolerance || skew < -updatedAtTolerance {
+		fields = append(fields, "updated_at")
+	}
+	return fields
+}
+
+func equalTimes(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func (r *UserRepository) get(id string) (*domain.User, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.entries[id]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expiresAt) {
+		delete(r.entries, id)
+		return nil, false
+	}
+	user := e.user
+	return &user, true
+}
+
+func (r *UserRepository) put(user *domain.User, ttl time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.entries) >= r.maxEntries {
+		now := time.Now()
+		for id, e := range r.entries {
+			if now.After(e.expiresAt) {
+				delete(r.entries, id)
+			}
+		}
+		// Still full: drop an arbitrary entry rather than grow
+		for id := range r.entries {
+			if len(r.entries) < r.maxEntries {
+				break
+			}
+			delete(r.entries, id)
+		}
+	}
+
+	r.entries[user.ID] = entry{user: *user, expiresAt: time.Now().Add(ttl)}
+}
+
+func (r *UserRepository) invalidate(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.entries, id)
+}
+
+func (r *UserRepository) Update(ctx context.Context, userID string, fields *domain.UpdateUserFields) error {
+	defer r.invalidate(userID)
+	return r.UserRepository.Update(ctx, userID, fields)
+}
+
+func (r *UserRepository) AddCoinsAtomic(ctx context.Context, userID string, coins int64, reason, idempotencyKey string) (*domain.User, bool, error) {
+	defer r.invalidate(userID)
+	return r.UserRepository.AddCoinsAtomic(ctx, userID, coins, reason, idempotencyKey)
+}
+
+func (r *UserRepository) DeductCoinsAtomic(ctx context.Context, userID string, coins int64, reason, idempotencyKey string) (*domain.User, bool, error) {
+	defer r.invalidate(userID)
+	return r.UserRepository.DeductCoinsAtomic(ctx, userID, coins, reason, idempotencyKey)
+}
+
+func (r *UserRepository) TransferCoins(ctx context.Context, fromID, toID string, coins int64) (*domain.User, *domain.User, error) {
+	defer r.invalidate(fromID)
+	defer r.invalidate(toID)
+	return r.UserRepository.TransferCoins(ctx, fromID, toID, coins)
+}
+
+func (r *UserRepository) ActivateSubscriptionAtomic(ctx context.Context, userID string, duration time.Duration, bonusCoins int64, idempotencyKey string) (*domain.User, bool, error) {
+	defer r.invalidate(userID)
+	return r.UserRepository.ActivateSubscriptionAtomic(ctx, userID, duration, bonusCoins, idempotencyKey)
+}
+
+func (r *UserRepository) RenewSubscriptionAtomic(ctx context.Context, userID string, duration time.Duration, bonusCoins int64, idempotencyKey string) (*domain.User, bool, error) {
+	defer r.invalidate(userID)
+	return r.UserRepository.RenewSubscriptionAtomic(ctx, userID, duration, bonusCoins, idempotencyKey)
+}
+
+func (r *UserRepository) RequestDeletion(ctx context.Context, userID string, requestedAt, scheduledFor time.Time) (*domain.User, error) {
+	defer r.invalidate(userID)
+	return r.UserRepository.RequestDeletion(ctx, userID, requestedAt, scheduledFor)
+}
+
+func (r *UserRepository) CancelDeletion(ctx context.Context, userID string, now time.Time) (*domain.User, error) {
+	defer r.invalidate(userID)
+	return r.UserRepository.CancelDeletion(ctx, userID, now)
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id string) error {
+	defer r.invalidate(id)
+	return r.UserRepository.Delete(ctx, id)
+}
+
+func (r *UserRepository) HardDelete(ctx context.Context, id string) error {
+	defer r.invalidate(id)
+	return r.UserRepository.HardDelete(ctx, id)
+}
+
+func (r *UserRepository) Restore(ctx context.Context, id string) (*domain.User, error) {
+	defer r.invalidate(id)
+	return r.UserRepository.Restore(ctx, id)
+}
+
+func (r *UserRepository) ConfirmEmailVerification(ctx context.Context, userID, tokenHash string) error {
+	defer r.invalidate(userID)
+	return r.UserRepository.ConfirmEmailVerification(ctx, userID, tokenHash)
+}
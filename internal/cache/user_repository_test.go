@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"user-service/internal/domain"
+	"user-service/internal/service"
+)
+
+// countingRepo serves one user and counts the reads that reach it.
+type countingRepo struct {
+	service.UserRepository
+	user  domain.User
+	reads int
+}
+
+func (r *countingRepo) GetByID(ctx context.Context, id string, includeDeleted bool) (*domain.User, error) {
+	r.reads++
+	user := r.user
+	return &user, nil
+}
+
+func TestSetConfigReloadsTTL(t *testing.T) {
+	next := &countingRepo{user: domain.User{ID: "u1"}}
+	repo := NewUserRepository(next, Config{TTL: time.Hour})
+	ctx := context.Background()
+
+	repo.GetByID(ctx, "u1", false)
+	repo.GetByID(ctx, "u1", false)
+	if next.reads != 1 {
+		t.Fatalf("%d database reads with a 1h TTL, want 1", next.reads)
+	}
+
+	// Entries stored from now on expire at once
+	repo.SetConfig(Config{TTL: -time.Second})
+	repo.invalidate("u1")
+	repo.GetByID(ctx, "u1", false)
+	repo.GetByID(ctx, "u1", false)
+	if next.reads != 3 {
+		t.Fatalf("%d database reads after shortening the TTL, want 3", next.reads)
+	}
+}
+
+func TestSetConfigReloadsShadowMode(t *testing.T) {
+	next := &countingRepo{user: domain.User{ID: "u1"}}
+	repo := NewUserRepository(next, Config{TTL: time.Hour})
+	ctx := context.Background()
+
+	repo.GetByID(ctx, "u1", false)
+	repo.SetConfig(Config{TTL: time.Hour, ShadowMode: true, ShadowSampleRate: 1})
+	repo.GetByID(ctx, "u1", false)
+	if next.reads != 2 {
+		t.Fatalf("%d database reads in shadow mode, want 2", next.reads)
+	}
+
+	repo.SetConfig(Config{TTL: time.Hour})
+	repo.GetByID(ctx, "u1", false)
+	if next.reads != 2 {
+		t.Fatalf("%d database reads after leaving shadow mode, want 2", next.reads)
+	}
+}
+
+func TestSetConfigKeepsMaxEntries(t *testing.T) {
+	next := &countingRepo{}
+	repo := NewUserRepository(next, Config{TTL: time.Hour, MaxEntries: 1})
+	repo.SetConfig(Config{TTL: time.Hour, MaxEntries: 100})
+
+	repo.put(&domain.User{ID: "u1"}, time.Hour)
+	repo.put(&domain.User{ID: "u2"}, time.Hour)
+	if len(repo.entries) != 1 {
+		t.Fatalf("%d entries cached, want MaxEntries 1 to hold", len(repo.entries))
+	}
+	if repo.config().MaxEntries != 1 {
+		t.Fatalf("config MaxEntries = %d, want 1", repo.config().MaxEntries)
+	}
+}
@@ -1,7 +1,13 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"time"
+	"user-service/internal/domain"
+	"user-service/internal/featureflag"
+	"user-service/internal/jsonenc"
+	"user-service/internal/pii"
 
 	"github.com/caarlos0/env/v11"
 )
@@ -12,10 +18,291 @@ type DB struct {
 	MaxIdleConns    int           `env:"DB_MAX_IDLE_CONNS" envDefault:"8"`
 	ConnMaxLifetime time.Duration `env:"DB_CONN_MAX_LIFETIME" envDefault:"1h"`
 	ConnMaxIdleTime time.Duration `env:"DB_CONN_MAX_IDLE_TIME" envDefault:"15m"`
+	// ReservedInteractiveConns is how many pool connections heavy operations
+	// (bulk imports and price updates, reports, campaign batches) never take,
+	// so interactive requests always find one.
+	ReservedInteractiveConns int `env:"DB_RESERVED_INTERACTIVE_CONNS" envDefault:"4"`
+}
+
+// HeavyOpConns is how many pool connections heavy operations may hold at
+// once: all but the reserved ones, the health check's own connection and,
+// with leader election enabled, the one the elector holds while leader. The
+// migration lock's connection is not counted, as it is released before any
+// heavy operation can start.
+func (c *Config) HeavyOpConns() int {
+	return c.DB.MaxOpenConns - c.DB.ReservedInteractiveConns - c.setAsideConns()
+}
+
+// setAsideConns counts the connections held for the life of the process.
+func (c *Config) setAsideConns() int {
+	n := 1 // health check
+	if c.Leader.Enabled {
+		n++
+	}
+	return n
+}
+
+type User struct {
+	RequireEmailVerification bool          `env:"REQUIRE_EMAIL_VERIFICATION" envDefault:"false"`
+	EmailVerificationTTL     time.Duration `env:"EMAIL_VERIFICATION_TTL" envDefault:"24h"`
+	// SignupBonusCoins are credited to every new user unless an admin opts out.
+	SignupBonusCoins int64 `env:"SIGNUP_BONUS_COINS" envDefault:"200"`
+	// DeletionGracePeriod is how long a requested account deletion can be
+	// cancelled before the account is erased.
+	DeletionGracePeriod time.Duration `env:"USER_DELETION_GRACE_PERIOD" envDefault:"336h"`
+	// LegacyTrialPolicy is deny or grant: whether a trial with no end time
+	// gives access.
+	LegacyTrialPolicy string `env:"LEGACY_TRIAL_POLICY" envDefault:"deny"`
+	// TrialLength is how long the trial of a new user lasts. Imported users
+	// on a trial with no end get the end a trial this long would have had.
+	TrialLength time.Duration `env:"TRIAL_LENGTH" envDefault:"72h"`
+}
+
+type Logging struct {
+	// SlowRequestThreshold is the latency from which a request is logged with
+	// a breakdown of where its time went.
+	SlowRequestThreshold time.Duration `env:"SLOW_REQUEST_THRESHOLD" envDefault:"1s"`
+}
+
+type Validation struct {
+	MinNameLength int `env:"MIN_NAME_LENGTH" envDefault:"1"`
+	// InvalidInputPolicy is reject or clamp: whether list requests beyond the
+	// maximum limit or offset fail or get the largest page allowed.
+	InvalidInputPolicy string `env:"INVALID_INPUT_POLICY" envDefault:"reject"`
+}
+
+type Cache struct {
+	Enabled            bool          `env:"CACHE_ENABLED" envDefault:"false"`
+	TTL                time.Duration `env:"CACHE_TTL" envDefault:"30s"`
+	MaxEntries         int           `env:"CACHE_MAX_ENTRIES" envDefault:"10000"`
+	ShadowMode         bool          `env:"CACHE_SHADOW_MODE" envDefault:"false"`
+	ShadowSampleRate   float64       `env:"CACHE_SHADOW_SAMPLE_RATE" envDefault:"0.1"`
+	UpdatedAtTolerance time.Duration `env:"CACHE_SHADOW_UPDATED_AT_TOLERANCE" envDefault:"1s"`
+}
+
+type Breaker struct {
+	Enabled            bool          `env:"DB_BREAKER_ENABLED" envDefault:"true"`
+	Window             time.Duration `env:"DB_BREAKER_WINDOW" envDefault:"30s"`
+	MinRequests        int           `env:"DB_BREAKER_MIN_REQUESTS" envDefault:"20"`
+	ErrorRateThreshold float64       `env:"DB_BREAKER_ERROR_RATE" envDefault:"0.5"`
+	CoolDown           time.Duration `env:"DB_BREAKER_COOL_DOWN" envDefault:"15s"`
+	HalfOpenProbes     int           `env:"DB_BREAKER_HALF_OPEN_PROBES" envDefault:"3"`
+}
+
+type Audit struct {
+	Async      bool `env:"AUDIT_ASYNC" envDefault:"true"`
+	Workers    int  `env:"AUDIT_WORKERS" envDefault:"4"`
+	QueueDepth int  `env:"AUDIT_QUEUE_DEPTH" envDefault:"1000"`
+	// Required makes startup wait for Kafka, up to KafkaReadyTimeout, before
+	// serving, so no events are dropped while the broker is unreachable.
+	Required          bool          `env:"AUDIT_REQUIRED" envDefault:"false"`
+	KafkaReadyTimeout time.Duration `env:"AUDIT_KAFKA_READY_TIMEOUT" envDefault:"60s"`
+	// StoreEnabled keeps a copy of every audit event in the database so a
+	// time range can be replayed to Kafka after an outage.
+	StoreEnabled bool `env:"AUDIT_STORE_ENABLED" envDefault:"false"`
+	// Sinks lists where audit events are delivered: any of "kafka", "log"
+	// and "http". Every event goes to all of them.
+	Sinks       []string      `env:"AUDIT_SINKS" envSeparator:"," envDefault:"kafka"`
+	HTTPURL     string        `env:"AUDIT_HTTP_URL"`
+	HTTPTimeout time.Duration `env:"AUDIT_HTTP_TIMEOUT" envDefault:"5s"`
+	// EventAllowlist and EventDenylist keep event types out of the sinks;
+	// at most one of them may be set. FilteredToStore writes the held-back
+	// events to the local audit store instead of dropping them.
+	EventAllowlist  []string `env:"AUDIT_EVENT_ALLOWLIST" envSeparator:","`
+	EventDenylist   []string `env:"AUDIT_EVENT_DENYLIST" envSeparator:","`
+	FilteredToStore bool     `env:"AUDIT_FILTERED_TO_STORE" envDefault:"false"`
+}
+
+// Audit sink names accepted in AUDIT_SINKS.
+const (
+	AuditSinkKafka = "kafka"
+	AuditSinkLog   = "log"
+	AuditSinkHTTP  = "http"
+)
+
+// HasSink reports whether name is one of the configured audit sinks.
+func (a Audit) HasSink(name string) bool {
+	for _, sink := range a.Sinks {
+		if sink == name {
+			return true
+		}
+	}
+	return false
+}
+
+type Admin struct {
+	APIToken string `env:"ADMIN_API_TOKEN"`
+	// RoleTokens maps each role to the bearer token that grants it, as
+	// "role=token,role=token".
+	RoleTokens map[string]string `env:"ROLE_TOKENS" envSeparator:"," envKeyValSeparator:"="`
+	// RouteACL maps routes to the roles allowed to call them, as
+	// "METHOD /path=role|role;METHOD /path=role". Unlisted routes are open.
+	RouteACL map[string]string `env:"ROUTE_ACL" envSeparator:";" envKeyValSeparator:"="`
+}
+
+type Leader struct {
+	Enabled       bool          `env:"LEADER_ELECTION_ENABLED" envDefault:"true"`
+	RenewInterval time.Duration `env:"LEADER_RENEW_INTERVAL" envDefault:"10s"`
+}
+
+type Idempotency struct {
+	KeyTTL          time.Duration `env:"IDEMPOTENCY_KEY_TTL" envDefault:"24h"`
+	CleanupInterval time.Duration `env:"IDEMPOTENCY_CLEANUP_INTERVAL" envDefault:"10m"`
+}
+
+// JanitorPolicy tunes the cleanup of one table. The table itself is chosen in code.
+type JanitorPolicy struct {
+	MaxAge    time.Duration `env:"MAX_AGE" envDefault:"0s"`
+	BatchSize int           `env:"BATCH_SIZE" envDefault:"1000"`
+	Interval  time.Duration `env:"INTERVAL" envDefault:"1h"`
+}
+
+// CoinLedgerRetention tunes the pruning of the coin ledger. Entries older
+// than MaxAge are folded into an opening balance entry per user; zero keeps
+// the whole ledger.
+type CoinLedgerRetention struct {
+	MaxAge    time.Duration `env:"MAX_AGE" envDefault:"0s"`
+	BatchSize int           `env:"BATCH_SIZE" envDefault:"200"`
+	Interval  time.Duration `env:"INTERVAL" envDefault:"24h"`
+}
+
+type Janitor struct {
+	Enabled                 bool                `env:"JANITOR_ENABLED" envDefault:"true"`
+	BatchPause              time.Duration       `env:"JANITOR_BATCH_PAUSE" envDefault:"100ms"`
+	EmailVerificationTokens JanitorPolicy       `envPrefix:"JANITOR_EMAIL_VERIFICATION_TOKENS_"`
+	SlugReservations        JanitorPolicy       `envPrefix:"JANITOR_SLUG_RESERVATIONS_"`
+	CoinLedger              CoinLedgerRetention `envPrefix:"JANITOR_COIN_LEDGER_"`
+}
+
+type FeatureFlags struct {
+	// Definitions is a JSON object of flag name to {"rollout", "allow", "deny"}
+	Definitions featureflag.Definitions `env:"FEATURE_FLAGS"`
+}
+
+type Catalog struct {
+	// UncategorizedEnabled keeps a fallback category for products created
+	// without one and for products of deleted categories.
+	UncategorizedEnabled bool   `env:"CATALOG_UNCATEGORIZED_ENABLED" envDefault:"false"`
+	UncategorizedSlug    string `env:"CATALOG_UNCATEGORIZED_SLUG" envDefault:"uncategorized"`
+	// MaxProductsPerCategory caps how many products one category may hold;
+	// 0 means unlimited.
+	MaxProductsPerCategory int `env:"CATALOG_MAX_PRODUCTS_PER_CATEGORY" envDefault:"0"`
+	// MaxProductContentBytes caps a product's description and metadata
+	// together, in bytes; 0 means unlimited.
+	MaxProductContentBytes int `env:"CATALOG_MAX_PRODUCT_CONTENT_BYTES" envDefault:"65536"`
+	// HideInactiveBySlug makes inactive products and categories look missing
+	// when fetched by slug without the admin token.
+	HideInactiveBySlug bool `env:"CATALOG_HIDE_INACTIVE_BY_SLUG" envDefault:"true"`
+	// ProductsActiveByDefault is the is_active of products created without
+	// one; an explicit false is always kept.
+	ProductsActiveByDefault bool `env:"CATALOG_PRODUCTS_ACTIVE_BY_DEFAULT" envDefault:"true"`
+	// RejectInactiveCategory refuses to create products in inactive
+	// categories instead of creating products nobody sees.
+	RejectInactiveCategory bool `env:"CATALOG_REJECT_INACTIVE_CATEGORY" envDefault:"false"`
+	// Product views are buffered and written every ViewFlushInterval, or
+	// sooner once ViewFlushThreshold views are pending.
+	ViewFlushInterval  time.Duration `env:"CATALOG_VIEW_FLUSH_INTERVAL" envDefault:"10s"`
+	ViewFlushThreshold int           `env:"CATALOG_VIEW_FLUSH_THRESHOLD" envDefault:"1000"`
+	// StatsCacheTTL is how long product conversion stats are served from
+	// memory; 0 disables caching.
+	StatsCacheTTL time.Duration `env:"CATALOG_STATS_CACHE_TTL" envDefault:"5m"`
+}
+
+type Jobs struct {
+	ExpirySweepInterval     time.Duration `env:"JOBS_EXPIRY_SWEEP_INTERVAL" envDefault:"5m"`
+	ExpirySweepBatchSize    int           `env:"JOBS_EXPIRY_SWEEP_BATCH_SIZE" envDefault:"500"`
+	AccountErasureInterval  time.Duration `env:"JOBS_ACCOUNT_ERASURE_INTERVAL" envDefault:"10m"`
+	AccountErasureBatchSize int           `env:"JOBS_ACCOUNT_ERASURE_BATCH_SIZE" envDefault:"100"`
+	// The legacy trial backfill gives trials without an end time one.
+	LegacyTrialBackfillInterval  time.Duration `env:"JOBS_LEGACY_TRIAL_BACKFILL_INTERVAL" envDefault:"1h"`
+	LegacyTrialBackfillBatchSize int           `env:"JOBS_LEGACY_TRIAL_BACKFILL_BATCH_SIZE" envDefault:"500"`
+	// The PII backfill encrypts users stored before PII encryption was on.
+	PIIBackfillInterval  time.Duration `env:"JOBS_PII_BACKFILL_INTERVAL" envDefault:"1h"`
+	PIIBackfillBatchSize int           `env:"JOBS_PII_BACKFILL_BATCH_SIZE" envDefault:"200"`
+}
+
+// EmailLookup sets the anti-enumeration protection of user lookup by email.
+type EmailLookup struct {
+	// Protected rate limits and pads lookups by callers outside
+	// TrustedRoles and without the admin token.
+	Protected  bool          `env:"EMAIL_LOOKUP_PROTECTED" envDefault:"false"`
+	RateLimit  int           `env:"EMAIL_LOOKUP_RATE_LIMIT" envDefault:"30"`
+	MinLatency time.Duration `env:"EMAIL_LOOKUP_MIN_LATENCY" envDefault:"250ms"`
+	// TrustedRoles are role names, as in ROLE_TOKENS, that always get fast
+	// exact answers, e.g. internal services.
+	TrustedRoles []string `env:"EMAIL_LOOKUP_TRUSTED_ROLES" envSeparator:","`
+}
+
+// Consistency tunes the entitlement consistency check.
+type Consistency struct {
+	// StaleAfter is how long past its end time a subscription or trial flag
+	// may stay set before the check reports it.
+	StaleAfter time.Duration `env:"CONSISTENCY_CHECK_STALE_AFTER" envDefault:"24h"`
+	BatchSize  int           `env:"CONSISTENCY_CHECK_BATCH_SIZE" envDefault:"500"`
+}
+
+type Campaign struct {
+	BatchSize int `env:"CAMPAIGN_BATCH_SIZE" envDefault:"500"`
+}
+
+// PublicIDs controls prefixed public IDs such as usr_01j9x3k7q8m2r5t6v7w8x9y0z1.
+// They are accepted as input either way.
+type PublicIDs struct {
+	// Output writes IDs in responses in their public form instead of as
+	// bare UUIDs.
+	Output bool `env:"PUBLIC_IDS_OUTPUT" envDefault:"false"`
+}
+
+// PII sets application-level encryption of user emails and names. A key
+// and a hash key are needed whenever encrypted rows may exist, so turning
+// encryption off again keeps them readable.
+type PII struct {
+	// EncryptionEnabled encrypts emails and names as they are written and
+	// runs the backfill that encrypts the rows stored before.
+	EncryptionEnabled bool `env:"PII_ENCRYPTION_ENABLED" envDefault:"false"`
+	// KeyID is stored with every value; give a new key a new ID.
+	KeyID string `env:"PII_KEY_ID" envDefault:"k1"`
+	// Key or KeyFile holds the base64 32-byte key-encryption key.
+	Key     string `env:"PII_KEY"`
+	KeyFile string `env:"PII_KEY_FILE"`
+	// EmailHashKey is the base64 key, of at least 32 bytes, of the hashes
+	// emails are looked up by. Changing it loses every stored hash.
+	EmailHashKey string `env:"PII_EMAIL_HASH_KEY"`
+}
+
+// Configured reports whether a key is set, i.e. stored values can be decrypted.
+func (p PII) Configured() bool {
+	return p.Key != "" || p.KeyFile != ""
+}
+
+// JSON picks the encoder responses are written with.
+type JSON struct {
+	// Encoder is std or go-json; go-json needs a binary built with the
+	// gojson tag.
+	Encoder string `env:"JSON_ENCODER" envDefault:"std"`
 }
 
 type Config struct {
-	DB DB
+	DB           DB
+	User         User
+	Validation   Validation
+	Logging      Logging
+	Cache        Cache
+	Breaker      Breaker
+	Audit        Audit
+	Admin        Admin
+	Leader       Leader
+	Idempotency  Idempotency
+	Janitor      Janitor
+	FeatureFlags FeatureFlags
+	Catalog      Catalog
+	Jobs         Jobs
+	Campaign     Campaign
+	EmailLookup  EmailLookup
+	Consistency  Consistency
+	PublicIDs    PublicIDs
+	PII          PII
+	JSON         JSON
 }
 
 func Load() (*Config, error) {
@@ -23,5 +310,213 @@ func Load() (*Config, error) {
 	if err := env.Parse(cfg); err != nil {
 		return nil, err
 	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
+
+// Validate rejects values that parse but cannot work.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.DB.MaxOpenConns <= 0 {
+		errs = append(errs, errors.New("DB_MAX_OPEN_CONNS must be greater than 0"))
+	}
+	if c.DB.ReservedInteractiveConns < 1 {
+		errs = append(errs, errors.New("DB_RESERVED_INTERACTIVE_CONNS must be at least 1"))
+	} else if c.HeavyOpConns() < 1 {
+		errs = append(errs, fmt.Errorf("DB_MAX_OPEN_CONNS must leave room for heavy operations beyond DB_RESERVED_INTERACTIVE_CONNS, the health check connection and, with LEADER_ELECTION_ENABLED, the leader's connection, got %d of %d reserved",
+			c.DB.ReservedInteractiveConns+c.setAsideConns(), c.DB.MaxOpenConns))
+	}
+	if c.User.EmailVerificationTTL <= 0 {
+		errs = append(errs, errors.New("EMAIL_VERIFICATION_TTL must be greater than 0"))
+	}
+	if c.User.SignupBonusCoins < 0 {
+		errs = append(errs, errors.New("SIGNUP_BONUS_COINS must not be negative"))
+	}
+	if c.Validation.MinNameLength < 1 || c.Validation.MinNameLength > 100 {
+		errs = append(errs, fmt.Errorf("MIN_NAME_LENGTH must be in [1, 100], got %d", c.Validation.MinNameLength))
+	}
+	if c.Catalog.StatsCacheTTL < 0 {
+		errs = append(errs, errors.New("CATALOG_STATS_CACHE_TTL must not be negative"))
+	}
+	if c.Validation.InvalidInputPolicy != domain.InvalidInputReject && c.Validation.InvalidInputPolicy != domain.InvalidInputClamp {
+		errs = append(errs, errors.New("INVALID_INPUT_POLICY must be reject or clamp"))
+	}
+	if c.Consistency.StaleAfter <= 0 {
+		errs = append(errs, errors.New("CONSISTENCY_CHECK_STALE_AFTER must be greater than 0"))
+	}
+	if c.Consistency.BatchSize <= 0 {
+		errs = append(errs, errors.New("CONSISTENCY_CHECK_BATCH_SIZE must be greater than 0"))
+	}
+	if c.EmailLookup.RateLimit < 0 {
+		errs = append(errs, errors.New("EMAIL_LOOKUP_RATE_LIMIT must not be negative"))
+	}
+	if c.EmailLookup.MinLatency < 0 {
+		errs = append(errs, errors.New("EMAIL_LOOKUP_MIN_LATENCY must not be negative"))
+	}
+	if c.Logging.SlowRequestThreshold <= 0 {
+		errs = append(errs, errors.New("SLOW_REQUEST_THRESHOLD must be greater than 0"))
+	}
+	if c.Cache.TTL <= 0 {
+		errs = append(errs, errors.New("CACHE_TTL must be greater than 0"))
+	}
+	if c.Cache.ShadowSampleRate < 0 || c.Cache.ShadowSampleRate > 1 {
+		errs = append(errs, fmt.Errorf("CACHE_SHADOW_SAMPLE_RATE must be in [0, 1], got %v", c.Cache.ShadowSampleRate))
+	}
+	if c.Breaker.Window <= 0 {
+		errs = append(errs, errors.New("DB_BREAKER_WINDOW must be greater than 0"))
+	}
+	if c.Breaker.ErrorRateThreshold <= 0 || c.Breaker.ErrorRateThreshold > 1 {
+		errs = append(errs, fmt.Errorf("DB_BREAKER_ERROR_RATE must be in (0, 1], got %v", c.Breaker.ErrorRateThreshold))
+	}
+	if c.Breaker.CoolDown <= 0 {
+		errs = append(errs, errors.New("DB_BREAKER_COOL_DOWN must be greater than 0"))
+	}
+	if c.Audit.KafkaReadyTimeout <= 0 {
+		errs = append(errs, errors.New("AUDIT_KAFKA_READY_TIMEOUT must be greater than 0"))
+	}
+	if c.Audit.Workers <= 0 {
+		errs = append(errs, errors.New("AUDIT_WORKERS must be greater than 0"))
+	}
+	if c.Audit.QueueDepth <= 0 {
+		errs = append(errs, errors.New("AUDIT_QUEUE_DEPTH must be greater than 0"))
+	}
+	if len(c.Audit.Sinks) == 0 {
+		errs = append(errs, errors.New("AUDIT_SINKS must name at least one sink"))
+	}
+	for _, sink := range c.Audit.Sinks {
+		switch sink {
+		case AuditSinkKafka, AuditSinkLog, AuditSinkHTTP:
+		default:
+			errs = append(errs, fmt.Errorf("AUDIT_SINKS: unknown sink %q, want kafka, log or http", sink))
+		}
+	}
+	if c.Audit.HasSink(AuditSinkHTTP) {
+		if c.Audit.HTTPURL == "" {
+			errs = append(errs, errors.New("AUDIT_HTTP_URL is required when the http audit sink is enabled"))
+		}
+		if c.Audit.HTTPTimeout <= 0 {
+			errs = append(errs, errors.New("AUDIT_HTTP_TIMEOUT must be greater than 0"))
+		}
+	}
+	for role, token := range c.Admin.RoleTokens {
+		if role == "" || token == "" {
+			errs = append(errs, errors.New("ROLE_TOKENS entries need both a role and a token"))
+			break
+		}
+	}
+	if len(c.Audit.EventAllowlist) > 0 && len(c.Audit.EventDenylist) > 0 {
+		errs = append(errs, errors.New("AUDIT_EVENT_ALLOWLIST and AUDIT_EVENT_DENYLIST are mutually exclusive"))
+	}
+	for name, list := range map[string][]string{
+		"AUDIT_EVENT_ALLOWLIST": c.Audit.EventAllowlist,
+		"AUDIT_EVENT_DENYLIST":  c.Audit.EventDenylist,
+	} {
+		for _, eventType := range list {
+			if !domain.IsKnownAuditEventType(eventType) {
+				errs = append(errs, fmt.Errorf("%s: unknown audit event type %q", name, eventType))
+			}
+		}
+	}
+	if c.Audit.Required && !c.Audit.HasSink(AuditSinkKafka) {
+		errs = append(errs, errors.New("AUDIT_REQUIRED needs the kafka audit sink"))
+	}
+	if c.Leader.RenewInterval <= 0 {
+		errs = append(errs, errors.New("LEADER_RENEW_INTERVAL must be greater than 0"))
+	}
+	if c.Idempotency.KeyTTL <= 0 {
+		errs = append(errs, errors.New("IDEMPOTENCY_KEY_TTL must be greater than 0"))
+	}
+	if c.Idempotency.CleanupInterval <= 0 {
+		errs = append(errs, errors.New("IDEMPOTENCY_CLEANUP_INTERVAL must be greater than 0"))
+	}
+	if c.Janitor.BatchPause < 0 {
+		errs = append(errs, errors.New("JANITOR_BATCH_PAUSE must not be negative"))
+	}
+	for name, p := range map[string]JanitorPolicy{
+		"JANITOR_EMAIL_VERIFICATION_TOKENS_": c.Janitor.EmailVerificationTokens,
+		"JANITOR_SLUG_RESERVATIONS_":         c.Janitor.SlugReservations,
+	} {
+		if p.MaxAge < 0 || p.BatchSize <= 0 || p.Interval <= 0 {
+			errs = append(errs, fmt.Errorf("%sMAX_AGE must not be negative and %[1]sBATCH_SIZE and %[1]sINTERVAL must be greater than 0", name))
+		}
+	}
+	// Burn rates are computed from the ledger, so it must reach back over
+	// the longest window one can ask for
+	minLedgerRetention := time.Duration(domain.MaxBurnRateWindowDays) * 24 * time.Hour
+	if c.Janitor.CoinLedger.MaxAge != 0 && c.Janitor.CoinLedger.MaxAge < minLedgerRetention {
+		errs = append(errs, fmt.Errorf("JANITOR_COIN_LEDGER_MAX_AGE must be 0 or at least %v, the longest burn rate window", minLedgerRetention))
+	}
+	if c.Janitor.CoinLedger.BatchSize <= 0 || c.Janitor.CoinLedger.Interval <= 0 {
+		errs = append(errs, errors.New("JANITOR_COIN_LEDGER_BATCH_SIZE and JANITOR_COIN_LEDGER_INTERVAL must be greater than 0"))
+	}
+	if c.Jobs.ExpirySweepInterval <= 0 {
+		errs = append(errs, errors.New("JOBS_EXPIRY_SWEEP_INTERVAL must be greater than 0"))
+	}
+	if c.Jobs.ExpirySweepBatchSize <= 0 {
+		errs = append(errs, errors.New("JOBS_EXPIRY_SWEEP_BATCH_SIZE must be greater than 0"))
+	}
+	if c.Jobs.AccountErasureInterval <= 0 {
+		errs = append(errs, errors.New("JOBS_ACCOUNT_ERASURE_INTERVAL must be greater than 0"))
+	}
+	if c.Jobs.AccountErasureBatchSize <= 0 {
+		errs = append(errs, errors.New("JOBS_ACCOUNT_ERASURE_BATCH_SIZE must be greater than 0"))
+	}
+	if c.User.DeletionGracePeriod <= 0 {
+		errs = append(errs, errors.New("USER_DELETION_GRACE_PERIOD must be greater than 0"))
+	}
+	if c.User.LegacyTrialPolicy != domain.LegacyTrialDeny && c.User.LegacyTrialPolicy != domain.LegacyTrialGrant {
+		errs = append(errs, errors.New("LEGACY_TRIAL_POLICY must be deny or grant"))
+	}
+	if c.User.TrialLength <= 0 {
+		errs = append(errs, errors.New("TRIAL_LENGTH must be greater than 0"))
+	}
+	if c.Jobs.LegacyTrialBackfillInterval <= 0 {
+		errs = append(errs, errors.New("JOBS_LEGACY_TRIAL_BACKFILL_INTERVAL must be greater than 0"))
+	}
+	if c.Jobs.LegacyTrialBackfillBatchSize <= 0 {
+		errs = append(errs, errors.New("JOBS_LEGACY_TRIAL_BACKFILL_BATCH_SIZE must be greater than 0"))
+	}
+	if c.Jobs.PIIBackfillInterval <= 0 {
+		errs = append(errs, errors.New("JOBS_PII_BACKFILL_INTERVAL must be greater than 0"))
+	}
+	if c.Jobs.PIIBackfillBatchSize <= 0 {
+		errs = append(errs, errors.New("JOBS_PII_BACKFILL_BATCH_SIZE must be greater than 0"))
+	}
+	if c.PII.Key != "" && c.PII.KeyFile != "" {
+		errs = append(errs, errors.New("PII_KEY and PII_KEY_FILE are mutually exclusive"))
+	}
+	if c.PII.EncryptionEnabled && !c.PII.Configured() {
+		errs = append(errs, errors.New("PII_ENCRYPTION_ENABLED needs PII_KEY or PII_KEY_FILE"))
+	}
+	if c.PII.Key != "" {
+		if key, err := pii.ParseKey(c.PII.Key); err != nil || len(key) != pii.KeySize {
+			errs = append(errs, fmt.Errorf("PII_KEY must be %d base64-encoded bytes", pii.KeySize))
+		}
+	}
+	if c.PII.Configured() {
+		if key, err := pii.ParseKey(c.PII.EmailHashKey); err != nil || len(key) < pii.MinHashKeySize {
+			errs = append(errs, fmt.Errorf("PII_EMAIL_HASH_KEY must be at least %d base64-encoded bytes when a PII key is set", pii.MinHashKeySize))
+		}
+	}
+	if c.Catalog.MaxProductsPerCategory < 0 {
+		errs = append(errs, errors.New("CATALOG_MAX_PRODUCTS_PER_CATEGORY must not be negative"))
+	}
+	if c.Catalog.MaxProductContentBytes < 0 {
+		errs = append(errs, errors.New("CATALOG_MAX_PRODUCT_CONTENT_BYTES must not be negative"))
+	}
+	if c.Catalog.ViewFlushInterval <= 0 {
+		errs = append(errs, errors.New("CATALOG_VIEW_FLUSH_INTERVAL must be greater than 0"))
+	}
+	if c.Catalog.ViewFlushThreshold <= 0 {
+		errs = append(errs, errors.New("CATALOG_VIEW_FLUSH_THRESHOLD must be greater than 0"))
+	}
+	if c.Campaign.BatchSize <= 0 {
+		errs = append(errs, errors.New("CAMPAIGN_BATCH_SIZE must be greater than 0"))
+	}
+	if _, err := jsonenc.Lookup(c.JSON.Encoder); err != nil {
+		errs = append(errs, fmt.Errorf("JSON_ENCODER: %v", err))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/caarlos0/env/v11"
+)
+
+// defaults parses a config from nothing but the required variables, plus
+// any overrides.
+func defaults(t *testing.T, overrides map[string]string) *Config {
+	t.Helper()
+	vars := map[string]string{"DATABASE_URL": "postgres://localhost/test"}
+	for k, v := range overrides {
+		vars[k] = v
+	}
+	cfg := &Config{}
+	if err := env.ParseWithOptions(cfg, env.Options{Environment: vars}); err != nil {
+		t.Fatalf("parse config: %v", err)
+	}
+	return cfg
+}
+
+func TestDefaultsAreValid(t *testing.T) {
+	if err := defaults(t, nil).Validate(); err != nil {
+		t.Fatalf("default config: %v", err)
+	}
+}
+
+func TestHeavyOpConnsSetsAsideLeaderConn(t *testing.T) {
+	tests := []struct {
+		leader string
+		want   int
+	}{
+		{"false", 1},
+		{"true", 0},
+	}
+	for _, tt := range tests {
+		cfg := defaults(t, map[string]string{
+			"DB_MAX_OPEN_CONNS":             "6",
+			"DB_RESERVED_INTERACTIVE_CONNS": "4",
+			"LEADER_ELECTION_ENABLED":       tt.leader,
+		})
+		if got := cfg.HeavyOpConns(); got != tt.want {
+			t.Errorf("leader election %s: HeavyOpConns = %d, want %d", tt.leader, got, tt.want)
+		}
+
+		err := cfg.Validate()
+		if tt.want > 0 && err != nil {
+			t.Errorf("leader election %s: %v", tt.leader, err)
+		}
+		if tt.want == 0 && (err == nil || !strings.Contains(err.Error(), "got 6 of 6 reserved")) {
+			t.Errorf("leader election %s: got %v, want the pool rejected with 6 of 6 reserved", tt.leader, err)
+		}
+	}
+}
+
+func TestJSONEncoderMustBeCompiledIn(t *testing.T) {
+	if err := defaults(t, map[string]string{"JSON_ENCODER": "std"}).Validate(); err != nil {
+		t.Errorf("JSON_ENCODER=std: %v", err)
+	}
+	err := defaults(t, map[string]string{"JSON_ENCODER": "simdjson"}).Validate()
+	if err == nil || !strings.Contains(err.Error(), "JSON_ENCODER") {
+		t.Errorf("JSON_ENCODER=simdjson: got %v, want it rejected", err)
+	}
+}
+
+func TestCoinLedgerRetentionCoversBurnRateWindow(t *testing.T) {
+	tests := []struct {
+		maxAge string
+		valid  bool
+	}{
+		{"0s", true},
+		{"8760h", true},
+		{"17520h", true},
+		{"8759h", false},
+		{"720h", false},
+	}
+	for _, tt := range tests {
+		err := defaults(t, map[string]string{"JANITOR_COIN_LEDGER_MAX_AGE": tt.maxAge}).Validate()
+		if tt.valid && err != nil {
+			t.Errorf("JANITOR_COIN_LEDGER_MAX_AGE=%s: %v", tt.maxAge, err)
+		}
+		if !tt.valid && (err == nil || !strings.Contains(err.Error(), "JANITOR_COIN_LEDGER_MAX_AGE")) {
+			t.Errorf("JANITOR_COIN_LEDGER_MAX_AGE=%s: got %v, want it rejected", tt.maxAge, err)
+		}
+	}
+}
+
+func TestAuditSinks(t *testing.T) {
+	tests := []struct {
+		vars    map[string]string
+		wantErr string
+	}{
+		{map[string]string{"AUDIT_SINKS": "kafka,log"}, ""},
+		{map[string]string{"AUDIT_SINKS": "kafka,log,http", "AUDIT_HTTP_URL": "http://collector/audit"}, ""},
+		{map[string]string{"AUDIT_SINKS": "log,http"}, "AUDIT_HTTP_URL"},
+		{map[string]string{"AUDIT_SINKS": "kafka,syslog"}, `unknown sink "syslog"`},
+		{map[string]string{"AUDIT_SINKS": "log", "AUDIT_REQUIRED": "true"}, "AUDIT_REQUIRED"},
+	}
+	for _, tt := range tests {
+		cfg := defaults(t, tt.vars)
+		err := cfg.Validate()
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%v: %v", tt.vars, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%v: got %v, want it rejected for %s", tt.vars, err, tt.wantErr)
+		}
+	}
+
+	cfg := defaults(t, map[string]string{"AUDIT_SINKS": "kafka,log"})
+	if !cfg.Audit.HasSink(AuditSinkKafka) || !cfg.Audit.HasSink(AuditSinkLog) || cfg.Audit.HasSink(AuditSinkHTTP) {
+		t.Errorf("AUDIT_SINKS=kafka,log parsed as %v", cfg.Audit.Sinks)
+	}
+}
+
+func TestAuditEventListsAreExclusive(t *testing.T) {
+	tests := []struct {
+		allow, deny string
+		wantErr     string
+	}{
+		{"", "", ""},
+		{"user_created,order_completed", "", ""},
+		{"", "user_updated", ""},
+		{"user_created", "user_updated", "mutually exclusive"},
+		// Naming the same type in both is still a conflict
+		{"user_created", "user_created", "mutually exclusive"},
+		{"user_created,user_renamed", "", `AUDIT_EVENT_ALLOWLIST: unknown audit event type "user_renamed"`},
+		{"", "user_created, user_updated", `AUDIT_EVENT_DENYLIST: unknown audit event type " user_updated"`},
+	}
+	for _, tt := range tests {
+		vars := map[string]string{}
+		if tt.allow != "" {
+			vars["AUDIT_EVENT_ALLOWLIST"] = tt.allow
+		}
+		if tt.deny != "" {
+			vars["AUDIT_EVENT_DENYLIST"] = tt.deny
+		}
+		err := defaults(t, vars).Validate()
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("allow %q, deny %q: %v", tt.allow, tt.deny, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("allow %q, deny %q: got %v, want it rejected with %q", tt.allow, tt.deny, err, tt.wantErr)
+		}
+	}
+
+	// A variable set but empty is no list at all
+	cfg := defaults(t, map[string]string{"AUDIT_EVENT_ALLOWLIST": "", "AUDIT_EVENT_DENYLIST": "user_updated"})
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("empty allowlist with a denylist: %v", err)
+	}
+}
+
+func TestProductsActiveByDefault(t *testing.T) {
+	if !defaults(t, nil).Catalog.ProductsActiveByDefault {
+		t.Error("products are inactive by default, want active")
+	}
+	if defaults(t, map[string]string{"CATALOG_PRODUCTS_ACTIVE_BY_DEFAULT": "false"}).Catalog.ProductsActiveByDefault {
+		t.Error("CATALOG_PRODUCTS_ACTIVE_BY_DEFAULT=false left products active by default")
+	}
+}
+
+func TestRejectInactiveCategoryIsOptIn(t *testing.T) {
+	if defaults(t, nil).Catalog.RejectInactiveCategory {
+		t.Error("products in inactive categories are rejected by default, want allowed")
+	}
+	if !defaults(t, map[string]string{"CATALOG_REJECT_INACTIVE_CATEGORY": "true"}).Catalog.RejectInactiveCategory {
+		t.Error("CATALOG_REJECT_INACTIVE_CATEGORY=true did not enable the check")
+	}
+}
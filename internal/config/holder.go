@@ -0,0 +1,154 @@
+package config
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/joho/godotenv"
+	log "github.com/sirupsen/logrus"
+)
+
+// Holder keeps the current configuration snapshot and swaps it on reload.
+// Readers call Current per use and must not modify the returned Config.
+type Holder struct {
+	current atomic.Pointer[Config]
+	envFile string
+
+	mu        sync.Mutex
+	listeners []func(*Config)
+}
+
+// NewHolder wraps an initial configuration. envFile, when set, is re-read on
+// every reload so changes to it take effect without a restart.
+func NewHolder(cfg *Config, envFile string) *Holder {
+	h := &Holder{envFile: envFile}
+	h.current.Store(cfg)
+	return h
+}
+
+func (h *Holder) Current() *Config {
+	return h.current.Load()
+}
+
+// OnReload registers f to be called with the new snapshot after each successful reload.
+func (h *Holder) OnReload(f func(*Config)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners = append(h.listeners, f)
+}
+
+// Reload re-parses the environment and swaps in the result. A configuration
+// that fails to parse or validate is rejected and the old one stays in place.
+// Structural settings cannot change at runtime: their new values are discarded
+// and the names of the affected sections are returned.
+func (h *Holder) Reload() ([]string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.envFile != "" {
+		if err := godotenv.Overload(h.envFile); err != nil {
+			log.WithError(err).WithField("file", h.envFile).Warn("Could not re-read env file on config reload")
+		}
+	}
+
+	next, err := Load()
+	if err != nil {
+		log.WithError(err).Error("Config reload rejected, keeping current configuration")
+		return nil, err
+	}
+
+	ignored := keepStructural(h.current.Load(), next)
+	if len(ignored) > 0 {
+		log.WithField("sections", ignored).Warn("Config reload ignored changes to settings that require a restart")
+	}
+
+	h.current.Store(next)
+	for _, f := range h.listeners {
+		f(next)
+	}
+
+	log.Info("Configuration reloaded")
+	return ignored, nil
+}
+
+// keepStructural copies settings that are only read at startup from old into
+// next and reports which of them differed.
+func keepStructural(old, next *Config) []string {
+	var ignored []string
+	if next.DB != old.DB {
+		ignored = append(ignored, "DB")
+		next.DB = old.DB
+	}
+	// Audit holds the sink list, so it can't be compared with !=
+	if !reflect.DeepEqual(next.Audit, old.Audit) {
+		ignored = append(ignored, "Audit")
+		next.Audit = old.Audit
+	}
+	if !reflect.DeepEqual(next.Admin, old.Admin) {
+		ignored = append(ignored, "Admin")
+		next.Admin = old.Admin
+	}
+	// EmailLookup holds the trusted role list, so it can't be compared with !=
+	if !reflect.DeepEqual(next.EmailLookup, old.EmailLookup) {
+		ignored = append(ignored, "EmailLookup")
+		next.EmailLookup = old.EmailLookup
+	}
+	if next.Consistency != old.Consistency {
+		ignored = append(ignored, "Consistency")
+		next.Consistency = old.Consistency
+	}
+	if next.PublicIDs != old.PublicIDs {
+		ignored = append(ignored, "PublicIDs")
+		next.PublicIDs = old.PublicIDs
+	}
+	if next.PII != old.PII {
+		ignored = append(ignored, "PII")
+		next.PII = old.PII
+	}
+	if next.JSON != old.JSON {
+		ignored = append(ignored, "JSON")
+		next.JSON = old.JSON
+	}
+	if next.Leader != old.Leader {
+		ignored = append(ignored, "Leader")
+		next.Leader = old.Leader
+	}
+	// The cache's TTL and shadow settings can change at runtime, not whether
+	// it exists or how many users it holds
+	if next.Cache.Enabled != old.Cache.Enabled {
+		ignored = append(ignored, "Cache.Enabled")
+		next.Cache.Enabled = old.Cache.Enabled
+	}
+	if next.Cache.MaxEntries != old.Cache.MaxEntries {
+		ignored = append(ignored, "Cache.MaxEntries")
+		next.Cache.MaxEntries = old.Cache.MaxEntries
+	}
+	if next.Idempotency != old.Idempotency {
+		ignored = append(ignored, "Idempotency")
+		next.Idempotency = old.Idempotency
+	}
+	if next.Janitor != old.Janitor {
+		ignored = append(ignored, "Janitor")
+		next.Janitor = old.Janitor
+	}
+	// Only the product caps of Catalog can change at runtime
+	maxProducts, maxContent := next.Catalog.MaxProductsPerCategory, next.Catalog.MaxProductContentBytes
+	next.Catalog.MaxProductsPerCategory = old.Catalog.MaxProductsPerCategory
+	next.Catalog.MaxProductContentBytes = old.Catalog.MaxProductContentBytes
+	if next.Catalog != old.Catalog {
+		ignored = append(ignored, "Catalog")
+		next.Catalog = old.Catalog
+	}
+	next.Catalog.MaxProductsPerCategory = maxProducts
+	next.Catalog.MaxProductContentBytes = maxContent
+	if next.Jobs != old.Jobs {
+		ignored = append(ignored, "Jobs")
+		next.Jobs = old.Jobs
+	}
+	if next.Breaker.Enabled != old.Breaker.Enabled {
+		ignored = append(ignored, "Breaker.Enabled")
+		next.Breaker.Enabled = old.Breaker.Enabled
+	}
+	return ignored
+}
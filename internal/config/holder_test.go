@@ -0,0 +1,167 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// loadHolder sets the required variables and returns a holder of the
+// configuration they load.
+func loadHolder(t *testing.T) *Holder {
+	t.Helper()
+	t.Setenv("DATABASE_URL", "postgres://localhost/test")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return NewHolder(cfg, "")
+}
+
+func TestReloadSwapsInNewConfig(t *testing.T) {
+	h := loadHolder(t)
+	old := h.Current()
+	var notified *Config
+	h.OnReload(func(cfg *Config) { notified = cfg })
+
+	t.Setenv("SIGNUP_BONUS_COINS", "500")
+	t.Setenv("TRIAL_LENGTH", "96h")
+	ignored, err := h.Reload()
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if len(ignored) != 0 {
+		t.Errorf("Reload ignored %v, want nothing", ignored)
+	}
+
+	cfg := h.Current()
+	if cfg.User.SignupBonusCoins != 500 || cfg.User.TrialLength != 96*time.Hour {
+		t.Errorf("after reload bonus %d, trial %v: want 500 and 96h", cfg.User.SignupBonusCoins, cfg.User.TrialLength)
+	}
+	if notified != cfg {
+		t.Error("listener was not called with the new config")
+	}
+	if old.User.SignupBonusCoins != 200 {
+		t.Errorf("reload modified the old snapshot: bonus %d", old.User.SignupBonusCoins)
+	}
+}
+
+func TestReloadRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name, key, value string
+	}{
+		{"fails to parse", "SIGNUP_BONUS_COINS", "lots"},
+		{"fails to validate", "EMAIL_VERIFICATION_TTL", "0s"},
+		{"misses a required variable", "DATABASE_URL", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := loadHolder(t)
+			old := h.Current()
+			snapshot := *old
+			notified := false
+			h.OnReload(func(*Config) { notified = true })
+
+			t.Setenv(tt.key, tt.value)
+			if tt.value == "" {
+				os.Unsetenv(tt.key)
+			}
+			if _, err := h.Reload(); err == nil {
+				t.Fatal("Reload accepted an invalid config")
+			}
+			if h.Current() != old || !reflect.DeepEqual(*h.Current(), snapshot) {
+				t.Error("rejected reload replaced the config")
+			}
+			if notified {
+				t.Error("listener was called for a rejected reload")
+			}
+		})
+	}
+}
+
+func TestReloadKeepsStructuralSettings(t *testing.T) {
+	h := loadHolder(t)
+
+	t.Setenv("DB_MAX_OPEN_CONNS", "32")
+	t.Setenv("LEADER_ELECTION_ENABLED", "false")
+	t.Setenv("CATALOG_UNCATEGORIZED_SLUG", "misc")
+	t.Setenv("CATALOG_MAX_PRODUCTS_PER_CATEGORY", "50")
+	t.Setenv("SIGNUP_BONUS_COINS", "10")
+	ignored, err := h.Reload()
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if want := []string{"DB", "Leader", "Catalog"}; !reflect.DeepEqual(ignored, want) {
+		t.Errorf("ignored %v, want %v", ignored, want)
+	}
+
+	cfg := h.Current()
+	if cfg.DB.MaxOpenConns != 16 || !cfg.Leader.Enabled || cfg.Catalog.UncategorizedSlug != "uncategorized" {
+		t.Errorf("structural settings changed: %d conns, leader %v, slug %q", cfg.DB.MaxOpenConns, cfg.Leader.Enabled, cfg.Catalog.UncategorizedSlug)
+	}
+	if cfg.Catalog.MaxProductsPerCategory != 50 || cfg.User.SignupBonusCoins != 10 {
+		t.Errorf("runtime settings not applied: cap %d, bonus %d", cfg.Catalog.MaxProductsPerCategory, cfg.User.SignupBonusCoins)
+	}
+}
+
+// TestReadersSeeWholeSnapshots reloads between two configurations while
+// readers run, and checks no reader sees a mix of the two. Run with -race.
+func TestReadersSeeWholeSnapshots(t *testing.T) {
+	h := loadHolder(t)
+	t.Setenv("SIGNUP_BONUS_COINS", "200")
+	t.Setenv("TRIAL_LENGTH", "72h")
+
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	errs := make(chan string, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stop.Load() {
+				cfg := h.Current()
+				bonus, trial := cfg.User.SignupBonusCoins, cfg.User.TrialLength
+				if !(bonus == 200 && trial == 72*time.Hour) && !(bonus == 500 && trial == 96*time.Hour) {
+					errs <- "mixed snapshot"
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 200; i++ {
+		if i%2 == 0 {
+			os.Setenv("SIGNUP_BONUS_COINS", "500")
+			os.Setenv("TRIAL_LENGTH", "96h")
+		} else {
+			os.Setenv("SIGNUP_BONUS_COINS", "200")
+			os.Setenv("TRIAL_LENGTH", "72h")
+		}
+		if _, err := h.Reload(); err != nil {
+			t.Fatalf("Reload: %v", err)
+		}
+	}
+	stop.Store(true)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadRejectsConflictingAuditLists(t *testing.T) {
+	t.Setenv("AUDIT_EVENT_ALLOWLIST", "user_created")
+	h := loadHolder(t)
+	old := h.Current()
+
+	t.Setenv("AUDIT_EVENT_DENYLIST", "user_updated")
+	if _, err := h.Reload(); err == nil {
+		t.Fatal("Reload accepted both an allowlist and a denylist")
+	}
+	if h.Current() != old || len(h.Current().Audit.EventDenylist) != 0 {
+		t.Error("rejected reload replaced the config")
+	}
+}
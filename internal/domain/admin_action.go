@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Admin actions: the user mutations recorded when an admin makes them on
+// someone else's account. Where one exists they match the audit event type.
+const (
+	AdminActionUserUpdated           = AuditUserUpdated
+	AdminActionCoinsAdded            = AuditUserCoinsAdded
+	AdminActionCoinsDeducted         = AuditUserCoinsDeducted
+	AdminActionCoinsTransferred      = AuditUserCoinsTransferred
+	AdminActionSubscriptionActivated = AuditSubscriptionActivated
+	AdminActionSubscriptionRenewed   = AuditSubscriptionRenewed
+	AdminActionDeletionRequested     = AuditDeletionRequested
+	AdminActionDeletionCancelled     = AuditDeletionCancelled
+	AdminActionUserDeleted           = "user_deleted"
+	AdminActionUserRestored          = "user_restored"
+)
+
+// AdminAction is one change an admin made to a user.
+type AdminAction struct {
+	ID        int64           `json:"id"`
+	UserID    string          `json:"user_id"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Details   json.RawMessage `json:"details"`
+	CreatedAt time.Time       `json:"created_at"`
+}
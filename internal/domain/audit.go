@@ -1,8 +1,114 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"time"
+)
 
+// Audit replay bounds
+const (
+	DefaultAuditReplayRate = 50
+	MaxAuditReplayRate     = 1000
+)
+
+var (
+	ErrInvalidReplayRange = errors.New("replay needs from before to")
+	ErrInvalidReplayRate  = errors.New("rate_per_second must be between 1 and 1000")
+	ErrReplayInProgress   = errors.New("an audit replay is already running")
+	ErrReplayUnavailable  = errors.New("audit replay needs the kafka audit sink")
+)
+
+// Audit event types. Every event the service publishes uses one of these;
+// configuration that names event types is checked against this list.
+const (
+	AuditUserCreated           = "user_created"
+	AuditUserUpdated           = "user_updated"
+	AuditUserCoinsAdded        = "user_coins_added"
+	AuditUserCoinsDeducted     = "user_coins_deducted"
+	AuditUserCoinsDepleted     = "user_coins_depleted"
+	AuditUserCoinsGranted      = "user_coins_granted"
+	AuditUserCoinsTransferred  = "user_coins_transferred"
+	AuditSubscriptionActivated = "user_subscription_activated"
+	AuditSubscriptionRenewed   = "user_subscription_renewed"
+	AuditEmailVerificationSent = "user_email_verification_sent"
+	AuditEmailVerified         = "user_email_verified"
+	AuditOrderCompleted        = "order_completed"
+	AuditOrderRefunded         = "order_refunded"
+	AuditProductPurchased      = "product_purchased"
+	AuditDeletionRequested     = "user_deletion_requested"
+	AuditDeletionCancelled     = "user_deletion_cancelled"
+	AuditUserErased            = "user_erased"
+	AuditEntitlementRepaired   = "user_entitlement_repaired"
+)
+
+var knownAuditEventTypes = map[string]bool{
+	AuditUserCreated:           true,
+	AuditUserUpdated:           true,
+	AuditUserCoinsAdded:        true,
+	AuditUserCoinsDeducted:     true,
+	AuditUserCoinsDepleted:     true,
+	AuditUserCoinsGranted:      true,
+	AuditUserCoinsTransferred:  true,
+	AuditSubscriptionActivated: true,
+	AuditSubscriptionRenewed:   true,
+	AuditEmailVerificationSent: true,
+	AuditEmailVerified:         true,
+	AuditOrderCompleted:        true,
+	AuditOrderRefunded:         true,
+	AuditProductPurchased:      true,
+	AuditDeletionRequested:     true,
+	AuditDeletionCancelled:     true,
+	AuditUserErased:            true,
+	AuditEntitlementRepaired:   true,
+}
+
+// IsKnownAuditEventType reports whether eventType is one the service publishes.
+func IsKnownAuditEventType(eventType string) bool {
+	return knownAuditEventTypes[eventType]
+}
+
+// AuditEventFilter decides which event types leave the service. With Allow
+// set only those types pass; otherwise every type not in Deny passes. The
+// zero value lets everything through.
+type AuditEventFilter struct {
+	Allow map[string]bool
+	Deny  map[string]bool
+}
+
+// NewAuditEventFilter builds a filter from an allowlist or a denylist; at
+// most one of them may be non-empty.
+func NewAuditEventFilter(allow, deny []string) AuditEventFilter {
+	var f AuditEventFilter
+	if len(allow) > 0 {
+		f.Allow = make(map[string]bool, len(allow))
+		for _, t := range allow {
+			f.Allow[t] = true
+		}
+	}
+	if len(deny) > 0 {
+		f.Deny = make(map[string]bool, len(deny))
+		for _, t := range deny {
+			f.Deny[t] = true
+		}
+	}
+	return f
+}
+
+// Allows reports whether events of eventType may be published.
+func (f AuditEventFilter) Allows(eventType string) bool {
+	if f.Allow != nil {
+		return f.Allow[eventType]
+	}
+	return !f.Deny[eventType]
+}
+
+// AuditEvent describes an action for the audit log. OccurredAt is when the
+// action happened; it is set by the service that performed the action, and
+// publishers only fill it in when it is zero. ID identifies the event to
+// consumers, which dedupe on it; it is assigned once, when the event is first
+// published, and kept when the event is replayed.
 type AuditEvent struct {
+	ID         string                 `json:"id"`
 	Service    string                 `json:"service"`
 	EventType  string                 `json:"event_type"`
 	EntityID   string                 `json:"entity_id"`
@@ -10,3 +116,36 @@ type AuditEvent struct {
 	OccurredAt time.Time              `json:"occurred_at"`
 	Payload    map[string]interface{} `json:"payload"`
 }
+
+// AuditReplayRequest selects the stored events to re-publish: those that
+// occurred in [From, To), optionally of one EventType.
+type AuditReplayRequest struct {
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	EventType     string    `json:"event_type,omitempty"`
+	RatePerSecond int       `json:"rate_per_second,omitempty"`
+}
+
+// AuditReplayStatus reports the progress of the current or last replay.
+type AuditReplayStatus struct {
+	Request   AuditReplayRequest `json:"request"`
+	Running   bool               `json:"running"`
+	Published int64              `json:"published"`
+	Failed    int64              `json:"failed"`
+	// Skipped counts stored events held back by the audit event filter.
+	Skipped    int64      `json:"skipped"`
+	FailedIDs  []string   `json:"failed_ids,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+func ValidateAuditReplayRequest(req AuditReplayRequest) error {
+	if req.From.IsZero() || req.To.IsZero() || !req.From.Before(req.To) {
+		return ErrInvalidReplayRange
+	}
+	if req.RatePerSecond < 1 || req.RatePerSecond > MaxAuditReplayRate {
+		return ErrInvalidReplayRate
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package domain
+
+import "testing"
+
+func TestAuditEventFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		allow, deny []string
+		passes      map[string]bool
+	}{
+		{"neither", nil, nil, map[string]bool{AuditUserCreated: true, AuditUserUpdated: true}},
+		{"allowlist", []string{AuditUserCreated}, nil, map[string]bool{AuditUserCreated: true, AuditUserUpdated: false}},
+		{"denylist", nil, []string{AuditUserUpdated}, map[string]bool{AuditUserCreated: true, AuditUserUpdated: false}},
+		{"empty lists", []string{}, []string{}, map[string]bool{AuditUserCreated: true}},
+		// Config validation rejects both lists; should they get here, the allowlist decides
+		{"both", []string{AuditUserCreated}, []string{AuditUserCreated, AuditUserUpdated}, map[string]bool{AuditUserCreated: true, AuditUserUpdated: false, AuditOrderCompleted: false}},
+	}
+	for _, tt := range tests {
+		f := NewAuditEventFilter(tt.allow, tt.deny)
+		for eventType, want := range tt.passes {
+			if got := f.Allows(eventType); got != want {
+				t.Errorf("%s: Allows(%s) = %v, want %v", tt.name, eventType, got, want)
+			}
+		}
+	}
+
+	var zero AuditEventFilter
+	if !zero.Allows(AuditUserErased) {
+		t.Errorf("zero filter holds back events")
+	}
+}
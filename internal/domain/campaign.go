@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	maxCampaignReasonLength = 255
+)
+
+// Campaign status constants
+const (
+	CampaignStatusRunning   = "running"
+	CampaignStatusCompleted = "completed"
+)
+
+var (
+	ErrCampaignNotFound      = errors.New("campaign not found")
+	ErrInvalidCampaignReason = errors.New("invalid campaign reason")
+	ErrInvalidCampaignFilter = errors.New("invalid campaign filter")
+)
+
+// CoinCampaignFilter selects the cohort of users a coin campaign grants to.
+// nil fields are not applied.
+type CoinCampaignFilter struct {
+	Status        *UserStatus `json:"status,omitempty"`
+	IsTrial       *bool       `json:"is_trial,omitempty"`
+	CreatedBefore *time.Time  `json:"created_before,omitempty"`
+	CreatedAfter  *time.Time  `json:"created_after,omitempty"`
+}
+
+type CoinCampaign struct {
+	ID          string             `json:"id"`
+	Filter      CoinCampaignFilter `json:"filter"`
+	Amount      int64              `json:"amount"`
+	Reason      string             `json:"reason"`
+	Status      string             `json:"status"`
+	Total       int64              `json:"total"`
+	Processed   int64              `json:"processed"`
+	Failed      int64              `json:"failed"`
+	LastUserID  *string            `json:"-"`
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+	CompletedAt *time.Time         `json:"completed_at,omitempty"`
+}
+
+type CreateCoinCampaignRequest struct {
+	Filter CoinCampaignFilter `json:"filter"`
+	Amount int64              `json:"amount"`
+	Reason string             `json:"reason"`
+}
+
+func ValidateCampaignReason(reason string) error {
+	if strings.TrimSpace(reason) == "" || len(reason) > maxCampaignReasonLength {
+		return ErrInvalidCampaignReason
+	}
+	return nil
+}
+
+func ValidateCampaignFilter(filter CoinCampaignFilter) error {
+	if filter.CreatedBefore != nil && filter.CreatedAfter != nil && !filter.CreatedAfter.Before(*filter.CreatedBefore) {
+		return ErrInvalidCampaignFilter
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package domain
+
+import (
+	"errors"
+	"regexp"
+	"time"
+)
+
+// Coin transaction directions
+const (
+	CoinDirectionCredit = "credit"
+	CoinDirectionDebit  = "debit"
+)
+
+// Coin transaction reasons: what caused a balance change.
+const (
+	CoinReasonPurchase          = "coin_purchase"
+	CoinReasonSpend             = "spend"
+	CoinReasonSignupBonus       = "signup_bonus"
+	CoinReasonSubscriptionBonus = "subscription_bonus"
+	CoinReasonCampaignGrant     = "campaign_grant"
+	CoinReasonCheckout          = "checkout"
+	CoinReasonRefund            = "refund"
+	CoinReasonTransferOut       = "transfer_out"
+	CoinReasonTransferIn        = "transfer_in"
+	// CoinReasonOpeningBalance marks the entry the ledger retention job
+	// leaves in place of the entries it pruned: a credit of the balance they
+	// ended on, dated at the last of them.
+	CoinReasonOpeningBalance = "opening_balance"
+)
+
+// Coin ledger categories group entries by what the coins were spent on or
+// came from. Checkout and refund entries are categorized by the slug of
+// their products' category instead, and entries written before categories
+// existed, or by flows without one, are reported as CoinCategoryOther.
+const (
+	CoinCategorySubscription = "subscription"
+	CoinCategoryTransfer     = "transfer"
+	// CoinCategoryMixed marks an order spanning several product categories.
+	CoinCategoryMixed = "mixed"
+	CoinCategoryOther = "other"
+)
+
+// MaxCoinReasonLength bounds caller-supplied ledger reasons.
+const MaxCoinReasonLength = 64
+
+var (
+	ErrInvalidCoinReason  = errors.New("reason must be 1 to 64 lowercase letters, digits or underscores")
+	ErrReservedCoinReason = errors.New("reason is reserved for coins moved by the service itself")
+)
+
+// reservedCoinReasons are the reasons the service writes for its own balance
+// changes. Callers may not use them, so the ledger entries carrying them can
+// be trusted to come from the flows they name.
+var reservedCoinReasons = map[string]bool{
+	CoinReasonSignupBonus:       true,
+	CoinReasonSubscriptionBonus: true,
+	CoinReasonCampaignGrant:     true,
+	CoinReasonCheckout:          true,
+	CoinReasonRefund:            true,
+	CoinReasonTransferOut:       true,
+	CoinReasonTransferIn:        true,
+	CoinReasonOpeningBalance:    true,
+}
+
+var coinReasonPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// ValidateCoinReason checks a ledger reason supplied by a caller, such as
+// "coin_purchase" or "promo_code". Reasons are free-form so new sources of
+// coins need no code change, but kept to identifiers so they group cleanly,
+// and the reserved ones are rejected with ErrReservedCoinReason.
+func ValidateCoinReason(reason string) error {
+	if len(reason) > MaxCoinReasonLength || !coinReasonPattern.MatchString(reason) {
+		return ErrInvalidCoinReason
+	}
+	if reservedCoinReasons[reason] {
+		return ErrReservedCoinReason
+	}
+	return nil
+}
+
+// CoinTransaction is one entry of a user's coin ledger. Amount is always
+// positive; Direction tells whether it was credited or debited, and Delta is
+// the signed change to the balance. Checkout and refund entries name their
+// order, a refund entry names its refund and the checkout entry it
+// reverses, and a campaign grant names its campaign.
+type CoinTransaction struct {
+	ID           int64     `json:"id"`
+	UserID       string    `json:"user_id"`
+	Amount       int64     `json:"amount"`
+	Direction    string    `json:"direction"`
+	Delta        int64     `json:"delta"`
+	Reason       string    `json:"reason"`
+	Category     string    `json:"category"`
+	BalanceAfter int64     `json:"balance_after"`
+	OrderID      *string   `json:"order_id,omitempty"`
+	RefundID     *string   `json:"refund_id,omitempty"`
+	ReversesID   *int64    `json:"reverses_id,omitempty"`
+	CampaignID   *string   `json:"campaign_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// CoinLedgerDiscrepancy is a ledger entry whose balance_after does not follow
+// from the entry before it, the trace of a balance change written without its
+// ledger entry or of an entry written without its balance change.
+type CoinLedgerDiscrepancy struct {
+	TransactionID int64 `json:"transaction_id"`
+	PreviousID    int64 `json:"previous_id"`
+	// Expected is the previous entry's balance_after plus this entry's delta.
+	Expected     int64 `json:"expected"`
+	BalanceAfter int64 `json:"balance_after"`
+	// Gap is how far balance_after is from Expected.
+	Gap int64 `json:"gap"`
+}
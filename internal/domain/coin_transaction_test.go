@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateCoinReason(t *testing.T) {
+	tests := []struct {
+		reason string
+		want   error
+	}{
+		{CoinReasonPurchase, nil},
+		{CoinReasonSpend, nil},
+		{"promo_code", nil},
+		{"", ErrInvalidCoinReason},
+		{"Promo Code", ErrInvalidCoinReason},
+		{CoinReasonRefund, ErrReservedCoinReason},
+		{CoinReasonSignupBonus, ErrReservedCoinReason},
+		{CoinReasonSubscriptionBonus, ErrReservedCoinReason},
+		{CoinReasonTransferIn, ErrReservedCoinReason},
+		{CoinReasonOpeningBalance, ErrReservedCoinReason},
+		// Named by callers, not written by the service
+		{"admin_grant", nil},
+	}
+	for _, tt := range tests {
+		if err := ValidateCoinReason(tt.reason); !errors.Is(err, tt.want) {
+			t.Errorf("ValidateCoinReason(%q) = %v, want %v", tt.reason, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package domain
+
+// Entitlement inconsistencies: a subscription or trial flag that is set
+// although its end time is missing or long past.
+const (
+	InconsistencySubscriptionNoEnd   = "subscription_without_end"
+	InconsistencySubscriptionExpired = "subscription_long_expired"
+	InconsistencyTrialNoEnd          = "trial_without_end"
+	InconsistencyTrialExpired        = "trial_long_expired"
+)
+
+// MaxConsistencySample caps the inconsistent users listed in a report; the
+// counts cover all of them.
+const MaxConsistencySample = 100
+
+// EntitlementInconsistency lists what is wrong with one user's flags.
+type EntitlementInconsistency struct {
+	UserID string   `json:"user_id"`
+	Issues []string `json:"issues"`
+}
+
+// EntitlementConsistencyReport is the outcome of a consistency check. Without
+// Repair it is a dry run and Repaired is 0.
+type EntitlementConsistencyReport struct {
+	Repair   bool                       `json:"repair"`
+	Found    int64                      `json:"found"`
+	Repaired int64                      `json:"repaired"`
+	ByIssue  map[string]int64           `json:"by_issue"`
+	Sample   []EntitlementInconsistency `json:"sample"`
+}
+
+// Reconcile batch sizes: the default and the most one request may fix.
+const (
+	DefaultReconcileBatchSize = 1000
+	MaxReconcileBatchSize     = 5000
+)
+
+// ReconcileBatchReport is the outcome of one reconcile batch. More is set
+// when the batch was full, so another call may find further users to fix.
+type ReconcileBatchReport struct {
+	Limit int   `json:"limit"`
+	Fixed int64 `json:"fixed"`
+	More  bool  `json:"more"`
+}
@@ -0,0 +1,25 @@
+package domain
+
+import "errors"
+
+var (
+	ErrInvalidIdempotencyKey = errors.New("idempotency key must be at most 255 printable ASCII characters")
+	ErrIdempotencyKeyReused  = errors.New("idempotency key was already used for a different request")
+)
+
+// MaxIdempotencyKeyLength bounds client-supplied idempotency keys.
+const MaxIdempotencyKeyLength = 255
+
+// ValidateIdempotencyKey accepts an empty key, meaning none, or up to
+// MaxIdempotencyKeyLength printable ASCII characters.
+func ValidateIdempotencyKey(key string) error {
+	if len(key) > MaxIdempotencyKeyLength {
+		return ErrInvalidIdempotencyKey
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return ErrInvalidIdempotencyKey
+		}
+	}
+	return nil
+}
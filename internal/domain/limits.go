@@ -0,0 +1,173 @@
+package domain
+
+import "time"
+
+// SlugPattern describes product and category slugs: no spaces, at most
+// MaxLength bytes.
+const SlugPattern = `^[^ ]+$`
+
+// Limits is the machine-readable form of the validation limits, built from
+// the same constants the validators use so clients never drift from them.
+type Limits struct {
+	User         UserLimits         `json:"user"`
+	Coins        CoinLimits         `json:"coins"`
+	Subscription SubscriptionLimits `json:"subscription"`
+	List         ListLimits         `json:"list"`
+	Product      ProductLimits      `json:"product"`
+	Category     CategoryLimits     `json:"category"`
+	Checkout     CheckoutLimits     `json:"checkout"`
+	Campaign     CampaignLimits     `json:"campaign"`
+	Report       ReportLimits       `json:"report"`
+	Audit        AuditLimits        `json:"audit"`
+	Reconcile    ReconcileLimits    `json:"reconcile"`
+	// MaxRequestBodyBytes also bounds product metadata, which has no limit of its own.
+	MaxRequestBodyBytes     int `json:"max_request_body_bytes"`
+	MaxIdempotencyKeyLength int `json:"max_idempotency_key_length"`
+}
+
+type UserLimits struct {
+	MaxEmailLength int    `json:"max_email_length"`
+	EmailPattern   string `json:"email_pattern"`
+	MinNameLength  int    `json:"min_name_length"`
+	MaxNameLength  int    `json:"max_name_length"`
+}
+
+type CoinLimits struct {
+	MaxAmount       int64  `json:"max_amount"`
+	MaxReasonLength int    `json:"max_reason_length"`
+	ReasonPattern   string `json:"reason_pattern"`
+}
+
+type SubscriptionLimits struct {
+	TrialSeconds     int64 `json:"trial_seconds"`
+	MaxDurationHours int   `json:"max_duration_hours"`
+}
+
+type ListLimits struct {
+	MaxLimit  int `json:"max_limit"`
+	MaxOffset int `json:"max_offset"`
+	// InvalidInputPolicy is reject or clamp: what a page beyond the maxima gets.
+	InvalidInputPolicy string `json:"invalid_input_policy"`
+}
+
+type SlugLimits struct {
+	Pattern   string `json:"pattern"`
+	MaxLength int    `json:"max_length"`
+}
+
+type ProductLimits struct {
+	Slug                   SlugLimits `json:"slug"`
+	MinNameLength          int        `json:"min_name_length"`
+	MaxNameLength          int        `json:"max_name_length"`
+	MinPriceCoins          int64      `json:"min_price_coins"`
+	MaxPriceCoins          int64      `json:"max_price_coins"`
+	MinPriceAdjustment     int        `json:"min_price_adjustment_percent"`
+	MaxPriceAdjustment     int        `json:"max_price_adjustment_percent"`
+	MaxImportRows          int        `json:"max_import_rows"`
+	MaxSlugOwnerLength     int        `json:"max_slug_owner_length"`
+	MaxSlugReservationSecs int64      `json:"max_slug_reservation_seconds"`
+	// MaxPerCategory is 0 when categories are unlimited.
+	MaxPerCategory int `json:"max_per_category"`
+	// MaxContentBytes caps description and metadata together; 0 means unlimited.
+	MaxContentBytes int `json:"max_content_bytes"`
+}
+
+type CategoryLimits struct {
+	Slug          SlugLimits `json:"slug"`
+	MinNameLength int        `json:"min_name_length"`
+	MaxNameLength int        `json:"max_name_length"`
+	// MaxSlugLookup bounds the slugs of one by-slugs lookup.
+	MaxSlugLookup int `json:"max_slug_lookup"`
+}
+
+type CheckoutLimits struct {
+	MaxItems    int `json:"max_items"`
+	MaxQuantity int `json:"max_quantity"`
+}
+
+type CampaignLimits struct {
+	MaxReasonLength int `json:"max_reason_length"`
+}
+
+type ReportLimits struct {
+	MaxBurnRateWindowDays int `json:"max_burn_rate_window_days"`
+	MaxProductStatsDays   int `json:"max_product_stats_days"`
+}
+
+type AuditLimits struct {
+	MaxReplayRate int `json:"max_replay_rate"`
+}
+
+type ReconcileLimits struct {
+	MaxBatchSize int `json:"max_batch_size"`
+}
+
+// ValidationLimits assembles the limits in force. minNameLength,
+// maxPerCategory, maxContentBytes, invalidInputPolicy and trialLength come
+// from configuration; everything else is fixed here.
+func ValidationLimits(minNameLength, maxPerCategory, maxContentBytes int, invalidInputPolicy string, trialLength time.Duration) Limits {
+	if minNameLength < DefaultMinNameLength {
+		minNameLength = DefaultMinNameLength
+	}
+	return Limits{
+		User: UserLimits{
+			MaxEmailLength: MaxEmailLength,
+			EmailPattern:   EmailPattern,
+			MinNameLength:  minNameLength,
+			MaxNameLength:  MaxNameLength,
+		},
+		Coins: CoinLimits{
+			MaxAmount:       MaxCoinsAmount,
+			MaxReasonLength: MaxCoinReasonLength,
+			ReasonPattern:   coinReasonPattern.String(),
+		},
+		Subscription: SubscriptionLimits{
+			TrialSeconds:     int64(trialLength / time.Second),
+			MaxDurationHours: MaxSubscriptionDurationHours,
+		},
+		List: ListLimits{
+			MaxLimit:           MaxListLimit,
+			MaxOffset:          MaxListOffset,
+			InvalidInputPolicy: invalidInputPolicy,
+		},
+		Product: ProductLimits{
+			Slug:                   SlugLimits{Pattern: SlugPattern, MaxLength: maxProductSlugLength},
+			MinNameLength:          minNameLength,
+			MaxNameLength:          maxProductNameLength,
+			MinPriceCoins:          MinProductPrice,
+			MaxPriceCoins:          MaxProductPrice,
+			MinPriceAdjustment:     minPriceAdjustmentPercent,
+			MaxPriceAdjustment:     maxPriceAdjustmentPercent,
+			MaxImportRows:          MaxProductImportRows,
+			MaxSlugOwnerLength:     maxSlugOwnerLength,
+			MaxSlugReservationSecs: int64(MaxSlugReservationTTL / time.Second),
+			MaxPerCategory:         maxPerCategory,
+			MaxContentBytes:        maxContentBytes,
+		},
+		Category: CategoryLimits{
+			Slug:          SlugLimits{Pattern: SlugPattern, MaxLength: maxCategorySlugLength},
+			MinNameLength: minNameLength,
+			MaxNameLength: maxCategoryNameLength,
+			MaxSlugLookup: MaxCategorySlugLookup,
+		},
+		Checkout: CheckoutLimits{
+			MaxItems:    maxCheckoutItems,
+			MaxQuantity: maxCheckoutQuantity,
+		},
+		Campaign: CampaignLimits{
+			MaxReasonLength: maxCampaignReasonLength,
+		},
+		Report: ReportLimits{
+			MaxBurnRateWindowDays: MaxBurnRateWindowDays,
+			MaxProductStatsDays:   MaxProductStatsDays,
+		},
+		Audit: AuditLimits{
+			MaxReplayRate: MaxAuditReplayRate,
+		},
+		Reconcile: ReconcileLimits{
+			MaxBatchSize: MaxReconcileBatchSize,
+		},
+		MaxRequestBodyBytes:     MaxRequestBodySize,
+		MaxIdempotencyKeyLength: MaxIdempotencyKeyLength,
+	}
+}
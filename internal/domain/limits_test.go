@@ -0,0 +1,114 @@
+package domain
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// notLimits are bounds that are not checked against client input, so they
+// have no place in the published limits.
+var notLimits = map[string]string{
+	"MaxSlugAttempts":      "bounds the retries of generated slugs",
+	"MaxConsistencySample": "caps a report, not a request",
+}
+
+// limitName matches the constants and patterns the validators check input
+// against.
+var limitName = regexp.MustCompile(`^(?i:max|min)[A-Z]|Pattern$`)
+
+func TestEveryLimitIsPublished(t *testing.T) {
+	entries, err := os.ReadDir(".")
+	if err != nil {
+		t.Fatalf("read package: %v", err)
+	}
+	fset := token.NewFileSet()
+	declared := map[string]token.Position{}
+	published := map[string]bool{}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".go") || strings.HasSuffix(entry.Name(), "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, entry.Name(), nil, 0)
+		if err != nil {
+			t.Fatalf("parse %s: %v", entry.Name(), err)
+		}
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *ast.GenDecl:
+				if d.Tok != token.CONST && d.Tok != token.VAR {
+					continue
+				}
+				for _, spec := range d.Specs {
+					for _, name := range spec.(*ast.ValueSpec).Names {
+						if limitName.MatchString(name.Name) {
+							declared[name.Name] = fset.Position(name.Pos())
+						}
+					}
+				}
+			case *ast.FuncDecl:
+				if d.Name.Name != "ValidationLimits" {
+					continue
+				}
+				ast.Inspect(d.Body, func(n ast.Node) bool {
+					if id, ok := n.(*ast.Ident); ok {
+						published[id.Name] = true
+					}
+					return true
+				})
+			}
+		}
+	}
+
+	if len(declared) < 20 {
+		t.Fatalf("found only %d limits, the scan is broken: %v", len(declared), declared)
+	}
+	for name, pos := range declared {
+		if _, skip := notLimits[name]; skip {
+			continue
+		}
+		if !published[name] {
+			t.Errorf("%s (%s) is not in ValidationLimits", name, pos)
+		}
+	}
+}
+
+// zeroFields lists the fields of v left at their zero value, by JSON path.
+func zeroFields(v reflect.Value, path string) []string {
+	if v.Kind() == reflect.Struct {
+		var zero []string
+		for i := 0; i < v.NumField(); i++ {
+			name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+			zero = append(zero, zeroFields(v.Field(i), path+"."+name)...)
+		}
+		return zero
+	}
+	if v.IsZero() {
+		return []string{path}
+	}
+	return nil
+}
+
+func TestValidationLimitsAreFilledIn(t *testing.T) {
+	limits := ValidationLimits(3, 100, 4096, "clamp", 7*24*time.Hour)
+	if zero := zeroFields(reflect.ValueOf(limits), ""); len(zero) > 0 {
+		t.Errorf("limits left unset: %v", zero)
+	}
+
+	if limits.User.MinNameLength != 3 || limits.Product.MinNameLength != 3 || limits.Category.MinNameLength != 3 {
+		t.Errorf("configured name minimum not applied: %+v", limits)
+	}
+	if limits.Subscription.TrialSeconds != 7*24*3600 || limits.Product.MaxPerCategory != 100 || limits.Product.MaxContentBytes != 4096 {
+		t.Errorf("configured limits not applied: %+v", limits)
+	}
+	// A minimum below the floor is reported as the floor the validators use
+	if got := ValidationLimits(0, 0, 0, "reject", 0).User.MinNameLength; got != DefaultMinNameLength {
+		t.Errorf("MinNameLength = %d for a zero minimum, want %d", got, DefaultMinNameLength)
+	}
+}
@@ -2,7 +2,11 @@ package domain
 
 import (
 	"errors"
+	"regexp"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // User errors
@@ -21,35 +25,89 @@ var (
 	ErrUserIDRequired              = errors.New("user ID is required")
 	ErrEmailTooLong                = errors.New("email is too long")
 	ErrNameTooLong                 = errors.New("name is too long")
+	ErrInvalidName                 = errors.New("name is too short or has no letters or digits")
 	ErrInvalidUUID                 = errors.New("invalid user ID format")
 	ErrCoinsAmountTooLarge         = errors.New("coins amount is too large")
 	ErrListLimitTooLarge           = errors.New("list limit is too large")
 	ErrListOffsetTooLarge          = errors.New("list offset is too large")
 	ErrSubscriptionDurationTooLong = errors.New("subscription duration is too long")
-)
-
-// User status constants
-const (
-	StatusActive    = "active"
-	StatusInactive  = "inactive"
-	StatusSuspended = "suspended"
-	StatusDeleted   = "deleted"
+	ErrInvalidVerificationToken    = errors.New("invalid or expired verification token")
+	ErrEmailAlreadyVerified        = errors.New("email is already verified")
+	ErrInvalidCoinsRange           = errors.New("min_coins must not be greater than max_coins")
+	ErrDeletionAlreadyRequested    = errors.New("account deletion is already requested")
+	ErrNoDeletionRequest           = errors.New("no account deletion is pending")
+	ErrDeletionGraceExpired        = errors.New("the account deletion grace period has ended")
+	ErrUserDeleted                 = errors.New("user is deleted")
+	ErrUserNotActive               = errors.New("user is not active")
+	ErrCannotTransferToSelf        = errors.New("cannot transfer coins to the same user")
+	ErrUserNotDeleted              = errors.New("user is not deleted")
+	ErrUserErased                  = errors.New("user is erased")
 )
 
 // Validation constants
 const (
-	MaxEmailLength     = 255
-	MaxNameLength      = 100
-	MaxCoinsAmount     = 1_000_000_000 // 1 billion
-	MaxListLimit       = 100
-	MaxListOffset      = 10_000_000      // 10 million
-	MaxRequestBodySize = 1 * 1024 * 1024 // 1 MB
-	MaxSubscriptionDurationHours = 87600 // 10 years (365 * 24 * 10)
+	MaxEmailLength               = 255
+	MaxNameLength                = 100
+	DefaultMinNameLength         = 1
+	MaxCoinsAmount               = 1_000_000_000 // 1 billion
+	MaxListLimit                 = 100
+	MaxListOffset                = 10_000_000      // 10 million
+	MaxRequestBodySize           = 1 * 1024 * 1024 // 1 MB
+	MaxSubscriptionDurationHours = 87600           // 10 years (365 * 24 * 10)
+	TrialDuration                = 3 * 24 * time.Hour
+	DefaultDeletionGracePeriod   = 14 * 24 * time.Hour
 )
 
-// ValidStatuses returns list of valid user statuses
-func ValidStatuses() []string {
-	return []string{StatusActive, StatusInactive, StatusSuspended, StatusDeleted}
+// EmailPattern is the format every user email must match.
+const EmailPattern = `^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`
+
+var emailRegexp = regexp.MustCompile(EmailPattern)
+
+// IsValidEmailFormat reports whether email matches EmailPattern.
+func IsValidEmailFormat(email string) bool {
+	return emailRegexp.MatchString(email)
+}
+
+// NameMeetsMinimum reports whether name, ignoring surrounding whitespace, has
+// at least minLength characters and contains a letter or digit, so names made
+// only of punctuation or whitespace are rejected.
+func NameMeetsMinimum(name string, minLength int) bool {
+	trimmed := strings.TrimSpace(name)
+	if utf8.RuneCountInString(trimmed) < minLength {
+		return false
+	}
+	return strings.IndexFunc(trimmed, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}) >= 0
+}
+
+// NormalizeName returns name as it is stored: control and invisible format
+// characters (zero-width spaces, byte order marks, bidi overrides) removed,
+// runs of whitespace collapsed to one space, and the ends trimmed. The zero
+// width joiner and non-joiner are kept because emoji sequences and some
+// scripts need them. A name with nothing printable normalizes to "".
+func NormalizeName(name string) string {
+	fields := strings.Fields(name)
+	kept := fields[:0]
+	for _, field := range fields {
+		field = strings.Map(func(r rune) rune {
+			if isJoiner(r) {
+				return r
+			}
+			if unicode.IsControl(r) || unicode.Is(unicode.Cf, r) || r == utf8.RuneError {
+				return -1
+			}
+			return r
+		}, field)
+		if strings.TrimFunc(field, isJoiner) != "" {
+			kept = append(kept, field)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+func isJoiner(r rune) bool {
+	return r == '\u200c' || r == '\u200d'
 }
 
 type User struct {
@@ -62,20 +120,128 @@ type User struct {
 	TrialEndsAt         *time.Time `json:"trial_ends_at"`
 	HasSubscription     bool       `json:"has_subscription"`
 	SubscriptionEndsAt  *time.Time `json:"subscription_ends_at"`
-	Status              string     `json:"status"`
-	CreatedAt           time.Time  `json:"created_at"`
-	UpdatedAt           time.Time  `json:"updated_at"`
+	Status              UserStatus `json:"status"`
+	EmailVerified       bool       `json:"email_verified"`
+	// DeletionPending is set while a deletion request waits out its grace
+	// period; the account is erased at DeletionScheduledFor unless the
+	// request is cancelled first.
+	DeletionPending      bool       `json:"deletion_pending"`
+	DeletionRequestedAt  *time.Time `json:"deletion_requested_at,omitempty"`
+	DeletionScheduledFor *time.Time `json:"scheduled_for,omitempty"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+	// DeletedAt is set while the user is soft-deleted; reads skip such
+	// users unless asked to include them.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// UserListFilter narrows ListUsers. nil or empty fields are not applied.
+type UserListFilter struct {
+	MinCoins *int64
+	MaxCoins *int64
+	// Statuses keeps users in any of the listed statuses.
+	Statuses        []UserStatus
+	HasSubscription *bool
+	IsTrial         *bool
+	// IncludeDeleted also lists soft-deleted users.
+	IncludeDeleted bool
+}
+
+// Access decision reasons
+const (
+	AccessReasonSubscriptionActive = "subscription_active"
+	AccessReasonTrialActive        = "trial_active"
+	AccessReasonUserNotActive      = "user_not_active"
+	AccessReasonEmailNotVerified   = "email_not_verified"
+	AccessReasonNoEntitlement      = "no_active_subscription_or_trial"
+	AccessReasonNoSubscription     = "no_active_subscription"
+	AccessReasonNoCoins            = "no_coins"
+	AccessReasonTrialWithoutEnd    = "trial_without_end"
+)
+
+// Legacy trial policies decide access for users imported with is_trial set
+// but no trial_ends_at, until the backfill gives them one.
+const (
+	LegacyTrialDeny  = "deny"
+	LegacyTrialGrant = "grant"
+)
+
+// Capability names, as used for the keys of Capabilities.Reasons
+const (
+	CapabilityRead     = "can_read"
+	CapabilityCreate   = "can_create"
+	CapabilityPurchase = "can_purchase"
+)
+
+// Capabilities are the tiers of what a user may do: trial users can read,
+// subscribers can also create, and anyone with coins can purchase, all
+// provided the account is active and, if required, its email verified.
+type Capabilities struct {
+	CanRead     bool `json:"can_read"`
+	CanCreate   bool `json:"can_create"`
+	CanPurchase bool `json:"can_purchase"`
+	// Reasons maps each denied capability to the access reason that denied it.
+	Reasons map[string]string `json:"reasons"`
+}
+
+// AccessDecision records how an access check was evaluated so support can see
+// why it was granted or denied. Reason names the deciding check.
+type AccessDecision struct {
+	HasAccess   bool      `json:"has_access"`
+	Reason      string    `json:"reason"`
+	EvaluatedAt time.Time `json:"evaluated_at"`
+
+	Status struct {
+		Value  UserStatus `json:"value"`
+		Passed bool       `json:"passed"`
+	} `json:"status"`
+	EmailVerification struct {
+		Required bool `json:"required"`
+		Verified bool `json:"verified"`
+		Passed   bool `json:"passed"`
+	} `json:"email_verification"`
+	Subscription AccessWindow `json:"subscription"`
+	Trial        AccessWindow `json:"trial"`
+	// GracePeriod is reported for completeness; no grace period is applied
+	// after a subscription or trial ends.
+	GracePeriod struct {
+		Applicable bool `json:"applicable"`
+	} `json:"grace_period"`
+	// Capabilities are derived from the same checks; HasAccess is
+	// CanRead || CanCreate.
+	Capabilities Capabilities `json:"capabilities"`
+}
+
+// AccessWindow describes one time-limited entitlement in an AccessDecision.
+type AccessWindow struct {
+	Flag     bool       `json:"flag"`
+	EndsAt   *time.Time `json:"ends_at"`
+	InFuture bool       `json:"in_future"`
+	Active   bool       `json:"active"`
+}
+
+// SubscriptionStatus is a point-in-time view of a user's access, evaluated
+// against server time so clients don't depend on their own clock.
+type SubscriptionStatus struct {
+	Now                time.Time  `json:"now"`
+	HasAccess          bool       `json:"has_access"`
+	SubscriptionEndsAt *time.Time `json:"subscription_ends_at"`
+	TrialEndsAt        *time.Time `json:"trial_ends_at"`
+	SecondsRemaining   int64      `json:"seconds_remaining"`
 }
 
 type CreateUserRequest struct {
 	Email string `json:"email"`
 	Name  string `json:"name"`
+	// SkipSignupBonus creates the user without the signup coin grant. It is
+	// set from the admin-only grant_signup_bonus=false query parameter.
+	SkipSignupBonus bool `json:"-"`
 }
 
 type UpdateUserRequest struct {
-	Email  string  `json:"email"`
-	Name   string  `json:"name"`
-	Status *string `json:"status"` // optional
+	Email  string      `json:"email"`
+	Name   string      `json:"name"`
+	Status *UserStatus `json:"status"` // optional
 }
 
 // UpdateUserFields represents fields to update in repository
@@ -83,5 +249,20 @@ type UpdateUserRequest struct {
 type UpdateUserFields struct {
 	Email  *string
 	Name   *string
-	Status *string
+	Status *UserStatus
+}
+
+// Changes lists the fields being set and their new values.
+func (f *UpdateUserFields) Changes() map[string]interface{} {
+	changes := map[string]interface{}{}
+	if f.Email != nil {
+		changes["email"] = *f.Email
+	}
+	if f.Name != nil {
+		changes["name"] = *f.Name
+	}
+	if f.Status != nil {
+		changes["status"] = *f.Status
+	}
+	return changes
 }
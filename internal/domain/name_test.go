@@ -0,0 +1,97 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNameMinimumAcrossValidators(t *testing.T) {
+	tests := []struct {
+		name      string
+		minLength int
+		valid     bool
+	}{
+		{"A", DefaultMinNameLength, true},
+		{"7", DefaultMinNameLength, true},
+		{"A", 2, false},
+		{"Al", 2, true},
+		{"  Al  ", 3, false},
+		{"Ада", 3, true},
+		{"Ад", 3, false},
+		{"-", DefaultMinNameLength, false},
+		{"...", DefaultMinNameLength, false},
+		{"!?!?", 2, false},
+		{"- _ -", DefaultMinNameLength, false},
+		{"   ", DefaultMinNameLength, false},
+		{"\t\n", DefaultMinNameLength, false},
+		{"-A-", 3, true},
+	}
+
+	validators := map[string]struct {
+		validate func(name string, minLength int) error
+		err      error
+	}{
+		"product":  {ValidateProductName, ErrInvalidProductName},
+		"category": {ValidateCategoryName, ErrInvalidCategoryName},
+	}
+	for _, tt := range tests {
+		if got := NameMeetsMinimum(tt.name, tt.minLength); got != tt.valid {
+			t.Errorf("NameMeetsMinimum(%q, %d) = %v, want %v", tt.name, tt.minLength, got, tt.valid)
+		}
+		for kind, v := range validators {
+			want := v.err
+			if tt.valid {
+				want = nil
+			}
+			if err := v.validate(tt.name, tt.minLength); err != want {
+				t.Errorf("%s name %q with minimum %d: %v, want %v", kind, tt.name, tt.minLength, err, want)
+			}
+		}
+	}
+
+	// The maximum still applies on top of the minimum
+	long := strings.Repeat("a", MaxNameLength+200)
+	if ValidateProductName(long, DefaultMinNameLength) == nil || ValidateCategoryName(long, DefaultMinNameLength) == nil {
+		t.Errorf("overlong name accepted")
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	const (
+		zwj  = "\u200d" // zero width joiner
+		zwnj = "\u200c" // zero width non-joiner
+		zwsp = "\u200b" // zero width space
+		bom  = "\ufeff"
+		rlm  = "\u200f" // right-to-left mark
+		rlo  = "\u202e" // right-to-left override
+		pdf  = "\u202c" // pop directional formatting
+	)
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"مريم الأحمد", "مريم الأحمد"},
+		{"  דוד   כהן ", "דוד כהן"},
+		{"Ada 👩" + zwj + "💻", "Ada 👩" + zwj + "💻"},
+		{"👨" + zwj + "👩" + zwj + "👧", "👨" + zwj + "👩" + zwj + "👧"},
+		{"Ivan 🇺🇦", "Ivan 🇺🇦"},
+		{"José", "José"},
+		{"می" + zwnj + "خواهم", "می" + zwnj + "خواهم"},
+		{rlo + "evil" + pdf, "evil"},
+		{rlm + "سارا" + rlm + " Smith", "سارا Smith"},
+		{bom + "Ada" + zwsp + " Lovelace", "Ada Lovelace"},
+		{"Ada\tLovelace\n", "Ada Lovelace"},
+		{"Ada\x00\x07", "Ada"},
+		{"Ada \xff", "Ada"},
+		{zwsp + "\u2060" + bom, ""},
+		{zwj + " " + zwnj, ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeName(tt.name); got != tt.want {
+			t.Errorf("NormalizeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if got := NormalizeName(tt.want); got != tt.want {
+			t.Errorf("NormalizeName(%q) is not stable: %q", tt.want, got)
+		}
+	}
+}
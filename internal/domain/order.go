@@ -0,0 +1,144 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	maxCheckoutItems    = 50
+	maxCheckoutQuantity = 1000
+)
+
+// Order status constants
+const (
+	OrderStatusCompleted         = "completed"
+	OrderStatusRefunded          = "refunded"
+	OrderStatusPartiallyRefunded = "partially_refunded"
+)
+
+var (
+	ErrOrderNotFound            = errors.New("order not found")
+	ErrEmptyCheckout            = errors.New("checkout must contain at least one item")
+	ErrTooManyCheckoutItems     = errors.New("checkout has too many items")
+	ErrInvalidQuantity          = errors.New("invalid quantity")
+	ErrDuplicateCheckoutItem    = errors.New("product appears more than once in checkout")
+	ErrOutOfStock               = errors.New("product is out of stock")
+	ErrOrderItemNotFound        = errors.New("order item not found")
+	ErrOrderItemAlreadyRefunded = errors.New("order item is already refunded")
+	ErrOrderAlreadyRefunded     = errors.New("order is already fully refunded")
+	ErrPurchaseProductRequired  = errors.New("exactly one of product_id and slug is required")
+)
+
+type Order struct {
+	ID         string      `json:"id"`
+	UserID     string      `json:"user_id"`
+	TotalCoins int64       `json:"total_coins"`
+	Status     string      `json:"status"`
+	Items      []OrderItem `json:"items"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+// PurchaseQuote says whether a user's balance covers one unit of a product.
+// Shortfall is how many more coins the user needs, 0 when affordable.
+type PurchaseQuote struct {
+	Affordable bool  `json:"affordable"`
+	PriceCoins int64 `json:"price_coins"`
+	Balance    int64 `json:"balance"`
+	Shortfall  int64 `json:"shortfall"`
+}
+
+// OrderItem is one line of an order. ProductName and UnitPriceCoins are
+// snapshots taken at checkout and do not follow later catalog edits.
+type OrderItem struct {
+	ID             string     `json:"id"`
+	ProductID      string     `json:"product_id"`
+	ProductName    string     `json:"product_name"`
+	Quantity       int        `json:"quantity"`
+	UnitPriceCoins int64      `json:"unit_price_coins"`
+	TotalCoins     int64      `json:"total_coins"`
+	RefundedAt     *time.Time `json:"refunded_at,omitempty"`
+}
+
+// OrderRefund records coins returned for some or all items of an order.
+type OrderRefund struct {
+	ID          string      `json:"id"`
+	OrderID     string      `json:"order_id"`
+	UserID      string      `json:"user_id"`
+	AmountCoins int64       `json:"amount_coins"`
+	OrderStatus string      `json:"order_status"`
+	Items       []OrderItem `json:"items"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+// RefundOrderRequest selects the items to refund. No items means the whole order.
+type RefundOrderRequest struct {
+	OrderItemIDs []string `json:"order_item_ids,omitempty"`
+}
+
+type CheckoutItem struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+type CheckoutRequest struct {
+	Items []CheckoutItem `json:"items"`
+}
+
+// PurchaseRequest buys one unit of a single product, named by exactly one
+// of ProductID and Slug.
+type PurchaseRequest struct {
+	ProductID string `json:"product_id,omitempty"`
+	Slug      string `json:"slug,omitempty"`
+}
+
+// Purchase is one unit of a product bought on its own. It is carried out
+// as a one-item order, which it references and which refunds go through.
+// ProductName is the order item's snapshot.
+type Purchase struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	ProductID   string     `json:"product_id"`
+	ProductName string     `json:"product_name"`
+	OrderID     string     `json:"order_id"`
+	PriceCoins  int64      `json:"price_coins"`
+	RefundedAt  *time.Time `json:"refunded_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// LineItemError reports which checkout item caused the checkout to fail.
+type LineItemError struct {
+	Index     int
+	ProductID string
+	Err       error
+}
+
+func (e *LineItemError) Error() string {
+	return fmt.Sprintf("item %d (product %s): %v", e.Index, e.ProductID, e.Err)
+}
+
+func (e *LineItemError) Unwrap() error {
+	return e.Err
+}
+
+func ValidateCheckoutRequest(req CheckoutRequest) error {
+	if len(req.Items) == 0 {
+		return ErrEmptyCheckout
+	}
+	if len(req.Items) > maxCheckoutItems {
+		return ErrTooManyCheckoutItems
+	}
+
+	seen := make(map[string]bool, len(req.Items))
+	for i, item := range req.Items {
+		if item.Quantity <= 0 || item.Quantity > maxCheckoutQuantity {
+			return &LineItemError{Index: i, ProductID: item.ProductID, Err: ErrInvalidQuantity}
+		}
+		if seen[item.ProductID] {
+			return &LineItemError{Index: i, ProductID: item.ProductID, Err: ErrDuplicateCheckoutItem}
+		}
+		seen[item.ProductID] = true
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package domain
+
+// Invalid input policies decide what list endpoints do with a page that
+// asks for more than MaxListLimit items or starts past MaxListOffset.
+const (
+	// InvalidInputReject fails the request with ErrListLimitTooLarge or
+	// ErrListOffsetTooLarge.
+	InvalidInputReject = "reject"
+	// InvalidInputClamp serves the page cut down to the maximum instead.
+	InvalidInputClamp = "clamp"
+)
+
+// defaultListLimit is the page size of a list request that names none.
+const defaultListLimit = 10
+
+// ListPage returns the page to serve for a requested limit and offset under
+// policy. A non-positive limit means the default and a negative offset means
+// the start, whatever the policy.
+func ListPage(policy string, limit, offset int) (int, int, error) {
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if policy == InvalidInputClamp {
+		if limit > MaxListLimit {
+			limit = MaxListLimit
+		}
+		if offset > MaxListOffset {
+			offset = MaxListOffset
+		}
+		return limit, offset, nil
+	}
+	if limit > MaxListLimit {
+		return 0, 0, ErrListLimitTooLarge
+	}
+	if offset > MaxListOffset {
+		return 0, 0, ErrListOffsetTooLarge
+	}
+	return limit, offset, nil
+}
+
+// Page is one page of a list: its items, how many there are in total, and
+// the limit and offset ListPage settled on to serve it.
+type Page[T any] struct {
+	Items  []T
+	Total  int64
+	Limit  int
+	Offset int
+}
@@ -2,47 +2,148 @@ package domain
 
 import (
 	"errors"
-	"time"
+	"fmt"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
 	maxProductNameLength = 200
 	maxProductSlugLength = 50
-	minProductPrice      = 1
-	maxProductPrice      = 1_000_000_000
+	maxSlugOwnerLength   = 100
+)
+
+// Slug reservation lifetime bounds
+const (
+	DefaultSlugReservationTTL = 24 * time.Hour
+	MaxSlugReservationTTL     = 30 * 24 * time.Hour
+)
+
+// Product price bounds, inclusive
+const (
+	MinProductPrice = 1
+	MaxProductPrice = 1_000_000_000
+)
+
+// Bulk percentage price adjustment bounds
+const (
+	minPriceAdjustmentPercent = -99
+	maxPriceAdjustmentPercent = 1000
 )
 
 var (
-	ErrProductNotFound    = errors.New("product not found")
-	ErrProductSlugExists  = errors.New("product slug already exists")
-	ErrInvalidProductSlug = errors.New("invalid product slug")
-	ErrInvalidProductName = errors.New("invalid product name")
-	ErrInvalidPrice       = errors.New("invalid product price")
-	ErrProductInactive    = errors.New("product is inactive")
+	ErrProductNotFound        = errors.New("product not found")
+	ErrProductSlugExists      = errors.New("product slug already exists")
+	ErrInvalidProductSlug     = errors.New("invalid product slug")
+	ErrInvalidProductName     = errors.New("invalid product name")
+	ErrInvalidPrice           = errors.New("invalid product price")
+	ErrProductInactive        = errors.New("product is inactive")
+	ErrInvalidPriceAdjustment = errors.New("invalid price adjustment")
+	ErrInvalidStock           = errors.New("stock must not be negative")
+	ErrSlugReserved           = errors.New("slug is reserved by another owner")
+	ErrSlugReservationMissing = errors.New("slug reservation not found")
+	ErrInvalidSlugOwner       = errors.New("invalid slug reservation owner")
+	ErrInvalidReservationTTL  = errors.New("invalid slug reservation TTL")
+	ErrInvalidSortField       = errors.New("invalid sort field")
+	ErrInvalidProductMetadata = errors.New("invalid product metadata")
+	ErrCategoryFull           = errors.New("product category is full")
+	ErrCategoryInactive       = errors.New("product category is inactive")
+	ErrProductContentTooLarge = errors.New("product description and metadata are too large")
+	ErrNoFreeSlug             = errors.New("no free slug for the product")
+	ErrInvalidProductImport   = errors.New("product import must have between 1 and 500 products")
+	ErrModifiedSince          = errors.New("modified since the given time")
 )
 
+// ModifiedSinceError reports a conditional update refused because the row
+// changed after the caller's If-Unmodified-Since time.
+type ModifiedSinceError struct {
+	UpdatedAt time.Time
+}
+
+func (e *ModifiedSinceError) Error() string {
+	return fmt.Sprintf("%v: updated at %s", ErrModifiedSince, e.UpdatedAt.Format(time.RFC3339))
+}
+
+func (e *ModifiedSinceError) Unwrap() error {
+	return ErrModifiedSince
+}
+
+// CategoryFullError reports the cap that a create or category move would exceed.
+type CategoryFullError struct {
+	MaxProducts int
+}
+
+func (e *CategoryFullError) Error() string {
+	return fmt.Sprintf("%v: at most %d products per category", ErrCategoryFull, e.MaxProducts)
+}
+
+func (e *CategoryFullError) Unwrap() error {
+	return ErrCategoryFull
+}
+
+// ProductContentTooLargeError reports a description and metadata whose
+// combined size exceeds the configured cap.
+type ProductContentTooLargeError struct {
+	Bytes    int
+	MaxBytes int
+}
+
+func (e *ProductContentTooLargeError) Error() string {
+	return fmt.Sprintf("%v: %d bytes combined, at most %d allowed", ErrProductContentTooLarge, e.Bytes, e.MaxBytes)
+}
+
+func (e *ProductContentTooLargeError) Unwrap() error {
+	return ErrProductContentTooLarge
+}
+
 type Product struct {
-	ID          string    `json:"id"`
-	CategoryID  string    `json:"category_id"`
-	Slug        string    `json:"slug"`
-	Name        string    `json:"name"`
-	Description string    `json:"description,omitempty"`
-	PriceCoins  int64     `json:"price_coins"`
-	Metadata    string    `json:"metadata,omitempty"`
-	IsActive    bool      `json:"is_active"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          string `json:"id"`
+	CategoryID  string `json:"category_id"`
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	PriceCoins  int64  `json:"price_coins"`
+	Metadata    string `json:"metadata,omitempty"`
+	IsActive    bool   `json:"is_active"`
+	// Stock is the number of units left; nil means the product is unlimited.
+	Stock *int64 `json:"stock"`
+	// ViewCount is how often the product was viewed. Recent views are
+	// buffered in memory and can take a few seconds to show up.
+	ViewCount int64     `json:"view_count"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProductExpandCategory asks for the product's category to be embedded.
+const ProductExpandCategory = "category"
+
+// ProductWithCategory is a product with its category embedded. Category is
+// nil when the product points at a category that no longer exists.
+type ProductWithCategory struct {
+	Product
+	Category *ProductCategory `json:"category"`
 }
 
+// ProductSortPopularity orders public product lists by view count, most viewed first.
+const ProductSortPopularity = "popularity"
+
 type CreateProductRequest struct {
+	// ID is the ID the product is stored under, set by the service; the
+	// database generates one when it is empty.
+	ID          string `json:"-"`
 	CategoryID  string `json:"category_id"`
 	Slug        string `json:"slug"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	PriceCoins  int64  `json:"price_coins"`
 	Metadata    string `json:"metadata,omitempty"`
-	IsActive    bool   `json:"is_active"`
+	// IsActive is left nil when the client omits it; the service then
+	// applies the configured default.
+	IsActive *bool  `json:"is_active,omitempty"`
+	Stock    *int64 `json:"stock,omitempty"`
+	// Owner lets the holder of an active slug reservation create the product.
+	Owner string `json:"owner,omitempty"`
 }
 
 type UpdateProductRequest struct {
@@ -52,6 +153,167 @@ type UpdateProductRequest struct {
 	PriceCoins  *int64  `json:"price_coins,omitempty"`
 	Metadata    *string `json:"metadata,omitempty"`
 	IsActive    *bool   `json:"is_active,omitempty"`
+	Stock       *int64  `json:"stock,omitempty"`
+	// IfUnmodifiedSince comes from the If-Unmodified-Since header. When set,
+	// the update applies only if updated_at, truncated to the second, is not
+	// later than it.
+	IfUnmodifiedSince *time.Time `json:"-"`
+}
+
+// BulkPriceUpdateRequest changes the price of every product in a category.
+// Exactly one of Percent or SetCoins must be set.
+type BulkPriceUpdateRequest struct {
+	Percent  *int   `json:"percent,omitempty"`
+	SetCoins *int64 `json:"set_coins,omitempty"`
+}
+
+// productSortColumns whitelists the columns admin product lists may sort by.
+var productSortColumns = map[string]bool{
+	"created_at":  true,
+	"updated_at":  true,
+	"name":        true,
+	"slug":        true,
+	"price_coins": true,
+	"stock":       true,
+	"is_active":   true,
+	"view_count":  true,
+}
+
+// AdminProductQuery selects a page of the unfiltered admin product list.
+type AdminProductQuery struct {
+	OnlyActive bool
+	SortBy     string
+	Descending bool
+	Limit      int
+	Offset     int
+}
+
+// ValidateProductSortField accepts only whitelisted sort columns, so SortBy
+// can be interpolated into SQL.
+func ValidateProductSortField(field string) error {
+	if !productSortColumns[field] {
+		return ErrInvalidSortField
+	}
+	return nil
+}
+
+// ValidateProductListSort accepts the sort orders of public product lists:
+// "" for newest first, or ProductSortPopularity.
+func ValidateProductListSort(sort string) error {
+	if sort != "" && sort != ProductSortPopularity {
+		return ErrInvalidSortField
+	}
+	return nil
+}
+
+// SlugReservation holds a product slug for Owner until ExpiresAt so drafts
+// can claim a slug before the product exists.
+type SlugReservation struct {
+	Slug      string    `json:"slug"`
+	Owner     string    `json:"owner"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ReserveSlugRequest struct {
+	Slug       string `json:"slug"`
+	Owner      string `json:"owner"`
+	TTLSeconds int64  `json:"ttl_seconds,omitempty"`
+}
+
+type ReleaseSlugRequest struct {
+	Slug  string `json:"slug"`
+	Owner string `json:"owner"`
+}
+
+// CloneSlug returns the slug base for a copy of the product with slug,
+// "<slug>-copy", shortened so it fits the slug length limit.
+func CloneSlug(slug string) string {
+	const suffix = "-copy"
+	if len(slug)+len(suffix) > maxProductSlugLength {
+		slug = slug[:maxProductSlugLength-len(suffix)]
+	}
+	return slug + suffix
+}
+
+// MaxProductImportRows bounds the products of one bulk import.
+const MaxProductImportRows = 500
+
+// MaxSlugAttempts bounds how many suffixed candidates a generated slug tries.
+const MaxSlugAttempts = 20
+
+// ProductImportRequest creates many products at once. Rows without a slug get
+// one generated from their name.
+type ProductImportRequest struct {
+	Products []CreateProductRequest `json:"products"`
+}
+
+// ProductImportResult reports what happened to one import row: the created
+// product and the slug it was given, or why it failed.
+type ProductImportResult struct {
+	Index   int      `json:"index"`
+	Slug    string   `json:"slug,omitempty"`
+	Product *Product `json:"product,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	// Err is the failure behind Error; the server turns it into a message.
+	Err error `json:"-"`
+}
+
+// Slugify derives a product slug from name: lower-case ASCII letters and
+// digits, with every other run of characters replaced by a single dash. A
+// name with nothing usable yields "product".
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			dash = b.Len() > 0
+			continue
+		}
+		if dash {
+			if b.Len()+2 > maxProductSlugLength {
+				break
+			}
+			b.WriteByte('-')
+			dash = false
+		}
+		if b.Len()+1 > maxProductSlugLength {
+			break
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == 0 {
+		return "product"
+	}
+	return b.String()
+}
+
+// SuffixedSlug returns the n-th candidate for a generated slug: base itself
+// for n == 1 and "<base>-<n>" after that, shortened to fit the length limit.
+func SuffixedSlug(base string, n int) string {
+	if n <= 1 {
+		return base
+	}
+	suffix := "-" + strconv.Itoa(n)
+	if len(base)+len(suffix) > maxProductSlugLength {
+		base = strings.TrimRight(base[:maxProductSlugLength-len(suffix)], "-")
+	}
+	return base + suffix
+}
+
+func ValidateBulkPriceUpdate(req BulkPriceUpdateRequest) error {
+	if (req.Percent == nil) == (req.SetCoins == nil) {
+		return ErrInvalidPriceAdjustment
+	}
+	if req.Percent != nil {
+		if *req.Percent == 0 || *req.Percent < minPriceAdjustmentPercent || *req.Percent > maxPriceAdjustmentPercent {
+			return ErrInvalidPriceAdjustment
+		}
+	}
+	if req.SetCoins != nil {
+		return ValidateProductPrice(*req.SetCoins)
+	}
+	return nil
 }
 
 func ValidateProductSlug(slug string) error {
@@ -64,16 +326,40 @@ func ValidateProductSlug(slug string) error {
 	return nil
 }
 
-func ValidateProductName(name string) error {
-	if name == "" || len(name) > maxProductNameLength {
+func ValidateProductName(name string, minLength int) error {
+	if name == "" || len(name) > maxProductNameLength || !NameMeetsMinimum(name, minLength) {
 		return ErrInvalidProductName
 	}
 	return nil
 }
 
 func ValidateProductPrice(price int64) error {
-	if price < minProductPrice || price > maxProductPrice {
+	if price < MinProductPrice || price > MaxProductPrice {
 		return ErrInvalidPrice
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+func ValidateProductStock(stock *int64) error {
+	if stock != nil && *stock < 0 {
+		return ErrInvalidStock
+	}
+	return nil
+}
+
+// ValidateProductContentSize checks the combined byte size of description and
+// metadata against maxBytes; 0 means unlimited.
+func ValidateProductContentSize(description, metadata string, maxBytes int) error {
+	size := len(description) + len(metadata)
+	if maxBytes > 0 && size > maxBytes {
+		return &ProductContentTooLargeError{Bytes: size, MaxBytes: maxBytes}
+	}
+	return nil
+}
+
+func ValidateSlugOwner(owner string) error {
+	if strings.TrimSpace(owner) == "" || len(owner) > maxSlugOwnerLength {
+		return ErrInvalidSlugOwner
+	}
+	return nil
+}
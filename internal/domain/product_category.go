@@ -1,7 +1,9 @@
 package domain
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 )
@@ -11,30 +13,113 @@ const (
 	maxCategorySlugLength = 50
 )
 
+// MaxCategorySlugLookup caps the slugs of one bulk category lookup.
+const MaxCategorySlugLookup = 100
+
 var (
-	ErrCategoryNotFound    = errors.New("product category not found")
-	ErrCategorySlugExists  = errors.New("product category slug already exists")
-	ErrInvalidCategorySlug = errors.New("invalid product category slug")
-	ErrInvalidCategoryName = errors.New("invalid product category name")
+	ErrCategoryNotFound      = errors.New("product category not found")
+	ErrCategorySlugExists    = errors.New("product category slug already exists")
+	ErrInvalidCategorySlug   = errors.New("invalid product category slug")
+	ErrInvalidCategoryName   = errors.New("invalid product category name")
+	ErrCategoryHasProducts   = errors.New("product category still has products")
+	ErrCategoryProtected     = errors.New("the fallback product category cannot be deleted")
+	ErrInvalidMetadataSchema = errors.New("invalid metadata schema")
+	ErrCategoryPositionTaken = errors.New("product category position is already taken")
+	ErrInvalidPositionPolicy = errors.New("on_conflict must be shift or error")
+	ErrInvalidSlugLookup     = errors.New("slugs must have between 1 and 100 entries")
 )
 
-type ProductCategory struct {
-	ID          string    `json:"id"`
-	Slug        string    `json:"slug"`
-	Name        string    `json:"name"`
-	Description string    `json:"description,omitempty"`
-	Position    int       `json:"position"`
-	IsActive    bool      `json:"is_active"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+// PositionConflict says what happens when a category is created or moved to
+// a position another category already holds.
+type PositionConflict string
+
+const (
+	// PositionConflictError rejects the write with ErrCategoryPositionTaken.
+	PositionConflictError PositionConflict = "error"
+	// PositionConflictShift inserts the category at the position and moves it
+	// and every category after it down by one.
+	PositionConflictShift PositionConflict = "shift"
+)
+
+// ParsePositionConflict reads an on_conflict value; empty means PositionConflictError.
+func ParsePositionConflict(s string) (PositionConflict, error) {
+	switch PositionConflict(s) {
+	case "", PositionConflictError:
+		return PositionConflictError, nil
+	case PositionConflictShift:
+		return PositionConflictShift, nil
+	default:
+		return "", ErrInvalidPositionPolicy
+	}
 }
 
-type CreateCategoryRequest struct {
+// SchemaError carries the details of a metadata schema problem: either the
+// schema itself is invalid or a product's metadata does not conform to it.
+type SchemaError struct {
+	Err    error
+	Detail string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("%v: %s", e.Err, e.Detail)
+}
+
+func (e *SchemaError) Unwrap() error {
+	return e.Err
+}
+
+type ProductCategory struct {
+	ID          string `json:"id"`
 	Slug        string `json:"slug"`
 	Name        string `json:"name"`
-	Description string `json:"description"`
+	Description string `json:"description,omitempty"`
 	Position    int    `json:"position"`
 	IsActive    bool   `json:"is_active"`
+	// MetadataSchema is an optional JSON schema that metadata of products in
+	// this category must conform to.
+	MetadataSchema json.RawMessage `json:"metadata_schema,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+type CreateCategoryRequest struct {
+	// ID is the ID the category is stored under, set by the service; the
+	// database generates one when it is empty.
+	ID             string          `json:"-"`
+	Slug           string          `json:"slug"`
+	Name           string          `json:"name"`
+	Description    string          `json:"description"`
+	Position       int             `json:"position"`
+	IsActive       bool            `json:"is_active"`
+	MetadataSchema json.RawMessage `json:"metadata_schema,omitempty"`
+	// OnConflict comes from the on_conflict query parameter.
+	OnConflict PositionConflict `json:"-"`
+}
+
+// CategorySlugsRequest looks up several categories by slug at once.
+type CategorySlugsRequest struct {
+	Slugs []string `json:"slugs"`
+}
+
+// NormalizeCategorySlugs trims the slugs and drops duplicates, keeping the
+// first occurrence, then checks the count and each slug.
+func NormalizeCategorySlugs(slugs []string) ([]string, error) {
+	seen := make(map[string]bool, len(slugs))
+	normalized := make([]string, 0, len(slugs))
+	for _, slug := range slugs {
+		slug = strings.TrimSpace(slug)
+		if err := ValidateCategorySlug(slug); err != nil {
+			return nil, err
+		}
+		if !seen[slug] {
+			seen[slug] = true
+			normalized = append(normalized, slug)
+		}
+	}
+	if len(normalized) == 0 || len(normalized) > MaxCategorySlugLookup {
+		return nil, ErrInvalidSlugLookup
+	}
+	return normalized, nil
 }
 
 type UpdateCategoryRequest struct {
@@ -42,6 +127,13 @@ type UpdateCategoryRequest struct {
 	Description *string `json:"description,omitempty"`
 	Position    *int    `json:"position,omitempty"`
 	IsActive    *bool   `json:"is_active,omitempty"`
+	// MetadataSchema replaces the schema when present; an explicit null removes it.
+	MetadataSchema json.RawMessage `json:"metadata_schema,omitempty"`
+	// OnConflict comes from the on_conflict query parameter.
+	OnConflict PositionConflict `json:"-"`
+	// IfUnmodifiedSince comes from the If-Unmodified-Since header; see
+	// UpdateProductRequest.
+	IfUnmodifiedSince *time.Time `json:"-"`
 }
 
 func ValidateCategorySlug(slug string) error {
@@ -54,8 +146,8 @@ func ValidateCategorySlug(slug string) error {
 	return nil
 }
 
-func ValidateCategoryName(name string) error {
-	if name == "" || len(name) > maxCategoryNameLength {
+func ValidateCategoryName(name string, minLength int) error {
+	if name == "" || len(name) > maxCategoryNameLength || !NameMeetsMinimum(name, minLength) {
 		return ErrInvalidCategoryName
 	}
 	return nil
@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateProductContentSize(t *testing.T) {
+	const limit = 64
+	tests := []struct {
+		name                  string
+		description, metadata string
+		maxBytes              int
+		wantBytes             int
+	}{
+		{"description alone at the limit", strings.Repeat("d", limit), "", limit, 0},
+		{"metadata alone at the limit", "", `{"k":"` + strings.Repeat("m", limit-8) + `"}`, limit, 0},
+		{"together at the limit", strings.Repeat("d", 40), strings.Repeat("m", 24), limit, 0},
+		{"together one byte over", strings.Repeat("d", 40), strings.Repeat("m", 25), limit, limit + 1},
+		{"each under, together over", strings.Repeat("d", 50), strings.Repeat("m", 50), limit, 100},
+		// The cap counts bytes: 32 two-byte letters fill it
+		{"multibyte at the limit", strings.Repeat("я", 32), "", limit, 0},
+		{"multibyte over", strings.Repeat("я", 32), "1", limit, limit + 1},
+		{"unlimited", strings.Repeat("d", 10000), strings.Repeat("m", 10000), 0, 0},
+	}
+	for _, tt := range tests {
+		err := ValidateProductContentSize(tt.description, tt.metadata, tt.maxBytes)
+		if tt.wantBytes == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		var tooLarge *ProductContentTooLargeError
+		if !errors.As(err, &tooLarge) || !errors.Is(err, ErrProductContentTooLarge) {
+			t.Errorf("%s: got %v, want ProductContentTooLargeError", tt.name, err)
+			continue
+		}
+		if tooLarge.Bytes != tt.wantBytes || tooLarge.MaxBytes != tt.maxBytes {
+			t.Errorf("%s: reported %d of %d bytes, want %d of %d", tt.name, tooLarge.Bytes, tooLarge.MaxBytes, tt.wantBytes, tt.maxBytes)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// Burn rate window bounds, in days
+const (
+	DefaultBurnRateWindowDays = 30
+	MaxBurnRateWindowDays     = 365
+)
+
+var ErrInvalidBurnRateWindow = errors.New("window_days must be between 1 and 365")
+
+// CoinTotals are system-wide coin aggregates used for financial reconciliation.
+type CoinTotals struct {
+	// Held is the sum of all current balances.
+	Held int64 `json:"held"`
+	// Purchased is the sum of coins ever credited through purchases and
+	// subscription bonuses. Campaign grants and refunds are not purchases.
+	Purchased int64 `json:"purchased"`
+	// Spent is the coins spent on orders net of refunds. Direct deductions
+	// through the coins API are not recorded anywhere and are not included.
+	Spent      int64     `json:"spent"`
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+// BurnRate is how fast a user spent coins over the last WindowDays days.
+type BurnRate struct {
+	UserID     string `json:"user_id"`
+	WindowDays int    `json:"window_days"`
+	// Spent is the coins debited from the user's ledger in the window.
+	Spent        int64     `json:"spent"`
+	AverageDaily float64   `json:"average_daily"`
+	From         time.Time `json:"from"`
+	To           time.Time `json:"to"`
+}
+
+func ValidateBurnRateWindow(days int) error {
+	if days < 1 || days > MaxBurnRateWindowDays {
+		return ErrInvalidBurnRateWindow
+	}
+	return nil
+}
+
+// CoinSummary totals a user's ledger entries over a range of days by
+// category.
+type CoinSummary struct {
+	UserID     string              `json:"user_id"`
+	From       string              `json:"from"`
+	To         string              `json:"to"`
+	Credited   int64               `json:"credited"`
+	Debited    int64               `json:"debited"`
+	Categories []CoinCategoryTotal `json:"categories"`
+}
+
+// CoinCategoryTotal is the coins credited to and debited from a user in one
+// ledger category, and the number of entries.
+type CoinCategoryTotal struct {
+	Category string `json:"category"`
+	Credited int64  `json:"credited"`
+	Debited  int64  `json:"debited"`
+	Entries  int64  `json:"entries"`
+}
+
+// Product stats ranges, in whole UTC days
+const (
+	DefaultProductStatsDays = 30
+	MaxProductStatsDays     = 366
+)
+
+// StatsDateLayout is the format of the days bounding a stats range.
+const StatsDateLayout = "2006-01-02"
+
+var ErrInvalidStatsRange = errors.New("from and to must be dates as YYYY-MM-DD, from not after to, at most 366 days apart")
+
+// StatsRange is a range of whole UTC days, From and To included.
+type StatsRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// ParseStatsRange reads a range from the from and to query values. Without
+// to, the range ends today; without from, it spans DefaultProductStatsDays.
+func ParseStatsRange(from, to string, now time.Time) (StatsRange, error) {
+	var r StatsRange
+	today := now.UTC().Truncate(24 * time.Hour)
+
+	r.To = today
+	if to != "" {
+		t, err := time.Parse(StatsDateLayout, to)
+		if err != nil {
+			return StatsRange{}, ErrInvalidStatsRange
+		}
+		r.To = t
+	}
+	r.From = r.To.AddDate(0, 0, -(DefaultProductStatsDays - 1))
+	if from != "" {
+		t, err := time.Parse(StatsDateLayout, from)
+		if err != nil {
+			return StatsRange{}, ErrInvalidStatsRange
+		}
+		r.From = t
+	}
+
+	if r.From.After(r.To) || r.Days() > MaxProductStatsDays {
+		return StatsRange{}, ErrInvalidStatsRange
+	}
+	return r, nil
+}
+
+// Days is the number of days in the range.
+func (r StatsRange) Days() int {
+	return int(r.To.Sub(r.From)/(24*time.Hour)) + 1
+}
+
+// ProductStats is how a product turned views into purchases over a range of
+// days. Views are counted per UTC day from when daily counts were introduced;
+// purchases and revenue come from order lines placed in the range that have
+// not been refunded.
+type ProductStats struct {
+	ProductID    string `json:"product_id"`
+	From         string `json:"from"`
+	To           string `json:"to"`
+	Views        int64  `json:"views"`
+	Purchases    int64  `json:"purchases"`
+	RevenueCoins int64  `json:"revenue_coins"`
+	// ConversionRate is purchases per view, 0 without views.
+	ConversionRate float64 `json:"conversion_rate"`
+}
+
+// SetRange fills in the range and the conversion rate.
+func (s *ProductStats) SetRange(r StatsRange) {
+	s.From = r.From.Format(StatsDateLayout)
+	s.To = r.To.Format(StatsDateLayout)
+	if s.Views > 0 {
+		s.ConversionRate = float64(s.Purchases) / float64(s.Views)
+	}
+}
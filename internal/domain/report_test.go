@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseStatsRange(t *testing.T) {
+	now := time.Date(2026, 10, 17, 15, 30, 0, 0, time.FixedZone("UTC+3", 3*3600))
+	tests := []struct {
+		name     string
+		from, to string
+		wantFrom string
+		wantTo   string
+		wantErr  error
+	}{
+		// The default is the last 30 UTC days, today included
+		{"defaults", "", "", "2026-09-18", "2026-10-17", nil},
+		{"only to", "", "2026-09-30", "2026-09-01", "2026-09-30", nil},
+		{"only from", "2026-10-01", "", "2026-10-01", "2026-10-17", nil},
+		{"one day", "2026-10-01", "2026-10-01", "2026-10-01", "2026-10-01", nil},
+		{"longest", "2025-10-01", "2026-10-01", "2025-10-01", "2026-10-01", nil},
+		{"too long", "2025-09-30", "2026-10-01", "", "", ErrInvalidStatsRange},
+		{"from after to", "2026-10-02", "2026-10-01", "", "", ErrInvalidStatsRange},
+		{"from after today", "2026-10-18", "", "", "", ErrInvalidStatsRange},
+		{"junk from", "yesterday", "", "", "", ErrInvalidStatsRange},
+		{"timestamp to", "", "2026-10-01T00:00:00Z", "", "", ErrInvalidStatsRange},
+	}
+	for _, tt := range tests {
+		got, err := ParseStatsRange(tt.from, tt.to, now)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if f, to := got.From.Format(StatsDateLayout), got.To.Format(StatsDateLayout); f != tt.wantFrom || to != tt.wantTo {
+			t.Errorf("%s: got %s to %s, want %s to %s", tt.name, f, to, tt.wantFrom, tt.wantTo)
+		}
+	}
+	if r, _ := ParseStatsRange("2025-10-01", "2026-10-01", now); r.Days() != MaxProductStatsDays {
+		t.Errorf("longest range has %d days, want %d", r.Days(), MaxProductStatsDays)
+	}
+}
+
+func TestProductStatsConversionRate(t *testing.T) {
+	rng := StatsRange{From: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2026, 10, 7, 0, 0, 0, 0, time.UTC)}
+	tests := []struct {
+		views, purchases int64
+		want             float64
+	}{
+		{200, 5, 0.025},
+		{0, 0, 0},
+		// Purchases without recorded views, e.g. before daily views were kept
+		{0, 3, 0},
+	}
+	for _, tt := range tests {
+		s := ProductStats{Views: tt.views, Purchases: tt.purchases}
+		s.SetRange(rng)
+		if s.ConversionRate != tt.want || s.From != "2026-10-01" || s.To != "2026-10-07" {
+			t.Errorf("%d views, %d purchases: got %+v, want rate %v", tt.views, tt.purchases, s, tt.want)
+		}
+	}
+}
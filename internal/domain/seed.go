@@ -0,0 +1,30 @@
+package domain
+
+import "time"
+
+// DefaultSeedUsers and DefaultSeedProductsPerCategory size the development
+// dataset. 48 users cover every combination of status, entitlement state and
+// email verification once.
+const (
+	DefaultSeedUsers               = 48
+	DefaultSeedProductsPerCategory = 5
+)
+
+// SeedEntitlements is the entitlement state a seeded user is put in.
+type SeedEntitlements struct {
+	IsTrial            bool
+	TrialEndsAt        *time.Time
+	HasSubscription    bool
+	SubscriptionEndsAt *time.Time
+	EmailVerified      bool
+}
+
+// SeedReport counts what a seeding run created and updated.
+type SeedReport struct {
+	UsersCreated      int `json:"users_created"`
+	UsersUpdated      int `json:"users_updated"`
+	CategoriesCreated int `json:"categories_created"`
+	CategoriesUpdated int `json:"categories_updated"`
+	ProductsCreated   int `json:"products_created"`
+	ProductsUpdated   int `json:"products_updated"`
+}
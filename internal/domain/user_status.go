@@ -0,0 +1,95 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// UserStatus is the lifecycle state of a user. Only the declared constants are
+// valid; decoding any other value from JSON or the database fails with
+// ErrInvalidStatus instead of silently producing an unknown state.
+type UserStatus string
+
+// User status constants
+const (
+	StatusActive    UserStatus = "active"
+	StatusInactive  UserStatus = "inactive"
+	StatusSuspended UserStatus = "suspended"
+	StatusDeleted   UserStatus = "deleted"
+)
+
+// ValidStatuses returns list of valid user statuses
+func ValidStatuses() []UserStatus {
+	return []UserStatus{StatusActive, StatusInactive, StatusSuspended, StatusDeleted}
+}
+
+// ParseUserStatus returns the status named by s.
+func ParseUserStatus(s string) (UserStatus, error) {
+	status := UserStatus(s)
+	if !status.Valid() {
+		return "", ErrInvalidStatus
+	}
+	return status, nil
+}
+
+// Valid reports whether s is one of the declared statuses.
+func (s UserStatus) Valid() bool {
+	switch s {
+	case StatusActive, StatusInactive, StatusSuspended, StatusDeleted:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s UserStatus) String() string {
+	return string(s)
+}
+
+func (s UserStatus) MarshalJSON() ([]byte, error) {
+	if !s.Valid() {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidStatus, string(s))
+	}
+	return json.Marshal(string(s))
+}
+
+func (s *UserStatus) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	status, err := ParseUserStatus(raw)
+	if err != nil {
+		return err
+	}
+	*s = status
+	return nil
+}
+
+// Scan implements sql.Scanner.
+func (s *UserStatus) Scan(src interface{}) error {
+	var raw string
+	switch v := src.(type) {
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("%w: cannot scan %T", ErrInvalidStatus, src)
+	}
+	status, err := ParseUserStatus(raw)
+	if err != nil {
+		return fmt.Errorf("%w: %q", ErrInvalidStatus, raw)
+	}
+	*s = status
+	return nil
+}
+
+// Value implements driver.Valuer.
+func (s UserStatus) Value() (driver.Value, error) {
+	if !s.Valid() {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidStatus, string(s))
+	}
+	return string(s), nil
+}
@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestUserStatusRoundTrip(t *testing.T) {
+	for _, status := range ValidStatuses() {
+		data, err := json.Marshal(status)
+		if err != nil {
+			t.Fatalf("marshal %s: %v", status, err)
+		}
+		var decoded UserStatus
+		if err := json.Unmarshal(data, &decoded); err != nil || decoded != status {
+			t.Errorf("JSON round trip of %s = %q, %v", status, decoded, err)
+		}
+
+		value, err := status.Value()
+		if err != nil {
+			t.Fatalf("value of %s: %v", status, err)
+		}
+		var scanned UserStatus
+		if err := scanned.Scan(value); err != nil || scanned != status {
+			t.Errorf("Scan(Value()) of %s = %q, %v", status, scanned, err)
+		}
+		scanned = ""
+		if err := scanned.Scan([]byte(status)); err != nil || scanned != status {
+			t.Errorf("Scan of %s as bytes = %q, %v", status, scanned, err)
+		}
+	}
+}
+
+func TestUserStatusRejectsUnknownValues(t *testing.T) {
+	for _, raw := range []string{"", "Active", "banned", " active"} {
+		if _, err := ParseUserStatus(raw); !errors.Is(err, ErrInvalidStatus) {
+			t.Errorf("ParseUserStatus(%q) error = %v, want ErrInvalidStatus", raw, err)
+		}
+
+		status := StatusActive
+		data, _ := json.Marshal(raw)
+		if err := json.Unmarshal(data, &status); !errors.Is(err, ErrInvalidStatus) {
+			t.Errorf("unmarshal %s error = %v, want ErrInvalidStatus", data, err)
+		}
+		if err := status.Scan(raw); !errors.Is(err, ErrInvalidStatus) {
+			t.Errorf("Scan(%q) error = %v, want ErrInvalidStatus", raw, err)
+		}
+		if status != StatusActive {
+			t.Errorf("failed decode of %q changed the status to %q", raw, status)
+		}
+
+		if _, err := json.Marshal(UserStatus(raw)); !errors.Is(err, ErrInvalidStatus) {
+			t.Errorf("marshal %q error = %v, want ErrInvalidStatus", raw, err)
+		}
+		if _, err := UserStatus(raw).Value(); !errors.Is(err, ErrInvalidStatus) {
+			t.Errorf("Value of %q error = %v, want ErrInvalidStatus", raw, err)
+		}
+	}
+}
+
+func TestUserStatusScanRejectsOtherTypes(t *testing.T) {
+	for _, src := range []interface{}{nil, 1, int64(1), true} {
+		var status UserStatus
+		if err := status.Scan(src); !errors.Is(err, ErrInvalidStatus) {
+			t.Errorf("Scan(%v) error = %v, want ErrInvalidStatus", src, err)
+		}
+	}
+}
+
+func TestUserStatusInStruct(t *testing.T) {
+	var user User
+	if err := json.Unmarshal([]byte(`{"status":"suspended"}`), &user); err != nil || user.Status != StatusSuspended {
+		t.Errorf("decoded status %q, %v", user.Status, err)
+	}
+	if err := json.Unmarshal([]byte(`{"status":"gone"}`), &user); !errors.Is(err, ErrInvalidStatus) {
+		t.Errorf("unknown status in a user decoded with error %v", err)
+	}
+	if err := json.Unmarshal([]byte(`{"status":7}`), &user); err == nil {
+		t.Error("numeric status decoded")
+	}
+}
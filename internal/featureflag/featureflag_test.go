@@ -0,0 +1,152 @@
+package featureflag
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"user-service/internal/reqctx"
+)
+
+const (
+	alice = "0190c2a8-7f1e-7a3b-9c4d-000000000001"
+	bob   = "0190c2a8-7f1e-7a3b-9c4d-000000000002"
+	carol = "0190c2a8-7f1e-7a3b-9c4d-000000000003"
+)
+
+// TestBucketIsStable pins the bucket of a few users. Changing the hash would
+// move users in and out of every partial rollout, so it must not change.
+func TestBucketIsStable(t *testing.T) {
+	tests := []struct {
+		flag, user string
+		want       int
+	}{
+		{"new_checkout", alice, 55},
+		{"new_checkout", bob, 74},
+		{"new_checkout", carol, 93},
+		{"dark_mode", alice, 2},
+		{"dark_mode", bob, 83},
+		{"dark_mode", carol, 64},
+	}
+	for _, tt := range tests {
+		if got := bucket(tt.flag, tt.user); got != tt.want {
+			t.Errorf("bucket(%s, %s) = %d, want %d", tt.flag, tt.user, got, tt.want)
+		}
+	}
+}
+
+func TestEnabledFollowsRollout(t *testing.T) {
+	ctx := WithUser(context.Background(), bob)
+	for rollout := 0; rollout <= 100; rollout++ {
+		set := NewSet(Definitions{"new_checkout": {Rollout: rollout}})
+		// bob is in bucket 74
+		want := rollout > 74
+		for i := 0; i < 3; i++ {
+			if got := set.Enabled(ctx, "new_checkout"); got != want {
+				t.Fatalf("rollout %d: Enabled = %v, want %v", rollout, got, want)
+			}
+		}
+	}
+}
+
+func TestAllowAndDenyLists(t *testing.T) {
+	set := NewSet(Definitions{
+		"new_checkout": {Rollout: 50, Allow: []string{carol}, Deny: []string{alice}},
+		"full":         {Rollout: 100, Deny: []string{alice}},
+		"none":         {Rollout: 0, Allow: []string{alice}},
+		"both":         {Rollout: 0, Allow: []string{bob}, Deny: []string{bob}},
+		"public":       {Rollout: 100},
+	})
+
+	tests := []struct {
+		user string
+		want map[string]bool
+	}{
+		{alice, map[string]bool{"new_checkout": false, "full": false, "none": true, "both": false, "public": true}},
+		{bob, map[string]bool{"new_checkout": false, "full": true, "none": false, "both": false, "public": true}},
+		{carol, map[string]bool{"new_checkout": true, "full": true, "none": false, "both": false, "public": true}},
+		// Anonymous callers only get fully rolled out flags
+		{"", map[string]bool{"new_checkout": false, "full": true, "none": false, "both": false, "public": true}},
+	}
+	for _, tt := range tests {
+		got := set.All(WithUser(context.Background(), tt.user))
+		for name, want := range tt.want {
+			if got[name] != want {
+				t.Errorf("user %q, flag %s: got %v, want %v", tt.user, name, got[name], want)
+			}
+		}
+	}
+}
+
+func TestEnabledDefaultsToCaller(t *testing.T) {
+	set := NewSet(Definitions{"beta": {Allow: []string{alice}}})
+
+	ctx := reqctx.WithActor(context.Background(), alice)
+	if !set.Enabled(ctx, "beta") {
+		t.Error("flag is off for the calling user on its allow list")
+	}
+	if set.Enabled(WithUser(ctx, bob), "beta") {
+		t.Error("WithUser did not override the calling user")
+	}
+	if set.Enabled(ctx, "unknown") {
+		t.Error("unknown flag is on")
+	}
+}
+
+func TestSetDefinitionsSwapsFlags(t *testing.T) {
+	ctx := WithUser(context.Background(), alice)
+	set := NewSet(nil)
+	if set.Enabled(ctx, "beta") {
+		t.Fatal("flag is on with no definitions")
+	}
+	set.SetDefinitions(Definitions{"beta": {Rollout: 100}})
+	if !set.Enabled(ctx, "beta") {
+		t.Error("flag is off after it was rolled out")
+	}
+}
+
+// TestBucketDistribution checks users spread evenly over the buckets with a
+// chi-squared test. The user IDs are fixed, so the result is too.
+func TestBucketDistribution(t *testing.T) {
+	const users = 100000
+	// The chi-squared critical value for 99 degrees of freedom at p = 0.001
+	const critical = 148.23
+
+	for _, flag := range []string{"new_checkout", "dark_mode"} {
+		var counts [100]int
+		for i := 0; i < users; i++ {
+			counts[bucket(flag, fmt.Sprintf("0190c2a8-7f1e-7a3b-9c4d-%012d", i))]++
+		}
+
+		expected := float64(users) / float64(len(counts))
+		chiSquared := 0.0
+		for _, n := range counts {
+			d := float64(n) - expected
+			chiSquared += d * d / expected
+		}
+		if chiSquared > critical {
+			t.Errorf("%s: chi-squared = %.1f over %d buckets, want at most %.1f", flag, chiSquared, len(counts), critical)
+		}
+	}
+}
+
+func TestUnmarshalText(t *testing.T) {
+	tests := []struct {
+		text    string
+		wantErr bool
+	}{
+		{`{"beta":{"rollout":25,"allow":["a"],"deny":["b"]}}`, false},
+		{`{}`, false},
+		{`{"beta":{"rollout":101}}`, true},
+		{`{"beta":{"rollout":-1}}`, true},
+		{`{"":{"rollout":10}}`, true},
+		{`not json`, true},
+	}
+	for _, tt := range tests {
+		var defs Definitions
+		err := defs.UnmarshalText([]byte(tt.text))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("UnmarshalText(%s) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+		}
+	}
+}
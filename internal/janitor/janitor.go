@@ -0,0 +1,170 @@
+// Package janitor trims auxiliary tables, such as idempotency keys and expired
+// tokens, that would otherwise grow without bound.
+package janitor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"user-service/internal/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// identifierPattern limits policy table and column names to plain SQL identifiers.
+var identifierPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// Policy describes how one table is trimmed. Policies are declared in code by
+// the feature that owns the table; configuration may only tune the numbers,
+// so the janitor never deletes from a table nobody registered.
+type Policy struct {
+	// Name identifies the policy in logs and metrics.
+	Name      string
+	Table     string
+	AgeColumn string
+	// MaxAge is how long rows are kept after the time in AgeColumn. Zero
+	// deletes rows as soon as that time has passed, which suits expires_at columns.
+	MaxAge    time.Duration
+	BatchSize int
+	Interval  time.Duration
+}
+
+func (p Policy) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("janitor policy name is required")
+	}
+	if !identifierPattern.MatchString(p.Table) || !identifierPattern.MatchString(p.AgeColumn) {
+		return fmt.Errorf("janitor policy %s: invalid table or column name", p.Name)
+	}
+	if p.MaxAge < 0 || p.BatchSize <= 0 || p.Interval <= 0 {
+		return fmt.Errorf("janitor policy %s: max age must not be negative, batch size and interval must be positive", p.Name)
+	}
+	return nil
+}
+
+// Janitor runs every registered policy on its own interval. Each pass deletes
+// in batches of at most BatchSize rows and pauses between batches, so no
+// single statement holds locks for long.
+type Janitor struct {
+	db         *sql.DB
+	batchPause time.Duration
+
+	mu       sync.Mutex
+	policies []Policy
+}
+
+func New(db *sql.DB, batchPause time.Duration) *Janitor {
+	return &Janitor{db: db, batchPause: batchPause}
+}
+
+// Register adds a policy. It must be called before Run.
+func (j *Janitor) Register(p Policy) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, existing := range j.policies {
+		if existing.Name == p.Name {
+			return fmt.Errorf("janitor policy %s is already registered", p.Name)
+		}
+	}
+	j.policies = append(j.policies, p)
+	return nil
+}
+
+// Run trims every registered table until ctx is done.
+func (j *Janitor) Run(ctx context.Context) {
+	j.mu.Lock()
+	policies := append([]Policy(nil), j.policies...)
+	j.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, p := range policies {
+		wg.Add(1)
+		go func(p Policy) {
+			defer wg.Done()
+			j.runPolicy(ctx, p)
+		}(p)
+	}
+	wg.Wait()
+}
+
+func (j *Janitor) runPolicy(ctx context.Context, p Policy) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		j.sweep(ctx, p)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep deletes batches until one comes back short, which means nothing old
+// enough is left.
+func (j *Janitor) sweep(ctx context.Context, p Policy) {
+	var total int64
+	for ctx.Err() == nil {
+		deleted, err := j.deleteBatch(ctx, p)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.WithError(err).WithField("policy", p.Name).Error("Janitor failed to delete rows")
+			}
+			break
+		}
+		total += deleted
+		metrics.JanitorRowsDeleted.Add(p.Name, deleted)
+		if deleted < int64(p.BatchSize) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(j.batchPause):
+		}
+	}
+
+	if total > 0 {
+		log.WithFields(log.Fields{
+			"policy":  p.Name,
+			"table":   p.Table,
+			"deleted": total,
+		}).Info("Janitor deleted old rows")
+	}
+}
+
+// deleteBatch removes up to BatchSize rows past their retention. Rows are
+// addressed by ctid so the policy doesn't need to know the table's key.
+func (j *Janitor) deleteBatch(ctx context.Context, p Policy) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := fmt.Sprintf(`
+		DELETE FROM %[1]s
+		WHERE ctid = ANY(ARRAY(
+			SELECT ctid FROM %[1]s
+			WHERE %[2]s < NOW() - $1 * INTERVAL '1 microsecond'
+			LIMIT $2
+		))`, p.Table, p.AgeColumn)
+
+	result, err := j.db.ExecContext(ctx, query, p.MaxAge.Microseconds(), p.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete from %s: %w", p.Table, err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected for %s: %w", p.Table, err)
+	}
+	return deleted, nil
+}
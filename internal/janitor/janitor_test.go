@@ -0,0 +1,211 @@
+package janitor
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"os"
+	"testing"
+	"time"
+
+	"user-service/internal/metrics"
+
+	_ "github.com/lib/pq"
+)
+
+// openTestDB connects to the database at TEST_DATABASE_URL and creates an
+// empty janitor_test_rows table for the test to seed. Tests that need it are
+// skipped when the variable is not set.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(`DROP TABLE IF EXISTS janitor_test_rows;
+		CREATE TABLE janitor_test_rows (id SERIAL PRIMARY KEY, created_at TIMESTAMPTZ NOT NULL)`); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	t.Cleanup(func() { db.Exec(`DROP TABLE IF EXISTS janitor_test_rows`) })
+	return db
+}
+
+// seedRows inserts n rows created age ago.
+func seedRows(t *testing.T, db *sql.DB, n int, age time.Duration) {
+	t.Helper()
+	_, err := db.Exec(
+		`INSERT INTO janitor_test_rows (created_at) SELECT NOW() - $2 * INTERVAL '1 second' FROM generate_series(1, $1)`,
+		n, int64(age.Seconds()),
+	)
+	if err != nil {
+		t.Fatalf("seed rows: %v", err)
+	}
+}
+
+func countRows(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM janitor_test_rows`).Scan(&n); err != nil {
+		t.Fatalf("count rows: %v", err)
+	}
+	return n
+}
+
+func deletedBy(policy string) int64 {
+	if v, ok := metrics.JanitorRowsDeleted.Get(policy).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func testPolicy(name string, batchSize int) Policy {
+	return Policy{
+		Name:      name,
+		Table:     "janitor_test_rows",
+		AgeColumn: "created_at",
+		MaxAge:    24 * time.Hour,
+		BatchSize: batchSize,
+		Interval:  time.Hour,
+	}
+}
+
+func TestDeleteBatchBoundaries(t *testing.T) {
+	tests := []struct {
+		name        string
+		old, fresh  int
+		batchSize   int
+		wantBatches []int64
+	}{
+		{"short last batch", 25, 5, 10, []int64{10, 10, 5}},
+		{"exact multiple", 20, 5, 10, []int64{10, 10, 0}},
+		{"one short batch", 3, 5, 10, []int64{3}},
+		{"nothing old", 0, 5, 10, []int64{0}},
+		{"batch of one", 3, 0, 1, []int64{1, 1, 1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			seedRows(t, db, tt.old, 48*time.Hour)
+			seedRows(t, db, tt.fresh, time.Hour)
+			j := New(db, 0)
+			p := testPolicy("test_batches", tt.batchSize)
+
+			// A sweep stops at the first short batch
+			var batches []int64
+			for {
+				deleted, err := j.deleteBatch(context.Background(), p)
+				if err != nil {
+					t.Fatalf("deleteBatch: %v", err)
+				}
+				batches = append(batches, deleted)
+				if deleted < int64(p.BatchSize) {
+					break
+				}
+			}
+			if len(batches) != len(tt.wantBatches) {
+				t.Fatalf("batches %v, want %v", batches, tt.wantBatches)
+			}
+			for i := range batches {
+				if batches[i] != tt.wantBatches[i] {
+					t.Fatalf("batches %v, want %v", batches, tt.wantBatches)
+				}
+			}
+			if left := countRows(t, db); left != tt.fresh {
+				t.Errorf("%d rows left, want the %d fresh ones", left, tt.fresh)
+			}
+		})
+	}
+}
+
+func TestSweepDeletesOldRowsInPausedBatches(t *testing.T) {
+	db := openTestDB(t)
+	seedRows(t, db, 25, 48*time.Hour)
+	seedRows(t, db, 5, 23*time.Hour)
+
+	const pause = 30 * time.Millisecond
+	j := New(db, pause)
+	p := testPolicy("test_sweep", 10)
+	before := deletedBy(p.Name)
+
+	start := time.Now()
+	j.sweep(context.Background(), p)
+	elapsed := time.Since(start)
+
+	if left := countRows(t, db); left != 5 {
+		t.Errorf("%d rows left, want the 5 within max age", left)
+	}
+	if got := deletedBy(p.Name) - before; got != 25 {
+		t.Errorf("metric counted %d deleted rows, want 25", got)
+	}
+	// Three batches, with a pause after each of the two full ones
+	if elapsed < 2*pause {
+		t.Errorf("sweep took %v, want at least two pauses of %v", elapsed, pause)
+	}
+}
+
+func TestSweepStopsWhenCanceled(t *testing.T) {
+	db := openTestDB(t)
+	seedRows(t, db, 30, 48*time.Hour)
+
+	j := New(db, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		j.sweep(ctx, testPolicy("test_cancel", 10))
+		close(done)
+	}()
+
+	// The first batch goes through, then the sweep waits out its pause
+	deadline := time.Now().Add(5 * time.Second)
+	for countRows(t, db) != 20 {
+		if time.Now().After(deadline) {
+			t.Fatalf("first batch never deleted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("sweep kept running after cancel")
+	}
+	if left := countRows(t, db); left != 20 {
+		t.Errorf("%d rows left, want 20 after one batch", left)
+	}
+}
+
+func TestRegisterRejectsInvalidPolicies(t *testing.T) {
+	valid := testPolicy("valid", 10)
+	tests := []struct {
+		name   string
+		change func(p *Policy)
+	}{
+		{"no name", func(p *Policy) { p.Name = "" }},
+		{"injected table", func(p *Policy) { p.Table = "users; DROP TABLE users" }},
+		{"quoted column", func(p *Policy) { p.AgeColumn = `"created_at"` }},
+		{"negative max age", func(p *Policy) { p.MaxAge = -time.Second }},
+		{"zero batch size", func(p *Policy) { p.BatchSize = 0 }},
+		{"zero interval", func(p *Policy) { p.Interval = 0 }},
+	}
+	for _, tt := range tests {
+		p := valid
+		tt.change(&p)
+		if err := New(nil, 0).Register(p); err == nil {
+			t.Errorf("%s: registered", tt.name)
+		}
+	}
+
+	j := New(nil, 0)
+	if err := j.Register(valid); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := j.Register(valid); err == nil {
+		t.Errorf("same policy registered twice")
+	}
+}
@@ -0,0 +1,193 @@
+// Package jobs runs resumable background jobs. A job is a sequence of
+// idempotent batches; after each batch its checkpoint is persisted, so a job
+// interrupted by shutdown or lost leadership resumes where it stopped the
+// next time this or another replica runs it.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Job states as persisted by the Store.
+const (
+	StatusRunning  = "running"
+	StatusPaused   = "paused"
+	StatusFinished = "finished"
+	StatusFailed   = "failed"
+)
+
+// batchTimeout bounds a single batch. Batches are not cancelled when the
+// manager stops, so a batch that has started always gets to commit.
+const batchTimeout = time.Minute
+
+// Step processes one batch starting after checkpoint. It returns the
+// checkpoint to resume from, how many items it processed, and whether the
+// run is complete. Steps must be idempotent: a batch may be repeated if the
+// process dies before its checkpoint is saved.
+type Step func(ctx context.Context, checkpoint string) (next string, processed int64, done bool, err error)
+
+// Job is a named, recurring sequence of batches.
+type Job struct {
+	Name string
+	// Interval is the time between the end of one run and the start of the next.
+	Interval time.Duration
+	Step     Step
+}
+
+// State is the persisted progress of a job.
+type State struct {
+	Name       string     `json:"name"`
+	Status     string     `json:"status"`
+	Checkpoint string     `json:"checkpoint"`
+	Processed  int64      `json:"processed"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Store persists job progress.
+type Store interface {
+	Get(ctx context.Context, name string) (*State, error)
+	Save(ctx context.Context, state State) error
+	List(ctx context.Context) ([]State, error)
+}
+
+// Manager owns the registered jobs. Run executes them until its context is
+// done, stopping each job between batches.
+type Manager struct {
+	store Store
+
+	mu   sync.Mutex
+	jobs []Job
+}
+
+func NewManager(store Store) *Manager {
+	return &Manager{store: store}
+}
+
+// Register adds a job. It must be called before Run.
+func (m *Manager) Register(job Job) error {
+	if job.Name == "" || job.Step == nil || job.Interval <= 0 {
+		return fmt.Errorf("job %q needs a name, a step and a positive interval", job.Name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.jobs {
+		if existing.Name == job.Name {
+			return fmt.Errorf("job %s is already registered", job.Name)
+		}
+	}
+	m.jobs = append(m.jobs, job)
+	return nil
+}
+
+// States returns the persisted progress of every job that has run.
+func (m *Manager) States(ctx context.Context) ([]State, error) {
+	return m.store.List(ctx)
+}
+
+// Run executes every registered job until ctx is done and returns once all of
+// them have stopped. It is meant to run only on the elected leader.
+func (m *Manager) Run(ctx context.Context) {
+	m.mu.Lock()
+	jobs := append([]Job(nil), m.jobs...)
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job Job) {
+			defer wg.Done()
+			m.loop(ctx, job)
+		}(job)
+	}
+	wg.Wait()
+}
+
+func (m *Manager) loop(ctx context.Context, job Job) {
+	for {
+		m.run(ctx, job)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(job.Interval):
+		}
+	}
+}
+
+// run performs one run of job, resuming an interrupted run if there is one.
+func (m *Manager) run(ctx context.Context, job Job) {
+	entry := log.WithField("job", job.Name)
+
+	state, err := m.store.Get(ctx, job.Name)
+	if err != nil {
+		if ctx.Err() == nil {
+			entry.WithError(err).Error("Failed to load job checkpoint")
+		}
+		return
+	}
+
+	if state == nil || state.Status == StatusFinished || state.Status == StatusFailed {
+		state = &State{Name: job.Name, StartedAt: time.Now().UTC()}
+	} else {
+		entry.WithFields(log.Fields{
+			"checkpoint": state.Checkpoint,
+			"processed":  state.Processed,
+		}).Info("Resuming job from checkpoint")
+	}
+	state.Status = StatusRunning
+	state.Error = ""
+	state.FinishedAt = nil
+
+	// Checkpoints are saved even while stopping, so they must not use ctx
+	saveCtx := context.WithoutCancel(ctx)
+	save := func() {
+		state.UpdatedAt = time.Now().UTC()
+		if err := m.store.Save(saveCtx, *state); err != nil {
+			entry.WithError(err).Error("Failed to save job checkpoint")
+		}
+	}
+	save()
+
+	for {
+		if ctx.Err() != nil {
+			state.Status = StatusPaused
+			save()
+			entry.WithField("checkpoint", state.Checkpoint).Info("Job paused")
+			return
+		}
+
+		batchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), batchTimeout)
+		next, processed, done, err := job.Step(batchCtx, state.Checkpoint)
+		cancel()
+		if err != nil {
+			state.Status = StatusFailed
+			state.Error = err.Error()
+			save()
+			entry.WithError(err).Error("Job batch failed")
+			return
+		}
+
+		state.Checkpoint = next
+		state.Processed += processed
+		if done {
+			now := time.Now().UTC()
+			state.Status = StatusFinished
+			state.FinishedAt = &now
+			save()
+			if state.Processed > 0 {
+				entry.WithField("processed", state.Processed).Info("Job finished")
+			}
+			return
+		}
+		save()
+	}
+}
@@ -0,0 +1,147 @@
+package jobs
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore keeps job states in memory.
+type memoryStore struct {
+	mu     sync.Mutex
+	states map[string]State
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{states: map[string]State{}}
+}
+
+func (s *memoryStore) Get(ctx context.Context, name string) (*State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[name]
+	if !ok {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+func (s *memoryStore) Save(ctx context.Context, state State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[state.Name] = state
+	return nil
+}
+
+func (s *memoryStore) List(ctx context.Context) ([]State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var states []State
+	for _, state := range s.states {
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// rowsJob walks rows 1 to total in batches of batchSize, with the last row
+// done as the checkpoint, and counts how often each row is processed.
+type rowsJob struct {
+	total, batchSize int
+
+	mu          sync.Mutex
+	seen        map[int]int
+	checkpoints []string
+	// onBatch, when set, is called in the middle of every batch.
+	onBatch func(batch int)
+}
+
+func (j *rowsJob) step(ctx context.Context, checkpoint string) (string, int64, bool, error) {
+	last := 0
+	if checkpoint != "" {
+		var err error
+		if last, err = strconv.Atoi(checkpoint); err != nil {
+			return "", 0, false, err
+		}
+	}
+
+	j.mu.Lock()
+	j.checkpoints = append(j.checkpoints, checkpoint)
+	batch := len(j.checkpoints)
+	j.mu.Unlock()
+
+	end := last + j.batchSize
+	if end > j.total {
+		end = j.total
+	}
+	for row := last + 1; row <= end; row++ {
+		if row == last+1 && j.onBatch != nil {
+			j.onBatch(batch)
+		}
+		j.mu.Lock()
+		j.seen[row]++
+		j.mu.Unlock()
+	}
+	return strconv.Itoa(end), int64(end - last), end == j.total, nil
+}
+
+func TestCancelledJobResumesFromCheckpoint(t *testing.T) {
+	store := newMemoryStore()
+	rows := &rowsJob{total: 10, batchSize: 2, seen: map[int]int{}}
+	job := Job{Name: "rows", Interval: time.Hour, Step: rows.step}
+
+	// Stop the manager in the middle of the second batch
+	ctx, cancel := context.WithCancel(context.Background())
+	rows.onBatch = func(batch int) {
+		if batch == 2 {
+			cancel()
+		}
+	}
+	first := NewManager(store)
+	if err := first.Register(job); err != nil {
+		t.Fatal(err)
+	}
+	first.Run(ctx)
+
+	state, _ := store.Get(context.Background(), "rows")
+	if state == nil || state.Status != StatusPaused || state.Checkpoint != "4" || state.Processed != 4 {
+		t.Fatalf("state after stopping %+v, want paused at checkpoint 4 with 4 processed", state)
+	}
+
+	// Another manager, as on the next leader, picks the run up
+	rows.onBatch = nil
+	second := NewManager(store)
+	second.run(context.Background(), job)
+
+	state, _ = store.Get(context.Background(), "rows")
+	if state.Status != StatusFinished || state.Processed != 10 || state.FinishedAt == nil {
+		t.Fatalf("state after resuming %+v, want finished with 10 processed", state)
+	}
+	for row := 1; row <= rows.total; row++ {
+		if rows.seen[row] != 1 {
+			t.Errorf("row %d processed %d times, want once", row, rows.seen[row])
+		}
+	}
+	if got := rows.checkpoints[2]; got != "4" {
+		t.Errorf("resumed run started after %q, want 4", got)
+	}
+}
+
+func TestFinishedJobStartsOver(t *testing.T) {
+	store := newMemoryStore()
+	rows := &rowsJob{total: 3, batchSize: 2, seen: map[int]int{}}
+	job := Job{Name: "rows", Interval: time.Hour, Step: rows.step}
+	m := NewManager(store)
+
+	m.run(context.Background(), job)
+	m.run(context.Background(), job)
+
+	state, _ := store.Get(context.Background(), "rows")
+	if state.Status != StatusFinished || state.Processed != 3 {
+		t.Fatalf("state %+v, want finished with 3 processed in the last run", state)
+	}
+	if rows.seen[1] != 2 || rows.checkpoints[2] != "" {
+		t.Errorf("second run started after %q, want a fresh run from the start", rows.checkpoints[2])
+	}
+}
@@ -0,0 +1,27 @@
+//go:build gojson
+
+package jsonenc
+
+import (
+	"io"
+
+	gojson "github.com/goccy/go-json"
+)
+
+func init() {
+	encoders[GoJSON] = goJSONEncoder{}
+}
+
+type goJSONEncoder struct{}
+
+func (goJSONEncoder) Encode(w io.Writer, v interface{}, indent string) error {
+	enc := gojson.NewEncoder(w)
+	if indent != "" {
+		enc.SetIndent("", indent)
+	}
+	return enc.Encode(v)
+}
+
+func (goJSONEncoder) Marshal(v interface{}) ([]byte, error) {
+	return gojson.Marshal(v)
+}
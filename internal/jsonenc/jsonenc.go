@@ -0,0 +1,71 @@
+// Package jsonenc holds the JSON encoders responses can be written with.
+// The standard library's is always there; go-json is compiled in with the
+// gojson build tag. Both write the same bytes for the service's responses.
+package jsonenc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Encoder names, as set in JSON_ENCODER.
+const (
+	Std    = "std"
+	GoJSON = "go-json"
+)
+
+// buildTags names the build tag each optional encoder is compiled in with.
+var buildTags = map[string]string{
+	GoJSON: "gojson",
+}
+
+// Encoder writes values as JSON.
+type Encoder interface {
+	// Encode writes v to w followed by a newline, indented by indent when
+	// it isn't empty, as json.Encoder does.
+	Encode(w io.Writer, v interface{}, indent string) error
+	// Marshal returns the compact encoding of v.
+	Marshal(v interface{}) ([]byte, error)
+}
+
+var encoders = map[string]Encoder{
+	Std: stdEncoder{},
+}
+
+// Lookup returns the encoder called name. An encoder this binary was built
+// without is an error naming the build tag it needs.
+func Lookup(name string) (Encoder, error) {
+	if enc, ok := encoders[name]; ok {
+		return enc, nil
+	}
+	if tag, ok := buildTags[name]; ok {
+		return nil, fmt.Errorf("JSON encoder %q is not compiled in, build with -tags %s", name, tag)
+	}
+	return nil, fmt.Errorf("unknown JSON encoder %q", name)
+}
+
+// Available returns the names of the encoders compiled in, sorted.
+func Available() []string {
+	names := make([]string, 0, len(encoders))
+	for name := range encoders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type stdEncoder struct{}
+
+func (stdEncoder) Encode(w io.Writer, v interface{}, indent string) error {
+	enc := json.NewEncoder(w)
+	if indent != "" {
+		enc.SetIndent("", indent)
+	}
+	return enc.Encode(v)
+}
+
+func (stdEncoder) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
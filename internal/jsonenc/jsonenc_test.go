@@ -0,0 +1,38 @@
+package jsonenc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	enc, err := Lookup(Std)
+	if err != nil {
+		t.Fatalf("Lookup(std): %v", err)
+	}
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, map[string]int{"b": 2, "a": 1}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "{\"a\":1,\"b\":2}\n" {
+		t.Errorf("std encoded %q", got)
+	}
+
+	if _, err := Lookup("sonic"); err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Errorf("Lookup(sonic): got %v, want unknown encoder", err)
+	}
+
+	// go-json is there exactly when the binary was built with its tag
+	_, err = Lookup(GoJSON)
+	compiled := false
+	for _, name := range Available() {
+		compiled = compiled || name == GoJSON
+	}
+	if compiled && err != nil {
+		t.Errorf("Lookup(go-json): %v", err)
+	}
+	if !compiled && (err == nil || !strings.Contains(err.Error(), "-tags gojson")) {
+		t.Errorf("Lookup(go-json) without the tag: got %v, want the build tag named", err)
+	}
+}
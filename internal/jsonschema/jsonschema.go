@@ -0,0 +1,120 @@
+// Package jsonschema validates JSON documents against JSON Schema, drafts 4,
+// 6 and 7, using gojsonschema. Schemas are checked against their draft's
+// meta-schema when compiled, and may only reference their own definitions:
+// a $ref to another document is rejected rather than fetched.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Schema is a compiled schema.
+type Schema struct {
+	schema *gojsonschema.Schema
+}
+
+// Compile parses a schema document.
+func Compile(raw []byte) (*Schema, error) {
+	var doc interface{}
+	if err := decode(raw, &doc); err != nil {
+		return nil, errors.New("#: schema must be valid JSON")
+	}
+	if _, ok := doc.(map[string]interface{}); !ok {
+		return nil, errors.New("#: schema must be a JSON object")
+	}
+	if err := checkRefs(doc, "#"); err != nil {
+		return nil, err
+	}
+
+	loader := gojsonschema.NewSchemaLoader()
+	loader.Validate = true
+	schema, err := loader.Compile(gojsonschema.NewBytesLoader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("#: %v", err)
+	}
+	return &Schema{schema: schema}, nil
+}
+
+// checkRefs rejects references to anything but the schema itself, so
+// compiling a schema never reads a file or makes a request.
+func checkRefs(v interface{}, path string) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok && !strings.HasPrefix(ref, "#") {
+			return fmt.Errorf("%s: $ref %q must point inside the schema", path, ref)
+		}
+		for key, child := range v {
+			if err := checkRefs(child, path+"/"+escapePointer(key)); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			if err := checkRefs(child, fmt.Sprintf("%s/%d", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateJSON decodes doc and validates it. The returned error names the
+// first failing location as a JSON pointer.
+func (s *Schema) ValidateJSON(doc []byte) error {
+	var v interface{}
+	if err := decode(doc, &v); err != nil {
+		return errors.New("#: document must be valid JSON")
+	}
+	result, err := s.schema.Validate(gojsonschema.NewBytesLoader(doc))
+	if err != nil {
+		return fmt.Errorf("#: %v", err)
+	}
+	if result.Valid() {
+		return nil
+	}
+
+	// Report the same error for the same document whatever order the
+	// validator walked the schema in
+	failures := result.Errors()
+	sort.SliceStable(failures, func(a, b int) bool {
+		return pointer(failures[a]) < pointer(failures[b])
+	})
+	return fmt.Errorf("%s: %s", pointer(failures[0]), failures[0].Description())
+}
+
+// pointer returns the location of a validation failure as a JSON pointer.
+func pointer(failure gojsonschema.ResultError) string {
+	// NUL splits the path, as metadata property names never contain it
+	tokens := strings.Split(failure.Context().String("\x00"), "\x00")
+	var b strings.Builder
+	b.WriteString("#")
+	for _, token := range tokens[1:] {
+		b.WriteString("/")
+		b.WriteString(escapePointer(token))
+	}
+	return b.String()
+}
+
+func escapePointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
+
+// decode keeps numbers as json.Number so integers are checked exactly.
+func decode(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("trailing data")
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package jsonschema
+
+import (
+	"strings"
+	"testing"
+)
+
+const bookSchema = `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"type": "object",
+	"required": ["isbn", "pages"],
+	"properties": {
+		"isbn": {"type": "string", "pattern": "^[0-9-]{10,17}$"},
+		"pages": {"type": "integer", "minimum": 1},
+		"format": {"enum": ["paperback", "hardcover"]},
+		"authors": {"type": "array", "items": {"$ref": "#/definitions/author"}, "minItems": 1}
+	},
+	"additionalProperties": false,
+	"definitions": {
+		"author": {"type": "string", "minLength": 1}
+	}
+}`
+
+func TestValidateJSONConforming(t *testing.T) {
+	schema, err := Compile([]byte(bookSchema))
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	docs := []string{
+		`{"isbn": "978-3-16-148410-0", "pages": 320}`,
+		`{"isbn": "0306406152", "pages": 1, "format": "hardcover", "authors": ["Ada"]}`,
+	}
+	for _, doc := range docs {
+		if err := schema.ValidateJSON([]byte(doc)); err != nil {
+			t.Errorf("ValidateJSON(%s): %v", doc, err)
+		}
+	}
+}
+
+func TestValidateJSONNonConforming(t *testing.T) {
+	schema, err := Compile([]byte(bookSchema))
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	tests := []struct {
+		doc     string
+		pointer string
+	}{
+		{`{"pages": 10}`, "#:"},
+		{`{"isbn": "978-3-16-148410-0", "pages": 0}`, "#/pages:"},
+		{`{"isbn": "978-3-16-148410-0", "pages": 1.5}`, "#/pages:"},
+		{`{"isbn": "not an isbn", "pages": 10}`, "#/isbn:"},
+		{`{"isbn": "0306406152", "pages": 10, "format": "scroll"}`, "#/format:"},
+		{`{"isbn": "0306406152", "pages": 10, "authors": [""]}`, "#/authors/0:"},
+		{`{"isbn": "0306406152", "pages": 10, "color": "red"}`, "#:"},
+		{`[]`, "#:"},
+		{`{"isbn": "0306406152"`, "#:"},
+	}
+	for _, tt := range tests {
+		err := schema.ValidateJSON([]byte(tt.doc))
+		if err == nil {
+			t.Errorf("ValidateJSON(%s) succeeded, want an error at %s", tt.doc, tt.pointer)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), tt.pointer) {
+			t.Errorf("ValidateJSON(%s) = %q, want an error at %s", tt.doc, err, tt.pointer)
+		}
+	}
+}
+
+func TestCompileRejectsInvalidSchemas(t *testing.T) {
+	schemas := []string{
+		`not json`,
+		`[]`,
+		`{"type": "text"}`,
+		`{"properties": {"a": {"minimum": "one"}}}`,
+		`{"$ref": "http://example.com/schema.json"}`,
+		`{"properties": {"a": {"$ref": "other.json#/definitions/a"}}}`,
+	}
+	for _, raw := range schemas {
+		if _, err := Compile([]byte(raw)); err == nil {
+			t.Errorf("Compile(%s) succeeded, want an error", raw)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Advisory lock keys taken by the service. They only need to be unique
+// within the database.
+const (
+	MigrationLockKey int64 = 0x75736572_0001
+	WorkerLockKey    int64 = 0x75736572_0002
+)
+
+// Elector elects a single leader among replicas sharing a database using a
+// session-level Postgres advisory lock. The lock lives on a dedicated
+// connection, so it is released as soon as the leader's session ends and
+// another replica takes over on its next attempt.
+type Elector struct {
+	db       *sql.DB
+	key      int64
+	interval time.Duration
+	leader   atomic.Bool
+}
+
+// New creates an Elector for key. interval is both how often a follower
+// retries and how often the leader checks it still holds the lock.
+func New(db *sql.DB, key int64, interval time.Duration) *Elector {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return &Elector{db: db, key: key, interval: interval}
+}
+
+// IsLeader reports whether this instance currently holds leadership.
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Run campaigns for leadership until ctx is done. Each time this instance is
+// elected, lead is called with a context that is cancelled when leadership is
+// lost; Run waits for lead to return before campaigning again. If lead
+// returns on its own, leadership is given up.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context)) {
+	for {
+		if conn := e.tryAcquire(ctx); conn != nil {
+			e.hold(ctx, conn, lead)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.interval):
+		}
+	}
+}
+
+func (e *Elector) tryAcquire(ctx context.Context) *sql.Conn {
+	conn, err := e.db.Conn(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.WithError(err).Warn("Leader election could not get a connection")
+		}
+		return nil
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, e.key).Scan(&acquired); err != nil || !acquired {
+		if err != nil && ctx.Err() == nil {
+			log.WithError(err).Warn("Leader election attempt failed")
+		}
+		conn.Close()
+		return nil
+	}
+
+	return conn
+}
+
+func (e *Elector) hold(ctx context.Context, conn *sql.Conn, lead func(ctx context.Context)) {
+	leadCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	e.leader.Store(true)
+	log.Info("Acquired leadership")
+
+	go func() {
+		defer close(done)
+		lead(leadCtx)
+	}()
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+renew:
+	for {
+		select {
+		case <-ctx.Done():
+			break renew
+		case <-done:
+			break renew
+		case <-ticker.C:
+			if err := e.checkHeld(ctx, conn); err != nil {
+				if ctx.Err() == nil {
+					log.WithError(err).Warn("Lost leadership")
+				}
+				break renew
+			}
+		}
+	}
+
+	e.leader.Store(false)
+	cancel()
+	<-done
+	e.release(conn)
+	log.Info("Released leadership")
+}
+
+// checkHeld confirms the lock is still held by this session. pg_locks
+// shows a bigint key split in two oids, the high half as classid and the
+// low half as objid, with objsubid 1; a lock on a pair of int4 keys has
+// objsubid 2 and is not ours even if its halves match.
+func (e *Elector) checkHeld(ctx context.Context, conn *sql.Conn) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var held bool
+	err := conn.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM pg_locks
+			WHERE locktype = 'advisory'
+			  AND pid = pg_backend_pid()
+			  AND granted
+			  AND objsubid = 1
+			  AND ((classid::bigint << 32) | objid::bigint) = $1
+		)`, e.key).Scan(&held)
+	if err != nil {
+		return fmt.Errorf("failed to check leader lock: %w", err)
+	}
+	if !held {
+		return fmt.Errorf("leader lock is no longer held")
+	}
+	return nil
+}
+
+// release unlocks and returns conn. If the unlock fails, the connection is
+// discarded instead so the pool never hands out a session still holding the lock.
+func (e *Elector) release(conn *sql.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, e.key); err != nil {
+		conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+	conn.Close()
+}
+
+// WithLock runs fn while holding the advisory lock key, waiting until any
+// other holder releases it or ctx is done.
+func WithLock(ctx context.Context, db *sql.DB, key int64, fn func() error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get lock connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, key); err != nil {
+		return fmt.Errorf("failed to acquire advisory lock: %w", err)
+	}
+
+	fnErr := fn()
+
+	unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := conn.ExecContext(unlockCtx, `SELECT pg_advisory_unlock($1)`, key); err != nil {
+		conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		log.WithError(err).Warn("Failed to release advisory lock, discarding connection")
+	}
+
+	return fnErr
+}
+
+// RunUnelected makes this instance leader without taking the lock, for
+// deployments that run a single replica with election disabled. It calls
+// lead and returns when lead does.
+func (e *Elector) RunUnelected(ctx context.Context, lead func(ctx context.Context)) {
+	e.leader.Store(true)
+	defer e.leader.Store(false)
+	lead(ctx)
+}
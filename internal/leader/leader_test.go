@@ -0,0 +1,171 @@
+package leader
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// openTestDB connects to the database at TEST_DATABASE_URL. Tests that need
+// it are skipped when the variable is not set. Each call opens a pool of its
+// own, as a separate replica would.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// waitFor polls cond until it holds or a few seconds pass.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// testLockKey keeps the tests' lock apart from the service's.
+const testLockKey int64 = 0x74657374_0001
+
+func TestOneOfTwoElectorsLeadsAndTheOtherTakesOver(t *testing.T) {
+	dbs := []*sql.DB{openTestDB(t), openTestDB(t)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var running, maxRunning, runs atomic.Int32
+	electors := make([]*Elector, len(dbs))
+	var wg sync.WaitGroup
+	for i, db := range dbs {
+		electors[i] = New(db, testLockKey, 50*time.Millisecond)
+		wg.Add(1)
+		go func(e *Elector) {
+			defer wg.Done()
+			e.Run(ctx, func(ctx context.Context) {
+				runs.Add(1)
+				n := running.Add(1)
+				for {
+					m := maxRunning.Load()
+					if n <= m || maxRunning.CompareAndSwap(m, n) {
+						break
+					}
+				}
+				<-ctx.Done()
+				running.Add(-1)
+			})
+		}(electors[i])
+	}
+
+	leaderIndex := func() int {
+		index := -1
+		for i, e := range electors {
+			if e.IsLeader() {
+				if index >= 0 {
+					t.Fatal("both electors are leader")
+				}
+				index = i
+			}
+		}
+		return index
+	}
+	waitFor(t, "a leader", func() bool { return leaderIndex() >= 0 })
+	first := leaderIndex()
+
+	// Several renewals pass without the follower taking over
+	time.Sleep(300 * time.Millisecond)
+	if got := leaderIndex(); got != first {
+		t.Fatalf("leader changed from %d to %d while the lock was held", first, got)
+	}
+	if got := runs.Load(); got != 1 {
+		t.Fatalf("worker ran %d times, want 1", got)
+	}
+
+	// Ending the leader's session releases the lock with it. Closing its
+	// pool too keeps it from winning the lock straight back.
+	_, err := dbs[1-first].Exec(`
+		SELECT pg_terminate_backend(pid) FROM pg_locks
+		WHERE locktype = 'advisory' AND granted AND objsubid = 1
+		  AND ((classid::bigint << 32) | objid::bigint) = $1`, testLockKey)
+	if err != nil {
+		t.Fatalf("terminate leader session: %v", err)
+	}
+	dbs[first].Close()
+	waitFor(t, "the follower to take over", func() bool { return leaderIndex() == 1-first })
+
+	cancel()
+	wg.Wait()
+	if got := maxRunning.Load(); got != 1 {
+		t.Errorf("%d workers ran at once, want 1", got)
+	}
+	if got := runs.Load(); got != 2 {
+		t.Errorf("worker ran %d times, want 2", got)
+	}
+}
+
+// TestCheckHeldDecodesLockKeys covers keys whose halves don't fit a signed
+// int4: a low half with its top bit set and a negative key.
+func TestCheckHeldDecodesLockKeys(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	for _, key := range []int64{testLockKey, 0x74657374_80000002, -testLockKey} {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := New(db, key, time.Second)
+
+		if err := e.checkHeld(ctx, conn); err == nil {
+			t.Errorf("key %#x: checkHeld passed before the lock was taken", key)
+		}
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, key); err != nil {
+			t.Fatalf("key %#x: lock: %v", key, err)
+		}
+		if err := e.checkHeld(ctx, conn); err != nil {
+			t.Errorf("key %#x: checkHeld: %v", key, err)
+		}
+		if err := New(db, key+1, time.Second).checkHeld(ctx, conn); err == nil {
+			t.Errorf("key %#x: checkHeld passed for the next key", key)
+		}
+		e.release(conn)
+	}
+}
+
+// TestCheckHeldIgnoresInt4PairLocks checks a lock on two int4 keys whose
+// halves match the key isn't mistaken for it.
+func TestCheckHeldIgnoresInt4PairLocks(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	key := testLockKey
+	high, low := int32(key>>32), int32(key)
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1::int4, $2::int4)`, high, low); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1::int4, $2::int4)`, high, low)
+
+	if err := New(db, testLockKey, time.Second).checkHeld(ctx, conn); err == nil {
+		t.Error("checkHeld passed for a lock on a pair of int4 keys")
+	}
+}
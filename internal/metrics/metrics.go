@@ -0,0 +1,46 @@
+// Package metrics holds the service's process-wide counters. They are
+// published through expvar and served as JSON to admins on /debug/vars.
+package metrics
+
+import (
+	"expvar"
+	"net/http"
+)
+
+var (
+	// CircuitBreakerRejections counts requests short-circuited with 503 by the DB circuit breaker.
+	CircuitBreakerRejections = expvar.NewInt("db_circuit_breaker_rejections_total")
+	// CircuitBreakerTrips counts transitions of the DB circuit breaker into the open state.
+	CircuitBreakerTrips = expvar.NewInt("db_circuit_breaker_trips_total")
+	// JanitorRowsDeleted counts rows deleted by the janitor, keyed by policy name.
+	JanitorRowsDeleted = expvar.NewMap("janitor_rows_deleted_total")
+	// CacheShadowComparisons counts sampled cache shadow reads compared against the database.
+	CacheShadowComparisons = expvar.NewInt("cache_shadow_comparisons_total")
+	// CacheShadowMismatches counts stale cached fields found by shadow reads, keyed by field name.
+	CacheShadowMismatches = expvar.NewMap("cache_shadow_mismatches_total")
+	// AuditEventsFiltered counts audit events held back by the event filter, keyed by event type.
+	AuditEventsFiltered = expvar.NewMap("audit_events_filtered_total")
+	// EmailLookupMisses counts email lookups that found no user, keyed by the
+	// caller's token, with callers without one under "anonymous".
+	EmailLookupMisses = expvar.NewMap("email_lookup_misses_total")
+	// LegacyTrialAccessChecks counts access checks of users with a trial but no trial end, keyed by policy.
+	LegacyTrialAccessChecks = expvar.NewMap("legacy_trial_access_checks_total")
+	// LegacyTrialsBackfilled counts trials given an end time by the legacy trial backfill.
+	LegacyTrialsBackfilled = expvar.NewInt("legacy_trials_backfilled_total")
+	// PIIUsersEncrypted counts users whose email and name the PII backfill encrypted.
+	PIIUsersEncrypted = expvar.NewInt("pii_users_encrypted_total")
+	// CoinLedgerEntriesPruned counts coin ledger entries folded into opening balances by the retention job.
+	CoinLedgerEntriesPruned = expvar.NewInt("coin_ledger_entries_pruned_total")
+	// CoinLedgerDiscrepancies counts ledger entries whose balance_after did not follow from the entry before, as found by verified ledger reads.
+	CoinLedgerDiscrepancies = expvar.NewInt("coin_ledger_discrepancies_total")
+)
+
+// PublishFunc registers a value computed on every scrape, such as a current state.
+func PublishFunc(name string, f func() interface{}) {
+	expvar.Publish(name, expvar.Func(f))
+}
+
+// Handler serves all published metrics.
+func Handler() http.Handler {
+	return expvar.Handler()
+}
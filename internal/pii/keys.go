@@ -0,0 +1,69 @@
+package pii
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeyProvider supplies the key-encryption keys data keys are sealed with.
+// Keys are known by an ID stored with every value, so a provider can move
+// new values to another key while still opening those sealed under older
+// ones. A KMS-backed provider fits the same interface.
+type KeyProvider interface {
+	// CurrentKey returns the ID and bytes of the key new values are sealed with.
+	CurrentKey(ctx context.Context) (string, []byte, error)
+	// Key returns the key with id, or ErrUnknownKey.
+	Key(ctx context.Context, id string) ([]byte, error)
+}
+
+// StaticKeyProvider holds a single key given at startup, e.g. from the
+// environment or a file.
+type StaticKeyProvider struct {
+	id  string
+	key []byte
+}
+
+// NewStaticKeyProvider creates a provider for key under id. The id is
+// stored with every value, so it must not contain ':'.
+func NewStaticKeyProvider(id string, key []byte) (*StaticKeyProvider, error) {
+	if id == "" || strings.Contains(id, ":") {
+		return nil, errors.New("pii: key id must be non-empty and must not contain ':'")
+	}
+	if len(key) != KeySize {
+		return nil, ErrKeySize
+	}
+	return &StaticKeyProvider{id: id, key: key}, nil
+}
+
+func (p *StaticKeyProvider) CurrentKey(context.Context) (string, []byte, error) {
+	return p.id, p.key, nil
+}
+
+func (p *StaticKeyProvider) Key(_ context.Context, id string) ([]byte, error) {
+	if id != p.id {
+		return nil, ErrUnknownKey
+	}
+	return p.key, nil
+}
+
+// ParseKey decodes a base64 key, ignoring surrounding whitespace.
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("pii: key is not valid base64: %w", err)
+	}
+	return key, nil
+}
+
+// ReadKeyFile reads a base64 key from the file at path.
+func ReadKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("pii: read key file: %w", err)
+	}
+	return ParseKey(string(data))
+}
@@ -0,0 +1,198 @@
+// Package pii encrypts the personal data the service stores, such as user
+// emails and names, with envelope encryption: every value is sealed with its
+// own random data key, which is in turn sealed with a key-encryption key from
+// a KeyProvider. Values stored before encryption was turned on have no
+// encrypted prefix and are read back as they are, so a table can hold both
+// while it is backfilled.
+package pii
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Prefix starts every encrypted value: "enc:v1:<key id>:<sealed data key>:<sealed value>".
+const Prefix = "enc:v1:"
+
+const (
+	// KeySize is the size of key-encryption and data keys, for AES-256.
+	KeySize = 32
+	// MinHashKeySize is the smallest key Hash accepts.
+	MinHashKeySize = 32
+)
+
+var (
+	ErrUnknownKey     = errors.New("pii: unknown key")
+	ErrMalformedValue = errors.New("pii: malformed encrypted value")
+	ErrKeySize        = fmt.Errorf("pii: keys must be %d bytes", KeySize)
+	ErrHashKeySize    = fmt.Errorf("pii: hash keys must be at least %d bytes", MinHashKeySize)
+)
+
+// Cipher encrypts and decrypts values and computes the keyed hashes that
+// stand in for them in exact-match lookups.
+type Cipher struct {
+	keys    KeyProvider
+	hashKey []byte
+}
+
+// NewCipher creates a Cipher sealing data keys with keys. hashKey keys Hash;
+// it must stay the same for as long as stored hashes are looked up.
+func NewCipher(keys KeyProvider, hashKey []byte) (*Cipher, error) {
+	if len(hashKey) < MinHashKeySize {
+		return nil, ErrHashKeySize
+	}
+	return &Cipher{keys: keys, hashKey: hashKey}, nil
+}
+
+// IsEncrypted reports whether value was stored by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// Encrypt seals plaintext under a new data key, itself sealed with the
+// provider's current key. Encrypting the same value twice gives different
+// results, so use Hash to look values up.
+func (c *Cipher) Encrypt(ctx context.Context, plaintext string) (string, error) {
+	keyID, kek, err := c.keys.CurrentKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("pii: get current key: %w", err)
+	}
+
+	dek := make([]byte, KeySize)
+	if _, err := rand.Read(dek); err != nil {
+		return "", fmt.Errorf("pii: generate data key: %w", err)
+	}
+	sealedKey, err := seal(kek, dek, []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+	sealedValue, err := seal(dek, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+
+	return Prefix + keyID + ":" +
+		base64.RawStdEncoding.EncodeToString(sealedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(sealedValue), nil
+}
+
+// Decrypt opens a value stored by Encrypt. Any other value is returned as
+// it is, being plaintext stored before encryption was turned on.
+func (c *Cipher) Decrypt(ctx context.Context, stored string) (string, error) {
+	if !IsEncrypted(stored) {
+		return stored, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(stored, Prefix), ":")
+	if len(parts) != 3 {
+		return "", ErrMalformedValue
+	}
+	keyID := parts[0]
+	sealedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrMalformedValue
+	}
+	sealedValue, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrMalformedValue
+	}
+
+	kek, err := c.keys.Key(ctx, keyID)
+	if err != nil {
+		return "", fmt.Errorf("pii: get key %s: %w", keyID, err)
+	}
+	dek, err := open(kek, sealedKey, []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dek, sealedValue, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Hash returns the keyed hash of value, hex encoded. Equal values hash
+// equally, so the hash can be indexed and matched in place of the value.
+func (c *Cipher) Hash(value string) string {
+	mac := hmac.New(sha256.New, c.hashKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Redacted stands in for a redacted name.
+const Redacted = "[redacted]"
+
+// Redact returns a copy of fields, such as an audit payload or a set of
+// changes, safe to store next to encrypted data: "email" is replaced by its
+// hash under "email_hash" and the value of "name" by Redacted. A nil Cipher
+// returns fields as they are.
+func (c *Cipher) Redact(fields map[string]interface{}) map[string]interface{} {
+	if c == nil || fields == nil {
+		return fields
+	}
+	redacted := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		switch key {
+		case "email":
+			if email, ok := value.(string); ok {
+				redacted["email_hash"] = c.Hash(email)
+			}
+		case "name":
+			redacted[key] = Redacted
+		default:
+			redacted[key] = value
+		}
+	}
+	return redacted
+}
+
+// seal encrypts plaintext with AES-GCM under key, prefixing the nonce.
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("pii: generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open reverses seal.
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformedValue
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("pii: open sealed value: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, ErrKeySize
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("pii: create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
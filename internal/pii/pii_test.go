@@ -0,0 +1,164 @@
+package pii
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newTestCipher(t *testing.T, keyID string) *Cipher {
+	t.Helper()
+	keys, err := NewStaticKeyProvider(keyID, bytes.Repeat([]byte{1}, KeySize))
+	if err != nil {
+		t.Fatalf("NewStaticKeyProvider: %v", err)
+	}
+	c, err := NewCipher(keys, bytes.Repeat([]byte{2}, MinHashKeySize))
+	if err != nil {
+		t.Fatalf("NewCipher: %v", err)
+	}
+	return c
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	c := newTestCipher(t, "k1")
+	ctx := context.Background()
+
+	for _, plaintext := range []string{"ada@example.com", "Ada Lovelace", "", "名前 with : colons"} {
+		sealed, err := c.Encrypt(ctx, plaintext)
+		if err != nil {
+			t.Fatalf("Encrypt(%q): %v", plaintext, err)
+		}
+		if !IsEncrypted(sealed) || (plaintext != "" && strings.Contains(sealed, plaintext)) {
+			t.Fatalf("Encrypt(%q) = %q, want an encrypted value", plaintext, sealed)
+		}
+		got, err := c.Decrypt(ctx, sealed)
+		if err != nil {
+			t.Fatalf("Decrypt: %v", err)
+		}
+		if got != plaintext {
+			t.Errorf("round trip of %q gave %q", plaintext, got)
+		}
+	}
+}
+
+func TestEncryptIsRandomized(t *testing.T) {
+	c := newTestCipher(t, "k1")
+	ctx := context.Background()
+
+	a, err := c.Encrypt(ctx, "ada@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.Encrypt(ctx, "ada@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Error("encrypting a value twice gave the same result")
+	}
+}
+
+func TestDecryptPassesPlaintextThrough(t *testing.T) {
+	c := newTestCipher(t, "k1")
+
+	got, err := c.Decrypt(context.Background(), "legacy@example.com")
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if got != "legacy@example.com" {
+		t.Errorf("Decrypt of plaintext = %q", got)
+	}
+}
+
+func TestDecryptRejectsUnknownKeyAndTampering(t *testing.T) {
+	ctx := context.Background()
+	sealed, err := newTestCipher(t, "k1").Encrypt(ctx, "ada@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newTestCipher(t, "k2").Decrypt(ctx, sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt under another key ID: err = %v, want ErrUnknownKey", err)
+	}
+
+	// Flip a byte of the sealed value
+	parts := strings.Split(strings.TrimPrefix(sealed, Prefix), ":")
+	value, _ := base64.RawStdEncoding.DecodeString(parts[2])
+	value[len(value)-1] ^= 1
+	tampered := Prefix + parts[0] + ":" + parts[1] + ":" + base64.RawStdEncoding.EncodeToString(value)
+	if _, err := newTestCipher(t, "k1").Decrypt(ctx, tampered); err == nil {
+		t.Error("Decrypt of a tampered value succeeded")
+	}
+
+	if _, err := newTestCipher(t, "k1").Decrypt(ctx, Prefix+"k1:only-two"); !errors.Is(err, ErrMalformedValue) {
+		t.Errorf("Decrypt of a malformed value: err = %v, want ErrMalformedValue", err)
+	}
+}
+
+func TestHashIsDeterministicAndKeyed(t *testing.T) {
+	c := newTestCipher(t, "k1")
+	if c.Hash("ada@example.com") != c.Hash("ada@example.com") {
+		t.Error("Hash is not deterministic")
+	}
+	if c.Hash("ada@example.com") == c.Hash("bob@example.com") {
+		t.Error("different values hash equally")
+	}
+
+	keys, _ := NewStaticKeyProvider("k1", bytes.Repeat([]byte{1}, KeySize))
+	other, err := NewCipher(keys, bytes.Repeat([]byte{3}, MinHashKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Hash("ada@example.com") == c.Hash("ada@example.com") {
+		t.Error("hashes under different keys are equal")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	c := newTestCipher(t, "k1")
+	fields := map[string]interface{}{
+		"email":  "ada@example.com",
+		"name":   "Ada",
+		"status": "active",
+	}
+
+	got := c.Redact(fields)
+	if _, ok := got["email"]; ok {
+		t.Error("redacted fields still hold the email")
+	}
+	if got["email_hash"] != c.Hash("ada@example.com") {
+		t.Errorf("email_hash = %v", got["email_hash"])
+	}
+	if got["name"] != Redacted || got["status"] != "active" {
+		t.Errorf("redacted fields = %v", got)
+	}
+	if fields["email"] != "ada@example.com" {
+		t.Error("Redact modified its input")
+	}
+
+	var nilCipher *Cipher
+	if got := nilCipher.Redact(fields); got["email"] != "ada@example.com" {
+		t.Error("a nil Cipher redacted fields")
+	}
+}
+
+func TestKeyValidation(t *testing.T) {
+	if _, err := NewStaticKeyProvider("k1", make([]byte, 16)); !errors.Is(err, ErrKeySize) {
+		t.Errorf("short key: err = %v, want ErrKeySize", err)
+	}
+	if _, err := NewStaticKeyProvider("k:1", make([]byte, KeySize)); err == nil {
+		t.Error("key ID with ':' accepted")
+	}
+	keys, _ := NewStaticKeyProvider("k1", make([]byte, KeySize))
+	if _, err := NewCipher(keys, make([]byte, 8)); !errors.Is(err, ErrHashKeySize) {
+		t.Errorf("short hash key: err = %v, want ErrHashKeySize", err)
+	}
+
+	key, err := ParseKey(" " + base64.StdEncoding.EncodeToString(make([]byte, KeySize)) + "\n")
+	if err != nil || len(key) != KeySize {
+		t.Errorf("ParseKey = %d bytes, %v", len(key), err)
+	}
+}
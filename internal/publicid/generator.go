@@ -0,0 +1,27 @@
+package publicid
+
+import "github.com/google/uuid"
+
+// Generator creates the UUIDs new resources are stored under.
+type Generator interface {
+	NewID() (string, error)
+}
+
+// UUIDv7 generates time-ordered version 7 UUIDs, so new rows land at the end
+// of the primary key index and public IDs sort by creation time.
+type UUIDv7 struct{}
+
+func (UUIDv7) NewID() (string, error) {
+	u, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// RandomUUID generates version 4 UUIDs, as rows created by the database get.
+type RandomUUID struct{}
+
+func (RandomUUID) NewID() (string, error) {
+	return uuid.NewString(), nil
+}
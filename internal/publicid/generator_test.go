@@ -0,0 +1,43 @@
+package publicid
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestUUIDv7IsTimeOrdered(t *testing.T) {
+	var gen UUIDv7
+	ids := make([]string, 1000)
+	public := make([]string, len(ids))
+	for i := range ids {
+		id, err := gen.NewID()
+		if err != nil {
+			t.Fatalf("NewID: %v", err)
+		}
+		u, err := uuid.Parse(id)
+		if err != nil || u.Version() != 7 {
+			t.Fatalf("NewID = %q, want a version 7 UUID", id)
+		}
+		ids[i] = id
+		public[i] = Format(Product, id)
+	}
+
+	if !sort.StringsAreSorted(ids) {
+		t.Error("UUIDs generated one after another are not in order")
+	}
+	if !sort.StringsAreSorted(public) {
+		t.Error("public IDs generated one after another are not in order")
+	}
+}
+
+func TestRandomUUID(t *testing.T) {
+	id, err := RandomUUID{}.NewID()
+	if err != nil {
+		t.Fatalf("NewID: %v", err)
+	}
+	if u, err := uuid.Parse(id); err != nil || u.Version() != 4 {
+		t.Errorf("NewID = %q, want a version 4 UUID", id)
+	}
+}
@@ -0,0 +1,155 @@
+// Package publicid converts between the UUIDs resources are stored under and
+// their public form: a type prefix and the UUID's 16 bytes in Crockford
+// base32, e.g. usr_01j9x3k7q8m2r5t6v7w8x9y0z1. Bare UUIDs stay valid input so
+// clients can move to the prefixed form at their own pace.
+package publicid
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Kind is the type of resource an ID names.
+type Kind string
+
+const (
+	User     Kind = "usr"
+	Product  Kind = "prod"
+	Category Kind = "cat"
+	Order    Kind = "ord"
+)
+
+var (
+	ErrInvalidID    = errors.New("invalid id")
+	ErrKindMismatch = errors.New("id is for a different type of resource")
+)
+
+// kinds lists every Kind, for telling a foreign prefix from garbage.
+var kinds = []Kind{User, Product, Category, Order}
+
+const (
+	separator = "_"
+	// encodedLength is the length of 128 bits in base32.
+	encodedLength = 26
+	alphabet      = "0123456789abcdefghjkmnpqrstvwxyz"
+)
+
+// decodeMap maps a lower-case alphabet byte to its value, or 0xff.
+var decodeMap = func() [256]byte {
+	var m [256]byte
+	for i := range m {
+		m[i] = 0xff
+	}
+	for i := 0; i < len(alphabet); i++ {
+		m[alphabet[i]] = byte(i)
+	}
+	return m
+}()
+
+// Format returns the public form of the UUID id for kind. An id that is not
+// a UUID is returned unchanged.
+func Format(kind Kind, id string) string {
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return id
+	}
+	return string(kind) + separator + encode(u)
+}
+
+// Parse returns the UUID named by s, which is either a bare UUID or the
+// public form for kind. A public ID of another kind gives ErrKindMismatch.
+func Parse(kind Kind, s string) (string, error) {
+	if u, err := uuid.Parse(s); err == nil {
+		return u.String(), nil
+	}
+
+	prefix, encoded, ok := strings.Cut(s, separator)
+	if !ok {
+		return "", ErrInvalidID
+	}
+	u, ok := decode(encoded)
+	if !ok {
+		return "", ErrInvalidID
+	}
+	if Kind(prefix) != kind {
+		for _, k := range kinds {
+			if Kind(prefix) == k {
+				return "", fmt.Errorf("%w: got %s, want %s", ErrKindMismatch, prefix, kind)
+			}
+		}
+		return "", ErrInvalidID
+	}
+	return u.String(), nil
+}
+
+// IsPublic reports whether s looks like a public ID of any kind, and which.
+func IsPublic(s string) (Kind, bool) {
+	prefix, encoded, ok := strings.Cut(s, separator)
+	if !ok {
+		return "", false
+	}
+	if _, ok := decode(encoded); !ok {
+		return "", false
+	}
+	for _, k := range kinds {
+		if Kind(prefix) == k {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+// encode writes u as 26 base32 digits, most significant first. The two spare
+// leading bits are zero, so the first digit is at most 7 and the encoding
+// sorts the same way as the UUID bytes.
+func encode(u uuid.UUID) string {
+	var out [encodedLength]byte
+	var acc uint64
+	var bits uint
+	pos := encodedLength - 1
+	for i := len(u) - 1; i >= 0; i-- {
+		acc |= uint64(u[i]) << bits
+		bits += 8
+		for bits >= 5 {
+			out[pos] = alphabet[acc&0x1f]
+			pos--
+			acc >>= 5
+			bits -= 5
+		}
+	}
+	out[pos] = alphabet[acc&0x1f]
+	return string(out[:])
+}
+
+func decode(s string) (uuid.UUID, bool) {
+	var u uuid.UUID
+	if len(s) != encodedLength {
+		return u, false
+	}
+	s = strings.ToLower(s)
+	if decodeMap[s[0]] > 7 {
+		return u, false
+	}
+
+	var acc uint64
+	var bits uint
+	pos := len(u) - 1
+	for i := encodedLength - 1; i >= 0; i-- {
+		v := decodeMap[s[i]]
+		if v == 0xff {
+			return u, false
+		}
+		acc |= uint64(v) << bits
+		bits += 5
+		for bits >= 8 && pos >= 0 {
+			u[pos] = byte(acc)
+			pos--
+			acc >>= 8
+			bits -= 8
+		}
+	}
+	return u, true
+}
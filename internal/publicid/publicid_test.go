@@ -0,0 +1,113 @@
+package publicid
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestFormatAndParseRoundTrip(t *testing.T) {
+	ids := []string{
+		"00000000-0000-0000-0000-000000000000",
+		"ffffffff-ffff-ffff-ffff-ffffffffffff",
+		"0190c2a8-7f1e-7a3b-9c4d-000000000001",
+		uuid.NewString(),
+	}
+	for _, kind := range kinds {
+		for _, id := range ids {
+			public := Format(kind, id)
+			if !strings.HasPrefix(public, string(kind)+"_") || len(public) != len(kind)+1+encodedLength {
+				t.Errorf("Format(%s, %s) = %q", kind, id, public)
+			}
+			got, err := Parse(kind, public)
+			if err != nil || got != id {
+				t.Errorf("Parse(%s, %s) = %q, %v, want %s", kind, public, got, err, id)
+			}
+			if got, err := Parse(kind, strings.ToUpper(public[len(kind)+1:])); err == nil {
+				t.Errorf("Parse accepted an ID without its prefix: %s", got)
+			}
+			if k, ok := IsPublic(public); !ok || k != kind {
+				t.Errorf("IsPublic(%s) = %s, %v", public, k, ok)
+			}
+		}
+	}
+}
+
+func TestParseAcceptsBareUUIDs(t *testing.T) {
+	id := "0190c2a8-7f1e-7a3b-9c4d-000000000001"
+	for _, s := range []string{id, strings.ToUpper(id), "{" + id + "}", "urn:uuid:" + id} {
+		if got, err := Parse(Product, s); err != nil || got != id {
+			t.Errorf("Parse(%q) = %q, %v, want %s", s, got, err, id)
+		}
+	}
+}
+
+func TestParseIsCaseInsensitive(t *testing.T) {
+	id := uuid.NewString()
+	public := Format(Order, id)
+	upper := "ord_" + strings.ToUpper(strings.TrimPrefix(public, "ord_"))
+	if got, err := Parse(Order, upper); err != nil || got != id {
+		t.Errorf("Parse(%s) = %q, %v, want %s", upper, got, err, id)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	user := Format(User, "0190c2a8-7f1e-7a3b-9c4d-000000000001")
+	encoded := strings.TrimPrefix(user, "usr_")
+
+	tests := []struct {
+		name string
+		s    string
+		want error
+	}{
+		{"another kind", user, ErrKindMismatch},
+		{"unknown prefix", "acct_" + encoded, ErrInvalidID},
+		{"no prefix", encoded, ErrInvalidID},
+		{"empty", "", ErrInvalidID},
+		{"too short", "prod_" + encoded[1:], ErrInvalidID},
+		{"too long", "prod_" + encoded + "0", ErrInvalidID},
+		// Crockford base32 leaves out i, l, o and u
+		{"letter outside the alphabet", "prod_" + encoded[:25] + "u", ErrInvalidID},
+		// 26 digits hold 130 bits, so the first may be at most 7
+		{"more than 128 bits", "prod_8" + encoded[1:], ErrInvalidID},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(Product, tt.s); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Parse(%q) error = %v, want %v", tt.name, tt.s, err, tt.want)
+		}
+		if tt.want == ErrInvalidID {
+			if _, ok := IsPublic(tt.s); ok {
+				t.Errorf("%s: IsPublic(%q) = true", tt.name, tt.s)
+			}
+		}
+	}
+}
+
+func TestFormatLeavesNonUUIDsAlone(t *testing.T) {
+	for _, s := range []string{"", "books", "prod_0000"} {
+		if got := Format(Product, s); got != s {
+			t.Errorf("Format(%q) = %q", s, got)
+		}
+	}
+}
+
+// TestFormatKeepsUUIDOrder checks public IDs sort like the UUIDs they
+// encode, so IDs of time-ordered UUIDs sort by creation time.
+func TestFormatKeepsUUIDOrder(t *testing.T) {
+	ids := make([]string, 500)
+	for i := range ids {
+		ids[i] = uuid.NewString()
+	}
+	sort.Strings(ids)
+
+	public := make([]string, len(ids))
+	for i, id := range ids {
+		public[i] = Format(Category, id)
+	}
+	if !sort.StringsAreSorted(public) {
+		t.Error("public IDs do not sort like their UUIDs")
+	}
+}
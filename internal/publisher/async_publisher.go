@@ -0,0 +1,155 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"user-service/internal/domain"
+	"user-service/internal/reqctx"
+	"user-service/internal/timing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// publishTimeout bounds a single delivery attempt made by a worker.
+const publishTimeout = 15 * time.Second
+
+var ErrPublisherClosed = errors.New("audit publisher is closed")
+
+// EventPublisher is implemented by the synchronous sinks AsyncAuditPublisher delivers to.
+type EventPublisher interface {
+	Publish(ctx context.Context, event domain.AuditEvent) error
+}
+
+// workItem is a queued event together with the request metadata captured at
+// enqueue time, since the request context is usually done by delivery.
+type workItem struct {
+	event     domain.AuditEvent
+	requestID string
+	actor     string
+}
+
+// AsyncAuditPublisher hands audit events to a pool of workers so callers don't
+// wait for delivery. Each worker owns its own queue and events are routed by
+// EntityID, so events for the same entity are delivered in the order they were
+// published while different entities are delivered in parallel.
+type AsyncAuditPublisher struct {
+	next   EventPublisher
+	queues []chan workItem
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func NewAsyncAuditPublisher(next EventPublisher, workers, queueDepth int) *AsyncAuditPublisher {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueDepth <= 0 {
+		queueDepth = 1
+	}
+
+	p := &AsyncAuditPublisher{
+		next:   next,
+		queues: make([]chan workItem, workers),
+	}
+
+	for i := range p.queues {
+		p.queues[i] = make(chan workItem, queueDepth)
+		p.wg.Add(1)
+		go p.work(i, p.queues[i])
+	}
+
+	log.WithFields(log.Fields{
+		"workers":     workers,
+		"queue_depth": queueDepth,
+	}).Info("Async audit publisher started")
+
+	return p
+}
+
+// Publish enqueues event for delivery. It blocks only while the entity's queue
+// is full, and gives up when ctx is done.
+func (p *AsyncAuditPublisher) Publish(ctx context.Context, event domain.AuditEvent) error {
+	defer timing.Record(ctx, "audit_enqueue", time.Now())
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrPublisherClosed
+	}
+
+	// Stamp unstamped events now rather than when a worker gets to them, so
+	// queueing lag doesn't shift the event time.
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now().UTC()
+	}
+
+	item := workItem{
+		event:     event,
+		requestID: reqctx.RequestID(ctx),
+		actor:     reqctx.Actor(ctx),
+	}
+	if item.actor == "" {
+		item.actor = event.Actor
+	}
+
+	select {
+	case p.queues[p.queueFor(event.EntityID)] <- item:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting events and waits until every queued event has been delivered.
+func (p *AsyncAuditPublisher) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	for _, q := range p.queues {
+		close(q)
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	log.Info("Async audit publisher drained")
+}
+
+func (p *AsyncAuditPublisher) queueFor(entityID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(entityID))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+func (p *AsyncAuditPublisher) work(id int, queue <-chan workItem) {
+	defer p.wg.Done()
+
+	for item := range queue {
+		ctx := reqctx.WithRequestID(context.Background(), item.requestID)
+		ctx = reqctx.WithActor(ctx, item.actor)
+		ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+
+		entry := log.WithFields(log.Fields{
+			"worker":     id,
+			"event_type": item.event.EventType,
+			"entity_id":  item.event.EntityID,
+			"request_id": item.requestID,
+			"actor":      item.actor,
+		})
+		if err := p.next.Publish(ctx, item.event); err != nil {
+			entry.WithError(err).Error("Failed to publish audit event")
+		} else {
+			entry.Debug("Audit event published")
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,200 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/reqctx"
+
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+// recordingPublisher records the events it is given per entity, taking
+// delay over each, and tracks how many deliveries overlap.
+type recordingPublisher struct {
+	delay time.Duration
+
+	mu          sync.Mutex
+	byEntity    map[string][]int
+	inFlight    map[string]bool
+	concurrent  int
+	maxParallel int
+	overlapped  []string
+}
+
+func newRecordingPublisher(delay time.Duration) *recordingPublisher {
+	return &recordingPublisher{delay: delay, byEntity: map[string][]int{}, inFlight: map[string]bool{}}
+}
+
+func (r *recordingPublisher) Publish(ctx context.Context, event domain.AuditEvent) error {
+	r.mu.Lock()
+	if r.inFlight[event.EntityID] {
+		r.overlapped = append(r.overlapped, event.EntityID)
+	}
+	r.inFlight[event.EntityID] = true
+	r.concurrent++
+	r.maxParallel = max(r.maxParallel, r.concurrent)
+	r.mu.Unlock()
+
+	time.Sleep(r.delay)
+
+	r.mu.Lock()
+	r.byEntity[event.EntityID] = append(r.byEntity[event.EntityID], event.Payload["seq"].(int))
+	r.inFlight[event.EntityID] = false
+	r.concurrent--
+	r.mu.Unlock()
+	return nil
+}
+
+func TestAsyncPublisherKeepsEntityOrder(t *testing.T) {
+	const entities, perEntity = 16, 12
+
+	for _, workers := range []int{1, 8} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			sink := newRecordingPublisher(time.Millisecond)
+			p := NewAsyncAuditPublisher(sink, workers, 4)
+
+			// Interleave entities as concurrent requests would
+			for seq := 0; seq < perEntity; seq++ {
+				for e := 0; e < entities; e++ {
+					event := domain.AuditEvent{
+						EventType: domain.AuditUserCoinsAdded,
+						EntityID:  fmt.Sprintf("entity-%02d", e),
+						Payload:   map[string]interface{}{"seq": seq},
+					}
+					if err := p.Publish(context.Background(), event); err != nil {
+						t.Fatalf("Publish: %v", err)
+					}
+				}
+			}
+			p.Close()
+
+			if len(sink.byEntity) != entities {
+				t.Fatalf("delivered events of %d entities, want %d", len(sink.byEntity), entities)
+			}
+			for entity, seqs := range sink.byEntity {
+				if len(seqs) != perEntity {
+					t.Errorf("%s: %d events delivered, want %d", entity, len(seqs), perEntity)
+					continue
+				}
+				for i, seq := range seqs {
+					if seq != i {
+						t.Errorf("%s delivered out of order: %v", entity, seqs)
+						break
+					}
+				}
+			}
+			if len(sink.overlapped) > 0 {
+				t.Errorf("events of one entity delivered concurrently: %v", sink.overlapped)
+			}
+
+			// Different entities are delivered in parallel, up to the pool size
+			if sink.maxParallel > workers {
+				t.Errorf("%d deliveries in parallel with %d workers", sink.maxParallel, workers)
+			}
+			if workers > 1 && sink.maxParallel < 2 {
+				t.Errorf("%d workers never delivered in parallel", workers)
+			}
+		})
+	}
+}
+
+func TestAsyncPublisherRejectsAfterClose(t *testing.T) {
+	p := NewAsyncAuditPublisher(newRecordingPublisher(0), 2, 1)
+	p.Close()
+	p.Close()
+	if err := p.Publish(context.Background(), domain.AuditEvent{EntityID: "entity"}); err != ErrPublisherClosed {
+		t.Errorf("Publish after Close: %v, want ErrPublisherClosed", err)
+	}
+}
+
+func TestAsyncPublisherKeepsOccurredAt(t *testing.T) {
+	sink := newCapturingPublisher()
+	p := NewAsyncAuditPublisher(sink, 1, 4)
+
+	occurred := time.Now().UTC().Add(-time.Hour).Truncate(time.Microsecond)
+	before := time.Now().UTC()
+	if err := p.Publish(context.Background(), domain.AuditEvent{EntityID: "stamped", OccurredAt: occurred}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if err := p.Publish(context.Background(), domain.AuditEvent{EntityID: "unstamped"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	enqueued := time.Now().UTC()
+	p.Close()
+
+	if got := sink.events["stamped"].OccurredAt; !got.Equal(occurred) {
+		t.Errorf("stamped event delivered as occurring at %v, want %v", got, occurred)
+	}
+	// An unstamped event is stamped when queued, not when delivered
+	if got := sink.events["unstamped"].OccurredAt; got.Before(before) || got.After(enqueued) {
+		t.Errorf("unstamped event stamped %v, want between %v and %v", got, before, enqueued)
+	}
+}
+
+// capturingPublisher keeps the last event delivered per entity.
+type capturingPublisher struct {
+	mu     sync.Mutex
+	events map[string]domain.AuditEvent
+}
+
+func newCapturingPublisher() *capturingPublisher {
+	return &capturingPublisher{events: map[string]domain.AuditEvent{}}
+}
+
+func (c *capturingPublisher) Publish(ctx context.Context, event domain.AuditEvent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events[event.EntityID] = event
+	return nil
+}
+
+// failingPublisher fails every delivery with err.
+type failingPublisher struct {
+	err error
+}
+
+func (f failingPublisher) Publish(ctx context.Context, event domain.AuditEvent) error {
+	return f.err
+}
+
+func TestAsyncPublishLogCarriesRequestID(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+	level := log.GetLevel()
+	log.SetLevel(log.DebugLevel)
+	defer log.SetLevel(level)
+
+	for _, sink := range []EventPublisher{newCapturingPublisher(), failingPublisher{errors.New("broker unreachable")}} {
+		hook.Reset()
+		p := NewAsyncAuditPublisher(sink, 2, 4)
+
+		// The request is over by the time the worker delivers
+		ctx, cancel := context.WithCancel(reqctx.WithActor(reqctx.WithRequestID(context.Background(), "req-729"), "admin"))
+		if err := p.Publish(ctx, domain.AuditEvent{EventType: domain.AuditUserCoinsAdded, EntityID: "user-1"}); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		cancel()
+		p.Close()
+
+		var found bool
+		for _, entry := range hook.AllEntries() {
+			if entry.Data["entity_id"] != "user-1" {
+				continue
+			}
+			found = true
+			if entry.Data["request_id"] != "req-729" || entry.Data["actor"] != "admin" {
+				t.Errorf("%T: %q logged with request_id %v and actor %v, want req-729 and admin",
+					sink, entry.Message, entry.Data["request_id"], entry.Data["actor"])
+			}
+		}
+		if !found {
+			t.Errorf("%T: no publish log line for the event", sink)
+		}
+	}
+}
@@ -4,71 +4,188 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"user-service/internal/domain"
+	"user-service/internal/timing"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 )
 
+// deliveryTimeout is how long the producer tries to deliver a message
+// before reporting it failed.
+const deliveryTimeout = 10 * time.Second
+
+// producer is the part of *kafka.Producer the publisher uses.
+type producer interface {
+	Produce(msg *kafka.Message, deliveryChan chan kafka.Event) error
+	Events() chan kafka.Event
+	GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error)
+	Flush(timeoutMs int) int
+	Close()
+}
+
 type AuditPublisher struct {
-	producer *kafka.Producer
+	producer producer
 	topic    string
+	// deliveries holds idle *delivery values, so producing a message
+	// allocates no channel of its own.
+	deliveries sync.Pool
+	// eventsDone is closed once the producer's events are drained.
+	eventsDone chan struct{}
+}
+
+// delivery carries the delivery report of one message from the events loop
+// to the caller that produced it. It rides along as the message's Opaque.
+type delivery struct {
+	result chan error
 }
 
 func NewAuditPublisher(bootstrapServers, topic string) (*AuditPublisher, error) {
-	p, err := kafka.NewProducer(&kafka.ConfigMap{"bootstrap.servers": bootstrapServers})
+	p, err := kafka.NewProducer(&kafka.ConfigMap{
+		"bootstrap.servers":  bootstrapServers,
+		"message.timeout.ms": int(deliveryTimeout.Milliseconds()),
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create kafka producer: %w", err)
 	}
 
 	log.Info("Audit Kafka producer created successfully for user-service")
 
-	return &AuditPublisher{producer: p, topic: topic}, nil
+	return newAuditPublisher(p, topic), nil
+}
+
+func newAuditPublisher(p producer, topic string) *AuditPublisher {
+	publisher := &AuditPublisher{
+		producer:   p,
+		topic:      topic,
+		eventsDone: make(chan struct{}),
+	}
+	publisher.deliveries.New = func() interface{} {
+		return &delivery{result: make(chan error, 1)}
+	}
+	go publisher.handleEvents()
+	return publisher
 }
 
+// handleEvents routes the delivery reports on the producer's shared events
+// channel to the callers waiting for them, until the producer is closed.
+func (p *AuditPublisher) handleEvents() {
+	defer close(p.eventsDone)
+	for e := range p.producer.Events() {
+		switch ev := e.(type) {
+		case *kafka.Message:
+			d, ok := ev.Opaque.(*delivery)
+			if !ok {
+				log.WithField("topic", p.topic).Warn("Kafka delivery report for an unknown message")
+				continue
+			}
+			// Buffered, so a caller that stopped waiting doesn't block the loop
+			d.result <- ev.TopicPartition.Error
+		case kafka.Error:
+			log.WithError(ev).Warn("Kafka producer error")
+		}
+	}
+}
+
+// replayedHeader marks messages re-published from the audit store.
+const replayedHeader = "replayed"
+
 func (p *AuditPublisher) Publish(ctx context.Context, event domain.AuditEvent) error {
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
 	if event.OccurredAt.IsZero() {
 		event.OccurredAt = time.Now().UTC()
 	}
 
+	return p.produce(ctx, event, nil)
+}
+
+// Replay re-publishes a stored event unchanged, keeping its ID and OccurredAt,
+// with a "replayed: true" header so consumers can tell it apart.
+func (p *AuditPublisher) Replay(ctx context.Context, event domain.AuditEvent) error {
+	return p.produce(ctx, event, []kafka.Header{{Key: replayedHeader, Value: []byte("true")}})
+}
+
+func (p *AuditPublisher) produce(ctx context.Context, event domain.AuditEvent, headers []kafka.Header) error {
+	defer timing.Record(ctx, "kafka_publish", time.Now())
+
 	payload, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("failed to marshal audit event: %w", err)
 	}
 
-	deliveryChan := make(chan kafka.Event, 1)
-	defer close(deliveryChan)
-
+	d := p.deliveries.Get().(*delivery)
 	if err := p.producer.Produce(&kafka.Message{
 		TopicPartition: kafka.TopicPartition{Topic: &p.topic, Partition: kafka.PartitionAny},
 		Key:            []byte(event.EntityID),
 		Value:          payload,
-		Opaque:         deliveryChan,
+		Headers:        headers,
+		Opaque:         d,
 	}, nil); err != nil {
+		p.deliveries.Put(d)
 		return fmt.Errorf("failed to produce message: %w", err)
 	}
 
+	// The producer reports every message within deliveryTimeout, failed or not
 	select {
-	case e := <-deliveryChan:
-		msg, ok := e.(*kafka.Message)
-		if !ok {
-			return fmt.Errorf("unexpected event type: %T", e)
-		}
-		if msg.TopicPartition.Error != nil {
-			return fmt.Errorf("delivery failed: %w", msg.TopicPartition.Error)
+	case err := <-d.result:
+		p.deliveries.Put(d)
+		if err != nil {
+			return fmt.Errorf("delivery failed: %w", err)
 		}
 		return nil
-	case <-time.After(10 * time.Second):
-		return fmt.Errorf("delivery timeout")
 	case <-ctx.Done():
+		// The report is still coming, so d can't be reused
 		return ctx.Err()
 	}
 }
 
+// kafkaReadyRetryInterval is the pause between broker reachability checks.
+const kafkaReadyRetryInterval = 2 * time.Second
+
+// kafkaMetadataTimeout bounds a single metadata request.
+const kafkaMetadataTimeout = 5 * time.Second
+
+// WaitReady blocks until a broker answers a metadata request for the audit
+// topic, retrying until ctx is done.
+func (p *AuditPublisher) WaitReady(ctx context.Context) error {
+	return waitReady(ctx, kafkaReadyRetryInterval, func() error {
+		timeout := kafkaMetadataTimeout
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+			timeout = time.Until(deadline)
+		}
+		_, err := p.producer.GetMetadata(&p.topic, false, int(timeout.Milliseconds()))
+		return err
+	})
+}
+
+// waitReady calls check until it succeeds, pausing interval between
+// attempts. It gives up with the last check error once ctx is done.
+func waitReady(ctx context.Context, interval time.Duration, check func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := check()
+		if err == nil {
+			return nil
+		}
+
+		log.WithError(err).WithField("attempt", attempt).Warn("Kafka is not reachable yet")
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return fmt.Errorf("kafka not reachable after %d attempts: %w", attempt, err)
+		}
+	}
+}
+
 func (p *AuditPublisher) Close() {
 	log.Info("Closing audit Kafka producer for user-service...")
 	p.producer.Flush(15 * 1000)
 	p.producer.Close()
+	<-p.eventsDone
 }
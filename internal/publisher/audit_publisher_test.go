@@ -0,0 +1,287 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"user-service/internal/domain"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// fakeProducer reports the delivery of each message on its events channel,
+// like librdkafka. With hold set, reports wait for release.
+type fakeProducer struct {
+	events chan kafka.Event
+	hold   bool
+	// fail is the delivery error for messages by key.
+	fail map[string]error
+	// metadataErr fails every metadata request, as an unreachable broker would.
+	metadataErr error
+
+	mu               sync.Mutex
+	produced         []*kafka.Message
+	held             []*kafka.Message
+	metadataTimeouts []int
+}
+
+func newFakeProducer() *fakeProducer {
+	return &fakeProducer{events: make(chan kafka.Event, 1024), fail: map[string]error{}}
+}
+
+func (f *fakeProducer) Produce(msg *kafka.Message, deliveryChan chan kafka.Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.produced = append(f.produced, msg)
+	if f.hold {
+		f.held = append(f.held, msg)
+		return nil
+	}
+	f.report(msg)
+	return nil
+}
+
+func (f *fakeProducer) report(msg *kafka.Message) {
+	report := *msg
+	report.TopicPartition.Error = f.fail[string(msg.Key)]
+	f.events <- &report
+}
+
+// release reports the held messages, last produced first.
+func (f *fakeProducer) release() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.held) - 1; i >= 0; i-- {
+		f.report(f.held[i])
+	}
+	f.held = nil
+}
+
+func (f *fakeProducer) heldCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.held)
+}
+
+func (f *fakeProducer) Events() chan kafka.Event { return f.events }
+
+func (f *fakeProducer) GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.metadataTimeouts = append(f.metadataTimeouts, timeoutMs)
+	if f.metadataErr != nil {
+		return nil, f.metadataErr
+	}
+	return &kafka.Metadata{}, nil
+}
+
+func (f *fakeProducer) Flush(timeoutMs int) int { return 0 }
+
+func (f *fakeProducer) Close() { close(f.events) }
+
+// TestDeliveryReportsReachTheirCallers delivers reports in the reverse order
+// of publishing, some failed, and checks each caller gets its own.
+func TestDeliveryReportsReachTheirCallers(t *testing.T) {
+	fake := newFakeProducer()
+	fake.hold = true
+	p := newAuditPublisher(fake, "audit")
+	defer p.Close()
+
+	const publishers = 50
+	errs := make([]error, publishers)
+	var wg sync.WaitGroup
+	for i := 0; i < publishers; i++ {
+		key := fmt.Sprintf("entity-%d", i)
+		if i%3 == 0 {
+			fake.fail[key] = kafka.NewError(kafka.ErrMsgTimedOut, "timed out", false)
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = p.Publish(context.Background(), domain.AuditEvent{EntityID: key})
+		}(i)
+	}
+	for fake.heldCount() < publishers {
+		time.Sleep(time.Millisecond)
+	}
+	fake.release()
+	wg.Wait()
+
+	for i, err := range errs {
+		if wantFailed := i%3 == 0; (err != nil) != wantFailed {
+			t.Errorf("publisher %d: error %v, want failed %v", i, err, wantFailed)
+		}
+	}
+}
+
+func TestUnknownDeliveryReportIsSkipped(t *testing.T) {
+	fake := newFakeProducer()
+	p := newAuditPublisher(fake, "audit")
+	defer p.Close()
+
+	fake.events <- &kafka.Message{Opaque: "not ours"}
+	fake.events <- kafka.NewError(kafka.ErrAllBrokersDown, "all brokers down", false)
+
+	if err := p.Publish(context.Background(), domain.AuditEvent{EntityID: "e1"}); err != nil {
+		t.Fatalf("Publish after foreign events: %v", err)
+	}
+}
+
+// TestAbandonedDeliveryDoesNotBlock stops waiting for a report that comes
+// later, and checks the events loop still serves other publishes.
+func TestAbandonedDeliveryDoesNotBlock(t *testing.T) {
+	fake := newFakeProducer()
+	fake.hold = true
+	p := newAuditPublisher(fake, "audit")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.Publish(ctx, domain.AuditEvent{EntityID: "slow"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Publish with a report pending: got %v, want DeadlineExceeded", err)
+	}
+	fake.release()
+
+	fake.hold = false
+	if err := p.Publish(context.Background(), domain.AuditEvent{EntityID: "next"}); err != nil {
+		t.Fatalf("Publish after an abandoned delivery: %v", err)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		p.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not return")
+	}
+}
+
+func TestPublishAndReplayMessages(t *testing.T) {
+	fake := newFakeProducer()
+	p := newAuditPublisher(fake, "audit")
+	defer p.Close()
+
+	if err := p.Publish(context.Background(), domain.AuditEvent{EventType: "user_created", EntityID: "u1"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	stored := domain.AuditEvent{
+		ID:         "0190c2a8-7f1e-7a3b-9c4d-000000000001",
+		EventType:  "user_created",
+		EntityID:   "u1",
+		OccurredAt: time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC),
+	}
+	if err := p.Replay(context.Background(), stored); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+
+	published, replayed := fake.produced[0], fake.produced[1]
+	var event domain.AuditEvent
+	if err := json.Unmarshal(published.Value, &event); err != nil {
+		t.Fatalf("decode published event: %v", err)
+	}
+	if event.ID == "" || event.OccurredAt.IsZero() {
+		t.Errorf("published event has ID %q and OccurredAt %v, want both set", event.ID, event.OccurredAt)
+	}
+	if string(published.Key) != "u1" || *published.TopicPartition.Topic != "audit" || len(published.Headers) != 0 {
+		t.Errorf("published key %q, topic %q, headers %v", published.Key, *published.TopicPartition.Topic, published.Headers)
+	}
+
+	if err := json.Unmarshal(replayed.Value, &event); err != nil {
+		t.Fatalf("decode replayed event: %v", err)
+	}
+	if event.ID != stored.ID || !event.OccurredAt.Equal(stored.OccurredAt) {
+		t.Errorf("replayed event has ID %q and OccurredAt %v, want the stored ones", event.ID, event.OccurredAt)
+	}
+	if len(replayed.Headers) != 1 || replayed.Headers[0].Key != replayedHeader || string(replayed.Headers[0].Value) != "true" {
+		t.Errorf("replayed headers %v", replayed.Headers)
+	}
+}
+
+func TestWaitReadyGivesUpOnUnreachableBroker(t *testing.T) {
+	fake := newFakeProducer()
+	fake.metadataErr = kafka.NewError(kafka.ErrTransport, "connection refused", false)
+	p := newAuditPublisher(fake, "audit")
+	defer p.Close()
+
+	const timeout = 100 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	err := p.WaitReady(ctx)
+	elapsed := time.Since(start)
+
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Fatalf("WaitReady: got %v, want the broker error", err)
+	}
+	// The startup timeout bounds the wait, not the retry interval
+	if elapsed < timeout || elapsed > timeout+kafkaReadyRetryInterval/2 {
+		t.Errorf("gave up after %v, want shortly after %v", elapsed, timeout)
+	}
+	if len(fake.metadataTimeouts) == 0 || fake.metadataTimeouts[0] > int(timeout.Milliseconds()) {
+		t.Errorf("metadata requests with timeouts %v ms, want at most the %v left", fake.metadataTimeouts, timeout)
+	}
+}
+
+func TestWaitReadyReachableBroker(t *testing.T) {
+	p := newAuditPublisher(newFakeProducer(), "audit")
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := p.WaitReady(ctx); err != nil {
+		t.Fatalf("WaitReady: %v", err)
+	}
+}
+
+func TestWaitReadyRetriesUntilReachable(t *testing.T) {
+	unreachable := errors.New("connection refused")
+	attempts := 0
+	err := waitReady(context.Background(), time.Millisecond, func() error {
+		attempts++
+		if attempts < 4 {
+			return unreachable
+		}
+		return nil
+	})
+	if err != nil || attempts != 4 {
+		t.Errorf("waitReady: %v after %d attempts, want success on the 4th", err, attempts)
+	}
+
+	// Out of time, the last error is returned after one more attempt
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	attempts = 0
+	err = waitReady(ctx, time.Hour, func() error { attempts++; return unreachable })
+	if !errors.Is(err, unreachable) || attempts != 1 {
+		t.Errorf("waitReady with no time left: %v after %d attempts, want the check error after 1", err, attempts)
+	}
+}
+
+func BenchmarkPublish(b *testing.B) {
+	fake := newFakeProducer()
+	p := newAuditPublisher(fake, "audit")
+	defer p.Close()
+	event := domain.AuditEvent{
+		ID:         "0190c2a8-7f1e-7a3b-9c4d-000000000001",
+		EventType:  "user_coins_added",
+		EntityID:   "0190c2a8-7f1e-7a3b-9c4d-000000000002",
+		OccurredAt: time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC),
+	}
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := p.Publish(context.Background(), event); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
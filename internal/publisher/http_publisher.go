@@ -0,0 +1,66 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"user-service/internal/domain"
+	"user-service/internal/timing"
+
+	"github.com/google/uuid"
+)
+
+// HTTPAuditPublisher POSTs each audit event as JSON to a collector URL. Any
+// non-2xx response is a failed delivery.
+type HTTPAuditPublisher struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPAuditPublisher(url string, timeout time.Duration) *HTTPAuditPublisher {
+	return &HTTPAuditPublisher{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *HTTPAuditPublisher) Publish(ctx context.Context, event domain.AuditEvent) error {
+	defer timing.Record(ctx, "http_audit_publish", time.Now())
+
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now().UTC()
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to build audit request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", event.ID)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post audit event: %w", err)
+	}
+	defer resp.Body.Close()
+	// Drain the body so the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("audit collector responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
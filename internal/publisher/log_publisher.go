@@ -0,0 +1,38 @@
+package publisher
+
+import (
+	"context"
+	"time"
+
+	"user-service/internal/domain"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// LogAuditPublisher writes audit events to the service log. It suits local
+// development, where no broker is running.
+type LogAuditPublisher struct{}
+
+func NewLogAuditPublisher() *LogAuditPublisher {
+	return &LogAuditPublisher{}
+}
+
+func (p *LogAuditPublisher) Publish(ctx context.Context, event domain.AuditEvent) error {
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now().UTC()
+	}
+
+	log.WithFields(log.Fields{
+		"event_id":    event.ID,
+		"event_type":  event.EventType,
+		"entity_id":   event.EntityID,
+		"actor":       event.Actor,
+		"occurred_at": event.OccurredAt,
+		"payload":     event.Payload,
+	}).Info("Audit event")
+	return nil
+}
@@ -0,0 +1,60 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"user-service/internal/domain"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// Sink is one named destination of a MultiAuditPublisher.
+type Sink struct {
+	Name      string
+	Publisher EventPublisher
+}
+
+// MultiAuditPublisher fans every event out to several sinks at once. Sinks are
+// isolated from each other: each is published to concurrently, and a failing
+// sink is logged and reported without keeping the event from the others.
+type MultiAuditPublisher struct {
+	sinks []Sink
+}
+
+func NewMultiAuditPublisher(sinks ...Sink) *MultiAuditPublisher {
+	return &MultiAuditPublisher{sinks: sinks}
+}
+
+// Publish delivers event to every sink and returns the joined errors of those
+// that failed. The event ID is assigned up front, so all sinks see the same one.
+func (p *MultiAuditPublisher) Publish(ctx context.Context, event domain.AuditEvent) error {
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now().UTC()
+	}
+
+	errs := make([]error, len(p.sinks))
+	var wg sync.WaitGroup
+	for i, sink := range p.sinks {
+		wg.Go(func() {
+			if err := sink.Publisher.Publish(ctx, event); err != nil {
+				log.WithError(err).WithFields(log.Fields{
+					"sink":       sink.Name,
+					"event_id":   event.ID,
+					"event_type": event.EventType,
+				}).Warn("Audit sink failed to publish event")
+				errs[i] = fmt.Errorf("audit sink %s: %w", sink.Name, err)
+			}
+		})
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,165 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"user-service/internal/domain"
+
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+// collector stands in for the HTTP audit collector, answering with status
+// and keeping what it was sent.
+type collector struct {
+	status int
+
+	mu     sync.Mutex
+	events []domain.AuditEvent
+	keys   []string
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var event domain.AuditEvent
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	c.events = append(c.events, event)
+	c.keys = append(c.keys, r.Header.Get("Idempotency-Key"))
+	c.mu.Unlock()
+	w.WriteHeader(c.status)
+}
+
+func TestMultiPublisherFansOutOneEvent(t *testing.T) {
+	kafka := newCapturingPublisher()
+	logSink := newCapturingPublisher()
+	c := &collector{status: http.StatusAccepted}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	p := NewMultiAuditPublisher(
+		Sink{Name: "kafka", Publisher: kafka},
+		Sink{Name: "log", Publisher: logSink},
+		Sink{Name: "http", Publisher: NewHTTPAuditPublisher(server.URL, time.Second)},
+	)
+	if err := p.Publish(context.Background(), domain.AuditEvent{EventType: domain.AuditUserCreated, EntityID: "user-1"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	fromKafka, fromLog := kafka.events["user-1"], logSink.events["user-1"]
+	if fromKafka.ID == "" || fromKafka.OccurredAt.IsZero() {
+		t.Fatalf("sink got event %+v without an ID and time", fromKafka)
+	}
+	// Every sink sees the same ID, so downstream dedupe works across them
+	if fromLog.ID != fromKafka.ID || !fromLog.OccurredAt.Equal(fromKafka.OccurredAt) {
+		t.Errorf("log sink got %s at %v, kafka %s at %v", fromLog.ID, fromLog.OccurredAt, fromKafka.ID, fromKafka.OccurredAt)
+	}
+	if len(c.events) != 1 || c.events[0].ID != fromKafka.ID || c.keys[0] != fromKafka.ID {
+		t.Errorf("collector got %v with keys %v, want event %s", c.events, c.keys, fromKafka.ID)
+	}
+}
+
+// blockingPublisher holds every delivery until release is closed.
+type blockingPublisher struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b blockingPublisher) Publish(ctx context.Context, event domain.AuditEvent) error {
+	close(b.started)
+	<-b.release
+	return nil
+}
+
+func TestMultiPublisherPartialFailure(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	healthy := newCapturingPublisher()
+	slow := blockingPublisher{started: make(chan struct{}), release: make(chan struct{})}
+	down := &collector{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(down)
+	defer server.Close()
+	brokerErr := errors.New("broker unreachable")
+
+	p := NewMultiAuditPublisher(
+		Sink{Name: "slow", Publisher: slow},
+		Sink{Name: "kafka", Publisher: failingPublisher{brokerErr}},
+		Sink{Name: "log", Publisher: healthy},
+		Sink{Name: "http", Publisher: NewHTTPAuditPublisher(server.URL, time.Second)},
+	)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Publish(context.Background(), domain.AuditEvent{EventType: domain.AuditUserCoinsAdded, EntityID: "user-1"})
+	}()
+	// A slow sink holds up neither the other sinks nor their failures
+	<-slow.started
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		healthy.mu.Lock()
+		_, delivered := healthy.events["user-1"]
+		healthy.mu.Unlock()
+		down.mu.Lock()
+		posted := len(down.events)
+		down.mu.Unlock()
+		if delivered && posted == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("other sinks waited on the slow one")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Publish returned %v before every sink finished", err)
+	default:
+	}
+	close(slow.release)
+
+	err := <-done
+	if !errors.Is(err, brokerErr) {
+		t.Errorf("Publish: got %v, want it to wrap the kafka sink's error", err)
+	}
+	for _, want := range []string{"audit sink kafka", "audit sink http"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Publish: got %v, want it to name %q", err, want)
+		}
+	}
+	if err != nil && (strings.Contains(err.Error(), "audit sink log") || strings.Contains(err.Error(), "audit sink slow")) {
+		t.Errorf("Publish: %v names a sink that delivered", err)
+	}
+
+	failed := map[string]bool{}
+	for _, entry := range hook.AllEntries() {
+		if entry.Message == "Audit sink failed to publish event" {
+			failed[entry.Data["sink"].(string)] = true
+		}
+	}
+	if len(failed) != 2 || !failed["kafka"] || !failed["http"] {
+		t.Errorf("logged failures for %v, want kafka and http", failed)
+	}
+}
+
+func TestMultiPublisherAllSinksHealthy(t *testing.T) {
+	a, b := newCapturingPublisher(), newCapturingPublisher()
+	p := NewMultiAuditPublisher(Sink{Name: "a", Publisher: a}, Sink{Name: "b", Publisher: b})
+
+	for _, entity := range []string{"user-1", "user-2", "user-3"} {
+		if err := p.Publish(context.Background(), domain.AuditEvent{EventType: domain.AuditUserUpdated, EntityID: entity}); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+	if len(a.events) != 3 || len(b.events) != 3 {
+		t.Errorf("sinks got %d and %d events, want 3 each", len(a.events), len(b.events))
+	}
+}
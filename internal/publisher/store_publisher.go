@@ -0,0 +1,48 @@
+package publisher
+
+import (
+	"context"
+	"time"
+
+	"user-service/internal/domain"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// EventStore keeps a copy of published audit events so they can be replayed.
+type EventStore interface {
+	SaveEvent(ctx context.Context, event domain.AuditEvent) error
+}
+
+// StoringAuditPublisher records every event in an EventStore before passing it
+// on. It assigns the event ID up front, so the stored copy and the delivered
+// one carry the same ID and a replay is deduplicated by consumers.
+type StoringAuditPublisher struct {
+	store EventStore
+	next  EventPublisher
+}
+
+func NewStoringAuditPublisher(store EventStore, next EventPublisher) *StoringAuditPublisher {
+	return &StoringAuditPublisher{store: store, next: next}
+}
+
+// Publish stores event and passes it on. A failure to store is logged rather
+// than returned: the event is still delivered, it just cannot be replayed.
+func (p *StoringAuditPublisher) Publish(ctx context.Context, event domain.AuditEvent) error {
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now().UTC()
+	}
+
+	if err := p.store.SaveEvent(ctx, event); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"event_id":   event.ID,
+			"event_type": event.EventType,
+		}).Warn("Failed to store audit event for replay")
+	}
+
+	return p.next.Publish(ctx, event)
+}
@@ -0,0 +1,27 @@
+package publisher
+
+import (
+	"context"
+
+	"user-service/internal/domain"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LogVerificationSender "delivers" email verification tokens by logging them.
+// It stands in until a mail provider is integrated; the token itself is only
+// logged at debug level.
+type LogVerificationSender struct{}
+
+func NewLogVerificationSender() *LogVerificationSender {
+	return &LogVerificationSender{}
+}
+
+func (s *LogVerificationSender) SendVerification(ctx context.Context, user *domain.User, token string) error {
+	log.WithField("user_id", user.ID).Info("Email verification requested")
+	log.WithFields(log.Fields{
+		"user_id": user.ID,
+		"token":   token,
+	}).Debug("Email verification token issued")
+	return nil
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/reqctx"
+	"user-service/internal/timing"
+)
+
+// dbExecutor is what *sql.DB and *sql.Tx have in common.
+type dbExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// adminActor returns the caller of ctx when it is an admin acting on
+// someone else's account. Self-service changes and requests without a known
+// actor are not admin actions.
+func adminActor(ctx context.Context, userID string) (string, bool) {
+	actor := reqctx.Actor(ctx)
+	if actor == "" || actor == userID || !reqctx.IsAdmin(ctx) {
+		return "", false
+	}
+	return actor, true
+}
+
+// recordAdminAction stores action on userID if the caller of ctx is an admin
+// acting on someone else's account, and does nothing otherwise. q should be
+// the transaction that made the change.
+func recordAdminAction(ctx context.Context, q dbExecutor, userID, action string, details map[string]interface{}) error {
+	actor, ok := adminActor(ctx, userID)
+	if !ok {
+		return nil
+	}
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	encoded, err := json.Marshal(details)
+	if err != nil {
+		return wrapErr("encode admin action details", err)
+	}
+	_, err = q.ExecContext(ctx, `
+		INSERT INTO user_admin_actions (user_id, actor, action, details)
+		VALUES ($1, $2, $3, $4)`,
+		userID, actor, action, encoded,
+	)
+	if err != nil {
+		return wrapErr("record admin action", err)
+	}
+	return nil
+}
+
+// withAdminAction runs fn and, when the caller of ctx is an admin acting on
+// userID, records action in the same transaction. Otherwise fn runs directly
+// on the pool.
+func (r *postgresUserRepository) withAdminAction(ctx context.Context, userID, action string, details map[string]interface{}, fn func(q dbExecutor) error) error {
+	if _, ok := adminActor(ctx, userID); !ok {
+		return fn(r.db)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapErr("begin admin action", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := recordAdminAction(ctx, tx, userID, action, details); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return wrapErr("commit admin action", err)
+	}
+	return nil
+}
+
+// ListAdminActions returns a page of the admin actions taken on the user,
+// newest first, and the number of them in total.
+func (r *postgresUserRepository) ListAdminActions(ctx context.Context, userID string, limit, offset int) ([]domain.AdminAction, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_list_admin_actions", time.Now())
+
+	var total int64
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM user_admin_actions WHERE user_id = $1`, userID).Scan(&total); err != nil {
+		return nil, 0, wrapErr("count admin actions", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, actor, action, details, created_at
+		FROM user_admin_actions
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3`, userID, limit, offset)
+	if err != nil {
+		return nil, 0, wrapErr("list admin actions", err)
+	}
+	defer rows.Close()
+
+	actions := []domain.AdminAction{}
+	for rows.Next() {
+		var a domain.AdminAction
+		var details []byte
+		if err := rows.Scan(&a.ID, &a.UserID, &a.Actor, &a.Action, &details, &a.CreatedAt); err != nil {
+			return nil, 0, wrapErr("scan admin action", err)
+		}
+		a.Details = json.RawMessage(details)
+		actions = append(actions, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, wrapErr("iterate admin actions", err)
+	}
+
+	return actions, total, nil
+}
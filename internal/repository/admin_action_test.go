@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"user-service/internal/domain"
+	"user-service/internal/reqctx"
+)
+
+func TestAdminActor(t *testing.T) {
+	const user, operator = "0190c2a8-7f1e-7a3b-9c4d-000000000001", "0190c2a8-7f1e-7a3b-9c4d-000000000002"
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want bool
+	}{
+		{"admin on another user", reqctx.WithAdmin(reqctx.WithActor(ctx, operator)), true},
+		{"admin on themselves", reqctx.WithAdmin(reqctx.WithActor(ctx, user)), false},
+		{"admin without an actor", reqctx.WithAdmin(ctx), false},
+		{"non-admin on another user", reqctx.WithActor(ctx, operator), false},
+		{"self service", reqctx.WithActor(ctx, user), false},
+		{"no caller", ctx, false},
+	}
+	for _, tt := range tests {
+		actor, ok := adminActor(tt.ctx, user)
+		if ok != tt.want || ok && actor != operator || !ok && actor != "" {
+			t.Errorf("%s: got %q, %v, want %v", tt.name, actor, ok, tt.want)
+		}
+	}
+}
+
+func TestAdminActionsRecordOnlyAdminChanges(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+	member := createFundedUser(t, repo, 100)
+	operator := createFundedUser(t, repo, 0)
+
+	admin := reqctx.WithAdmin(reqctx.WithActor(ctx, operator.ID))
+	callers := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"admin on themselves", reqctx.WithAdmin(reqctx.WithActor(ctx, member.ID))},
+		{"admin without an actor", reqctx.WithAdmin(ctx)},
+		{"non-admin on another user", reqctx.WithActor(ctx, operator.ID)},
+		{"self service", reqctx.WithActor(ctx, member.ID)},
+	}
+	for _, caller := range callers {
+		if _, _, err := repo.AddCoinsAtomic(caller.ctx, member.ID, 1, domain.CoinReasonPurchase, ""); err != nil {
+			t.Fatalf("%s: AddCoinsAtomic: %v", caller.name, err)
+		}
+		name := "Renamed by " + caller.name
+		if err := repo.Update(caller.ctx, member.ID, &domain.UpdateUserFields{Name: &name}); err != nil {
+			t.Fatalf("%s: Update: %v", caller.name, err)
+		}
+	}
+	if _, total, err := repo.ListAdminActions(ctx, member.ID, 10, 0); err != nil || total != 0 {
+		t.Fatalf("non-admin changes recorded %d admin actions, %v", total, err)
+	}
+
+	// The same changes by an admin on someone else are recorded, newest first
+	if _, _, err := repo.AddCoinsAtomic(admin, member.ID, 5, domain.CoinReasonPurchase, ""); err != nil {
+		t.Fatalf("AddCoinsAtomic: %v", err)
+	}
+	name := "Renamed by support"
+	if err := repo.Update(admin, member.ID, &domain.UpdateUserFields{Name: &name}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	// A change that fails records nothing, as the action shares its transaction
+	if _, _, err := repo.DeductCoinsAtomic(admin, member.ID, 1_000_000, domain.CoinReasonSpend, ""); !errors.Is(err, domain.ErrInsufficientCoinsBalance) {
+		t.Fatalf("DeductCoinsAtomic: got %v, want ErrInsufficientCoinsBalance", err)
+	}
+
+	actions, total, err := repo.ListAdminActions(ctx, member.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("ListAdminActions: %v", err)
+	}
+	wantActions := []string{domain.AdminActionUserUpdated, domain.AdminActionCoinsAdded}
+	if total != 2 || len(actions) != 2 {
+		t.Fatalf("got %d of %d actions %+v, want %v", len(actions), total, actions, wantActions)
+	}
+	for i, a := range actions {
+		if a.Action != wantActions[i] || a.Actor != operator.ID || a.UserID != member.ID {
+			t.Errorf("action %d: %+v, want %s by %s", i, a, wantActions[i], operator.ID)
+		}
+	}
+	var details map[string]any
+	if err := json.Unmarshal(actions[0].Details, &details); err != nil || details["name"] != name {
+		t.Errorf("update details %s, want the new name", actions[0].Details)
+	}
+
+	// Pages and other users' lists
+	if page, total, err := repo.ListAdminActions(ctx, member.ID, 1, 1); err != nil || total != 2 || len(page) != 1 || page[0].ID != actions[1].ID {
+		t.Errorf("second page: got %+v of %d, %v, want the coin addition", page, total, err)
+	}
+	if page, total, err := repo.ListAdminActions(ctx, operator.ID, 10, 0); err != nil || total != 0 || len(page) != 0 {
+		t.Errorf("operator's own list: got %+v of %d, %v, want none", page, total, err)
+	}
+}
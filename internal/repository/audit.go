@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/timing"
+)
+
+type postgresAuditRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresAuditRepository(db *sql.DB) *postgresAuditRepository {
+	return &postgresAuditRepository{db: db}
+}
+
+// SaveEvent stores a published audit event so it can be replayed later.
+// Saving an ID that is already stored is a no-op.
+func (r *postgresAuditRepository) SaveEvent(ctx context.Context, event domain.AuditEvent) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_audit_save_event", time.Now())
+
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return wrapErr("marshal audit payload", err)
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+		INSERT INTO audit_events (id, service, event_type, entity_id, actor, occurred_at, payload)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7)
+		ON CONFLICT (id) DO NOTHING`,
+		event.ID, event.Service, event.EventType, event.EntityID, event.Actor, event.OccurredAt, payload,
+	)
+	if err != nil {
+		return wrapErr("save audit event", err)
+	}
+	return nil
+}
+
+// ListEvents returns up to limit stored events that occurred in [from, to),
+// optionally only of eventType, ordered by occurred_at and ID and starting
+// after the (afterOccurredAt, afterID) cursor. A zero afterOccurredAt starts
+// from the beginning.
+func (r *postgresAuditRepository) ListEvents(ctx context.Context, from, to time.Time, eventType string, afterOccurredAt time.Time, afterID string, limit int) ([]domain.AuditEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_audit_list_events", time.Now())
+
+	if afterOccurredAt.IsZero() {
+		afterOccurredAt = from
+		afterID = "00000000-0000-0000-0000-000000000000"
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, service, event_type, entity_id, COALESCE(actor, ''), occurred_at, payload
+		FROM audit_events
+		WHERE occurred_at >= $1 AND occurred_at < $2
+		  AND ($3 = '' OR event_type = $3)
+		  AND (occurred_at, id) > ($4, $5::uuid)
+		ORDER BY occurred_at, id
+		LIMIT $6`,
+		from, to, eventType, afterOccurredAt, afterID, limit,
+	)
+	if err != nil {
+		return nil, wrapErr("list audit events", err)
+	}
+	defer rows.Close()
+
+	var events []domain.AuditEvent
+	for rows.Next() {
+		var event domain.AuditEvent
+		var payload []byte
+		if err := rows.Scan(&event.ID, &event.Service, &event.EventType, &event.EntityID, &event.Actor, &event.OccurredAt, &payload); err != nil {
+			return nil, wrapErr("scan audit event", err)
+		}
+		if len(payload) > 0 {
+			if err := json.Unmarshal(payload, &event.Payload); err != nil {
+				return nil, wrapErr("unmarshal audit payload", err)
+			}
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("iterate audit events", err)
+	}
+
+	return events, nil
+}
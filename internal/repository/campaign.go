@@ -0,0 +1,365 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/timing"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+type postgresCampaignRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresCampaignRepository(db *sql.DB) *postgresCampaignRepository {
+	return &postgresCampaignRepository{db: db}
+}
+
+// campaignFilterClause builds the WHERE conditions for a campaign cohort.
+// Placeholders start at argPos; the returned clause always starts with "1=1".
+func campaignFilterClause(filter domain.CoinCampaignFilter, argPos int) (string, []interface{}) {
+	var clause strings.Builder
+	args := []interface{}{}
+
+	clause.WriteString("1=1")
+	// Soft-deleted users are never granted coins
+	clause.WriteString(notDeleted)
+	if filter.Status != nil {
+		clause.WriteString(fmt.Sprintf(" AND status = $%d", argPos))
+		args = append(args, *filter.Status)
+		argPos++
+	}
+	if filter.IsTrial != nil {
+		clause.WriteString(fmt.Sprintf(" AND is_trial = $%d", argPos))
+		args = append(args, *filter.IsTrial)
+		argPos++
+	}
+	if filter.CreatedBefore != nil {
+		clause.WriteString(fmt.Sprintf(" AND created_at < $%d", argPos))
+		args = append(args, *filter.CreatedBefore)
+		argPos++
+	}
+	if filter.CreatedAfter != nil {
+		clause.WriteString(fmt.Sprintf(" AND created_at > $%d", argPos))
+		args = append(args, *filter.CreatedAfter)
+		argPos++
+	}
+
+	return clause.String(), args
+}
+
+func (r *postgresCampaignRepository) CountMatchingUsers(ctx context.Context, filter domain.CoinCampaignFilter) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_campaign_count_matching_users", time.Now())
+
+	where, args := campaignFilterClause(filter, 1)
+	query := "SELECT COUNT(*) FROM users WHERE " + where
+
+	var total int64
+	if err := r.db.QueryRowContext(ctx, query, args...).Scan(&total); err != nil {
+		log.WithError(err).Error("Failed to count campaign cohort")
+		return 0, wrapErr("count campaign cohort", err)
+	}
+
+	return total, nil
+}
+
+func (r *postgresCampaignRepository) Create(ctx context.Context, campaign *domain.CoinCampaign) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_campaign_create", time.Now())
+
+	filter, err := json.Marshal(campaign.Filter)
+	if err != nil {
+		return wrapErr("marshal campaign filter", err)
+	}
+
+	query := `INSERT INTO coin_campaigns (id, filter, amount, reason, status, total)
+	          VALUES ($1, $2, $3, $4, $5, $6)
+	          RETURNING created_at, updated_at`
+
+	err = r.db.QueryRowContext(ctx, query,
+		campaign.ID,
+		filter,
+		campaign.Amount,
+		campaign.Reason,
+		campaign.Status,
+		campaign.Total,
+	).Scan(&campaign.CreatedAt, &campaign.UpdatedAt)
+	if err != nil {
+		log.WithError(err).WithField("campaign_id", campaign.ID).Error("Failed to create campaign")
+		return wrapErr("create campaign", err)
+	}
+
+	return nil
+}
+
+const campaignColumns = `id, filter, amount, reason, status, total, processed, failed, last_user_id, created_at, updated_at, completed_at`
+
+func scanCampaign(row interface{ Scan(...interface{}) error }) (*domain.CoinCampaign, error) {
+	var campaign domain.CoinCampaign
+	var filter []byte
+	var lastUserID sql.NullString
+	var completedAt sql.NullTime
+
+	err := row.Scan(
+		&campaign.ID,
+		&filter,
+		&campaign.Amount,
+		&campaign.Reason,
+		&campaign.Status,
+		&campaign.Total,
+		&campaign.Processed,
+		&campaign.Failed,
+		&lastUserID,
+		&campaign.CreatedAt,
+		&campaign.UpdatedAt,
+		&completedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(filter, &campaign.Filter); err != nil {
+		return nil, wrapErr("unmarshal campaign filter", err)
+	}
+	if lastUserID.Valid {
+		campaign.LastUserID = &lastUserID.String
+	}
+	if completedAt.Valid {
+		campaign.CompletedAt = &completedAt.Time
+	}
+
+	return &campaign, nil
+}
+
+func (r *postgresCampaignRepository) GetByID(ctx context.Context, id string) (*domain.CoinCampaign, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_campaign_get_by_id", time.Now())
+
+	query := `SELECT ` + campaignColumns + ` FROM coin_campaigns WHERE id = $1`
+
+	campaign, err := scanCampaign(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrCampaignNotFound
+	}
+	if err != nil {
+		log.WithError(err).WithField("campaign_id", id).Error("Failed to get campaign by ID")
+		return nil, wrapErr("get campaign by id", err)
+	}
+
+	return campaign, nil
+}
+
+func (r *postgresCampaignRepository) ListByStatus(ctx context.Context, status string) ([]domain.CoinCampaign, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_campaign_list_by_status", time.Now())
+
+	query := `SELECT ` + campaignColumns + ` FROM coin_campaigns WHERE status = $1 ORDER BY created_at ASC, id ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, status)
+	if err != nil {
+		return nil, wrapErr("list campaigns by status", err)
+	}
+	defer rows.Close()
+
+	var campaigns []domain.CoinCampaign
+	for rows.Next() {
+		campaign, err := scanCampaign(rows)
+		if err != nil {
+			return nil, wrapErr("scan campaign row", err)
+		}
+		campaigns = append(campaigns, *campaign)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("iterate campaign rows", err)
+	}
+
+	return campaigns, nil
+}
+
+// NextBatch returns up to limit IDs of users matching the campaign filter,
+// ordered by ID and strictly after the campaign cursor.
+func (r *postgresCampaignRepository) NextBatch(ctx context.Context, campaign *domain.CoinCampaign, limit int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_campaign_next_batch", time.Now())
+
+	where, args := campaignFilterClause(campaign.Filter, 1)
+	argPos := len(args) + 1
+
+	var query strings.Builder
+	query.WriteString("SELECT id FROM users WHERE " + where)
+	if campaign.LastUserID != nil {
+		query.WriteString(fmt.Sprintf(" AND id > $%d", argPos))
+		args = append(args, *campaign.LastUserID)
+		argPos++
+	}
+	query.WriteString(fmt.Sprintf(" ORDER BY id ASC LIMIT $%d", argPos))
+	args = append(args, limit)
+
+	rows, err := r.db.QueryContext(ctx, query.String(), args...)
+	if err != nil {
+		return nil, wrapErr("select campaign batch", err)
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, wrapErr("scan campaign batch row", err)
+		}
+		userIDs = append(userIDs, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("iterate campaign batch rows", err)
+	}
+
+	return userIDs, nil
+}
+
+// GrantBatch credits the campaign amount to userIDs and advances the campaign
+// cursor to the last ID in a single transaction. Users that already received a
+// grant from this campaign are skipped, so replaying a batch after a crash is safe.
+// It returns the IDs that were actually credited.
+func (r *postgresCampaignRepository) GrantBatch(ctx context.Context, campaign *domain.CoinCampaign, userIDs []string) ([]string, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_campaign_grant_batch", time.Now())
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, wrapErr("begin campaign batch", err)
+	}
+	defer tx.Rollback()
+
+	// Locking the users keeps them from being deleted before they are
+	// credited below
+	rows, err := tx.QueryContext(ctx, `
+		INSERT INTO coin_campaign_grants (campaign_id, user_id, amount)
+		SELECT $1::uuid, u.id, $3::bigint FROM users u
+		WHERE u.id = ANY($2::uuid[]) AND u.deleted_at IS NULL
+		FOR UPDATE
+		ON CONFLICT (campaign_id, user_id) DO NOTHING
+		RETURNING user_id
+	`, campaign.ID, pq.Array(userIDs), campaign.Amount)
+	if err != nil {
+		return nil, wrapErr("insert campaign grants", err)
+	}
+
+	var granted []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, wrapErr("scan campaign grant", err)
+		}
+		granted = append(granted, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("iterate campaign grants", err)
+	}
+
+	if len(granted) > 0 {
+		_, err = tx.ExecContext(ctx, `
+			WITH credited AS (
+				UPDATE users SET
+					coins_balance = coins_balance + $1,
+					updated_at = NOW()
+				WHERE id = ANY($2::uuid[])`+notDeleted+`
+				RETURNING id, coins_balance
+			)
+			INSERT INTO coin_transactions (user_id, amount, direction, reason, balance_after, campaign_id)
+			SELECT id, $1, $3, $4, coins_balance, $5 FROM credited
+		`, campaign.Amount, pq.Array(granted), domain.CoinDirectionCredit, domain.CoinReasonCampaignGrant, campaign.ID)
+		if err != nil {
+			return nil, wrapErr("credit campaign grants", err)
+		}
+	}
+
+	lastUserID := userIDs[len(userIDs)-1]
+	_, err = tx.ExecContext(ctx, `
+		UPDATE coin_campaigns SET
+			processed = processed + $1,
+			last_user_id = $2,
+			updated_at = NOW()
+		WHERE id = $3
+	`, len(userIDs), lastUserID, campaign.ID)
+	if err != nil {
+		return nil, wrapErr("advance campaign cursor", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, wrapErr("commit campaign batch", err)
+	}
+
+	campaign.Processed += int64(len(userIDs))
+	campaign.LastUserID = &lastUserID
+
+	return granted, nil
+}
+
+// SkipBatch records userIDs as failed and advances the cursor past them.
+func (r *postgresCampaignRepository) SkipBatch(ctx context.Context, campaign *domain.CoinCampaign, userIDs []string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_campaign_skip_batch", time.Now())
+
+	lastUserID := userIDs[len(userIDs)-1]
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE coin_campaigns SET
+			processed = processed + $1,
+			failed = failed + $1,
+			last_user_id = $2,
+			updated_at = NOW()
+		WHERE id = $3
+	`, len(userIDs), lastUserID, campaign.ID)
+	if err != nil {
+		return wrapErr("skip campaign batch", err)
+	}
+
+	campaign.Processed += int64(len(userIDs))
+	campaign.Failed += int64(len(userIDs))
+	campaign.LastUserID = &lastUserID
+
+	return nil
+}
+
+func (r *postgresCampaignRepository) MarkCompleted(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_campaign_mark_completed", time.Now())
+
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE coin_campaigns SET
+			status = $1,
+			completed_at = NOW(),
+			updated_at = NOW()
+		WHERE id = $2
+	`, domain.CampaignStatusCompleted, id)
+	if err != nil {
+		return wrapErr("complete campaign", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"user-service/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+func TestGrantBatchSkipsDeletedUsers(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	users := NewPostgresUserRepository(db)
+	campaigns := NewPostgresCampaignRepository(db)
+
+	kept := createFundedUser(t, users, 0)
+	deleted := createFundedUser(t, users, 0)
+	if err := users.Delete(ctx, deleted.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	campaign := &domain.CoinCampaign{
+		ID:     uuid.NewString(),
+		Amount: 25,
+		Reason: "spring promo",
+		Status: domain.CampaignStatusRunning,
+		Total:  2,
+	}
+	if err := campaigns.Create(ctx, campaign); err != nil {
+		t.Fatalf("Create campaign: %v", err)
+	}
+
+	granted, err := campaigns.GrantBatch(ctx, campaign, []string{kept.ID, deleted.ID})
+	if err != nil {
+		t.Fatalf("GrantBatch: %v", err)
+	}
+	if len(granted) != 1 || granted[0] != kept.ID {
+		t.Fatalf("granted %v, want only [%s]", granted, kept.ID)
+	}
+
+	got, err := users.GetByID(ctx, deleted.ID, true)
+	if err != nil {
+		t.Fatalf("GetByID including deleted: %v", err)
+	}
+	if got.CoinsBalance != 0 {
+		t.Errorf("deleted user balance %d, want 0", got.CoinsBalance)
+	}
+	var grants int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM coin_campaign_grants WHERE user_id = $1`, deleted.ID).Scan(&grants); err != nil {
+		t.Fatalf("count grants: %v", err)
+	}
+	if grants != 0 {
+		t.Errorf("deleted user has %d grants, want 0", grants)
+	}
+}
+
+func TestGrantBatchLedgerNamesCampaign(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	users := NewPostgresUserRepository(db)
+	campaigns := NewPostgresCampaignRepository(db)
+
+	user := createFundedUser(t, users, 10)
+	campaign := &domain.CoinCampaign{
+		ID:     uuid.NewString(),
+		Amount: 25,
+		Reason: "spring promo",
+		Status: domain.CampaignStatusRunning,
+		Total:  1,
+	}
+	if err := campaigns.Create(ctx, campaign); err != nil {
+		t.Fatalf("Create campaign: %v", err)
+	}
+	if _, err := campaigns.GrantBatch(ctx, campaign, []string{user.ID}); err != nil {
+		t.Fatalf("GrantBatch: %v", err)
+	}
+
+	ledger, _, err := users.ListCoinTransactions(ctx, user.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("ListCoinTransactions: %v", err)
+	}
+	if len(ledger) != 2 {
+		t.Fatalf("%d ledger entries, want the funding and the grant", len(ledger))
+	}
+	grant, funding := ledger[0], ledger[1]
+	if grant.Reason != domain.CoinReasonCampaignGrant || grant.CampaignID == nil || *grant.CampaignID != campaign.ID {
+		t.Errorf("grant entry has reason %s and campaign %v, want %s", grant.Reason, grant.CampaignID, campaign.ID)
+	}
+	if grant.Amount != 25 || grant.BalanceAfter != 35 {
+		t.Errorf("grant entry of %d leaving %d, want 25 leaving 35", grant.Amount, grant.BalanceAfter)
+	}
+	if funding.CampaignID != nil {
+		t.Errorf("funding entry names campaign %s", *funding.CampaignID)
+	}
+}
@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/timing"
+)
+
+// recordCoinTransaction appends a ledger entry in category, if any, inside
+// tx, the transaction that changed the balance.
+func recordCoinTransaction(ctx context.Context, tx *sql.Tx, userID string, amount int64, direction, reason, category string, balanceAfter int64) error {
+	_, err := recordOrderCoinTransaction(ctx, tx, userID, amount, direction, reason, balanceAfter, ledgerRef{Category: category})
+	return err
+}
+
+// ledgerRef ties a ledger entry to the order it paid for or refunded. A
+// refund entry also names its refund and the checkout entry it reverses.
+// Category is the entry's ledger category; empty leaves it uncategorized.
+type ledgerRef struct {
+	OrderID    string
+	RefundID   string
+	ReversesID int64
+	Category   string
+}
+
+// recordOrderCoinTransaction appends a ledger entry carrying ref inside tx
+// and returns its ID.
+func recordOrderCoinTransaction(ctx context.Context, tx *sql.Tx, userID string, amount int64, direction, reason string, balanceAfter int64, ref ledgerRef) (int64, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO coin_transactions (user_id, amount, direction, reason, balance_after, order_id, refund_id, reverses_id, category)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::uuid, NULLIF($7, '')::uuid, NULLIF($8, 0), NULLIF($9, ''))
+		RETURNING id`,
+		userID, amount, direction, reason, balanceAfter, ref.OrderID, ref.RefundID, ref.ReversesID, ref.Category,
+	).Scan(&id)
+	if err != nil {
+		return 0, wrapErr("record coin transaction", err)
+	}
+	return id, nil
+}
+
+// ListCoinTransactions returns a page of the user's ledger, newest first, and
+// the number of entries in total.
+func (r *postgresUserRepository) ListCoinTransactions(ctx context.Context, userID string, limit, offset int) ([]domain.CoinTransaction, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_list_coin_transactions", time.Now())
+
+	var total int64
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM coin_transactions WHERE user_id = $1`, userID).Scan(&total); err != nil {
+		return nil, 0, wrapErr("count coin transactions", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, amount, direction, reason, COALESCE(category, $4), balance_after, order_id, refund_id, reverses_id, campaign_id, created_at
+		FROM coin_transactions
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3`, userID, limit, offset, domain.CoinCategoryOther)
+	if err != nil {
+		return nil, 0, wrapErr("list coin transactions", err)
+	}
+	defer rows.Close()
+
+	transactions := []domain.CoinTransaction{}
+	for rows.Next() {
+		var t domain.CoinTransaction
+		var orderID, refundID, campaignID sql.NullString
+		var reversesID sql.NullInt64
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Amount, &t.Direction, &t.Reason, &t.Category, &t.BalanceAfter, &orderID, &refundID, &reversesID, &campaignID, &t.CreatedAt); err != nil {
+			return nil, 0, wrapErr("scan coin transaction", err)
+		}
+		if orderID.Valid {
+			t.OrderID = &orderID.String
+		}
+		if refundID.Valid {
+			t.RefundID = &refundID.String
+		}
+		if reversesID.Valid {
+			t.ReversesID = &reversesID.Int64
+		}
+		if campaignID.Valid {
+			t.CampaignID = &campaignID.String
+		}
+		t.Delta = t.Amount
+		if t.Direction == domain.CoinDirectionDebit {
+			t.Delta = -t.Amount
+		}
+		transactions = append(transactions, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, wrapErr("iterate coin transactions", err)
+	}
+
+	return transactions, total, nil
+}
+
+// VerifyCoinTransactions checks the page of the user's ledger that
+// ListCoinTransactions returns for the same limit and offset, comparing each
+// entry's balance_after with the entry before it, which may sit on an
+// earlier page. The user's first entry has nothing to follow and is never
+// reported, so balances held before the ledger existed don't show up as
+// discrepancies.
+func (r *postgresUserRepository) VerifyCoinTransactions(ctx context.Context, userID string, limit, offset int) ([]domain.CoinLedgerDiscrepancy, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_verify_coin_transactions", time.Now())
+
+	rows, err := r.db.QueryContext(ctx, `
+		WITH ledger AS (
+			SELECT id, created_at, balance_after,
+			       CASE WHEN direction = $4 THEN -amount ELSE amount END AS delta,
+			       LAG(id) OVER w AS previous_id,
+			       LAG(balance_after) OVER w AS previous_balance
+			FROM coin_transactions
+			WHERE user_id = $1
+			WINDOW w AS (ORDER BY created_at, id)
+		), page AS (
+			SELECT * FROM ledger
+			ORDER BY created_at DESC, id DESC
+			LIMIT $2 OFFSET $3
+		)
+		SELECT id, previous_id, previous_balance + delta, balance_after
+		FROM page
+		WHERE previous_id IS NOT NULL AND balance_after <> previous_balance + delta
+		ORDER BY created_at DESC, id DESC`,
+		userID, limit, offset, domain.CoinDirectionDebit)
+	if err != nil {
+		return nil, wrapErr("verify coin transactions", err)
+	}
+	defer rows.Close()
+
+	discrepancies := []domain.CoinLedgerDiscrepancy{}
+	for rows.Next() {
+		var d domain.CoinLedgerDiscrepancy
+		if err := rows.Scan(&d.TransactionID, &d.PreviousID, &d.Expected, &d.BalanceAfter); err != nil {
+			return nil, wrapErr("scan coin ledger discrepancy", err)
+		}
+		d.Gap = d.BalanceAfter - d.Expected
+		discrepancies = append(discrepancies, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("iterate coin ledger discrepancies", err)
+	}
+	return discrepancies, nil
+}
+
+// PruneCoinLedger folds the ledger entries created before cutoff of up to
+// limit users, in ID order after afterID, into one opening balance entry per
+// user. The entry credits the balance_after of the last entry it replaces and
+// takes its created_at, so the retained ledger still starts from zero, its
+// deltas still add up to the balance and every balance_after still follows
+// from the entry before it. Users whose only old entry is an earlier opening
+// balance are skipped. It returns the last user ID folded, how many users
+// were and how many entries were deleted; a lastID of "" means no users were
+// left.
+func (r *postgresUserRepository) PruneCoinLedger(ctx context.Context, afterID string, cutoff time.Time, limit int) (string, int, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_prune_coin_ledger", time.Now())
+
+	if afterID == "" {
+		afterID = "00000000-0000-0000-0000-000000000000"
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", 0, 0, wrapErr("begin coin ledger pruning", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT DISTINCT user_id FROM coin_transactions
+		WHERE user_id > $1
+		  AND created_at < $2
+		  AND reason <> $3
+		ORDER BY user_id
+		LIMIT $4`, afterID, cutoff, domain.CoinReasonOpeningBalance, limit)
+	if err != nil {
+		return "", 0, 0, wrapErr("find prunable coin ledgers", err)
+	}
+	var userIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return "", 0, 0, wrapErr("scan prunable coin ledger", err)
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", 0, 0, wrapErr("iterate prunable coin ledgers", err)
+	}
+	if len(userIDs) == 0 {
+		return "", 0, 0, nil
+	}
+
+	var pruned int64
+	for _, userID := range userIDs {
+		var deleted int64
+		err := tx.QueryRowContext(ctx, `
+			WITH pruned AS (
+				DELETE FROM coin_transactions
+				WHERE user_id = $1 AND created_at < $2
+				RETURNING id, balance_after, created_at
+			), last AS (
+				SELECT balance_after, created_at FROM pruned
+				ORDER BY created_at DESC, id DESC
+				LIMIT 1
+			), opening AS (
+				INSERT INTO coin_transactions (user_id, amount, direction, reason, balance_after, created_at)
+				SELECT $1, balance_after, $3, $4, balance_after, created_at FROM last
+			)
+			SELECT COUNT(*) FROM pruned`,
+			userID, cutoff, domain.CoinDirectionCredit, domain.CoinReasonOpeningBalance,
+		).Scan(&deleted)
+		if err != nil {
+			return "", 0, 0, wrapErr("prune coin ledger", err)
+		}
+		pruned += deleted
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", 0, 0, wrapErr("commit coin ledger pruning", err)
+	}
+
+	return userIDs[len(userIDs)-1], len(userIDs), pruned, nil
+}
@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+	"user-service/internal/domain"
+)
+
+// ledgerRetention is the retention the pruning tests run with; entries are
+// aged past it by backdateLedger.
+const ledgerRetention = 365 * 24 * time.Hour
+
+// backdateLedger moves the user's first n ledger entries back past
+// ledgerRetention, keeping their order.
+func backdateLedger(t *testing.T, db *sql.DB, userID string, n int) {
+	t.Helper()
+	_, err := db.Exec(`
+		UPDATE coin_transactions SET created_at = created_at - INTERVAL '400 days'
+		WHERE id IN (SELECT id FROM coin_transactions WHERE user_id = $1 ORDER BY id LIMIT $2)`,
+		userID, n)
+	if err != nil {
+		t.Fatalf("backdate ledger: %v", err)
+	}
+}
+
+// assertLedgerReconciles checks the user's ledger the way reconciliation
+// reads it: every balance_after follows from the entry before it, and the
+// deltas add up to the stored balance.
+func assertLedgerReconciles(t *testing.T, repo *postgresUserRepository, userID string) []domain.CoinTransaction {
+	t.Helper()
+	ctx := context.Background()
+	user, err := repo.GetByID(ctx, userID, false)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	entries, _, err := repo.ListCoinTransactions(ctx, userID, 100, 0)
+	if err != nil {
+		t.Fatalf("ListCoinTransactions: %v", err)
+	}
+
+	var sum int64
+	for i := len(entries) - 1; i >= 0; i-- {
+		sum += entries[i].Delta
+		if entries[i].BalanceAfter != sum {
+			t.Errorf("entry %d (%s): balance_after %d, want %d", entries[i].ID, entries[i].Reason, entries[i].BalanceAfter, sum)
+		}
+	}
+	if sum != user.CoinsBalance {
+		t.Errorf("ledger adds up to %d, balance is %d", sum, user.CoinsBalance)
+	}
+	return entries
+}
+
+func TestPruneCoinLedgerKeepsAggregatesAndReconciliation(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	users := NewPostgresUserRepository(db)
+	reports := NewPostgresReportRepository(db)
+
+	// 100 in, 30 out, 50 in, all aged past retention, then 10 out recently
+	user := createFundedUser(t, users, 100)
+	if _, _, err := users.DeductCoinsAtomic(ctx, user.ID, 30, domain.CoinReasonSpend, ""); err != nil {
+		t.Fatalf("DeductCoinsAtomic: %v", err)
+	}
+	if _, _, err := users.AddCoinsAtomic(ctx, user.ID, 50, domain.CoinReasonPurchase, ""); err != nil {
+		t.Fatalf("AddCoinsAtomic: %v", err)
+	}
+	backdateLedger(t, db, user.ID, 3)
+	if _, _, err := users.DeductCoinsAtomic(ctx, user.ID, 10, domain.CoinReasonSpend, ""); err != nil {
+		t.Fatalf("DeductCoinsAtomic: %v", err)
+	}
+	// A user with nothing old is left alone
+	recent := createFundedUser(t, users, 40)
+
+	totalsBefore, err := reports.CoinTotals(ctx)
+	if err != nil {
+		t.Fatalf("CoinTotals: %v", err)
+	}
+	burnBefore, err := reports.BurnRate(ctx, user.ID, domain.MaxBurnRateWindowDays)
+	if err != nil {
+		t.Fatalf("BurnRate: %v", err)
+	}
+
+	lastID, folded, pruned, err := users.PruneCoinLedger(ctx, "", time.Now().Add(-ledgerRetention), 10)
+	if err != nil {
+		t.Fatalf("PruneCoinLedger: %v", err)
+	}
+	if lastID != user.ID || folded != 1 || pruned != 3 {
+		t.Fatalf("pruned %d entries of %d users up to %s, want 3 of 1 up to %s", pruned, folded, lastID, user.ID)
+	}
+
+	entries := assertLedgerReconciles(t, users, user.ID)
+	if len(entries) != 2 {
+		t.Fatalf("%d entries left, want the opening balance and the recent deduction", len(entries))
+	}
+	opening := entries[1]
+	if opening.Reason != domain.CoinReasonOpeningBalance || opening.Delta != 120 || opening.BalanceAfter != 120 {
+		t.Errorf("opening entry %+v, want a credit of 120 ending at 120", opening)
+	}
+	if entries[0].Reason != domain.CoinReasonSpend || entries[0].BalanceAfter != 110 {
+		t.Errorf("recent entry %+v, want the deduction ending at 110", entries[0])
+	}
+	if kept := assertLedgerReconciles(t, users, recent.ID); len(kept) != 1 {
+		t.Errorf("%d entries left for the recent user, want 1", len(kept))
+	}
+
+	totalsAfter, err := reports.CoinTotals(ctx)
+	if err != nil {
+		t.Fatalf("CoinTotals: %v", err)
+	}
+	if totalsAfter.Held != totalsBefore.Held || totalsAfter.Purchased != totalsBefore.Purchased || totalsAfter.Spent != totalsBefore.Spent {
+		t.Errorf("totals %+v after pruning, want %+v", totalsAfter, totalsBefore)
+	}
+	burnAfter, err := reports.BurnRate(ctx, user.ID, domain.MaxBurnRateWindowDays)
+	if err != nil {
+		t.Fatalf("BurnRate: %v", err)
+	}
+	if burnAfter.Spent != burnBefore.Spent || burnAfter.Spent != 10 {
+		t.Errorf("burn rate spent %d after pruning, %d before, want 10", burnAfter.Spent, burnBefore.Spent)
+	}
+
+	// The opening balance is old too, but folding it again would change nothing
+	lastID, folded, pruned, err = users.PruneCoinLedger(ctx, "", time.Now().Add(-ledgerRetention), 10)
+	if err != nil {
+		t.Fatalf("second PruneCoinLedger: %v", err)
+	}
+	if lastID != "" || folded != 0 || pruned != 0 {
+		t.Errorf("second run pruned %d entries of %d users, want none", pruned, folded)
+	}
+}
+
+func TestPruneCoinLedgerFoldsIntoEarlierOpeningBalance(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	users := NewPostgresUserRepository(db)
+
+	user := createFundedUser(t, users, 100)
+	backdateLedger(t, db, user.ID, 1)
+	if _, _, _, err := users.PruneCoinLedger(ctx, "", time.Now().Add(-ledgerRetention), 10); err != nil {
+		t.Fatalf("PruneCoinLedger: %v", err)
+	}
+
+	// Entries that age out later are folded together with the opening balance
+	if _, _, err := users.DeductCoinsAtomic(ctx, user.ID, 25, domain.CoinReasonSpend, ""); err != nil {
+		t.Fatalf("DeductCoinsAtomic: %v", err)
+	}
+	if _, err := db.Exec(`UPDATE coin_transactions SET created_at = NOW() - INTERVAL '390 days' WHERE user_id = $1 AND reason = $2`, user.ID, domain.CoinReasonSpend); err != nil {
+		t.Fatalf("backdate deduction: %v", err)
+	}
+	if _, _, pruned, err := users.PruneCoinLedger(ctx, "", time.Now().Add(-ledgerRetention), 10); err != nil || pruned != 2 {
+		t.Fatalf("PruneCoinLedger: pruned %d, %v; want the opening balance and the deduction", pruned, err)
+	}
+
+	entries := assertLedgerReconciles(t, users, user.ID)
+	if len(entries) != 1 || entries[0].Reason != domain.CoinReasonOpeningBalance || entries[0].BalanceAfter != 75 {
+		t.Fatalf("entries %+v, want one opening balance of 75", entries)
+	}
+}
+
+func TestVerifyCoinTransactionsFindsCorruptedEntries(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	users := NewPostgresUserRepository(db)
+
+	// 100, 70, 120, 110 in a consistent ledger
+	user := createFundedUser(t, users, 100)
+	if _, _, err := users.DeductCoinsAtomic(ctx, user.ID, 30, domain.CoinReasonSpend, ""); err != nil {
+		t.Fatalf("DeductCoinsAtomic: %v", err)
+	}
+	if _, _, err := users.AddCoinsAtomic(ctx, user.ID, 50, domain.CoinReasonPurchase, ""); err != nil {
+		t.Fatalf("AddCoinsAtomic: %v", err)
+	}
+	if _, _, err := users.DeductCoinsAtomic(ctx, user.ID, 10, domain.CoinReasonSpend, ""); err != nil {
+		t.Fatalf("DeductCoinsAtomic: %v", err)
+	}
+	clean, err := users.VerifyCoinTransactions(ctx, user.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("VerifyCoinTransactions: %v", err)
+	}
+	if len(clean) != 0 {
+		t.Fatalf("consistent ledger reported %+v", clean)
+	}
+
+	// Drop the credit of 50 as if the purchase had skipped its ledger write
+	// while the balance still moved: the deduction after it now jumps by 50.
+	entries, _, err := users.ListCoinTransactions(ctx, user.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("ListCoinTransactions: %v", err)
+	}
+	if _, err := db.Exec(`DELETE FROM coin_transactions WHERE id = $1`, entries[1].ID); err != nil {
+		t.Fatalf("corrupt ledger: %v", err)
+	}
+
+	discrepancies, err := users.VerifyCoinTransactions(ctx, user.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("VerifyCoinTransactions: %v", err)
+	}
+	want := domain.CoinLedgerDiscrepancy{
+		TransactionID: entries[0].ID,
+		PreviousID:    entries[2].ID,
+		Expected:      60,
+		BalanceAfter:  110,
+		Gap:           50,
+	}
+	if len(discrepancies) != 1 || discrepancies[0] != want {
+		t.Fatalf("discrepancies %+v, want %+v", discrepancies, want)
+	}
+
+	// The previous entry of a page's last row is read from the page after it
+	if paged, err := users.VerifyCoinTransactions(ctx, user.ID, 1, 0); err != nil || len(paged) != 1 || paged[0] != want {
+		t.Errorf("first page: %+v, %v; want %+v", paged, err, want)
+	}
+	if paged, err := users.VerifyCoinTransactions(ctx, user.ID, 1, 1); err != nil || len(paged) != 0 {
+		t.Errorf("second page: %+v, %v; want no discrepancies", paged, err)
+	}
+}
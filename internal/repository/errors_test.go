@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"user-service/internal/domain"
+	"user-service/internal/testutil/factory"
+
+	"github.com/lib/pq"
+)
+
+// failingConnector opens connections on which every statement fails with
+// err, as a database rejecting the write would.
+type failingConnector struct{ err error }
+
+func (c failingConnector) Connect(context.Context) (driver.Conn, error) { return failingConn(c), nil }
+func (c failingConnector) Driver() driver.Driver                        { return nil }
+
+type failingConn struct{ err error }
+
+func (c failingConn) Prepare(string) (driver.Stmt, error) { return nil, c.err }
+func (c failingConn) Close() error                        { return nil }
+func (c failingConn) Begin() (driver.Tx, error)           { return failingTx{}, nil }
+
+func (c failingConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return nil, c.err
+}
+
+func (c failingConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return nil, c.err
+}
+
+type failingTx struct{}
+
+func (failingTx) Commit() error   { return nil }
+func (failingTx) Rollback() error { return nil }
+
+func TestEmailUniqueViolationMapsToErrEmailAlreadyExists(t *testing.T) {
+	ctx := context.Background()
+	duplicate := &pq.Error{
+		Code:       "23505",
+		Message:    `duplicate key value violates unique constraint "users_email_hash_key"`,
+		Constraint: "users_email_hash_key",
+	}
+	other := &pq.Error{Code: "23514", Message: `new row violates check constraint "users_coins_balance_check"`}
+	email := "ada@example.com"
+
+	tests := []struct {
+		name      string
+		err       error
+		duplicate bool
+	}{
+		{"unique violation", duplicate, true},
+		{"other constraint", other, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := sql.OpenDB(failingConnector{err: tt.err})
+			defer db.Close()
+			repo := NewPostgresUserRepository(db)
+
+			createErr := repo.Create(ctx, factory.User(factory.WithEmail(email)))
+			updateErr := repo.Update(ctx, factory.User().ID, &domain.UpdateUserFields{Email: &email})
+			for op, err := range map[string]error{"Create": createErr, "Update": updateErr} {
+				if got := errors.Is(err, domain.ErrEmailAlreadyExists); got != tt.duplicate {
+					t.Errorf("%s: %v, want ErrEmailAlreadyExists %v", op, err, tt.duplicate)
+				}
+				if !tt.duplicate && !errors.Is(err, tt.err) {
+					t.Errorf("%s: %v, want the driver error wrapped", op, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"user-service/internal/domain"
+)
+
+// SetIdempotencyKeyTTL sets how long a stored idempotency key is honored. It
+// is meant to be called once at startup, before serving requests.
+func (r *postgresUserRepository) SetIdempotencyKeyTTL(ttl time.Duration) {
+	r.idempotencyKeyTTL = ttl
+}
+
+// idempotencyRequestHash identifies what a key was first used for, so reusing
+// it for a different request can be refused.
+func idempotencyRequestHash(operation string, params ...interface{}) string {
+	parts := []string{operation}
+	for _, param := range params {
+		parts = append(parts, fmt.Sprint(param))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, ":")))
+	return hex.EncodeToString(sum[:])
+}
+
+// claimIdempotencyKey claims key for the user inside tx before the mutation
+// runs. If the key was already used and has not expired, it returns the user
+// as the first request left it, decrypted, and true, and the caller must not
+// mutate again. A claim by a concurrent transaction blocks until that one
+// ends, so a retry racing the original still sees its result.
+func (r *postgresUserRepository) claimIdempotencyKey(ctx context.Context, tx *sql.Tx, userID, key, requestHash string, ttl time.Duration) (*domain.User, bool, error) {
+	expiresAt := time.Now().UTC().Add(ttl)
+
+	// An expired key is taken over as if it were new
+	var claimed string
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO idempotency_keys (user_id, key, request_hash, response, expires_at)
+		SELECT $1, $2, $3, '{}', $4
+		WHERE EXISTS (SELECT 1 FROM users WHERE id = $1)
+		ON CONFLICT (user_id, key) DO UPDATE SET
+			request_hash = EXCLUDED.request_hash,
+			response = EXCLUDED.response,
+			created_at = NOW(),
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= NOW()
+		RETURNING user_id`,
+		userID, key, requestHash, expiresAt,
+	).Scan(&claimed)
+	if err == nil {
+		return nil, false, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, false, wrapErr("claim idempotency key", err)
+	}
+
+	var storedHash string
+	var response []byte
+	err = tx.QueryRowContext(ctx,
+		`SELECT request_hash, response FROM idempotency_keys WHERE user_id = $1 AND key = $2`,
+		userID, key,
+	).Scan(&storedHash, &response)
+	if err == sql.ErrNoRows {
+		return nil, false, domain.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, false, wrapErr("get idempotency key", err)
+	}
+	if storedHash != requestHash {
+		return nil, false, domain.ErrIdempotencyKeyReused
+	}
+
+	var user domain.User
+	if err := json.Unmarshal(response, &user); err != nil {
+		return nil, false, wrapErr("decode idempotent response", err)
+	}
+	if r.pii != nil {
+		if user.Email, err = r.pii.Decrypt(ctx, user.Email); err != nil {
+			return nil, false, wrapErr("decrypt idempotent response", err)
+		}
+		if user.Name, err = r.pii.Decrypt(ctx, user.Name); err != nil {
+			return nil, false, wrapErr("decrypt idempotent response", err)
+		}
+	}
+	return &user, true, nil
+}
+
+// storeIdempotentResult saves the user as the mutation left it under the key
+// claimed in tx, for replays. Email and name are stored as the users row
+// stores them, encrypted while encryption is on.
+func (r *postgresUserRepository) storeIdempotentResult(ctx context.Context, tx *sql.Tx, userID, key string, user *domain.User) error {
+	stored := *user
+	var err error
+	if stored.Email, stored.Name, _, err = r.sealUser(ctx, user.Email, user.Name); err != nil {
+		return err
+	}
+	response, err := json.Marshal(stored)
+	if err != nil {
+		return wrapErr("encode idempotent response", err)
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE idempotency_keys SET response = $3 WHERE user_id = $1 AND key = $2`,
+		userID, key, response,
+	)
+	if err != nil {
+		return wrapErr("store idempotent response", err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"user-service/internal/domain"
+)
+
+func TestIdempotencyKeyReplaysUntilExpired(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+	user := createFundedUser(t, repo, 100)
+
+	first, replayed, err := repo.AddCoinsAtomic(ctx, user.ID, 10, domain.CoinReasonPurchase, "key-1")
+	if err != nil || replayed {
+		t.Fatalf("first AddCoinsAtomic: replayed %v, %v", replayed, err)
+	}
+	if first.CoinsBalance != 110 {
+		t.Fatalf("balance %d after the first request, want 110", first.CoinsBalance)
+	}
+
+	// A fresh key replays the stored result without applying it again
+	again, replayed, err := repo.AddCoinsAtomic(ctx, user.ID, 10, domain.CoinReasonPurchase, "key-1")
+	if err != nil || !replayed {
+		t.Fatalf("retry: replayed %v, %v", replayed, err)
+	}
+	if again.CoinsBalance != 110 || again.Email != first.Email || !again.UpdatedAt.Equal(first.UpdatedAt) {
+		t.Errorf("replayed balance %d, email %q, updated %v: want the first result", again.CoinsBalance, again.Email, again.UpdatedAt)
+	}
+	if _, _, err := repo.AddCoinsAtomic(ctx, user.ID, 20, domain.CoinReasonPurchase, "key-1"); !errors.Is(err, domain.ErrIdempotencyKeyReused) {
+		t.Errorf("key reused for another amount: got %v, want ErrIdempotencyKeyReused", err)
+	}
+
+	// An expired key is taken over and the mutation applies again
+	if _, err := db.ExecContext(ctx, `UPDATE idempotency_keys SET expires_at = NOW() - interval '1 second' WHERE user_id = $1`, user.ID); err != nil {
+		t.Fatalf("expire key: %v", err)
+	}
+	renewed, replayed, err := repo.AddCoinsAtomic(ctx, user.ID, 10, domain.CoinReasonPurchase, "key-1")
+	if err != nil || replayed {
+		t.Fatalf("AddCoinsAtomic with an expired key: replayed %v, %v", replayed, err)
+	}
+	if renewed.CoinsBalance != 120 {
+		t.Fatalf("balance %d after the expired key was reused, want 120", renewed.CoinsBalance)
+	}
+	replay, replayed, err := repo.AddCoinsAtomic(ctx, user.ID, 10, domain.CoinReasonPurchase, "key-1")
+	if err != nil || !replayed || replay.CoinsBalance != 120 {
+		t.Fatalf("retry after takeover: balance %v, replayed %v, %v", replay, replayed, err)
+	}
+
+	var keys int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM idempotency_keys WHERE user_id = $1 AND expires_at > NOW()`, user.ID).Scan(&keys); err != nil {
+		t.Fatalf("count keys: %v", err)
+	}
+	if keys != 1 {
+		t.Errorf("%d live keys, want 1", keys)
+	}
+}
+
+func TestConcurrentRetriesApplyOnce(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+	user := createFundedUser(t, repo, 100)
+
+	const retries = 8
+	balances := make([]int64, retries)
+	errs := make([]error, retries)
+	var wg sync.WaitGroup
+	for i := 0; i < retries; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			got, _, err := repo.DeductCoinsAtomic(ctx, user.ID, 30, domain.CoinReasonSpend, "checkout-1")
+			errs[i] = err
+			if err == nil {
+				balances[i] = got.CoinsBalance
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range errs {
+		if errs[i] != nil {
+			t.Fatalf("retry %d: %v", i, errs[i])
+		}
+		if balances[i] != 70 {
+			t.Errorf("retry %d saw balance %d, want 70", i, balances[i])
+		}
+	}
+	got, err := repo.GetByID(ctx, user.ID, false)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.CoinsBalance != 70 {
+		t.Errorf("balance %d, want 70", got.CoinsBalance)
+	}
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"user-service/internal/jobs"
+	"user-service/internal/timing"
+)
+
+type postgresJobRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresJobRepository(db *sql.DB) *postgresJobRepository {
+	return &postgresJobRepository{db: db}
+}
+
+const jobColumns = `name, status, checkpoint, processed, error, started_at, updated_at, finished_at`
+
+func scanJobState(row interface{ Scan(...interface{}) error }) (*jobs.State, error) {
+	var state jobs.State
+	var jobErr sql.NullString
+	var finishedAt sql.NullTime
+	err := row.Scan(
+		&state.Name,
+		&state.Status,
+		&state.Checkpoint,
+		&state.Processed,
+		&jobErr,
+		&state.StartedAt,
+		&state.UpdatedAt,
+		&finishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	state.Error = jobErr.String
+	if finishedAt.Valid {
+		state.FinishedAt = &finishedAt.Time
+	}
+	return &state, nil
+}
+
+// Get returns the job's saved state, or nil if it has never run.
+func (r *postgresJobRepository) Get(ctx context.Context, name string) (*jobs.State, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_job_get", time.Now())
+
+	state, err := scanJobState(r.db.QueryRowContext(ctx,
+		`SELECT `+jobColumns+` FROM job_checkpoints WHERE name = $1`, name))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, wrapErr("get job checkpoint", err)
+	}
+	return state, nil
+}
+
+func (r *postgresJobRepository) Save(ctx context.Context, state jobs.State) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_job_save", time.Now())
+
+	var jobErr interface{}
+	if state.Error != "" {
+		jobErr = state.Error
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO job_checkpoints (name, status, checkpoint, processed, error, started_at, updated_at, finished_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (name) DO UPDATE SET
+			status = EXCLUDED.status,
+			checkpoint = EXCLUDED.checkpoint,
+			processed = EXCLUDED.processed,
+			error = EXCLUDED.error,
+			started_at = EXCLUDED.started_at,
+			updated_at = EXCLUDED.updated_at,
+			finished_at = EXCLUDED.finished_at`,
+		state.Name, state.Status, state.Checkpoint, state.Processed, jobErr,
+		state.StartedAt, state.UpdatedAt, state.FinishedAt,
+	)
+	if err != nil {
+		return wrapErr("save job checkpoint", err)
+	}
+	return nil
+}
+
+func (r *postgresJobRepository) List(ctx context.Context) ([]jobs.State, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_job_list", time.Now())
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+jobColumns+` FROM job_checkpoints ORDER BY name`)
+	if err != nil {
+		return nil, wrapErr("list job checkpoints", err)
+	}
+	defer rows.Close()
+
+	states := []jobs.State{}
+	for rows.Next() {
+		state, err := scanJobState(rows)
+		if err != nil {
+			return nil, wrapErr("scan job checkpoint row", err)
+		}
+		states = append(states, *state)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("iterate job checkpoint rows", err)
+	}
+	return states, nil
+}
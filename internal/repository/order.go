@@ -0,0 +1,527 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/timing"
+
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+type postgresOrderRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresOrderRepository(db *sql.DB) *postgresOrderRepository {
+	return &postgresOrderRepository{db: db}
+}
+
+// Checkout prices every item, deducts the total from the user's balance,
+// decrements stock and writes the order in a single transaction. The user
+// must exist and be active. A failure attributable to one item is returned
+// as a *domain.LineItemError.
+func (r *postgresOrderRepository) Checkout(ctx context.Context, userID string, items []domain.CheckoutItem) (*domain.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_order_checkout", time.Now())
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, wrapErr("begin checkout", err)
+	}
+	defer tx.Rollback()
+
+	order, err := checkout(ctx, tx, userID, items)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, wrapErr("commit checkout", err)
+	}
+
+	log.WithFields(log.Fields{
+		"order_id":    order.ID,
+		"user_id":     userID,
+		"total_coins": order.TotalCoins,
+		"items":       len(order.Items),
+	}).Info("Checkout completed")
+
+	return order, nil
+}
+
+// checkout performs a checkout inside tx, leaving the commit to the caller.
+func checkout(ctx context.Context, tx *sql.Tx, userID string, items []domain.CheckoutItem) (*domain.Order, error) {
+	// Lock products in a fixed order so concurrent checkouts sharing products
+	// can't deadlock each other.
+	lockOrder := make([]int, len(items))
+	for i := range lockOrder {
+		lockOrder[i] = i
+	}
+	sort.Slice(lockOrder, func(a, b int) bool {
+		return items[lockOrder[a]].ProductID < items[lockOrder[b]].ProductID
+	})
+
+	order := &domain.Order{
+		UserID: userID,
+		Status: domain.OrderStatusCompleted,
+		Items:  make([]domain.OrderItem, len(items)),
+	}
+
+	// The ledger entry is categorized by the products' category, or as mixed
+	// when they span several
+	category := ""
+	for _, i := range lockOrder {
+		item := items[i]
+
+		var name, categorySlug string
+		var price int64
+		var isActive bool
+		var stock sql.NullInt64
+		err := tx.QueryRowContext(ctx,
+			`SELECT p.name, p.price_coins, p.is_active, p.stock, c.slug
+			 FROM products p
+			 JOIN product_categories c ON c.id = p.category_id
+			 WHERE p.id = $1
+			 FOR UPDATE OF p`,
+			item.ProductID,
+		).Scan(&name, &price, &isActive, &stock, &categorySlug)
+		if err == sql.ErrNoRows {
+			return nil, &domain.LineItemError{Index: i, ProductID: item.ProductID, Err: domain.ErrProductNotFound}
+		}
+		if err != nil {
+			return nil, wrapErr("lock checkout product", err)
+		}
+
+		if !isActive {
+			return nil, &domain.LineItemError{Index: i, ProductID: item.ProductID, Err: domain.ErrProductInactive}
+		}
+		if price < domain.MinProductPrice {
+			return nil, &domain.LineItemError{Index: i, ProductID: item.ProductID, Err: domain.ErrInvalidPrice}
+		}
+		if stock.Valid && stock.Int64 < int64(item.Quantity) {
+			return nil, &domain.LineItemError{Index: i, ProductID: item.ProductID, Err: domain.ErrOutOfStock}
+		}
+
+		switch category {
+		case "":
+			category = categorySlug
+		case categorySlug:
+		default:
+			category = domain.CoinCategoryMixed
+		}
+
+		lineTotal := price * int64(item.Quantity)
+		order.Items[i] = domain.OrderItem{
+			ProductID:      item.ProductID,
+			ProductName:    name,
+			Quantity:       item.Quantity,
+			UnitPriceCoins: price,
+			TotalCoins:     lineTotal,
+		}
+		order.TotalCoins += lineTotal
+
+		if stock.Valid {
+			_, err := tx.ExecContext(ctx,
+				`UPDATE products SET stock = stock - $1, updated_at = NOW() WHERE id = $2`,
+				item.Quantity, item.ProductID,
+			)
+			if err != nil {
+				return nil, wrapErr("decrement product stock", err)
+			}
+		}
+	}
+
+	var balance int64
+	var status domain.UserStatus
+	err := tx.QueryRowContext(ctx, `SELECT coins_balance, status FROM users WHERE id = $1`+notDeleted+` FOR UPDATE`, userID).Scan(&balance, &status)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, wrapErr("lock checkout user", err)
+	}
+	if status != domain.StatusActive {
+		return nil, domain.ErrUserNotActive
+	}
+	if balance < order.TotalCoins {
+		return nil, domain.ErrInsufficientCoinsBalance
+	}
+
+	err = tx.QueryRowContext(ctx,
+		`UPDATE users SET coins_balance = coins_balance - $1, updated_at = NOW() WHERE id = $2 RETURNING coins_balance`,
+		order.TotalCoins, userID,
+	).Scan(&balance)
+	if err != nil {
+		return nil, wrapErr("deduct checkout total", err)
+	}
+
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO orders (user_id, total_coins, status) VALUES ($1, $2, $3) RETURNING id, created_at`,
+		userID, order.TotalCoins, order.Status,
+	).Scan(&order.ID, &order.CreatedAt)
+	if err != nil {
+		return nil, wrapErr("insert order", err)
+	}
+	_, err = recordOrderCoinTransaction(ctx, tx, userID, order.TotalCoins, domain.CoinDirectionDebit, domain.CoinReasonCheckout, balance, ledgerRef{OrderID: order.ID, Category: category})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, item := range order.Items {
+		err := tx.QueryRowContext(ctx,
+			`INSERT INTO order_items (order_id, line_no, product_id, product_name, quantity, unit_price_coins, total_coins)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7)
+			 RETURNING id`,
+			order.ID, i, item.ProductID, item.ProductName, item.Quantity, item.UnitPriceCoins, item.TotalCoins,
+		).Scan(&order.Items[i].ID)
+		if err != nil {
+			return nil, wrapErr("insert order item", err)
+		}
+	}
+
+	return order, nil
+}
+
+func (r *postgresOrderRepository) GetByID(ctx context.Context, id string) (*domain.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_order_get_by_id", time.Now())
+
+	var order domain.Order
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, user_id, total_coins, status, created_at FROM orders WHERE id = $1`,
+		id,
+	).Scan(&order.ID, &order.UserID, &order.TotalCoins, &order.Status, &order.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrOrderNotFound
+	}
+	if err != nil {
+		log.WithError(err).WithField("order_id", id).Error("Failed to get order by ID")
+		return nil, wrapErr("get order by id", err)
+	}
+
+	orders := []domain.Order{order}
+	if err := r.loadItems(ctx, orders); err != nil {
+		return nil, err
+	}
+
+	return &orders[0], nil
+}
+
+// ListByUser returns a page of the user's orders, newest first, together with
+// the total number of orders the user has.
+func (r *postgresOrderRepository) ListByUser(ctx context.Context, userID string, limit, offset int) ([]domain.Order, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_order_list_by_user", time.Now())
+
+	var total int64
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM orders WHERE user_id = $1`, userID).Scan(&total); err != nil {
+		return nil, 0, wrapErr("count user orders", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, user_id, total_coins, status, created_at
+		 FROM orders
+		 WHERE user_id = $1
+		 ORDER BY created_at DESC, id DESC
+		 LIMIT $2 OFFSET $3`,
+		userID, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, wrapErr("list user orders", err)
+	}
+	defer rows.Close()
+
+	orders := []domain.Order{}
+	for rows.Next() {
+		var order domain.Order
+		if err := rows.Scan(&order.ID, &order.UserID, &order.TotalCoins, &order.Status, &order.CreatedAt); err != nil {
+			return nil, 0, wrapErr("scan order row", err)
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, wrapErr("iterate order rows", err)
+	}
+
+	if err := r.loadItems(ctx, orders); err != nil {
+		return nil, 0, err
+	}
+
+	return orders, total, nil
+}
+
+// loadItems fills in the line items of orders with a single query.
+func (r *postgresOrderRepository) loadItems(ctx context.Context, orders []domain.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(orders))
+	index := make(map[string]int, len(orders))
+	for i := range orders {
+		ids[i] = orders[i].ID
+		index[orders[i].ID] = i
+		orders[i].Items = []domain.OrderItem{}
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT order_id, id, product_id, product_name, quantity, unit_price_coins, total_coins, refunded_at
+		 FROM order_items
+		 WHERE order_id = ANY($1)
+		 ORDER BY order_id, line_no`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return wrapErr("list order items", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderID string
+		var item domain.OrderItem
+		var refundedAt sql.NullTime
+		if err := rows.Scan(&orderID, &item.ID, &item.ProductID, &item.ProductName, &item.Quantity, &item.UnitPriceCoins, &item.TotalCoins, &refundedAt); err != nil {
+			return wrapErr("scan order item row", err)
+		}
+		if refundedAt.Valid {
+			item.RefundedAt = &refundedAt.Time
+		}
+		i := index[orderID]
+		orders[i].Items = append(orders[i].Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return wrapErr("iterate order item rows", err)
+	}
+
+	return nil
+}
+
+// Refund refunds the given items of an order, or every unrefunded item when
+// itemIDs is empty. Coins go back to the user's balance without counting as
+// purchased, tracked stock is restored and the order status is updated, all
+// in one transaction. The order row is locked first, so concurrent refunds of
+// the same order are serialized and an item can only be refunded once.
+func (r *postgresOrderRepository) Refund(ctx context.Context, orderID string, itemIDs []string) (*domain.OrderRefund, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_order_refund", time.Now())
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, wrapErr("begin refund", err)
+	}
+	defer tx.Rollback()
+
+	refund := &domain.OrderRefund{OrderID: orderID}
+	err = tx.QueryRowContext(ctx, `SELECT user_id FROM orders WHERE id = $1 FOR UPDATE`, orderID).Scan(&refund.UserID)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, wrapErr("lock refund order", err)
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, product_id, product_name, quantity, unit_price_coins, total_coins, refunded_at
+		 FROM order_items
+		 WHERE order_id = $1
+		 ORDER BY line_no`,
+		orderID,
+	)
+	if err != nil {
+		return nil, wrapErr("list refund order items", err)
+	}
+	var items []domain.OrderItem
+	for rows.Next() {
+		var item domain.OrderItem
+		var refundedAt sql.NullTime
+		if err := rows.Scan(&item.ID, &item.ProductID, &item.ProductName, &item.Quantity, &item.UnitPriceCoins, &item.TotalCoins, &refundedAt); err != nil {
+			rows.Close()
+			return nil, wrapErr("scan refund order item", err)
+		}
+		if refundedAt.Valid {
+			item.RefundedAt = &refundedAt.Time
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("iterate refund order items", err)
+	}
+
+	requested := make(map[string]bool, len(itemIDs))
+	for _, id := range itemIDs {
+		requested[id] = true
+	}
+
+	// remaining counts items still unrefunded after this refund
+	remaining := 0
+	for _, item := range items {
+		if item.RefundedAt != nil {
+			if requested[item.ID] {
+				return nil, domain.ErrOrderItemAlreadyRefunded
+			}
+			continue
+		}
+		if len(itemIDs) == 0 || requested[item.ID] {
+			refund.Items = append(refund.Items, item)
+			delete(requested, item.ID)
+		} else {
+			remaining++
+		}
+	}
+	if len(requested) > 0 {
+		return nil, domain.ErrOrderItemNotFound
+	}
+	if len(refund.Items) == 0 {
+		return nil, domain.ErrOrderAlreadyRefunded
+	}
+
+	refundIDs := make([]string, len(refund.Items))
+	for i, item := range refund.Items {
+		refundIDs[i] = item.ID
+		refund.AmountCoins += item.TotalCoins
+	}
+
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO order_refunds (order_id, amount_coins) VALUES ($1, $2) RETURNING id, created_at`,
+		orderID, refund.AmountCoins,
+	).Scan(&refund.ID, &refund.CreatedAt)
+	if err != nil {
+		return nil, wrapErr("insert order refund", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE order_items SET refund_id = $1, refunded_at = $2 WHERE id = ANY($3)`,
+		refund.ID, refund.CreatedAt, pq.Array(refundIDs),
+	)
+	if err != nil {
+		return nil, wrapErr("mark order items refunded", err)
+	}
+	for i := range refund.Items {
+		refund.Items[i].RefundedAt = &refund.CreatedAt
+	}
+
+	// Restore stock in product ID order, matching Checkout's lock order
+	restock := make([]domain.OrderItem, len(refund.Items))
+	copy(restock, refund.Items)
+	sort.Slice(restock, func(a, b int) bool {
+		return restock[a].ProductID < restock[b].ProductID
+	})
+	for _, item := range restock {
+		_, err := tx.ExecContext(ctx,
+			`UPDATE products SET stock = stock + $1, updated_at = NOW() WHERE id = $2 AND stock IS NOT NULL`,
+			item.Quantity, item.ProductID,
+		)
+		if err != nil {
+			return nil, wrapErr("restore product stock", err)
+		}
+	}
+
+	var balance int64
+	err = tx.QueryRowContext(ctx,
+		`UPDATE users SET coins_balance = coins_balance + $1, updated_at = NOW() WHERE id = $2 RETURNING coins_balance`,
+		refund.AmountCoins, refund.UserID,
+	).Scan(&balance)
+	if err != nil {
+		return nil, wrapErr("credit refund", err)
+	}
+
+	// Orders placed before the ledger named its orders have no entry to
+	// reverse. The refund takes the category of the entry it reverses.
+	var checkoutEntry sql.NullInt64
+	var category sql.NullString
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, category FROM coin_transactions WHERE order_id = $1 AND reason = $2 ORDER BY id LIMIT 1`,
+		orderID, domain.CoinReasonCheckout,
+	).Scan(&checkoutEntry, &category)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, wrapErr("find refunded checkout entry", err)
+	}
+	_, err = recordOrderCoinTransaction(ctx, tx, refund.UserID, refund.AmountCoins, domain.CoinDirectionCredit, domain.CoinReasonRefund, balance, ledgerRef{
+		OrderID:    orderID,
+		RefundID:   refund.ID,
+		ReversesID: checkoutEntry.Int64,
+		Category:   category.String,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refund.OrderStatus = domain.OrderStatusRefunded
+	if remaining > 0 {
+		refund.OrderStatus = domain.OrderStatusPartiallyRefunded
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE orders SET status = $1 WHERE id = $2`, refund.OrderStatus, orderID); err != nil {
+		return nil, wrapErr("update order status", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, wrapErr("commit refund", err)
+	}
+
+	log.WithFields(log.Fields{
+		"order_id":     orderID,
+		"refund_id":    refund.ID,
+		"amount_coins": refund.AmountCoins,
+		"items":        len(refund.Items),
+		"order_status": refund.OrderStatus,
+	}).Info("Order refunded")
+
+	return refund, nil
+}
+
+// PurchaseQuote reads the user's balance and the product's price and
+// availability in one query. Purchases draw on the whole balance, so it is
+// also the available balance.
+func (r *postgresOrderRepository) PurchaseQuote(ctx context.Context, userID, productID string) (*domain.PurchaseQuote, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_order_purchase_quote", time.Now())
+
+	var balance, price, stock sql.NullInt64
+	var isActive sql.NullBool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT u.coins_balance, p.price_coins, p.is_active, p.stock
+		FROM (SELECT 1) AS one
+		LEFT JOIN users u ON u.id = $1 AND u.deleted_at IS NULL
+		LEFT JOIN products p ON p.id = $2`,
+		userID, productID,
+	).Scan(&balance, &price, &isActive, &stock)
+	if err != nil {
+		return nil, wrapErr("get purchase quote", err)
+	}
+
+	if !balance.Valid {
+		return nil, domain.ErrUserNotFound
+	}
+	if !price.Valid {
+		return nil, domain.ErrProductNotFound
+	}
+
+	quote := &domain.PurchaseQuote{
+		PriceCoins: price.Int64,
+		Balance:    balance.Int64,
+	}
+	if quote.Balance >= quote.PriceCoins {
+		quote.Affordable = true
+	} else {
+		quote.Shortfall = quote.PriceCoins - quote.Balance
+	}
+
+	if !isActive.Bool {
+		return quote, domain.ErrProductInactive
+	}
+	if stock.Valid && stock.Int64 <= 0 {
+		return quote, domain.ErrOutOfStock
+	}
+
+	return quote, nil
+}
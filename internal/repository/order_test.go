@@ -0,0 +1,370 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"user-service/internal/domain"
+	"user-service/internal/testutil/factory"
+)
+
+func TestRefundLedgerEntryReversesCheckout(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	users := NewPostgresUserRepository(db)
+	orders := NewPostgresOrderRepository(db)
+
+	user := createFundedUser(t, users, 100)
+	productID := createTestProduct(t, db, factory.WithPrice(30))
+
+	order, err := orders.Checkout(ctx, user.ID, []domain.CheckoutItem{{ProductID: productID, Quantity: 2}})
+	if err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	refund, err := orders.Refund(ctx, order.ID, nil)
+	if err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+
+	ledger, _, err := users.ListCoinTransactions(ctx, user.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("ListCoinTransactions: %v", err)
+	}
+	var checkout, credit *domain.CoinTransaction
+	for i := range ledger {
+		switch ledger[i].Reason {
+		case domain.CoinReasonCheckout:
+			checkout = &ledger[i]
+		case domain.CoinReasonRefund:
+			credit = &ledger[i]
+		}
+	}
+	if checkout == nil || credit == nil {
+		t.Fatalf("ledger %+v: want a checkout and a refund entry", ledger)
+	}
+	if checkout.OrderID == nil || *checkout.OrderID != order.ID {
+		t.Errorf("checkout entry order %v, want %s", checkout.OrderID, order.ID)
+	}
+	if credit.OrderID == nil || *credit.OrderID != order.ID {
+		t.Errorf("refund entry order %v, want %s", credit.OrderID, order.ID)
+	}
+	if credit.RefundID == nil || *credit.RefundID != refund.ID {
+		t.Errorf("refund entry refund %v, want %s", credit.RefundID, refund.ID)
+	}
+	if credit.ReversesID == nil || *credit.ReversesID != checkout.ID {
+		t.Errorf("refund entry reverses %v, want %d", credit.ReversesID, checkout.ID)
+	}
+}
+
+func TestCheckoutRejectsInactiveUser(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	users := NewPostgresUserRepository(db)
+	orders := NewPostgresOrderRepository(db)
+
+	user := createFundedUser(t, users, 100, factory.WithStatus(domain.StatusSuspended))
+	productID := createTestProduct(t, db, factory.WithPrice(10))
+
+	_, err := orders.Checkout(ctx, user.ID, []domain.CheckoutItem{{ProductID: productID, Quantity: 1}})
+	if !errors.Is(err, domain.ErrUserNotActive) {
+		t.Fatalf("Checkout by a suspended user: got %v, want ErrUserNotActive", err)
+	}
+}
+
+func TestParallelCheckoutsNeverOversellStock(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	users := NewPostgresUserRepository(db)
+	orders := NewPostgresOrderRepository(db)
+
+	const stock, buyers = 3, 10
+	limited := int64(stock)
+	productID := createTestProduct(t, db, factory.WithPrice(10), factory.WithStock(limited))
+	buyerIDs := make([]string, buyers)
+	for i := range buyerIDs {
+		buyerIDs[i] = createFundedUser(t, users, 100).ID
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, buyers)
+	for i, id := range buyerIDs {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			_, errs[i] = orders.Checkout(ctx, id, []domain.CheckoutItem{{ProductID: productID, Quantity: 1}})
+		}(i, id)
+	}
+	wg.Wait()
+
+	sold := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			sold++
+		case errors.Is(err, domain.ErrOutOfStock):
+		default:
+			t.Errorf("Checkout: %v", err)
+		}
+	}
+	if sold != stock {
+		t.Errorf("%d checkouts succeeded, want %d", sold, stock)
+	}
+
+	var left int64
+	if err := db.QueryRow(`SELECT stock FROM products WHERE id = $1`, productID).Scan(&left); err != nil {
+		t.Fatalf("read stock: %v", err)
+	}
+	if left != 0 {
+		t.Errorf("stock left %d, want 0", left)
+	}
+}
+
+func TestPurchaseQuoteHidesDeletedUser(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	users := NewPostgresUserRepository(db)
+	orders := NewPostgresOrderRepository(db)
+
+	user := createFundedUser(t, users, 100)
+	productID := createTestProduct(t, db, factory.WithPrice(30))
+	if _, err := orders.PurchaseQuote(ctx, user.ID, productID); err != nil {
+		t.Fatalf("PurchaseQuote before deletion: %v", err)
+	}
+	if err := users.Delete(ctx, user.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	if _, err := orders.PurchaseQuote(ctx, user.ID, productID); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Fatalf("PurchaseQuote after deletion: got %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestPurchaseQuote(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	users := NewPostgresUserRepository(db)
+	orders := NewPostgresOrderRepository(db)
+	user := createFundedUser(t, users, 50)
+
+	tests := []struct {
+		name      string
+		productID string
+		want      *domain.PurchaseQuote
+		wantErr   error
+	}{
+		{"below balance", createTestProduct(t, db, factory.WithPrice(30)),
+			&domain.PurchaseQuote{Affordable: true, PriceCoins: 30, Balance: 50}, nil},
+		{"exactly the balance", createTestProduct(t, db, factory.WithPrice(50)),
+			&domain.PurchaseQuote{Affordable: true, PriceCoins: 50, Balance: 50}, nil},
+		{"above balance", createTestProduct(t, db, factory.WithPrice(80)),
+			&domain.PurchaseQuote{PriceCoins: 80, Balance: 50, Shortfall: 30}, nil},
+		{"in stock", createTestProduct(t, db, factory.WithPrice(30), factory.WithStock(1)),
+			&domain.PurchaseQuote{Affordable: true, PriceCoins: 30, Balance: 50}, nil},
+		{"out of stock", createTestProduct(t, db, factory.WithPrice(80), factory.WithStock(0)),
+			&domain.PurchaseQuote{PriceCoins: 80, Balance: 50, Shortfall: 30}, domain.ErrOutOfStock},
+		{"inactive", createTestProduct(t, db, factory.WithPrice(30), factory.InactiveProduct()),
+			&domain.PurchaseQuote{Affordable: true, PriceCoins: 30, Balance: 50}, domain.ErrProductInactive},
+		{"unknown product", "0190c2a8-7f1e-7a3b-8c4d-000000000999", nil, domain.ErrProductNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quote, err := orders.PurchaseQuote(ctx, user.ID, tt.productID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if (quote == nil) != (tt.want == nil) || (quote != nil && *quote != *tt.want) {
+				t.Errorf("quote %+v, want %+v", quote, tt.want)
+			}
+		})
+	}
+
+	// A quote changes nothing
+	var balance int64
+	if err := db.QueryRow(`SELECT coins_balance FROM users WHERE id = $1`, user.ID).Scan(&balance); err != nil {
+		t.Fatalf("read balance: %v", err)
+	}
+	if balance != 50 {
+		t.Errorf("balance %d after quoting, want 50", balance)
+	}
+	if _, err := orders.PurchaseQuote(ctx, "0190c2a8-7f1e-7a3b-9c4d-000000000999", tests[0].productID); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Errorf("unknown user: got %v, want ErrUserNotFound", err)
+	}
+}
+
+// checkoutTwoProducts has a user with 100 coins buy 2 of a 10-coin product
+// with 5 in stock and 1 of a 30-coin product with unlimited stock.
+func checkoutTwoProducts(t *testing.T, db *sql.DB) (*domain.User, *domain.Order, string) {
+	t.Helper()
+	users := NewPostgresUserRepository(db)
+	limitedID := createTestProduct(t, db, factory.WithPrice(10), factory.WithStock(5))
+	unlimitedID := createTestProduct(t, db, factory.WithPrice(30))
+	user := createFundedUser(t, users, 100)
+
+	order, err := NewPostgresOrderRepository(db).Checkout(context.Background(), user.ID, []domain.CheckoutItem{
+		{ProductID: limitedID, Quantity: 2},
+		{ProductID: unlimitedID, Quantity: 1},
+	})
+	if err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	return user, order, limitedID
+}
+
+func assertBalanceAndStock(t *testing.T, db *sql.DB, userID string, balance int64, productID string, stock int64) {
+	t.Helper()
+	var gotBalance, gotStock int64
+	if err := db.QueryRow(`SELECT coins_balance FROM users WHERE id = $1`, userID).Scan(&gotBalance); err != nil {
+		t.Fatalf("read balance: %v", err)
+	}
+	if err := db.QueryRow(`SELECT stock FROM products WHERE id = $1`, productID).Scan(&gotStock); err != nil {
+		t.Fatalf("read stock: %v", err)
+	}
+	if gotBalance != balance || gotStock != stock {
+		t.Errorf("balance %d and stock %d, want %d and %d", gotBalance, gotStock, balance, stock)
+	}
+}
+
+func TestFullRefund(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	orders := NewPostgresOrderRepository(db)
+
+	user, order, limitedID := checkoutTwoProducts(t, db)
+	assertBalanceAndStock(t, db, user.ID, 50, limitedID, 3)
+
+	refund, err := orders.Refund(ctx, order.ID, nil)
+	if err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	if refund.AmountCoins != 50 || len(refund.Items) != 2 || refund.OrderStatus != domain.OrderStatusRefunded {
+		t.Errorf("refund of %d coins for %d items, order %s: want 50 for 2, refunded", refund.AmountCoins, len(refund.Items), refund.OrderStatus)
+	}
+	assertBalanceAndStock(t, db, user.ID, 100, limitedID, 5)
+
+	if _, err := orders.Refund(ctx, order.ID, nil); !errors.Is(err, domain.ErrOrderAlreadyRefunded) {
+		t.Errorf("second full refund: got %v, want ErrOrderAlreadyRefunded", err)
+	}
+	assertBalanceAndStock(t, db, user.ID, 100, limitedID, 5)
+}
+
+func TestPartialRefunds(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	orders := NewPostgresOrderRepository(db)
+
+	user, order, limitedID := checkoutTwoProducts(t, db)
+	limitedItem, unlimitedItem := order.Items[0], order.Items[1]
+
+	refund, err := orders.Refund(ctx, order.ID, []string{limitedItem.ID})
+	if err != nil {
+		t.Fatalf("Refund of the first item: %v", err)
+	}
+	if refund.AmountCoins != 20 || refund.OrderStatus != domain.OrderStatusPartiallyRefunded {
+		t.Errorf("refund of %d coins, order %s: want 20, partially refunded", refund.AmountCoins, refund.OrderStatus)
+	}
+	assertBalanceAndStock(t, db, user.ID, 70, limitedID, 5)
+
+	// The rest of the order is what a full refund now returns
+	refund, err = orders.Refund(ctx, order.ID, nil)
+	if err != nil {
+		t.Fatalf("Refund of the rest: %v", err)
+	}
+	if refund.AmountCoins != 30 || len(refund.Items) != 1 || refund.Items[0].ID != unlimitedItem.ID || refund.OrderStatus != domain.OrderStatusRefunded {
+		t.Errorf("refund %+v: want the 30-coin item and the order refunded", refund)
+	}
+	assertBalanceAndStock(t, db, user.ID, 100, limitedID, 5)
+}
+
+func TestRepeatedItemRefund(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	orders := NewPostgresOrderRepository(db)
+
+	user, order, limitedID := checkoutTwoProducts(t, db)
+	itemID := order.Items[0].ID
+	if _, err := orders.Refund(ctx, order.ID, []string{itemID}); err != nil {
+		t.Fatalf("first Refund: %v", err)
+	}
+	if _, err := orders.Refund(ctx, order.ID, []string{itemID}); !errors.Is(err, domain.ErrOrderItemAlreadyRefunded) {
+		t.Fatalf("second Refund: got %v, want ErrOrderItemAlreadyRefunded", err)
+	}
+	// Naming a refunded item fails the whole refund, the other item included
+	if _, err := orders.Refund(ctx, order.ID, []string{itemID, order.Items[1].ID}); !errors.Is(err, domain.ErrOrderItemAlreadyRefunded) {
+		t.Fatalf("Refund with a refunded item: got %v, want ErrOrderItemAlreadyRefunded", err)
+	}
+	assertBalanceAndStock(t, db, user.ID, 70, limitedID, 5)
+}
+
+func TestConcurrentRefundsOfOneItem(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	orders := NewPostgresOrderRepository(db)
+
+	user, order, limitedID := checkoutTwoProducts(t, db)
+	itemID := order.Items[0].ID
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = orders.Refund(ctx, order.ID, []string{itemID})
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded, rejected := 0, 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, domain.ErrOrderItemAlreadyRefunded):
+			rejected++
+		default:
+			t.Errorf("Refund: %v", err)
+		}
+	}
+	if succeeded != 1 || rejected != 1 {
+		t.Fatalf("%d refunds succeeded and %d were rejected, want 1 and 1", succeeded, rejected)
+	}
+	assertBalanceAndStock(t, db, user.ID, 70, limitedID, 5)
+
+	var credits int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM coin_transactions WHERE order_id = $1 AND reason = $2`, order.ID, domain.CoinReasonRefund).Scan(&credits); err != nil {
+		t.Fatalf("count refund entries: %v", err)
+	}
+	if credits != 1 {
+		t.Errorf("%d refund ledger entries, want 1", credits)
+	}
+}
+
+func TestPurchaseQuoteShortfall(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	users := NewPostgresUserRepository(db)
+	orders := NewPostgresOrderRepository(db)
+
+	user := createFundedUser(t, users, 200)
+	tests := []struct {
+		price      int64
+		affordable bool
+		shortfall  int64
+	}{
+		{150, true, 0},
+		{200, true, 0},
+		{500, false, 300},
+	}
+	for _, tt := range tests {
+		productID := createTestProduct(t, db, factory.WithPrice(tt.price))
+		quote, err := orders.PurchaseQuote(ctx, user.ID, productID)
+		if err != nil {
+			t.Fatalf("PurchaseQuote at %d coins: %v", tt.price, err)
+		}
+		if quote.Affordable != tt.affordable || quote.Shortfall != tt.shortfall {
+			t.Errorf("at %d coins: affordable %v, shortfall %d; want %v, %d", tt.price, quote.Affordable, quote.Shortfall, tt.affordable, tt.shortfall)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/pii"
+	"user-service/internal/timing"
+)
+
+// SetPIICipher makes reads decrypt emails and names with c and email
+// lookups go through the email hash. With encrypt, emails and names are
+// also encrypted as they are written. Rows stored in plaintext stay
+// readable either way. It is meant to be called once at startup, before
+// serving requests.
+func (r *postgresUserRepository) SetPIICipher(c *pii.Cipher, encrypt bool) {
+	r.pii = c
+	r.encryptPII = c != nil && encrypt
+}
+
+// scanUser reads a row selected with userColumns into a domain.User with
+// email and name decrypted. Scan errors, sql.ErrNoRows included, are
+// returned as they are.
+func (r *postgresUserRepository) scanUser(ctx context.Context, row interface{ Scan(...interface{}) error }) (*domain.User, error) {
+	user, err := scanUserRow(row)
+	if err != nil || r.pii == nil {
+		return user, err
+	}
+
+	if user.Email, err = r.pii.Decrypt(ctx, user.Email); err != nil {
+		return nil, wrapErr("decrypt user email", err)
+	}
+	if user.Name, err = r.pii.Decrypt(ctx, user.Name); err != nil {
+		return nil, wrapErr("decrypt user name", err)
+	}
+	return user, nil
+}
+
+// sealValue returns value as it is to be stored: encrypted while encryption
+// is on, unchanged otherwise.
+func (r *postgresUserRepository) sealValue(ctx context.Context, value string) (string, error) {
+	if !r.encryptPII {
+		return value, nil
+	}
+	sealed, err := r.pii.Encrypt(ctx, value)
+	if err != nil {
+		return "", wrapErr("encrypt user data", err)
+	}
+	return sealed, nil
+}
+
+// emailHash returns the value of the email_hash column for email: its hash
+// while a cipher is set, NULL otherwise.
+func (r *postgresUserRepository) emailHash(email string) interface{} {
+	if r.pii == nil {
+		return nil
+	}
+	return r.pii.Hash(email)
+}
+
+// redact returns fields with emails and names redacted while encryption is
+// on, for records such as admin action details kept next to the users.
+func (r *postgresUserRepository) redact(fields map[string]interface{}) map[string]interface{} {
+	if !r.encryptPII {
+		return fields
+	}
+	return r.pii.Redact(fields)
+}
+
+// sealUser returns email and name as they are to be stored, and the email hash.
+func (r *postgresUserRepository) sealUser(ctx context.Context, email, name string) (string, string, interface{}, error) {
+	sealedEmail, err := r.sealValue(ctx, email)
+	if err != nil {
+		return "", "", nil, err
+	}
+	sealedName, err := r.sealValue(ctx, name)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return sealedEmail, sealedName, r.emailHash(email), nil
+}
+
+// EncryptPIIBatch encrypts the email and name and sets the email hash of up
+// to limit users with ID after afterID that still have any of them in
+// plaintext. It returns the last ID it encrypted and how many users it
+// encrypted; rows already encrypted are not touched, so a batch can be
+// repeated. Encryption must be on.
+func (r *postgresUserRepository) EncryptPIIBatch(ctx context.Context, afterID string, limit int) (string, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_encrypt_pii_batch", time.Now())
+
+	if !r.encryptPII {
+		return "", 0, errors.New("encrypt user data: encryption is off")
+	}
+	if afterID == "" {
+		afterID = "00000000-0000-0000-0000-000000000000"
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", 0, wrapErr("begin user encryption", err)
+	}
+	defer tx.Rollback()
+
+	// Rows being written concurrently are locked out until the batch commits
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, email, name FROM users
+		WHERE id > $1
+		  AND (email_hash IS NULL OR email NOT LIKE $3 OR name NOT LIKE $3)
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE`, afterID, limit, pii.Prefix+"%")
+	if err != nil {
+		return "", 0, wrapErr("select users to encrypt", err)
+	}
+	type storedUser struct{ id, email, name string }
+	var batch []storedUser
+	for rows.Next() {
+		var u storedUser
+		if err := rows.Scan(&u.id, &u.email, &u.name); err != nil {
+			rows.Close()
+			return "", 0, wrapErr("scan user to encrypt", err)
+		}
+		batch = append(batch, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", 0, wrapErr("iterate users to encrypt", err)
+	}
+
+	var lastID string
+	for _, u := range batch {
+		// Either column may already be encrypted, e.g. after a name-only update
+		email, err := r.pii.Decrypt(ctx, u.email)
+		if err != nil {
+			return "", 0, wrapErr("decrypt email of user "+u.id, err)
+		}
+		name, err := r.pii.Decrypt(ctx, u.name)
+		if err != nil {
+			return "", 0, wrapErr("decrypt name of user "+u.id, err)
+		}
+		sealedEmail, sealedName, emailHash, err := r.sealUser(ctx, email, name)
+		if err != nil {
+			return "", 0, err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`UPDATE users SET email = $1, name = $2, email_hash = $3 WHERE id = $4`,
+			sealedEmail, sealedName, emailHash, u.id,
+		)
+		if isUniqueViolation(err) {
+			return "", 0, wrapErr("encrypt user "+u.id, domain.ErrEmailAlreadyExists)
+		}
+		if err != nil {
+			return "", 0, wrapErr("encrypt user "+u.id, err)
+		}
+		lastID = u.id
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", 0, wrapErr("commit user encryption", err)
+	}
+	return lastID, int64(len(batch)), nil
+}
@@ -0,0 +1,216 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"user-service/internal/domain"
+	"user-service/internal/pii"
+	"user-service/internal/testutil/factory"
+)
+
+func newTestPIICipher(t *testing.T) *pii.Cipher {
+	t.Helper()
+	keys, err := pii.NewStaticKeyProvider("test", bytes.Repeat([]byte{7}, pii.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := pii.NewCipher(keys, bytes.Repeat([]byte{8}, pii.MinHashKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// storedUser reads the email, name and email hash of a user as stored.
+func storedUser(t *testing.T, db *sql.DB, id string) (string, string, sql.NullString) {
+	t.Helper()
+	var email, name string
+	var emailHash sql.NullString
+	err := db.QueryRow(`SELECT email, name, email_hash FROM users WHERE id = $1`, id).Scan(&email, &name, &emailHash)
+	if err != nil {
+		t.Fatalf("read stored user: %v", err)
+	}
+	return email, name, emailHash
+}
+
+func TestEncryptedUserRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+	repo.SetPIICipher(newTestPIICipher(t), true)
+
+	user := factory.User(factory.WithEmail("ada@example.com"))
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	email, name, emailHash := storedUser(t, db, user.ID)
+	if !pii.IsEncrypted(email) || !pii.IsEncrypted(name) || !emailHash.Valid {
+		t.Fatalf("stored email %q, name %q, hash %v: want both encrypted and a hash", email, name, emailHash)
+	}
+
+	got, err := repo.GetByID(ctx, user.ID, false)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Email != user.Email || got.Name != user.Name {
+		t.Errorf("GetByID = %q, %q; want %q, %q", got.Email, got.Name, user.Email, user.Name)
+	}
+
+	newName := "Ada King"
+	if err := repo.Update(ctx, user.ID, &domain.UpdateUserFields{Name: &newName}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, name, _ := storedUser(t, db, user.ID); !pii.IsEncrypted(name) {
+		t.Errorf("updated name stored as %q", name)
+	}
+	if got, _ := repo.GetByID(ctx, user.ID, false); got.Name != newName {
+		t.Errorf("updated name read back as %q", got.Name)
+	}
+}
+
+func TestGetByEmailFindsEncryptedAndPlaintextRows(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	// A row written before encryption was turned on
+	plain := factory.User(factory.WithEmail("legacy@example.com"))
+	if err := NewPostgresUserRepository(db).Create(ctx, plain); err != nil {
+		t.Fatalf("Create plaintext: %v", err)
+	}
+
+	repo := NewPostgresUserRepository(db)
+	repo.SetPIICipher(newTestPIICipher(t), true)
+	encrypted := factory.User(factory.WithEmail("new@example.com"))
+	if err := repo.Create(ctx, encrypted); err != nil {
+		t.Fatalf("Create encrypted: %v", err)
+	}
+
+	for _, want := range []*domain.User{plain, encrypted} {
+		got, err := repo.GetByEmail(ctx, want.Email, false)
+		if err != nil {
+			t.Fatalf("GetByEmail(%q): %v", want.Email, err)
+		}
+		if got.ID != want.ID || got.Email != want.Email {
+			t.Errorf("GetByEmail(%q) = %s %q", want.Email, got.ID, got.Email)
+		}
+	}
+
+	if _, err := repo.GetByEmail(ctx, "missing@example.com", false); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Errorf("GetByEmail of an unknown email: err = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestEncryptedEmailsStayUnique(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+	repo.SetPIICipher(newTestPIICipher(t), true)
+
+	if err := repo.Create(ctx, factory.User(factory.WithEmail("ada@example.com"))); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	// The ciphertexts differ, so only the hash index can catch this
+	if err := repo.Create(ctx, factory.User(factory.WithEmail("ada@example.com"))); !errors.Is(err, domain.ErrEmailAlreadyExists) {
+		t.Errorf("second Create with the same email: err = %v, want ErrEmailAlreadyExists", err)
+	}
+
+	other := factory.User(factory.WithEmail("bob@example.com"))
+	if err := repo.Create(ctx, other); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	taken := "ada@example.com"
+	if err := repo.Update(ctx, other.ID, &domain.UpdateUserFields{Email: &taken}); !errors.Is(err, domain.ErrEmailAlreadyExists) {
+		t.Errorf("Update to a taken email: err = %v, want ErrEmailAlreadyExists", err)
+	}
+}
+
+func TestEncryptPIIBatchBackfillsAndResumes(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	plainRepo := NewPostgresUserRepository(db)
+	var users []*domain.User
+	for i := 0; i < 5; i++ {
+		user := factory.User(factory.WithEmail(fmt.Sprintf("user%d@example.com", i)))
+		if err := plainRepo.Create(ctx, user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		users = append(users, user)
+	}
+
+	repo := NewPostgresUserRepository(db)
+	repo.SetPIICipher(newTestPIICipher(t), true)
+
+	// Batches of 2 from the checkpoint each returns, as the job runs them
+	checkpoint, total := "", int64(0)
+	for batches := 0; ; batches++ {
+		if batches > 5 {
+			t.Fatal("backfill did not finish")
+		}
+		lastID, encrypted, err := repo.EncryptPIIBatch(ctx, checkpoint, 2)
+		if err != nil {
+			t.Fatalf("EncryptPIIBatch: %v", err)
+		}
+		total += encrypted
+		if lastID == "" || encrypted < 2 {
+			break
+		}
+		checkpoint = lastID
+	}
+	if total != int64(len(users)) {
+		t.Errorf("encrypted %d users, want %d", total, len(users))
+	}
+
+	for _, user := range users {
+		email, name, emailHash := storedUser(t, db, user.ID)
+		if !pii.IsEncrypted(email) || !pii.IsEncrypted(name) || !emailHash.Valid {
+			t.Errorf("user %s stored as %q, %q, %v after backfill", user.ID, email, name, emailHash)
+		}
+		got, err := repo.GetByEmail(ctx, user.Email, false)
+		if err != nil || got.ID != user.ID || got.Name != user.Name {
+			t.Errorf("GetByEmail(%q) after backfill = %+v, %v", user.Email, got, err)
+		}
+	}
+
+	// Repeating the backfill finds nothing left to do
+	if _, encrypted, err := repo.EncryptPIIBatch(ctx, "", 10); err != nil || encrypted != 0 {
+		t.Errorf("second backfill encrypted %d users, err %v", encrypted, err)
+	}
+}
+
+func TestIdempotentResponseIsStoredEncrypted(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+	repo.SetPIICipher(newTestPIICipher(t), true)
+
+	user := factory.User(factory.WithEmail("ada@example.com"))
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, _, err := repo.AddCoinsAtomic(ctx, user.ID, 10, domain.CoinReasonPurchase, "key-1"); err != nil {
+		t.Fatalf("AddCoinsAtomic: %v", err)
+	}
+
+	var response string
+	if err := db.QueryRow(`SELECT response FROM idempotency_keys WHERE user_id = $1`, user.ID).Scan(&response); err != nil {
+		t.Fatalf("read idempotency response: %v", err)
+	}
+	if strings.Contains(response, user.Email) || strings.Contains(response, user.Name) {
+		t.Errorf("idempotency response holds plaintext: %s", response)
+	}
+
+	replayed, isReplay, err := repo.AddCoinsAtomic(ctx, user.ID, 10, domain.CoinReasonPurchase, "key-1")
+	if err != nil || !isReplay {
+		t.Fatalf("replay: replayed %v, err %v", isReplay, err)
+	}
+	if replayed.Email != user.Email || replayed.Name != user.Name {
+		t.Errorf("replay returned %q, %q", replayed.Email, replayed.Name)
+	}
+}
@@ -3,11 +3,15 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 	"user-service/internal/domain"
+	"user-service/internal/timing"
 
+	"github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -19,150 +23,169 @@ func NewPostgresProductRepository(db *sql.DB) *postgresProductRepository {
 	return &postgresProductRepository{db: db}
 }
 
-func (r *postgresProductRepository) ListProducts(ctx context.Context, categoryID *string, onlyActive bool, limit, offset int) ([]domain.Product, error) {
+// productColumns lists the products columns in the order scanProduct expects them.
+const productColumns = `id, category_id, slug, name, description, price_coins, metadata, is_active, stock, view_count, created_at, updated_at`
+
+// qualifyColumns prefixes each column of a list like productColumns with
+// alias, for queries joining tables with overlapping column names.
+func qualifyColumns(columns, alias string) string {
+	parts := strings.Split(columns, ", ")
+	for i, col := range parts {
+		parts[i] = alias + "." + col
+	}
+	return strings.Join(parts, ", ")
+}
+
+// scanProduct reads a row selected with productColumns into a domain.Product.
+// NULL description and metadata are read as "".
+func scanProduct(row interface{ Scan(...interface{}) error }) (*domain.Product, error) {
+	var product domain.Product
+	var description, metadata sql.NullString
+	var stock sql.NullInt64
+	err := row.Scan(
+		&product.ID,
+		&product.CategoryID,
+		&product.Slug,
+		&product.Name,
+		&description,
+		&product.PriceCoins,
+		&metadata,
+		&product.IsActive,
+		&stock,
+		&product.ViewCount,
+		&product.CreatedAt,
+		&product.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	product.Description = description.String
+	product.Metadata = metadata.String
+	if stock.Valid {
+		product.Stock = &stock.Int64
+	}
+
+	return &product, nil
+}
+
+// ListProducts returns a page of the matching products and how many match
+// in total; the count uses the same filters as the page.
+func (r *postgresProductRepository) ListProducts(ctx context.Context, categoryID *string, onlyActive bool, sort string, limit, offset int) ([]domain.Product, int64, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	defer timing.Record(ctx, "db_product_list_products", time.Now())
 
-	var query strings.Builder
+	var where strings.Builder
 	args := []interface{}{}
 	argPos := 1
 
-	query.WriteString(`SELECT id, category_id, slug, name, description, price_coins, metadata, is_active, created_at, updated_at 
-	                   FROM products 
-	                   WHERE 1=1`)
+	where.WriteString("1=1")
 
 	if categoryID != nil {
-		query.WriteString(fmt.Sprintf(" AND category_id = $%d", argPos))
+		where.WriteString(fmt.Sprintf(" AND category_id = $%d", argPos))
 		args = append(args, *categoryID)
 		argPos++
 	}
 
 	if onlyActive {
-		query.WriteString(fmt.Sprintf(" AND is_active = $%d", argPos))
+		where.WriteString(fmt.Sprintf(" AND is_active = $%d", argPos))
 		args = append(args, true)
 		argPos++
 	}
 
-	query.WriteString(" ORDER BY created_at DESC")
+	var total int64
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM products WHERE `+where.String(), args...).Scan(&total); err != nil {
+		return nil, 0, wrapErr("count products", err)
+	}
+
+	var query strings.Builder
+	query.WriteString(`SELECT ` + productColumns + `
+	                   FROM products
+	                   WHERE ` + where.String())
+
+	if sort == domain.ProductSortPopularity {
+		query.WriteString(" ORDER BY view_count DESC, id")
+	} else {
+		query.WriteString(" ORDER BY created_at DESC, id DESC")
+	}
 	query.WriteString(fmt.Sprintf(" LIMIT $%d OFFSET $%d", argPos, argPos+1))
 	args = append(args, limit, offset)
 
 	rows, err := r.db.QueryContext(ctx, query.String(), args...)
 	if err != nil {
-		return nil, err
+		return nil, 0, wrapErr("list products", err)
 	}
 	defer rows.Close()
 
-	var products []domain.Product
+	products := []domain.Product{}
 	for rows.Next() {
-		var product domain.Product
-		var metadata sql.NullString
-		err := rows.Scan(
-			&product.ID,
-			&product.CategoryID,
-			&product.Slug,
-			&product.Name,
-			&product.Description,
-			&product.PriceCoins,
-			&metadata,
-			&product.IsActive,
-			&product.CreatedAt,
-			&product.UpdatedAt,
-		)
+		product, err := scanProduct(rows)
 		if err != nil {
 			log.WithError(err).Error("Failed to scan product row")
-			return nil, err
+			return nil, 0, wrapErr("scan product row", err)
 		}
 
-		if metadata.Valid {
-			product.Metadata = metadata.String
-		}
+		products = append(products, *product)
+	}
 
-		products = append(products, product)
+	if err := rows.Err(); err != nil {
+		return nil, 0, wrapErr("iterate product rows", err)
 	}
 
-	return products, rows.Err()
+	return products, total, nil
 }
 
 func (r *postgresProductRepository) GetByID(ctx context.Context, id string) (*domain.Product, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	defer timing.Record(ctx, "db_product_get_by_id", time.Now())
 
-	var product domain.Product
-	var metadata sql.NullString
-	query := `SELECT id, category_id, slug, name, description, price_coins, metadata, is_active, created_at, updated_at 
-	          FROM products 
+	query := `SELECT ` + productColumns + `
+	          FROM products
 	          WHERE id = $1`
 
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&product.ID,
-		&product.CategoryID,
-		&product.Slug,
-		&product.Name,
-		&product.Description,
-		&product.PriceCoins,
-		&metadata,
-		&product.IsActive,
-		&product.CreatedAt,
-		&product.UpdatedAt,
-	)
+	product, err := scanProduct(r.db.QueryRowContext(ctx, query, id))
 
 	if err == sql.ErrNoRows {
 		return nil, domain.ErrProductNotFound
 	}
 	if err != nil {
 		log.WithError(err).WithField("product_id", id).Error("Failed to get product by ID")
-		return nil, err
-	}
-
-	if metadata.Valid {
-		product.Metadata = metadata.String
+		return nil, wrapErr("get product by id", err)
 	}
 
-	return &product, nil
+	return product, nil
 }
 
 func (r *postgresProductRepository) GetBySlug(ctx context.Context, slug string) (*domain.Product, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	defer timing.Record(ctx, "db_product_get_by_slug", time.Now())
 
-	var product domain.Product
-	var metadata sql.NullString
-	query := `SELECT id, category_id, slug, name, description, price_coins, metadata, is_active, created_at, updated_at 
-	          FROM products 
+	query := `SELECT ` + productColumns + `
+	          FROM products
 	          WHERE slug = $1`
 
-	err := r.db.QueryRowContext(ctx, query, slug).Scan(
-		&product.ID,
-		&product.CategoryID,
-		&product.Slug,
-		&product.Name,
-		&product.Description,
-		&product.PriceCoins,
-		&metadata,
-		&product.IsActive,
-		&product.CreatedAt,
-		&product.UpdatedAt,
-	)
+	product, err := scanProduct(r.db.QueryRowContext(ctx, query, slug))
 
 	if err == sql.ErrNoRows {
 		return nil, domain.ErrProductNotFound
 	}
 	if err != nil {
 		log.WithError(err).WithField("slug", slug).Error("Failed to get product by slug")
-		return nil, err
+		return nil, wrapErr("get product by slug", err)
 	}
 
-	if metadata.Valid {
-		product.Metadata = metadata.String
-	}
-
-	return &product, nil
+	return product, nil
 }
 
-func (r *postgresProductRepository) Create(ctx context.Context, req domain.CreateProductRequest) (*domain.Product, error) {
+// Create inserts a product. When maxPerCategory is positive, a category that
+// already holds that many products is refused with a *domain.CategoryFullError.
+func (r *postgresProductRepository) Create(ctx context.Context, req domain.CreateProductRequest, maxPerCategory int) (*domain.Product, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	defer timing.Record(ctx, "db_product_create", time.Now())
 
 	log.WithFields(log.Fields{
 		"slug":        req.Slug,
@@ -170,21 +193,43 @@ func (r *postgresProductRepository) Create(ctx context.Context, req domain.Creat
 		"category_id": req.CategoryID,
 	}).Info("Creating new product")
 
-	query := `INSERT INTO products (category_id, slug, name, description, price_coins, metadata, is_active)
-	          VALUES ($1, $2, $3, $4, $5, $6, $7)
-	          RETURNING id, category_id, slug, name, description, price_coins, metadata, is_active, created_at, updated_at`
+	query := `INSERT INTO products (id, category_id, slug, name, description, price_coins, metadata, is_active, stock)
+	          VALUES (COALESCE(NULLIF($1, '')::uuid, gen_random_uuid()), $2, $3, $4, $5, $6, $7, $8, $9)
+	          RETURNING ` + productColumns
 
-	var product domain.Product
-	var metadata sql.NullString
-	
 	var metadataValue interface{}
 	if req.Metadata != "" {
 		metadataValue = req.Metadata
 	} else {
 		metadataValue = nil
 	}
-	
-	err := r.db.QueryRowContext(ctx, query,
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, wrapErr("begin create product", err)
+	}
+	defer tx.Rollback()
+
+	// An active reservation by someone else blocks the slug; the owner's own
+	// reservation is consumed by the create.
+	var reservedBy string
+	err = tx.QueryRowContext(ctx,
+		`SELECT owner FROM slug_reservations WHERE slug = $1 AND expires_at > NOW() FOR UPDATE`,
+		req.Slug,
+	).Scan(&reservedBy)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, wrapErr("check slug reservation", err)
+	}
+	if err == nil && reservedBy != req.Owner {
+		return nil, domain.ErrSlugReserved
+	}
+
+	if err := checkCategoryCapacity(ctx, tx, req.CategoryID, maxPerCategory); err != nil {
+		return nil, err
+	}
+
+	product, err := scanProduct(tx.QueryRowContext(ctx, query,
+		req.ID,
 		req.CategoryID,
 		req.Slug,
 		req.Name,
@@ -192,38 +237,38 @@ func (r *postgresProductRepository) Create(ctx context.Context, req domain.Creat
 		req.PriceCoins,
 		metadataValue,
 		req.IsActive,
-	).Scan(
-		&product.ID,
-		&product.CategoryID,
-		&product.Slug,
-		&product.Name,
-		&product.Description,
-		&product.PriceCoins,
-		&metadata,
-		&product.IsActive,
-		&product.CreatedAt,
-		&product.UpdatedAt,
-	)
+		req.Stock,
+	))
 
+	if isUniqueViolation(err) {
+		return nil, domain.ErrProductSlugExists
+	}
 	if err != nil {
 		log.WithError(err).WithFields(log.Fields{
 			"slug":        req.Slug,
 			"name":        req.Name,
 			"category_id": req.CategoryID,
 		}).Error("Failed to create product")
-		return nil, err
+		return nil, wrapErr("create product", err)
 	}
 
-	if metadata.Valid {
-		product.Metadata = metadata.String
+	if _, err := tx.ExecContext(ctx, `DELETE FROM slug_reservations WHERE slug = $1`, req.Slug); err != nil {
+		return nil, wrapErr("release slug reservation", err)
 	}
 
-	return &product, nil
+	if err := tx.Commit(); err != nil {
+		return nil, wrapErr("commit create product", err)
+	}
+
+	return product, nil
 }
 
-func (r *postgresProductRepository) Update(ctx context.Context, id string, req domain.UpdateProductRequest) (*domain.Product, error) {
+// Update changes the given fields of a product. Moving it to another category
+// is subject to the same maxPerCategory cap as Create.
+func (r *postgresProductRepository) Update(ctx context.Context, id string, req domain.UpdateProductRequest, maxPerCategory int) (*domain.Product, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	defer timing.Record(ctx, "db_product_update", time.Now())
 
 	setParts := []string{}
 	args := []interface{}{}
@@ -259,53 +304,127 @@ func (r *postgresProductRepository) Update(ctx context.Context, id string, req d
 		args = append(args, *req.IsActive)
 		argPos++
 	}
+	if req.Stock != nil {
+		setParts = append(setParts, fmt.Sprintf("stock = $%d", argPos))
+		args = append(args, *req.Stock)
+		argPos++
+	}
 
 	if len(setParts) == 0 {
 		return r.GetByID(ctx, id)
 	}
 
 	setParts = append(setParts, "updated_at = NOW()")
+	where := fmt.Sprintf("id = $%d", argPos)
 	args = append(args, id)
+	argPos++
+	if req.IfUnmodifiedSince != nil {
+		where += fmt.Sprintf(" AND date_trunc('second', updated_at) <= $%d", argPos)
+		args = append(args, req.IfUnmodifiedSince.UTC())
+	}
 
 	query := fmt.Sprintf(`UPDATE products 
 	                      SET %s 
-	                      WHERE id = $%d 
-	                      RETURNING id, category_id, slug, name, description, price_coins, metadata, is_active, created_at, updated_at`,
-		strings.Join(setParts, ", "), argPos)
+	                      WHERE %s 
+	                      RETURNING `+productColumns,
+		strings.Join(setParts, ", "), where)
 
-	var product domain.Product
-	var metadata sql.NullString
-	err := r.db.QueryRowContext(ctx, query, args...).Scan(
-		&product.ID,
-		&product.CategoryID,
-		&product.Slug,
-		&product.Name,
-		&product.Description,
-		&product.PriceCoins,
-		&metadata,
-		&product.IsActive,
-		&product.CreatedAt,
-		&product.UpdatedAt,
-	)
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, wrapErr("begin update product", err)
+	}
+	defer tx.Rollback()
+
+	if req.CategoryID != nil {
+		var moving bool
+		err := tx.QueryRowContext(ctx,
+			`SELECT category_id <> $2 FROM products WHERE id = $1`, id, *req.CategoryID,
+		).Scan(&moving)
+		if err == sql.ErrNoRows {
+			return nil, domain.ErrProductNotFound
+		}
+		if err != nil {
+			return nil, wrapErr("check product category", err)
+		}
+		if moving {
+			if err := checkCategoryCapacity(ctx, tx, *req.CategoryID, maxPerCategory); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	product, err := scanProduct(tx.QueryRowContext(ctx, query, args...))
 
+	if err == sql.ErrNoRows && req.IfUnmodifiedSince != nil {
+		return nil, modifiedSince(ctx, tx, "products", id, domain.ErrProductNotFound)
+	}
 	if err == sql.ErrNoRows {
 		return nil, domain.ErrProductNotFound
 	}
 	if err != nil {
 		log.WithError(err).WithField("product_id", id).Error("Failed to update product")
-		return nil, err
+		return nil, wrapErr("update product", err)
 	}
 
-	if metadata.Valid {
-		product.Metadata = metadata.String
+	if err := tx.Commit(); err != nil {
+		return nil, wrapErr("commit update product", err)
 	}
 
-	return &product, nil
+	return product, nil
+}
+
+// modifiedSince explains why a conditional update of id in table matched no
+// row: either the row is gone (notFound) or it changed after the caller's
+// If-Unmodified-Since time, reported with its current updated_at.
+func modifiedSince(ctx context.Context, tx *sql.Tx, table, id string, notFound error) error {
+	var updatedAt time.Time
+	err := tx.QueryRowContext(ctx, `SELECT updated_at FROM `+table+` WHERE id = $1`, id).Scan(&updatedAt)
+	if err == sql.ErrNoRows {
+		return notFound
+	}
+	if err != nil {
+		return wrapErr("check "+table+" updated_at", err)
+	}
+	return &domain.ModifiedSinceError{UpdatedAt: updatedAt}
+}
+
+// checkCategoryCapacity refuses to add a product to a category that already
+// holds maxPerCategory products. It locks the category row until tx ends, so
+// parallel writers into the same category are counted one at a time. A
+// missing category is left for the insert's foreign key to report.
+func checkCategoryCapacity(ctx context.Context, tx *sql.Tx, categoryID string, maxPerCategory int) error {
+	if maxPerCategory <= 0 {
+		return nil
+	}
+
+	var id string
+	err := tx.QueryRowContext(ctx, `SELECT id FROM product_categories WHERE id = $1 FOR UPDATE`, categoryID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return wrapErr("lock category", err)
+	}
+
+	// Counted in a statement of its own: one that waited for the lock sees
+	// the products its predecessor committed, where a count in the locking
+	// statement would still see the snapshot from before the wait
+	var count int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM products WHERE category_id = $1`, categoryID).Scan(&count)
+	if err != nil {
+		return wrapErr("count category products", err)
+	}
+
+	if count >= maxPerCategory {
+		return &domain.CategoryFullError{MaxProducts: maxPerCategory}
+	}
+	return nil
 }
 
 func (r *postgresProductRepository) Delete(ctx context.Context, id string) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	defer timing.Record(ctx, "db_product_delete", time.Now())
 
 	log.WithField("product_id", id).Info("Deleting product")
 
@@ -313,12 +432,12 @@ func (r *postgresProductRepository) Delete(ctx context.Context, id string) error
 	result, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
 		log.WithError(err).WithField("product_id", id).Error("Failed to delete product")
-		return err
+		return wrapErr("delete product", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return err
+		return wrapErr("delete product rows affected", err)
 	}
 
 	if rowsAffected == 0 {
@@ -326,4 +445,314 @@ func (r *postgresProductRepository) Delete(ctx context.Context, id string) error
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// UpdateCategoryPrices reprices every product in a category in one transaction,
+// clamping the result to the valid price range, and records each changed price
+// in product_price_history. It returns the number of products whose price changed.
+func (r *postgresProductRepository) UpdateCategoryPrices(ctx context.Context, categoryID string, req domain.BulkPriceUpdateRequest) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_product_update_category_prices", time.Now())
+
+	var priceExpr, reason string
+	var value interface{}
+	if req.Percent != nil {
+		priceExpr = "ROUND(price_coins * (100 + $2::numeric) / 100)"
+		reason = "bulk_percent"
+		value = *req.Percent
+	} else {
+		priceExpr = "$2::bigint"
+		reason = "bulk_set"
+		value = *req.SetCoins
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, wrapErr("begin category price update", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM product_categories WHERE id = $1)`, categoryID).Scan(&exists)
+	if err != nil {
+		return 0, wrapErr("check category exists", err)
+	}
+	if !exists {
+		return 0, domain.ErrCategoryNotFound
+	}
+
+	query := fmt.Sprintf(`
+		WITH repriced AS (
+			SELECT id, price_coins AS old_price,
+				LEAST(GREATEST(%s, $3), $4)::bigint AS new_price
+			FROM products
+			WHERE category_id = $1
+			FOR UPDATE
+		), changed AS (
+			UPDATE products p
+			SET price_coins = repriced.new_price, updated_at = NOW()
+			FROM repriced
+			WHERE p.id = repriced.id AND repriced.old_price <> repriced.new_price
+			RETURNING p.id, repriced.old_price, repriced.new_price
+		)
+		INSERT INTO product_price_history (product_id, old_price_coins, new_price_coins, reason)
+		SELECT id, old_price, new_price, $5 FROM changed`, priceExpr)
+
+	result, err := tx.ExecContext(ctx, query, categoryID, value, domain.MinProductPrice, domain.MaxProductPrice, reason)
+	if err != nil {
+		log.WithError(err).WithField("category_id", categoryID).Error("Failed to update category prices")
+		return 0, wrapErr("update category prices", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return 0, wrapErr("update category prices rows affected", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, wrapErr("commit category price update", err)
+	}
+
+	return updated, nil
+}
+
+// ReserveSlug claims slug for owner until expiresAt. An owner may extend its
+// own reservation; an unexpired reservation held by another owner returns
+// domain.ErrSlugReserved.
+func (r *postgresProductRepository) ReserveSlug(ctx context.Context, slug, owner string, expiresAt time.Time) (*domain.SlugReservation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_product_reserve_slug", time.Now())
+
+	query := `INSERT INTO slug_reservations (slug, owner, expires_at)
+	          VALUES ($1, $2, $3)
+	          ON CONFLICT (slug) DO UPDATE
+	          SET owner = EXCLUDED.owner,
+	              expires_at = EXCLUDED.expires_at,
+	              created_at = CASE WHEN slug_reservations.owner = EXCLUDED.owner
+	                                THEN slug_reservations.created_at ELSE NOW() END
+	          WHERE slug_reservations.owner = EXCLUDED.owner
+	             OR slug_reservations.expires_at <= NOW()
+	          RETURNING slug, owner, expires_at, created_at`
+
+	var reservation domain.SlugReservation
+	err := r.db.QueryRowContext(ctx, query, slug, owner, expiresAt).Scan(
+		&reservation.Slug,
+		&reservation.Owner,
+		&reservation.ExpiresAt,
+		&reservation.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrSlugReserved
+	}
+	if err != nil {
+		log.WithError(err).WithField("slug", slug).Error("Failed to reserve slug")
+		return nil, wrapErr("reserve slug", err)
+	}
+
+	return &reservation, nil
+}
+
+// ReleaseSlug drops owner's active reservation of slug.
+func (r *postgresProductRepository) ReleaseSlug(ctx context.Context, slug, owner string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_product_release_slug", time.Now())
+
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM slug_reservations WHERE slug = $1 AND owner = $2 AND expires_at > NOW()`,
+		slug, owner,
+	)
+	if err != nil {
+		log.WithError(err).WithField("slug", slug).Error("Failed to release slug")
+		return wrapErr("release slug", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return wrapErr("release slug rows affected", err)
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrSlugReservationMissing
+	}
+
+	return nil
+}
+
+// ListAll returns a page of products across all categories, inactive ones
+// included unless q.OnlyActive is set, along with the total matching count.
+// q.SortBy must already be validated against the sort whitelist.
+func (r *postgresProductRepository) ListAll(ctx context.Context, q domain.AdminProductQuery) ([]domain.Product, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_product_list_all", time.Now())
+
+	where := "1=1"
+	if q.OnlyActive {
+		where = "is_active = true"
+	}
+
+	var total int64
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM products WHERE `+where).Scan(&total); err != nil {
+		return nil, 0, wrapErr("count all products", err)
+	}
+
+	direction := "ASC"
+	if q.Descending {
+		direction = "DESC"
+	}
+	query := fmt.Sprintf(`SELECT `+productColumns+`
+		FROM products
+		WHERE %s
+		ORDER BY %s %s NULLS LAST, id %s
+		LIMIT $1 OFFSET $2`, where, q.SortBy, direction, direction)
+
+	rows, err := r.db.QueryContext(ctx, query, q.Limit, q.Offset)
+	if err != nil {
+		return nil, 0, wrapErr("list all products", err)
+	}
+	defer rows.Close()
+
+	products := []domain.Product{}
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			return nil, 0, wrapErr("scan product row", err)
+		}
+		products = append(products, *product)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, wrapErr("iterate product rows", err)
+	}
+
+	return products, total, nil
+}
+
+// GetProductCategory returns the category of the product, joined through
+// its category_id, or nil if no such category exists.
+func (r *postgresProductRepository) GetProductCategory(ctx context.Context, productID string) (*domain.ProductCategory, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_product_get_product_category", time.Now())
+
+	query := `SELECT ` + qualifyColumns(categoryColumns, "c") + `
+	          FROM products p
+	          JOIN product_categories c ON c.id = p.category_id
+	          WHERE p.id = $1`
+
+	category, err := scanCategory(r.db.QueryRowContext(ctx, query, productID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, wrapErr("get product category", err)
+	}
+	return category, nil
+}
+
+// GetCategoryMetadataSchema returns the metadata schema of a category, or nil
+// if it has none.
+func (r *postgresProductRepository) GetCategoryMetadataSchema(ctx context.Context, categoryID string) (json.RawMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_product_get_category_metadata_schema", time.Now())
+
+	var schema sql.NullString
+	err := r.db.QueryRowContext(ctx,
+		`SELECT metadata_schema FROM product_categories WHERE id = $1`, categoryID,
+	).Scan(&schema)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrCategoryNotFound
+	}
+	if err != nil {
+		return nil, wrapErr("get category metadata schema", err)
+	}
+
+	if !schema.Valid {
+		return nil, nil
+	}
+	return json.RawMessage(schema.String), nil
+}
+
+// IsCategoryActive reports whether the category is active.
+func (r *postgresProductRepository) IsCategoryActive(ctx context.Context, categoryID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_product_is_category_active", time.Now())
+
+	var active bool
+	err := r.db.QueryRowContext(ctx,
+		`SELECT is_active FROM product_categories WHERE id = $1`, categoryID,
+	).Scan(&active)
+	if err == sql.ErrNoRows {
+		return false, domain.ErrCategoryNotFound
+	}
+	if err != nil {
+		return false, wrapErr("get category is_active", err)
+	}
+	return active, nil
+}
+
+// AddViewCounts adds the accumulated views to each product's view_count and
+// to its views of the current UTC day, for stats over a range of days.
+// Products that no longer exist are skipped.
+func (r *postgresProductRepository) AddViewCounts(ctx context.Context, counts map[string]int64) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_product_add_view_counts", time.Now())
+
+	ids := make([]string, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	views := make([]int64, len(ids))
+	for i, id := range ids {
+		views[i] = counts[id]
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapErr("begin add view counts", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the rows in ID order first so flushes from other replicas can't deadlock
+	if _, err := tx.ExecContext(ctx,
+		`SELECT id FROM products WHERE id = ANY($1::uuid[]) ORDER BY id FOR NO KEY UPDATE`,
+		pq.Array(ids),
+	); err != nil {
+		return wrapErr("lock products for view counts", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE products p
+		SET view_count = p.view_count + v.views
+		FROM unnest($1::uuid[], $2::bigint[]) AS v(id, views)
+		WHERE p.id = v.id`,
+		pq.Array(ids), pq.Array(views),
+	)
+	if err != nil {
+		return wrapErr("add product view counts", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO product_view_days (product_id, day, views)
+		SELECT p.id, (NOW() AT TIME ZONE 'UTC')::date, v.views
+		FROM unnest($1::uuid[], $2::bigint[]) AS v(id, views)
+		JOIN products p ON p.id = v.id
+		ON CONFLICT (product_id, day) DO UPDATE SET
+			views = product_view_days.views + EXCLUDED.views`,
+		pq.Array(ids), pq.Array(views),
+	)
+	if err != nil {
+		return wrapErr("add product view days", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return wrapErr("commit add view counts", err)
+	}
+	return nil
+}
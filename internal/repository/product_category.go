@@ -3,12 +3,14 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"strings"
 	"time"
 	"user-service/internal/domain"
-	"strings"
+	"user-service/internal/timing"
 
+	"github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
-
 )
 
 type postgresProductCategoryRepository struct {
@@ -19,152 +21,315 @@ func NewPostgresProductCategoryRepository(db *sql.DB) *postgresProductCategoryRe
 	return &postgresProductCategoryRepository{db: db}
 }
 
+// categoryColumns lists the product_categories columns in the order scanCategory expects them.
+const categoryColumns = `id, slug, name, description, position, is_active, metadata_schema, created_at, updated_at`
+
+// scanCategory reads a row selected with categoryColumns into a
+// domain.ProductCategory. A NULL description is read as "".
+func scanCategory(row interface{ Scan(...interface{}) error }) (*domain.ProductCategory, error) {
+	var cat domain.ProductCategory
+	var description, metadataSchema sql.NullString
+	err := row.Scan(
+		&cat.ID,
+		&cat.Slug,
+		&cat.Name,
+		&description,
+		&cat.Position,
+		&cat.IsActive,
+		&metadataSchema,
+		&cat.CreatedAt,
+		&cat.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	cat.Description = description.String
+	if metadataSchema.Valid {
+		cat.MetadataSchema = json.RawMessage(metadataSchema.String)
+	}
+	return &cat, nil
+}
+
 func (r *postgresProductCategoryRepository) ListCategories(ctx context.Context, onlyActive bool) ([]domain.ProductCategory, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	defer timing.Record(ctx, "db_category_list_categories", time.Now())
 
 	var query string
 	if onlyActive {
-		query = `SELECT id, slug, name, description, position, is_active, created_at, updated_at 
+		query = `SELECT ` + categoryColumns + `
 		         FROM product_categories 
 		         WHERE is_active = true 
-		         ORDER BY position ASC, created_at ASC`
+		         ORDER BY position ASC, created_at ASC, id ASC`
 	} else {
-		query = `SELECT id, slug, name, description, position, is_active, created_at, updated_at 
+		query = `SELECT ` + categoryColumns + `
 		         FROM product_categories 
-		         ORDER BY position ASC, created_at ASC`
+		         ORDER BY position ASC, created_at ASC, id ASC`
 	}
 
 	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
-		return nil, err
+		return nil, wrapErr("list categories", err)
 	}
 	defer rows.Close()
 
-	var categories []domain.ProductCategory
+	categories := []domain.ProductCategory{}
 	for rows.Next() {
-		var cat domain.ProductCategory
-		err := rows.Scan(
-			&cat.ID,
-			&cat.Slug,
-			&cat.Name,
-			&cat.Description,
-			&cat.Position,
-			&cat.IsActive,
-			&cat.CreatedAt,
-			&cat.UpdatedAt,
-		)
+		cat, err := scanCategory(rows)
 		if err != nil {
-			return nil, err
+			return nil, wrapErr("scan category row", err)
 		}
-		categories = append(categories, cat)
+		categories = append(categories, *cat)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("iterate category rows", err)
 	}
 
-	return categories, rows.Err()
+	return categories, nil
 }
 
 func (r *postgresProductCategoryRepository) GetByID(ctx context.Context, id string) (*domain.ProductCategory, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	defer timing.Record(ctx, "db_category_get_by_id", time.Now())
 
-	var cat domain.ProductCategory
-	query := `SELECT id, slug, name, description, position, is_active, created_at, updated_at 
+	query := `SELECT ` + categoryColumns + `
 	          FROM product_categories 
 	          WHERE id = $1`
 
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&cat.ID,
-		&cat.Slug,
-		&cat.Name,
-		&cat.Description,
-		&cat.Position,
-		&cat.IsActive,
-		&cat.CreatedAt,
-		&cat.UpdatedAt,
-	)
+	cat, err := scanCategory(r.db.QueryRowContext(ctx, query, id))
 
 	if err == sql.ErrNoRows {
 		return nil, domain.ErrCategoryNotFound
 	}
 	if err != nil {
 		log.WithError(err).WithField("category_id", id).Error("Failed to get product category by ID")
-		return nil, err
+		return nil, wrapErr("get category by id", err)
 	}
 
-	return &cat, nil
+	return cat, nil
 }
 
 func (r *postgresProductCategoryRepository) GetBySlug(ctx context.Context, slug string) (*domain.ProductCategory, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	defer timing.Record(ctx, "db_category_get_by_slug", time.Now())
 
-	var cat domain.ProductCategory
-	query := `SELECT id, slug, name, description, position, is_active, created_at, updated_at 
+	query := `SELECT ` + categoryColumns + `
 	          FROM product_categories 
 	          WHERE slug = $1`
 
-	err := r.db.QueryRowContext(ctx, query, slug).Scan(
-		&cat.ID,
-		&cat.Slug,
-		&cat.Name,
-		&cat.Description,
-		&cat.Position,
-		&cat.IsActive,
-		&cat.CreatedAt,
-		&cat.UpdatedAt,
-	)
+	cat, err := scanCategory(r.db.QueryRowContext(ctx, query, slug))
 
 	if err == sql.ErrNoRows {
 		return nil, domain.ErrCategoryNotFound
 	}
 	if err != nil {
 		log.WithError(err).WithField("slug", slug).Error("Failed to get product category by slug")
-		return nil, err
+		return nil, wrapErr("get category by slug", err)
 	}
 
-	return &cat, nil
+	return cat, nil
+}
+
+// GetBySlugs returns the categories whose slug is in slugs, in display order.
+// Slugs with no category are left out.
+func (r *postgresProductCategoryRepository) GetBySlugs(ctx context.Context, slugs []string) ([]domain.ProductCategory, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_category_get_by_slugs", time.Now())
+
+	query := `SELECT ` + categoryColumns + `
+	          FROM product_categories 
+	          WHERE slug = ANY($1)
+	          ORDER BY position ASC, created_at ASC, id ASC`
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(slugs))
+	if err != nil {
+		return nil, wrapErr("get categories by slugs", err)
+	}
+	defer rows.Close()
+
+	var categories []domain.ProductCategory
+	for rows.Next() {
+		cat, err := scanCategory(rows)
+		if err != nil {
+			return nil, wrapErr("scan category row", err)
+		}
+		categories = append(categories, *cat)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("iterate category rows", err)
+	}
+
+	return categories, nil
 }
 
 func (r *postgresProductCategoryRepository) Create(ctx context.Context, req domain.CreateCategoryRequest) (*domain.ProductCategory, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	defer timing.Record(ctx, "db_category_create", time.Now())
 
-	query := `INSERT INTO product_categories (slug, name, description, position, is_active)
-	          VALUES ($1, $2, $3, $4, $5)
-	          RETURNING id, slug, name, description, position, is_active, created_at, updated_at`
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, wrapErr("begin create category", err)
+	}
+	defer tx.Rollback()
 
-	var cat domain.ProductCategory
-	err := r.db.QueryRowContext(ctx, query,
+	if err := claimPosition(ctx, tx, req.Position, "", req.OnConflict); err != nil {
+		return nil, err
+	}
+
+	query := `INSERT INTO product_categories (id, slug, name, description, position, is_active, metadata_schema)
+	          VALUES (COALESCE(NULLIF($1, '')::uuid, gen_random_uuid()), $2, $3, $4, $5, $6, $7)
+	          RETURNING ` + categoryColumns
+
+	cat, err := scanCategory(tx.QueryRowContext(ctx, query,
+		req.ID,
 		req.Slug,
 		req.Name,
 		req.Description,
 		req.Position,
 		req.IsActive,
-	).Scan(
-		&cat.ID,
-		&cat.Slug,
-		&cat.Name,
-		&cat.Description,
-		&cat.Position,
-		&cat.IsActive,
-		&cat.CreatedAt,
-		&cat.UpdatedAt,
-	)
+		nullableJSON(req.MetadataSchema),
+	))
 
 	if err != nil {
 		log.WithError(err).WithFields(log.Fields{
 			"slug": req.Slug,
 			"name": req.Name,
 		}).Error("Failed to create product category")
-		return nil, err
+		return nil, wrapErr("create category", err)
 	}
 
-	return &cat, nil
+	if err := tx.Commit(); err != nil {
+		return nil, wrapErr("commit create category", err)
+	}
+
+	return cat, nil
+}
+
+// Upsert creates the category with req.Slug or, if one exists, replaces its
+// mutable fields with those in req. It reports whether the category was
+// created. The lookup and the write run under the position lock that every
+// category create takes, so two upserts of a new slug can't both insert.
+func (r *postgresProductCategoryRepository) Upsert(ctx context.Context, req domain.CreateCategoryRequest) (*domain.ProductCategory, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_category_upsert", time.Now())
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, wrapErr("begin upsert category", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockCategoryPositions(ctx, tx); err != nil {
+		return nil, false, err
+	}
+
+	var existingID string
+	err = tx.QueryRowContext(ctx, `SELECT id FROM product_categories WHERE slug = $1`, req.Slug).Scan(&existingID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, false, wrapErr("find category by slug", err)
+	}
+	created := existingID == ""
+
+	if err := claimPosition(ctx, tx, req.Position, existingID, req.OnConflict); err != nil {
+		return nil, false, err
+	}
+
+	var query string
+	args := []interface{}{
+		req.Name,
+		req.Description,
+		req.Position,
+		req.IsActive,
+		nullableJSON(req.MetadataSchema),
+	}
+	if created {
+		query = `INSERT INTO product_categories (name, description, position, is_active, metadata_schema, slug, id)
+		         VALUES ($1, $2, $3, $4, $5, $6, COALESCE(NULLIF($7, '')::uuid, gen_random_uuid()))
+		         RETURNING ` + categoryColumns
+		args = append(args, req.Slug, req.ID)
+	} else {
+		query = `UPDATE product_categories
+		         SET name = $1, description = $2, position = $3, is_active = $4, metadata_schema = $5, updated_at = NOW()
+		         WHERE id = $6
+		         RETURNING ` + categoryColumns
+		args = append(args, existingID)
+	}
+
+	cat, err := scanCategory(tx.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		log.WithError(err).WithField("slug", req.Slug).Error("Failed to upsert product category")
+		return nil, false, wrapErr("upsert category", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, wrapErr("commit upsert category", err)
+	}
+
+	return cat, created, nil
+}
+
+// lockCategoryPositions takes the table lock that serializes category
+// position writers until tx ends.
+func lockCategoryPositions(ctx context.Context, tx *sql.Tx) error {
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE product_categories IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return wrapErr("lock category positions", err)
+	}
+	return nil
+}
+
+// claimPosition makes position free for the category being written (excludeID
+// on update, "" on create). If another category holds it, the write is either
+// refused or every category at or after it moves down by one, depending on
+// onConflict. Position writers are serialized by a table lock that is held
+// until tx ends, so two concurrent writes cannot both see a free slot.
+func claimPosition(ctx context.Context, tx *sql.Tx, position int, excludeID string, onConflict domain.PositionConflict) error {
+	if err := lockCategoryPositions(ctx, tx); err != nil {
+		return err
+	}
+
+	var taken bool
+	err := tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM product_categories WHERE position = $1 AND id::text <> $2)`,
+		position, excludeID).Scan(&taken)
+	if err != nil {
+		return wrapErr("check category position", err)
+	}
+	if !taken {
+		return nil
+	}
+
+	if onConflict != domain.PositionConflictShift {
+		return domain.ErrCategoryPositionTaken
+	}
+
+	shifted, err := tx.ExecContext(ctx,
+		`UPDATE product_categories SET position = position + 1, updated_at = NOW()
+		 WHERE position >= $1 AND id::text <> $2`,
+		position, excludeID)
+	if err != nil {
+		return wrapErr("shift category positions", err)
+	}
+	if n, err := shifted.RowsAffected(); err == nil {
+		log.WithFields(log.Fields{
+			"position": position,
+			"shifted":  n,
+		}).Info("Shifted product categories to free a position")
+	}
+	return nil
 }
 
 func (r *postgresProductCategoryRepository) Update(ctx context.Context, id string, req domain.UpdateCategoryRequest) (*domain.ProductCategory, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	defer timing.Record(ctx, "db_category_update", time.Now())
 
 	setParts := []string{}
 	args := []interface{}{}
@@ -190,62 +355,186 @@ func (r *postgresProductCategoryRepository) Update(ctx context.Context, id strin
 		args = append(args, *req.IsActive)
 		argPos++
 	}
+	if len(req.MetadataSchema) > 0 {
+		setParts = append(setParts, "metadata_schema = $"+string(rune('0'+argPos)))
+		args = append(args, nullableJSON(req.MetadataSchema))
+		argPos++
+	}
 
 	if len(setParts) == 0 {
 		return r.GetByID(ctx, id)
 	}
 
 	setParts = append(setParts, "updated_at = NOW()")
+	where := "id = $" + string(rune('0'+argPos))
 	args = append(args, id)
+	argPos++
+	if req.IfUnmodifiedSince != nil {
+		where += " AND date_trunc('second', updated_at) <= $" + string(rune('0'+argPos))
+		args = append(args, req.IfUnmodifiedSince.UTC())
+	}
 
 	query := `UPDATE product_categories 
 	          SET ` + strings.Join(setParts, ", ") + `
-	          WHERE id = $` + string(rune('0'+argPos)) + `
-	          RETURNING id, slug, name, description, position, is_active, created_at, updated_at`
+	          WHERE ` + where + `
+	          RETURNING ` + categoryColumns
 
-	var cat domain.ProductCategory
-	err := r.db.QueryRowContext(ctx, query, args...).Scan(
-		&cat.ID,
-		&cat.Slug,
-		&cat.Name,
-		&cat.Description,
-		&cat.Position,
-		&cat.IsActive,
-		&cat.CreatedAt,
-		&cat.UpdatedAt,
-	)
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, wrapErr("begin update category", err)
+	}
+	defer tx.Rollback()
+
+	if req.Position != nil {
+		if err := claimPosition(ctx, tx, *req.Position, id, req.OnConflict); err != nil {
+			return nil, err
+		}
+	}
+
+	cat, err := scanCategory(tx.QueryRowContext(ctx, query, args...))
 
+	if err == sql.ErrNoRows && req.IfUnmodifiedSince != nil {
+		return nil, modifiedSince(ctx, tx, "product_categories", id, domain.ErrCategoryNotFound)
+	}
 	if err == sql.ErrNoRows {
 		return nil, domain.ErrCategoryNotFound
 	}
 	if err != nil {
 		log.WithError(err).WithField("category_id", id).Error("Failed to update product category")
-		return nil, err
+		return nil, wrapErr("update category", err)
 	}
 
-	return &cat, nil
+	if err := tx.Commit(); err != nil {
+		return nil, wrapErr("commit update category", err)
+	}
+
+	return cat, nil
+}
+
+// CompactPositions renumbers all categories 1..N in their current display
+// order, closing gaps and breaking ties by creation time. It returns how many
+// categories changed position.
+func (r *postgresProductCategoryRepository) CompactPositions(ctx context.Context) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_category_compact_positions", time.Now())
+
+	query := `UPDATE product_categories c
+	          SET position = ranked.rn, updated_at = NOW()
+	          FROM (
+	              SELECT id, ROW_NUMBER() OVER (ORDER BY position ASC, created_at ASC, id ASC) AS rn
+	              FROM product_categories
+	          ) ranked
+	          WHERE c.id = ranked.id AND c.position <> ranked.rn`
+
+	result, err := r.db.ExecContext(ctx, query)
+	if err != nil {
+		log.WithError(err).Error("Failed to compact product category positions")
+		return 0, wrapErr("compact category positions", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return 0, wrapErr("compact category positions rows affected", err)
+	}
+	return updated, nil
 }
 
-func (r *postgresProductCategoryRepository) Delete(ctx context.Context, id string) error {
+// Delete removes a category. When reassignTo is set, the category's products
+// are moved there first in the same transaction; otherwise a category that
+// still has products is refused with ErrCategoryHasProducts.
+func (r *postgresProductCategoryRepository) Delete(ctx context.Context, id string, reassignTo string) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	defer timing.Record(ctx, "db_category_delete", time.Now())
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapErr("begin delete category", err)
+	}
+	defer tx.Rollback()
+
+	if reassignTo != "" {
+		moved, err := tx.ExecContext(ctx,
+			`UPDATE products SET category_id = $1, updated_at = NOW() WHERE category_id = $2`,
+			reassignTo, id)
+		if err != nil {
+			return wrapErr("reassign category products", err)
+		}
+		if n, err := moved.RowsAffected(); err == nil && n > 0 {
+			log.WithFields(log.Fields{
+				"category_id": id,
+				"reassign_to": reassignTo,
+				"products":    n,
+			}).Info("Moved products out of deleted category")
+		}
+	}
 
 	query := `DELETE FROM product_categories WHERE id = $1`
-	result, err := r.db.ExecContext(ctx, query, id)
-	
+	result, err := tx.ExecContext(ctx, query, id)
+
+	if isForeignKeyViolation(err) {
+		return domain.ErrCategoryHasProducts
+	}
 	if err != nil {
 		log.WithError(err).WithField("category_id", id).Error("Failed to delete product category")
-		return err
+		return wrapErr("delete category", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return err
+		return wrapErr("delete category rows affected", err)
 	}
 
 	if rowsAffected == 0 {
 		return domain.ErrCategoryNotFound
 	}
 
+	if err := tx.Commit(); err != nil {
+		return wrapErr("commit delete category", err)
+	}
+
 	return nil
-}
\ No newline at end of file
+}
+
+func (r *postgresProductCategoryRepository) CountActiveProducts(ctx context.Context) (map[string]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_category_count_active_products", time.Now())
+
+	query := `SELECT c.id, COUNT(p.id)
+	          FROM product_categories c
+	          LEFT JOIN products p ON p.category_id = c.id AND p.is_active = true
+	          GROUP BY c.id`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		log.WithError(err).Error("Failed to count products per category")
+		return nil, wrapErr("count products per category", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var categoryID string
+		var count int64
+		if err := rows.Scan(&categoryID, &count); err != nil {
+			return nil, wrapErr("scan category product count", err)
+		}
+		counts[categoryID] = count
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("iterate category product counts", err)
+	}
+
+	return counts, nil
+}
+
+// nullableJSON stores an absent or null JSON document as SQL NULL.
+func nullableJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	return string(raw)
+}
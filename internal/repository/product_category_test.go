@@ -0,0 +1,295 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"user-service/internal/domain"
+	"user-service/internal/testutil/factory"
+)
+
+func TestCountActiveProductsIncludesEmptyCategories(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	categories := NewPostgresProductCategoryRepository(db)
+
+	stocked := createTestCategory(t, db)
+	onlyInactive := createTestCategory(t, db)
+	empty := createTestCategory(t, db, factory.InactiveCategory())
+	createTestProduct(t, db, factory.WithCategory(stocked))
+	createTestProduct(t, db, factory.WithCategory(stocked))
+	createTestProduct(t, db, factory.WithCategory(stocked), factory.InactiveProduct())
+	createTestProduct(t, db, factory.WithCategory(onlyInactive), factory.InactiveProduct())
+
+	counts, err := categories.CountActiveProducts(ctx)
+	if err != nil {
+		t.Fatalf("CountActiveProducts: %v", err)
+	}
+	want := map[string]int64{stocked: 2, onlyInactive: 0, empty: 0}
+	for id, n := range want {
+		got, ok := counts[id]
+		if !ok {
+			t.Errorf("category %s missing from the counts", id)
+		} else if got != n {
+			t.Errorf("category %s has %d active products, want %d", id, got, n)
+		}
+	}
+}
+
+func TestDeleteReassignsProductsToFallback(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	categories := NewPostgresProductCategoryRepository(db)
+
+	fallback := createTestCategory(t, db)
+	doomed := createTestCategory(t, db)
+	products := []string{
+		createTestProduct(t, db, factory.WithCategory(doomed)),
+		createTestProduct(t, db, factory.WithCategory(doomed), factory.InactiveProduct()),
+	}
+
+	// Without the fallback a category holding products stays
+	if err := categories.Delete(ctx, doomed, ""); !errors.Is(err, domain.ErrCategoryHasProducts) {
+		t.Fatalf("Delete without reassignment: got %v, want ErrCategoryHasProducts", err)
+	}
+
+	if err := categories.Delete(ctx, doomed, fallback); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := categories.GetByID(ctx, doomed); !errors.Is(err, domain.ErrCategoryNotFound) {
+		t.Errorf("deleted category: got %v, want ErrCategoryNotFound", err)
+	}
+	for _, id := range products {
+		var categoryID string
+		if err := db.QueryRow(`SELECT category_id FROM products WHERE id = $1`, id).Scan(&categoryID); err != nil {
+			t.Fatalf("read product: %v", err)
+		}
+		if categoryID != fallback {
+			t.Errorf("product %s in %s, want the fallback %s", id, categoryID, fallback)
+		}
+	}
+}
+
+// categoryOrder lists the categories as "label@position" in display order,
+// labelling each by the name it was given in labels.
+func categoryOrder(t *testing.T, db *sql.DB, labels map[string]string) string {
+	t.Helper()
+	rows, err := db.Query(`SELECT id, position FROM product_categories ORDER BY position, created_at, id`)
+	if err != nil {
+		t.Fatalf("list categories: %v", err)
+	}
+	defer rows.Close()
+	var order []string
+	for rows.Next() {
+		var id string
+		var position int
+		if err := rows.Scan(&id, &position); err != nil {
+			t.Fatalf("scan category: %v", err)
+		}
+		order = append(order, fmt.Sprintf("%s@%d", labels[id], position))
+	}
+	return strings.Join(order, " ")
+}
+
+func TestCategoryPositionConflicts(t *testing.T) {
+	tests := []struct {
+		name       string
+		position   int
+		onConflict domain.PositionConflict
+		wantErr    error
+		wantOrder  string
+	}{
+		{"shift at the head", 1, domain.PositionConflictShift, nil, "new@1 a@2 b@3 c@4"},
+		{"shift in the middle", 2, domain.PositionConflictShift, nil, "a@1 new@2 b@3 c@4"},
+		{"shift at the tail", 3, domain.PositionConflictShift, nil, "a@1 b@2 new@3 c@4"},
+		{"past the tail", 4, domain.PositionConflictShift, nil, "a@1 b@2 c@3 new@4"},
+		{"taken without shift", 2, domain.PositionConflictError, domain.ErrCategoryPositionTaken, "a@1 b@2 c@3"},
+		{"free without shift", 4, domain.PositionConflictError, nil, "a@1 b@2 c@3 new@4"},
+	}
+	for _, tt := range tests {
+		t.Run("create/"+tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			ctx := context.Background()
+			labels := map[string]string{}
+			for i, label := range []string{"a", "b", "c"} {
+				labels[createTestCategory(t, db, factory.WithPosition(i+1))] = label
+			}
+
+			category := factory.Category()
+			created, err := NewPostgresProductCategoryRepository(db).Create(ctx, domain.CreateCategoryRequest{
+				Slug: category.Slug, Name: category.Name, Position: tt.position, IsActive: true, OnConflict: tt.onConflict,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Create: got %v, want %v", err, tt.wantErr)
+			}
+			if created != nil {
+				labels[created.ID] = "new"
+			}
+			if got := categoryOrder(t, db, labels); got != tt.wantOrder {
+				t.Errorf("order %q, want %q", got, tt.wantOrder)
+			}
+		})
+	}
+
+	moves := []struct {
+		name      string
+		move      string
+		position  int
+		wantOrder string
+	}{
+		{"tail to head", "c", 1, "c@1 a@2 b@3"},
+		{"head to middle", "a", 2, "a@2 b@3 c@4"},
+		{"middle to tail", "b", 3, "a@1 b@3 c@4"},
+		{"onto itself", "b", 2, "a@1 b@2 c@3"},
+	}
+	for _, tt := range moves {
+		t.Run("update/"+tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			ctx := context.Background()
+			labels, ids := map[string]string{}, map[string]string{}
+			for i, label := range []string{"a", "b", "c"} {
+				id := createTestCategory(t, db, factory.WithPosition(i+1))
+				labels[id], ids[label] = label, id
+			}
+
+			position := tt.position
+			_, err := NewPostgresProductCategoryRepository(db).Update(ctx, ids[tt.move], domain.UpdateCategoryRequest{
+				Position: &position, OnConflict: domain.PositionConflictShift,
+			})
+			if err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+			if got := categoryOrder(t, db, labels); got != tt.wantOrder {
+				t.Errorf("order %q, want %q", got, tt.wantOrder)
+			}
+		})
+	}
+}
+
+func TestCompactPositionsResolvesDuplicates(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	categories := NewPostgresProductCategoryRepository(db)
+
+	// Written before collisions were checked: a shared position and gaps
+	labels := map[string]string{}
+	for _, c := range []struct {
+		label    string
+		position int
+	}{{"a", 1}, {"b", 1}, {"c", 5}, {"d", 9}, {"e", 9}} {
+		labels[createTestCategory(t, db, factory.WithPosition(c.position))] = c.label
+	}
+
+	changed, err := categories.CompactPositions(ctx)
+	if err != nil {
+		t.Fatalf("CompactPositions: %v", err)
+	}
+	// Only a keeps its position; ties keep their creation order
+	if changed != 4 {
+		t.Errorf("%d categories changed, want 4", changed)
+	}
+	if got, want := categoryOrder(t, db, labels), "a@1 b@2 c@3 d@4 e@5"; got != want {
+		t.Errorf("order %q, want %q", got, want)
+	}
+
+	changed, err = categories.CompactPositions(ctx)
+	if err != nil || changed != 0 {
+		t.Errorf("second CompactPositions changed %d: %v, want 0", changed, err)
+	}
+}
+
+func TestUpsertCreatesThenUpdates(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	categories := NewPostgresProductCategoryRepository(db)
+	req := domain.CreateCategoryRequest{
+		Slug:        "board-games",
+		Name:        "Board games",
+		Description: "Tabletop",
+		Position:    7,
+		IsActive:    true,
+		OnConflict:  domain.PositionConflictError,
+	}
+
+	first, created, err := categories.Upsert(ctx, req)
+	if err != nil || !created {
+		t.Fatalf("first Upsert: created %v, %v; want a new category", created, err)
+	}
+
+	// A re-run of provisioning with changed fields updates the same row
+	req.Name = "Tabletop games"
+	req.Description = "Board and card games"
+	req.Position = 8
+	req.IsActive = false
+	req.MetadataSchema = []byte(`{"type":"object"}`)
+	second, created, err := categories.Upsert(ctx, req)
+	if err != nil || created {
+		t.Fatalf("second Upsert: created %v, %v; want the existing category updated", created, err)
+	}
+	if second.ID != first.ID || second.Slug != req.Slug {
+		t.Errorf("second Upsert returned %s %s, want %s %s", second.ID, second.Slug, first.ID, req.Slug)
+	}
+	var schema bytes.Buffer
+	if err := json.Compact(&schema, second.MetadataSchema); err != nil || schema.String() != `{"type":"object"}` {
+		t.Errorf("second Upsert stored schema %s, want %s", second.MetadataSchema, req.MetadataSchema)
+	}
+	if second.Name != req.Name || second.Description != req.Description || second.Position != 8 || second.IsActive {
+		t.Errorf("second Upsert returned %+v, want the new fields", second)
+	}
+	if !second.CreatedAt.Equal(first.CreatedAt) || !second.UpdatedAt.After(first.UpdatedAt) {
+		t.Errorf("created %v then %v, updated %v then %v", first.CreatedAt, second.CreatedAt, first.UpdatedAt, second.UpdatedAt)
+	}
+
+	// Running it again with nothing changed is still an update, not a duplicate
+	if _, created, err := categories.Upsert(ctx, req); err != nil || created {
+		t.Errorf("third Upsert: created %v, %v", created, err)
+	}
+	var rows int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM product_categories WHERE slug = $1`, req.Slug).Scan(&rows); err != nil {
+		t.Fatalf("count categories: %v", err)
+	}
+	if rows != 1 {
+		t.Errorf("%d categories with slug %s, want 1", rows, req.Slug)
+	}
+}
+
+func TestGetBySlugsMixesFoundAndMissing(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	categories := NewPostgresProductCategoryRepository(db)
+
+	second := createTestCategory(t, db, factory.WithPosition(2))
+	first := createTestCategory(t, db, factory.WithPosition(1))
+	inactive := createTestCategory(t, db, factory.WithPosition(3), factory.InactiveCategory())
+	createTestCategory(t, db, factory.WithPosition(4))
+	slugOf := func(id string) string {
+		var slug string
+		if err := db.QueryRow(`SELECT slug FROM product_categories WHERE id = $1`, id).Scan(&slug); err != nil {
+			t.Fatalf("read slug: %v", err)
+		}
+		return slug
+	}
+
+	got, err := categories.GetBySlugs(ctx, []string{slugOf(inactive), "missing", slugOf(second), slugOf(first), "also-missing"})
+	if err != nil {
+		t.Fatalf("GetBySlugs: %v", err)
+	}
+	// Missing slugs are left out and the rest come in display order,
+	// inactive ones included for the service to filter
+	var ids []string
+	for _, c := range got {
+		ids = append(ids, c.ID)
+	}
+	if want := []string{first, second, inactive}; fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", ids, want)
+	}
+
+	if got, err := categories.GetBySlugs(ctx, []string{"missing"}); err != nil || len(got) != 0 {
+		t.Errorf("only missing slugs: got %v, %v, want none", got, err)
+	}
+}
@@ -0,0 +1,609 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/publicid"
+	"user-service/internal/testutil/factory"
+)
+
+func TestParallelCreatesRespectCategoryCap(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	products := NewPostgresProductRepository(db)
+
+	const maxPerCategory, writers = 3, 12
+	categoryID := createTestCategory(t, db)
+
+	var wg sync.WaitGroup
+	errs := make([]error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			product := factory.Product()
+			_, errs[i] = products.Create(ctx, domain.CreateProductRequest{
+				CategoryID: categoryID,
+				Slug:       product.Slug,
+				Name:       product.Name,
+				PriceCoins: product.PriceCoins,
+			}, maxPerCategory)
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		var full *domain.CategoryFullError
+		switch {
+		case err == nil:
+			created++
+		case errors.As(err, &full):
+		default:
+			t.Errorf("Create: %v", err)
+		}
+	}
+	if created != maxPerCategory {
+		t.Errorf("%d creates succeeded, want %d", created, maxPerCategory)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM products WHERE category_id = $1`, categoryID).Scan(&count); err != nil {
+		t.Fatalf("count products: %v", err)
+	}
+	if count != maxPerCategory {
+		t.Errorf("category holds %d products, want %d", count, maxPerCategory)
+	}
+}
+
+func TestCreateStoresGivenID(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	products := NewPostgresProductRepository(db)
+	categoryID := createTestCategory(t, db)
+
+	id, err := publicid.UUIDv7{}.NewID()
+	if err != nil {
+		t.Fatalf("NewID: %v", err)
+	}
+	product := factory.Product()
+	got, err := products.Create(ctx, domain.CreateProductRequest{
+		ID:         id,
+		CategoryID: categoryID,
+		Slug:       product.Slug,
+		Name:       product.Name,
+		PriceCoins: product.PriceCoins,
+	}, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if got.ID != id {
+		t.Errorf("stored under %s, want %s", got.ID, id)
+	}
+
+	// Without one the database picks it
+	product = factory.Product()
+	got, err = products.Create(ctx, domain.CreateProductRequest{
+		CategoryID: categoryID,
+		Slug:       product.Slug,
+		Name:       product.Name,
+		PriceCoins: product.PriceCoins,
+	}, 0)
+	if err != nil {
+		t.Fatalf("Create without an ID: %v", err)
+	}
+	if got.ID == "" || got.ID == id {
+		t.Errorf("stored under %q", got.ID)
+	}
+}
+
+func TestCreateHonorsSlugReservations(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	products := NewPostgresProductRepository(db)
+	categoryID := createTestCategory(t, db)
+	create := func(slug, owner string) (*domain.Product, error) {
+		product := factory.Product()
+		return products.Create(ctx, domain.CreateProductRequest{
+			CategoryID: categoryID,
+			Slug:       slug,
+			Name:       product.Name,
+			PriceCoins: product.PriceCoins,
+			Owner:      owner,
+		}, 0)
+	}
+
+	t.Run("reserved by the creator", func(t *testing.T) {
+		slug := factory.Product().Slug
+		if _, err := products.ReserveSlug(ctx, slug, "drafts-team", time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("ReserveSlug: %v", err)
+		}
+		if _, err := create(slug, "drafts-team"); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		// The create consumed the reservation
+		if err := products.ReleaseSlug(ctx, slug, "drafts-team"); !errors.Is(err, domain.ErrSlugReservationMissing) {
+			t.Errorf("ReleaseSlug after create: %v, want ErrSlugReservationMissing", err)
+		}
+	})
+
+	t.Run("reserved by another caller", func(t *testing.T) {
+		slug := factory.Product().Slug
+		if _, err := products.ReserveSlug(ctx, slug, "drafts-team", time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("ReserveSlug: %v", err)
+		}
+		if _, err := create(slug, "someone-else"); !errors.Is(err, domain.ErrSlugReserved) {
+			t.Fatalf("Create by another owner: %v, want ErrSlugReserved", err)
+		}
+		if _, err := create(slug, ""); !errors.Is(err, domain.ErrSlugReserved) {
+			t.Fatalf("Create without an owner: %v, want ErrSlugReserved", err)
+		}
+		if _, err := products.ReserveSlug(ctx, slug, "someone-else", time.Now().Add(time.Hour)); !errors.Is(err, domain.ErrSlugReserved) {
+			t.Fatalf("ReserveSlug by another owner: %v, want ErrSlugReserved", err)
+		}
+	})
+
+	t.Run("reservation expired", func(t *testing.T) {
+		slug := factory.Product().Slug
+		if _, err := products.ReserveSlug(ctx, slug, "drafts-team", time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("ReserveSlug: %v", err)
+		}
+		if _, err := db.Exec(`UPDATE slug_reservations SET expires_at = NOW() - INTERVAL '1 minute' WHERE slug = $1`, slug); err != nil {
+			t.Fatalf("expire reservation: %v", err)
+		}
+		if _, err := create(slug, "someone-else"); err != nil {
+			t.Fatalf("Create after expiry: %v", err)
+		}
+	})
+}
+
+// insertPricedProducts inserts one product per price into categoryID and
+// returns their IDs in the same order.
+func insertPricedProducts(t *testing.T, db *sql.DB, categoryID string, prices ...int64) []string {
+	t.Helper()
+	ids := make([]string, len(prices))
+	for i, price := range prices {
+		product := factory.Product(factory.WithCategory(categoryID), factory.WithPrice(price))
+		err := db.QueryRow(
+			`INSERT INTO products (category_id, slug, name, price_coins) VALUES ($1, $2, $3, $4) RETURNING id`,
+			product.CategoryID, product.Slug, product.Name, product.PriceCoins,
+		).Scan(&ids[i])
+		if err != nil {
+			t.Fatalf("insert product: %v", err)
+		}
+	}
+	return ids
+}
+
+func TestUpdateCategoryPrices(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	products := NewPostgresProductRepository(db)
+	percent := func(p int) domain.BulkPriceUpdateRequest { return domain.BulkPriceUpdateRequest{Percent: &p} }
+	set := func(c int64) domain.BulkPriceUpdateRequest { return domain.BulkPriceUpdateRequest{SetCoins: &c} }
+
+	tests := []struct {
+		name       string
+		prices     []int64
+		req        domain.BulkPriceUpdateRequest
+		want       []int64
+		wantReason string
+	}{
+		{"percent off", []int64{100, 250, 3}, percent(-20), []int64{80, 200, 2}, "bulk_percent"},
+		{"percent up", []int64{100, 7}, percent(50), []int64{150, 11}, "bulk_percent"},
+		{"percent clamped to the minimum", []int64{3, 1, 1000}, percent(-99), []int64{domain.MinProductPrice, domain.MinProductPrice, 10}, "bulk_percent"},
+		{"percent clamped to the maximum", []int64{domain.MaxProductPrice / 2, domain.MaxProductPrice, 10}, percent(1000), []int64{domain.MaxProductPrice, domain.MaxProductPrice, 110}, "bulk_percent"},
+		{"absolute", []int64{100, 500, domain.MaxProductPrice}, set(500), []int64{500, 500, 500}, "bulk_set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			categoryID := createTestCategory(t, db)
+			ids := insertPricedProducts(t, db, categoryID, tt.prices...)
+			// Products of other categories keep their price
+			bystander := insertPricedProducts(t, db, createTestCategory(t, db), 100)[0]
+
+			updated, err := products.UpdateCategoryPrices(ctx, categoryID, tt.req)
+			if err != nil {
+				t.Fatalf("UpdateCategoryPrices: %v", err)
+			}
+
+			var changed int64
+			for i, id := range ids {
+				var price int64
+				if err := db.QueryRow(`SELECT price_coins FROM products WHERE id = $1`, id).Scan(&price); err != nil {
+					t.Fatalf("read price: %v", err)
+				}
+				if price != tt.want[i] {
+					t.Errorf("price %d became %d, want %d", tt.prices[i], price, tt.want[i])
+				}
+
+				// Only a changed price is recorded in the history
+				var history int
+				var oldPrice, newPrice int64
+				var reason string
+				err := db.QueryRow(`
+					SELECT COUNT(*) OVER (), old_price_coins, new_price_coins, reason
+					FROM product_price_history WHERE product_id = $1`, id).Scan(&history, &oldPrice, &newPrice, &reason)
+				switch {
+				case tt.want[i] == tt.prices[i]:
+					if err != sql.ErrNoRows {
+						t.Errorf("unchanged price %d has history: %v", tt.prices[i], err)
+					}
+				case err != nil:
+					t.Errorf("history of price %d: %v", tt.prices[i], err)
+				default:
+					changed++
+					if history != 1 || oldPrice != tt.prices[i] || newPrice != tt.want[i] || reason != tt.wantReason {
+						t.Errorf("history %d rows, %d -> %d for %s; want one row, %d -> %d for %s",
+							history, oldPrice, newPrice, reason, tt.prices[i], tt.want[i], tt.wantReason)
+					}
+				}
+			}
+			if updated != changed {
+				t.Errorf("reported %d updated, %d prices changed", updated, changed)
+			}
+
+			var price int64
+			if err := db.QueryRow(`SELECT price_coins FROM products WHERE id = $1`, bystander).Scan(&price); err != nil || price != 100 {
+				t.Errorf("product of another category priced %d, %v; want 100", price, err)
+			}
+		})
+	}
+
+	missing, _ := publicid.UUIDv7{}.NewID()
+	if _, err := products.UpdateCategoryPrices(ctx, missing, percent(-20)); err != domain.ErrCategoryNotFound {
+		t.Errorf("unknown category: %v, want ErrCategoryNotFound", err)
+	}
+}
+
+func TestListAllIncludesInactive(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	products := NewPostgresProductRepository(db)
+
+	activeID := createTestProduct(t, db)
+	inactiveID := createTestProduct(t, db, factory.InactiveProduct())
+
+	var all, active int64
+	if err := db.QueryRow(`SELECT COUNT(*), COUNT(*) FILTER (WHERE is_active) FROM products`).Scan(&all, &active); err != nil {
+		t.Fatalf("count products: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		onlyActive   bool
+		wantTotal    int64
+		wantInactive bool
+	}{
+		{"every product", false, all, true},
+		{"only active", true, active, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Newest first, so the products just created lead the page
+			listed, total, err := products.ListAll(ctx, domain.AdminProductQuery{
+				OnlyActive: tt.onlyActive,
+				SortBy:     "created_at",
+				Descending: true,
+				Limit:      domain.MaxListLimit,
+			})
+			if err != nil {
+				t.Fatalf("ListAll: %v", err)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("total = %d, want %d", total, tt.wantTotal)
+			}
+			found := map[string]bool{}
+			for _, p := range listed {
+				found[p.ID] = true
+				if tt.onlyActive && !p.IsActive {
+					t.Errorf("inactive product %s listed with only_active", p.ID)
+				}
+			}
+			if !found[activeID] {
+				t.Errorf("active product %s not listed", activeID)
+			}
+			if found[inactiveID] != tt.wantInactive {
+				t.Errorf("inactive product %s listed = %v, want %v", inactiveID, found[inactiveID], tt.wantInactive)
+			}
+		})
+	}
+}
+
+func TestNullColumnsReadBack(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	products := NewPostgresProductRepository(db)
+	categories := NewPostgresProductCategoryRepository(db)
+
+	category := factory.Category()
+	product := factory.Product()
+	var categoryID, productID string
+	err := db.QueryRow(
+		`INSERT INTO product_categories (slug, name, description, metadata_schema) VALUES ($1, $2, NULL, NULL) RETURNING id`,
+		category.Slug, category.Name,
+	).Scan(&categoryID)
+	if err != nil {
+		t.Fatalf("insert category: %v", err)
+	}
+	err = db.QueryRow(
+		`INSERT INTO products (category_id, slug, name, price_coins, description, metadata, stock)
+		 VALUES ($1, $2, $3, $4, NULL, NULL, NULL) RETURNING id`,
+		categoryID, product.Slug, product.Name, product.PriceCoins,
+	).Scan(&productID)
+	if err != nil {
+		t.Fatalf("insert product: %v", err)
+	}
+
+	// Every read path, so none can regress to scanning NULL into a string
+	read := map[string]func() (*domain.Product, error){
+		"GetByID":   func() (*domain.Product, error) { return products.GetByID(ctx, productID) },
+		"GetBySlug": func() (*domain.Product, error) { return products.GetBySlug(ctx, product.Slug) },
+		"ListProducts": func() (*domain.Product, error) {
+			listed, _, err := products.ListProducts(ctx, &categoryID, false, "", 10, 0)
+			if err != nil || len(listed) != 1 {
+				return nil, fmt.Errorf("listed %d products: %v", len(listed), err)
+			}
+			return &listed[0], nil
+		},
+		"ListAll": func() (*domain.Product, error) {
+			listed, _, err := products.ListAll(ctx, domain.AdminProductQuery{SortBy: "created_at", Limit: 10})
+			if err != nil || len(listed) != 1 {
+				return nil, fmt.Errorf("listed %d products: %v", len(listed), err)
+			}
+			return &listed[0], nil
+		},
+	}
+	for name, get := range read {
+		t.Run(name, func(t *testing.T) {
+			p, err := get()
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if p.Description != "" || p.Metadata != "" || p.Stock != nil {
+				t.Errorf("read description %q, metadata %q, stock %v; want empty, empty and unlimited", p.Description, p.Metadata, p.Stock)
+			}
+			// NULL and "" are both left out of the JSON, not sent as null
+			body, err := json.Marshal(p)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			if bytes.Contains(body, []byte(`"description"`)) || bytes.Contains(body, []byte(`"metadata"`)) {
+				t.Errorf("JSON %s carries description or metadata", body)
+			}
+		})
+	}
+
+	readCategory := map[string]func() (*domain.ProductCategory, error){
+		"category GetByID":   func() (*domain.ProductCategory, error) { return categories.GetByID(ctx, categoryID) },
+		"category GetBySlug": func() (*domain.ProductCategory, error) { return categories.GetBySlug(ctx, category.Slug) },
+		"ListCategories": func() (*domain.ProductCategory, error) {
+			listed, err := categories.ListCategories(ctx, false)
+			if err != nil || len(listed) != 1 {
+				return nil, fmt.Errorf("listed %d categories: %v", len(listed), err)
+			}
+			return &listed[0], nil
+		},
+		"GetBySlugs": func() (*domain.ProductCategory, error) {
+			listed, err := categories.GetBySlugs(ctx, []string{category.Slug})
+			if err != nil || len(listed) != 1 {
+				return nil, fmt.Errorf("listed %d categories: %v", len(listed), err)
+			}
+			return &listed[0], nil
+		},
+		"GetProductCategory": func() (*domain.ProductCategory, error) { return products.GetProductCategory(ctx, productID) },
+	}
+	for name, get := range readCategory {
+		t.Run(name, func(t *testing.T) {
+			c, err := get()
+			if err != nil || c == nil {
+				t.Fatalf("%s: %v, %v", name, c, err)
+			}
+			if c.Description != "" {
+				t.Errorf("read description %q, want empty", c.Description)
+			}
+		})
+	}
+
+	schema, err := products.GetCategoryMetadataSchema(ctx, categoryID)
+	if err != nil || schema != nil {
+		t.Errorf("GetCategoryMetadataSchema = %s, %v; want no schema", schema, err)
+	}
+}
+
+func TestAddViewCountsAccumulates(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	products := NewPostgresProductRepository(db)
+	first := createTestProduct(t, db)
+	second := createTestProduct(t, db)
+	// A product deleted between the views and the flush is skipped
+	deleted := "0190f1a2-0000-7000-8000-0000000000dd"
+
+	if err := products.AddViewCounts(ctx, map[string]int64{first: 7, second: 3, deleted: 4}); err != nil {
+		t.Fatalf("AddViewCounts: %v", err)
+	}
+	if err := products.AddViewCounts(ctx, map[string]int64{first: 2}); err != nil {
+		t.Fatalf("second AddViewCounts: %v", err)
+	}
+
+	for id, want := range map[string]int64{first: 9, second: 3} {
+		var total, today int64
+		err := db.QueryRow(`
+			SELECT p.view_count, COALESCE(d.views, 0)
+			FROM products p
+			LEFT JOIN product_view_days d ON d.product_id = p.id AND d.day = (NOW() AT TIME ZONE 'UTC')::date
+			WHERE p.id = $1`, id,
+		).Scan(&total, &today)
+		if err != nil {
+			t.Fatalf("read views: %v", err)
+		}
+		if total != want || today != want {
+			t.Errorf("product %s: view_count %d, today %d; want %d", id, total, today, want)
+		}
+	}
+	var days int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM product_view_days`).Scan(&days); err != nil {
+		t.Fatalf("count view days: %v", err)
+	}
+	if days != 2 {
+		t.Errorf("%d view day rows, want one per existing product", days)
+	}
+}
+
+func TestCreateDuplicateSlug(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	products := NewPostgresProductRepository(db)
+	categoryID := createTestCategory(t, db)
+	inactive := false
+	req := domain.CreateProductRequest{CategoryID: categoryID, Slug: "desk-lamp-copy", Name: "Desk lamp", PriceCoins: 40, IsActive: &inactive}
+
+	if _, err := products.Create(ctx, req, 0); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	// A racing clone that picked the same slug moves on to the next one
+	if _, err := products.Create(ctx, req, 0); !errors.Is(err, domain.ErrProductSlugExists) {
+		t.Errorf("Create with a taken slug: %v, want ErrProductSlugExists", err)
+	}
+}
+
+func TestConditionalUpdates(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	products := NewPostgresProductRepository(db)
+	categories := NewPostgresProductCategoryRepository(db)
+
+	updatedAt := func(table, id string) time.Time {
+		var at time.Time
+		if err := db.QueryRow(`SELECT updated_at FROM `+table+` WHERE id = $1`, id).Scan(&at); err != nil {
+			t.Fatalf("read %s updated_at: %v", table, err)
+		}
+		return at
+	}
+	at := func(tm time.Time) *time.Time { return &tm }
+
+	for _, table := range []string{"products", "product_categories"} {
+		t.Run(table, func(t *testing.T) {
+			var id string
+			var update func(name string, since *time.Time) error
+			if table == "products" {
+				id = createTestProduct(t, db)
+				update = func(name string, since *time.Time) error {
+					_, err := products.Update(ctx, id, domain.UpdateProductRequest{Name: &name, IfUnmodifiedSince: since}, 0)
+					return err
+				}
+			} else {
+				id = createTestCategory(t, db)
+				update = func(name string, since *time.Time) error {
+					_, err := categories.Update(ctx, id, domain.UpdateCategoryRequest{Name: &name, IfUnmodifiedSince: since})
+					return err
+				}
+			}
+
+			// Missing header: unconditional
+			if err := update("Renamed once", nil); err != nil {
+				t.Fatalf("update without a precondition: %v", err)
+			}
+			current := updatedAt(table, id)
+
+			// Stale: the header is a second before the last change
+			err := update("Stale", at(current.Truncate(time.Second).Add(-time.Second)))
+			var stale *domain.ModifiedSinceError
+			if !errors.As(err, &stale) || !stale.UpdatedAt.Equal(current) {
+				t.Fatalf("stale update: got %v, want ModifiedSinceError at %v", err, current)
+			}
+			if !updatedAt(table, id).Equal(current) {
+				t.Errorf("stale update changed the row")
+			}
+
+			// Fresh: an HTTP date, with its whole seconds, of the last change
+			if err := update("Renamed twice", at(current.Truncate(time.Second))); err != nil {
+				t.Errorf("fresh update: %v", err)
+			}
+		})
+	}
+
+	// A conditional update of a missing row is a 404, not a 412
+	missing := "0190f1a2-0000-7000-8000-0000000000ff"
+	name := "Gone"
+	_, err := products.Update(ctx, missing, domain.UpdateProductRequest{Name: &name, IfUnmodifiedSince: at(time.Now())}, 0)
+	if !errors.Is(err, domain.ErrProductNotFound) {
+		t.Errorf("conditional update of a missing product: got %v, want ErrProductNotFound", err)
+	}
+}
+
+func TestGetProductCategory(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	products := NewPostgresProductRepository(db)
+
+	hiddenID := createTestCategory(t, db, factory.InactiveCategory())
+	productID := createTestProduct(t, db)
+	if _, err := db.Exec(`UPDATE products SET category_id = $2 WHERE id = $1`, productID, hiddenID); err != nil {
+		t.Fatalf("move product: %v", err)
+	}
+
+	category, err := products.GetProductCategory(ctx, productID)
+	if err != nil {
+		t.Fatalf("GetProductCategory: %v", err)
+	}
+	if category == nil || category.ID != hiddenID || category.IsActive || category.Slug == "" || category.CreatedAt.IsZero() {
+		t.Errorf("GetProductCategory = %+v, want the inactive category %s", category, hiddenID)
+	}
+
+	if category, err := products.GetProductCategory(ctx, "0190f1a2-0000-7000-8000-00000000dead"); err != nil || category != nil {
+		t.Errorf("unknown product: got %+v, %v, want nil", category, err)
+	}
+
+	// The foreign key keeps categories from going missing, so break it the
+	// way a restore or manual fix could, where the database allows it
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`SET LOCAL session_replication_role = replica`); err != nil {
+		t.Skipf("cannot bypass the category foreign key: %v", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM product_categories WHERE id = $1`, hiddenID); err != nil {
+		t.Fatalf("delete category: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if category, err := products.GetProductCategory(ctx, productID); err != nil || category != nil {
+		t.Errorf("missing category: got %+v, %v, want nil", category, err)
+	}
+}
+
+func TestIsCategoryActive(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	products := NewPostgresProductRepository(db)
+
+	tests := []struct {
+		name       string
+		categoryID string
+		want       bool
+		wantErr    error
+	}{
+		{"active", createTestCategory(t, db), true, nil},
+		{"inactive", createTestCategory(t, db, factory.InactiveCategory()), false, nil},
+		{"unknown", "0190f1a2-0000-7000-8000-00000000dead", false, domain.ErrCategoryNotFound},
+	}
+	for _, tt := range tests {
+		got, err := products.IsCategoryActive(ctx, tt.categoryID)
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: got %v, %v, want %v, %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
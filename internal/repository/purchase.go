@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/timing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Purchase buys one unit of the product for the user: the checkout of a
+// one-item order and the purchase row referencing it are written in a
+// single transaction. It returns the purchase and the order.
+func (r *postgresOrderRepository) Purchase(ctx context.Context, userID, productID string) (*domain.Purchase, *domain.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_order_purchase", time.Now())
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, wrapErr("begin purchase", err)
+	}
+	defer tx.Rollback()
+
+	order, err := checkout(ctx, tx, userID, []domain.CheckoutItem{{ProductID: productID, Quantity: 1}})
+	if err != nil {
+		return nil, nil, err
+	}
+	item := order.Items[0]
+
+	purchase := &domain.Purchase{
+		UserID:      userID,
+		ProductID:   productID,
+		ProductName: item.ProductName,
+		OrderID:     order.ID,
+		PriceCoins:  item.UnitPriceCoins,
+	}
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO purchases (user_id, product_id, order_id, price_coins)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING id, created_at`,
+		userID, productID, order.ID, item.UnitPriceCoins,
+	).Scan(&purchase.ID, &purchase.CreatedAt)
+	if err != nil {
+		return nil, nil, wrapErr("insert purchase", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, wrapErr("commit purchase", err)
+	}
+
+	log.WithFields(log.Fields{
+		"purchase_id": purchase.ID,
+		"order_id":    order.ID,
+		"user_id":     userID,
+		"product_id":  productID,
+		"price_coins": purchase.PriceCoins,
+	}).Info("Purchase completed")
+
+	return purchase, order, nil
+}
+
+// ListPurchasesByUser returns a page of the user's purchases, newest first,
+// together with the total number of purchases the user has.
+func (r *postgresOrderRepository) ListPurchasesByUser(ctx context.Context, userID string, limit, offset int) ([]domain.Purchase, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_order_list_purchases_by_user", time.Now())
+
+	var total int64
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM purchases WHERE user_id = $1`, userID).Scan(&total); err != nil {
+		return nil, 0, wrapErr("count user purchases", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT p.id, p.user_id, p.product_id, oi.product_name, p.order_id, p.price_coins, oi.refunded_at, p.created_at
+		 FROM purchases p
+		 JOIN order_items oi ON oi.order_id = p.order_id
+		 WHERE p.user_id = $1
+		 ORDER BY p.created_at DESC, p.id DESC
+		 LIMIT $2 OFFSET $3`,
+		userID, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, wrapErr("list user purchases", err)
+	}
+	defer rows.Close()
+
+	purchases := []domain.Purchase{}
+	for rows.Next() {
+		var purchase domain.Purchase
+		var refundedAt sql.NullTime
+		err := rows.Scan(
+			&purchase.ID,
+			&purchase.UserID,
+			&purchase.ProductID,
+			&purchase.ProductName,
+			&purchase.OrderID,
+			&purchase.PriceCoins,
+			&refundedAt,
+			&purchase.CreatedAt,
+		)
+		if err != nil {
+			return nil, 0, wrapErr("scan purchase row", err)
+		}
+		if refundedAt.Valid {
+			purchase.RefundedAt = &refundedAt.Time
+		}
+		purchases = append(purchases, purchase)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, wrapErr("iterate purchase rows", err)
+	}
+
+	return purchases, total, nil
+}
@@ -0,0 +1,283 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/timing"
+)
+
+type postgresReportRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresReportRepository(db *sql.DB) *postgresReportRepository {
+	return &postgresReportRepository{db: db}
+}
+
+// CoinTotals aggregates balances and order spend in a single snapshot.
+func (r *postgresReportRepository) CoinTotals(ctx context.Context) (*domain.CoinTotals, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_report_coin_totals", time.Now())
+
+	var totals domain.CoinTotals
+	err := r.db.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COALESCE(SUM(coins_balance), 0) FROM users),
+			(SELECT COALESCE(SUM(total_coins_purchased), 0) FROM users),
+			(SELECT COALESCE(SUM(total_coins), 0) FROM orders)
+				- (SELECT COALESCE(SUM(amount_coins), 0) FROM order_refunds),
+			NOW()`,
+	).Scan(&totals.Held, &totals.Purchased, &totals.Spent, &totals.ComputedAt)
+	if err != nil {
+		return nil, wrapErr("aggregate coin totals", err)
+	}
+
+	return &totals, nil
+}
+
+// BurnRate sums the coins debited from userID's ledger in the last
+// windowDays days, whatever they were spent on. It returns
+// domain.ErrUserNotFound for an unknown user.
+func (r *postgresReportRepository) BurnRate(ctx context.Context, userID string, windowDays int) (*domain.BurnRate, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_report_burn_rate", time.Now())
+
+	rate := domain.BurnRate{UserID: userID, WindowDays: windowDays}
+	err := r.db.QueryRowContext(ctx, `
+		WITH bounds AS (
+			SELECT NOW() AS to_ts, NOW() - make_interval(days => $2) AS from_ts
+		)
+		SELECT
+			(SELECT COALESCE(SUM(t.amount), 0) FROM coin_transactions t
+			  WHERE t.user_id = u.id AND t.direction = $3 AND t.created_at >= b.from_ts),
+			b.from_ts, b.to_ts
+		FROM users u, bounds b
+		WHERE u.id = $1`,
+		userID, windowDays, domain.CoinDirectionDebit,
+	).Scan(&rate.Spent, &rate.From, &rate.To)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, wrapErr("aggregate burn rate", err)
+	}
+
+	rate.AverageDaily = float64(rate.Spent) / float64(windowDays)
+	return &rate, nil
+}
+
+// CoinSummary totals userID's ledger entries created over rng by category
+// and direction, most spent first. Uncategorized entries are totaled as
+// domain.CoinCategoryOther. It returns domain.ErrUserNotFound for an unknown
+// user.
+func (r *postgresReportRepository) CoinSummary(ctx context.Context, userID string, rng domain.StatsRange) (*domain.CoinSummary, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_report_coin_summary", time.Now())
+
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, userID).Scan(&exists); err != nil {
+		return nil, wrapErr("check coin summary user", err)
+	}
+	if !exists {
+		return nil, domain.ErrUserNotFound
+	}
+
+	from, until := statsBounds(rng)
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT COALESCE(category, $4), direction, SUM(amount), COUNT(*)
+		FROM coin_transactions
+		WHERE user_id = $1
+		  AND created_at >= $2::date::timestamp AT TIME ZONE 'UTC'
+		  AND created_at < $3::date::timestamp AT TIME ZONE 'UTC'
+		GROUP BY COALESCE(category, $4), direction`,
+		userID, from, until, domain.CoinCategoryOther,
+	)
+	if err != nil {
+		return nil, wrapErr("aggregate coin summary", err)
+	}
+	defer rows.Close()
+
+	summary := domain.CoinSummary{
+		UserID:     userID,
+		From:       rng.From.Format(domain.StatsDateLayout),
+		To:         rng.To.Format(domain.StatsDateLayout),
+		Categories: []domain.CoinCategoryTotal{},
+	}
+	index := map[string]int{}
+	for rows.Next() {
+		var category, direction string
+		var amount, entries int64
+		if err := rows.Scan(&category, &direction, &amount, &entries); err != nil {
+			return nil, wrapErr("scan coin summary", err)
+		}
+		i, ok := index[category]
+		if !ok {
+			i = len(summary.Categories)
+			index[category] = i
+			summary.Categories = append(summary.Categories, domain.CoinCategoryTotal{Category: category})
+		}
+		total := &summary.Categories[i]
+		total.Entries += entries
+		if direction == domain.CoinDirectionDebit {
+			total.Debited += amount
+			summary.Debited += amount
+		} else {
+			total.Credited += amount
+			summary.Credited += amount
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("iterate coin summary", err)
+	}
+
+	sort.Slice(summary.Categories, func(a, b int) bool {
+		ca, cb := summary.Categories[a], summary.Categories[b]
+		if ca.Debited != cb.Debited {
+			return ca.Debited > cb.Debited
+		}
+		if ca.Credited != cb.Credited {
+			return ca.Credited > cb.Credited
+		}
+		return ca.Category < cb.Category
+	})
+	return &summary, nil
+}
+
+// statsBounds returns the first day of r and the day after its last, as the
+// dates the stats queries compare view days and UTC order times against.
+func statsBounds(r domain.StatsRange) (string, string) {
+	return r.From.Format(domain.StatsDateLayout), r.To.AddDate(0, 0, 1).Format(domain.StatsDateLayout)
+}
+
+// ProductStats aggregates the views and sales of productID over rng. It returns
+// domain.ErrProductNotFound for an unknown product.
+func (r *postgresReportRepository) ProductStats(ctx context.Context, productID string, rng domain.StatsRange) (*domain.ProductStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_report_product_stats", time.Now())
+
+	from, until := statsBounds(rng)
+	stats := domain.ProductStats{ProductID: productID}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT v.views, s.purchases, s.revenue
+		FROM products p
+		CROSS JOIN LATERAL (
+			SELECT COALESCE(SUM(d.views), 0) AS views
+			FROM product_view_days d
+			WHERE d.product_id = p.id AND d.day >= $2::date AND d.day < $3::date
+		) v
+		CROSS JOIN LATERAL (
+			SELECT COALESCE(SUM(oi.quantity), 0) AS purchases, COALESCE(SUM(oi.total_coins), 0) AS revenue
+			FROM order_items oi
+			JOIN orders o ON o.id = oi.order_id
+			WHERE oi.product_id = p.id
+			  AND oi.refunded_at IS NULL
+			  AND o.created_at >= $2::date::timestamp AT TIME ZONE 'UTC'
+			  AND o.created_at < $3::date::timestamp AT TIME ZONE 'UTC'
+		) s
+		WHERE p.id = $1`,
+		productID, from, until,
+	).Scan(&stats.Views, &stats.Purchases, &stats.RevenueCoins)
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrProductNotFound
+	}
+	if err != nil {
+		return nil, wrapErr("aggregate product stats", err)
+	}
+
+	stats.SetRange(rng)
+	return &stats, nil
+}
+
+// CatalogStats aggregates the views and sales over rng of every product that
+// had either, in categoryID when given, best selling first. It returns a
+// page of them and how many there are in total, or
+// domain.ErrCategoryNotFound for an unknown category.
+func (r *postgresReportRepository) CatalogStats(ctx context.Context, categoryID *string, rng domain.StatsRange, limit, offset int) ([]domain.ProductStats, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_report_catalog_stats", time.Now())
+
+	if categoryID != nil {
+		var exists bool
+		err := r.db.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM product_categories WHERE id = $1)`, *categoryID,
+		).Scan(&exists)
+		if err != nil {
+			return nil, 0, wrapErr("check stats category", err)
+		}
+		if !exists {
+			return nil, 0, domain.ErrCategoryNotFound
+		}
+	}
+
+	from, until := statsBounds(rng)
+	// The total is counted even when the page is past the end, so the query
+	// always returns a row and the page columns are null on an empty page
+	rows, err := r.db.QueryContext(ctx, `
+		WITH views AS (
+			SELECT product_id, SUM(views) AS views
+			FROM product_view_days
+			WHERE day >= $1::date AND day < $2::date
+			GROUP BY product_id
+		), sales AS (
+			SELECT oi.product_id, SUM(oi.quantity) AS purchases, SUM(oi.total_coins) AS revenue
+			FROM order_items oi
+			JOIN orders o ON o.id = oi.order_id
+			WHERE oi.refunded_at IS NULL
+			  AND o.created_at >= $1::date::timestamp AT TIME ZONE 'UTC'
+			  AND o.created_at < $2::date::timestamp AT TIME ZONE 'UTC'
+			GROUP BY oi.product_id
+		), stats AS (
+			SELECT p.id, COALESCE(v.views, 0) AS views, COALESCE(s.purchases, 0) AS purchases, COALESCE(s.revenue, 0) AS revenue
+			FROM products p
+			LEFT JOIN views v ON v.product_id = p.id
+			LEFT JOIN sales s ON s.product_id = p.id
+			WHERE (v.product_id IS NOT NULL OR s.product_id IS NOT NULL)
+			  AND ($3::uuid IS NULL OR p.category_id = $3::uuid)
+		)
+		SELECT total.n, page.id, page.views, page.purchases, page.revenue
+		FROM (SELECT COUNT(*) AS n FROM stats) total
+		LEFT JOIN LATERAL (
+			SELECT * FROM stats
+			ORDER BY revenue DESC, views DESC, id
+			LIMIT $4 OFFSET $5
+		) page ON true`,
+		from, until, categoryID, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, wrapErr("aggregate catalog stats", err)
+	}
+	defer rows.Close()
+
+	stats := []domain.ProductStats{}
+	var total int64
+	for rows.Next() {
+		var id sql.NullString
+		var views, purchases, revenue sql.NullInt64
+		if err := rows.Scan(&total, &id, &views, &purchases, &revenue); err != nil {
+			return nil, 0, wrapErr("scan catalog stats", err)
+		}
+		if !id.Valid {
+			continue
+		}
+		s := domain.ProductStats{
+			ProductID:    id.String,
+			Views:        views.Int64,
+			Purchases:    purchases.Int64,
+			RevenueCoins: revenue.Int64,
+		}
+		s.SetRange(rng)
+		stats = append(stats, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, wrapErr("iterate catalog stats", err)
+	}
+	return stats, total, nil
+}
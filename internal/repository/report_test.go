@@ -0,0 +1,349 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/testutil/factory"
+)
+
+func TestBurnRateSumsLedgerDebits(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	users := NewPostgresUserRepository(db)
+	orders := NewPostgresOrderRepository(db)
+	reports := NewPostgresReportRepository(db)
+
+	user := createFundedUser(t, users, 100)
+	productID := createTestProduct(t, db, factory.WithPrice(20))
+	if _, err := orders.Checkout(ctx, user.ID, []domain.CheckoutItem{{ProductID: productID, Quantity: 1}}); err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	// Direct deductions never show up in orders but are spend all the same
+	if _, _, err := users.DeductCoinsAtomic(ctx, user.ID, 15, domain.CoinReasonSpend, ""); err != nil {
+		t.Fatalf("DeductCoinsAtomic: %v", err)
+	}
+
+	// Earlier ledger entries, inside and outside the windows asked for below
+	other := createFundedUser(t, users, 0)
+	now := time.Now()
+	seed := []struct {
+		userID    string
+		amount    int64
+		direction string
+		age       time.Duration
+	}{
+		{user.ID, 30, domain.CoinDirectionDebit, 3 * 24 * time.Hour},
+		{user.ID, 20, domain.CoinDirectionDebit, 7*24*time.Hour - time.Hour},
+		{user.ID, 500, domain.CoinDirectionDebit, 7*24*time.Hour + time.Hour},
+		{user.ID, 1000, domain.CoinDirectionDebit, 31 * 24 * time.Hour},
+		// Credits and other users' spend are not this user's spend
+		{user.ID, 999, domain.CoinDirectionCredit, 24 * time.Hour},
+		{other.ID, 77, domain.CoinDirectionDebit, time.Hour},
+	}
+	for _, e := range seed {
+		if _, err := db.ExecContext(ctx, `
+			INSERT INTO coin_transactions (user_id, amount, direction, reason, balance_after, created_at)
+			VALUES ($1, $2, $3, $4, 0, $5)`,
+			e.userID, e.amount, e.direction, domain.CoinReasonSpend, now.Add(-e.age)); err != nil {
+			t.Fatalf("seed ledger entry: %v", err)
+		}
+	}
+
+	tests := []struct {
+		windowDays int
+		wantSpent  int64
+	}{
+		{1, 20 + 15},
+		{7, 20 + 15 + 30 + 20},
+		{30, 20 + 15 + 30 + 20 + 500},
+	}
+	for _, tt := range tests {
+		rate, err := reports.BurnRate(ctx, user.ID, tt.windowDays)
+		if err != nil {
+			t.Fatalf("BurnRate over %d days: %v", tt.windowDays, err)
+		}
+		wantAverage := float64(tt.wantSpent) / float64(tt.windowDays)
+		if rate.Spent != tt.wantSpent || rate.AverageDaily != wantAverage {
+			t.Errorf("over %d days: spent %d, average %v; want %d and %v", tt.windowDays, rate.Spent, rate.AverageDaily, tt.wantSpent, wantAverage)
+		}
+		if got := rate.To.Sub(rate.From); rate.WindowDays != tt.windowDays || got != time.Duration(tt.windowDays)*24*time.Hour {
+			t.Errorf("over %d days: window of %d days from %v to %v", tt.windowDays, rate.WindowDays, rate.From, rate.To)
+		}
+	}
+
+	if _, err := reports.BurnRate(ctx, "0190c2a8-7f1e-7a3b-9c4d-000000000099", 30); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Errorf("unknown user: got %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestCoinTotalsSumSeededUsers(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	users := NewPostgresUserRepository(db)
+	orders := NewPostgresOrderRepository(db)
+	reports := NewPostgresReportRepository(db)
+
+	// Bought 100, spent 50 on an order and got 20 of it refunded
+	_, order, _ := checkoutTwoProducts(t, db)
+	if _, err := orders.Refund(ctx, order.ID, []string{order.Items[0].ID}); err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	// Bought 250 and deducted 15 directly, which is not order spend
+	saver := createFundedUser(t, users, 250)
+	if _, _, err := users.DeductCoinsAtomic(ctx, saver.ID, 15, domain.CoinReasonSpend, ""); err != nil {
+		t.Fatalf("DeductCoinsAtomic: %v", err)
+	}
+	// Granted 40 without buying any
+	granted := createFundedUser(t, users, 0)
+	if _, _, err := users.AddCoinsAtomic(ctx, granted.ID, 40, "promo_code", ""); err != nil {
+		t.Fatalf("AddCoinsAtomic: %v", err)
+	}
+	createFundedUser(t, users, 0)
+
+	totals, err := reports.CoinTotals(ctx)
+	if err != nil {
+		t.Fatalf("CoinTotals: %v", err)
+	}
+	want := domain.CoinTotals{Held: 70 + 235 + 40, Purchased: 100 + 250, Spent: 50 - 20}
+	if totals.Held != want.Held || totals.Purchased != want.Purchased || totals.Spent != want.Spent {
+		t.Errorf("held %d, purchased %d, spent %d; want %d, %d and %d",
+			totals.Held, totals.Purchased, totals.Spent, want.Held, want.Purchased, want.Spent)
+	}
+	if totals.ComputedAt.IsZero() {
+		t.Errorf("computed_at not set")
+	}
+}
+
+// categorySlug returns the slug of the category productID is in.
+func categorySlug(t *testing.T, db *sql.DB, productID string) string {
+	t.Helper()
+	var slug string
+	err := db.QueryRow(`SELECT c.slug FROM products p JOIN product_categories c ON c.id = p.category_id WHERE p.id = $1`, productID).Scan(&slug)
+	if err != nil {
+		t.Fatalf("category slug: %v", err)
+	}
+	return slug
+}
+
+func TestCoinSummaryGroupsMixedLedger(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	users := NewPostgresUserRepository(db)
+	orders := NewPostgresOrderRepository(db)
+	reports := NewPostgresReportRepository(db)
+
+	user := createFundedUser(t, users, 1000)
+	friend := createFundedUser(t, users, 0)
+	boost := createTestProduct(t, db, factory.WithPrice(20))
+	theme := createTestProduct(t, db, factory.WithPrice(50))
+	boosts, themes := categorySlug(t, db, boost), categorySlug(t, db, theme)
+
+	// Two boosts, one of them refunded
+	if _, _, err := orders.Purchase(ctx, user.ID, boost); err != nil {
+		t.Fatalf("Purchase: %v", err)
+	}
+	_, refunded, err := orders.Purchase(ctx, user.ID, boost)
+	if err != nil {
+		t.Fatalf("Purchase: %v", err)
+	}
+	if _, err := orders.Refund(ctx, refunded.ID, nil); err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	// A theme alone, and a theme with a boost in one order
+	if _, err := orders.Checkout(ctx, user.ID, []domain.CheckoutItem{{ProductID: theme, Quantity: 1}}); err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	if _, err := orders.Checkout(ctx, user.ID, []domain.CheckoutItem{{ProductID: theme, Quantity: 1}, {ProductID: boost, Quantity: 2}}); err != nil {
+		t.Fatalf("Checkout: %v", err)
+	}
+	if _, _, err := users.ActivateSubscriptionAtomic(ctx, user.ID, 24*time.Hour, 500, ""); err != nil {
+		t.Fatalf("ActivateSubscriptionAtomic: %v", err)
+	}
+	if _, _, err := users.TransferCoins(ctx, user.ID, friend.ID, 30); err != nil {
+		t.Fatalf("TransferCoins: %v", err)
+	}
+	if _, _, err := users.DeductCoinsAtomic(ctx, user.ID, 15, domain.CoinReasonSpend, ""); err != nil {
+		t.Fatalf("DeductCoinsAtomic: %v", err)
+	}
+	// A debit from before categories existed, and one outside the range
+	if _, err := db.Exec(`
+		INSERT INTO coin_transactions (user_id, amount, direction, reason, balance_after)
+		VALUES ($1, 5, $2, 'legacy_spend', 0)`, user.ID, domain.CoinDirectionDebit); err != nil {
+		t.Fatalf("insert legacy entry: %v", err)
+	}
+	if _, err := db.Exec(`
+		INSERT INTO coin_transactions (user_id, amount, direction, reason, balance_after, category, created_at)
+		VALUES ($1, 999, $2, $3, 0, $4, NOW() - INTERVAL '60 days')`,
+		user.ID, domain.CoinDirectionDebit, domain.CoinReasonCheckout, boosts); err != nil {
+		t.Fatalf("insert old entry: %v", err)
+	}
+
+	rng, err := domain.ParseStatsRange("", "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := reports.CoinSummary(ctx, user.ID, rng)
+	if err != nil {
+		t.Fatalf("CoinSummary: %v", err)
+	}
+
+	want := []domain.CoinCategoryTotal{
+		{Category: domain.CoinCategoryMixed, Debited: 90, Entries: 1},
+		{Category: themes, Debited: 50, Entries: 1},
+		{Category: boosts, Credited: 20, Debited: 40, Entries: 3},
+		{Category: domain.CoinCategoryTransfer, Debited: 30, Entries: 1},
+		{Category: domain.CoinCategoryOther, Credited: 1000, Debited: 20, Entries: 3},
+		{Category: domain.CoinCategorySubscription, Credited: 500, Entries: 1},
+	}
+	if len(summary.Categories) != len(want) {
+		t.Fatalf("categories %+v, want %+v", summary.Categories, want)
+	}
+	for i := range want {
+		if summary.Categories[i] != want[i] {
+			t.Errorf("category %d: %+v, want %+v", i, summary.Categories[i], want[i])
+		}
+	}
+	if summary.Credited != 1520 || summary.Debited != 230 {
+		t.Errorf("credited %d, debited %d; want 1520 and 230", summary.Credited, summary.Debited)
+	}
+
+	friendSummary, err := reports.CoinSummary(ctx, friend.ID, rng)
+	if err != nil {
+		t.Fatalf("CoinSummary: %v", err)
+	}
+	if len(friendSummary.Categories) != 1 || friendSummary.Categories[0] != (domain.CoinCategoryTotal{Category: domain.CoinCategoryTransfer, Credited: 30, Entries: 1}) {
+		t.Errorf("friend categories %+v, want the transfer in", friendSummary.Categories)
+	}
+
+	if _, err := reports.CoinSummary(ctx, "0190c2a8-7f1e-7a3b-9c4d-000000000099", rng); err != domain.ErrUserNotFound {
+		t.Errorf("unknown user: %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestProductStatsOverSeededOrdersAndViews(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	users := NewPostgresUserRepository(db)
+	orders := NewPostgresOrderRepository(db)
+	reports := NewPostgresReportRepository(db)
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	first, last := today.AddDate(0, 0, -2), today.AddDate(0, 0, -1)
+	rng := domain.StatsRange{From: first, To: last}
+
+	categoryID := createTestCategory(t, db)
+	lamp := createTestProduct(t, db, factory.WithCategory(categoryID), factory.WithPrice(10))
+	desk := createTestProduct(t, db, factory.WithCategory(categoryID), factory.WithPrice(40))
+	chair := createTestProduct(t, db, factory.WithPrice(25))
+	idle := createTestProduct(t, db)
+
+	views := []struct {
+		productID string
+		day       time.Time
+		views     int64
+	}{
+		{lamp, first, 10},
+		{lamp, last, 30},
+		{lamp, today, 100},                  // after the range
+		{lamp, first.AddDate(0, 0, -1), 50}, // before it
+		{desk, last, 5},
+		{chair, first, 8},
+	}
+	for _, v := range views {
+		if _, err := db.Exec(`INSERT INTO product_view_days (product_id, day, views) VALUES ($1, $2, $3)`, v.productID, v.day, v.views); err != nil {
+			t.Fatalf("seed views: %v", err)
+		}
+	}
+
+	buyer := createFundedUser(t, users, 1000)
+	checkout := func(at time.Time, items ...domain.CheckoutItem) *domain.Order {
+		t.Helper()
+		order, err := orders.Checkout(ctx, buyer.ID, items)
+		if err != nil {
+			t.Fatalf("Checkout: %v", err)
+		}
+		if _, err := db.Exec(`UPDATE orders SET created_at = $2 WHERE id = $1`, order.ID, at); err != nil {
+			t.Fatalf("backdate order: %v", err)
+		}
+		return order
+	}
+	// The range runs from the first instant of its first UTC day to the
+	// last of its last
+	checkout(first, domain.CheckoutItem{ProductID: lamp, Quantity: 2})
+	mixed := checkout(last.Add(24*time.Hour-time.Second),
+		domain.CheckoutItem{ProductID: lamp, Quantity: 1},
+		domain.CheckoutItem{ProductID: desk, Quantity: 1},
+	)
+	checkout(first.Add(-time.Second), domain.CheckoutItem{ProductID: lamp, Quantity: 4})
+	checkout(today, domain.CheckoutItem{ProductID: chair, Quantity: 3})
+	// Refunded lines are not sales
+	for _, item := range mixed.Items {
+		if item.ProductID == desk {
+			if _, err := orders.Refund(ctx, mixed.ID, []string{item.ID}); err != nil {
+				t.Fatalf("Refund: %v", err)
+			}
+		}
+	}
+
+	want := map[string]domain.ProductStats{
+		lamp:  {ProductID: lamp, Views: 40, Purchases: 3, RevenueCoins: 30, ConversionRate: 3.0 / 40},
+		desk:  {ProductID: desk, Views: 5},
+		chair: {ProductID: chair, Views: 8},
+		idle:  {ProductID: idle},
+	}
+	for id, w := range want {
+		w.SetRange(rng)
+		got, err := reports.ProductStats(ctx, id, rng)
+		if err != nil {
+			t.Fatalf("ProductStats: %v", err)
+		}
+		if *got != w {
+			t.Errorf("ProductStats(%s) = %+v, want %+v", id, *got, w)
+		}
+	}
+	if _, err := reports.ProductStats(ctx, "0190f1a2-0000-7000-8000-00000000dead", rng); !errors.Is(err, domain.ErrProductNotFound) {
+		t.Errorf("unknown product: got %v, want ErrProductNotFound", err)
+	}
+
+	// Products without views or sales are left out; best selling first
+	catalog := []struct {
+		name       string
+		categoryID *string
+		limit      int
+		offset     int
+		want       []string
+		wantTotal  int64
+	}{
+		{"all", nil, 10, 0, []string{lamp, chair, desk}, 3},
+		{"category", &categoryID, 10, 0, []string{lamp, desk}, 2},
+		{"second page", nil, 1, 1, []string{chair}, 3},
+		{"past the end", nil, 10, 5, nil, 3},
+	}
+	for _, tt := range catalog {
+		page, total, err := reports.CatalogStats(ctx, tt.categoryID, rng, tt.limit, tt.offset)
+		if err != nil {
+			t.Fatalf("%s: CatalogStats: %v", tt.name, err)
+		}
+		var ids []string
+		for _, s := range page {
+			w := want[s.ProductID]
+			w.SetRange(rng)
+			if s != w {
+				t.Errorf("%s: %+v, want %+v", tt.name, s, w)
+			}
+			ids = append(ids, s.ProductID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(tt.want) || total != tt.wantTotal {
+			t.Errorf("%s: got %v of %d, want %v of %d", tt.name, ids, total, tt.want, tt.wantTotal)
+		}
+	}
+	unknown := "0190f1a2-0000-7000-8000-00000000dead"
+	if _, _, err := reports.CatalogStats(ctx, &unknown, rng, 10, 0); !errors.Is(err, domain.ErrCategoryNotFound) {
+		t.Errorf("unknown category: got %v, want ErrCategoryNotFound", err)
+	}
+}
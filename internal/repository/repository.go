@@ -7,80 +7,45 @@ import (
 	"strings"
 	"time"
 	"user-service/internal/domain"
+	"user-service/internal/pii"
+	"user-service/internal/timing"
 
 	log "github.com/sirupsen/logrus"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type postgresUserRepository struct {
 	db *sql.DB
+	// idempotencyKeyTTL is how long idempotency keys of coin and
+	// subscription mutations are honored.
+	idempotencyKeyTTL time.Duration
+	// pii, when set, decrypts emails and names as they are read and hashes
+	// emails for lookups. encryptPII also encrypts them as they are written.
+	pii        *pii.Cipher
+	encryptPII bool
 }
 
 func NewPostgresUserRepository(db *sql.DB) *postgresUserRepository {
-	return &postgresUserRepository{db: db}
+	return &postgresUserRepository{db: db, idempotencyKeyTTL: 24 * time.Hour}
 }
 
-func (r *postgresUserRepository) Create(ctx context.Context, user *domain.User) error {
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-
-	log.WithFields(log.Fields{
-		"user_id": user.ID,
-		"email":   user.Email,
-		"name":    user.Name,
-	}).Info("Creating new user in database")
-
-	query := `
-		INSERT INTO users (
-			id, email, name,
-			coins_balance, total_coins_purchased,
-			is_trial, trial_ends_at,
-			has_subscription, subscription_ends_at,
-			status
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-	`
-
-	_, err := r.db.ExecContext(ctx, query,
-		user.ID,
-		user.Email,
-		user.Name,
-		user.CoinsBalance,
-		user.TotalCoinsPurchased,
-		user.IsTrial,
-		user.TrialEndsAt,
-		user.HasSubscription,
-		user.SubscriptionEndsAt,
-		user.Status,
-	)
-
-	if err != nil {
-		log.WithError(err).WithField("user_id", user.ID).Error("Failed to create user")
-		return fmt.Errorf("failed to create user: %w", err)
-	}
-
-	log.WithField("user_id", user.ID).Info("User successfully created")
-	return nil
-}
-
-func (r *postgresUserRepository) GetByID(ctx context.Context, id string) (*domain.User, error) {
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-
-	query := `
-		SELECT id, email, name,
-			coins_balance, total_coins_purchased,
-			is_trial, trial_ends_at,
-			has_subscription, subscription_ends_at,
-			status, created_at, updated_at
-		FROM users
-		WHERE id = $1
-	`
-
+// userColumns lists the users columns in the order scanUser expects them.
+const userColumns = `id, email, name,
+	coins_balance, total_coins_purchased,
+	is_trial, trial_ends_at,
+	has_subscription, subscription_ends_at,
+	status, email_verified,
+	deletion_requested_at, deletion_scheduled_for,
+	deleted_at, created_at, updated_at`
+
+// scanUserRow reads a row selected with userColumns into a domain.User, as
+// stored. Use scanUser to get email and name decrypted.
+func scanUserRow(row interface{ Scan(...interface{}) error }) (*domain.User, error) {
 	var user domain.User
-	var trialEndsAt, subscriptionEndsAt sql.NullTime
+	var trialEndsAt, subscriptionEndsAt, deletionRequestedAt, deletionScheduledFor, deletedAt sql.NullTime
 
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
+	err := row.Scan(
 		&user.ID,
 		&user.Email,
 		&user.Name,
@@ -91,16 +56,15 @@ func (r *postgresUserRepository) GetByID(ctx context.Context, id string) (*domai
 		&user.HasSubscription,
 		&subscriptionEndsAt,
 		&user.Status,
+		&user.EmailVerified,
+		&deletionRequestedAt,
+		&deletionScheduledFor,
+		&deletedAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
-
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, domain.ErrUserNotFound
-		}
-		log.WithError(err).WithField("user_id", id).Error("Failed to get user by ID")
-		return nil, fmt.Errorf("failed to get user by ID: %w", err)
+		return nil, err
 	}
 
 	if trialEndsAt.Valid {
@@ -109,63 +73,148 @@ func (r *postgresUserRepository) GetByID(ctx context.Context, id string) (*domai
 	if subscriptionEndsAt.Valid {
 		user.SubscriptionEndsAt = &subscriptionEndsAt.Time
 	}
+	if deletionRequestedAt.Valid {
+		user.DeletionRequestedAt = &deletionRequestedAt.Time
+	}
+	if deletionScheduledFor.Valid {
+		user.DeletionScheduledFor = &deletionScheduledFor.Time
+		user.DeletionPending = true
+	}
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
 
 	return &user, nil
 }
 
-func (r *postgresUserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+const insertUserQuery = `
+	INSERT INTO users (
+		id, email, name,
+		coins_balance, total_coins_purchased,
+		is_trial, trial_ends_at,
+		has_subscription, subscription_ends_at,
+		status, email_verified, email_hash
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+`
+
+func (r *postgresUserRepository) Create(ctx context.Context, user *domain.User) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	defer timing.Record(ctx, "db_user_create", time.Now())
 
-	query := `
-		SELECT id, email, name,
-			coins_balance, total_coins_purchased,
-			is_trial, trial_ends_at,
-			has_subscription, subscription_ends_at,
-			status, created_at, updated_at
-		FROM users
-		WHERE email = $1
-	`
+	log.WithField("user_id", user.ID).Info("Creating new user in database")
 
-	var user domain.User
-	var trialEndsAt, subscriptionEndsAt sql.NullTime
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapErr("begin create user", err)
+	}
+	defer tx.Rollback()
 
-	err := r.db.QueryRowContext(ctx, query, email).Scan(
-		&user.ID,
-		&user.Email,
-		&user.Name,
-		&user.CoinsBalance,
-		&user.TotalCoinsPurchased,
-		&user.IsTrial,
-		&trialEndsAt,
-		&user.HasSubscription,
-		&subscriptionEndsAt,
-		&user.Status,
-		&user.CreatedAt,
-		&user.UpdatedAt,
+	email, name, emailHash, err := r.sealUser(ctx, user.Email, user.Name)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, insertUserQuery,
+		user.ID,
+		email,
+		name,
+		user.CoinsBalance,
+		user.TotalCoinsPurchased,
+		user.IsTrial,
+		user.TrialEndsAt,
+		user.HasSubscription,
+		user.SubscriptionEndsAt,
+		user.Status,
+		user.EmailVerified,
+		emailHash,
 	)
+	// The email check in the service is not atomic with this INSERT, so a
+	// concurrent create with the same address is caught by the unique constraint.
+	if isUniqueViolation(err) {
+		return domain.ErrEmailAlreadyExists
+	}
+	if err != nil {
+		log.WithError(err).WithField("user_id", user.ID).Error("Failed to create user")
+		return wrapErr("create user", err)
+	}
+
+	if user.CoinsBalance > 0 {
+		if err := recordCoinTransaction(ctx, tx, user.ID, user.CoinsBalance, domain.CoinDirectionCredit, domain.CoinReasonSignupBonus, "", user.CoinsBalance); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return wrapErr("commit user creation", err)
+	}
+
+	log.WithField("user_id", user.ID).Info("User successfully created")
+	return nil
+}
+
+// notDeleted is the condition excluding soft-deleted users from reads.
+const notDeleted = ` AND deleted_at IS NULL`
+
+// GetByID returns the user, or ErrUserNotFound if it doesn't exist or is
+// soft-deleted and includeDeleted is false.
+func (r *postgresUserRepository) GetByID(ctx context.Context, id string, includeDeleted bool) (*domain.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_get_by_id", time.Now())
+
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	if !includeDeleted {
+		query += notDeleted
+	}
 
+	user, err := r.scanUser(ctx, r.db.QueryRowContext(ctx, query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, domain.ErrUserNotFound
 		}
-		log.WithError(err).WithField("email", email).Error("Failed to get user by email")
-		return nil, fmt.Errorf("failed to get user by email: %w", err)
+		log.WithError(err).WithField("user_id", id).Error("Failed to get user by ID")
+		return nil, wrapErr("get user by ID", err)
 	}
 
-	if trialEndsAt.Valid {
-		user.TrialEndsAt = &trialEndsAt.Time
+	return user, nil
+}
+
+// GetByEmail returns the user with email, or ErrUserNotFound if there is
+// none or it is soft-deleted and includeDeleted is false.
+func (r *postgresUserRepository) GetByEmail(ctx context.Context, email string, includeDeleted bool) (*domain.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_get_by_email", time.Now())
+
+	// Encrypted emails are found by their hash, rows not yet backfilled by
+	// the plaintext email
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1`
+	args := []interface{}{email}
+	if r.pii != nil {
+		query = `SELECT ` + userColumns + ` FROM users
+			WHERE (email_hash = $1 OR (email_hash IS NULL AND email = $2))`
+		args = []interface{}{r.pii.Hash(email), email}
 	}
-	if subscriptionEndsAt.Valid {
-		user.SubscriptionEndsAt = &subscriptionEndsAt.Time
+	if !includeDeleted {
+		query += notDeleted
 	}
 
-	return &user, nil
+	user, err := r.scanUser(ctx, r.db.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, domain.ErrUserNotFound
+		}
+		log.WithError(err).Error("Failed to get user by email")
+		return nil, wrapErr("get user by email", err)
+	}
+
+	return user, nil
 }
 
 func (r *postgresUserRepository) Update(ctx context.Context, userID string, fields *domain.UpdateUserFields) error {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	defer timing.Record(ctx, "db_user_update", time.Now())
 
 	// Build dynamic SQL query based on provided fields
 	var setParts []string
@@ -173,14 +222,26 @@ func (r *postgresUserRepository) Update(ctx context.Context, userID string, fiel
 	argIndex := 1
 
 	if fields.Email != nil {
-		setParts = append(setParts, fmt.Sprintf("email = $%d", argIndex))
-		args = append(args, *fields.Email)
-		argIndex++
+		email, err := r.sealValue(ctx, *fields.Email)
+		if err != nil {
+			return err
+		}
+		// A new address has not been verified yet
+		setParts = append(setParts,
+			fmt.Sprintf("email = $%d", argIndex),
+			fmt.Sprintf("email_hash = $%d", argIndex+1),
+			"email_verified = false")
+		args = append(args, email, r.emailHash(*fields.Email))
+		argIndex += 2
 	}
 
 	if fields.Name != nil {
+		name, err := r.sealValue(ctx, *fields.Name)
+		if err != nil {
+			return err
+		}
 		setParts = append(setParts, fmt.Sprintf("name = $%d", argIndex))
-		args = append(args, *fields.Name)
+		args = append(args, name)
 		argIndex++
 	}
 
@@ -206,37 +267,59 @@ func (r *postgresUserRepository) Update(ctx context.Context, userID string, fiel
 		argIndex,
 	)
 	args = append(args, userID)
+	if fields.Email != nil {
+		// Tokens mailed to the old address must not verify the new one, so
+		// they go in the same statement as the change
+		query = fmt.Sprintf("WITH purged AS (DELETE FROM email_verification_tokens WHERE user_id = $%d) ", argIndex) + query
+	}
 
 	log.WithFields(log.Fields{
 		"user_id": userID,
 		"fields":  setParts,
 	}).Info("Updating user with dynamic SQL in single transaction")
 
-	result, err := r.db.ExecContext(ctx, query, args...)
-	if err != nil {
-		log.WithError(err).WithField("user_id", userID).Error("Failed to update user")
-		return fmt.Errorf("failed to update user: %w", err)
-	}
+	err := r.withAdminAction(ctx, userID, domain.AdminActionUserUpdated, r.redact(fields.Changes()), func(q dbExecutor) error {
+		result, err := q.ExecContext(ctx, query, args...)
+		if err != nil {
+			// The email check in the service is not atomic with this UPDATE, so a
+			// concurrent change to the same address is caught by the unique constraint.
+			if isUniqueViolation(err) {
+				return domain.ErrEmailAlreadyExists
+			}
+			log.WithError(err).WithField("user_id", userID).Error("Failed to update user")
+			return wrapErr("update user", err)
+		}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("could not determine rows affected: %w", err)
-	}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return wrapErr("update user rows affected", err)
+		}
 
-	if rowsAffected == 0 {
-		return domain.ErrUserNotFound
+		if rowsAffected == 0 {
+			return domain.ErrUserNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	log.WithField("user_id", userID).Info("User successfully updated in single transaction")
 	return nil
 }
 
-func (r *postgresUserRepository) AddCoinsAtomic(ctx context.Context, userID string, coins int64) error {
+// AddCoinsAtomic credits coins, records them in the ledger under reason, and
+// returns the user as updated. Coins count toward total_coins_purchased only
+// under domain.CoinReasonPurchase. With an idempotencyKey, a repeat of a
+// request already made with that key returns the first result and true
+// instead.
+func (r *postgresUserRepository) AddCoinsAtomic(ctx context.Context, userID string, coins int64, reason, idempotencyKey string) (*domain.User, bool, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	defer timing.Record(ctx, "db_user_add_coins_atomic", time.Now())
 
 	if coins <= 0 {
-		return domain.ErrInvalidCoinsAmount
+		return nil, false, domain.ErrInvalidCoinsAmount
 	}
 
 	log.WithFields(log.Fields{
@@ -244,39 +327,77 @@ func (r *postgresUserRepository) AddCoinsAtomic(ctx context.Context, userID stri
 		"coins":   coins,
 	}).Info("Atomically adding coins to user")
 
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, wrapErr("begin add coins", err)
+	}
+	defer tx.Rollback()
+
+	if idempotencyKey != "" {
+		previous, replayed, err := r.claimIdempotencyKey(ctx, tx, userID, idempotencyKey, idempotencyRequestHash("add_coins", reason, coins), r.idempotencyKeyTTL)
+		if err != nil {
+			return nil, false, err
+		}
+		if replayed {
+			return previous, true, nil
+		}
+	}
+
+	// Only bought coins count as purchased, not grants under other reasons
+	var purchased int64
+	if reason == domain.CoinReasonPurchase {
+		purchased = coins
+	}
 	query := `
 		UPDATE users SET
 			coins_balance = coins_balance + $1,
-			total_coins_purchased = total_coins_purchased + $1,
+			total_coins_purchased = total_coins_purchased + $2,
 			updated_at = NOW()
-		WHERE id = $2
-	`
+		WHERE id = $3` + notDeleted + `
+		RETURNING ` + userColumns
 
-	result, err := r.db.ExecContext(ctx, query, coins, userID)
+	user, err := r.scanUser(ctx, tx.QueryRowContext(ctx, query, coins, purchased, userID))
+	if err == sql.ErrNoRows {
+		return nil, false, domain.ErrUserNotFound
+	}
 	if err != nil {
 		log.WithError(err).WithField("user_id", userID).Error("Failed to add coins atomically")
-		return fmt.Errorf("failed to add coins: %w", err)
+		return nil, false, wrapErr("add coins", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("could not determine rows affected: %w", err)
+	if err := recordCoinTransaction(ctx, tx, userID, coins, domain.CoinDirectionCredit, reason, "", user.CoinsBalance); err != nil {
+		return nil, false, err
 	}
-
-	if rowsAffected == 0 {
-		return domain.ErrUserNotFound
+	if err := recordAdminAction(ctx, tx, userID, domain.AdminActionCoinsAdded, map[string]interface{}{
+		"amount":        coins,
+		"reason":        reason,
+		"balance_after": user.CoinsBalance,
+	}); err != nil {
+		return nil, false, err
+	}
+	if idempotencyKey != "" {
+		if err := r.storeIdempotentResult(ctx, tx, userID, idempotencyKey, user); err != nil {
+			return nil, false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, wrapErr("commit coins added", err)
 	}
 
 	log.WithField("user_id", userID).Info("Coins successfully added atomically")
-	return nil
+	return user, false, nil
 }
 
-func (r *postgresUserRepository) DeductCoinsAtomic(ctx context.Context, userID string, coins int64) error {
+// DeductCoinsAtomic debits coins if the balance covers them, records them in
+// the ledger under reason, and returns the user as updated. idempotencyKey
+// works as for AddCoinsAtomic.
+func (r *postgresUserRepository) DeductCoinsAtomic(ctx context.Context, userID string, coins int64, reason, idempotencyKey string) (*domain.User, bool, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	defer timing.Record(ctx, "db_user_deduct_coins_atomic", time.Now())
 
 	if coins <= 0 {
-		return domain.ErrInvalidCoinsAmount
+		return nil, false, domain.ErrInvalidCoinsAmount
 	}
 
 	log.WithFields(log.Fields{
@@ -284,209 +405,1055 @@ func (r *postgresUserRepository) DeductCoinsAtomic(ctx context.Context, userID s
 		"coins":   coins,
 	}).Info("Atomically deducting coins from user")
 
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, wrapErr("begin deduct coins", err)
+	}
+	defer tx.Rollback()
+
+	if idempotencyKey != "" {
+		previous, replayed, err := r.claimIdempotencyKey(ctx, tx, userID, idempotencyKey, idempotencyRequestHash("deduct_coins", reason, coins), r.idempotencyKeyTTL)
+		if err != nil {
+			return nil, false, err
+		}
+		if replayed {
+			return previous, true, nil
+		}
+	}
+
 	query := `
 		UPDATE users SET
 			coins_balance = coins_balance - $1,
 			updated_at = NOW()
-		WHERE id = $2
+		WHERE id = $2` + notDeleted + `
 		  AND coins_balance >= $1
-	`
+		RETURNING ` + userColumns
 
-	result, err := r.db.ExecContext(ctx, query, coins, userID)
+	user, err := r.scanUser(ctx, tx.QueryRowContext(ctx, query, coins, userID))
+	if err == sql.ErrNoRows {
+		if _, err := r.GetByID(ctx, userID, false); err != nil {
+			return nil, false, domain.ErrUserNotFound
+		}
+		return nil, false, domain.ErrInsufficientCoinsBalance
+	}
 	if err != nil {
 		log.WithError(err).WithField("user_id", userID).Error("Failed to deduct coins atomically")
-		return fmt.Errorf("failed to deduct coins: %w", err)
+		return nil, false, wrapErr("deduct coins", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("could not determine rows affected: %w", err)
+	if err := recordCoinTransaction(ctx, tx, userID, coins, domain.CoinDirectionDebit, reason, "", user.CoinsBalance); err != nil {
+		return nil, false, err
 	}
-
-	if rowsAffected == 0 {
-		_, err := r.GetByID(ctx, userID)
-		if err != nil {
-			return domain.ErrUserNotFound
+	if err := recordAdminAction(ctx, tx, userID, domain.AdminActionCoinsDeducted, map[string]interface{}{
+		"amount":        coins,
+		"reason":        reason,
+		"balance_after": user.CoinsBalance,
+	}); err != nil {
+		return nil, false, err
+	}
+	if idempotencyKey != "" {
+		if err := r.storeIdempotentResult(ctx, tx, userID, idempotencyKey, user); err != nil {
+			return nil, false, err
 		}
-		return domain.ErrInsufficientCoinsBalance
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, wrapErr("commit coins deducted", err)
 	}
 
 	log.WithField("user_id", userID).Info("Coins successfully deducted atomically")
-	return nil
+	return user, false, nil
 }
 
-func (r *postgresUserRepository) ActivateSubscriptionAtomic(ctx context.Context, userID string, isTrial bool, trialEndsAt *time.Time, subscriptionEndsAt *time.Time) error {
+// TransferCoins moves coins from one user to another in one transaction and
+// returns both users as updated. Both must exist and be active, and the
+// sender's balance must cover the coins. The two rows are locked in id
+// order, so concurrent transfers in opposite directions cannot deadlock.
+func (r *postgresUserRepository) TransferCoins(ctx context.Context, fromID, toID string, coins int64) (*domain.User, *domain.User, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	defer timing.Record(ctx, "db_user_transfer_coins", time.Now())
+
+	if coins <= 0 {
+		return nil, nil, domain.ErrInvalidCoinsAmount
+	}
 
 	log.WithFields(log.Fields{
-		"user_id":              userID,
-		"is_trial":             isTrial,
-		"subscription_ends_at": subscriptionEndsAt,
-	}).Info("Atomically activating subscription")
+		"from_user_id": fromID,
+		"to_user_id":   toID,
+		"coins":        coins,
+	}).Info("Transferring coins between users")
 
-	query := `
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, wrapErr("begin coin transfer", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, status FROM users
+		WHERE id IN ($1, $2)`+notDeleted+`
+		ORDER BY id
+		FOR UPDATE`, fromID, toID)
+	if err != nil {
+		return nil, nil, wrapErr("lock transfer users", err)
+	}
+	statuses := make(map[string]domain.UserStatus, 2)
+	for rows.Next() {
+		var id string
+		var status domain.UserStatus
+		if err := rows.Scan(&id, &status); err != nil {
+			rows.Close()
+			return nil, nil, wrapErr("scan transfer user", err)
+		}
+		statuses[id] = status
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, wrapErr("iterate transfer users", err)
+	}
+	for _, id := range []string{fromID, toID} {
+		status, ok := statuses[id]
+		if !ok {
+			return nil, nil, domain.ErrUserNotFound
+		}
+		if status != domain.StatusActive {
+			return nil, nil, domain.ErrUserNotActive
+		}
+	}
+
+	from, err := r.scanUser(ctx, tx.QueryRowContext(ctx, `
 		UPDATE users SET
-			is_trial = $1,
-			trial_ends_at = $2,
-			has_subscription = true,
-			subscription_ends_at = $3,
+			coins_balance = coins_balance - $1,
 			updated_at = NOW()
-		WHERE id = $4
-		  AND has_subscription = false
-	`
-
-	result, err := r.db.ExecContext(ctx, query, isTrial, trialEndsAt, subscriptionEndsAt, userID)
+		WHERE id = $2
+		  AND coins_balance >= $1
+		RETURNING `+userColumns, coins, fromID))
+	if err == sql.ErrNoRows {
+		return nil, nil, domain.ErrInsufficientCoinsBalance
+	}
 	if err != nil {
-		log.WithError(err).WithField("user_id", userID).Error("Failed to activate subscription atomically")
-		return fmt.Errorf("failed to activate subscription: %w", err)
+		log.WithError(err).WithField("user_id", fromID).Error("Failed to debit coin transfer")
+		return nil, nil, wrapErr("debit coin transfer", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	to, err := r.scanUser(ctx, tx.QueryRowContext(ctx, `
+		UPDATE users SET
+			coins_balance = coins_balance + $1,
+			updated_at = NOW()
+		WHERE id = $2
+		RETURNING `+userColumns, coins, toID))
 	if err != nil {
-		return fmt.Errorf("could not determine rows affected: %w", err)
+		log.WithError(err).WithField("user_id", toID).Error("Failed to credit coin transfer")
+		return nil, nil, wrapErr("credit coin transfer", err)
 	}
 
-	if rowsAffected == 0 {
-		_, err := r.GetByID(ctx, userID)
-		if err != nil {
-			return domain.ErrUserNotFound
-		}
-		return domain.ErrSubscriptionAlreadyActive
+	if err := recordCoinTransaction(ctx, tx, fromID, coins, domain.CoinDirectionDebit, domain.CoinReasonTransferOut, domain.CoinCategoryTransfer, from.CoinsBalance); err != nil {
+		return nil, nil, err
+	}
+	if err := recordCoinTransaction(ctx, tx, toID, coins, domain.CoinDirectionCredit, domain.CoinReasonTransferIn, domain.CoinCategoryTransfer, to.CoinsBalance); err != nil {
+		return nil, nil, err
+	}
+	if err := recordAdminAction(ctx, tx, fromID, domain.AdminActionCoinsTransferred, map[string]interface{}{
+		"amount":        coins,
+		"to_user_id":    toID,
+		"balance_after": from.CoinsBalance,
+	}); err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, wrapErr("commit coin transfer", err)
 	}
 
-	log.WithField("user_id", userID).Info("Subscription successfully activated atomically")
-	return nil
+	log.WithFields(log.Fields{
+		"from_user_id": fromID,
+		"to_user_id":   toID,
+	}).Info("Coins successfully transferred")
+	return from, to, nil
 }
 
-func (r *postgresUserRepository) RenewSubscriptionAtomic(ctx context.Context, userID string, subscriptionEndsAt *time.Time) error {
+// ActivateSubscriptionAtomic starts a subscription lasting duration, ends any
+// trial, credits bonusCoins as a subscription bonus and returns the user as
+// updated, all in one transaction. idempotencyKey works as for
+// AddCoinsAtomic.
+func (r *postgresUserRepository) ActivateSubscriptionAtomic(ctx context.Context, userID string, duration time.Duration, bonusCoins int64, idempotencyKey string) (*domain.User, bool, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	defer timing.Record(ctx, "db_user_activate_subscription_atomic", time.Now())
 
 	log.WithFields(log.Fields{
-		"user_id":              userID,
-		"subscription_ends_at": subscriptionEndsAt,
-	}).Info("Atomically renewing subscription")
+		"user_id":  userID,
+		"duration": duration,
+	}).Info("Atomically activating subscription")
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, wrapErr("begin subscription activation", err)
+	}
+	defer tx.Rollback()
+
+	if idempotencyKey != "" {
+		previous, replayed, err := r.claimIdempotencyKey(ctx, tx, userID, idempotencyKey, idempotencyRequestHash("activate_subscription", duration), r.idempotencyKeyTTL)
+		if err != nil {
+			return nil, false, err
+		}
+		if replayed {
+			return previous, true, nil
+		}
+	}
 
 	query := `
 		UPDATE users SET
-			subscription_ends_at = $1,
+			is_trial = false,
+			has_subscription = true,
+			subscription_ends_at = NOW() + make_interval(secs => $1),
+			coins_balance = coins_balance + $2,
 			updated_at = NOW()
-		WHERE id = $2
-		  AND has_subscription = true
-	`
+		WHERE id = $3` + notDeleted + `
+		  AND has_subscription = false
+		RETURNING ` + userColumns
 
-	result, err := r.db.ExecContext(ctx, query, subscriptionEndsAt, userID)
-	if err != nil {
-		log.WithError(err).WithField("user_id", userID).Error("Failed to renew subscription atomically")
-		return fmt.Errorf("failed to renew subscription: %w", err)
+	user, err := r.scanUser(ctx, tx.QueryRowContext(ctx, query, duration.Seconds(), bonusCoins, userID))
+	if err == sql.ErrNoRows {
+		if _, err := r.GetByID(ctx, userID, false); err != nil {
+			return nil, false, domain.ErrUserNotFound
+		}
+		return nil, false, domain.ErrSubscriptionAlreadyActive
 	}
-
-	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("could not determine rows affected: %w", err)
+		log.WithError(err).WithField("user_id", userID).Error("Failed to activate subscription atomically")
+		return nil, false, wrapErr("activate subscription", err)
 	}
 
-	if rowsAffected == 0 {
-		_, err := r.GetByID(ctx, userID)
-		if err != nil {
-			return domain.ErrUserNotFound
+	if err := r.recordSubscriptionBonus(ctx, tx, user, bonusCoins, domain.AdminActionSubscriptionActivated); err != nil {
+		return nil, false, err
+	}
+	if idempotencyKey != "" {
+		if err := r.storeIdempotentResult(ctx, tx, userID, idempotencyKey, user); err != nil {
+			return nil, false, err
 		}
-		return domain.ErrNoActiveSubscription
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, wrapErr("commit subscription activation", err)
 	}
 
-	log.WithField("user_id", userID).Info("Subscription successfully renewed atomically")
-	return nil
+	log.WithField("user_id", userID).Info("Subscription successfully activated atomically")
+	return user, false, nil
 }
 
-func (r *postgresUserRepository) Delete(ctx context.Context, id string) error {
+// recordSubscriptionBonus writes the ledger entry and admin actions of a
+// subscription activation or renewal that credited bonusCoins to user.
+func (r *postgresUserRepository) recordSubscriptionBonus(ctx context.Context, tx *sql.Tx, user *domain.User, bonusCoins int64, action string) error {
+	if bonusCoins > 0 {
+		if err := recordCoinTransaction(ctx, tx, user.ID, bonusCoins, domain.CoinDirectionCredit, domain.CoinReasonSubscriptionBonus, domain.CoinCategorySubscription, user.CoinsBalance); err != nil {
+			return err
+		}
+		if err := recordAdminAction(ctx, tx, user.ID, domain.AdminActionCoinsAdded, map[string]interface{}{
+			"amount":        bonusCoins,
+			"reason":        domain.CoinReasonSubscriptionBonus,
+			"balance_after": user.CoinsBalance,
+		}); err != nil {
+			return err
+		}
+	}
+	return recordAdminAction(ctx, tx, user.ID, action, map[string]interface{}{
+		"subscription_ends_at": user.SubscriptionEndsAt,
+	})
+}
+
+// CreateWithSubscription inserts user and immediately activates a subscription
+// ending at subscriptionEndsAt, crediting bonusCoins as a purchase. Both happen
+// in one transaction, so a failed activation leaves no user behind. It returns
+// the user as stored after activation.
+func (r *postgresUserRepository) CreateWithSubscription(ctx context.Context, user *domain.User, bonusCoins int64, subscriptionEndsAt time.Time) (*domain.User, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	defer timing.Record(ctx, "db_user_create_with_subscription", time.Now())
 
-	log.WithField("user_id", id).Info("Deleting user from database")
-
-	query := `DELETE FROM users WHERE id = $1`
+	log.WithFields(log.Fields{
+		"user_id":              user.ID,
+		"subscription_ends_at": subscriptionEndsAt,
+	}).Info("Provisioning user with subscription")
 
-	result, err := r.db.ExecContext(ctx, query, id)
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		log.WithError(err).WithField("user_id", id).Error("Failed to delete user")
-		return fmt.Errorf("failed to delete user: %w", err)
+		return nil, wrapErr("begin provisioning", err)
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
+	email, name, emailHash, err := r.sealUser(ctx, user.Email, user.Name)
 	if err != nil {
-		return fmt.Errorf("could not determine rows affected: %w", err)
-	}
-
-	if rowsAffected == 0 {
-		return domain.ErrUserNotFound
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, insertUserQuery,
+		user.ID,
+		email,
+		name,
+		user.CoinsBalance,
+		user.TotalCoinsPurchased,
+		user.IsTrial,
+		user.TrialEndsAt,
+		user.HasSubscription,
+		user.SubscriptionEndsAt,
+		user.Status,
+		user.EmailVerified,
+		emailHash,
+	)
+	if isUniqueViolation(err) {
+		return nil, domain.ErrEmailAlreadyExists
+	}
+	if err != nil {
+		log.WithError(err).WithField("user_id", user.ID).Error("Failed to insert provisioned user")
+		return nil, wrapErr("create user", err)
+	}
+	if user.CoinsBalance > 0 {
+		if err := recordCoinTransaction(ctx, tx, user.ID, user.CoinsBalance, domain.CoinDirectionCredit, domain.CoinReasonSignupBonus, "", user.CoinsBalance); err != nil {
+			return nil, err
+		}
 	}
 
-	log.WithField("user_id", id).Info("User successfully deleted")
-	return nil
+	query := `
+		UPDATE users SET
+			coins_balance = coins_balance + $1,
+			is_trial = false,
+			has_subscription = true,
+			subscription_ends_at = $2,
+			updated_at = NOW()
+		WHERE id = $3
+		  AND has_subscription = false
+		RETURNING ` + userColumns
+
+	provisioned, err := r.scanUser(ctx, tx.QueryRowContext(ctx, query, bonusCoins, subscriptionEndsAt, user.ID))
+	if err == sql.ErrNoRows {
+		return nil, domain.ErrSubscriptionAlreadyActive
+	}
+	if err != nil {
+		log.WithError(err).WithField("user_id", user.ID).Error("Failed to activate subscription for provisioned user")
+		return nil, wrapErr("activate subscription", err)
+	}
+	if bonusCoins > 0 {
+		if err := recordCoinTransaction(ctx, tx, user.ID, bonusCoins, domain.CoinDirectionCredit, domain.CoinReasonSubscriptionBonus, domain.CoinCategorySubscription, provisioned.CoinsBalance); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, wrapErr("commit provisioning", err)
+	}
+
+	log.WithField("user_id", user.ID).Info("User successfully provisioned with subscription")
+	return provisioned, nil
 }
 
-func (r *postgresUserRepository) List(ctx context.Context, limit, offset int) ([]domain.User, error) {
+// ExpireEntitlements clears has_subscription and is_trial on up to limit users,
+// in ID order after afterID, whose subscription or trial end has passed. It
+// returns the last user ID examined and how many users were updated; a
+// lastID of "" means no users were left.
+func (r *postgresUserRepository) ExpireEntitlements(ctx context.Context, afterID string, limit int) (string, int64, error) {
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+	defer timing.Record(ctx, "db_user_expire_entitlements", time.Now())
 
-	query := `
-		SELECT id, email, name,
-			coins_balance, total_coins_purchased,
-			is_trial, trial_ends_at,
-			has_subscription, subscription_ends_at,
-			status, created_at, updated_at
+	if afterID == "" {
+		afterID = "00000000-0000-0000-0000-000000000000"
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		WITH batch AS (
+			SELECT id FROM users
+			WHERE id > $1
+			  AND ((has_subscription AND subscription_ends_at <= NOW())
+			    OR (is_trial AND trial_ends_at <= NOW()))
+			ORDER BY id
+			LIMIT $2
+		)
+		UPDATE users u SET
+			has_subscription = u.has_subscription AND NOT COALESCE(u.subscription_ends_at <= NOW(), false),
+			is_trial = u.is_trial AND NOT COALESCE(u.trial_ends_at <= NOW(), false),
+			updated_at = NOW()
+		FROM batch
+		WHERE u.id = batch.id
+		RETURNING u.id`, afterID, limit)
+	if err != nil {
+		return "", 0, wrapErr("expire entitlements", err)
+	}
+	defer rows.Close()
+
+	var lastID string
+	var updated int64
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return "", 0, wrapErr("scan expired user", err)
+		}
+		if id > lastID {
+			lastID = id
+		}
+		updated++
+	}
+	if err := rows.Err(); err != nil {
+		return "", 0, wrapErr("iterate expired users", err)
+	}
+
+	return lastID, updated, nil
+}
+
+// BackfillTrialEnds sets trial_ends_at to created_at plus trialLength on up
+// to limit users, in ID order after afterID, that are on a trial with no end
+// time. It returns the last user ID updated and how many were; a lastID of
+// "" means no users were left.
+func (r *postgresUserRepository) BackfillTrialEnds(ctx context.Context, afterID string, trialLength time.Duration, limit int) (string, int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_backfill_trial_ends", time.Now())
+
+	if afterID == "" {
+		afterID = "00000000-0000-0000-0000-000000000000"
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		WITH batch AS (
+			SELECT id FROM users
+			WHERE id > $1
+			  AND is_trial
+			  AND trial_ends_at IS NULL
+			ORDER BY id
+			LIMIT $2
+		)
+		UPDATE users u SET
+			trial_ends_at = u.created_at + make_interval(secs => $3),
+			updated_at = NOW()
+		FROM batch
+		WHERE u.id = batch.id
+		  AND u.trial_ends_at IS NULL
+		RETURNING u.id`, afterID, limit, trialLength.Seconds())
+	if err != nil {
+		return "", 0, wrapErr("backfill trial ends", err)
+	}
+	defer rows.Close()
+
+	var lastID string
+	var updated int64
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return "", 0, wrapErr("scan backfilled user", err)
+		}
+		if id > lastID {
+			lastID = id
+		}
+		updated++
+	}
+	if err := rows.Err(); err != nil {
+		return "", 0, wrapErr("iterate backfilled users", err)
+	}
+
+	return lastID, updated, nil
+}
+
+// FindEntitlementInconsistencies returns, in ID order after afterID, up to
+// limit users whose subscription or trial flag is set with no end time or an
+// end time before staleBefore.
+func (r *postgresUserRepository) FindEntitlementInconsistencies(ctx context.Context, afterID string, staleBefore time.Time, limit int) ([]domain.EntitlementInconsistency, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_find_entitlement_inconsistencies", time.Now())
+
+	if afterID == "" {
+		afterID = "00000000-0000-0000-0000-000000000000"
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id,
+			has_subscription AND subscription_ends_at IS NULL,
+			has_subscription AND COALESCE(subscription_ends_at < $2, false),
+			is_trial AND trial_ends_at IS NULL,
+			is_trial AND COALESCE(trial_ends_at < $2, false)
 		FROM users
-		ORDER BY created_at DESC
-		LIMIT $1 OFFSET $2
-	`
+		WHERE id > $1
+		  AND ((has_subscription AND (subscription_ends_at IS NULL OR subscription_ends_at < $2))
+		    OR (is_trial AND (trial_ends_at IS NULL OR trial_ends_at < $2)))
+		ORDER BY id
+		LIMIT $3`, afterID, staleBefore, limit)
+	if err != nil {
+		return nil, wrapErr("find entitlement inconsistencies", err)
+	}
+	defer rows.Close()
+
+	var found []domain.EntitlementInconsistency
+	for rows.Next() {
+		var item domain.EntitlementInconsistency
+		var subNoEnd, subExpired, trialNoEnd, trialExpired bool
+		if err := rows.Scan(&item.UserID, &subNoEnd, &subExpired, &trialNoEnd, &trialExpired); err != nil {
+			return nil, wrapErr("scan entitlement inconsistency", err)
+		}
+		for _, issue := range []struct {
+			set  bool
+			name string
+		}{
+			{subNoEnd, domain.InconsistencySubscriptionNoEnd},
+			{subExpired, domain.InconsistencySubscriptionExpired},
+			{trialNoEnd, domain.InconsistencyTrialNoEnd},
+			{trialExpired, domain.InconsistencyTrialExpired},
+		} {
+			if issue.set {
+				item.Issues = append(item.Issues, issue.name)
+			}
+		}
+		found = append(found, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("iterate entitlement inconsistencies", err)
+	}
+
+	return found, nil
+}
+
+// RepairEntitlements clears the flags of userIDs the way ExpireEntitlements
+// does, also treating a missing end time as ended. Only users still
+// inconsistent against staleBefore are touched; their IDs are returned.
+func (r *postgresUserRepository) RepairEntitlements(ctx context.Context, userIDs []string, staleBefore time.Time) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_repair_entitlements", time.Now())
 
-	rows, err := r.db.QueryContext(ctx, query, limit, offset)
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE users SET
+			has_subscription = has_subscription AND COALESCE(subscription_ends_at > NOW(), false),
+			is_trial = is_trial AND COALESCE(trial_ends_at > NOW(), false),
+			updated_at = NOW()
+		WHERE id = ANY($1::uuid[])
+		  AND ((has_subscription AND (subscription_ends_at IS NULL OR subscription_ends_at < $2))
+		    OR (is_trial AND (trial_ends_at IS NULL OR trial_ends_at < $2)))
+		RETURNING id`, pq.Array(userIDs), staleBefore)
 	if err != nil {
-		log.WithError(err).Error("Failed to list users")
-		return nil, fmt.Errorf("failed to list users: %w", err)
+		return nil, wrapErr("repair entitlements", err)
 	}
 	defer rows.Close()
 
-	var users []domain.User
+	var repaired []string
 	for rows.Next() {
-		var user domain.User
-		var trialEndsAt, subscriptionEndsAt sql.NullTime
-
-		err := rows.Scan(
-			&user.ID,
-			&user.Email,
-			&user.Name,
-			&user.CoinsBalance,
-			&user.TotalCoinsPurchased,
-			&user.IsTrial,
-			&trialEndsAt,
-			&user.HasSubscription,
-			&subscriptionEndsAt,
-			&user.Status,
-			&user.CreatedAt,
-			&user.UpdatedAt,
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, wrapErr("scan repaired user", err)
+		}
+		repaired = append(repaired, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("iterate repaired users", err)
+	}
+
+	return repaired, nil
+}
+
+// RequestDeletion schedules the user's erasure for scheduledFor and makes the
+// account inactive, remembering its status so a cancellation can restore it.
+func (r *postgresUserRepository) RequestDeletion(ctx context.Context, userID string, requestedAt, scheduledFor time.Time) (*domain.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_request_deletion", time.Now())
+
+	query := `
+		UPDATE users SET
+			status_before_deletion = status,
+			status = $2,
+			deletion_requested_at = $3,
+			deletion_scheduled_for = $4,
+			updated_at = NOW()
+		WHERE id = $1
+		  AND deletion_scheduled_for IS NULL
+		  AND status <> $5
+		RETURNING ` + userColumns
+
+	var user *domain.User
+	details := map[string]interface{}{"scheduled_for": scheduledFor}
+	err := r.withAdminAction(ctx, userID, domain.AdminActionDeletionRequested, details, func(q dbExecutor) error {
+		var err error
+		user, err = r.scanUser(ctx, q.QueryRowContext(ctx, query, userID, domain.StatusInactive, requestedAt, scheduledFor, domain.StatusDeleted))
+		if err == sql.ErrNoRows {
+			current, err := r.GetByID(ctx, userID, true)
+			if err != nil {
+				return err
+			}
+			if current.Status == domain.StatusDeleted {
+				return domain.ErrUserDeleted
+			}
+			return domain.ErrDeletionAlreadyRequested
+		}
+		if err != nil {
+			log.WithError(err).WithField("user_id", userID).Error("Failed to request user deletion")
+			return wrapErr("request deletion", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// CancelDeletion withdraws a pending deletion request and restores the
+// status the user had before it. It only succeeds while the erasure is still
+// scheduled after now; once EraseDueDeletions has claimed the user the
+// conditional UPDATE matches nothing, so a cancellation racing the erasure
+// either fully wins or fully loses.
+func (r *postgresUserRepository) CancelDeletion(ctx context.Context, userID string, now time.Time) (*domain.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_cancel_deletion", time.Now())
+
+	query := `
+		UPDATE users SET
+			status = COALESCE(status_before_deletion, $3),
+			status_before_deletion = NULL,
+			deletion_requested_at = NULL,
+			deletion_scheduled_for = NULL,
+			updated_at = NOW()
+		WHERE id = $1
+		  AND deletion_scheduled_for > $2
+		RETURNING ` + userColumns
+
+	var user *domain.User
+	err := r.withAdminAction(ctx, userID, domain.AdminActionDeletionCancelled, nil, func(q dbExecutor) error {
+		var err error
+		user, err = r.scanUser(ctx, q.QueryRowContext(ctx, query, userID, now, domain.StatusActive))
+		if err == sql.ErrNoRows {
+			current, err := r.GetByID(ctx, userID, true)
+			if err != nil {
+				return err
+			}
+			switch {
+			case current.DeletionPending:
+				return domain.ErrDeletionGraceExpired
+			case current.Status == domain.StatusDeleted:
+				return domain.ErrUserDeleted
+			default:
+				return domain.ErrNoDeletionRequest
+			}
+		}
+		if err != nil {
+			log.WithError(err).WithField("user_id", userID).Error("Failed to cancel user deletion")
+			return wrapErr("cancel deletion", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// EraseDueDeletions erases up to limit users whose deletion was scheduled at
+// or before now: their email and name are replaced with placeholders, their
+// email hash is cleared, their status becomes deleted and they are stamped
+// deleted, so reads hide them as they do soft-deleted users. Orders and other
+// records keep pointing at the anonymized row. Rows locked by a concurrent
+// cancellation are skipped and picked up on a later run if still due. It
+// returns the erased user IDs.
+func (r *postgresUserRepository) EraseDueDeletions(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_erase_due_deletions", time.Now())
+
+	rows, err := r.db.QueryContext(ctx, `
+		WITH due AS (
+			SELECT id FROM users
+			WHERE deletion_scheduled_for <= $1
+			ORDER BY deletion_scheduled_for
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
 		)
+		UPDATE users u SET
+			email = 'deleted-' || u.id || '@deleted.invalid',
+			name = 'Deleted user',
+			email_hash = NULL,
+			email_verified = false,
+			status = $3,
+			status_before_deletion = NULL,
+			deletion_scheduled_for = NULL,
+			deleted_at = NOW(),
+			erased_at = NOW(),
+			updated_at = NOW()
+		FROM due
+		WHERE u.id = due.id
+		RETURNING u.id`, now, limit, domain.StatusDeleted)
+	if err != nil {
+		return nil, wrapErr("erase users", err)
+	}
+	defer rows.Close()
+
+	var erased []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, wrapErr("scan erased user", err)
+		}
+		erased = append(erased, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, wrapErr("iterate erased users", err)
+	}
 
+	return erased, nil
+}
+
+// RenewSubscriptionAtomic extends an active subscription by duration, from
+// its end if that is still ahead and from now otherwise, credits bonusCoins
+// as a subscription bonus and returns the user as updated, all in one
+// transaction. idempotencyKey works as for AddCoinsAtomic.
+func (r *postgresUserRepository) RenewSubscriptionAtomic(ctx context.Context, userID string, duration time.Duration, bonusCoins int64, idempotencyKey string) (*domain.User, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_renew_subscription_atomic", time.Now())
+
+	log.WithFields(log.Fields{
+		"user_id":  userID,
+		"duration": duration,
+	}).Info("Atomically renewing subscription")
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, wrapErr("begin subscription renewal", err)
+	}
+	defer tx.Rollback()
+
+	if idempotencyKey != "" {
+		previous, replayed, err := r.claimIdempotencyKey(ctx, tx, userID, idempotencyKey, idempotencyRequestHash("renew_subscription", duration), r.idempotencyKeyTTL)
 		if err != nil {
-			log.WithError(err).Error("Failed to scan user row")
-			return nil, fmt.Errorf("failed to scan user row: %w", err)
+			return nil, false, err
+		}
+		if replayed {
+			return previous, true, nil
+		}
+	}
+
+	query := `
+		UPDATE users SET
+			subscription_ends_at = GREATEST(COALESCE(subscription_ends_at, NOW()), NOW()) + make_interval(secs => $1),
+			coins_balance = coins_balance + $2,
+			updated_at = NOW()
+		WHERE id = $3` + notDeleted + `
+		  AND has_subscription = true
+		RETURNING ` + userColumns
+
+	user, err := r.scanUser(ctx, tx.QueryRowContext(ctx, query, duration.Seconds(), bonusCoins, userID))
+	if err == sql.ErrNoRows {
+		if _, err := r.GetByID(ctx, userID, false); err != nil {
+			return nil, false, domain.ErrUserNotFound
+		}
+		return nil, false, domain.ErrNoActiveSubscription
+	}
+	if err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to renew subscription atomically")
+		return nil, false, wrapErr("renew subscription", err)
+	}
+
+	if err := r.recordSubscriptionBonus(ctx, tx, user, bonusCoins, domain.AdminActionSubscriptionRenewed); err != nil {
+		return nil, false, err
+	}
+	if idempotencyKey != "" {
+		if err := r.storeIdempotentResult(ctx, tx, userID, idempotencyKey, user); err != nil {
+			return nil, false, err
 		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, wrapErr("commit subscription renewal", err)
+	}
+
+	log.WithField("user_id", userID).Info("Subscription successfully renewed atomically")
+	return user, false, nil
+}
+
+// Delete soft-deletes the user: it is marked deleted and hidden from reads,
+// but its row, and the rows referencing it, are kept.
+func (r *postgresUserRepository) Delete(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_delete", time.Now())
+
+	log.WithField("user_id", id).Info("Soft-deleting user")
+
+	err := r.withAdminAction(ctx, id, domain.AdminActionUserDeleted, nil, func(q dbExecutor) error {
+		result, err := q.ExecContext(ctx, `
+			UPDATE users SET
+				status = $2,
+				deleted_at = NOW(),
+				updated_at = NOW()
+			WHERE id = $1`+notDeleted, id, domain.StatusDeleted)
+		if err != nil {
+			log.WithError(err).WithField("user_id", id).Error("Failed to soft-delete user")
+			return wrapErr("delete user", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return wrapErr("delete user rows affected", err)
+		}
+
+		if rowsAffected == 0 {
+			return domain.ErrUserNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.WithField("user_id", id).Info("User successfully soft-deleted")
+	return nil
+}
+
+// Restore undoes a soft delete, making the user active again. Users the
+// deletion worker erased stay erased: they get ErrUserErased.
+func (r *postgresUserRepository) Restore(ctx context.Context, id string) (*domain.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_restore", time.Now())
 
-		if trialEndsAt.Valid {
-			user.TrialEndsAt = &trialEndsAt.Time
+	query := `
+		UPDATE users SET
+			status = $2,
+			deleted_at = NULL,
+			updated_at = NOW()
+		WHERE id = $1
+		  AND deleted_at IS NOT NULL
+		  AND erased_at IS NULL
+		RETURNING ` + userColumns
+
+	var user *domain.User
+	err := r.withAdminAction(ctx, id, domain.AdminActionUserRestored, nil, func(q dbExecutor) error {
+		var err error
+		user, err = r.scanUser(ctx, q.QueryRowContext(ctx, query, id, domain.StatusActive))
+		if err == sql.ErrNoRows {
+			// Erasure is terminal: the anonymized row is not an account to give back
+			var erased bool
+			err := q.QueryRowContext(ctx, `SELECT erased_at IS NOT NULL FROM users WHERE id = $1`, id).Scan(&erased)
+			switch {
+			case err == sql.ErrNoRows:
+				return domain.ErrUserNotFound
+			case err != nil:
+				return wrapErr("check user to restore", err)
+			case erased:
+				return domain.ErrUserErased
+			}
+			return domain.ErrUserNotDeleted
 		}
-		if subscriptionEndsAt.Valid {
-			user.SubscriptionEndsAt = &subscriptionEndsAt.Time
+		if err != nil {
+			log.WithError(err).WithField("user_id", id).Error("Failed to restore user")
+			return wrapErr("restore user", err)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
 
-		users = append(users, user)
+// HardDelete removes the user's row for good, along with the rows that
+// cascade from it.
+func (r *postgresUserRepository) HardDelete(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_hard_delete", time.Now())
+
+	log.WithField("user_id", id).Info("Deleting user from database")
+
+	query := `DELETE FROM users WHERE id = $1`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		log.WithError(err).WithField("user_id", id).Error("Failed to delete user")
+		return wrapErr("hard delete user", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return wrapErr("hard delete user rows affected", err)
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrUserNotFound
+	}
+
+	log.WithField("user_id", id).Info("User successfully deleted")
+	return nil
+}
+
+// userFilterClause builds the WHERE condition for filter, numbering
+// placeholders from argPos.
+func userFilterClause(filter domain.UserListFilter, argPos int) (string, []interface{}) {
+	var clause strings.Builder
+	args := []interface{}{}
+
+	clause.WriteString("1=1")
+	if !filter.IncludeDeleted {
+		clause.WriteString(notDeleted)
+	}
+	if filter.MinCoins != nil {
+		clause.WriteString(fmt.Sprintf(" AND coins_balance >= $%d", argPos))
+		args = append(args, *filter.MinCoins)
+		argPos++
+	}
+	if filter.MaxCoins != nil {
+		clause.WriteString(fmt.Sprintf(" AND coins_balance <= $%d", argPos))
+		args = append(args, *filter.MaxCoins)
+		argPos++
+	}
+	if filter.HasSubscription != nil {
+		clause.WriteString(fmt.Sprintf(" AND has_subscription = $%d", argPos))
+		args = append(args, *filter.HasSubscription)
+		argPos++
+	}
+	if filter.IsTrial != nil {
+		clause.WriteString(fmt.Sprintf(" AND is_trial = $%d", argPos))
+		args = append(args, *filter.IsTrial)
+		argPos++
+	}
+	if len(filter.Statuses) > 0 {
+		placeholders := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			placeholders[i] = fmt.Sprintf("$%d", argPos)
+			args = append(args, string(status))
+			argPos++
+		}
+		clause.WriteString(" AND status IN (" + strings.Join(placeholders, ", ") + ")")
+	}
+
+	return clause.String(), args
+}
+
+// Count returns how many users match filter, ignoring pagination.
+func (r *postgresUserRepository) Count(ctx context.Context, filter domain.UserListFilter) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_count", time.Now())
+
+	where, args := userFilterClause(filter, 1)
+	var total int64
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE `+where, args...).Scan(&total); err != nil {
+		return 0, wrapErr("count users", err)
+	}
+	return total, nil
+}
+
+func (r *postgresUserRepository) List(ctx context.Context, filter domain.UserListFilter, limit, offset int) ([]domain.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_list", time.Now())
+
+	where, args := userFilterClause(filter, 1)
+	query := fmt.Sprintf(`SELECT `+userColumns+`
+		FROM users
+		WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d OFFSET $%d`, where, len(args)+1, len(args)+2)
+	args = append(args, limit, offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		log.WithError(err).Error("Failed to list users")
+		return nil, wrapErr("list users", err)
+	}
+	defer rows.Close()
+
+	users := []domain.User{}
+	for rows.Next() {
+		user, err := r.scanUser(ctx, rows)
+		if err != nil {
+			log.WithError(err).Error("Failed to scan user row")
+			return nil, wrapErr("scan user row", err)
+		}
+
+		users = append(users, *user)
 	}
 
 	if err := rows.Err(); err != nil {
 		log.WithError(err).Error("Error iterating over user rows")
-		return nil, fmt.Errorf("error iterating over user rows: %w", err)
+		return nil, wrapErr("iterate user rows", err)
 	}
 
 	return users, nil
 }
+
+func (r *postgresUserRepository) CreateEmailVerificationToken(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_create_email_verification_token", time.Now())
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapErr("begin verification token", err)
+	}
+	defer tx.Rollback()
+
+	// Only the most recently sent token is valid
+	if _, err := tx.ExecContext(ctx, `DELETE FROM email_verification_tokens WHERE user_id = $1`, userID); err != nil {
+		return wrapErr("delete previous verification tokens", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO email_verification_tokens (token_hash, user_id, expires_at)
+		VALUES ($1, $2, $3)
+	`, tokenHash, userID, expiresAt)
+	if err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to store email verification token")
+		return wrapErr("store verification token", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return wrapErr("commit verification token", err)
+	}
+
+	return nil
+}
+
+func (r *postgresUserRepository) ConfirmEmailVerification(ctx context.Context, userID, tokenHash string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_confirm_email_verification", time.Now())
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return wrapErr("begin email verification", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		DELETE FROM email_verification_tokens
+		WHERE user_id = $1
+		  AND token_hash = $2
+		  AND expires_at > NOW()
+	`, userID, tokenHash)
+	if err != nil {
+		return wrapErr("consume verification token", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return wrapErr("consume verification token rows affected", err)
+	}
+
+	if rowsAffected == 0 {
+		return domain.ErrInvalidVerificationToken
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE users SET
+			email_verified = true,
+			updated_at = NOW()
+		WHERE id = $1
+	`, userID)
+	if err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to mark email verified")
+		return wrapErr("mark email verified", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return wrapErr("commit email verification", err)
+	}
+
+	log.WithField("user_id", userID).Info("Email successfully verified")
+	return nil
+}
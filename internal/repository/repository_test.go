@@ -0,0 +1,964 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/testutil/factory"
+)
+
+func TestEraseDueDeletionsHidesUser(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+
+	user := factory.User()
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	now := time.Now()
+	if _, err := repo.RequestDeletion(ctx, user.ID, now.Add(-time.Hour), now.Add(-time.Minute)); err != nil {
+		t.Fatalf("RequestDeletion: %v", err)
+	}
+
+	erased, err := repo.EraseDueDeletions(ctx, now, 10)
+	if err != nil {
+		t.Fatalf("EraseDueDeletions: %v", err)
+	}
+	if len(erased) != 1 || erased[0] != user.ID {
+		t.Fatalf("erased %v, want [%s]", erased, user.ID)
+	}
+	if _, err := repo.GetByID(ctx, user.ID, false); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Fatalf("GetByID after erasure: got %v, want ErrUserNotFound", err)
+	}
+	if _, err := repo.GetByID(ctx, user.ID, true); err != nil {
+		t.Fatalf("GetByID including deleted: %v", err)
+	}
+}
+
+func TestRestoreRefusesErasedUsers(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+
+	erased, deleted := factory.User(), factory.User()
+	for _, user := range []*domain.User{erased, deleted} {
+		if err := repo.Create(ctx, user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	now := time.Now()
+	if _, err := repo.RequestDeletion(ctx, erased.ID, now.Add(-time.Hour), now.Add(-time.Minute)); err != nil {
+		t.Fatalf("RequestDeletion: %v", err)
+	}
+	if _, err := repo.EraseDueDeletions(ctx, now, 10); err != nil {
+		t.Fatalf("EraseDueDeletions: %v", err)
+	}
+	if err := repo.Delete(ctx, deleted.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	if _, err := repo.Restore(ctx, erased.ID); !errors.Is(err, domain.ErrUserErased) {
+		t.Fatalf("Restore erased user: got %v, want ErrUserErased", err)
+	}
+	got, err := repo.GetByID(ctx, erased.ID, true)
+	if err != nil {
+		t.Fatalf("GetByID including deleted: %v", err)
+	}
+	if got.Status != domain.StatusDeleted || got.DeletedAt == nil || got.Name != "Deleted user" {
+		t.Errorf("erased user changed by Restore: %+v", got)
+	}
+
+	// A soft delete is still undone
+	restored, err := repo.Restore(ctx, deleted.ID)
+	if err != nil {
+		t.Fatalf("Restore soft-deleted user: %v", err)
+	}
+	if restored.Status != domain.StatusActive || restored.DeletedAt != nil {
+		t.Errorf("restored %+v, want active and not deleted", restored)
+	}
+	if _, err := repo.Restore(ctx, deleted.ID); !errors.Is(err, domain.ErrUserNotDeleted) {
+		t.Errorf("Restore live user: got %v, want ErrUserNotDeleted", err)
+	}
+}
+
+func TestCoinMutationsSkipDeletedUsers(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+
+	user := factory.User()
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, _, err := repo.AddCoinsAtomic(ctx, user.ID, 100, domain.CoinReasonPurchase, ""); err != nil {
+		t.Fatalf("AddCoinsAtomic: %v", err)
+	}
+	if err := repo.Delete(ctx, user.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	if _, _, err := repo.AddCoinsAtomic(ctx, user.ID, 10, domain.CoinReasonPurchase, ""); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Errorf("AddCoinsAtomic: got %v, want ErrUserNotFound", err)
+	}
+	if _, _, err := repo.DeductCoinsAtomic(ctx, user.ID, 10, domain.CoinReasonSpend, ""); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Errorf("DeductCoinsAtomic: got %v, want ErrUserNotFound", err)
+	}
+	if _, _, err := repo.ActivateSubscriptionAtomic(ctx, user.ID, time.Hour, 0, ""); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Errorf("ActivateSubscriptionAtomic: got %v, want ErrUserNotFound", err)
+	}
+
+	got, err := repo.GetByID(ctx, user.ID, true)
+	if err != nil {
+		t.Fatalf("GetByID including deleted: %v", err)
+	}
+	if got.CoinsBalance != 100 {
+		t.Errorf("balance %d, want 100", got.CoinsBalance)
+	}
+}
+
+func TestCoinMutationsReturnUpdatedUser(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+	user := createFundedUser(t, repo, 100)
+
+	steps := []struct {
+		name        string
+		mutate      func() (*domain.User, bool, error)
+		wantBalance int64
+		wantErr     error
+	}{
+		{"add", func() (*domain.User, bool, error) {
+			return repo.AddCoinsAtomic(ctx, user.ID, 50, domain.CoinReasonPurchase, "")
+		}, 150, nil},
+		{"deduct", func() (*domain.User, bool, error) {
+			return repo.DeductCoinsAtomic(ctx, user.ID, 30, domain.CoinReasonSpend, "deduct-731")
+		}, 120, nil},
+		{"deduct replayed", func() (*domain.User, bool, error) {
+			return repo.DeductCoinsAtomic(ctx, user.ID, 30, domain.CoinReasonSpend, "deduct-731")
+		}, 120, nil},
+		{"deduct too much", func() (*domain.User, bool, error) {
+			return repo.DeductCoinsAtomic(ctx, user.ID, 500, domain.CoinReasonSpend, "")
+		}, 120, domain.ErrInsufficientCoinsBalance},
+		{"deduct to zero", func() (*domain.User, bool, error) {
+			return repo.DeductCoinsAtomic(ctx, user.ID, 120, domain.CoinReasonSpend, "")
+		}, 0, nil},
+	}
+	for _, step := range steps {
+		returned, _, err := step.mutate()
+		if !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: err = %v, want %v", step.name, err, step.wantErr)
+		}
+		stored, getErr := repo.GetByID(ctx, user.ID, false)
+		if getErr != nil {
+			t.Fatalf("GetByID: %v", getErr)
+		}
+		if stored.CoinsBalance != step.wantBalance {
+			t.Errorf("%s: stored balance %d, want %d", step.name, stored.CoinsBalance, step.wantBalance)
+		}
+		if err != nil {
+			continue
+		}
+		// The returned row is the one the update wrote, not a read before it
+		if returned.ID != user.ID || returned.CoinsBalance != stored.CoinsBalance || !returned.UpdatedAt.Equal(stored.UpdatedAt) {
+			t.Errorf("%s: returned %s with balance %d updated %v, stored balance %d updated %v",
+				step.name, returned.ID, returned.CoinsBalance, returned.UpdatedAt, stored.CoinsBalance, stored.UpdatedAt)
+		}
+	}
+}
+
+func TestAddCoinsCountsOnlyPurchasesAsPurchased(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+
+	user := createFundedUser(t, repo, 50)
+	got, _, err := repo.AddCoinsAtomic(ctx, user.ID, 20, "promo_code", "")
+	if err != nil {
+		t.Fatalf("AddCoinsAtomic: %v", err)
+	}
+	if got.CoinsBalance != 70 || got.TotalCoinsPurchased != 50 {
+		t.Fatalf("balance %d, purchased %d: want 70 and 50", got.CoinsBalance, got.TotalCoinsPurchased)
+	}
+
+	// Subscription bonuses are granted, not bought
+	if got, _, err = repo.ActivateSubscriptionAtomic(ctx, user.ID, time.Hour, 30, ""); err != nil {
+		t.Fatalf("ActivateSubscriptionAtomic: %v", err)
+	}
+	if got.CoinsBalance != 100 || got.TotalCoinsPurchased != 50 {
+		t.Fatalf("after activation: balance %d, purchased %d: want 100 and 50", got.CoinsBalance, got.TotalCoinsPurchased)
+	}
+	if got, _, err = repo.RenewSubscriptionAtomic(ctx, user.ID, time.Hour, 30, ""); err != nil {
+		t.Fatalf("RenewSubscriptionAtomic: %v", err)
+	}
+	if got.CoinsBalance != 130 || got.TotalCoinsPurchased != 50 {
+		t.Fatalf("after renewal: balance %d, purchased %d: want 130 and 50", got.CoinsBalance, got.TotalCoinsPurchased)
+	}
+}
+
+func TestBackfillTrialEndsInBatches(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+
+	// Users imported from the old system are on a trial with no end
+	for i := 0; i < 3; i++ {
+		user := factory.User()
+		user.TrialEndsAt = nil
+		if err := repo.Create(ctx, user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	const trialLength = 48 * time.Hour
+	lastID, updated, err := repo.BackfillTrialEnds(ctx, "", trialLength, 2)
+	if err != nil {
+		t.Fatalf("first batch: %v", err)
+	}
+	if updated != 2 || lastID == "" {
+		t.Fatalf("first batch updated %d up to %q, want 2", updated, lastID)
+	}
+	_, updated, err = repo.BackfillTrialEnds(ctx, lastID, trialLength, 2)
+	if err != nil {
+		t.Fatalf("second batch: %v", err)
+	}
+	if updated != 1 {
+		t.Fatalf("second batch updated %d, want 1", updated)
+	}
+
+	var wrong int
+	err = db.QueryRow(`
+		SELECT COUNT(*) FROM users
+		WHERE trial_ends_at IS DISTINCT FROM created_at + make_interval(secs => $1)`, trialLength.Seconds()).Scan(&wrong)
+	if err != nil {
+		t.Fatalf("check trial ends: %v", err)
+	}
+	if wrong != 0 {
+		t.Errorf("%d users without the backfilled trial end", wrong)
+	}
+}
+
+// fakeClock is the time passed to the deletion methods, moved by hand.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestDeletionGracePeriodExpiry(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+
+	const grace = 72 * time.Hour
+	clock := &fakeClock{now: time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)}
+	user := factory.User(factory.WithStatus(domain.StatusSuspended))
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// Cancelled within the grace period, the user gets their status back
+	if _, err := repo.RequestDeletion(ctx, user.ID, clock.now, clock.now.Add(grace)); err != nil {
+		t.Fatalf("RequestDeletion: %v", err)
+	}
+	clock.Advance(grace - time.Second)
+	if erased, err := repo.EraseDueDeletions(ctx, clock.now, 10); err != nil || len(erased) != 0 {
+		t.Fatalf("EraseDueDeletions before the grace period ended: erased %v, %v", erased, err)
+	}
+	restored, err := repo.CancelDeletion(ctx, user.ID, clock.now)
+	if err != nil {
+		t.Fatalf("CancelDeletion within the grace period: %v", err)
+	}
+	if restored.Status != domain.StatusSuspended || restored.DeletionPending {
+		t.Fatalf("after cancellation status %s, pending %v: want suspended, not pending", restored.Status, restored.DeletionPending)
+	}
+	if _, err := repo.CancelDeletion(ctx, user.ID, clock.now); !errors.Is(err, domain.ErrNoDeletionRequest) {
+		t.Fatalf("second CancelDeletion: got %v, want ErrNoDeletionRequest", err)
+	}
+
+	// Once the grace period has passed it can't be cancelled, even before
+	// the erasure has run
+	if _, err := repo.RequestDeletion(ctx, user.ID, clock.now, clock.now.Add(grace)); err != nil {
+		t.Fatalf("second RequestDeletion: %v", err)
+	}
+	if _, err := repo.RequestDeletion(ctx, user.ID, clock.now, clock.now.Add(grace)); !errors.Is(err, domain.ErrDeletionAlreadyRequested) {
+		t.Fatalf("repeated RequestDeletion: got %v, want ErrDeletionAlreadyRequested", err)
+	}
+	clock.Advance(grace)
+	if _, err := repo.CancelDeletion(ctx, user.ID, clock.now); !errors.Is(err, domain.ErrDeletionGraceExpired) {
+		t.Fatalf("CancelDeletion at the end of the grace period: got %v, want ErrDeletionGraceExpired", err)
+	}
+
+	erased, err := repo.EraseDueDeletions(ctx, clock.now, 10)
+	if err != nil {
+		t.Fatalf("EraseDueDeletions: %v", err)
+	}
+	if len(erased) != 1 || erased[0] != user.ID {
+		t.Fatalf("erased %v, want [%s]", erased, user.ID)
+	}
+	if _, err := repo.CancelDeletion(ctx, user.ID, clock.now); !errors.Is(err, domain.ErrUserDeleted) {
+		t.Fatalf("CancelDeletion after erasure: got %v, want ErrUserDeleted", err)
+	}
+
+	got, err := repo.GetByID(ctx, user.ID, true)
+	if err != nil {
+		t.Fatalf("GetByID including deleted: %v", err)
+	}
+	if got.Status != domain.StatusDeleted || got.Email == user.Email || got.Name == user.Name {
+		t.Errorf("erased user kept status %s, email %q, name %q", got.Status, got.Email, got.Name)
+	}
+}
+
+// TestCancelDeletionRacesErasure runs a cancellation that is still in time
+// against an erasure that is due, which clocks on two replicas can disagree
+// about. Exactly one of them must take effect.
+func TestCancelDeletionRacesErasure(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+
+	scheduledFor := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		user := factory.User()
+		if err := repo.Create(ctx, user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if _, err := repo.RequestDeletion(ctx, user.ID, scheduledFor.Add(-time.Hour), scheduledFor); err != nil {
+			t.Fatalf("RequestDeletion: %v", err)
+		}
+
+		var (
+			wg        sync.WaitGroup
+			cancelErr error
+			erased    []string
+			eraseErr  error
+		)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, cancelErr = repo.CancelDeletion(ctx, user.ID, scheduledFor.Add(-time.Second))
+		}()
+		go func() {
+			defer wg.Done()
+			erased, eraseErr = repo.EraseDueDeletions(ctx, scheduledFor.Add(time.Second), 10)
+		}()
+		wg.Wait()
+		if eraseErr != nil {
+			t.Fatalf("EraseDueDeletions: %v", eraseErr)
+		}
+		if cancelErr != nil && !errors.Is(cancelErr, domain.ErrUserDeleted) {
+			t.Fatalf("CancelDeletion: %v", cancelErr)
+		}
+
+		cancelled := cancelErr == nil
+		if cancelled == (len(erased) == 1) {
+			t.Fatalf("run %d: cancelled %v and erased %v", i, cancelled, erased)
+		}
+		got, err := repo.GetByID(ctx, user.ID, true)
+		if err != nil {
+			t.Fatalf("GetByID including deleted: %v", err)
+		}
+		if cancelled && (got.Status != domain.StatusActive || got.DeletedAt != nil) {
+			t.Fatalf("run %d: cancelled user has status %s, deleted at %v", i, got.Status, got.DeletedAt)
+		}
+		if !cancelled && (got.Status != domain.StatusDeleted || got.DeletionPending) {
+			t.Fatalf("run %d: erased user has status %s, pending %v", i, got.Status, got.DeletionPending)
+		}
+	}
+}
+
+func TestConcurrentEmailChangeToSameAddress(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+
+	for i := 0; i < 10; i++ {
+		first, second := factory.User(), factory.User()
+		for _, user := range []*domain.User{first, second} {
+			if err := repo.Create(ctx, user); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+
+		email := factory.User().Email
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for j, user := range []*domain.User{first, second} {
+			wg.Add(1)
+			go func(j int, userID string) {
+				defer wg.Done()
+				errs[j] = repo.Update(ctx, userID, &domain.UpdateUserFields{Email: &email})
+			}(j, user.ID)
+		}
+		wg.Wait()
+
+		succeeded := 0
+		for _, err := range errs {
+			switch {
+			case err == nil:
+				succeeded++
+			case !errors.Is(err, domain.ErrEmailAlreadyExists):
+				t.Fatalf("Update: got %v, want ErrEmailAlreadyExists", err)
+			}
+		}
+		if succeeded != 1 {
+			t.Fatalf("run %d: %d updates succeeded, want 1", i, succeeded)
+		}
+	}
+}
+
+func TestEmailChangeInvalidatesVerificationToken(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+
+	user := factory.User()
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := repo.CreateEmailVerificationToken(ctx, user.ID, "token-for-old-address", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("CreateEmailVerificationToken: %v", err)
+	}
+
+	// A name change keeps the token
+	name := "Renamed"
+	if err := repo.Update(ctx, user.ID, &domain.UpdateUserFields{Name: &name}); err != nil {
+		t.Fatalf("Update name: %v", err)
+	}
+	var tokens int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM email_verification_tokens WHERE user_id = $1`, user.ID).Scan(&tokens); err != nil || tokens != 1 {
+		t.Fatalf("after a name change: %d tokens, %v, want 1", tokens, err)
+	}
+
+	email := factory.User().Email
+	if err := repo.Update(ctx, user.ID, &domain.UpdateUserFields{Email: &email}); err != nil {
+		t.Fatalf("Update email: %v", err)
+	}
+	if err := repo.ConfirmEmailVerification(ctx, user.ID, "token-for-old-address"); !errors.Is(err, domain.ErrInvalidVerificationToken) {
+		t.Fatalf("old token after an email change: got %v, want ErrInvalidVerificationToken", err)
+	}
+	got, err := repo.GetByID(ctx, user.ID, false)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Email != email || got.EmailVerified {
+		t.Errorf("got %s verified %v, want %s unverified", got.Email, got.EmailVerified, email)
+	}
+
+	// A token sent to the new address verifies it
+	if err := repo.CreateEmailVerificationToken(ctx, user.ID, "token-for-new-address", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("CreateEmailVerificationToken: %v", err)
+	}
+	if err := repo.ConfirmEmailVerification(ctx, user.ID, "token-for-new-address"); err != nil {
+		t.Errorf("new token: %v", err)
+	}
+}
+
+// assertNoUserRows fails if anything of userID was left behind.
+func assertNoUserRows(t *testing.T, repo *postgresUserRepository, userID string) {
+	t.Helper()
+	var users, entries int
+	err := repo.db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM users WHERE id = $1), (SELECT COUNT(*) FROM coin_transactions WHERE user_id = $1)`,
+		userID,
+	).Scan(&users, &entries)
+	if err != nil {
+		t.Fatalf("count user rows: %v", err)
+	}
+	if users != 0 || entries != 0 {
+		t.Errorf("%d user rows and %d ledger entries left behind, want none", users, entries)
+	}
+}
+
+func TestCreateWithSubscription(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+	endsAt := time.Now().Add(30 * 24 * time.Hour).UTC().Truncate(time.Microsecond)
+
+	t.Run("provisioned", func(t *testing.T) {
+		user := factory.User()
+		user.CoinsBalance = 100
+		provisioned, err := repo.CreateWithSubscription(ctx, user, 5000, endsAt)
+		if err != nil {
+			t.Fatalf("CreateWithSubscription: %v", err)
+		}
+		if !provisioned.HasSubscription || provisioned.IsTrial || provisioned.SubscriptionEndsAt == nil || !provisioned.SubscriptionEndsAt.Equal(endsAt) {
+			t.Errorf("provisioned %+v, want a subscription ending at %v instead of the trial", provisioned, endsAt)
+		}
+		if provisioned.CoinsBalance != 5100 || provisioned.TotalCoinsPurchased != 0 {
+			t.Errorf("balance %d, purchased %d: want the signup bonus plus the subscription bonus, none of it purchased",
+				provisioned.CoinsBalance, provisioned.TotalCoinsPurchased)
+		}
+		stored, err := repo.GetByID(ctx, user.ID, false)
+		if err != nil || !stored.HasSubscription {
+			t.Fatalf("stored %+v, %v; want the subscribed user", stored, err)
+		}
+		entries, _, err := repo.ListCoinTransactions(ctx, user.ID, 10, 0)
+		if err != nil || len(entries) != 2 {
+			t.Fatalf("ledger %+v, %v; want the two bonuses", entries, err)
+		}
+	})
+
+	t.Run("activation fails", func(t *testing.T) {
+		// The activation only applies to a user without a subscription, so
+		// one inserted with a subscription already makes it fail
+		user := factory.User(factory.WithActiveSubscription(endsAt))
+		user.CoinsBalance = 100
+		if _, err := repo.CreateWithSubscription(ctx, user, 5000, endsAt); !errors.Is(err, domain.ErrSubscriptionAlreadyActive) {
+			t.Fatalf("CreateWithSubscription: %v, want ErrSubscriptionAlreadyActive", err)
+		}
+		assertNoUserRows(t, repo, user.ID)
+	})
+
+	t.Run("activation errors", func(t *testing.T) {
+		// A bonus the balance can't hold fails the UPDATE itself
+		user := factory.User()
+		user.CoinsBalance = 100
+		if _, err := repo.CreateWithSubscription(ctx, user, math.MaxInt64, endsAt); err == nil {
+			t.Fatal("CreateWithSubscription: succeeded, want the overflowing bonus rejected")
+		}
+		assertNoUserRows(t, repo, user.ID)
+		// The email is free again
+		retry := factory.User(factory.WithEmail(user.Email))
+		if _, err := repo.CreateWithSubscription(ctx, retry, 5000, endsAt); err != nil {
+			t.Fatalf("retry: %v", err)
+		}
+	})
+}
+
+// pageThrough collects the IDs of every page of size limit, failing on an ID
+// seen on an earlier page.
+func pageThrough(t *testing.T, total, limit int, page func(limit, offset int) []string) []string {
+	t.Helper()
+	seen := map[string]int{}
+	var ids []string
+	for offset := 0; offset < total+limit; offset += limit {
+		for _, id := range page(limit, offset) {
+			if first, dup := seen[id]; dup {
+				t.Errorf("%s on the page at offset %d and again at %d", id, first, offset)
+			}
+			seen[id] = offset
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) != total {
+		t.Errorf("paged through %d rows, want %d", len(ids), total)
+	}
+	return ids
+}
+
+func TestListPagesAreStableWithSharedTimestamps(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	users := NewPostgresUserRepository(db)
+	products := NewPostgresProductRepository(db)
+
+	// As if bulk-inserted in one transaction
+	const rows, limit = 25, 7
+	categoryID := createTestCategory(t, db)
+	for i := 0; i < rows; i++ {
+		if err := users.Create(ctx, factory.User()); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		product := factory.Product()
+		if _, err := products.Create(ctx, domain.CreateProductRequest{
+			CategoryID: categoryID,
+			Slug:       product.Slug,
+			Name:       product.Name,
+			PriceCoins: product.PriceCoins,
+		}, 0); err != nil {
+			t.Fatalf("Create product: %v", err)
+		}
+	}
+	for _, table := range []string{"users", "products"} {
+		if _, err := db.Exec(`UPDATE ` + table + ` SET created_at = '2026-01-01T00:00:00Z'`); err != nil {
+			t.Fatalf("share %s timestamp: %v", table, err)
+		}
+	}
+
+	listUsers := func(limit, offset int) []string {
+		page, err := users.List(ctx, domain.UserListFilter{}, limit, offset)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		ids := make([]string, len(page))
+		for i, u := range page {
+			ids[i] = u.ID
+		}
+		return ids
+	}
+	listProducts := func(limit, offset int) []string {
+		page, _, err := products.ListAll(ctx, domain.AdminProductQuery{SortBy: "created_at", Descending: true, Limit: limit, Offset: offset})
+		if err != nil {
+			t.Fatalf("ListAll: %v", err)
+		}
+		ids := make([]string, len(page))
+		for i, p := range page {
+			ids[i] = p.ID
+		}
+		return ids
+	}
+
+	for name, list := range map[string]func(limit, offset int) []string{"users": listUsers, "products": listProducts} {
+		first := pageThrough(t, rows, limit, list)
+		again := pageThrough(t, rows, limit, list)
+		for i := range first {
+			if i < len(again) && first[i] != again[i] {
+				t.Errorf("%s: row %d is %s, then %s", name, i, first[i], again[i])
+			}
+		}
+		// Ties are broken by id, descending
+		for i := 1; i < len(first); i++ {
+			if first[i-1] < first[i] {
+				t.Errorf("%s: %s before %s", name, first[i-1], first[i])
+			}
+		}
+	}
+}
+
+func TestUserFilterClauseCoinRange(t *testing.T) {
+	minCoins, maxCoins := int64(100), int64(500)
+	active := domain.StatusActive
+	tests := []struct {
+		name       string
+		filter     domain.UserListFilter
+		wantClause string
+		wantArgs   []interface{}
+	}{
+		{"no range", domain.UserListFilter{}, "1=1" + notDeleted, []interface{}{}},
+		{"only min", domain.UserListFilter{MinCoins: &minCoins}, "1=1" + notDeleted + " AND coins_balance >= $3", []interface{}{minCoins}},
+		{"only max", domain.UserListFilter{MaxCoins: &maxCoins}, "1=1" + notDeleted + " AND coins_balance <= $3", []interface{}{maxCoins}},
+		{"both", domain.UserListFilter{MinCoins: &minCoins, MaxCoins: &maxCoins},
+			"1=1" + notDeleted + " AND coins_balance >= $3 AND coins_balance <= $4", []interface{}{minCoins, maxCoins}},
+		{"with status", domain.UserListFilter{MaxCoins: &maxCoins, Statuses: []domain.UserStatus{active}},
+			"1=1" + notDeleted + " AND coins_balance <= $3 AND status IN ($4)", []interface{}{maxCoins, "active"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clause, args := userFilterClause(tt.filter, 3)
+			if clause != tt.wantClause {
+				t.Errorf("clause %q, want %q", clause, tt.wantClause)
+			}
+			if fmt.Sprint(args) != fmt.Sprint(tt.wantArgs) {
+				t.Errorf("args %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestListFiltersByCoinRange(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+
+	// A band of balances no other test's users fall into
+	base := int64(1_000_000_000_000) + time.Now().UnixNano()%1_000_000*1000
+	balances := []int64{base, base + 100, base + 200, base + 300}
+	ids := make(map[int64]string, len(balances))
+	for _, balance := range balances {
+		user := factory.User()
+		if err := repo.Create(ctx, user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if _, err := db.Exec(`UPDATE users SET coins_balance = $2 WHERE id = $1`, user.ID, balance); err != nil {
+			t.Fatalf("set balance: %v", err)
+		}
+		ids[balance] = user.ID
+	}
+	suspended := ids[base+200]
+	if _, err := db.Exec(`UPDATE users SET status = 'suspended' WHERE id = $1`, suspended); err != nil {
+		t.Fatalf("suspend: %v", err)
+	}
+
+	at := func(offset int64) *int64 { v := base + offset; return &v }
+	tests := []struct {
+		name   string
+		filter domain.UserListFilter
+		want   []int64
+	}{
+		{"closed range", domain.UserListFilter{MinCoins: at(100), MaxCoins: at(200)}, []int64{base + 100, base + 200}},
+		{"single value", domain.UserListFilter{MinCoins: at(100), MaxCoins: at(100)}, []int64{base + 100}},
+		{"only min", domain.UserListFilter{MinCoins: at(200)}, []int64{base + 200, base + 300}},
+		{"max from the band start", domain.UserListFilter{MinCoins: at(0), MaxCoins: at(100)}, []int64{base, base + 100}},
+		{"with status", domain.UserListFilter{MinCoins: at(0), Statuses: []domain.UserStatus{domain.StatusActive}}, []int64{base, base + 100, base + 300}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users, err := repo.List(ctx, tt.filter, domain.MaxListLimit, 0)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			total, err := repo.Count(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("Count: %v", err)
+			}
+			got := map[string]bool{}
+			for _, u := range users {
+				got[u.ID] = true
+			}
+			if len(users) != len(tt.want) || total != int64(len(tt.want)) {
+				t.Errorf("listed %d, counted %d, want %d", len(users), total, len(tt.want))
+			}
+			for _, balance := range tt.want {
+				if !got[ids[balance]] {
+					t.Errorf("user with %d coins not listed", balance-base)
+				}
+			}
+		})
+	}
+
+	// Only max, without a min, reaches below the band too
+	users, err := repo.List(ctx, domain.UserListFilter{MaxCoins: at(0)}, domain.MaxListLimit, 0)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	for _, u := range users {
+		if u.CoinsBalance > base {
+			t.Errorf("user with %d coins listed under max_coins", u.CoinsBalance)
+		}
+	}
+}
+
+func TestUnicodeNamesRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+	names := []string{
+		"مريم الأحمد",
+		"דוד כהן",
+		"Ada 👩\u200d💻",
+		"José",
+		"می\u200cخواهم",
+	}
+
+	for _, name := range names {
+		user := factory.User()
+		user.Name = name
+		if err := repo.Create(ctx, user); err != nil {
+			t.Fatalf("Create %q: %v", name, err)
+		}
+		got, err := repo.GetByID(ctx, user.ID, false)
+		if err != nil || got.Name != name {
+			t.Errorf("created %q, read back %v, %v", name, got, err)
+		}
+
+		renamed := name + " 🇺🇦"
+		if err := repo.Update(ctx, user.ID, &domain.UpdateUserFields{Name: &renamed}); err != nil {
+			t.Fatalf("Update %q: %v", renamed, err)
+		}
+		if got, err := repo.GetByID(ctx, user.ID, false); err != nil || got.Name != renamed {
+			t.Errorf("renamed to %q, read back %v, %v", renamed, got, err)
+		}
+	}
+}
+
+// setEntitlements writes a user's subscription and trial columns directly,
+// as manual SQL or an old bug would leave them.
+func setEntitlements(t *testing.T, db *sql.DB, userID string, hasSubscription bool, subscriptionEnd *time.Time, isTrial bool, trialEnd *time.Time) {
+	t.Helper()
+	_, err := db.Exec(`UPDATE users SET has_subscription = $2, subscription_ends_at = $3, is_trial = $4, trial_ends_at = $5 WHERE id = $1`,
+		userID, hasSubscription, subscriptionEnd, isTrial, trialEnd)
+	if err != nil {
+		t.Fatalf("seed entitlements: %v", err)
+	}
+}
+
+func TestEntitlementInconsistencyClasses(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+
+	now := time.Now().UTC()
+	staleBefore := now.Add(-24 * time.Hour)
+	at := func(d time.Duration) *time.Time {
+		v := now.Add(d)
+		return &v
+	}
+	seeds := []struct {
+		name            string
+		hasSubscription bool
+		subscriptionEnd *time.Time
+		isTrial         bool
+		trialEnd        *time.Time
+		wantIssues      []string
+	}{
+		{"subscription without end", true, nil, false, nil, []string{domain.InconsistencySubscriptionNoEnd}},
+		{"subscription long expired", true, at(-72 * time.Hour), false, nil, []string{domain.InconsistencySubscriptionExpired}},
+		{"trial without end", false, nil, true, nil, []string{domain.InconsistencyTrialNoEnd}},
+		{"trial long expired", false, nil, true, at(-72 * time.Hour), []string{domain.InconsistencyTrialExpired}},
+		{"both broken", true, nil, true, at(-48 * time.Hour), []string{domain.InconsistencySubscriptionNoEnd, domain.InconsistencyTrialExpired}},
+		// Left to the expiry sweep, which has not had its chance yet
+		{"subscription just expired", true, at(-time.Hour), false, nil, nil},
+		{"trial just expired", false, nil, true, at(-time.Hour), nil},
+		{"active subscription", true, at(time.Hour), false, nil, nil},
+		{"active trial", false, nil, true, at(time.Hour), nil},
+		{"flags cleared", false, nil, false, nil, nil},
+		{"cleared with stale ends", false, at(-72 * time.Hour), false, at(-72 * time.Hour), nil},
+	}
+	names := map[string]string{}
+	want := map[string][]string{}
+	// wantFlags is what repair leaves: consistent users untouched, and for
+	// the rest, as in the expiry sweep, only flags with a future end.
+	wantFlags := map[string][2]bool{}
+	alive := func(end *time.Time) bool { return end != nil && end.After(now) }
+	for _, seed := range seeds {
+		user := factory.User()
+		if err := repo.Create(ctx, user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		setEntitlements(t, db, user.ID, seed.hasSubscription, seed.subscriptionEnd, seed.isTrial, seed.trialEnd)
+		names[user.ID] = seed.name
+		wantFlags[user.ID] = [2]bool{seed.hasSubscription, seed.isTrial}
+		if seed.wantIssues != nil {
+			want[user.ID] = seed.wantIssues
+			wantFlags[user.ID] = [2]bool{seed.hasSubscription && alive(seed.subscriptionEnd), seed.isTrial && alive(seed.trialEnd)}
+		}
+	}
+
+	// Page through in batches smaller than the result to cover the cursor
+	found := map[string][]string{}
+	afterID := ""
+	for {
+		batch, err := repo.FindEntitlementInconsistencies(ctx, afterID, staleBefore, 2)
+		if err != nil {
+			t.Fatalf("FindEntitlementInconsistencies: %v", err)
+		}
+		for _, item := range batch {
+			if item.UserID <= afterID {
+				t.Fatalf("%s returned after %s, out of order", item.UserID, afterID)
+			}
+			found[item.UserID] = item.Issues
+			afterID = item.UserID
+		}
+		if len(batch) < 2 {
+			break
+		}
+	}
+	for id, issues := range found {
+		if fmt.Sprint(issues) != fmt.Sprint(want[id]) {
+			t.Errorf("%s: issues %v, want %v", names[id], issues, want[id])
+		}
+	}
+	for id, issues := range want {
+		if _, ok := found[id]; !ok {
+			t.Errorf("%s: not found, want %v", names[id], issues)
+		}
+	}
+
+	ids := make([]string, 0, len(names))
+	for id := range names {
+		ids = append(ids, id)
+	}
+	repaired, err := repo.RepairEntitlements(ctx, ids, staleBefore)
+	if err != nil {
+		t.Fatalf("RepairEntitlements: %v", err)
+	}
+	if len(repaired) != len(want) {
+		t.Errorf("repaired %d users, want only the %d inconsistent ones", len(repaired), len(want))
+	}
+	for _, id := range repaired {
+		if _, ok := want[id]; !ok {
+			t.Errorf("%s: repaired although consistent", names[id])
+		}
+	}
+
+	for id, name := range names {
+		var flags [2]bool
+		if err := db.QueryRow(`SELECT has_subscription, is_trial FROM users WHERE id = $1`, id).Scan(&flags[0], &flags[1]); err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if flags != wantFlags[id] {
+			t.Errorf("%s: has_subscription, is_trial = %v after repair, want %v", name, flags, wantFlags[id])
+		}
+	}
+
+	// A second pass finds nothing left to fix
+	if batch, err := repo.FindEntitlementInconsistencies(ctx, "", staleBefore, 100); err != nil || len(batch) != 0 {
+		t.Errorf("after repair: found %v, %v, want none", batch, err)
+	}
+	if again, err := repo.RepairEntitlements(ctx, ids, staleBefore); err != nil || len(again) != 0 {
+		t.Errorf("repeated repair: repaired %v, %v, want none", again, err)
+	}
+}
+
+func TestExpireEntitlementsFixesSeededRows(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	repo := NewPostgresUserRepository(db)
+
+	now := time.Now().UTC()
+	at := func(d time.Duration) *time.Time {
+		v := now.Add(d)
+		return &v
+	}
+	seeds := []struct {
+		name            string
+		status          domain.UserStatus
+		hasSubscription bool
+		subscriptionEnd *time.Time
+		isTrial         bool
+		trialEnd        *time.Time
+		// want is has_subscription, is_trial after reconciling.
+		want [2]bool
+	}{
+		{"active with expired subscription", domain.StatusActive, true, at(-time.Hour), false, nil, [2]bool{false, false}},
+		{"active with expired trial", domain.StatusActive, false, nil, true, at(-time.Minute), [2]bool{false, false}},
+		{"both expired", domain.StatusActive, true, at(-72 * time.Hour), true, at(-72 * time.Hour), [2]bool{false, false}},
+		{"expired subscription, live trial", domain.StatusActive, true, at(-time.Hour), true, at(time.Hour), [2]bool{false, true}},
+		{"suspended with expired subscription", domain.StatusSuspended, true, at(-time.Hour), false, nil, [2]bool{false, false}},
+		{"live subscription", domain.StatusActive, true, at(time.Hour), false, nil, [2]bool{true, false}},
+		{"live trial", domain.StatusActive, false, nil, true, at(time.Hour), [2]bool{false, true}},
+		// A missing end is the consistency check's to repair
+		{"subscription without end", domain.StatusActive, true, nil, false, nil, [2]bool{true, false}},
+		{"flags cleared", domain.StatusActive, false, at(-time.Hour), false, at(-time.Hour), [2]bool{false, false}},
+	}
+	names := map[string]string{}
+	want := map[string][2]bool{}
+	status := map[string]domain.UserStatus{}
+	for _, seed := range seeds {
+		user := factory.User(factory.WithStatus(seed.status))
+		if err := repo.Create(ctx, user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		setEntitlements(t, db, user.ID, seed.hasSubscription, seed.subscriptionEnd, seed.isTrial, seed.trialEnd)
+		names[user.ID], want[user.ID], status[user.ID] = seed.name, seed.want, seed.status
+	}
+
+	// Batches restart from the beginning, as reconcile-batch calls them;
+	// fixed rows no longer match, so each call moves on
+	var fixed []int64
+	for i := 0; i < 10; i++ {
+		_, n, err := repo.ExpireEntitlements(ctx, "", 2)
+		if err != nil {
+			t.Fatalf("ExpireEntitlements: %v", err)
+		}
+		fixed = append(fixed, n)
+		if n < 2 {
+			break
+		}
+	}
+	if want := []int64{2, 2, 1}; fmt.Sprint(fixed) != fmt.Sprint(want) {
+		t.Errorf("batches fixed %v, want %v", fixed, want)
+	}
+
+	for id, name := range names {
+		var flags [2]bool
+		var got domain.UserStatus
+		if err := db.QueryRow(`SELECT has_subscription, is_trial, status FROM users WHERE id = $1`, id).Scan(&flags[0], &flags[1], &got); err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if flags != want[id] {
+			t.Errorf("%s: has_subscription, is_trial = %v, want %v", name, flags, want[id])
+		}
+		// Status is a lifecycle state and is left alone
+		if got != status[id] {
+			t.Errorf("%s: status %s, want %s", name, got, status[id])
+		}
+	}
+}
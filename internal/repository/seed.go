@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/timing"
+)
+
+// SetEntitlements overwrites the user's trial, subscription and email
+// verification state as given, bypassing the rules the service enforces. It
+// exists so development seeding can create states the API can't reach
+// directly, such as lapsed trials and subscriptions.
+func (r *postgresUserRepository) SetEntitlements(ctx context.Context, userID string, e domain.SeedEntitlements) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	defer timing.Record(ctx, "db_user_set_entitlements", time.Now())
+
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE users SET
+			is_trial = $2,
+			trial_ends_at = $3,
+			has_subscription = $4,
+			subscription_ends_at = $5,
+			email_verified = $6,
+			updated_at = NOW()
+		WHERE id = $1`,
+		userID, e.IsTrial, e.TrialEndsAt, e.HasSubscription, e.SubscriptionEndsAt, e.EmailVerified,
+	)
+	if err != nil {
+		return wrapErr("set entitlements", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return wrapErr("set entitlements rows affected", err)
+	}
+	if rowsAffected == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
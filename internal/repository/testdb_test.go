@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"user-service/internal/domain"
+	"user-service/internal/testutil/factory"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	_ "github.com/lib/pq"
+)
+
+// openTestDB connects to the database at TEST_DATABASE_URL, applies the
+// migrations and empties the tables tests write to. Tests that need it are
+// skipped when the variable is not set. The database is wiped, so never
+// point it at one holding real data.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	m, err := migrate.New("file://../../db/migrations", url)
+	if err != nil {
+		t.Fatalf("create migrate instance: %v", err)
+	}
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	m.Close()
+
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(`TRUNCATE users, product_categories, job_checkpoints CASCADE`); err != nil {
+		t.Fatalf("empty tables: %v", err)
+	}
+	return db
+}
+
+// createTestCategory inserts a category built by factory.Category and
+// returns its ID.
+func createTestCategory(t *testing.T, db *sql.DB, opts ...factory.CategoryOption) string {
+	t.Helper()
+	category := factory.Category(opts...)
+	var id string
+	err := db.QueryRow(
+		`INSERT INTO product_categories (slug, name, position, is_active) VALUES ($1, $2, $3, $4) RETURNING id`,
+		category.Slug, category.Name, category.Position, category.IsActive,
+	).Scan(&id)
+	if err != nil {
+		t.Fatalf("insert category: %v", err)
+	}
+	return id
+}
+
+// createTestProduct inserts a product built by factory.Product, in a
+// category of its own, and returns its ID.
+func createTestProduct(t *testing.T, db *sql.DB, opts ...factory.ProductOption) string {
+	t.Helper()
+	categoryID := createTestCategory(t, db)
+	product := factory.Product(append([]factory.ProductOption{factory.WithCategory(categoryID)}, opts...)...)
+	var productID string
+	err := db.QueryRow(
+		`INSERT INTO products (category_id, slug, name, price_coins, stock, is_active) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		product.CategoryID, product.Slug, product.Name, product.PriceCoins, product.Stock, product.IsActive,
+	).Scan(&productID)
+	if err != nil {
+		t.Fatalf("insert product: %v", err)
+	}
+	return productID
+}
+
+// createFundedUser creates a user built by factory.User holding coins and
+// returns it.
+func createFundedUser(t *testing.T, repo *postgresUserRepository, coins int64, opts ...factory.UserOption) *domain.User {
+	t.Helper()
+	ctx := context.Background()
+	user := factory.User(opts...)
+	if err := repo.Create(ctx, user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if coins > 0 {
+		if _, _, err := repo.AddCoinsAtomic(ctx, user.ID, coins, domain.CoinReasonPurchase, ""); err != nil {
+			t.Fatalf("AddCoinsAtomic: %v", err)
+		}
+	}
+	return user
+}
@@ -0,0 +1,61 @@
+// Package semaphore bounds how much of a shared resource, such as the
+// database connection pool, a class of callers may hold at once.
+package semaphore
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// Weighted is a semaphore whose callers each hold a weight, typically the
+// number of connections an operation keeps open concurrently. Waiters are
+// served in arrival order, so a heavy caller isn't starved by lighter ones.
+// It wraps golang.org/x/sync/semaphore, adding the weight in use for
+// metrics. A nil *Weighted never blocks.
+type Weighted struct {
+	size  int64
+	sem   *semaphore.Weighted
+	inUse atomic.Int64
+}
+
+// NewWeighted creates a semaphore with the given total weight.
+func NewWeighted(size int64) *Weighted {
+	return &Weighted{size: size, sem: semaphore.NewWeighted(size)}
+}
+
+// Acquire waits until n can be held, or ctx is done. On ctx's cancellation
+// it returns ctx.Err() and holds nothing.
+func (s *Weighted) Acquire(ctx context.Context, n int64) error {
+	if s == nil {
+		return nil
+	}
+	// x/sync would wait for ctx on a weight that can never fit
+	if n > s.size {
+		return fmt.Errorf("semaphore: weight %d exceeds size %d", n, s.size)
+	}
+	if err := s.sem.Acquire(ctx, n); err != nil {
+		return err
+	}
+	s.inUse.Add(n)
+	return nil
+}
+
+// Release gives back n acquired by an earlier Acquire.
+func (s *Weighted) Release(n int64) {
+	if s == nil {
+		return
+	}
+	s.inUse.Add(-n)
+	s.sem.Release(n)
+}
+
+// InUse returns the weight currently held.
+func (s *Weighted) InUse() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.inUse.Load()
+}
@@ -0,0 +1,105 @@
+package semaphore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"user-service/internal/config"
+)
+
+// TestSmallPoolReservation sizes the semaphore as the service does for a
+// pool of 5 connections with 2 reserved for interactive requests, 1 for the
+// health check and, with leader election enabled, 1 for the leader, and
+// checks heavy operations never hold more than the connections left to them.
+func TestSmallPoolReservation(t *testing.T) {
+	tests := []struct {
+		name   string
+		leader bool
+		want   int64
+	}{
+		{"leader election disabled", false, 2},
+		{"leader election enabled", true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				DB:     config.DB{MaxOpenConns: 5, ReservedInteractiveConns: 2},
+				Leader: config.Leader{Enabled: tt.leader},
+			}
+			s := NewWeighted(int64(cfg.HeavyOpConns()))
+
+			var held, maxHeld atomic.Int64
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := s.Acquire(context.Background(), 1); err != nil {
+						t.Error(err)
+						return
+					}
+					n := held.Add(1)
+					for {
+						m := maxHeld.Load()
+						if n <= m || maxHeld.CompareAndSwap(m, n) {
+							break
+						}
+					}
+					time.Sleep(time.Millisecond)
+					held.Add(-1)
+					s.Release(1)
+				}()
+			}
+			wg.Wait()
+
+			if got := maxHeld.Load(); got > tt.want {
+				t.Errorf("heavy operations held %d connections at once, want at most %d", got, tt.want)
+			}
+			if got := s.InUse(); got != 0 {
+				t.Errorf("InUse = %d after all releases, want 0", got)
+			}
+		})
+	}
+}
+
+func TestAcquireRespectsCancellation(t *testing.T) {
+	s := NewWeighted(1)
+	if err := s.Acquire(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.Acquire(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire on a full semaphore = %v, want DeadlineExceeded", err)
+	}
+	if got := s.InUse(); got != 1 {
+		t.Fatalf("InUse = %d after a cancelled wait, want 1", got)
+	}
+
+	s.Release(1)
+	if err := s.Acquire(context.Background(), 1); err != nil {
+		t.Fatalf("Acquire after release: %v", err)
+	}
+}
+
+func TestAcquireRejectsOversizedWeight(t *testing.T) {
+	s := NewWeighted(2)
+	if err := s.Acquire(context.Background(), 3); err == nil {
+		t.Fatal("Acquire(3) on a semaphore of 2 succeeded")
+	}
+}
+
+func TestNilNeverBlocks(t *testing.T) {
+	var s *Weighted
+	if err := s.Acquire(context.Background(), 100); err != nil {
+		t.Fatal(err)
+	}
+	s.Release(100)
+	if got := s.InUse(); got != 0 {
+		t.Fatalf("InUse = %d, want 0", got)
+	}
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"user-service/internal/reqctx"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RoleTokenHeader carries the bearer token that identifies a caller's roles.
+const RoleTokenHeader = echo.HeaderAuthorization
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	// ID names the credential the caller presented, for per-caller limits
+	// and metrics. It never contains the credential itself.
+	ID    string
+	Roles map[string]bool
+	// Admin holds the admin token and passes every role check.
+	Admin bool
+}
+
+// HasAnyRole reports whether p holds at least one of roles.
+func (p *Principal) HasAnyRole(roles []string) bool {
+	if p.Admin {
+		return true
+	}
+	for _, role := range roles {
+		if p.Roles[role] {
+			return true
+		}
+	}
+	return false
+}
+
+// PrincipalResolver identifies the caller of a request; it returns nil when
+// the request carries no valid credentials.
+type PrincipalResolver func(c echo.Context) *Principal
+
+// StaticTokenPrincipals resolves callers from "Authorization: Bearer <token>"
+// against roleTokens, which maps each role to its token. A token shared by
+// several roles grants all of them. The admin token grants every role.
+func StaticTokenPrincipals(roleTokens map[string]string, adminToken string) PrincipalResolver {
+	return func(c echo.Context) *Principal {
+		if isAdmin(c, adminToken) {
+			return &Principal{ID: "admin", Admin: true}
+		}
+
+		provided, ok := strings.CutPrefix(c.Request().Header.Get(RoleTokenHeader), "Bearer ")
+		if !ok || provided == "" {
+			return nil
+		}
+		var principal *Principal
+		for role, token := range roleTokens {
+			if token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				continue
+			}
+			if principal == nil {
+				principal = &Principal{ID: tokenID(provided), Roles: make(map[string]bool)}
+			}
+			principal.Roles[role] = true
+		}
+		return principal
+	}
+}
+
+// tokenID names a role token by a prefix of its SHA-256, enough to tell
+// the configured tokens apart without revealing them.
+func tokenID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:6])
+}
+
+// RouteACL maps a route, written "METHOD /path" with the path as registered
+// (e.g. "POST /api/users/:id/coins"), to the roles that may call it.
+type RouteACL map[string][]string
+
+// ParseRouteACL builds a RouteACL from configuration entries whose values
+// list roles separated by "|".
+func ParseRouteACL(entries map[string]string) (RouteACL, error) {
+	acl := make(RouteACL, len(entries))
+	for route, value := range entries {
+		method, path, ok := strings.Cut(strings.TrimSpace(route), " ")
+		if !ok || method != strings.ToUpper(method) || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("route ACL: %q is not \"METHOD /path\"", route)
+		}
+		var roles []string
+		for _, role := range strings.Split(value, "|") {
+			if role = strings.TrimSpace(role); role != "" {
+				roles = append(roles, role)
+			}
+		}
+		if len(roles) == 0 {
+			return nil, fmt.Errorf("route ACL: %s lists no roles", route)
+		}
+		acl[method+" "+path] = roles
+	}
+	return acl, nil
+}
+
+// Check returns an error naming the ACL routes that match no registered
+// route, so a typo can't leave a route unguarded.
+func (acl RouteACL) Check(routes []*echo.Route) error {
+	registered := make(map[string]bool, len(routes))
+	for _, r := range routes {
+		registered[r.Method+" "+r.Path] = true
+	}
+
+	var unknown []string
+	for route := range acl {
+		if !registered[route] {
+			unknown = append(unknown, route)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("route ACL names unknown routes: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// RequireRouteRoles enforces acl: a request to a listed route is rejected
+// with 403 unless resolve finds a caller holding one of the route's roles.
+// Routes not in acl are left alone. It must be registered with Echo.Use so
+// the matched route is known when it runs.
+func RequireRouteRoles(acl RouteACL, resolve PrincipalResolver) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			roles, guarded := acl[c.Request().Method+" "+c.Path()]
+			if !guarded {
+				return next(c)
+			}
+
+			principal := resolve(c)
+			if principal == nil || !principal.HasAnyRole(roles) {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error": "access to this route requires role " + strings.Join(roles, " or "),
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+// AdminRole is the role whose holders count as admins, like holders of the
+// admin token.
+const AdminRole = "admin"
+
+// IdentifyAdmin marks the request context of callers resolve finds to be
+// admins, so changes they make to users are recorded as admin actions.
+func IdentifyAdmin(resolve PrincipalResolver) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal := resolve(c)
+			if principal != nil && (principal.Admin || principal.Roles[AdminRole]) {
+				req := c.Request()
+				c.SetRequest(req.WithContext(reqctx.WithAdmin(req.Context())))
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestRequireRouteRoles(t *testing.T) {
+	const adminToken = "admin-secret"
+	acl, err := ParseRouteACL(map[string]string{
+		"POST /api/users/:id/coins": "finance",
+	})
+	if err != nil {
+		t.Fatalf("ParseRouteACL: %v", err)
+	}
+	principals := StaticTokenPrincipals(map[string]string{
+		"finance": "finance-token",
+		"support": "support-token",
+	}, adminToken)
+
+	e := echo.New()
+	e.Use(RequireRouteRoles(acl, principals))
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusNoContent) }
+	e.POST("/api/users/:id/coins", ok)
+	e.GET("/api/users/:id", ok)
+
+	const user = "/api/users/0190c2a8-7f1e-7a3b-9c4d-000000000001"
+	tests := []struct {
+		name         string
+		method, path string
+		header       string
+		value        string
+		wantStatus   int
+	}{
+		{"support token", http.MethodPost, user + "/coins", RoleTokenHeader, "Bearer support-token", http.StatusForbidden},
+		{"finance token", http.MethodPost, user + "/coins", RoleTokenHeader, "Bearer finance-token", http.StatusNoContent},
+		{"admin token", http.MethodPost, user + "/coins", AdminTokenHeader, adminToken, http.StatusNoContent},
+		{"unknown token", http.MethodPost, user + "/coins", RoleTokenHeader, "Bearer guessed", http.StatusForbidden},
+		{"token without scheme", http.MethodPost, user + "/coins", RoleTokenHeader, "finance-token", http.StatusForbidden},
+		{"no token", http.MethodPost, user + "/coins", "", "", http.StatusForbidden},
+		{"unguarded route", http.MethodGet, user, RoleTokenHeader, "Bearer support-token", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+func TestParseRouteACL(t *testing.T) {
+	acl, err := ParseRouteACL(map[string]string{
+		" POST /api/users/:id/coins ": "finance | admin|",
+	})
+	if err != nil {
+		t.Fatalf("ParseRouteACL: %v", err)
+	}
+	roles := acl["POST /api/users/:id/coins"]
+	if len(roles) != 2 || roles[0] != "finance" || roles[1] != "admin" {
+		t.Errorf("roles %v, want [finance admin]", roles)
+	}
+
+	malformed := []map[string]string{
+		{"/api/users/:id/coins": "finance"},
+		{"post /api/users/:id/coins": "finance"},
+		{"POST api/users/:id/coins": "finance"},
+		{"POST": "finance"},
+		{"POST /api/users/:id/coins": ""},
+		{"POST /api/users/:id/coins": " | "},
+	}
+	for _, entries := range malformed {
+		if _, err := ParseRouteACL(entries); err == nil {
+			t.Errorf("ParseRouteACL(%v) accepted a malformed entry", entries)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"user-service/internal/domain"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/labstack/echo/v4"
+)
+
+type AuditReplayService interface {
+	StartReplay(req domain.AuditReplayRequest) (*domain.AuditReplayStatus, error)
+	ReplayStatus() *domain.AuditReplayStatus
+}
+
+type auditServer struct {
+	replayService AuditReplayService
+}
+
+func NewAuditServer(replayService AuditReplayService) *auditServer {
+	return &auditServer{replayService: replayService}
+}
+
+// StartReplay starts re-publishing stored audit events in the background and
+// answers 202 with the initial status.
+func (s *auditServer) StartReplay(c echo.Context) error {
+	var req domain.AuditReplayRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	status, err := s.replayService.StartReplay(req)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrInvalidReplayRange), errors.Is(err, domain.ErrInvalidReplayRate):
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		case errors.Is(err, domain.ErrReplayInProgress):
+			return c.JSON(http.StatusConflict, map[string]string{
+				"error": err.Error(),
+			})
+		case errors.Is(err, domain.ErrReplayUnavailable):
+			return c.JSON(http.StatusServiceUnavailable, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		log.WithError(err).Error("Failed to start audit replay")
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "internal server error",
+		})
+	}
+
+	return c.JSON(http.StatusAccepted, status)
+}
+
+// ReplayStatus reports the progress of the running or last replay.
+func (s *auditServer) ReplayStatus(c echo.Context) error {
+	status := s.replayService.ReplayStatus()
+	if status == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{
+			"error": "no audit replay has been started",
+		})
+	}
+
+	return c.JSON(http.StatusOK, status)
+}
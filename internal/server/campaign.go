@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"user-service/internal/domain"
+
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+type CampaignService interface {
+	CreateCoinGrant(ctx context.Context, req domain.CreateCoinCampaignRequest) (*domain.CoinCampaign, error)
+	GetCampaign(ctx context.Context, id string) (*domain.CoinCampaign, error)
+}
+
+type campaignServer struct {
+	campaignService CampaignService
+}
+
+func NewCampaignServer(campaignService CampaignService) *campaignServer {
+	return &campaignServer{
+		campaignService: campaignService,
+	}
+}
+
+func handleCampaignError(err error) (int, string) {
+	switch {
+	case errors.Is(err, domain.ErrCampaignNotFound):
+		return http.StatusNotFound, "campaign not found"
+	case errors.Is(err, domain.ErrInvalidCampaignReason):
+		return http.StatusBadRequest, "invalid campaign reason"
+	case errors.Is(err, domain.ErrInvalidCampaignFilter):
+		return http.StatusBadRequest, "invalid campaign filter"
+	case errors.Is(err, domain.ErrInvalidUUID):
+		return http.StatusBadRequest, "invalid campaign ID format"
+	default:
+		return handleError(err)
+	}
+}
+
+func (s *campaignServer) CreateCoinGrant(c echo.Context) error {
+	var req domain.CreateCoinCampaignRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": bindErrorMessage(err),
+		})
+	}
+
+	campaign, err := s.campaignService.CreateCoinGrant(c.Request().Context(), req)
+	if err != nil {
+		log.WithError(err).Error("Failed to create coin grant campaign")
+		statusCode, errorMsg := handleCampaignError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, "/api/campaigns/"+campaign.ID)
+	return c.JSON(http.StatusAccepted, campaign)
+}
+
+func (s *campaignServer) GetCampaign(c echo.Context) error {
+	id := c.Param("id")
+
+	campaign, err := s.campaignService.GetCampaign(c.Request().Context(), id)
+	if err != nil {
+		log.WithError(err).WithField("campaign_id", id).Error("Failed to get campaign")
+		statusCode, errorMsg := handleCampaignError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, campaign)
+}
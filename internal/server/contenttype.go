@@ -0,0 +1,86 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// JSONContentType rejects POST, PUT and PATCH requests with 415 unless their
+// Content-Type is application/json, optionally with a UTF-8 charset. echo's
+// Bind would otherwise read form bodies, or nothing at all, into a request of
+// zero values. A request with neither a body nor a Content-Type passes, for
+// actions that take no input.
+func JSONContentType() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			switch req.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch:
+			default:
+				return next(c)
+			}
+
+			contentType := req.Header.Get(echo.HeaderContentType)
+			if contentType == "" && req.ContentLength == 0 {
+				return next(c)
+			}
+			canonical, ok := jsonMediaType(contentType)
+			if !ok {
+				return c.JSON(http.StatusUnsupportedMediaType, map[string]string{
+					"error": "Content-Type must be application/json",
+				})
+			}
+			// echo's Bind matches the media type case-sensitively
+			if canonical != contentType {
+				req.Header.Set(echo.HeaderContentType, canonical)
+			}
+			return next(c)
+		}
+	}
+}
+
+// jsonMediaType reports whether contentType is application/json with no
+// charset or a UTF-8 one, and returns the bare media type; JSON is UTF-8
+// anyway.
+func jsonMediaType(contentType string) (string, bool) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != echo.MIMEApplicationJSON {
+		return "", false
+	}
+	if charset, ok := params["charset"]; ok && !strings.EqualFold(charset, "utf-8") {
+		return "", false
+	}
+	return mediaType, true
+}
+
+// RequireBody rejects requests to routes that bind a request body with 400
+// when the body is empty, rather than letting them act on zero values. A
+// chunked body of unknown length is peeked at to tell.
+func RequireBody() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			empty := req.ContentLength == 0
+			if req.ContentLength < 0 {
+				peeked := bufio.NewReader(req.Body)
+				_, err := peeked.Peek(1)
+				empty = err == io.EOF
+				req.Body = struct {
+					io.Reader
+					io.Closer
+				}{peeked, req.Body}
+			}
+			if empty {
+				return c.JSON(http.StatusBadRequest, map[string]string{
+					"error": "request body is required",
+				})
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// contentTypeServer routes as main does and echoes back the body each
+// handler bound.
+func contentTypeServer() *echo.Echo {
+	e := echo.New()
+	api := e.Group("/api")
+	api.Use(JSONContentType())
+	bind := func(c echo.Context) error {
+		var req map[string]any
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request"})
+		}
+		return c.JSON(http.StatusOK, req)
+	}
+	api.POST("/users", bind, RequireBody())
+	api.PATCH("/users/:id", bind, RequireBody())
+	api.PUT("/catalog/categories/by-slug/:slug", bind, RequireBody())
+	api.POST("/users/:id/restore", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+	api.GET("/users", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+	api.DELETE("/users/:id", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+	return e
+}
+
+func TestJSONContentType(t *testing.T) {
+	const path = "/api/users"
+	const body = `{"name":"Ada"}`
+	tests := []struct {
+		name        string
+		contentType string
+		wantStatus  int
+	}{
+		{"json", "application/json", http.StatusOK},
+		{"json with utf-8 charset", "application/json; charset=utf-8", http.StatusOK},
+		{"json with upper-case charset", "application/json; charset=UTF-8", http.StatusOK},
+		{"json without space before charset", "application/json;charset=utf-8", http.StatusOK},
+		{"upper-case json", "Application/JSON", http.StatusOK},
+		{"json with other charset", "application/json; charset=iso-8859-1", http.StatusUnsupportedMediaType},
+		{"json with malformed parameters", "application/json; charset", http.StatusUnsupportedMediaType},
+		{"form", "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"multipart", "multipart/form-data; boundary=xyz", http.StatusUnsupportedMediaType},
+		{"text", "text/plain", http.StatusUnsupportedMediaType},
+		{"text json", "text/json", http.StatusUnsupportedMediaType},
+		{"json suffix", "application/vnd.api+json", http.StatusUnsupportedMediaType},
+		{"xml", "application/xml", http.StatusUnsupportedMediaType},
+		{"csv", "text/csv", http.StatusUnsupportedMediaType},
+		{"missing with a body", "", http.StatusUnsupportedMediaType},
+	}
+	e := contentTypeServer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, method := range []string{http.MethodPost, http.MethodPatch, http.MethodPut} {
+				target := map[string]string{
+					http.MethodPost:  path,
+					http.MethodPatch: path + "/0190c2a8-7f1e-7a3b-9c4d-000000000001",
+					http.MethodPut:   "/api/catalog/categories/by-slug/books",
+				}[method]
+				req := httptest.NewRequest(method, target, strings.NewReader(body))
+				if tt.contentType != "" {
+					req.Header.Set(echo.HeaderContentType, tt.contentType)
+				}
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, req)
+
+				if rec.Code != tt.wantStatus {
+					t.Fatalf("%s: got %d, want %d: %s", method, rec.Code, tt.wantStatus, rec.Body)
+				}
+				var got map[string]string
+				if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+					t.Fatalf("%s: body %s is not JSON: %v", method, rec.Body, err)
+				}
+				if tt.wantStatus == http.StatusOK && got["name"] != "Ada" {
+					t.Errorf("%s: handler bound %v, want the request body", method, got)
+				}
+				// Rejections carry the structured error
+				if tt.wantStatus == http.StatusUnsupportedMediaType && got["error"] != "Content-Type must be application/json" {
+					t.Errorf("%s: error body %s", method, rec.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestJSONContentTypeEmptyBodies(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		chunked     bool
+		wantStatus  int
+		wantError   string
+	}{
+		{"json with no body on a body route", http.MethodPost, "/api/users", "application/json", "", false, http.StatusBadRequest, "request body is required"},
+		{"json with chunked empty body", http.MethodPost, "/api/users", "application/json", "", true, http.StatusBadRequest, "request body is required"},
+		{"json with chunked body", http.MethodPost, "/api/users", "application/json", `{"name":"Ada"}`, true, http.StatusOK, ""},
+		{"nothing on a body route", http.MethodPost, "/api/users", "", "", false, http.StatusBadRequest, "request body is required"},
+		{"nothing on an action", http.MethodPost, "/api/users/0190c2a8-7f1e-7a3b-9c4d-000000000001/restore", "", "", false, http.StatusNoContent, ""},
+		{"json with no body on an action", http.MethodPost, "/api/users/0190c2a8-7f1e-7a3b-9c4d-000000000001/restore", "application/json", "", false, http.StatusNoContent, ""},
+		{"form with no body on an action", http.MethodPost, "/api/users/0190c2a8-7f1e-7a3b-9c4d-000000000001/restore", "application/x-www-form-urlencoded", "", false, http.StatusUnsupportedMediaType, "Content-Type must be application/json"},
+	}
+	e := contentTypeServer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			if tt.contentType != "" {
+				req.Header.Set(echo.HeaderContentType, tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantError == "" {
+				return
+			}
+			var got map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got["error"] != tt.wantError {
+				t.Errorf("body %s, want error %q", rec.Body, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestJSONContentTypeSkipsOtherRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		wantStatus  int
+	}{
+		// Only bodies that are bound are checked
+		{"get with form type", http.MethodGet, "/api/users", "application/x-www-form-urlencoded", http.StatusNoContent},
+		{"delete with text type", http.MethodDelete, "/api/users/0190c2a8-7f1e-7a3b-9c4d-000000000001", "text/plain", http.StatusNoContent},
+	}
+	e := contentTypeServer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader("slug,name\nlamp,Lamp\n"))
+			req.Header.Set(echo.HeaderContentType, tt.contentType)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
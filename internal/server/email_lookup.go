@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+	"user-service/internal/metrics"
+
+	"github.com/labstack/echo/v4"
+)
+
+// EmailLookupConfig sets how GET /api/users/email/:email resists being used
+// to find out which emails have accounts.
+type EmailLookupConfig struct {
+	// Protected turns on rate limiting and response padding for callers
+	// that are neither admin nor in TrustedRoles. Off, every caller gets
+	// fast exact answers.
+	Protected bool
+	// RateLimit is how many lookups one caller may make per minute; 0
+	// means unlimited.
+	RateLimit int
+	// MinLatency is the time every protected lookup takes at least, so a
+	// miss can't be told from a hit by how fast it comes back.
+	MinLatency time.Duration
+	// TrustedRoles are exempt from protection, like the admin token.
+	TrustedRoles []string
+}
+
+// EmailLookupGuard applies EmailLookupConfig to email lookups and counts
+// lookup misses per token in metrics.EmailLookupMisses either way.
+type EmailLookupGuard struct {
+	cfg     EmailLookupConfig
+	resolve PrincipalResolver
+	limiter *windowLimiter
+}
+
+// NewEmailLookupGuard creates a guard that identifies callers with resolve.
+func NewEmailLookupGuard(cfg EmailLookupConfig, resolve PrincipalResolver) *EmailLookupGuard {
+	g := &EmailLookupGuard{cfg: cfg, resolve: resolve}
+	if cfg.Protected && cfg.RateLimit > 0 {
+		g.limiter = newWindowLimiter(cfg.RateLimit, time.Minute)
+	}
+	return g
+}
+
+// anonymousCaller is the metrics key shared by callers without credentials,
+// so lookups from many addresses can't grow metrics.EmailLookupMisses.
+const anonymousCaller = "anonymous"
+
+// caller identifies the caller of c and reports whether it is exempt from
+// protection. Callers with credentials are known by the token they present,
+// both for rate limiting and in metrics. Anyone else is rate limited by
+// client IP, which the limiter forgets every window, and counted in
+// metrics under anonymousCaller.
+func (g *EmailLookupGuard) caller(c echo.Context) (limitKey, metricKey string, exempt bool) {
+	var principal *Principal
+	if g.resolve != nil {
+		principal = g.resolve(c)
+	}
+	if principal == nil {
+		return "ip:" + c.RealIP(), anonymousCaller, !g.cfg.Protected
+	}
+	return principal.ID, principal.ID, !g.cfg.Protected || principal.HasAnyRole(g.cfg.TrustedRoles)
+}
+
+// pad waits until MinLatency has passed since start, or ctx is done.
+func (g *EmailLookupGuard) pad(ctx context.Context, start time.Time) {
+	wait := g.cfg.MinLatency - time.Since(start)
+	if wait <= 0 {
+		return
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// countMiss records a lookup of an email with no account.
+func (g *EmailLookupGuard) countMiss(key string) {
+	metrics.EmailLookupMisses.Add(key, 1)
+}
+
+// windowLimiter allows each key limit events per fixed window. Counts are
+// dropped when a new window starts, so memory is bounded by the keys seen
+// in one window.
+type windowLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu      sync.Mutex
+	started time.Time
+	counts  map[string]int
+}
+
+func newWindowLimiter(limit int, window time.Duration) *windowLimiter {
+	return &windowLimiter{
+		limit:  limit,
+		window: window,
+		counts: make(map[string]int),
+	}
+}
+
+// allow records an event for key at now. When the key is over its limit it
+// returns false and how long until the window resets.
+func (l *windowLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.started) >= l.window {
+		l.started = now.Truncate(l.window)
+		clear(l.counts)
+	}
+	if l.counts[key] >= l.limit {
+		return false, l.started.Add(l.window).Sub(now)
+	}
+	l.counts[key]++
+	return true, 0
+}
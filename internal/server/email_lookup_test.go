@@ -0,0 +1,236 @@
+package server
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/metrics"
+
+	"github.com/labstack/echo/v4"
+)
+
+// emailUserService knows one email and rejects malformed ones as the real
+// service does.
+type emailUserService struct {
+	UserService
+}
+
+func (emailUserService) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	switch {
+	case email == "ada@example.com":
+		return &domain.User{ID: "0190c2a8-7f1e-7a3b-9c4d-000000000001", Email: email, Status: domain.StatusActive}, nil
+	case !domain.IsValidEmailFormat(email):
+		return nil, domain.ErrInvalidEmailFormat
+	default:
+		return nil, domain.ErrUserNotFound
+	}
+}
+
+func (emailUserService) HasAccessByUser(user *domain.User) bool {
+	return true
+}
+
+const (
+	lookupAdminToken   = "admin-secret"
+	lookupSupportToken = "support-secret"
+	lookupMinLatency   = 80 * time.Millisecond
+)
+
+type lookupResult struct {
+	status  int
+	body    string
+	elapsed time.Duration
+	header  http.Header
+}
+
+func newEmailLookupEcho(protected bool) *echo.Echo {
+	resolve := StaticTokenPrincipals(map[string]string{"support": lookupSupportToken}, lookupAdminToken)
+	srv := NewServer(emailUserService{}, nil, nil, lookupAdminToken)
+	guard := NewEmailLookupGuard(EmailLookupConfig{
+		Protected:    protected,
+		RateLimit:    3,
+		MinLatency:   lookupMinLatency,
+		TrustedRoles: []string{"support"},
+	}, resolve)
+	if guard.limiter != nil {
+		// Start the window now so a minute boundary can't reset it mid-test
+		guard.limiter.started = time.Now()
+	}
+	srv.SetEmailLookupGuard(guard)
+	e := echo.New()
+	e.GET("/api/users/email/:email", srv.GetUserByEmail)
+	return e
+}
+
+func lookupEmail(e *echo.Echo, ip, email string, headers map[string]string) lookupResult {
+	req := httptest.NewRequest(http.MethodGet, "/api/users/email/"+email, nil)
+	req.Header.Set(echo.HeaderXRealIP, ip)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	e.ServeHTTP(rec, req)
+	return lookupResult{rec.Code, rec.Body.String(), time.Since(start), rec.Header()}
+}
+
+func missesOf(key string) int64 {
+	if v, ok := metrics.EmailLookupMisses.Get(key).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestEmailLookupUnprotected(t *testing.T) {
+	e := newEmailLookupEcho(false)
+	const ip = "198.51.100.1"
+	anonymous := missesOf(anonymousCaller)
+
+	// Exact answers, as fast as the lookup, with no limit on how many
+	for i := 0; i < 5; i++ {
+		if r := lookupEmail(e, ip, "ada@example.com", nil); r.status != http.StatusOK {
+			t.Fatalf("lookup %d of a known email: status %d: %s", i, r.status, r.body)
+		}
+	}
+	miss := lookupEmail(e, ip, "nobody@example.com", nil)
+	if miss.status != http.StatusNotFound || miss.elapsed >= lookupMinLatency {
+		t.Errorf("miss: status %d after %v, want a fast 404", miss.status, miss.elapsed)
+	}
+	if invalid := lookupEmail(e, ip, "not-an-email", nil); invalid.status != http.StatusBadRequest {
+		t.Errorf("malformed email: status %d, want 400: %s", invalid.status, invalid.body)
+	}
+
+	// Misses are counted even when unprotected
+	if got := missesOf(anonymousCaller) - anonymous; got != 1 {
+		t.Errorf("anonymous misses = %d, want 1", got)
+	}
+}
+
+func TestEmailLookupProtected(t *testing.T) {
+	e := newEmailLookupEcho(true)
+	const ip = "198.51.100.2"
+	anonymous := missesOf(anonymousCaller)
+
+	hit := lookupEmail(e, ip, "ada@example.com", nil)
+	miss := lookupEmail(e, ip, "nobody@example.com", nil)
+	invalid := lookupEmail(e, ip, "not-an-email", nil)
+
+	if hit.status != http.StatusOK {
+		t.Errorf("hit: status %d, want 200: %s", hit.status, hit.body)
+	}
+	// A malformed email must not be told apart from an unknown one
+	if miss.status != http.StatusNotFound || invalid.status != http.StatusNotFound || miss.body != invalid.body {
+		t.Errorf("miss %d %s and malformed %d %s, want the same 404", miss.status, miss.body, invalid.status, invalid.body)
+	}
+	for name, r := range map[string]lookupResult{"hit": hit, "miss": miss, "malformed": invalid} {
+		if r.elapsed < lookupMinLatency {
+			t.Errorf("%s answered after %v, want at least %v", name, r.elapsed, lookupMinLatency)
+		}
+	}
+	if got := missesOf(anonymousCaller) - anonymous; got != 1 {
+		t.Errorf("anonymous misses = %d, want 1", got)
+	}
+
+	limited := lookupEmail(e, ip, "ada@example.com", nil)
+	if limited.status != http.StatusTooManyRequests || limited.header.Get("Retry-After") == "" {
+		t.Errorf("fourth lookup: status %d, Retry-After %q; want 429 with Retry-After", limited.status, limited.header.Get("Retry-After"))
+	}
+	// The limit is per caller
+	if other := lookupEmail(e, "198.51.100.3", "ada@example.com", nil); other.status != http.StatusOK {
+		t.Errorf("another caller: status %d, want 200", other.status)
+	}
+}
+
+func TestEmailLookupExemptCallers(t *testing.T) {
+	e := newEmailLookupEcho(true)
+	callers := map[string]map[string]string{
+		"admin":        {AdminTokenHeader: lookupAdminToken},
+		"trusted role": {RoleTokenHeader: "Bearer " + lookupSupportToken},
+	}
+	for name, headers := range callers {
+		t.Run(name, func(t *testing.T) {
+			const ip = "198.51.100.4"
+			// Past the rate limit, unpadded and with the exact status
+			for i := 0; i < 5; i++ {
+				if r := lookupEmail(e, ip, "ada@example.com", headers); r.status != http.StatusOK {
+					t.Fatalf("lookup %d: status %d: %s", i, r.status, r.body)
+				}
+			}
+			miss := lookupEmail(e, ip, "nobody@example.com", headers)
+			if miss.status != http.StatusNotFound || miss.elapsed >= lookupMinLatency {
+				t.Errorf("miss: status %d after %v, want a fast 404", miss.status, miss.elapsed)
+			}
+			invalid := lookupEmail(e, ip, "not-an-email", headers)
+			if invalid.status != http.StatusBadRequest || !strings.Contains(invalid.body, "email") {
+				t.Errorf("malformed email: status %d %s, want the exact 400", invalid.status, invalid.body)
+			}
+		})
+	}
+}
+
+func TestEmailLookupKeysCallersByToken(t *testing.T) {
+	const analyticsToken, billingToken = "analytics-secret", "billing-secret"
+	resolve := StaticTokenPrincipals(map[string]string{
+		"analytics": analyticsToken,
+		"billing":   billingToken,
+		"support":   lookupSupportToken,
+	}, lookupAdminToken)
+	srv := NewServer(emailUserService{}, nil, nil, lookupAdminToken)
+	guard := NewEmailLookupGuard(EmailLookupConfig{Protected: true, RateLimit: 2, TrustedRoles: []string{"support"}}, resolve)
+	guard.limiter.started = time.Now()
+	srv.SetEmailLookupGuard(guard)
+	e := echo.New()
+	e.GET("/api/users/email/:email", srv.GetUserByEmail)
+
+	analytics := map[string]string{RoleTokenHeader: "Bearer " + analyticsToken}
+	billing := map[string]string{RoleTokenHeader: "Bearer " + billingToken}
+	before := missesOf(tokenID(analyticsToken))
+
+	// Each token has its own limit, wherever its requests come from
+	for i, ip := range []string{"198.51.100.10", "198.51.100.11"} {
+		if r := lookupEmail(e, ip, "nobody@example.com", analytics); r.status != http.StatusNotFound {
+			t.Fatalf("lookup %d: status %d: %s", i, r.status, r.body)
+		}
+	}
+	if r := lookupEmail(e, "198.51.100.12", "ada@example.com", analytics); r.status != http.StatusTooManyRequests {
+		t.Errorf("third lookup with one token: status %d, want 429", r.status)
+	}
+	if r := lookupEmail(e, "198.51.100.10", "ada@example.com", billing); r.status != http.StatusOK {
+		t.Errorf("another token: status %d, want 200", r.status)
+	}
+
+	// Misses are counted under the token's ID, which doesn't reveal it
+	if got := missesOf(tokenID(analyticsToken)) - before; got != 2 {
+		t.Errorf("misses of the analytics token = %d, want 2", got)
+	}
+	metrics.EmailLookupMisses.Do(func(kv expvar.KeyValue) {
+		if strings.Contains(kv.Key, "secret") {
+			t.Errorf("metrics key %q contains a token", kv.Key)
+		}
+	})
+}
+
+func TestEmailLookupMissesKeepBoundedKeys(t *testing.T) {
+	e := newEmailLookupEcho(false)
+	keys := func() int {
+		n := 0
+		metrics.EmailLookupMisses.Do(func(expvar.KeyValue) { n++ })
+		return n
+	}
+	lookupEmail(e, "203.0.113.0", "nobody@example.com", nil)
+	before := keys()
+
+	// Scraping from many addresses adds no keys
+	for i := 1; i < 50; i++ {
+		lookupEmail(e, fmt.Sprintf("203.0.113.%d", i), "nobody@example.com", nil)
+	}
+	if after := keys(); after != before {
+		t.Errorf("misses from 50 addresses grew the metric from %d to %d keys", before, after)
+	}
+}
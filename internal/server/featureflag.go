@@ -0,0 +1,32 @@
+package server
+
+import (
+	"net/http"
+	"user-service/internal/featureflag"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+type featureFlagServer struct {
+	evaluator featureflag.Evaluator
+}
+
+func NewFeatureFlagServer(evaluator featureflag.Evaluator) *featureFlagServer {
+	return &featureFlagServer{evaluator: evaluator}
+}
+
+// UserFlags returns every feature flag evaluated for the user in the path.
+func (s *featureFlagServer) UserFlags(c echo.Context) error {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid user ID format",
+		})
+	}
+
+	ctx := featureflag.WithUser(c.Request().Context(), id)
+	return c.JSON(http.StatusOK, UserFlagsResponse{
+		Flags: s.evaluator.All(ctx),
+	})
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// HealthConn is a database connection set aside for the health check, so a
+// pool saturated by heavy operations can't make the service look down.
+type HealthConn struct {
+	db *sql.DB
+
+	mu   sync.Mutex
+	conn *sql.Conn
+}
+
+// NewHealthConn takes the health check's connection out of db's pool. It is
+// meant to be called once at startup, before the pool gets busy.
+func NewHealthConn(ctx context.Context, db *sql.DB) (*HealthConn, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &HealthConn{db: db, conn: conn}, nil
+}
+
+// Ping checks the database over the dedicated connection. A connection that
+// fails is dropped and replaced on the next call, so the check recovers once
+// the database is back.
+func (h *HealthConn) Ping(ctx context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.conn == nil {
+		conn, err := h.db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		h.conn = conn
+	}
+	if err := h.conn.PingContext(ctx); err != nil {
+		h.conn.Close()
+		h.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Close returns the connection to the pool.
+func (h *HealthConn) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.conn == nil {
+		return nil
+	}
+	err := h.conn.Close()
+	h.conn = nil
+	return err
+}
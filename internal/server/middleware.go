@@ -0,0 +1,190 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"user-service/internal/breaker"
+	"user-service/internal/jsonenc"
+	"user-service/internal/metrics"
+	"user-service/internal/reqctx"
+	"user-service/internal/timing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// AdminTokenHeader carries the shared admin token for admin-only routes.
+const AdminTokenHeader = "X-Admin-Token"
+
+// UserIDHeader identifies the calling user on routes that are scoped to the
+// resource owner. It is set by the gateway after authentication.
+const UserIDHeader = "X-User-ID"
+
+// IdempotencyKeyHeader lets clients retry a coin mutation or a subscription
+// activation or renewal safely: a repeat with the same key returns the first
+// result instead of applying it again.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader is set on responses that replay the result of an
+// earlier request with the same Idempotency-Key.
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// maxRequestIDLength bounds client-supplied request IDs before they reach logs.
+const maxRequestIDLength = 128
+
+// RequestContext stores the request ID and calling user in the request context
+// so work that outlives the request, such as async audit publishing, can still
+// be correlated with it. The request ID is taken from X-Request-ID when present
+// and generated otherwise, and is echoed back in the response.
+func RequestContext() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+
+			requestID := req.Header.Get(echo.HeaderXRequestID)
+			if requestID == "" || len(requestID) > maxRequestIDLength {
+				requestID = uuid.New().String()
+			}
+			c.Response().Header().Set(echo.HeaderXRequestID, requestID)
+
+			ctx := reqctx.WithRequestID(req.Context(), requestID)
+			if actor := req.Header.Get(UserIDHeader); actor != "" {
+				ctx = reqctx.WithActor(ctx, actor)
+			}
+			c.SetRequest(req.WithContext(ctx))
+
+			return next(c)
+		}
+	}
+}
+
+// isAdmin reports whether c carries the admin token. An empty token never matches.
+func isAdmin(c echo.Context, token string) bool {
+	provided := c.Request().Header.Get(AdminTokenHeader)
+	return token != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
+
+// RequireAdminToken rejects requests whose X-Admin-Token header does not match
+// token. An empty token disables the guarded routes entirely.
+func RequireAdminToken(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !isAdmin(c, token) {
+				return c.JSON(http.StatusForbidden, map[string]string{
+					"error": "admin access required",
+				})
+			}
+			return next(c)
+		}
+	}
+}
+
+// CircuitBreaker short-circuits requests with 503 and Retry-After while b is
+// open. Responses with a 5xx status count as failures; on DB-backed routes
+// these are almost always database errors.
+func CircuitBreaker(b *breaker.Breaker) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ticket, allowed, retryAfter := b.Allow()
+			if !allowed {
+				metrics.CircuitBreakerRejections.Add(1)
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				if seconds < 1 {
+					seconds = 1
+				}
+				c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+				return c.JSON(http.StatusServiceUnavailable, map[string]string{
+					"error": "service temporarily unavailable",
+				})
+			}
+
+			err := next(c)
+
+			status := c.Response().Status
+			if err != nil {
+				var httpErr *echo.HTTPError
+				if errors.As(err, &httpErr) {
+					status = httpErr.Code
+				} else {
+					status = http.StatusInternalServerError
+				}
+			}
+			if tripped := b.Record(ticket, status < http.StatusInternalServerError); tripped {
+				metrics.CircuitBreakerTrips.Add(1)
+			}
+
+			return err
+		}
+	}
+}
+
+// RequestTiming attaches a timing.Recorder to each request, which repositories
+// and publishers add spans to, and logs a per-span breakdown for requests that
+// take at least threshold(). Fast requests only pay for the empty recorder.
+func RequestTiming(threshold func() time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			ctx, recorder := timing.WithRecorder(c.Request().Context())
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			err := next(c)
+
+			elapsed := time.Since(start)
+			if elapsed < threshold() {
+				return err
+			}
+
+			fields := log.Fields{
+				"method":     c.Request().Method,
+				"route":      c.Path(),
+				"status":     c.Response().Status,
+				"latency_ms": elapsed.Milliseconds(),
+				"request_id": reqctx.RequestID(ctx),
+				"breakdown":  recorder.Breakdown(),
+			}
+			// Spans that overlap, such as concurrent queries, can add up to more than the request
+			if other := elapsed - recorder.Total(); other >= time.Millisecond {
+				fields["other_ms"] = other.Milliseconds()
+			}
+			log.WithFields(fields).Warn("Slow request")
+
+			return err
+		}
+	}
+}
+
+// TimedJSONSerializer is echo's JSON serializer with the time spent encoding
+// responses recorded as the "serialize" span. Responses are written with
+// Encoder, or the standard library's when it is nil. Public IDs in request
+// bodies are turned into UUIDs; with PublicIDs set, IDs in responses are
+// written in their public form.
+type TimedJSONSerializer struct {
+	echo.DefaultJSONSerializer
+	Encoder   jsonenc.Encoder
+	PublicIDs bool
+}
+
+func (s TimedJSONSerializer) Serialize(c echo.Context, i interface{}, indent string) error {
+	defer timing.Record(c.Request().Context(), "serialize", time.Now())
+	enc := s.Encoder
+	if enc == nil {
+		enc, _ = jsonenc.Lookup(jsonenc.Std)
+	}
+	if s.PublicIDs {
+		return serializePublicIDs(c, enc, i, indent)
+	}
+	return enc.Encode(c.Response(), i, indent)
+}
+
+func (s TimedJSONSerializer) Deserialize(c echo.Context, i interface{}) error {
+	if err := unprefixRequestBody(c); err != nil {
+		return err
+	}
+	return s.DefaultJSONSerializer.Deserialize(c, i)
+}
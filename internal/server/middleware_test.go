@@ -0,0 +1,114 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"user-service/internal/timing"
+
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+// spanHandler records a db_get and a kafka_publish span of the given
+// lengths, spends pause outside of any span and answers with JSON.
+func spanHandler(db, kafka, pause time.Duration) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+		start := time.Now()
+		time.Sleep(db)
+		timing.Record(ctx, "db_get", start)
+		start = time.Now()
+		time.Sleep(kafka)
+		timing.Record(ctx, "kafka_publish", start)
+		time.Sleep(pause)
+		return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// breakdownMillis sums the spans of a breakdown such as
+// "db_get=12ms kafka_publish=950ms(x2)", keyed by name.
+func breakdownMillis(t *testing.T, breakdown string) map[string]float64 {
+	t.Helper()
+	spans := map[string]float64{}
+	for _, part := range strings.Fields(breakdown) {
+		name, value, ok := strings.Cut(part, "=")
+		value, _, _ = strings.Cut(value, "(x")
+		d, err := time.ParseDuration(value)
+		if !ok || err != nil {
+			t.Fatalf("malformed span %q in %q", part, breakdown)
+		}
+		spans[name] = float64(d) / float64(time.Millisecond)
+	}
+	return spans
+}
+
+func TestSlowRequestBreakdown(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	const threshold = 40 * time.Millisecond
+	e := echo.New()
+	e.JSONSerializer = TimedJSONSerializer{}
+	e.Use(RequestTiming(func() time.Duration { return threshold }))
+	e.GET("/fast", spanHandler(time.Millisecond, time.Millisecond, 0))
+	e.GET("/slow", spanHandler(20*time.Millisecond, 30*time.Millisecond, 15*time.Millisecond))
+
+	slowRequests := func() []*log.Entry {
+		var slow []*log.Entry
+		for _, entry := range hook.AllEntries() {
+			if entry.Message == "Slow request" {
+				slow = append(slow, entry)
+			}
+		}
+		return slow
+	}
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if slow := slowRequests(); len(slow) != 0 {
+		t.Fatalf("fast request logged as slow: %v", slow[0].Data)
+	}
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	slow := slowRequests()
+	if len(slow) != 1 {
+		t.Fatalf("%d slow request lines, want 1", len(slow))
+	}
+	fields := slow[0].Data
+	if fields["route"] != "/slow" || fields["status"] != http.StatusOK {
+		t.Errorf("logged route %v with status %v, want /slow and 200", fields["route"], fields["status"])
+	}
+
+	spans := breakdownMillis(t, fields["breakdown"].(string))
+	for name, atLeast := range map[string]float64{"db_get": 20, "kafka_publish": 30} {
+		if spans[name] < atLeast {
+			t.Errorf("%s = %vms, want at least %vms: %v", name, spans[name], atLeast, fields["breakdown"])
+		}
+	}
+	if _, ok := spans["serialize"]; !ok {
+		t.Errorf("no serialize span in %q", fields["breakdown"])
+	}
+
+	// The spans and the time outside them add up to the latency
+	latency := float64(fields["latency_ms"].(int64))
+	other, _ := fields["other_ms"].(int64)
+	var sum float64
+	for _, ms := range spans {
+		sum += ms
+	}
+	if sum > latency+1 {
+		t.Errorf("spans sum to %vms, more than the %vms latency", sum, latency)
+	}
+	if other < 15 {
+		t.Errorf("other_ms = %d, want at least the 15ms spent outside spans", other)
+	}
+	if gap := latency - sum - float64(other); gap < -2 || gap > 2 {
+		t.Errorf("latency %vms is not spans %vms plus other %dms", latency, sum, other)
+	}
+	if latency < float64(threshold.Milliseconds()) {
+		t.Errorf("latency_ms = %v, want at least the %v threshold", latency, threshold)
+	}
+}
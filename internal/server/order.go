@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"user-service/internal/domain"
+
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+type OrderService interface {
+	Checkout(ctx context.Context, userID string, req domain.CheckoutRequest) (*domain.Order, error)
+	ListUserOrders(ctx context.Context, userID string, limit, offset int) ([]domain.Order, int64, error)
+	GetOrder(ctx context.Context, orderID string, ownerID *string) (*domain.Order, error)
+	RefundOrder(ctx context.Context, orderID string, req domain.RefundOrderRequest) (*domain.OrderRefund, error)
+	CanPurchase(ctx context.Context, userID, productID string) (*domain.PurchaseQuote, error)
+}
+
+type orderServer struct {
+	orderService OrderService
+	adminToken   string
+}
+
+// NewOrderServer creates the order server. adminToken lets admins read any
+// order; other callers only see orders owned by the X-User-ID user.
+func NewOrderServer(orderService OrderService, adminToken string) *orderServer {
+	return &orderServer{
+		orderService: orderService,
+		adminToken:   adminToken,
+	}
+}
+
+func handleOrderError(err error) (int, string) {
+	switch {
+	case errors.Is(err, domain.ErrOrderNotFound):
+		return http.StatusNotFound, "order not found"
+	case errors.Is(err, domain.ErrOrderItemNotFound):
+		return http.StatusNotFound, "order item not found"
+	case errors.Is(err, domain.ErrOrderItemAlreadyRefunded), errors.Is(err, domain.ErrOrderAlreadyRefunded):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, domain.ErrProductNotFound):
+		return http.StatusNotFound, "product not found"
+	case errors.Is(err, domain.ErrProductInactive):
+		return http.StatusConflict, "product is inactive"
+	case errors.Is(err, domain.ErrOutOfStock):
+		return http.StatusConflict, "product is out of stock"
+	case errors.Is(err, domain.ErrInvalidPrice):
+		return http.StatusConflict, "product is not priced"
+	case errors.Is(err, domain.ErrEmptyCheckout),
+		errors.Is(err, domain.ErrTooManyCheckoutItems),
+		errors.Is(err, domain.ErrInvalidQuantity),
+		errors.Is(err, domain.ErrDuplicateCheckoutItem),
+		errors.Is(err, domain.ErrPurchaseProductRequired):
+		return http.StatusBadRequest, err.Error()
+	default:
+		return handleError(err)
+	}
+}
+
+func (s *orderServer) Checkout(c echo.Context) error {
+	userID := c.Param("id")
+
+	var req domain.CheckoutRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	order, err := s.orderService.Checkout(c.Request().Context(), userID, req)
+	if err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to checkout")
+
+		var lineErr *domain.LineItemError
+		if errors.As(err, &lineErr) {
+			statusCode, errorMsg := handleOrderError(lineErr.Err)
+			if errors.Is(lineErr.Err, domain.ErrInvalidUUID) {
+				errorMsg = "invalid product ID format"
+			}
+			return c.JSON(statusCode, LineItemErrorResponse{
+				Error:     errorMsg,
+				LineItem:  lineErr.Index,
+				ProductID: lineErr.ProductID,
+			})
+		}
+
+		statusCode, errorMsg := handleOrderError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, "/api/orders/"+order.ID)
+	return c.JSON(http.StatusCreated, order)
+}
+
+func (s *orderServer) ListUserOrders(c echo.Context) error {
+	userID := c.Param("id")
+	limit, offset, err := paginationParams(c, 10)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	orders, total, err := s.orderService.ListUserOrders(c.Request().Context(), userID, limit, offset)
+	if err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to list orders")
+		statusCode, errorMsg := handleOrderError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, UserOrdersResponse{
+		Orders: orders,
+		Total:  total,
+	})
+}
+
+func (s *orderServer) GetOrder(c echo.Context) error {
+	orderID := c.Param("order_id")
+
+	var ownerID *string
+	if !isAdmin(c, s.adminToken) {
+		callerID := c.Request().Header.Get(UserIDHeader)
+		ownerID = &callerID
+	}
+
+	order, err := s.orderService.GetOrder(c.Request().Context(), orderID, ownerID)
+	if err != nil {
+		log.WithError(err).WithField("order_id", orderID).Error("Failed to get order")
+		statusCode, errorMsg := handleOrderError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, order)
+}
+
+func (s *orderServer) RefundOrder(c echo.Context) error {
+	orderID := c.Param("order_id")
+
+	var req domain.RefundOrderRequest
+	if c.Request().ContentLength != 0 {
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "invalid request body",
+			})
+		}
+	}
+
+	refund, err := s.orderService.RefundOrder(c.Request().Context(), orderID, req)
+	if err != nil {
+		log.WithError(err).WithField("order_id", orderID).Error("Failed to refund order")
+		statusCode, errorMsg := handleOrderError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, refund)
+}
+
+// canPurchaseMaxAge lets clients reuse an affordability answer briefly while
+// rendering, without serving a stale balance for long.
+const canPurchaseMaxAge = "private, max-age=5"
+
+// CanPurchase answers whether the user can afford a product without buying
+// it. An inactive or out-of-stock product is a 409 that still carries the quote.
+func (s *orderServer) CanPurchase(c echo.Context) error {
+	userID := c.Param("id")
+	productID := c.Param("product_id")
+
+	quote, err := s.orderService.CanPurchase(c.Request().Context(), userID, productID)
+	if err != nil && quote == nil {
+		log.WithError(err).WithFields(log.Fields{
+			"user_id":    userID,
+			"product_id": productID,
+		}).Error("Failed to check purchase affordability")
+		statusCode, errorMsg := handleOrderError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	c.Response().Header().Set(echo.HeaderCacheControl, canPurchaseMaxAge)
+	if err != nil {
+		statusCode, errorMsg := handleOrderError(err)
+		return c.JSON(statusCode, QuoteErrorResponse{
+			Affordable: quote.Affordable,
+			Balance:    quote.Balance,
+			Error:      errorMsg,
+			PriceCoins: quote.PriceCoins,
+			Shortfall:  quote.Shortfall,
+		})
+	}
+
+	return c.JSON(http.StatusOK, quote)
+}
+
+// Shortfall tells an upsell prompt how many more coins the user needs to buy
+// one unit of the product_id product, 0 when the balance already covers it.
+// The product must exist and be active; its stock doesn't matter here.
+// Subscriptions are activated for a duration and cost no coins, so a plan
+// has no price to fall short of and is refused rather than answered with 0.
+func (s *orderServer) Shortfall(c echo.Context) error {
+	userID := c.Param("id")
+	if c.QueryParam("plan") != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "subscription plans cost no coins, use product_id",
+		})
+	}
+	productID := c.QueryParam("product_id")
+	if productID == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "product_id is required",
+		})
+	}
+
+	quote, err := s.orderService.CanPurchase(c.Request().Context(), userID, productID)
+	if err != nil && !(quote != nil && errors.Is(err, domain.ErrOutOfStock)) {
+		log.WithError(err).WithFields(log.Fields{
+			"user_id":    userID,
+			"product_id": productID,
+		}).Error("Failed to compute coin shortfall")
+		statusCode, errorMsg := handleOrderError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	c.Response().Header().Set(echo.HeaderCacheControl, canPurchaseMaxAge)
+	return c.JSON(http.StatusOK, ShortfallResponse{
+		Balance:    quote.Balance,
+		Needed:     quote.Shortfall,
+		PriceCoins: quote.PriceCoins,
+	})
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-service/internal/domain"
+
+	"github.com/labstack/echo/v4"
+)
+
+// quoteOrderService answers CanPurchase the way the repository does: the
+// quote is computed from balance and price, and an inactive or out-of-stock
+// product still comes back with it.
+type quoteOrderService struct {
+	OrderService
+	balance, price int64
+	err            error
+}
+
+func (f quoteOrderService) CanPurchase(ctx context.Context, userID, productID string) (*domain.PurchaseQuote, error) {
+	if f.err == domain.ErrUserNotFound || f.err == domain.ErrProductNotFound {
+		return nil, f.err
+	}
+	quote := &domain.PurchaseQuote{Balance: f.balance, PriceCoins: f.price}
+	if quote.Balance >= quote.PriceCoins {
+		quote.Affordable = true
+	} else {
+		quote.Shortfall = quote.PriceCoins - quote.Balance
+	}
+	return quote, f.err
+}
+
+func TestShortfall(t *testing.T) {
+	const path = "/api/users/0190c2a8-7f1e-7a3b-9c4d-000000000001/shortfall"
+	const productQuery = "?product_id=0190c2a8-7f1e-7a3b-8c4d-000000000001"
+
+	tests := []struct {
+		name       string
+		query      string
+		svc        quoteOrderService
+		wantStatus int
+		wantNeeded int64
+	}{
+		{"affordable", productQuery, quoteOrderService{balance: 500, price: 300}, http.StatusOK, 0},
+		{"exactly affordable", productQuery, quoteOrderService{balance: 300, price: 300}, http.StatusOK, 0},
+		{"unaffordable", productQuery, quoteOrderService{balance: 200, price: 500}, http.StatusOK, 300},
+		{"empty balance", productQuery, quoteOrderService{price: 500}, http.StatusOK, 500},
+		{"out of stock", productQuery, quoteOrderService{balance: 200, price: 500, err: domain.ErrOutOfStock}, http.StatusOK, 300},
+		{"inactive product", productQuery, quoteOrderService{balance: 200, price: 500, err: domain.ErrProductInactive}, http.StatusConflict, 0},
+		{"unknown product", productQuery, quoteOrderService{err: domain.ErrProductNotFound}, http.StatusNotFound, 0},
+		{"unknown user", productQuery, quoteOrderService{err: domain.ErrUserNotFound}, http.StatusNotFound, 0},
+		{"no product", "", quoteOrderService{}, http.StatusBadRequest, 0},
+		{"plan", "?plan=monthly", quoteOrderService{}, http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.GET("/api/users/:id/shortfall", NewOrderServer(tt.svc, "").Shortfall)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path+tt.query, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var got ShortfallResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode %s: %v", rec.Body, err)
+			}
+			want := ShortfallResponse{Balance: tt.svc.balance, Needed: tt.wantNeeded, PriceCoins: tt.svc.price}
+			if got != want {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestCanPurchase(t *testing.T) {
+	const path = "/api/users/0190c2a8-7f1e-7a3b-9c4d-000000000001/can-purchase/0190c2a8-7f1e-7a3b-8c4d-000000000001"
+
+	tests := []struct {
+		name       string
+		svc        quoteOrderService
+		wantStatus int
+		want       QuoteErrorResponse
+	}{
+		{"affordable", quoteOrderService{balance: 500, price: 300}, http.StatusOK,
+			QuoteErrorResponse{Affordable: true, Balance: 500, PriceCoins: 300}},
+		{"exactly affordable", quoteOrderService{balance: 300, price: 300}, http.StatusOK,
+			QuoteErrorResponse{Affordable: true, Balance: 300, PriceCoins: 300}},
+		{"unaffordable", quoteOrderService{balance: 200, price: 500}, http.StatusOK,
+			QuoteErrorResponse{Balance: 200, PriceCoins: 500, Shortfall: 300}},
+		{"empty balance", quoteOrderService{price: 500}, http.StatusOK,
+			QuoteErrorResponse{PriceCoins: 500, Shortfall: 500}},
+		{"inactive product", quoteOrderService{balance: 500, price: 300, err: domain.ErrProductInactive}, http.StatusConflict,
+			QuoteErrorResponse{Affordable: true, Balance: 500, PriceCoins: 300, Error: "product is inactive"}},
+		{"out of stock", quoteOrderService{balance: 200, price: 500, err: domain.ErrOutOfStock}, http.StatusConflict,
+			QuoteErrorResponse{Balance: 200, PriceCoins: 500, Shortfall: 300, Error: "product is out of stock"}},
+		{"unknown product", quoteOrderService{err: domain.ErrProductNotFound}, http.StatusNotFound,
+			QuoteErrorResponse{Error: "product not found"}},
+		{"unknown user", quoteOrderService{err: domain.ErrUserNotFound}, http.StatusNotFound,
+			QuoteErrorResponse{Error: "user not found"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.GET("/api/users/:id/can-purchase/:product_id", NewOrderServer(tt.svc, "").CanPurchase)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			var got QuoteErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode %s: %v", rec.Body, err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			// Only a quote may be cached, never a lookup failure
+			wantCache := canPurchaseMaxAge
+			if rec.Code == http.StatusNotFound {
+				wantCache = ""
+			}
+			if cache := rec.Header().Get(echo.HeaderCacheControl); cache != wantCache {
+				t.Errorf("Cache-Control %q, want %q", cache, wantCache)
+			}
+		})
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"errors"
 	"net/http"
-	"strconv"
+	"time"
 	"user-service/internal/domain"
 
 	"github.com/labstack/echo/v4"
@@ -12,21 +12,41 @@ import (
 )
 
 type ProductService interface {
-	ListProducts(ctx context.Context, categoryID *string, onlyActive bool, limit, offset int) ([]domain.Product, error)
+	ListProducts(ctx context.Context, categoryID *string, onlyActive bool, sort string, limit, offset int) (domain.Page[domain.Product], error)
 	GetProductByID(ctx context.Context, id string) (*domain.Product, error)
-	GetProductBySlug(ctx context.Context, slug string) (*domain.Product, error)
+	GetProductBySlug(ctx context.Context, slug string, includeInactive bool) (*domain.Product, error)
+	ExpandCategory(ctx context.Context, product *domain.Product) (*domain.ProductWithCategory, error)
 	CreateProduct(ctx context.Context, req domain.CreateProductRequest) (*domain.Product, error)
+	CloneProduct(ctx context.Context, id string) (*domain.Product, error)
+	ImportProducts(ctx context.Context, req domain.ProductImportRequest) ([]domain.ProductImportResult, error)
 	UpdateProduct(ctx context.Context, id string, req domain.UpdateProductRequest) (*domain.Product, error)
 	DeleteProduct(ctx context.Context, id string) error
+	UpdateCategoryPrices(ctx context.Context, categoryID string, req domain.BulkPriceUpdateRequest) (int64, error)
+	ReserveSlug(ctx context.Context, req domain.ReserveSlugRequest) (*domain.SlugReservation, error)
+	ReleaseSlug(ctx context.Context, req domain.ReleaseSlugRequest) error
+	ListAllProducts(ctx context.Context, q domain.AdminProductQuery) (domain.Page[domain.Product], error)
+}
+
+// ProductViewCounter counts product views for popularity sorting.
+type ProductViewCounter interface {
+	RecordView(productID string) error
 }
 
 type productServer struct {
 	productService ProductService
+	viewCounter    ProductViewCounter
+	adminToken     string
+	// hideInactive hides inactive products fetched by slug from callers
+	// without adminToken.
+	hideInactive bool
 }
 
-func NewProductServer(productService ProductService) *productServer {
+func NewProductServer(productService ProductService, viewCounter ProductViewCounter, adminToken string, hideInactive bool) *productServer {
 	return &productServer{
 		productService: productService,
+		viewCounter:    viewCounter,
+		adminToken:     adminToken,
+		hideInactive:   hideInactive,
 	}
 }
 
@@ -36,32 +56,64 @@ func handleProductError(err error) (int, string) {
 		return http.StatusNotFound, "product not found"
 	case errors.Is(err, domain.ErrProductSlugExists):
 		return http.StatusConflict, "product with this slug already exists"
-	case errors.Is(err, domain.ErrInvalidProductSlug), errors.Is(err, domain.ErrInvalidProductName), errors.Is(err, domain.ErrInvalidPrice), errors.Is(err, domain.ErrInvalidUUID):
+	case errors.Is(err, domain.ErrCategoryNotFound):
+		return http.StatusNotFound, "category not found"
+	case errors.Is(err, domain.ErrSlugReserved):
+		return http.StatusConflict, "slug is reserved by another owner"
+	case errors.Is(err, domain.ErrSlugReservationMissing):
+		return http.StatusNotFound, "slug reservation not found"
+	case errors.Is(err, domain.ErrInvalidSlugOwner), errors.Is(err, domain.ErrInvalidReservationTTL), errors.Is(err, domain.ErrInvalidSortField), errors.Is(err, domain.ErrInvalidProductImport):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, domain.ErrListLimitTooLarge), errors.Is(err, domain.ErrListOffsetTooLarge):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, domain.ErrInvalidProductMetadata), errors.Is(err, domain.ErrInvalidMetadataSchema), errors.Is(err, domain.ErrProductContentTooLarge):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, domain.ErrCategoryFull), errors.Is(err, domain.ErrCategoryInactive):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, domain.ErrNoFreeSlug):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, domain.ErrModifiedSince):
+		return http.StatusPreconditionFailed, "modified since If-Unmodified-Since"
+	case errors.Is(err, domain.ErrInvalidProductSlug), errors.Is(err, domain.ErrInvalidProductName), errors.Is(err, domain.ErrInvalidPrice), errors.Is(err, domain.ErrInvalidPriceAdjustment), errors.Is(err, domain.ErrInvalidStock), errors.Is(err, domain.ErrInvalidUUID):
 		return http.StatusBadRequest, "invalid request"
 	default:
 		return http.StatusInternalServerError, "internal server error"
 	}
 }
 
+// ifUnmodifiedSince parses the If-Unmodified-Since header. A missing or
+// malformed date yields nil and the update runs unconditionally, as RFC 9110
+// asks of a recipient that can't parse the date.
+func ifUnmodifiedSince(c echo.Context) *time.Time {
+	header := c.Request().Header.Get("If-Unmodified-Since")
+	if header == "" {
+		return nil
+	}
+	t, err := http.ParseTime(header)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// preconditionFailed writes the 412 for a stale conditional update, with the
+// current updated_at so the client can reload and retry.
+func preconditionFailed(c echo.Context, err *domain.ModifiedSinceError) error {
+	return c.JSON(http.StatusPreconditionFailed, PreconditionFailedResponse{
+		Error:     "modified since If-Unmodified-Since",
+		UpdatedAt: err.UpdatedAt,
+	})
+}
+
 func (s *productServer) ListProducts(c echo.Context) error {
 	categoryID := c.QueryParam("category_id")
 	onlyActive := c.QueryParam("only_active") == "true"
-	
-	limitStr := c.QueryParam("limit")
-	offsetStr := c.QueryParam("offset")
-	
-	limit := 10
-	offset := 0
-	
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
-		}
-	}
-	if offsetStr != "" {
-		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
-			offset = o
-		}
+
+	limit, offset, err := paginationParams(c, 10)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
 	}
 
 	var categoryIDPtr *string
@@ -69,7 +121,7 @@ func (s *productServer) ListProducts(c echo.Context) error {
 		categoryIDPtr = &categoryID
 	}
 
-	products, err := s.productService.ListProducts(c.Request().Context(), categoryIDPtr, onlyActive, limit, offset)
+	page, err := s.productService.ListProducts(c.Request().Context(), categoryIDPtr, onlyActive, c.QueryParam("sort"), limit, offset)
 	if err != nil {
 		log.WithError(err).Error("Failed to list products")
 		statusCode, errorMsg := handleProductError(err)
@@ -78,7 +130,21 @@ func (s *productServer) ListProducts(c echo.Context) error {
 		})
 	}
 
-	return c.JSON(http.StatusOK, products)
+	return c.JSON(http.StatusOK, newPage(page))
+}
+
+// RecordView counts a view of the product. Views are buffered and written in
+// batches, so the response doesn't wait for the database.
+func (s *productServer) RecordView(c echo.Context) error {
+	id := c.Param("id")
+	if err := s.viewCounter.RecordView(id); err != nil {
+		statusCode, errorMsg := handleProductError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.NoContent(http.StatusAccepted)
 }
 
 func (s *productServer) GetProductByID(c echo.Context) error {
@@ -98,7 +164,7 @@ func (s *productServer) GetProductByID(c echo.Context) error {
 		})
 	}
 
-	return c.JSON(http.StatusOK, product)
+	return s.productResponse(c, product)
 }
 
 func (s *productServer) GetProductBySlug(c echo.Context) error {
@@ -109,7 +175,8 @@ func (s *productServer) GetProductBySlug(c echo.Context) error {
 		})
 	}
 
-	product, err := s.productService.GetProductBySlug(c.Request().Context(), slug)
+	includeInactive := !s.hideInactive || isAdmin(c, s.adminToken)
+	product, err := s.productService.GetProductBySlug(c.Request().Context(), slug, includeInactive)
 	if err != nil {
 		log.WithError(err).WithField("slug", slug).Error("Failed to get product by slug")
 		statusCode, errorMsg := handleProductError(err)
@@ -118,7 +185,31 @@ func (s *productServer) GetProductBySlug(c echo.Context) error {
 		})
 	}
 
-	return c.JSON(http.StatusOK, product)
+	return s.productResponse(c, product)
+}
+
+// productResponse writes product, with its category embedded when the
+// request has expand=category.
+func (s *productServer) productResponse(c echo.Context, product *domain.Product) error {
+	switch c.QueryParam("expand") {
+	case "":
+		return c.JSON(http.StatusOK, product)
+	case domain.ProductExpandCategory:
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "expand must be category",
+		})
+	}
+
+	expanded, err := s.productService.ExpandCategory(c.Request().Context(), product)
+	if err != nil {
+		log.WithError(err).WithField("product_id", product.ID).Error("Failed to expand product category")
+		statusCode, errorMsg := handleProductError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+	return c.JSON(http.StatusOK, expanded)
 }
 
 func (s *productServer) CreateProduct(c echo.Context) error {
@@ -138,9 +229,63 @@ func (s *productServer) CreateProduct(c echo.Context) error {
 		})
 	}
 
+	c.Response().Header().Set(echo.HeaderLocation, "/api/catalog/products/"+product.ID)
+	return c.JSON(http.StatusCreated, product)
+}
+
+// CloneProduct copies a product into a new inactive product with a fresh slug.
+func (s *productServer) CloneProduct(c echo.Context) error {
+	id := c.Param("id")
+
+	product, err := s.productService.CloneProduct(c.Request().Context(), id)
+	if err != nil {
+		log.WithError(err).WithField("product_id", id).Error("Failed to clone product")
+		statusCode, errorMsg := handleProductError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, "/api/catalog/products/"+product.ID)
 	return c.JSON(http.StatusCreated, product)
 }
 
+// ImportProducts creates a batch of products and reports each row's outcome.
+// The response is 200 even when some rows failed; callers check the per-row
+// errors.
+func (s *productServer) ImportProducts(c echo.Context) error {
+	var req domain.ProductImportRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request",
+		})
+	}
+
+	results, err := s.productService.ImportProducts(c.Request().Context(), req)
+	if err != nil {
+		log.WithError(err).Error("Failed to import products")
+		statusCode, errorMsg := handleProductError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	created := 0
+	for i := range results {
+		if results[i].Err != nil {
+			_, results[i].Error = handleProductError(results[i].Err)
+			continue
+		}
+		created++
+	}
+
+	return c.JSON(http.StatusOK, ImportProductsResponse{
+		Created: created,
+		Failed:  len(results) - created,
+		Results: results,
+	})
+}
+
 func (s *productServer) UpdateProduct(c echo.Context) error {
 	id := c.Param("id")
 	if id == "" {
@@ -156,8 +301,14 @@ func (s *productServer) UpdateProduct(c echo.Context) error {
 		})
 	}
 
+	req.IfUnmodifiedSince = ifUnmodifiedSince(c)
+
 	product, err := s.productService.UpdateProduct(c.Request().Context(), id, req)
 	if err != nil {
+		var staleErr *domain.ModifiedSinceError
+		if errors.As(err, &staleErr) {
+			return preconditionFailed(c, staleErr)
+		}
 		log.WithError(err).WithField("product_id", id).Error("Failed to update product")
 		statusCode, errorMsg := handleProductError(err)
 		return c.JSON(statusCode, map[string]string{
@@ -186,4 +337,95 @@ func (s *productServer) DeleteProduct(c echo.Context) error {
 	}
 
 	return c.NoContent(http.StatusNoContent)
-}
\ No newline at end of file
+}
+
+func (s *productServer) UpdateCategoryPrices(c echo.Context) error {
+	categoryID := c.Param("id")
+
+	var req domain.BulkPriceUpdateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request",
+		})
+	}
+
+	updated, err := s.productService.UpdateCategoryPrices(c.Request().Context(), categoryID, req)
+	if err != nil {
+		log.WithError(err).WithField("category_id", categoryID).Error("Failed to update category prices")
+		statusCode, errorMsg := handleProductError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, UpdatePricesResponse{Updated: updated})
+}
+
+func (s *productServer) ReserveSlug(c echo.Context) error {
+	var req domain.ReserveSlugRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request",
+		})
+	}
+
+	reservation, err := s.productService.ReserveSlug(c.Request().Context(), req)
+	if err != nil {
+		log.WithError(err).WithField("slug", req.Slug).Error("Failed to reserve slug")
+		statusCode, errorMsg := handleProductError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, reservation)
+}
+
+func (s *productServer) ReleaseSlug(c echo.Context) error {
+	var req domain.ReleaseSlugRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request",
+		})
+	}
+
+	if err := s.productService.ReleaseSlug(c.Request().Context(), req); err != nil {
+		log.WithError(err).WithField("slug", req.Slug).Error("Failed to release slug")
+		statusCode, errorMsg := handleProductError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ListAllProducts is the admin product list: every category, inactive products
+// included unless only_active=true, sortable by any whitelisted column.
+func (s *productServer) ListAllProducts(c echo.Context) error {
+	limit, offset, err := paginationParams(c, 10)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	q := domain.AdminProductQuery{
+		OnlyActive: c.QueryParam("only_active") == "true",
+		SortBy:     c.QueryParam("sort"),
+		Descending: c.QueryParam("order") == "desc",
+		Limit:      limit,
+		Offset:     offset,
+	}
+
+	page, err := s.productService.ListAllProducts(c.Request().Context(), q)
+	if err != nil {
+		log.WithError(err).Error("Failed to list all products")
+		statusCode, errorMsg := handleProductError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, newPage(page))
+}
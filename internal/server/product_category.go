@@ -13,19 +13,29 @@ import (
 type ProductCategoryService interface {
 	ListCategories(ctx context.Context, onlyActive bool) ([]domain.ProductCategory, error)
 	GetCategoryByID(ctx context.Context, id string) (*domain.ProductCategory, error)
-	GetCategoryBySlug(ctx context.Context, slug string) (*domain.ProductCategory, error)
+	GetCategoryBySlug(ctx context.Context, slug string, includeInactive bool) (*domain.ProductCategory, error)
+	GetCategoriesBySlugs(ctx context.Context, slugs []string, includeInactive bool) (map[string]domain.ProductCategory, error)
 	CreateCategory(ctx context.Context, req domain.CreateCategoryRequest) (*domain.ProductCategory, error)
+	EnsureCategory(ctx context.Context, req domain.CreateCategoryRequest) (*domain.ProductCategory, bool, error)
 	UpdateCategory(ctx context.Context, id string, req domain.UpdateCategoryRequest) (*domain.ProductCategory, error)
 	DeleteCategory(ctx context.Context, id string) error
+	CompactPositions(ctx context.Context) (int64, error)
+	CountActiveProducts(ctx context.Context) (map[string]int64, error)
 }
 
 type productCategoryServer struct {
 	categoryService ProductCategoryService
+	adminToken      string
+	// hideInactive hides inactive categories fetched by slug from callers
+	// without adminToken.
+	hideInactive bool
 }
 
-func NewProductCategoryServer(categoryService ProductCategoryService) *productCategoryServer {
+func NewProductCategoryServer(categoryService ProductCategoryService, adminToken string, hideInactive bool) *productCategoryServer {
 	return &productCategoryServer{
 		categoryService: categoryService,
+		adminToken:      adminToken,
+		hideInactive:    hideInactive,
 	}
 }
 
@@ -37,6 +47,12 @@ func handleCategoryError(err error) (int, string) {
 		return http.StatusConflict, "category with this slug already exists"
 	case errors.Is(err, domain.ErrInvalidCategorySlug), errors.Is(err, domain.ErrInvalidCategoryName), errors.Is(err, domain.ErrInvalidUUID):
 		return http.StatusBadRequest, "invalid request"
+	case errors.Is(err, domain.ErrInvalidMetadataSchema), errors.Is(err, domain.ErrInvalidSlugLookup):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, domain.ErrCategoryHasProducts), errors.Is(err, domain.ErrCategoryProtected), errors.Is(err, domain.ErrCategoryPositionTaken):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, domain.ErrModifiedSince):
+		return http.StatusPreconditionFailed, "modified since If-Unmodified-Since"
 	default:
 		return http.StatusInternalServerError, "internal server error"
 	}
@@ -54,7 +70,11 @@ func (s *productCategoryServer) ListCategories(c echo.Context) error {
 		})
 	}
 
-	return c.JSON(http.StatusOK, categories)
+	// Categories aren't paginated, so the envelope has no limit or offset
+	return c.JSON(http.StatusOK, List[domain.ProductCategory]{
+		Items: categories,
+		Total: len(categories),
+	})
 }
 
 func (s *productCategoryServer) GetCategoryByID(c echo.Context) error {
@@ -85,7 +105,8 @@ func (s *productCategoryServer) GetCategoryBySlug(c echo.Context) error {
 		})
 	}
 
-	category, err := s.categoryService.GetCategoryBySlug(c.Request().Context(), slug)
+	includeInactive := !s.hideInactive || isAdmin(c, s.adminToken)
+	category, err := s.categoryService.GetCategoryBySlug(c.Request().Context(), slug, includeInactive)
 	if err != nil {
 		log.WithError(err).WithField("slug", slug).Error("Failed to get category by slug")
 		statusCode, errorMsg := handleCategoryError(err)
@@ -97,6 +118,29 @@ func (s *productCategoryServer) GetCategoryBySlug(c echo.Context) error {
 	return c.JSON(http.StatusOK, category)
 }
 
+// GetCategoriesBySlugs resolves a batch of slugs in one request. The response
+// is an object keyed by slug; slugs with no visible category are absent.
+func (s *productCategoryServer) GetCategoriesBySlugs(c echo.Context) error {
+	var req domain.CategorySlugsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request",
+		})
+	}
+
+	includeInactive := !s.hideInactive || isAdmin(c, s.adminToken)
+	categories, err := s.categoryService.GetCategoriesBySlugs(c.Request().Context(), req.Slugs, includeInactive)
+	if err != nil {
+		log.WithError(err).Error("Failed to get categories by slugs")
+		statusCode, errorMsg := handleCategoryError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, categories)
+}
+
 func (s *productCategoryServer) CreateCategory(c echo.Context) error {
 	var req domain.CreateCategoryRequest
 	if err := c.Bind(&req); err != nil {
@@ -104,6 +148,13 @@ func (s *productCategoryServer) CreateCategory(c echo.Context) error {
 			"error": "invalid request",
 		})
 	}
+	onConflict, err := domain.ParsePositionConflict(c.QueryParam("on_conflict"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	req.OnConflict = onConflict
 
 	category, err := s.categoryService.CreateCategory(c.Request().Context(), req)
 	if err != nil {
@@ -114,6 +165,48 @@ func (s *productCategoryServer) CreateCategory(c echo.Context) error {
 		})
 	}
 
+	c.Response().Header().Set(echo.HeaderLocation, "/api/catalog/categories/"+category.ID)
+	return c.JSON(http.StatusCreated, category)
+}
+
+// EnsureCategory upserts the category named by the slug in the path: 201 when
+// it was created, 200 when an existing one was updated.
+func (s *productCategoryServer) EnsureCategory(c echo.Context) error {
+	slug := c.Param("slug")
+
+	var req domain.CreateCategoryRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request",
+		})
+	}
+	if req.Slug != "" && req.Slug != slug {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "slug in body does not match the path",
+		})
+	}
+	req.Slug = slug
+	onConflict, err := domain.ParsePositionConflict(c.QueryParam("on_conflict"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	req.OnConflict = onConflict
+
+	category, created, err := s.categoryService.EnsureCategory(c.Request().Context(), req)
+	if err != nil {
+		log.WithError(err).WithField("slug", slug).Error("Failed to ensure category")
+		statusCode, errorMsg := handleCategoryError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	if !created {
+		return c.JSON(http.StatusOK, category)
+	}
+	c.Response().Header().Set(echo.HeaderLocation, "/api/catalog/categories/"+category.ID)
 	return c.JSON(http.StatusCreated, category)
 }
 
@@ -131,9 +224,21 @@ func (s *productCategoryServer) UpdateCategory(c echo.Context) error {
 			"error": "invalid request",
 		})
 	}
+	onConflict, err := domain.ParsePositionConflict(c.QueryParam("on_conflict"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	req.OnConflict = onConflict
+	req.IfUnmodifiedSince = ifUnmodifiedSince(c)
 
 	category, err := s.categoryService.UpdateCategory(c.Request().Context(), id, req)
 	if err != nil {
+		var staleErr *domain.ModifiedSinceError
+		if errors.As(err, &staleErr) {
+			return preconditionFailed(c, staleErr)
+		}
 		log.WithError(err).WithField("category_id", id).Error("Failed to update category")
 		statusCode, errorMsg := handleCategoryError(err)
 		return c.JSON(statusCode, map[string]string{
@@ -162,4 +267,33 @@ func (s *productCategoryServer) DeleteCategory(c echo.Context) error {
 	}
 
 	return c.NoContent(http.StatusNoContent)
-}
\ No newline at end of file
+}
+
+// CompactPositions renumbers all categories 1..N in their current order.
+func (s *productCategoryServer) CompactPositions(c echo.Context) error {
+	updated, err := s.categoryService.CompactPositions(c.Request().Context())
+	if err != nil {
+		log.WithError(err).Error("Failed to compact category positions")
+		statusCode, errorMsg := handleCategoryError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, CompactPositionsResponse{
+		Updated: updated,
+	})
+}
+
+func (s *productCategoryServer) CountProducts(c echo.Context) error {
+	counts, err := s.categoryService.CountActiveProducts(c.Request().Context())
+	if err != nil {
+		log.WithError(err).Error("Failed to count products per category")
+		statusCode, errorMsg := handleCategoryError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, counts)
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"user-service/internal/domain"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ensuringCategoryService upserts categories by slug in memory.
+type ensuringCategoryService struct {
+	ProductCategoryService
+	bySlug map[string]*domain.ProductCategory
+}
+
+func (f ensuringCategoryService) EnsureCategory(ctx context.Context, req domain.CreateCategoryRequest) (*domain.ProductCategory, bool, error) {
+	if err := domain.ValidateCategoryName(req.Name, domain.DefaultMinNameLength); err != nil {
+		return nil, false, err
+	}
+	c, ok := f.bySlug[req.Slug]
+	if !ok {
+		c = &domain.ProductCategory{ID: "0190f1a2-0000-7000-8000-0000000000c1", Slug: req.Slug}
+		f.bySlug[req.Slug] = c
+	}
+	c.Name, c.Position, c.IsActive = req.Name, req.Position, req.IsActive
+	return c, !ok, nil
+}
+
+func TestEnsureCategoryCreatesThenUpdates(t *testing.T) {
+	service := ensuringCategoryService{bySlug: map[string]*domain.ProductCategory{}}
+	e := echo.New()
+	e.PUT("/api/catalog/categories/by-slug/:slug", NewProductCategoryServer(service, "", false).EnsureCategory)
+	put := func(slug, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/catalog/categories/by-slug/"+slug, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := put("board-games", `{"name":"Board games","position":3,"is_active":true}`)
+	if rec.Code != http.StatusCreated || rec.Header().Get(echo.HeaderLocation) != "/api/catalog/categories/0190f1a2-0000-7000-8000-0000000000c1" {
+		t.Fatalf("first run: got %d with Location %q, want 201 and the new category", rec.Code, rec.Header().Get(echo.HeaderLocation))
+	}
+
+	// The re-run finds the category and brings it in line
+	rec = put("board-games", `{"slug":"board-games","name":"Tabletop games","position":4,"is_active":false}`)
+	if rec.Code != http.StatusOK || rec.Header().Get(echo.HeaderLocation) != "" {
+		t.Fatalf("second run: got %d with Location %q, want 200", rec.Code, rec.Header().Get(echo.HeaderLocation))
+	}
+	var category domain.ProductCategory
+	if err := json.Unmarshal(rec.Body.Bytes(), &category); err != nil {
+		t.Fatalf("decode category: %v", err)
+	}
+	if category.Name != "Tabletop games" || category.Position != 4 || category.IsActive || len(service.bySlug) != 1 {
+		t.Errorf("second run returned %+v with %d categories, want the one category updated", category, len(service.bySlug))
+	}
+
+	for _, tt := range []struct{ name, slug, body, query string }{
+		{"slug mismatch", "board-games", `{"slug":"card-games","name":"Card games"}`, ""},
+		{"invalid name", "board-games", `{"name":""}`, ""},
+		{"unknown on_conflict", "board-games", `{"name":"Board games"}`, "?on_conflict=overwrite"},
+	} {
+		if rec := put(tt.slug+tt.query, tt.body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", tt.name, rec.Code)
+		}
+	}
+	if c := service.bySlug["board-games"]; c.Name != "Tabletop games" || len(service.bySlug) != 1 {
+		t.Errorf("rejected runs changed the categories: %+v", service.bySlug)
+	}
+}
+
+// slugLookupService resolves slugs against a fixed set of categories, as the
+// service does.
+type slugLookupService struct {
+	ProductCategoryService
+	includeInactive *bool
+}
+
+func (f slugLookupService) GetCategoriesBySlugs(ctx context.Context, slugs []string, includeInactive bool) (map[string]domain.ProductCategory, error) {
+	*f.includeInactive = includeInactive
+	slugs, err := domain.NormalizeCategorySlugs(slugs)
+	if err != nil {
+		return nil, err
+	}
+	stored := map[string]domain.ProductCategory{
+		"books":   {ID: "0190f1a2-0000-7000-8000-0000000000c1", Slug: "books", IsActive: true},
+		"pens":    {ID: "0190f1a2-0000-7000-8000-0000000000c2", Slug: "pens", IsActive: true},
+		"retired": {ID: "0190f1a2-0000-7000-8000-0000000000c3", Slug: "retired"},
+	}
+	found := map[string]domain.ProductCategory{}
+	for _, slug := range slugs {
+		if c, ok := stored[slug]; ok && (c.IsActive || includeInactive) {
+			found[slug] = c
+		}
+	}
+	return found, nil
+}
+
+func TestGetCategoriesBySlugsMixesFoundAndMissing(t *testing.T) {
+	const adminToken = "admin-secret"
+	var includeInactive bool
+	e := echo.New()
+	e.POST("/api/catalog/categories/by-slugs", NewProductCategoryServer(slugLookupService{includeInactive: &includeInactive}, adminToken, true).GetCategoriesBySlugs)
+	post := func(body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/catalog/categories/by-slugs", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if token != "" {
+			req.Header.Set(AdminTokenHeader, token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		token string
+		want  []string
+	}{
+		{"", []string{"books", "pens"}},
+		{adminToken, []string{"books", "pens", "retired"}},
+	}
+	for _, tt := range tests {
+		rec := post(`{"slugs":["books","missing","pens","retired","books"]}`, tt.token)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("token %q: got %d: %s", tt.token, rec.Code, rec.Body)
+		}
+		// Missing slugs are absent, not null
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(rec.Body.Bytes(), &raw); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		if len(raw) != len(tt.want) {
+			t.Errorf("token %q: got keys of %s, want %v", tt.token, rec.Body, tt.want)
+		}
+		for _, slug := range tt.want {
+			var c domain.ProductCategory
+			if err := json.Unmarshal(raw[slug], &c); err != nil || c.Slug != slug {
+				t.Errorf("token %q: %s maps to %s", tt.token, slug, raw[slug])
+			}
+		}
+		if includeInactive != (tt.token == adminToken) {
+			t.Errorf("token %q: service asked with includeInactive %v", tt.token, includeInactive)
+		}
+	}
+
+	// All missing is an empty object
+	if rec := post(`{"slugs":["missing"]}`, ""); rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "{}" {
+		t.Errorf("only missing slugs: got %d %s, want 200 {}", rec.Code, rec.Body)
+	}
+
+	tooMany := make([]string, domain.MaxCategorySlugLookup+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("category-%d", i)
+	}
+	body, _ := json.Marshal(domain.CategorySlugsRequest{Slugs: tooMany})
+	for name, body := range map[string]string{
+		"no slugs":  `{"slugs":[]}`,
+		"too many":  string(body),
+		"malformed": `{"slugs":["books","Board Games"]}`,
+		"not json":  `{"slugs":`,
+	} {
+		if rec := post(body, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", name, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"user-service/internal/domain"
+
+	"github.com/labstack/echo/v4"
+)
+
+// conditionalStore applies an update only when the resource, last updated
+// at updatedAt, is unmodified since the request's precondition, as the
+// repositories do.
+type conditionalStore struct {
+	updatedAt time.Time
+	got       **time.Time
+}
+
+func (s conditionalStore) apply(since *time.Time) error {
+	*s.got = since
+	if since != nil && s.updatedAt.Truncate(time.Second).After(*since) {
+		return &domain.ModifiedSinceError{UpdatedAt: s.updatedAt}
+	}
+	return nil
+}
+
+type conditionalProductService struct {
+	ProductService
+	conditionalStore
+}
+
+func (f conditionalProductService) UpdateProduct(ctx context.Context, id string, req domain.UpdateProductRequest) (*domain.Product, error) {
+	if err := f.apply(req.IfUnmodifiedSince); err != nil {
+		return nil, err
+	}
+	return &domain.Product{ID: id, Name: *req.Name}, nil
+}
+
+type conditionalCategoryService struct {
+	ProductCategoryService
+	conditionalStore
+}
+
+func (f conditionalCategoryService) UpdateCategory(ctx context.Context, id string, req domain.UpdateCategoryRequest) (*domain.ProductCategory, error) {
+	if err := f.apply(req.IfUnmodifiedSince); err != nil {
+		return nil, err
+	}
+	return &domain.ProductCategory{ID: id, Name: *req.Name}, nil
+}
+
+func TestIfUnmodifiedSince(t *testing.T) {
+	const id = "0190f1a2-0000-7000-8000-000000000001"
+	updatedAt := time.Date(2026, 10, 1, 12, 0, 0, 500_000_000, time.UTC)
+	var got *time.Time
+	store := conditionalStore{updatedAt: updatedAt, got: &got}
+
+	e := echo.New()
+	e.PUT("/products/:id", NewProductServer(conditionalProductService{conditionalStore: store}, nil, "", false).UpdateProduct)
+	e.PUT("/categories/:id", NewProductCategoryServer(conditionalCategoryService{conditionalStore: store}, "", false).UpdateCategory)
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+		// wantSince is the precondition the service sees; zero for none.
+		wantSince time.Time
+	}{
+		{"missing", "", http.StatusOK, time.Time{}},
+		// HTTP dates have whole seconds, so the sub-second part of updated_at is ignored
+		{"fresh at updated_at", "Thu, 01 Oct 2026 12:00:00 GMT", http.StatusOK, updatedAt.Truncate(time.Second)},
+		{"fresh after updated_at", "Thu, 01 Oct 2026 13:00:00 GMT", http.StatusOK, updatedAt.Truncate(time.Second).Add(time.Hour)},
+		{"stale", "Thu, 01 Oct 2026 11:59:59 GMT", http.StatusPreconditionFailed, updatedAt.Truncate(time.Second).Add(-time.Second)},
+		// An unparsable date is ignored and the update runs unconditionally
+		{"malformed", "yesterday", http.StatusOK, time.Time{}},
+	}
+	for _, path := range []string{"/products/" + id, "/categories/" + id} {
+		for _, tt := range tests {
+			got = nil
+			req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(`{"name":"Renamed"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			if tt.header != "" {
+				req.Header.Set("If-Unmodified-Since", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("%s %s: got %d, want %d: %s", path, tt.name, rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantSince.IsZero() != (got == nil) || got != nil && !got.Equal(tt.wantSince) {
+				t.Errorf("%s %s: service got precondition %v, want %v", path, tt.name, got, tt.wantSince)
+			}
+			if tt.wantStatus != http.StatusPreconditionFailed {
+				continue
+			}
+			// The client gets the current updated_at to reload and retry with
+			var body PreconditionFailedResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || !body.UpdatedAt.Equal(updatedAt) {
+				t.Errorf("%s %s: body %s, want updated_at %v", path, tt.name, rec.Body, updatedAt)
+			}
+		}
+	}
+}
+
+// slugCatalog holds one active and one inactive product and category, and
+// hides the inactive ones unless asked to include them, as the services do.
+type slugCatalog struct {
+	ProductService
+	ProductCategoryService
+}
+
+func (slugCatalog) GetProductBySlug(ctx context.Context, slug string, includeInactive bool) (*domain.Product, error) {
+	products := map[string]*domain.Product{
+		"on-sale": {ID: "0190f1a2-0000-7000-8000-0000000000a1", Slug: "on-sale", IsActive: true},
+		"retired": {ID: "0190f1a2-0000-7000-8000-0000000000a2", Slug: "retired"},
+	}
+	p, ok := products[slug]
+	if !ok || !p.IsActive && !includeInactive {
+		return nil, domain.ErrProductNotFound
+	}
+	return p, nil
+}
+
+func (slugCatalog) GetCategoryBySlug(ctx context.Context, slug string, includeInactive bool) (*domain.ProductCategory, error) {
+	categories := map[string]*domain.ProductCategory{
+		"on-sale": {ID: "0190f1a2-0000-7000-8000-0000000000c1", Slug: "on-sale", IsActive: true},
+		"retired": {ID: "0190f1a2-0000-7000-8000-0000000000c2", Slug: "retired"},
+	}
+	c, ok := categories[slug]
+	if !ok || !c.IsActive && !includeInactive {
+		return nil, domain.ErrCategoryNotFound
+	}
+	return c, nil
+}
+
+func TestInactiveBySlugIsHiddenFromPublic(t *testing.T) {
+	const adminToken = "admin-secret"
+	tests := []struct {
+		hide              bool
+		token             string
+		slug              string
+		wantStatus        int
+		wantSameAsMissing bool
+	}{
+		{true, "", "on-sale", http.StatusOK, false},
+		{true, "", "retired", http.StatusNotFound, true},
+		{true, "wrong", "retired", http.StatusNotFound, true},
+		{true, adminToken, "retired", http.StatusOK, false},
+		{true, adminToken, "gone", http.StatusNotFound, false},
+		// With hiding off everyone sees inactive entries, as before
+		{false, "", "retired", http.StatusOK, false},
+	}
+	for _, kind := range []string{"products", "categories"} {
+		for _, tt := range tests {
+			e := echo.New()
+			e.GET("/api/catalog/products/slug/:slug", NewProductServer(slugCatalog{}, nil, adminToken, tt.hide).GetProductBySlug)
+			e.GET("/api/catalog/categories/slug/:slug", NewProductCategoryServer(slugCatalog{}, adminToken, tt.hide).GetCategoryBySlug)
+			get := func(slug string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, "/api/catalog/"+kind+"/slug/"+slug, nil)
+				if tt.token != "" {
+					req.Header.Set(AdminTokenHeader, tt.token)
+				}
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, req)
+				return rec
+			}
+
+			rec := get(tt.slug)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("%s %s, hide %v, token %q: got %d, want %d", kind, tt.slug, tt.hide, tt.token, rec.Code, tt.wantStatus)
+			}
+			// A hidden entry can't be told apart from one that doesn't exist
+			if missing := get("gone"); tt.wantSameAsMissing && rec.Body.String() != missing.Body.String() {
+				t.Errorf("%s %s: hidden body %s differs from missing body %s", kind, tt.slug, rec.Body, missing.Body)
+			}
+		}
+	}
+}
+
+// creatingProductService keeps the is_active each create was asked for and
+// fails creates with err, when set.
+type creatingProductService struct {
+	ProductService
+	got **bool
+	err error
+}
+
+func (f creatingProductService) CreateProduct(ctx context.Context, req domain.CreateProductRequest) (*domain.Product, error) {
+	*f.got = req.IsActive
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &domain.Product{ID: "0190f1a2-0000-7000-8000-0000000000a1", Slug: req.Slug}, nil
+}
+
+func TestCreateProductKeepsOmittedIsActiveApart(t *testing.T) {
+	var got *bool
+	e := echo.New()
+	e.POST("/api/catalog/products", NewProductServer(creatingProductService{got: &got}, nil, "", false).CreateProduct)
+
+	active, inactive := true, false
+	tests := []struct {
+		isActive string
+		// want is the is_active the service sees; nil leaves it to the
+		// configured default.
+		want *bool
+	}{
+		{"", nil},
+		{`,"is_active":true`, &active},
+		{`,"is_active":false`, &inactive},
+	}
+	for _, tt := range tests {
+		got = nil
+		req := httptest.NewRequest(http.MethodPost, "/api/catalog/products", strings.NewReader(`{"slug":"lamp","name":"Lamp"`+tt.isActive+`}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("%q: got %d: %s", tt.isActive, rec.Code, rec.Body)
+		}
+		if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+			t.Errorf("%q: service got is_active %v, want %v", tt.isActive, got, tt.want)
+		}
+	}
+}
+
+// expandingProductService serves one product per slug and embeds its
+// category, which is nil for the orphan, as the service does.
+type expandingProductService struct {
+	ProductService
+}
+
+var expandCatalog = map[string]*domain.Product{
+	"in-hidden": {ID: "0190f1a2-0000-7000-8000-0000000000a1", Slug: "in-hidden", CategoryID: "0190f1a2-0000-7000-8000-0000000000c1", IsActive: true},
+	"orphan":    {ID: "0190f1a2-0000-7000-8000-0000000000a2", Slug: "orphan", CategoryID: "0190f1a2-0000-7000-8000-0000000000c9", IsActive: true},
+}
+
+func (expandingProductService) GetProductByID(ctx context.Context, id string) (*domain.Product, error) {
+	for _, p := range expandCatalog {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return nil, domain.ErrProductNotFound
+}
+
+func (expandingProductService) GetProductBySlug(ctx context.Context, slug string, includeInactive bool) (*domain.Product, error) {
+	if p, ok := expandCatalog[slug]; ok {
+		return p, nil
+	}
+	return nil, domain.ErrProductNotFound
+}
+
+func (expandingProductService) ExpandCategory(ctx context.Context, product *domain.Product) (*domain.ProductWithCategory, error) {
+	expanded := &domain.ProductWithCategory{Product: *product}
+	if product.Slug == "in-hidden" {
+		expanded.Category = &domain.ProductCategory{ID: product.CategoryID, Slug: "hidden"}
+	}
+	return expanded, nil
+}
+
+func TestGetProductExpandCategory(t *testing.T) {
+	e := echo.New()
+	server := NewProductServer(expandingProductService{}, nil, "", false)
+	e.GET("/api/catalog/products/:id", server.GetProductByID)
+	e.GET("/api/catalog/products/slug/:slug", server.GetProductBySlug)
+
+	for slug, product := range expandCatalog {
+		for _, path := range []string{"/api/catalog/products/" + product.ID, "/api/catalog/products/slug/" + slug} {
+			get := func(query string) (int, map[string]json.RawMessage) {
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path+query, nil))
+				var body map[string]json.RawMessage
+				if rec.Code == http.StatusOK {
+					if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+						t.Fatalf("%s%s: decode %s: %v", path, query, rec.Body, err)
+					}
+				}
+				return rec.Code, body
+			}
+
+			// Without expand the response is the plain product
+			code, body := get("")
+			if _, ok := body["category"]; code != http.StatusOK || ok {
+				t.Errorf("%s: got %d with category %s, want 200 without one", path, code, body["category"])
+			}
+
+			code, body = get("?expand=category")
+			if code != http.StatusOK || string(body["id"]) != `"`+product.ID+`"` || string(body["category_id"]) != `"`+product.CategoryID+`"` {
+				t.Fatalf("%s expanded: got %d %v, want the product", path, code, body)
+			}
+			raw, ok := body["category"]
+			if !ok {
+				t.Fatalf("%s expanded: no category field", path)
+			}
+			if slug == "orphan" {
+				// A missing category is explicit, not an error
+				if string(raw) != "null" {
+					t.Errorf("%s expanded: category %s, want null", path, raw)
+				}
+				continue
+			}
+			var category map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &category); err != nil {
+				t.Fatalf("%s expanded: category %s: %v", path, raw, err)
+			}
+			// The active flag is there even when false, so clients can warn
+			if string(category["slug"]) != `"hidden"` || string(category["is_active"]) != "false" {
+				t.Errorf("%s expanded: category %s, want hidden with is_active false", path, raw)
+			}
+
+			if code, _ := get("?expand=owner"); code != http.StatusBadRequest {
+				t.Errorf("%s?expand=owner: got %d, want 400", path, code)
+			}
+		}
+	}
+}
+
+func TestCreateProductInInactiveCategoryIsConflict(t *testing.T) {
+	var got *bool
+	e := echo.New()
+	e.POST("/api/catalog/products", NewProductServer(creatingProductService{got: &got, err: domain.ErrCategoryInactive}, nil, "", false).CreateProduct)
+	req := httptest.NewRequest(http.MethodPost, "/api/catalog/products", strings.NewReader(`{"slug":"lamp","name":"Lamp"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusConflict || body["error"] != domain.ErrCategoryInactive.Error() {
+		t.Errorf("got %d %s, want 409 naming the inactive category", rec.Code, rec.Body)
+	}
+}
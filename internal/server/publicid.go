@@ -0,0 +1,294 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"user-service/internal/jsonenc"
+	"user-service/internal/publicid"
+
+	"github.com/labstack/echo/v4"
+)
+
+// publicIDFields are the JSON keys and parameter names that always hold an
+// ID of one kind.
+var publicIDFields = map[string]publicid.Kind{
+	"user_id":     publicid.User,
+	"to_user_id":  publicid.User,
+	"product_id":  publicid.Product,
+	"category_id": publicid.Category,
+	"order_id":    publicid.Order,
+}
+
+// embeddedKinds are the JSON keys under which a response embeds a resource,
+// so the "id" of the embedded object is of that kind.
+var embeddedKinds = map[string]publicid.Kind{
+	"user":     publicid.User,
+	"product":  publicid.Product,
+	"category": publicid.Category,
+	"order":    publicid.Order,
+}
+
+// routeKinds maps the last static segment of a route path to the kind of
+// resource the route's :id names and, for routes that return a resource,
+// the kind of that resource. Routes with no entry, such as campaigns, keep
+// bare UUIDs.
+var routeKinds = map[string]publicid.Kind{
+	"users":      publicid.User,
+	"email":      publicid.User,
+	"restore":    publicid.User,
+	"products":   publicid.Product,
+	"clone":      publicid.Product,
+	"categories": publicid.Category,
+	"by-slug":    publicid.Category,
+	"orders":     publicid.Order,
+	"checkout":   publicid.Order,
+}
+
+// routeKind returns the kind of resource named by :id in path.
+func routeKind(path string) (publicid.Kind, bool) {
+	segments := strings.Split(path, "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		if segments[i] == ":id" && i > 0 {
+			kind, ok := routeKinds[segments[i-1]]
+			return kind, ok
+		}
+	}
+	return "", false
+}
+
+// responseKind returns the kind of resource the route at path returns.
+// Product and category lookups by slug return the resource of the
+// collection the "slug" segment is in.
+func responseKind(path string) (publicid.Kind, bool) {
+	segments := strings.Split(path, "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		segment := segments[i]
+		if segment == "" || strings.HasPrefix(segment, ":") {
+			continue
+		}
+		if segment == "slug" && i > 0 {
+			segment = segments[i-1]
+		}
+		kind, ok := routeKinds[segment]
+		return kind, ok
+	}
+	return "", false
+}
+
+// PublicIDs lets clients send prefixed public IDs wherever a UUID is
+// expected in the path or query. They are replaced with the UUID before the
+// handler runs; an ID of the wrong kind, e.g. a prod_ ID on a user route, is
+// rejected with 400. Bare UUIDs and anything else pass through for the
+// handler to validate. It must run after routing, i.e. be added with Use.
+func PublicIDs() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			names := c.ParamNames()
+			values := c.ParamValues()
+			changed := false
+			for i, name := range names {
+				if i >= len(values) {
+					break
+				}
+				kind, ok := publicIDFields[name]
+				if name == "id" {
+					kind, ok = routeKind(c.Path())
+				}
+				if !ok {
+					continue
+				}
+				id, replaced, err := resolvePublicID(kind, values[i])
+				if err != nil {
+					return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+				}
+				if replaced {
+					values[i] = id
+					changed = true
+				}
+			}
+			if changed {
+				c.SetParamValues(values...)
+			}
+
+			query := c.QueryParams()
+			for name, kind := range publicIDFields {
+				value := query.Get(name)
+				if value == "" {
+					continue
+				}
+				id, replaced, err := resolvePublicID(kind, value)
+				if err != nil {
+					return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+				}
+				if replaced {
+					query.Set(name, id)
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// resolvePublicID returns the UUID for value when it is a public ID of kind.
+// replaced is false when value is not a public ID at all.
+func resolvePublicID(kind publicid.Kind, value string) (string, bool, error) {
+	if _, ok := publicid.IsPublic(value); !ok {
+		return value, false, nil
+	}
+	id, err := publicid.Parse(kind, value)
+	if err != nil {
+		return "", false, err
+	}
+	return id, true, nil
+}
+
+// publicIDPrefixes are what a JSON string holding a public ID starts with,
+// for skipping the rewrite of bodies that have none.
+var publicIDPrefixes = [][]byte{[]byte(`"usr_`), []byte(`"prod_`), []byte(`"cat_`), []byte(`"ord_`)}
+
+// unprefixBody replaces public IDs in the ID fields of a JSON request body
+// with their UUIDs.
+func unprefixBody(body []byte) ([]byte, error) {
+	found := false
+	for _, prefix := range publicIDPrefixes {
+		if bytes.Contains(body, prefix) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return body, nil
+	}
+
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		// Leave the error to the real decoder
+		return body, nil
+	}
+	if err := unprefixValue(v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func unprefixValue(v interface{}) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if s, ok := value.(string); ok {
+				kind, ok := publicIDFields[key]
+				if !ok {
+					continue
+				}
+				id, replaced, err := resolvePublicID(kind, s)
+				if err != nil {
+					return err
+				}
+				if replaced {
+					v[key] = id
+				}
+				continue
+			}
+			if err := unprefixValue(value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if err := unprefixValue(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// prefixResponse rewrites the UUIDs in response body v to public IDs: the
+// ID fields anywhere, and "id" where the kind of its object is known. That
+// is the object the route returns, the items of a list envelope, and
+// resources embedded under a key such as "category".
+func prefixResponse(path string, v interface{}) {
+	kind, ok := responseKind(path)
+	switch body := v.(type) {
+	case map[string]interface{}:
+		_, hasItems := body["items"]
+		_, hasTotal := body["total"]
+		if hasItems && hasTotal {
+			items, _ := body["items"].([]interface{})
+			for _, item := range items {
+				prefixObject(item, kind, ok)
+			}
+			prefixObject(body, "", false)
+			return
+		}
+		prefixObject(body, kind, ok)
+	case []interface{}:
+		for _, item := range body {
+			prefixObject(item, kind, ok)
+		}
+	}
+}
+
+// prefixObject rewrites the IDs in v. When known, kind is the kind of v's
+// own "id".
+func prefixObject(v interface{}, kind publicid.Kind, known bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if s, ok := value.(string); ok {
+				if key == "id" && known {
+					v[key] = publicid.Format(kind, s)
+				} else if fieldKind, ok := publicIDFields[key]; ok {
+					v[key] = publicid.Format(fieldKind, s)
+				}
+				continue
+			}
+			embedded, ok := embeddedKinds[key]
+			prefixObject(value, embedded, ok)
+		}
+	case []interface{}:
+		for _, item := range v {
+			prefixObject(item, "", false)
+		}
+	}
+}
+
+// serializePublicIDs encodes i with enc like echo's serializer, with IDs in
+// their public form.
+func serializePublicIDs(c echo.Context, enc jsonenc.Encoder, i interface{}, indent string) error {
+	data, err := enc.Marshal(i)
+	if err != nil {
+		return err
+	}
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	prefixResponse(c.Path(), v)
+
+	return enc.Encode(c.Response(), v, indent)
+}
+
+// unprefixRequestBody replaces the request body of c with one whose public
+// IDs are UUIDs.
+func unprefixRequestBody(c echo.Context) error {
+	req := c.Request()
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
+	body, err = unprefixBody(body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return nil
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"user-service/internal/publicid"
+
+	"github.com/labstack/echo/v4"
+)
+
+const testUUID = "0190c2a8-7f1e-7a3b-9c4d-000000000001"
+
+// publicIDServer routes a few paths through PublicIDs to a handler that
+// echoes the parameters it was given.
+func publicIDServer() *echo.Echo {
+	e := echo.New()
+	e.Use(PublicIDs())
+	params := func(c echo.Context) error {
+		got := map[string]string{}
+		for _, name := range c.ParamNames() {
+			got[name] = c.Param(name)
+		}
+		if v := c.QueryParam("category_id"); v != "" {
+			got["query_category_id"] = v
+		}
+		return c.JSON(http.StatusOK, got)
+	}
+	e.GET("/api/users/:id", params)
+	e.GET("/api/users/:id/can-purchase/:product_id", params)
+	e.GET("/api/catalog/products/:id", params)
+	e.GET("/api/catalog/products", params)
+	e.GET("/api/catalog/categories/:id", params)
+	return e
+}
+
+func TestPublicIDsOnRoutes(t *testing.T) {
+	e := publicIDServer()
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		want   map[string]string
+	}{
+		{"user ID", "/api/users/" + publicid.Format(publicid.User, testUUID), http.StatusOK, map[string]string{"id": testUUID}},
+		{"bare UUID", "/api/users/" + testUUID, http.StatusOK, map[string]string{"id": testUUID}},
+		{"product ID on a user route", "/api/users/" + publicid.Format(publicid.Product, testUUID), http.StatusBadRequest, nil},
+		{"category ID on a product route", "/api/catalog/products/" + publicid.Format(publicid.Category, testUUID), http.StatusBadRequest, nil},
+		{"product ID on a category route", "/api/catalog/categories/" + publicid.Format(publicid.Product, testUUID), http.StatusBadRequest, nil},
+		{"product ID", "/api/catalog/products/" + publicid.Format(publicid.Product, testUUID), http.StatusOK, map[string]string{"id": testUUID}},
+		{"two kinds", "/api/users/" + publicid.Format(publicid.User, testUUID) + "/can-purchase/" + publicid.Format(publicid.Product, testUUID), http.StatusOK,
+			map[string]string{"id": testUUID, "product_id": testUUID}},
+		{"wrong kind as a named parameter", "/api/users/" + testUUID + "/can-purchase/" + publicid.Format(publicid.User, testUUID), http.StatusBadRequest, nil},
+		{"category in the query", "/api/catalog/products?category_id=" + publicid.Format(publicid.Category, testUUID), http.StatusOK,
+			map[string]string{"query_category_id": testUUID}},
+		{"user in the category query", "/api/catalog/products?category_id=" + publicid.Format(publicid.User, testUUID), http.StatusBadRequest, nil},
+		// Not an ID of any kind, so the handler validates it
+		{"garbage", "/api/users/not-an-id", http.StatusOK, map[string]string{"id": "not-an-id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				if !strings.Contains(rec.Body.String(), "different type of resource") {
+					t.Errorf("body %s does not explain the mismatch", rec.Body)
+				}
+				return
+			}
+			var got map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("%s = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestPublicIDsInBodies(t *testing.T) {
+	product := publicid.Format(publicid.Product, testUUID)
+	body, err := unprefixBody([]byte(`{"items":[{"product_id":"` + product + `","quantity":2}],"note":"` + product + `"}`))
+	if err != nil {
+		t.Fatalf("unprefixBody: %v", err)
+	}
+	want := `{"items":[{"product_id":"` + testUUID + `","quantity":2}],"note":"` + product + `"}`
+	if string(body) != want {
+		t.Errorf("got  %s\nwant %s", body, want)
+	}
+
+	if _, err := unprefixBody([]byte(`{"to_user_id":"` + product + `"}`)); err == nil {
+		t.Error("a product ID was accepted as to_user_id")
+	}
+}
+
+func TestResponsesUsePublicIDs(t *testing.T) {
+	e := echo.New()
+	e.JSONSerializer = TimedJSONSerializer{PublicIDs: true}
+	e.GET("/api/catalog/products/:id", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"id":          testUUID,
+			"category_id": testUUID,
+			"category":    map[string]string{"id": testUUID},
+		})
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/catalog/products/"+testUUID, nil))
+	var got struct {
+		ID         string            `json:"id"`
+		CategoryID string            `json:"category_id"`
+		Category   map[string]string `json:"category"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != publicid.Format(publicid.Product, testUUID) {
+		t.Errorf("id %q, want a product ID", got.ID)
+	}
+	if want := publicid.Format(publicid.Category, testUUID); got.CategoryID != want || got.Category["id"] != want {
+		t.Errorf("category_id %q and category.id %q, want %s", got.CategoryID, got.Category["id"], want)
+	}
+}
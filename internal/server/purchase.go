@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"user-service/internal/domain"
+
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+type PurchaseService interface {
+	Purchase(ctx context.Context, userID string, req domain.PurchaseRequest) (*domain.Purchase, error)
+	ListUserPurchases(ctx context.Context, userID string, limit, offset int) (domain.Page[domain.Purchase], error)
+}
+
+type purchaseServer struct {
+	purchaseService PurchaseService
+}
+
+func NewPurchaseServer(purchaseService PurchaseService) *purchaseServer {
+	return &purchaseServer{purchaseService: purchaseService}
+}
+
+// Purchase buys one unit of the product named by product_id or slug.
+func (s *purchaseServer) Purchase(c echo.Context) error {
+	userID := c.Param("id")
+
+	var req domain.PurchaseRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	purchase, err := s.purchaseService.Purchase(c.Request().Context(), userID, req)
+	if err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to purchase product")
+		statusCode, errorMsg := handleOrderError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	// A purchase is read back as the order it was placed in
+	c.Response().Header().Set(echo.HeaderLocation, "/api/orders/"+purchase.OrderID)
+	return c.JSON(http.StatusCreated, purchase)
+}
+
+func (s *purchaseServer) ListUserPurchases(c echo.Context) error {
+	userID := c.Param("id")
+	limit, offset, err := paginationParams(c, 10)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	page, err := s.purchaseService.ListUserPurchases(c.Request().Context(), userID, limit, offset)
+	if err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to list purchases")
+		statusCode, errorMsg := handleOrderError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, newPage(page))
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"user-service/internal/domain"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ReportService interface {
+	CoinTotals(ctx context.Context) (*domain.CoinTotals, error)
+	BurnRate(ctx context.Context, userID string, windowDays int) (*domain.BurnRate, error)
+	CoinSummary(ctx context.Context, userID string, rng domain.StatsRange) (*domain.CoinSummary, error)
+	ProductStats(ctx context.Context, productID string, rng domain.StatsRange) (*domain.ProductStats, error)
+	CatalogStats(ctx context.Context, categoryID *string, rng domain.StatsRange, limit, offset int) (domain.Page[domain.ProductStats], error)
+}
+
+type reportServer struct {
+	reportService ReportService
+}
+
+func NewReportServer(reportService ReportService) *reportServer {
+	return &reportServer{reportService: reportService}
+}
+
+func (s *reportServer) CoinTotals(c echo.Context) error {
+	totals, err := s.reportService.CoinTotals(c.Request().Context())
+	if err != nil {
+		log.WithError(err).Error("Failed to get coin totals")
+		statusCode, errorMsg := handleError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, totals)
+}
+
+// BurnRate reports a user's coin spend over the last window_days days (default 30).
+func (s *reportServer) BurnRate(c echo.Context) error {
+	id := c.Param("id")
+
+	windowDays := domain.DefaultBurnRateWindowDays
+	if raw := c.QueryParam("window_days"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": domain.ErrInvalidBurnRateWindow.Error(),
+			})
+		}
+		windowDays = v
+	}
+
+	rate, err := s.reportService.BurnRate(c.Request().Context(), id, windowDays)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidBurnRateWindow) {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": err.Error(),
+			})
+		}
+		log.WithError(err).WithField("user_id", id).Error("Failed to get burn rate")
+		statusCode, errorMsg := handleError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, rate)
+}
+
+// CoinSummary reports the coins a user was credited and spent by ledger
+// category over the days from and to (YYYY-MM-DD, both included), by default
+// the last 30 days.
+func (s *reportServer) CoinSummary(c echo.Context) error {
+	id := c.Param("id")
+
+	rng, err := domain.ParseStatsRange(c.QueryParam("from"), c.QueryParam("to"), time.Now())
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	summary, err := s.reportService.CoinSummary(c.Request().Context(), id, rng)
+	if err != nil {
+		log.WithError(err).WithField("user_id", id).Error("Failed to get coin summary")
+		statusCode, errorMsg := handleError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, summary)
+}
+
+// ProductStats reports a product's views, purchases and revenue over the days
+// from and to (YYYY-MM-DD, both included), by default the last 30 days.
+func (s *reportServer) ProductStats(c echo.Context) error {
+	id := c.Param("id")
+
+	rng, err := domain.ParseStatsRange(c.QueryParam("from"), c.QueryParam("to"), time.Now())
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	stats, err := s.reportService.ProductStats(c.Request().Context(), id, rng)
+	if err != nil {
+		log.WithError(err).WithField("product_id", id).Error("Failed to get product stats")
+		statusCode, errorMsg := handleProductError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, stats)
+}
+
+// CatalogStats reports the stats of every product viewed or bought over the
+// range, optionally only those in category_id, best selling first.
+func (s *reportServer) CatalogStats(c echo.Context) error {
+	limit, offset, err := paginationParams(c, 10)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	rng, err := domain.ParseStatsRange(c.QueryParam("from"), c.QueryParam("to"), time.Now())
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	var categoryID *string
+	if raw := c.QueryParam("category_id"); raw != "" {
+		categoryID = &raw
+	}
+
+	page, err := s.reportService.CatalogStats(c.Request().Context(), categoryID, rng, limit, offset)
+	if err != nil {
+		log.WithError(err).Error("Failed to get catalog stats")
+		statusCode, errorMsg := handleProductError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, StatsPage{
+		From:   rng.From.Format(domain.StatsDateLayout),
+		Items:  page.Items,
+		Limit:  page.Limit,
+		Offset: page.Offset,
+		To:     rng.To.Format(domain.StatsDateLayout),
+		Total:  page.Total,
+	})
+}
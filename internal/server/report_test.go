@@ -0,0 +1,223 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"user-service/internal/domain"
+
+	"github.com/labstack/echo/v4"
+)
+
+// summaryReportService answers CoinSummary with a fixed summary over the
+// range it was asked for.
+type summaryReportService struct {
+	ReportService
+	err error
+}
+
+func (f summaryReportService) CoinSummary(ctx context.Context, userID string, rng domain.StatsRange) (*domain.CoinSummary, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &domain.CoinSummary{
+		UserID:   userID,
+		From:     rng.From.Format(domain.StatsDateLayout),
+		To:       rng.To.Format(domain.StatsDateLayout),
+		Credited: 500,
+		Debited:  1200,
+		Categories: []domain.CoinCategoryTotal{
+			{Category: "boosts", Debited: 1200, Entries: 4},
+			{Category: domain.CoinCategoryOther, Credited: 500, Entries: 1},
+		},
+	}, nil
+}
+
+func TestCoinSummary(t *testing.T) {
+	const path = "/api/users/0190c2a8-7f1e-7a3b-9c4d-000000000001/coins/summary"
+
+	tests := []struct {
+		name       string
+		query      string
+		svc        summaryReportService
+		wantStatus int
+		wantFrom   string
+		wantTo     string
+	}{
+		{"range", "?from=2026-09-01&to=2026-09-30", summaryReportService{}, http.StatusOK, "2026-09-01", "2026-09-30"},
+		{"only to", "?to=2026-09-30", summaryReportService{}, http.StatusOK, "2026-09-01", "2026-09-30"},
+		{"from after to", "?from=2026-09-30&to=2026-09-01", summaryReportService{}, http.StatusBadRequest, "", ""},
+		{"junk date", "?from=september", summaryReportService{}, http.StatusBadRequest, "", ""},
+		{"unknown user", "", summaryReportService{err: domain.ErrUserNotFound}, http.StatusNotFound, "", ""},
+		{"invalid user", "", summaryReportService{err: domain.ErrInvalidUUID}, http.StatusBadRequest, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.GET("/api/users/:id/coins/summary", NewReportServer(tt.svc).CoinSummary)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path+tt.query, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got domain.CoinSummary
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if got.From != tt.wantFrom || got.To != tt.wantTo {
+				t.Errorf("range %s to %s, want %s to %s", got.From, got.To, tt.wantFrom, tt.wantTo)
+			}
+			if len(got.Categories) != 2 || got.Categories[0].Category != "boosts" || got.Categories[0].Debited != 1200 {
+				t.Errorf("categories %+v, want boosts first", got.Categories)
+			}
+		})
+	}
+}
+
+// statsReportService answers the stats reports with fixed figures over the
+// range and page it was asked for.
+type statsReportService struct {
+	ReportService
+	err      error
+	category *string
+	limit    int
+	offset   int
+}
+
+func (f *statsReportService) ProductStats(ctx context.Context, productID string, rng domain.StatsRange) (*domain.ProductStats, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	stats := &domain.ProductStats{ProductID: productID, Views: 40, Purchases: 3, RevenueCoins: 30}
+	stats.SetRange(rng)
+	return stats, nil
+}
+
+func (f *statsReportService) CatalogStats(ctx context.Context, categoryID *string, rng domain.StatsRange, limit, offset int) (domain.Page[domain.ProductStats], error) {
+	if f.err != nil {
+		return domain.Page[domain.ProductStats]{}, f.err
+	}
+	f.category, f.limit, f.offset = categoryID, limit, offset
+	stats := domain.ProductStats{ProductID: "0190c2a8-7f1e-7a3b-9c4d-000000000001", Views: 40, Purchases: 3}
+	stats.SetRange(rng)
+	return domain.Page[domain.ProductStats]{Items: []domain.ProductStats{stats}, Total: 7, Limit: limit, Offset: offset}, nil
+}
+
+func TestProductStats(t *testing.T) {
+	const adminToken = "admin-secret"
+	const path = "/api/catalog/products/0190c2a8-7f1e-7a3b-9c4d-000000000001/stats"
+
+	tests := []struct {
+		name       string
+		query      string
+		token      string
+		err        error
+		wantStatus int
+		wantFrom   string
+		wantTo     string
+	}{
+		{"range", "?from=2026-09-01&to=2026-09-30", adminToken, nil, http.StatusOK, "2026-09-01", "2026-09-30"},
+		{"only to", "?to=2026-09-30", adminToken, nil, http.StatusOK, "2026-09-01", "2026-09-30"},
+		{"longest range", "?from=2025-10-01&to=2026-10-01", adminToken, nil, http.StatusOK, "2025-10-01", "2026-10-01"},
+		{"range too long", "?from=2025-09-30&to=2026-10-01", adminToken, nil, http.StatusBadRequest, "", ""},
+		{"from after to", "?from=2026-09-30&to=2026-09-01", adminToken, nil, http.StatusBadRequest, "", ""},
+		{"junk date", "?from=september", adminToken, nil, http.StatusBadRequest, "", ""},
+		{"unknown product", "", adminToken, domain.ErrProductNotFound, http.StatusNotFound, "", ""},
+		{"invalid product", "", adminToken, domain.ErrInvalidUUID, http.StatusBadRequest, "", ""},
+		// Stats are admin-only, as main wires them
+		{"no token", "?from=2026-09-01&to=2026-09-30", "", nil, http.StatusForbidden, "", ""},
+		{"wrong token", "?from=2026-09-01&to=2026-09-30", "guess", nil, http.StatusForbidden, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.GET("/api/catalog/products/:id/stats", NewReportServer(&statsReportService{err: tt.err}).ProductStats, RequireAdminToken(adminToken))
+			req := httptest.NewRequest(http.MethodGet, path+tt.query, nil)
+			if tt.token != "" {
+				req.Header.Set(AdminTokenHeader, tt.token)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got domain.ProductStats
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if got.From != tt.wantFrom || got.To != tt.wantTo || got.Views != 40 || got.Purchases != 3 || got.RevenueCoins != 30 || got.ConversionRate != 0.075 {
+				t.Errorf("got %+v, want 3 of 40 views from %s to %s", got, tt.wantFrom, tt.wantTo)
+			}
+		})
+	}
+}
+
+func TestCatalogStats(t *testing.T) {
+	const adminToken = "admin-secret"
+	const category = "0190c2a8-7f1e-7a3b-9c4d-000000000010"
+
+	tests := []struct {
+		name         string
+		query        string
+		token        string
+		err          error
+		wantStatus   int
+		wantCategory string
+		wantLimit    int
+		wantOffset   int
+	}{
+		{"defaults", "", adminToken, nil, http.StatusOK, "", 10, 0},
+		{"page in a category", "?category_id=" + category + "&limit=5&offset=5&from=2026-09-01&to=2026-09-30", adminToken, nil, http.StatusOK, category, 5, 5},
+		{"zero limit", "?limit=0", adminToken, nil, http.StatusBadRequest, "", 0, 0},
+		{"negative offset", "?offset=-1", adminToken, nil, http.StatusBadRequest, "", 0, 0},
+		{"junk limit", "?limit=ten", adminToken, nil, http.StatusBadRequest, "", 0, 0},
+		{"range too long", "?from=2025-09-30&to=2026-10-01", adminToken, nil, http.StatusBadRequest, "", 0, 0},
+		{"limit too large", "?limit=1000", adminToken, domain.ErrListLimitTooLarge, http.StatusBadRequest, "", 0, 0},
+		{"invalid category", "?category_id=books", adminToken, domain.ErrInvalidUUID, http.StatusBadRequest, "", 0, 0},
+		{"unknown category", "?category_id=" + category, adminToken, domain.ErrCategoryNotFound, http.StatusNotFound, "", 0, 0},
+		{"no token", "", "", nil, http.StatusForbidden, "", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &statsReportService{err: tt.err}
+			e := echo.New()
+			e.GET("/api/catalog/stats", NewReportServer(svc).CatalogStats, RequireAdminToken(adminToken))
+			req := httptest.NewRequest(http.MethodGet, "/api/catalog/stats"+tt.query, nil)
+			if tt.token != "" {
+				req.Header.Set(AdminTokenHeader, tt.token)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := svc.category; (got == nil) != (tt.wantCategory == "") || got != nil && *got != tt.wantCategory {
+				t.Errorf("asked for category %v, want %q", got, tt.wantCategory)
+			}
+			var page StatsPage
+			if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if page.Limit != tt.wantLimit || page.Offset != tt.wantOffset || svc.limit != tt.wantLimit || svc.offset != tt.wantOffset {
+				t.Errorf("page %d+%d, asked for %d+%d, want %d+%d", page.Offset, page.Limit, svc.offset, svc.limit, tt.wantOffset, tt.wantLimit)
+			}
+			if page.Total != 7 || len(page.Items) != 1 || page.Items[0].From != page.From || page.Items[0].To != page.To || page.From == "" {
+				t.Errorf("page %+v, want 1 item of 7 over the page's range", page)
+			}
+		})
+	}
+}
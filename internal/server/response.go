@@ -0,0 +1,192 @@
+package server
+
+import (
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/jobs"
+)
+
+// Response bodies. Fields are declared in the order of their JSON keys, so
+// responses keep the sorted key order they had when they were built as maps.
+
+// Page is the envelope of a paginated list.
+type Page[T any] struct {
+	Items  []T   `json:"items"`
+	Limit  int   `json:"limit"`
+	Offset int   `json:"offset"`
+	Total  int64 `json:"total"`
+}
+
+// newPage wraps a page a service served, with the limit and offset it
+// settled on, in the list envelope.
+func newPage[T any](p domain.Page[T]) Page[T] {
+	return Page[T]{Items: p.Items, Limit: p.Limit, Offset: p.Offset, Total: p.Total}
+}
+
+// List is the envelope of a list that isn't paginated.
+type List[T any] struct {
+	Items []T `json:"items"`
+	Total int `json:"total"`
+}
+
+// StatsPage is a page of product stats over the dates from and to.
+type StatsPage struct {
+	From   string                `json:"from"`
+	Items  []domain.ProductStats `json:"items"`
+	Limit  int                   `json:"limit"`
+	Offset int                   `json:"offset"`
+	To     string                `json:"to"`
+	Total  int64                 `json:"total"`
+}
+
+// HealthResponse reports whether the service can serve requests.
+type HealthResponse struct {
+	CircuitBreaker string `json:"circuit_breaker,omitempty"`
+	Error          string `json:"error,omitempty"`
+	Status         string `json:"status"`
+}
+
+// MessageResponse confirms an action that has nothing else to return.
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// UserResponse is a user with whether they have access now.
+type UserResponse struct {
+	CoinsBalance        int64             `json:"coins_balance"`
+	CreatedAt           time.Time         `json:"created_at"`
+	DeletedAt           *time.Time        `json:"deleted_at,omitempty"`
+	Email               string            `json:"email"`
+	EmailVerified       bool              `json:"email_verified"`
+	HasAccess           bool              `json:"has_access"`
+	HasSubscription     bool              `json:"has_subscription"`
+	ID                  string            `json:"id"`
+	IsTrial             bool              `json:"is_trial"`
+	Name                string            `json:"name"`
+	Status              domain.UserStatus `json:"status"`
+	SubscriptionEndsAt  *time.Time        `json:"subscription_ends_at"`
+	TotalCoinsPurchased int64             `json:"total_coins_purchased"`
+	TrialEndsAt         *time.Time        `json:"trial_ends_at"`
+	UpdatedAt           time.Time         `json:"updated_at"`
+}
+
+func newUserResponse(user *domain.User, hasAccess bool) UserResponse {
+	return UserResponse{
+		CoinsBalance:        user.CoinsBalance,
+		CreatedAt:           user.CreatedAt,
+		DeletedAt:           user.DeletedAt,
+		Email:               user.Email,
+		EmailVerified:       user.EmailVerified,
+		HasAccess:           hasAccess,
+		HasSubscription:     user.HasSubscription,
+		ID:                  user.ID,
+		IsTrial:             user.IsTrial,
+		Name:                user.Name,
+		Status:              user.Status,
+		SubscriptionEndsAt:  user.SubscriptionEndsAt,
+		TotalCoinsPurchased: user.TotalCoinsPurchased,
+		TrialEndsAt:         user.TrialEndsAt,
+		UpdatedAt:           user.UpdatedAt,
+	}
+}
+
+// AddCoinsResponse reports a credit. Balance and User predate CoinsBalance
+// and are kept for existing clients.
+type AddCoinsResponse struct {
+	Balance      int64        `json:"balance"`
+	CoinsAdded   int64        `json:"coins_added"`
+	CoinsBalance int64        `json:"coins_balance"`
+	User         *domain.User `json:"user"`
+}
+
+// DeductCoinsResponse reports a debit. Balance and User predate
+// CoinsBalance and are kept for existing clients.
+type DeductCoinsResponse struct {
+	Balance       int64        `json:"balance"`
+	CoinsBalance  int64        `json:"coins_balance"`
+	CoinsDeducted int64        `json:"coins_deducted"`
+	User          *domain.User `json:"user"`
+}
+
+// TransferCoinsResponse reports a transfer with the sender's new balance.
+type TransferCoinsResponse struct {
+	CoinsBalance     int64  `json:"coins_balance"`
+	CoinsTransferred int64  `json:"coins_transferred"`
+	ToUserID         string `json:"to_user_id"`
+}
+
+// UserOrdersResponse is a page of a user's orders.
+type UserOrdersResponse struct {
+	Orders []domain.Order `json:"orders"`
+	Total  int64          `json:"total"`
+}
+
+// LineItemErrorResponse names the checkout line item that failed.
+type LineItemErrorResponse struct {
+	Error     string `json:"error"`
+	LineItem  int    `json:"line_item"`
+	ProductID string `json:"product_id"`
+}
+
+// QuoteErrorResponse is a purchase check that failed for a reason other
+// than price, with the quote so clients can still show the shortfall.
+type QuoteErrorResponse struct {
+	Affordable bool   `json:"affordable"`
+	Balance    int64  `json:"balance"`
+	Error      string `json:"error"`
+	PriceCoins int64  `json:"price_coins"`
+	Shortfall  int64  `json:"shortfall"`
+}
+
+// ShortfallResponse is how many more coins a user needs for a product.
+type ShortfallResponse struct {
+	Balance    int64 `json:"balance"`
+	Needed     int64 `json:"needed"`
+	PriceCoins int64 `json:"price_coins"`
+}
+
+// PreconditionFailedResponse carries the current updated_at of a resource
+// a conditional update found modified.
+type PreconditionFailedResponse struct {
+	Error     string    `json:"error"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ImportProductsResponse reports each row of a product import.
+type ImportProductsResponse struct {
+	Created int                          `json:"created"`
+	Failed  int                          `json:"failed"`
+	Results []domain.ProductImportResult `json:"results"`
+}
+
+// UpdatePricesResponse counts the products whose price changed.
+type UpdatePricesResponse struct {
+	Updated int64 `json:"updated"`
+}
+
+// CompactPositionsResponse counts the categories whose position changed.
+type CompactPositionsResponse struct {
+	Updated int64 `json:"updated"`
+}
+
+// UserFlagsResponse holds whether each feature flag is on for a user.
+type UserFlagsResponse struct {
+	Flags map[string]bool `json:"flags"`
+}
+
+// SystemInfoResponse identifies the replica that answered.
+type SystemInfoResponse struct {
+	Hostname string `json:"hostname"`
+	Leader   bool   `json:"leader"`
+}
+
+// ReloadConfigResponse lists the settings a reload could not apply.
+type ReloadConfigResponse struct {
+	Reloaded        bool     `json:"reloaded"`
+	RequiresRestart []string `json:"requires_restart"`
+}
+
+// JobsResponse lists the background jobs.
+type JobsResponse struct {
+	Jobs []jobs.State `json:"jobs"`
+}
@@ -0,0 +1,245 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/jobs"
+	"user-service/internal/jsonenc"
+)
+
+var testTime = time.Date(2026, 3, 14, 15, 9, 26, 535000000, time.UTC)
+
+func testUser(i int) *domain.User {
+	trialEndsAt := testTime.Add(72 * time.Hour)
+	return &domain.User{
+		ID:                  fmt.Sprintf("0190c2a8-7f1e-7a3b-9c4d-%012d", i),
+		Email:               fmt.Sprintf("user%d@example.com", i),
+		Name:                fmt.Sprintf("User <%d> & Ünïcode 🎉", i),
+		CoinsBalance:        int64(i * 10),
+		TotalCoinsPurchased: int64(i * 20),
+		IsTrial:             i%2 == 0,
+		TrialEndsAt:         &trialEndsAt,
+		Status:              domain.StatusActive,
+		EmailVerified:       i%3 == 0,
+		CreatedAt:           testTime,
+		UpdatedAt:           testTime.Add(time.Duration(i) * time.Second),
+	}
+}
+
+func testProduct(i int) domain.Product {
+	stock := int64(i)
+	p := domain.Product{
+		ID:          fmt.Sprintf("0190c2a8-7f1e-7a3b-8c4d-%012d", i),
+		CategoryID:  "0190c2a8-7f1e-7a3b-8c4d-000000000000",
+		Slug:        fmt.Sprintf("product-%d", i),
+		Name:        fmt.Sprintf("Product %d", i),
+		Description: "A \"quoted\" description with <html> and a tab\t.",
+		PriceCoins:  int64(100 + i),
+		Metadata:    fmt.Sprintf(`{"color":"red","sizes":[1,2,3],"rank":%d,"tags":{"new":true}}`, i),
+		IsActive:    true,
+		ViewCount:   int64(i * 7),
+		CreatedAt:   testTime,
+		UpdatedAt:   testTime,
+	}
+	if i%2 == 0 {
+		p.Stock = &stock
+	}
+	return p
+}
+
+func userPage(n int) Page[domain.User] {
+	page := Page[domain.User]{Limit: n, Total: int64(n * 3)}
+	for i := 0; i < n; i++ {
+		page.Items = append(page.Items, *testUser(i))
+	}
+	return page
+}
+
+func productPage(n int) Page[domain.Product] {
+	page := Page[domain.Product]{Limit: n, Offset: n, Total: int64(n * 3)}
+	for i := 0; i < n; i++ {
+		page.Items = append(page.Items, testProduct(i))
+	}
+	return page
+}
+
+func encode(t testing.TB, enc jsonenc.Encoder, v interface{}, indent string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, v, indent); err != nil {
+		t.Fatalf("encode %T: %v", v, err)
+	}
+	return buf.Bytes()
+}
+
+// TestResponsesMatchMapEncoding checks the response types write the bytes
+// the maps they replaced did.
+func TestResponsesMatchMapEncoding(t *testing.T) {
+	user := testUser(1)
+	deleted := testUser(2)
+	deleted.DeletedAt = &testTime
+	products := productPage(2)
+	stats := []domain.ProductStats{{ProductID: products.Items[0].ID}}
+	states := []jobs.State{{Name: "expiry_sweep"}}
+
+	tests := []struct {
+		name string
+		dto  interface{}
+		old  interface{}
+	}{
+		{"page", products, map[string]interface{}{
+			"items": products.Items, "total": products.Total, "limit": products.Limit, "offset": products.Offset,
+		}},
+		{"empty page", Page[domain.User]{Limit: 10}, map[string]interface{}{
+			"items": []domain.User(nil), "total": int64(0), "limit": 10, "offset": 0,
+		}},
+		{"list", List[domain.ProductCategory]{Items: []domain.ProductCategory{{ID: "c1", Slug: "books"}}, Total: 1}, map[string]interface{}{
+			"items": []domain.ProductCategory{{ID: "c1", Slug: "books"}}, "total": 1,
+		}},
+		{"stats page", StatsPage{From: "2026-03-01", Items: stats, Limit: 10, To: "2026-03-14", Total: 1}, map[string]interface{}{
+			"items": stats, "total": int64(1), "limit": 10, "offset": 0, "from": "2026-03-01", "to": "2026-03-14",
+		}},
+		{"user", newUserResponse(user, true), map[string]interface{}{
+			"id": user.ID, "email": user.Email, "name": user.Name, "coins_balance": user.CoinsBalance,
+			"total_coins_purchased": user.TotalCoinsPurchased, "is_trial": user.IsTrial, "trial_ends_at": user.TrialEndsAt,
+			"has_subscription": user.HasSubscription, "subscription_ends_at": user.SubscriptionEndsAt, "status": user.Status,
+			"email_verified": user.EmailVerified, "created_at": user.CreatedAt, "updated_at": user.UpdatedAt, "has_access": true,
+		}},
+		{"deleted user", newUserResponse(deleted, false), map[string]interface{}{
+			"id": deleted.ID, "email": deleted.Email, "name": deleted.Name, "coins_balance": deleted.CoinsBalance,
+			"total_coins_purchased": deleted.TotalCoinsPurchased, "is_trial": deleted.IsTrial, "trial_ends_at": deleted.TrialEndsAt,
+			"has_subscription": deleted.HasSubscription, "subscription_ends_at": deleted.SubscriptionEndsAt, "status": deleted.Status,
+			"email_verified": deleted.EmailVerified, "created_at": deleted.CreatedAt, "updated_at": deleted.UpdatedAt, "has_access": false,
+			"deleted_at": deleted.DeletedAt,
+		}},
+		{"add coins", AddCoinsResponse{Balance: 10, CoinsAdded: 5, CoinsBalance: 10, User: user}, map[string]interface{}{
+			"coins_balance": int64(10), "coins_added": int64(5), "balance": int64(10), "user": user,
+		}},
+		{"deduct coins", DeductCoinsResponse{Balance: 10, CoinsBalance: 10, CoinsDeducted: 5, User: user}, map[string]interface{}{
+			"coins_balance": int64(10), "coins_deducted": int64(5), "balance": int64(10), "user": user,
+		}},
+		{"transfer coins", TransferCoinsResponse{CoinsBalance: 10, CoinsTransferred: 5, ToUserID: "u2"}, map[string]interface{}{
+			"coins_balance": int64(10), "coins_transferred": int64(5), "to_user_id": "u2",
+		}},
+		{"user orders", UserOrdersResponse{Orders: []domain.Order{{ID: "o1"}}, Total: 1}, map[string]interface{}{
+			"orders": []domain.Order{{ID: "o1"}}, "total": int64(1),
+		}},
+		{"line item error", LineItemErrorResponse{Error: "out of stock", LineItem: 2, ProductID: "p1"}, map[string]interface{}{
+			"error": "out of stock", "line_item": 2, "product_id": "p1",
+		}},
+		{"quote error", QuoteErrorResponse{Balance: 5, Error: "product is inactive", PriceCoins: 8, Shortfall: 3}, map[string]interface{}{
+			"error": "product is inactive", "affordable": false, "price_coins": int64(8), "balance": int64(5), "shortfall": int64(3),
+		}},
+		{"shortfall", ShortfallResponse{Balance: 5, Needed: 3, PriceCoins: 8}, map[string]int64{
+			"needed": 3, "price_coins": 8, "balance": 5,
+		}},
+		{"precondition failed", PreconditionFailedResponse{Error: "modified", UpdatedAt: testTime}, map[string]interface{}{
+			"error": "modified", "updated_at": testTime,
+		}},
+		{"import products", ImportProductsResponse{Created: 1, Failed: 1, Results: []domain.ProductImportResult{{Index: 0, Slug: "a"}, {Index: 1, Error: "bad"}}}, map[string]interface{}{
+			"created": 1, "failed": 1, "results": []domain.ProductImportResult{{Index: 0, Slug: "a"}, {Index: 1, Error: "bad"}},
+		}},
+		{"update prices", UpdatePricesResponse{Updated: 4}, map[string]int64{"updated": 4}},
+		{"compact positions", CompactPositionsResponse{Updated: 3}, map[string]interface{}{"updated": int64(3)}},
+		{"user flags", UserFlagsResponse{Flags: map[string]bool{"b": true, "a": false}}, map[string]interface{}{
+			"flags": map[string]bool{"b": true, "a": false},
+		}},
+		{"system info", SystemInfoResponse{Hostname: "replica-1", Leader: true}, map[string]interface{}{
+			"hostname": "replica-1", "leader": true,
+		}},
+		{"reload config", ReloadConfigResponse{Reloaded: true, RequiresRestart: []string{}}, map[string]interface{}{
+			"reloaded": true, "requires_restart": []string{},
+		}},
+		{"jobs", JobsResponse{Jobs: states}, map[string]interface{}{"jobs": states}},
+		{"healthy", HealthResponse{Status: "healthy"}, map[string]string{"status": "healthy"}},
+		{"healthy with breaker", HealthResponse{CircuitBreaker: "closed", Status: "healthy"}, map[string]string{
+			"status": "healthy", "circuit_breaker": "closed",
+		}},
+		{"breaker open", HealthResponse{CircuitBreaker: "open", Error: "database error rate too high", Status: "unhealthy"}, map[string]string{
+			"status": "unhealthy", "error": "database error rate too high", "circuit_breaker": "open",
+		}},
+		{"message", MessageResponse{Message: "email verified successfully"}, map[string]string{
+			"message": "email verified successfully",
+		}},
+	}
+
+	std, _ := jsonenc.Lookup(jsonenc.Std)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, want := encode(t, std, tt.dto, ""), encode(t, std, tt.old, "")
+			if !bytes.Equal(got, want) {
+				t.Errorf("got  %s\nwant %s", got, want)
+			}
+		})
+	}
+}
+
+// TestEncodersMatchStd checks every encoder compiled in writes the bytes
+// the standard library does. Build with -tags gojson to cover go-json.
+func TestEncodersMatchStd(t *testing.T) {
+	payloads := map[string]interface{}{
+		"users":        userPage(100),
+		"products":     productPage(100),
+		"empty page":   Page[domain.Product]{},
+		"user":         newUserResponse(testUser(7), true),
+		"add coins":    AddCoinsResponse{Balance: 10, CoinsAdded: 5, CoinsBalance: 10, User: testUser(3)},
+		"quote error":  QuoteErrorResponse{Error: "out of stock", PriceCoins: 8},
+		"flags":        UserFlagsResponse{Flags: map[string]bool{"z": true, "a": false, "m": true}},
+		"import":       ImportProductsResponse{Results: []domain.ProductImportResult{{Index: 0, Error: "slug taken"}}},
+		"error":        map[string]string{"error": "user not found"},
+		"precondition": PreconditionFailedResponse{Error: "modified", UpdatedAt: testTime},
+	}
+
+	std, _ := jsonenc.Lookup(jsonenc.Std)
+	for _, name := range jsonenc.Available() {
+		enc, err := jsonenc.Lookup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for payload, v := range payloads {
+			for _, indent := range []string{"", "  "} {
+				got, want := encode(t, enc, v, indent), encode(t, std, v, indent)
+				if !bytes.Equal(got, want) {
+					t.Errorf("%s, %s, indent %q: got\n%s\nwant\n%s", name, payload, indent, got, want)
+				}
+			}
+			got, err := enc.Marshal(v)
+			if err != nil {
+				t.Fatalf("%s: marshal %s: %v", name, payload, err)
+			}
+			want, _ := json.Marshal(v)
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s, %s: Marshal got\n%s\nwant\n%s", name, payload, got, want)
+			}
+		}
+	}
+}
+
+func benchmarkEncoders(b *testing.B, v interface{}) {
+	for _, name := range jsonenc.Available() {
+		enc, _ := jsonenc.Lookup(name)
+		b.Run(name, func(b *testing.B) {
+			var buf bytes.Buffer
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buf.Reset()
+				if err := enc.Encode(&buf, v, ""); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.SetBytes(int64(buf.Len()))
+		})
+	}
+}
+
+func BenchmarkEncodeUserPage100(b *testing.B) {
+	benchmarkEncoders(b, userPage(100))
+}
+
+func BenchmarkEncodeProductPage100(b *testing.B) {
+	benchmarkEncoders(b, productPage(100))
+}
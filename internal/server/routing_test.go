@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+func TestTrailingSlashRouting(t *testing.T) {
+	const adminToken = "admin-secret"
+	acl, err := ParseRouteACL(map[string]string{"POST /api/users/:id/coins": "finance"})
+	if err != nil {
+		t.Fatalf("ParseRouteACL: %v", err)
+	}
+	principals := StaticTokenPrincipals(map[string]string{"finance": "finance-token"}, adminToken)
+
+	// Wired up as in main
+	e := echo.New()
+	e.Pre(middleware.RemoveTrailingSlash())
+	e.Use(RequireRouteRoles(acl, principals))
+	route := func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Path()+" "+c.Param("id"))
+	}
+	e.GET("/health", route)
+	api := e.Group("/api")
+	api.Use(JSONContentType())
+	api.GET("/users", route)
+	api.GET("/users/:id", route)
+	api.POST("/users/:id/coins", route)
+	api.Group("/admin", RequireAdminToken(adminToken)).GET("/products", route)
+
+	const id = "0190c2a8-7f1e-7a3b-9c4d-000000000001"
+	tests := []struct {
+		method, path string
+		header, body string
+		wantStatus   int
+		wantRoute    string
+	}{
+		{http.MethodGet, "/health", "", "", http.StatusOK, "/health "},
+		{http.MethodGet, "/health/", "", "", http.StatusOK, "/health "},
+		{http.MethodGet, "/api/users", "", "", http.StatusOK, "/api/users "},
+		{http.MethodGet, "/api/users/", "", "", http.StatusOK, "/api/users "},
+		{http.MethodGet, "/api/users/" + id, "", "", http.StatusOK, "/api/users/:id " + id},
+		{http.MethodGet, "/api/users/" + id + "/", "", "", http.StatusOK, "/api/users/:id " + id},
+		{http.MethodGet, "/api/users/?limit=5", "", "", http.StatusOK, "/api/users "},
+		// Group middleware and route ACLs see the canonical path
+		{http.MethodGet, "/api/admin/products/", "", "", http.StatusForbidden, ""},
+		{http.MethodGet, "/api/admin/products/", AdminTokenHeader + ":" + adminToken, "", http.StatusOK, "/api/admin/products "},
+		{http.MethodPost, "/api/users/" + id + "/coins/", "", `{}`, http.StatusForbidden, ""},
+		{http.MethodPost, "/api/users/" + id + "/coins/", RoleTokenHeader + ":Bearer finance-token", `{}`, http.StatusOK, "/api/users/:id/coins " + id},
+		{http.MethodPost, "/api/users/" + id + "/coins/", RoleTokenHeader + ":Bearer finance-token", "coins=5", http.StatusUnsupportedMediaType, ""},
+		// Paths stay case-sensitive
+		{http.MethodGet, "/API/users", "", "", http.StatusNotFound, ""},
+		{http.MethodGet, "/api/Users/", "", "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		var req *http.Request
+		if tt.body != "" {
+			req = httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if strings.HasPrefix(tt.body, "{") {
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			} else {
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+			}
+		} else {
+			req = httptest.NewRequest(tt.method, tt.path, nil)
+		}
+		if name, value, ok := strings.Cut(tt.header, ":"); ok {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s %s: got %d, want %d: %s", tt.method, tt.path, rec.Code, tt.wantStatus, rec.Body)
+			continue
+		}
+		if tt.wantRoute != "" && rec.Body.String() != tt.wantRoute {
+			t.Errorf("%s %s: reached %q, want %q", tt.method, tt.path, rec.Body, tt.wantRoute)
+		}
+	}
+}
@@ -2,12 +2,14 @@ package server
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
+	"user-service/internal/breaker"
 	"user-service/internal/domain"
 
 	log "github.com/sirupsen/logrus"
@@ -18,30 +20,105 @@ import (
 // UserService defines the interface for user business logic
 type UserService interface {
 	CreateUser(ctx context.Context, req domain.CreateUserRequest) (*domain.User, error)
-	GetUser(ctx context.Context, id string) (*domain.User, error)
+	GetUser(ctx context.Context, id string, includeDeleted bool) (*domain.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*domain.User, error)
 	UpdateUser(ctx context.Context, id string, req domain.UpdateUserRequest) (*domain.User, error)
 	DeleteUser(ctx context.Context, id string) error
-	ListUsers(ctx context.Context, limit, offset int) ([]domain.User, error)
-	AddCoins(ctx context.Context, userID string, coins int64) error
-	DeductCoins(ctx context.Context, userID string, coins int64) error
-	ActivateSubscription(ctx context.Context, userID string, duration time.Duration) error
-	RenewSubscription(ctx context.Context, userID string, duration time.Duration) error
+	HardDeleteUser(ctx context.Context, id string) error
+	RestoreUser(ctx context.Context, id string) (*domain.User, error)
+	RequestDeletion(ctx context.Context, id string) (*domain.User, error)
+	CancelDeletion(ctx context.Context, id string) (*domain.User, error)
+	ListUsers(ctx context.Context, filter domain.UserListFilter, limit, offset int) (domain.Page[domain.User], error)
+	ListCoinTransactions(ctx context.Context, userID string, limit, offset int) (domain.Page[domain.CoinTransaction], error)
+	VerifyCoinTransactions(ctx context.Context, userID string, limit, offset int) ([]domain.CoinLedgerDiscrepancy, error)
+	ListAdminActions(ctx context.Context, userID string, limit, offset int) (domain.Page[domain.AdminAction], error)
+	AddCoins(ctx context.Context, userID string, coins int64, reason, idempotencyKey string) (*domain.User, bool, error)
+	DeductCoins(ctx context.Context, userID string, coins int64, reason, idempotencyKey string) (*domain.User, bool, error)
+	TransferCoins(ctx context.Context, fromID, toID string, coins int64) (*domain.User, error)
+	ActivateSubscription(ctx context.Context, userID string, duration time.Duration, idempotencyKey string) (*domain.User, bool, error)
+	ProvisionUser(ctx context.Context, req domain.CreateUserRequest, duration time.Duration) (*domain.User, error)
+	RenewSubscription(ctx context.Context, userID string, duration time.Duration, idempotencyKey string) (*domain.User, bool, error)
 	HasAccessByUser(user *domain.User) bool
+	ExplainAccess(user *domain.User) domain.AccessDecision
+	Capabilities(user *domain.User) domain.Capabilities
+	GetSubscriptionStatus(ctx context.Context, userID string) (*domain.SubscriptionStatus, error)
+	SendEmailVerification(ctx context.Context, userID string) error
+	ConfirmEmailVerification(ctx context.Context, userID, token string) error
 }
 
 type server struct {
 	userService UserService
-	db          *sql.DB
+	health      *HealthConn
+	breaker     *breaker.Breaker
+	adminToken  string
+	emailLookup *EmailLookupGuard
 }
 
-func NewServer(userService UserService, db *sql.DB) *server {
+// NewServer creates the user server. dbBreaker may be nil when the DB circuit
+// breaker is disabled. adminToken unlocks admin-only options on user routes.
+func NewServer(userService UserService, health *HealthConn, dbBreaker *breaker.Breaker, adminToken string) *server {
 	return &server{
 		userService: userService,
-		db:          db,
+		health:      health,
+		breaker:     dbBreaker,
+		adminToken:  adminToken,
+		emailLookup: NewEmailLookupGuard(EmailLookupConfig{}, nil),
 	}
 }
 
+// SetEmailLookupGuard replaces the default guard, which gives every caller
+// exact answers, on email lookups. It is meant to be called once at startup,
+// before serving requests.
+func (s *server) SetEmailLookupGuard(guard *EmailLookupGuard) {
+	s.emailLookup = guard
+}
+
+// signupBonusOption reads the admin-only grant_signup_bonus query parameter
+// into req. It returns a non-empty message and status when the request must
+// be rejected.
+func (s *server) signupBonusOption(c echo.Context, req *domain.CreateUserRequest) (int, string) {
+	raw := c.QueryParam("grant_signup_bonus")
+	if raw == "" {
+		return 0, ""
+	}
+	grant, err := strconv.ParseBool(raw)
+	if err != nil {
+		return http.StatusBadRequest, "grant_signup_bonus must be true or false"
+	}
+	if !grant && !isAdmin(c, s.adminToken) {
+		return http.StatusForbidden, "admin access required to skip the signup bonus"
+	}
+	req.SkipSignupBonus = !grant
+	return 0, ""
+}
+
+// adminFlag reads an optional boolean query parameter that only the admin
+// may set to true. It returns a non-empty message and status when the request
+// must be rejected.
+func (s *server) adminFlag(c echo.Context, name string) (bool, int, string) {
+	raw := c.QueryParam(name)
+	if raw == "" {
+		return false, 0, ""
+	}
+	set, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, http.StatusBadRequest, name + " must be true or false"
+	}
+	if set && !isAdmin(c, s.adminToken) {
+		return false, http.StatusForbidden, "admin access required for " + name
+	}
+	return set, 0, ""
+}
+
+// bindErrorMessage keeps validation errors raised while decoding the body,
+// such as an unknown status, distinguishable from malformed JSON.
+func bindErrorMessage(err error) string {
+	if errors.Is(err, domain.ErrInvalidStatus) {
+		return "invalid status"
+	}
+	return "invalid request body"
+}
+
 // handleError processes domain errors and returns appropriate HTTP response
 func handleError(err error) (int, string) {
 	switch {
@@ -63,6 +140,10 @@ func handleError(err error) (int, string) {
 		return http.StatusBadRequest, "coins must be greater than 0"
 	case errors.Is(err, domain.ErrInsufficientCoinsBalance):
 		return http.StatusBadRequest, "insufficient coins balance"
+	case errors.Is(err, domain.ErrInvalidIdempotencyKey), errors.Is(err, domain.ErrInvalidCoinReason), errors.Is(err, domain.ErrReservedCoinReason):
+		return http.StatusBadRequest, err.Error()
+	case errors.Is(err, domain.ErrIdempotencyKeyReused):
+		return http.StatusUnprocessableEntity, err.Error()
 	case errors.Is(err, domain.ErrInvalidSubscriptionDuration):
 		return http.StatusBadRequest, "subscription duration must be greater than 0"
 	case errors.Is(err, domain.ErrSubscriptionAlreadyActive):
@@ -73,6 +154,8 @@ func handleError(err error) (int, string) {
 		return http.StatusBadRequest, "email is too long"
 	case errors.Is(err, domain.ErrNameTooLong):
 		return http.StatusBadRequest, "name is too long"
+	case errors.Is(err, domain.ErrInvalidName):
+		return http.StatusBadRequest, "name is too short or has no letters or digits"
 	case errors.Is(err, domain.ErrInvalidUUID):
 		return http.StatusBadRequest, "invalid user ID format"
 	case errors.Is(err, domain.ErrCoinsAmountTooLarge):
@@ -81,24 +164,55 @@ func handleError(err error) (int, string) {
 		return http.StatusBadRequest, "list limit is too large"
 	case errors.Is(err, domain.ErrListOffsetTooLarge):
 		return http.StatusBadRequest, "list offset is too large"
+	case errors.Is(err, domain.ErrInvalidCoinsRange):
+		return http.StatusBadRequest, "min_coins must not be greater than max_coins"
 	case errors.Is(err, domain.ErrSubscriptionDurationTooLong):
 		return http.StatusBadRequest, "subscription duration is too long"
+	case errors.Is(err, domain.ErrInvalidVerificationToken):
+		return http.StatusBadRequest, "invalid or expired verification token"
+	case errors.Is(err, domain.ErrEmailAlreadyVerified):
+		return http.StatusConflict, "email is already verified"
+	case errors.Is(err, domain.ErrDeletionAlreadyRequested):
+		return http.StatusConflict, "account deletion is already requested"
+	case errors.Is(err, domain.ErrNoDeletionRequest):
+		return http.StatusNotFound, "no account deletion is pending"
+	case errors.Is(err, domain.ErrDeletionGraceExpired):
+		return http.StatusConflict, "the account deletion grace period has ended"
+	case errors.Is(err, domain.ErrUserDeleted):
+		return http.StatusConflict, "user is deleted"
+	case errors.Is(err, domain.ErrUserNotDeleted):
+		return http.StatusConflict, "user is not deleted"
+	case errors.Is(err, domain.ErrUserErased):
+		return http.StatusConflict, "user is erased and cannot be restored"
+	case errors.Is(err, domain.ErrUserNotActive):
+		return http.StatusConflict, "user is not active"
+	case errors.Is(err, domain.ErrCannotTransferToSelf):
+		return http.StatusBadRequest, "cannot transfer coins to the same user"
 	default:
 		return http.StatusInternalServerError, "internal server error"
 	}
 }
 
 func (s *server) HealthCheck(c echo.Context) error {
-	if err := s.db.Ping(); err != nil {
+	if err := s.health.Ping(c.Request().Context()); err != nil {
 		log.WithField("error", err).Error("Health check failed: database is down")
-		return c.JSON(http.StatusServiceUnavailable, map[string]string{
-			"status": "unhealthy",
-			"error":  "database connection error",
+		return c.JSON(http.StatusServiceUnavailable, HealthResponse{
+			Error:  "database connection error",
+			Status: "unhealthy",
 		})
 	}
-	return c.JSON(http.StatusOK, map[string]string{
-		"status": "healthy",
-	})
+	if s.breaker != nil && s.breaker.State() == breaker.StateOpen {
+		return c.JSON(http.StatusServiceUnavailable, HealthResponse{
+			CircuitBreaker: breaker.StateOpen.String(),
+			Error:          "database error rate too high",
+			Status:         "unhealthy",
+		})
+	}
+	response := HealthResponse{Status: "healthy"}
+	if s.breaker != nil {
+		response.CircuitBreaker = s.breaker.State().String()
+	}
+	return c.JSON(http.StatusOK, response)
 }
 
 func (s *server) CreateUser(c echo.Context) error {
@@ -108,6 +222,11 @@ func (s *server) CreateUser(c echo.Context) error {
 			"error": "invalid request body",
 		})
 	}
+	if statusCode, errorMsg := s.signupBonusOption(c, &req); errorMsg != "" {
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
 
 	ctx := c.Request().Context()
 	user, err := s.userService.CreateUser(ctx, req)
@@ -119,6 +238,7 @@ func (s *server) CreateUser(c echo.Context) error {
 		})
 	}
 
+	c.Response().Header().Set(echo.HeaderLocation, "/api/users/"+user.ID)
 	return c.JSON(http.StatusCreated, user)
 }
 
@@ -130,8 +250,15 @@ func (s *server) GetUser(c echo.Context) error {
 		})
 	}
 
+	includeDeleted, status, msg := s.adminFlag(c, "include_deleted")
+	if msg != "" {
+		return c.JSON(status, map[string]string{
+			"error": msg,
+		})
+	}
+
 	ctx := c.Request().Context()
-	user, err := s.userService.GetUser(ctx, id)
+	user, err := s.userService.GetUser(ctx, id, includeDeleted)
 	if err != nil {
 		log.WithError(err).WithField("user_id", id).Error("Failed to get user")
 		statusCode, errorMsg := handleError(err)
@@ -142,26 +269,28 @@ func (s *server) GetUser(c echo.Context) error {
 
 	hasAccess := s.userService.HasAccessByUser(user)
 
-	response := map[string]interface{}{
-		"id":                    user.ID,
-		"email":                 user.Email,
-		"name":                  user.Name,
-		"coins_balance":         user.CoinsBalance,
-		"total_coins_purchased": user.TotalCoinsPurchased,
-		"is_trial":              user.IsTrial,
-		"trial_ends_at":         user.TrialEndsAt,
-		"has_subscription":      user.HasSubscription,
-		"subscription_ends_at":  user.SubscriptionEndsAt,
-		"status":                user.Status,
-		"created_at":            user.CreatedAt,
-		"updated_at":            user.UpdatedAt,
-		"has_access":            hasAccess,
-	}
-
-	return c.JSON(http.StatusOK, response)
+	return c.JSON(http.StatusOK, newUserResponse(user, hasAccess))
 }
 
+// GetUserByEmail answers protected callers (see EmailLookupConfig) at a
+// uniform pace and with one 404 for every client-side failure, so the
+// response doesn't reveal whether the email has an account.
 func (s *server) GetUserByEmail(c echo.Context) error {
+	start := time.Now()
+	limitKey, metricKey, exempt := s.emailLookup.caller(c)
+	if !exempt && s.emailLookup.limiter != nil {
+		if ok, retryAfter := s.emailLookup.limiter.allow(limitKey, start); !ok {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+			return c.JSON(http.StatusTooManyRequests, map[string]string{
+				"error": "too many email lookups",
+			})
+		}
+	}
+
 	email := c.Param("email")
 	if email == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{
@@ -171,9 +300,18 @@ func (s *server) GetUserByEmail(c echo.Context) error {
 
 	ctx := c.Request().Context()
 	user, err := s.userService.GetUserByEmail(ctx, email)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		s.emailLookup.countMiss(metricKey)
+	}
+	if !exempt {
+		s.emailLookup.pad(ctx, start)
+	}
 	if err != nil {
-		log.WithError(err).WithField("email", email).Error("Failed to get user by email")
+		log.WithError(err).Error("Failed to get user by email")
 		statusCode, errorMsg := handleError(err)
+		if !exempt && statusCode < http.StatusInternalServerError {
+			statusCode, errorMsg = http.StatusNotFound, "user not found"
+		}
 		return c.JSON(statusCode, map[string]string{
 			"error": errorMsg,
 		})
@@ -181,23 +319,7 @@ func (s *server) GetUserByEmail(c echo.Context) error {
 
 	hasAccess := s.userService.HasAccessByUser(user)
 
-	response := map[string]interface{}{
-		"id":                    user.ID,
-		"email":                 user.Email,
-		"name":                  user.Name,
-		"coins_balance":         user.CoinsBalance,
-		"total_coins_purchased": user.TotalCoinsPurchased,
-		"is_trial":              user.IsTrial,
-		"trial_ends_at":         user.TrialEndsAt,
-		"has_subscription":      user.HasSubscription,
-		"subscription_ends_at":  user.SubscriptionEndsAt,
-		"status":                user.Status,
-		"created_at":            user.CreatedAt,
-		"updated_at":            user.UpdatedAt,
-		"has_access":            hasAccess,
-	}
-
-	return c.JSON(http.StatusOK, response)
+	return c.JSON(http.StatusOK, newUserResponse(user, hasAccess))
 }
 
 func (s *server) UpdateUser(c echo.Context) error {
@@ -211,7 +333,7 @@ func (s *server) UpdateUser(c echo.Context) error {
 	var req domain.UpdateUserRequest
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "invalid request body",
+			"error": bindErrorMessage(err),
 		})
 	}
 
@@ -236,8 +358,19 @@ func (s *server) DeleteUser(c echo.Context) error {
 		})
 	}
 
+	hard, status, msg := s.adminFlag(c, "hard")
+	if msg != "" {
+		return c.JSON(status, map[string]string{
+			"error": msg,
+		})
+	}
+
 	ctx := c.Request().Context()
-	if err := s.userService.DeleteUser(ctx, id); err != nil {
+	deleteUser := s.userService.DeleteUser
+	if hard {
+		deleteUser = s.userService.HardDeleteUser
+	}
+	if err := deleteUser(ctx, id); err != nil {
 		log.WithError(err).WithField("user_id", id).Error("Failed to delete user")
 		statusCode, errorMsg := handleError(err)
 		return c.JSON(statusCode, map[string]string{
@@ -245,29 +378,158 @@ func (s *server) DeleteUser(c echo.Context) error {
 		})
 	}
 
-	return c.JSON(http.StatusNoContent, nil)
+	return c.NoContent(http.StatusNoContent)
 }
 
-func (s *server) ListUsers(c echo.Context) error {
-	limitStr := c.QueryParam("limit")
-	offsetStr := c.QueryParam("offset")
+// RestoreUser undoes a soft delete and returns the restored user.
+func (s *server) RestoreUser(c echo.Context) error {
+	id := c.Param("id")
+
+	user, err := s.userService.RestoreUser(c.Request().Context(), id)
+	if err != nil {
+		log.WithError(err).WithField("user_id", id).Error("Failed to restore user")
+		statusCode, errorMsg := handleError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
+
+// RequestDeletion schedules the account for erasure after the grace period.
+// The response carries deletion_pending and scheduled_for.
+func (s *server) RequestDeletion(c echo.Context) error {
+	id := c.Param("id")
 
-	limit := 10
-	offset := 0
+	user, err := s.userService.RequestDeletion(c.Request().Context(), id)
+	if err != nil {
+		statusCode, errorMsg := handleError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
 
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-			limit = l
+	return c.JSON(http.StatusAccepted, user)
+}
+
+// CancelDeletion withdraws a pending deletion request within the grace period.
+func (s *server) CancelDeletion(c echo.Context) error {
+	id := c.Param("id")
+
+	user, err := s.userService.CancelDeletion(c.Request().Context(), id)
+	if err != nil {
+		statusCode, errorMsg := handleError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
+
+// coinsQueryParam parses an optional non-negative coin amount query parameter.
+func coinsQueryParam(c echo.Context, name string) (*int64, error) {
+	raw := c.QueryParam(name)
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if v < 0 {
+		return nil, domain.ErrInvalidCoinsAmount
+	}
+	return &v, nil
+}
+
+// boolQueryParam parses an optional boolean query parameter; nil means absent.
+func boolQueryParam(c echo.Context, name string) (*bool, error) {
+	raw := c.QueryParam(name)
+	if raw == "" {
+		return nil, nil
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// statusesQueryParam splits an optional comma-separated list of statuses,
+// such as status=active,suspended. The statuses are validated by the service.
+func statusesQueryParam(c echo.Context, name string) []domain.UserStatus {
+	raw := c.QueryParam(name)
+	if raw == "" {
+		return nil
+	}
+	var statuses []domain.UserStatus
+	for _, part := range strings.Split(raw, ",") {
+		statuses = append(statuses, domain.UserStatus(strings.TrimSpace(part)))
+	}
+	return statuses
+}
+
+// paginationParams parses the optional limit and offset query parameters.
+// Absent ones default to defaultLimit and 0; a present limit that isn't a
+// positive integer, or offset that isn't a non-negative one, is an error
+// rather than silently falling back to the default.
+func paginationParams(c echo.Context, defaultLimit int) (limit, offset int, err error) {
+	limit = defaultLimit
+	if raw := c.QueryParam("limit"); raw != "" {
+		if limit, err = strconv.Atoi(raw); err != nil || limit <= 0 {
+			return 0, 0, errors.New("invalid limit: must be a positive integer")
 		}
 	}
-	if offsetStr != "" {
-		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
-			offset = o
+	if raw := c.QueryParam("offset"); raw != "" {
+		if offset, err = strconv.Atoi(raw); err != nil || offset < 0 {
+			return 0, 0, errors.New("invalid offset: must be a non-negative integer")
 		}
 	}
+	return limit, offset, nil
+}
+
+func (s *server) ListUsers(c echo.Context) error {
+	limit, offset, err := paginationParams(c, 10)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	var filter domain.UserListFilter
+	if filter.MinCoins, err = coinsQueryParam(c, "min_coins"); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid min_coins",
+		})
+	}
+	if filter.MaxCoins, err = coinsQueryParam(c, "max_coins"); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid max_coins",
+		})
+	}
+	filter.Statuses = statusesQueryParam(c, "status")
+	if filter.HasSubscription, err = boolQueryParam(c, "has_subscription"); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "has_subscription must be true or false",
+		})
+	}
+	if filter.IsTrial, err = boolQueryParam(c, "is_trial"); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "is_trial must be true or false",
+		})
+	}
+	var status int
+	var msg string
+	if filter.IncludeDeleted, status, msg = s.adminFlag(c, "include_deleted"); msg != "" {
+		return c.JSON(status, map[string]string{
+			"error": msg,
+		})
+	}
 
 	ctx := c.Request().Context()
-	users, err := s.userService.ListUsers(ctx, limit, offset)
+	page, err := s.userService.ListUsers(ctx, filter, limit, offset)
 	if err != nil {
 		log.WithError(err).Error("Failed to list users")
 		statusCode, errorMsg := handleError(err)
@@ -276,12 +538,17 @@ func (s *server) ListUsers(c echo.Context) error {
 		})
 	}
 
-	return c.JSON(http.StatusOK, users)
+	return c.JSON(http.StatusOK, newPage(page))
 }
 
 // AddCoinsRequest - request structure to add coins
 type AddCoinsRequest struct {
 	Coins int64 `json:"coins"`
+	// Reason is recorded in the coin ledger, e.g. "promo_code"; it defaults
+	// to coin_purchase when adding and spend when deducting. Only coins added
+	// as coin_purchase count as purchased. Reasons the service writes itself,
+	// such as refund or signup_bonus, are rejected.
+	Reason string `json:"reason,omitempty"`
 }
 
 // SubscriptionRequest - request structure for subscription
@@ -289,6 +556,19 @@ type SubscriptionRequest struct {
 	DurationHours int `json:"duration_hours"`
 }
 
+// duration converts DurationHours to a time.Duration. Out-of-range values are
+// rejected before the multiplication so it can never overflow; the returned
+// message is empty when the value is valid.
+func (r SubscriptionRequest) duration() (time.Duration, string) {
+	if r.DurationHours <= 0 {
+		return 0, "duration_hours must be greater than 0"
+	}
+	if r.DurationHours > domain.MaxSubscriptionDurationHours {
+		return 0, fmt.Sprintf("duration_hours must not exceed %d hours", domain.MaxSubscriptionDurationHours)
+	}
+	return time.Duration(r.DurationHours) * time.Hour, ""
+}
+
 func (s *server) AddCoins(c echo.Context) error {
 	id := c.Param("id")
 	if id == "" {
@@ -305,16 +585,24 @@ func (s *server) AddCoins(c echo.Context) error {
 	}
 
 	ctx := c.Request().Context()
-	if err := s.userService.AddCoins(ctx, id, req.Coins); err != nil {
+	user, replayed, err := s.userService.AddCoins(ctx, id, req.Coins, req.Reason, c.Request().Header.Get(IdempotencyKeyHeader))
+	if err != nil {
 		log.WithError(err).WithField("user_id", id).Error("Failed to add coins")
 		statusCode, errorMsg := handleError(err)
 		return c.JSON(statusCode, map[string]string{
 			"error": errorMsg,
 		})
 	}
+	if replayed {
+		c.Response().Header().Set(IdempotentReplayedHeader, "true")
+	}
 
-	return c.JSON(http.StatusOK, map[string]string{
-		"message": "coins added successfully",
+	// balance and user predate coins_balance and are kept for existing clients
+	return c.JSON(http.StatusOK, AddCoinsResponse{
+		Balance:      user.CoinsBalance,
+		CoinsAdded:   req.Coins,
+		CoinsBalance: user.CoinsBalance,
+		User:         user,
 	})
 }
 
@@ -340,20 +628,35 @@ func (s *server) DeductCoins(c echo.Context) error {
 	}
 
 	ctx := c.Request().Context()
-	if err := s.userService.DeductCoins(ctx, id, req.Coins); err != nil {
+	user, replayed, err := s.userService.DeductCoins(ctx, id, req.Coins, req.Reason, c.Request().Header.Get(IdempotencyKeyHeader))
+	if err != nil {
 		log.WithError(err).WithField("user_id", id).Error("Failed to deduct coins")
 		statusCode, errorMsg := handleError(err)
 		return c.JSON(statusCode, map[string]string{
 			"error": errorMsg,
 		})
 	}
+	if replayed {
+		c.Response().Header().Set(IdempotentReplayedHeader, "true")
+	}
 
-	return c.JSON(http.StatusOK, map[string]string{
-		"message": "coins deducted successfully",
+	// balance and user predate coins_balance and are kept for existing clients
+	return c.JSON(http.StatusOK, DeductCoinsResponse{
+		Balance:       user.CoinsBalance,
+		CoinsBalance:  user.CoinsBalance,
+		CoinsDeducted: req.Coins,
+		User:          user,
 	})
 }
 
-func (s *server) ActivateSubscription(c echo.Context) error {
+// TransferCoinsRequest - request structure to transfer coins to another user
+type TransferCoinsRequest struct {
+	ToUserID string `json:"to_user_id"`
+	Coins    int64  `json:"coins"`
+}
+
+// TransferCoins moves coins from the user to the one named in the body.
+func (s *server) TransferCoins(c echo.Context) error {
 	id := c.Param("id")
 	if id == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{
@@ -361,42 +664,153 @@ func (s *server) ActivateSubscription(c echo.Context) error {
 		})
 	}
 
-	var req SubscriptionRequest
+	var req TransferCoinsRequest
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{
 			"error": "invalid request body",
 		})
 	}
-
-	if req.DurationHours <= 0 {
+	if req.ToUserID == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "duration_hours must be greater than 0",
+			"error": "to_user_id is required",
 		})
 	}
 
-	if req.DurationHours > domain.MaxSubscriptionDurationHours {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": fmt.Sprintf("duration_hours must not exceed %d hours", domain.MaxSubscriptionDurationHours),
+	user, err := s.userService.TransferCoins(c.Request().Context(), id, req.ToUserID, req.Coins)
+	if err != nil {
+		log.WithError(err).WithField("user_id", id).Error("Failed to transfer coins")
+		statusCode, errorMsg := handleError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
 		})
 	}
 
-	duration := time.Duration(req.DurationHours) * time.Hour
+	return c.JSON(http.StatusOK, TransferCoinsResponse{
+		CoinsBalance:     user.CoinsBalance,
+		CoinsTransferred: req.Coins,
+		ToUserID:         req.ToUserID,
+	})
+}
+
+// CoinTransactionsPage is a page of the coin ledger. With ?verify=true it
+// also lists the entries on the page whose balance_after does not follow
+// from the entry before.
+type CoinTransactionsPage struct {
+	Page[domain.CoinTransaction]
+	Verified      bool                           `json:"verified,omitempty"`
+	Discrepancies []domain.CoinLedgerDiscrepancy `json:"discrepancies,omitempty"`
+}
+
+// ListCoinTransactions returns the user's coin ledger, newest first. The
+// admin may pass verify=true to have the page checked for discrepancies.
+func (s *server) ListCoinTransactions(c echo.Context) error {
+	id := c.Param("id")
+	limit, offset, err := paginationParams(c, 10)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+	verify, status, msg := s.adminFlag(c, "verify")
+	if msg != "" {
+		return c.JSON(status, map[string]string{
+			"error": msg,
+		})
+	}
 
 	ctx := c.Request().Context()
-	if err := s.userService.ActivateSubscription(ctx, id, duration); err != nil {
-		log.WithError(err).WithField("user_id", id).Error("Failed to activate subscription")
+	page, err := s.userService.ListCoinTransactions(ctx, id, limit, offset)
+	if err != nil {
+		log.WithError(err).WithField("user_id", id).Error("Failed to list coin transactions")
 		statusCode, errorMsg := handleError(err)
 		return c.JSON(statusCode, map[string]string{
 			"error": errorMsg,
 		})
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{
-		"message": "subscription activated successfully",
+	var discrepancies []domain.CoinLedgerDiscrepancy
+	if verify {
+		discrepancies, err = s.userService.VerifyCoinTransactions(ctx, id, page.Limit, page.Offset)
+		if err != nil {
+			log.WithError(err).WithField("user_id", id).Error("Failed to verify coin transactions")
+			statusCode, errorMsg := handleError(err)
+			return c.JSON(statusCode, map[string]string{
+				"error": errorMsg,
+			})
+		}
+	}
+
+	return c.JSON(http.StatusOK, CoinTransactionsPage{
+		Page:          newPage(page),
+		Verified:      verify,
+		Discrepancies: discrepancies,
 	})
 }
 
-func (s *server) RenewSubscription(c echo.Context) error {
+// ListAdminActions returns the changes admins made to the user, newest
+// first.
+func (s *server) ListAdminActions(c echo.Context) error {
+	id := c.Param("id")
+	limit, offset, err := paginationParams(c, 10)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": err.Error(),
+		})
+	}
+
+	page, err := s.userService.ListAdminActions(c.Request().Context(), id, limit, offset)
+	if err != nil {
+		log.WithError(err).WithField("user_id", id).Error("Failed to list admin actions")
+		statusCode, errorMsg := handleError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, newPage(page))
+}
+
+// ProvisionUserRequest creates a user with an active subscription in one call.
+type ProvisionUserRequest struct {
+	domain.CreateUserRequest
+	SubscriptionRequest
+}
+
+// ProvisionUser creates a user and activates their subscription atomically.
+func (s *server) ProvisionUser(c echo.Context) error {
+	var req ProvisionUserRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+	if statusCode, errorMsg := s.signupBonusOption(c, &req.CreateUserRequest); errorMsg != "" {
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	duration, errorMsg := req.duration()
+	if errorMsg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	user, err := s.userService.ProvisionUser(c.Request().Context(), req.CreateUserRequest, duration)
+	if err != nil {
+		log.WithError(err).Error("Failed to provision user")
+		statusCode, errorMsg := handleError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, "/api/users/"+user.ID)
+	return c.JSON(http.StatusCreated, user)
+}
+
+func (s *server) ActivateSubscription(c echo.Context) error {
 	id := c.Param("id")
 	if id == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{
@@ -411,32 +825,65 @@ func (s *server) RenewSubscription(c echo.Context) error {
 		})
 	}
 
-	if req.DurationHours <= 0 {
+	duration, errorMsg := req.duration()
+	if errorMsg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	ctx := c.Request().Context()
+	_, replayed, err := s.userService.ActivateSubscription(ctx, id, duration, c.Request().Header.Get(IdempotencyKeyHeader))
+	if err != nil {
+		log.WithError(err).WithField("user_id", id).Error("Failed to activate subscription")
+		statusCode, errorMsg := handleError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+	if replayed {
+		c.Response().Header().Set(IdempotentReplayedHeader, "true")
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "subscription activated successfully"})
+}
+
+func (s *server) RenewSubscription(c echo.Context) error {
+	id := c.Param("id")
+	if id == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "duration_hours must be greater than 0",
+			"error": "user ID is required",
 		})
 	}
 
-	if req.DurationHours > domain.MaxSubscriptionDurationHours {
+	var req SubscriptionRequest
+	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": fmt.Sprintf("duration_hours must not exceed %d hours", domain.MaxSubscriptionDurationHours),
+			"error": "invalid request body",
 		})
 	}
 
-	duration := time.Duration(req.DurationHours) * time.Hour
+	duration, errorMsg := req.duration()
+	if errorMsg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": errorMsg,
+		})
+	}
 
 	ctx := c.Request().Context()
-	if err := s.userService.RenewSubscription(ctx, id, duration); err != nil {
+	_, replayed, err := s.userService.RenewSubscription(ctx, id, duration, c.Request().Header.Get(IdempotencyKeyHeader))
+	if err != nil {
 		log.WithError(err).WithField("user_id", id).Error("Failed to renew subscription")
 		statusCode, errorMsg := handleError(err)
 		return c.JSON(statusCode, map[string]string{
 			"error": errorMsg,
 		})
 	}
+	if replayed {
+		c.Response().Header().Set(IdempotentReplayedHeader, "true")
+	}
 
-	return c.JSON(http.StatusOK, map[string]string{
-		"message": "subscription renewed successfully",
-	})
+	return c.JSON(http.StatusOK, MessageResponse{Message: "subscription renewed successfully"})
 }
 
 func (s *server) HasAccess(c echo.Context) error {
@@ -448,7 +895,7 @@ func (s *server) HasAccess(c echo.Context) error {
 	}
 
 	ctx := c.Request().Context()
-	user, err := s.userService.GetUser(ctx, id)
+	user, err := s.userService.GetUser(ctx, id, false)
 	if err != nil {
 		if errors.Is(err, domain.ErrUserNotFound) {
 			return c.JSON(http.StatusNotFound, map[string]string{
@@ -461,9 +908,108 @@ func (s *server) HasAccess(c echo.Context) error {
 		})
 	}
 
+	if c.QueryParam("explain") == "true" {
+		return c.JSON(http.StatusOK, s.userService.ExplainAccess(user))
+	}
+
 	hasAccess := s.userService.HasAccessByUser(user)
 
 	return c.JSON(http.StatusOK, map[string]bool{
 		"has_access": hasAccess,
 	})
 }
+
+// Capabilities reports what the user may do: can_read, can_create and
+// can_purchase, with the reason for each one denied.
+func (s *server) Capabilities(c echo.Context) error {
+	id := c.Param("id")
+	if id == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "user ID is required",
+		})
+	}
+
+	user, err := s.userService.GetUser(c.Request().Context(), id, false)
+	if err != nil {
+		log.WithError(err).WithField("user_id", id).Error("Failed to get user")
+		statusCode, errorMsg := handleError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, s.userService.Capabilities(user))
+}
+
+// VerifyEmailRequest - request structure to confirm email verification
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+func (s *server) SendEmailVerification(c echo.Context) error {
+	id := c.Param("id")
+	if id == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "user ID is required",
+		})
+	}
+
+	ctx := c.Request().Context()
+	if err := s.userService.SendEmailVerification(ctx, id); err != nil {
+		log.WithError(err).WithField("user_id", id).Error("Failed to send email verification")
+		statusCode, errorMsg := handleError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusAccepted, MessageResponse{Message: "verification email sent"})
+}
+
+func (s *server) ConfirmEmailVerification(c echo.Context) error {
+	id := c.Param("id")
+	if id == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "user ID is required",
+		})
+	}
+
+	var req VerifyEmailRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "invalid request body",
+		})
+	}
+
+	ctx := c.Request().Context()
+	if err := s.userService.ConfirmEmailVerification(ctx, id, req.Token); err != nil {
+		log.WithError(err).WithField("user_id", id).Error("Failed to confirm email verification")
+		statusCode, errorMsg := handleError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, MessageResponse{Message: "email verified successfully"})
+}
+
+func (s *server) GetSubscriptionStatus(c echo.Context) error {
+	id := c.Param("id")
+	if id == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "user ID is required",
+		})
+	}
+
+	ctx := c.Request().Context()
+	status, err := s.userService.GetSubscriptionStatus(ctx, id)
+	if err != nil {
+		log.WithError(err).WithField("user_id", id).Error("Failed to get subscription status")
+		statusCode, errorMsg := handleError(err)
+		return c.JSON(statusCode, map[string]string{
+			"error": errorMsg,
+		})
+	}
+
+	return c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,1021 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/reqctx"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// driverErrors are database errors as the repositories return them, wrapped
+// with the operation that failed.
+var driverErrors = []error{
+	fmt.Errorf("create user: %w", &pq.Error{
+		Code:       "23505",
+		Message:    `duplicate key value violates unique constraint "users_email_hash_key"`,
+		Detail:     "Key (email_hash)=(9f86d081) already exists.",
+		Table:      "users",
+		Constraint: "users_email_hash_key",
+	}),
+	fmt.Errorf("lock checkout product: %w", &pq.Error{Code: "40P01", Message: "deadlock detected"}),
+	fmt.Errorf("list products: %w", &pq.Error{Code: "42P01", Message: `relation "products" does not exist`}),
+	fmt.Errorf("save job checkpoint: %w", &pq.Error{
+		Code:    "23503",
+		Message: `insert or update on table "order_items" violates foreign key constraint "order_items_order_id_fkey"`,
+		Table:   "order_items",
+	}),
+	fmt.Errorf("get user by ID: %w", sql.ErrConnDone),
+	fmt.Errorf("list categories: %w", context.DeadlineExceeded),
+}
+
+// tableNames returns the tables the migrations create.
+func tableNames(t *testing.T) []string {
+	t.Helper()
+	files, err := filepath.Glob("../../db/migrations/*.up.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no migrations found: %v", err)
+	}
+	createTable := regexp.MustCompile(`CREATE TABLE (?:IF NOT EXISTS )?(\w+)`)
+	seen := map[string]bool{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range createTable.FindAllStringSubmatch(string(data), -1) {
+			seen[m[1]] = true
+		}
+	}
+	var tables []string
+	for table := range seen {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// assertNoDriverDetails fails if msg carries anything from the database.
+func assertNoDriverDetails(t *testing.T, tables []string, where, msg string) {
+	t.Helper()
+	for _, leak := range []string{"pq:", "SQLSTATE", "constraint", "relation", "sql:", "deadline"} {
+		if strings.Contains(msg, leak) {
+			t.Errorf("%s: %q contains %q", where, msg, leak)
+		}
+	}
+	for _, table := range tables {
+		if regexp.MustCompile(`\b` + table + `\b`).MatchString(msg) {
+			t.Errorf("%s: %q names table %s", where, msg, table)
+		}
+	}
+}
+
+func TestErrorMappersHideDriverErrors(t *testing.T) {
+	tables := tableNames(t)
+	mappers := map[string]func(error) (int, string){
+		"handleError":         handleError,
+		"handleProductError":  handleProductError,
+		"handleCategoryError": handleCategoryError,
+		"handleOrderError":    handleOrderError,
+		"handleCampaignError": handleCampaignError,
+	}
+	for name, mapper := range mappers {
+		for _, err := range driverErrors {
+			status, msg := mapper(err)
+			if status != http.StatusInternalServerError {
+				t.Errorf("%s(%v) = %d, want 500", name, err, status)
+			}
+			assertNoDriverDetails(t, tables, name, msg)
+		}
+	}
+}
+
+type failingUserService struct {
+	UserService
+	err error
+}
+
+func (f failingUserService) GetUser(ctx context.Context, id string, includeDeleted bool) (*domain.User, error) {
+	return nil, f.err
+}
+
+func (f failingUserService) CreateUser(ctx context.Context, req domain.CreateUserRequest) (*domain.User, error) {
+	return nil, f.err
+}
+
+func (f failingUserService) UpdateUser(ctx context.Context, id string, req domain.UpdateUserRequest) (*domain.User, error) {
+	return nil, f.err
+}
+
+func (f failingUserService) AddCoins(ctx context.Context, userID string, coins int64, reason, idempotencyKey string) (*domain.User, bool, error) {
+	return nil, false, f.err
+}
+
+func (f failingUserService) ListUsers(ctx context.Context, filter domain.UserListFilter, limit, offset int) (domain.Page[domain.User], error) {
+	return domain.Page[domain.User]{}, f.err
+}
+
+type failingProductService struct {
+	ProductService
+	err error
+}
+
+func (f failingProductService) GetProductByID(ctx context.Context, id string) (*domain.Product, error) {
+	return nil, f.err
+}
+
+func (f failingProductService) CreateProduct(ctx context.Context, req domain.CreateProductRequest) (*domain.Product, error) {
+	return nil, f.err
+}
+
+type failingCategoryService struct {
+	ProductCategoryService
+	err error
+}
+
+func (f failingCategoryService) GetCategoryByID(ctx context.Context, id string) (*domain.ProductCategory, error) {
+	return nil, f.err
+}
+
+type failingOrderService struct {
+	OrderService
+	err error
+}
+
+func (f failingOrderService) GetOrder(ctx context.Context, orderID string, ownerID *string) (*domain.Order, error) {
+	return nil, f.err
+}
+
+// TestErrorBodiesHideDriverErrors sends requests whose service call fails
+// with a database error and checks the JSON bodies say nothing about it.
+func TestErrorBodiesHideDriverErrors(t *testing.T) {
+	tables := tableNames(t)
+	const userID = "0190c2a8-7f1e-7a3b-9c4d-000000000001"
+
+	for _, driverErr := range driverErrors {
+		e := echo.New()
+		e.JSONSerializer = TimedJSONSerializer{}
+		srv := NewServer(failingUserService{err: driverErr}, nil, nil, "")
+		products := NewProductServer(failingProductService{err: driverErr}, nil, "", false)
+		categories := NewProductCategoryServer(failingCategoryService{err: driverErr}, "", false)
+		orders := NewOrderServer(failingOrderService{err: driverErr}, "")
+		e.GET("/api/users/:id", srv.GetUser)
+		e.GET("/api/users", srv.ListUsers)
+		e.POST("/api/users", srv.CreateUser)
+		e.POST("/api/users/:id/coins", srv.AddCoins)
+		e.GET("/api/catalog/products/:id", products.GetProductByID)
+		e.POST("/api/catalog/products", products.CreateProduct)
+		e.GET("/api/catalog/categories/:id", categories.GetCategoryByID)
+		e.GET("/api/orders/:order_id", orders.GetOrder)
+
+		requests := []struct {
+			method, path, body string
+		}{
+			{http.MethodGet, "/api/users/" + userID, ""},
+			{http.MethodGet, "/api/users", ""},
+			{http.MethodPost, "/api/users", `{"email":"ada@example.com","name":"Ada"}`},
+			{http.MethodPost, "/api/users/" + userID + "/coins", `{"coins":10}`},
+			{http.MethodGet, "/api/catalog/products/" + userID, ""},
+			{http.MethodPost, "/api/catalog/products", `{"category_id":"` + userID + `","slug":"book","name":"Book","price_coins":10}`},
+			{http.MethodGet, "/api/catalog/categories/" + userID, ""},
+			{http.MethodGet, "/api/orders/" + userID, ""},
+		}
+		for _, r := range requests {
+			req := httptest.NewRequest(r.method, r.path, strings.NewReader(r.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set(UserIDHeader, userID)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			where := fmt.Sprintf("%s %s with %v", r.method, r.path, driverErr)
+			if rec.Code != http.StatusInternalServerError {
+				t.Errorf("%s: status %d, want 500: %s", where, rec.Code, rec.Body)
+			}
+			assertNoDriverDetails(t, tables, where, rec.Body.String())
+		}
+	}
+}
+
+// ledgerUserService serves a one-entry ledger page and the discrepancies it
+// was given, recording whether it was asked to verify.
+type ledgerUserService struct {
+	UserService
+	discrepancies []domain.CoinLedgerDiscrepancy
+	verified      *bool
+}
+
+func (f ledgerUserService) ListCoinTransactions(ctx context.Context, userID string, limit, offset int) (domain.Page[domain.CoinTransaction], error) {
+	return domain.Page[domain.CoinTransaction]{
+		Items: []domain.CoinTransaction{{ID: 4, UserID: userID, Amount: 10, Direction: domain.CoinDirectionDebit, Delta: -10, BalanceAfter: 110}},
+		Total: 1, Limit: limit, Offset: offset,
+	}, nil
+}
+
+func (f ledgerUserService) VerifyCoinTransactions(ctx context.Context, userID string, limit, offset int) ([]domain.CoinLedgerDiscrepancy, error) {
+	*f.verified = true
+	return f.discrepancies, nil
+}
+
+func TestListCoinTransactionsVerify(t *testing.T) {
+	const path = "/api/users/0190c2a8-7f1e-7a3b-9c4d-000000000001/coins/transactions"
+	const adminToken = "admin-secret"
+	gap := domain.CoinLedgerDiscrepancy{TransactionID: 4, PreviousID: 2, Expected: 60, BalanceAfter: 110, Gap: 50}
+
+	tests := []struct {
+		name          string
+		query         string
+		admin         bool
+		discrepancies []domain.CoinLedgerDiscrepancy
+		wantStatus    int
+		wantVerified  bool
+		wantBody      string
+	}{
+		{"unverified", "", false, nil, http.StatusOK, false, `"items":[{"id":4`},
+		{"verify false", "?verify=false", false, nil, http.StatusOK, false, `"items":[{"id":4`},
+		{"verify without admin", "?verify=true", false, nil, http.StatusForbidden, false, "admin access required for verify"},
+		{"verify junk", "?verify=yes", true, nil, http.StatusBadRequest, false, "verify must be true or false"},
+		{"verified clean", "?verify=true", true, []domain.CoinLedgerDiscrepancy{}, http.StatusOK, true, `"verified":true`},
+		{"verified corrupted", "?verify=true", true, []domain.CoinLedgerDiscrepancy{gap}, http.StatusOK, true,
+			`"discrepancies":[{"transaction_id":4,"previous_id":2,"expected":60,"balance_after":110,"gap":50}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verified := false
+			e := echo.New()
+			srv := NewServer(ledgerUserService{discrepancies: tt.discrepancies, verified: &verified}, nil, nil, adminToken)
+			e.GET("/api/users/:id/coins/transactions", srv.ListCoinTransactions)
+
+			req := httptest.NewRequest(http.MethodGet, path+tt.query, nil)
+			if tt.admin {
+				req.Header.Set(AdminTokenHeader, adminToken)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if verified != tt.wantVerified {
+				t.Errorf("verified %v, want %v", verified, tt.wantVerified)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body %s, want it to contain %s", rec.Body, tt.wantBody)
+			}
+			if !tt.wantVerified && strings.Contains(rec.Body.String(), "discrepancies") {
+				t.Errorf("unverified body %s lists discrepancies", rec.Body)
+			}
+		})
+	}
+}
+
+func TestDuplicateEmailIsConflict(t *testing.T) {
+	const path = "/api/users/0190c2a8-7f1e-7a3b-9c4d-000000000001"
+	// As the service returns the repository's mapping of a unique violation
+	errs := []error{
+		domain.ErrEmailAlreadyExists,
+		fmt.Errorf("failed to create user: %w", domain.ErrEmailAlreadyExists),
+	}
+	for _, err := range errs {
+		e := echo.New()
+		srv := NewServer(failingUserService{err: err}, nil, nil, "")
+		e.POST("/api/users", srv.CreateUser)
+		e.PUT("/api/users/:id", srv.UpdateUser)
+
+		for _, r := range []struct{ method, path string }{
+			{http.MethodPost, "/api/users"},
+			{http.MethodPut, path},
+		} {
+			req := httptest.NewRequest(r.method, r.path, strings.NewReader(`{"email":"ada@example.com","name":"Ada"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != http.StatusConflict {
+				t.Errorf("%s %s with %v: status %d, want 409: %s", r.method, r.path, err, rec.Code, rec.Body)
+			}
+		}
+	}
+}
+
+// subscriptionUserService records the durations it is asked to renew or
+// activate for.
+type subscriptionUserService struct {
+	UserService
+	durations *[]time.Duration
+}
+
+func (f subscriptionUserService) RenewSubscription(ctx context.Context, userID string, duration time.Duration, idempotencyKey string) (*domain.User, bool, error) {
+	*f.durations = append(*f.durations, duration)
+	return &domain.User{ID: userID}, false, nil
+}
+
+func (f subscriptionUserService) ActivateSubscription(ctx context.Context, userID string, duration time.Duration, idempotencyKey string) (*domain.User, bool, error) {
+	*f.durations = append(*f.durations, duration)
+	return &domain.User{ID: userID}, false, nil
+}
+
+func TestSubscriptionDurationOverflow(t *testing.T) {
+	const user = "/api/users/0190c2a8-7f1e-7a3b-9c4d-000000000001"
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"maximum", fmt.Sprintf(`{"duration_hours":%d}`, domain.MaxSubscriptionDurationHours), http.StatusOK},
+		{"one hour over", fmt.Sprintf(`{"duration_hours":%d}`, domain.MaxSubscriptionDurationHours+1), http.StatusBadRequest},
+		// Multiplied by time.Hour these wrap around to a negative or small positive duration
+		{"wraps negative", `{"duration_hours":2562048}`, http.StatusBadRequest},
+		{"wraps positive", `{"duration_hours":5124096}`, http.StatusBadRequest},
+		{"max int64", `{"duration_hours":9223372036854775807}`, http.StatusBadRequest},
+		{"beyond int64", `{"duration_hours":92233720368547758070}`, http.StatusBadRequest},
+		{"zero", `{"duration_hours":0}`, http.StatusBadRequest},
+		{"negative", `{"duration_hours":-1}`, http.StatusBadRequest},
+	}
+	for _, action := range []string{"renew", "activate"} {
+		for _, tt := range tests {
+			t.Run(action+"/"+tt.name, func(t *testing.T) {
+				var durations []time.Duration
+				e := echo.New()
+				srv := NewServer(subscriptionUserService{durations: &durations}, nil, nil, "")
+				e.POST("/api/users/:id/subscription/renew", srv.RenewSubscription)
+				e.POST("/api/users/:id/subscription/activate", srv.ActivateSubscription)
+
+				req := httptest.NewRequest(http.MethodPost, user+"/subscription/"+action, strings.NewReader(tt.body))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, req)
+
+				if rec.Code != tt.wantStatus {
+					t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+				}
+				if tt.wantStatus != http.StatusOK {
+					if len(durations) != 0 {
+						t.Errorf("service called with %v", durations)
+					}
+					return
+				}
+				if len(durations) != 1 || durations[0] != time.Duration(domain.MaxSubscriptionDurationHours)*time.Hour {
+					t.Errorf("service called with %v", durations)
+				}
+			})
+		}
+	}
+}
+
+// pagedCall records the page a list handler passed to its service; calls
+// stays zero when the handler rejected the request first.
+type pagedCall struct {
+	limit, offset, calls int
+}
+
+// serve records the page asked for and returns the one a service under the
+// clamp policy serves for it.
+func (c *pagedCall) serve(limit, offset int) (int, int) {
+	*c = pagedCall{limit, offset, c.calls + 1}
+	limit, offset, _ = domain.ListPage(domain.InvalidInputClamp, limit, offset)
+	return limit, offset
+}
+
+type pagedUserService struct {
+	UserService
+	call *pagedCall
+}
+
+func (f pagedUserService) ListUsers(ctx context.Context, filter domain.UserListFilter, limit, offset int) (domain.Page[domain.User], error) {
+	limit, offset = f.call.serve(limit, offset)
+	return domain.Page[domain.User]{Limit: limit, Offset: offset}, nil
+}
+
+type pagedProductService struct {
+	ProductService
+	call *pagedCall
+}
+
+func (f pagedProductService) ListProducts(ctx context.Context, categoryID *string, onlyActive bool, sort string, limit, offset int) (domain.Page[domain.Product], error) {
+	limit, offset = f.call.serve(limit, offset)
+	return domain.Page[domain.Product]{Limit: limit, Offset: offset}, nil
+}
+
+type pagedReportService struct {
+	ReportService
+	call *pagedCall
+}
+
+func (f pagedReportService) CatalogStats(ctx context.Context, categoryID *string, rng domain.StatsRange, limit, offset int) (domain.Page[domain.ProductStats], error) {
+	limit, offset = f.call.serve(limit, offset)
+	return domain.Page[domain.ProductStats]{Limit: limit, Offset: offset}, nil
+}
+
+func TestPaginationParamsAbsentVersusInvalid(t *testing.T) {
+	call := &pagedCall{}
+	e := echo.New()
+	e.GET("/api/users", NewServer(pagedUserService{call: call}, nil, nil, "").ListUsers)
+	e.GET("/api/catalog/products", NewProductServer(pagedProductService{call: call}, nil, "", false).ListProducts)
+	e.GET("/api/catalog/stats", NewReportServer(pagedReportService{call: call}).CatalogStats)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantLimit  int
+		wantOffset int
+		wantError  string
+	}{
+		{"both absent", "", http.StatusOK, 10, 0, ""},
+		{"both given", "?limit=25&offset=50", http.StatusOK, 25, 50, ""},
+		{"only offset", "?offset=5", http.StatusOK, 10, 5, ""},
+		{"empty limit", "?limit=", http.StatusOK, 10, 0, ""},
+		{"zero limit", "?limit=0", http.StatusBadRequest, 0, 0, "invalid limit"},
+		{"negative limit", "?limit=-5", http.StatusBadRequest, 0, 0, "invalid limit"},
+		{"junk limit", "?limit=ten", http.StatusBadRequest, 0, 0, "invalid limit"},
+		{"zero offset", "?offset=0", http.StatusOK, 10, 0, ""},
+		{"negative offset", "?offset=-1", http.StatusBadRequest, 0, 0, "invalid offset"},
+		{"junk offset", "?limit=5&offset=1.5", http.StatusBadRequest, 0, 0, "invalid offset"},
+		{"clamped page", "?limit=150&offset=10000001", http.StatusOK, 150, 10_000_001, ""},
+	}
+	for _, path := range []string{"/api/users", "/api/catalog/products", "/api/catalog/stats"} {
+		for _, tt := range tests {
+			t.Run(path+"/"+tt.name, func(t *testing.T) {
+				*call = pagedCall{}
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path+tt.query, nil))
+
+				if rec.Code != tt.wantStatus {
+					t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+				}
+				if tt.wantError != "" {
+					if call.calls != 0 {
+						t.Errorf("invalid page reached the service")
+					}
+					if !strings.Contains(rec.Body.String(), tt.wantError) {
+						t.Errorf("body %s, want %q", rec.Body, tt.wantError)
+					}
+					return
+				}
+				if call.calls != 1 || call.limit != tt.wantLimit || call.offset != tt.wantOffset {
+					t.Errorf("service called %d times with %d/%d, want once with %d/%d",
+						call.calls, call.limit, call.offset, tt.wantLimit, tt.wantOffset)
+				}
+				// The response reports the page the service served, not the
+				// one asked for
+				var page Page[json.RawMessage]
+				if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				if wantLimit, wantOffset := min(tt.wantLimit, domain.MaxListLimit), min(tt.wantOffset, domain.MaxListOffset); page.Limit != wantLimit || page.Offset != wantOffset {
+					t.Errorf("page %d/%d, want %d/%d", page.Limit, page.Offset, wantLimit, wantOffset)
+				}
+			})
+		}
+	}
+}
+
+// createUserService records the create requests it gets.
+type createUserService struct {
+	UserService
+	requests *[]domain.CreateUserRequest
+}
+
+func (f createUserService) CreateUser(ctx context.Context, req domain.CreateUserRequest) (*domain.User, error) {
+	*f.requests = append(*f.requests, req)
+	return &domain.User{ID: "0190c2a8-7f1e-7a3b-9c4d-000000000001", Email: req.Email, Name: req.Name, Status: domain.StatusActive}, nil
+}
+
+func TestSignupBonusOption(t *testing.T) {
+	const adminToken = "admin-secret"
+	tests := []struct {
+		name       string
+		query      string
+		admin      bool
+		wantStatus int
+		wantSkip   bool
+	}{
+		{"default grants the bonus", "", false, http.StatusCreated, false},
+		{"explicit grant", "?grant_signup_bonus=true", false, http.StatusCreated, false},
+		{"admin skips the bonus", "?grant_signup_bonus=false", true, http.StatusCreated, true},
+		{"admin grants the bonus", "?grant_signup_bonus=true", true, http.StatusCreated, false},
+		{"non-admin may not skip", "?grant_signup_bonus=false", false, http.StatusForbidden, false},
+		{"junk value", "?grant_signup_bonus=maybe", true, http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests []domain.CreateUserRequest
+			e := echo.New()
+			srv := NewServer(createUserService{requests: &requests}, nil, nil, adminToken)
+			e.POST("/api/users", srv.CreateUser)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/users"+tt.query, strings.NewReader(`{"email":"ada@example.com","name":"Ada"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			if tt.admin {
+				req.Header.Set(AdminTokenHeader, adminToken)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusCreated {
+				if len(requests) != 0 {
+					t.Errorf("rejected request created a user")
+				}
+				return
+			}
+			if len(requests) != 1 || requests[0].SkipSignupBonus != tt.wantSkip {
+				t.Errorf("create requests %+v, want one with SkipSignupBonus %v", requests, tt.wantSkip)
+			}
+		})
+	}
+}
+
+// Fakes that create every resource under createdID and delete anything.
+const createdID = "0190c2a8-7f1e-7a3b-9c4d-0000000000c1"
+
+type resourceUserService struct {
+	UserService
+}
+
+func (resourceUserService) CreateUser(ctx context.Context, req domain.CreateUserRequest) (*domain.User, error) {
+	return &domain.User{ID: createdID, Email: req.Email, Status: domain.StatusActive}, nil
+}
+
+func (resourceUserService) ProvisionUser(ctx context.Context, req domain.CreateUserRequest, duration time.Duration) (*domain.User, error) {
+	return &domain.User{ID: createdID, Email: req.Email, Status: domain.StatusActive}, nil
+}
+
+func (resourceUserService) DeleteUser(ctx context.Context, id string) error     { return nil }
+func (resourceUserService) HardDeleteUser(ctx context.Context, id string) error { return nil }
+
+type resourceProductService struct {
+	ProductService
+}
+
+func (resourceProductService) CreateProduct(ctx context.Context, req domain.CreateProductRequest) (*domain.Product, error) {
+	return &domain.Product{ID: createdID, Slug: req.Slug}, nil
+}
+
+func (resourceProductService) CloneProduct(ctx context.Context, id string) (*domain.Product, error) {
+	return &domain.Product{ID: createdID}, nil
+}
+
+func (resourceProductService) DeleteProduct(ctx context.Context, id string) error { return nil }
+func (resourceProductService) ReleaseSlug(ctx context.Context, req domain.ReleaseSlugRequest) error {
+	return nil
+}
+
+type resourceCategoryService struct {
+	ProductCategoryService
+}
+
+func (resourceCategoryService) CreateCategory(ctx context.Context, req domain.CreateCategoryRequest) (*domain.ProductCategory, error) {
+	return &domain.ProductCategory{ID: createdID, Slug: req.Slug}, nil
+}
+
+func (resourceCategoryService) EnsureCategory(ctx context.Context, req domain.CreateCategoryRequest) (*domain.ProductCategory, bool, error) {
+	return &domain.ProductCategory{ID: createdID, Slug: req.Slug}, true, nil
+}
+
+func (resourceCategoryService) DeleteCategory(ctx context.Context, id string) error { return nil }
+
+type resourceOrderService struct {
+	OrderService
+}
+
+func (resourceOrderService) Checkout(ctx context.Context, userID string, req domain.CheckoutRequest) (*domain.Order, error) {
+	return &domain.Order{ID: createdID, UserID: userID}, nil
+}
+
+type resourcePurchaseService struct {
+	PurchaseService
+}
+
+func (resourcePurchaseService) Purchase(ctx context.Context, userID string, req domain.PurchaseRequest) (*domain.Purchase, error) {
+	return &domain.Purchase{ID: "0190c2a8-7f1e-7a3b-9c4d-0000000000c2", UserID: userID, OrderID: createdID}, nil
+}
+
+func TestCreatedAndNoContentResponses(t *testing.T) {
+	const adminToken = "admin-secret"
+	const user = "/api/users/0190c2a8-7f1e-7a3b-9c4d-000000000001"
+	const product = "/api/catalog/products/0190c2a8-7f1e-7a3b-9c4d-000000000002"
+	const category = "/api/catalog/categories/0190c2a8-7f1e-7a3b-9c4d-000000000003"
+
+	e := echo.New()
+	srv := NewServer(resourceUserService{}, nil, nil, adminToken)
+	products := NewProductServer(resourceProductService{}, nil, adminToken, false)
+	categories := NewProductCategoryServer(resourceCategoryService{}, adminToken, false)
+	orders := NewOrderServer(resourceOrderService{}, adminToken)
+	purchases := NewPurchaseServer(resourcePurchaseService{})
+	e.POST("/api/users", srv.CreateUser)
+	e.POST("/api/users/provision", srv.ProvisionUser)
+	e.DELETE("/api/users/:id", srv.DeleteUser)
+	e.POST("/api/users/:id/checkout", orders.Checkout)
+	e.POST("/api/users/:id/purchases", purchases.Purchase)
+	e.POST("/api/catalog/products", products.CreateProduct)
+	e.POST("/api/catalog/products/:id/clone", products.CloneProduct)
+	e.DELETE("/api/catalog/products/:id", products.DeleteProduct)
+	e.POST("/api/catalog/slugs/release", products.ReleaseSlug)
+	e.POST("/api/catalog/categories", categories.CreateCategory)
+	e.PUT("/api/catalog/categories/by-slug/:slug", categories.EnsureCategory)
+	e.DELETE("/api/catalog/categories/:id", categories.DeleteCategory)
+
+	created := []struct {
+		method, path, body string
+		wantLocation       string
+	}{
+		{http.MethodPost, "/api/users", `{"email":"ada@example.com","name":"Ada"}`, "/api/users/" + createdID},
+		{http.MethodPost, "/api/users/provision", `{"email":"ada@example.com","name":"Ada","duration_hours":24}`, "/api/users/" + createdID},
+		{http.MethodPost, user + "/checkout", `{"items":[{"product_id":"0190c2a8-7f1e-7a3b-9c4d-000000000002","quantity":1}]}`, "/api/orders/" + createdID},
+		{http.MethodPost, user + "/purchases", `{"product_id":"0190c2a8-7f1e-7a3b-9c4d-000000000002"}`, "/api/orders/" + createdID},
+		{http.MethodPost, "/api/catalog/products", `{"slug":"book","name":"Book","price_coins":10}`, "/api/catalog/products/" + createdID},
+		{http.MethodPost, product + "/clone", "", "/api/catalog/products/" + createdID},
+		{http.MethodPost, "/api/catalog/categories", `{"slug":"books","name":"Books"}`, "/api/catalog/categories/" + createdID},
+		{http.MethodPut, "/api/catalog/categories/by-slug/books", `{"name":"Books"}`, "/api/catalog/categories/" + createdID},
+	}
+	for _, r := range created {
+		req := httptest.NewRequest(r.method, r.path, strings.NewReader(r.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusCreated {
+			t.Errorf("%s %s: status %d, want 201: %s", r.method, r.path, rec.Code, rec.Body)
+			continue
+		}
+		if got := rec.Header().Get(echo.HeaderLocation); got != r.wantLocation {
+			t.Errorf("%s %s: Location %q, want %q", r.method, r.path, got, r.wantLocation)
+		}
+		if !strings.Contains(rec.Body.String(), createdID) {
+			t.Errorf("%s %s: body %s doesn't describe the created resource", r.method, r.path, rec.Body)
+		}
+	}
+
+	deleted := []struct {
+		method, path, body string
+		admin              bool
+	}{
+		{http.MethodDelete, user, "", false},
+		{http.MethodDelete, user + "?hard=true", "", true},
+		{http.MethodDelete, product, "", false},
+		{http.MethodDelete, category, "", false},
+		{http.MethodPost, "/api/catalog/slugs/release", `{"slug":"book","owner":"importer"}`, false},
+	}
+	for _, r := range deleted {
+		req := httptest.NewRequest(r.method, r.path, strings.NewReader(r.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if r.admin {
+			req.Header.Set(AdminTokenHeader, adminToken)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("%s %s: status %d, want 204: %s", r.method, r.path, rec.Code, rec.Body)
+			continue
+		}
+		if rec.Body.Len() != 0 {
+			t.Errorf("%s %s: 204 with body %q", r.method, r.path, rec.Body)
+		}
+		if ct := rec.Header().Get(echo.HeaderContentType); ct != "" {
+			t.Errorf("%s %s: 204 with Content-Type %q", r.method, r.path, ct)
+		}
+	}
+}
+
+func TestListUsersCoinRangeParams(t *testing.T) {
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantError  string
+	}{
+		{"?min_coins=100", http.StatusOK, ""},
+		{"?max_coins=100", http.StatusOK, ""},
+		{"?min_coins=100&max_coins=100", http.StatusOK, ""},
+		{"?min_coins=0&max_coins=5000", http.StatusOK, ""},
+		{"?min_coins=-1", http.StatusBadRequest, "invalid min_coins"},
+		{"?max_coins=lots", http.StatusBadRequest, "invalid max_coins"},
+	}
+	for _, tt := range tests {
+		call := &pagedCall{}
+		e := echo.New()
+		e.GET("/api/users", NewServer(pagedUserService{call: call}, nil, nil, "").ListUsers)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/users"+tt.query, nil))
+
+		if rec.Code != tt.wantStatus || !strings.Contains(rec.Body.String(), tt.wantError) {
+			t.Errorf("%s: status %d %s, want %d %q", tt.query, rec.Code, rec.Body, tt.wantStatus, tt.wantError)
+		}
+		wantCalls := 0
+		if tt.wantStatus == http.StatusOK {
+			wantCalls = 1
+		}
+		if call.calls != wantCalls {
+			t.Errorf("%s: service listed %d times, want %d", tt.query, call.calls, wantCalls)
+		}
+	}
+
+	// The service's range check surfaces as a 400
+	e := echo.New()
+	e.GET("/api/users", NewServer(failingUserService{err: domain.ErrInvalidCoinsRange}, nil, nil, "").ListUsers)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/users?min_coins=500&max_coins=100", nil))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "min_coins must not be greater than max_coins") {
+		t.Errorf("min above max: status %d %s, want 400", rec.Code, rec.Body)
+	}
+}
+
+// adminProductsService lists one active and one inactive product, or only
+// the active one when asked, and records the query it got.
+type adminProductsService struct {
+	ProductService
+	query *domain.AdminProductQuery
+}
+
+func (f adminProductsService) ListAllProducts(ctx context.Context, q domain.AdminProductQuery) (domain.Page[domain.Product], error) {
+	*f.query = q
+	products := []domain.Product{
+		{ID: "0190f1a2-0000-7000-8000-000000000011", Slug: "active", IsActive: true},
+		{ID: "0190f1a2-0000-7000-8000-000000000012", Slug: "retired", IsActive: false},
+	}
+	if q.OnlyActive {
+		products = products[:1]
+	}
+	return domain.Page[domain.Product]{Items: products, Total: int64(len(products)), Limit: q.Limit, Offset: q.Offset}, nil
+}
+
+func TestAdminProductListIncludesInactive(t *testing.T) {
+	const adminToken = "admin-secret"
+	query := &domain.AdminProductQuery{}
+	e := echo.New()
+	admin := e.Group("/api/admin", RequireAdminToken(adminToken))
+	admin.GET("/products", NewProductServer(adminProductsService{query: query}, nil, adminToken, true).ListAllProducts)
+
+	list := func(rawQuery string, token string) (*httptest.ResponseRecorder, Page[domain.Product]) {
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/products"+rawQuery, nil)
+		if token != "" {
+			req.Header.Set(AdminTokenHeader, token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		var page Page[domain.Product]
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+				t.Fatalf("decode page: %v", err)
+			}
+		}
+		return rec, page
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantSlugs  []string
+		wantFilter domain.AdminProductQuery
+	}{
+		{"default", "", []string{"active", "retired"}, domain.AdminProductQuery{Limit: 10}},
+		{"only active", "?only_active=true", []string{"active"}, domain.AdminProductQuery{OnlyActive: true, Limit: 10}},
+		{"only active false", "?only_active=false", []string{"active", "retired"}, domain.AdminProductQuery{Limit: 10}},
+		{"sorted", "?sort=price_coins&order=desc&limit=5&offset=5", []string{"active", "retired"},
+			domain.AdminProductQuery{SortBy: "price_coins", Descending: true, Limit: 5, Offset: 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, page := list(tt.query, adminToken)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d, want 200: %s", rec.Code, rec.Body)
+			}
+			if *query != tt.wantFilter {
+				t.Errorf("service queried with %+v, want %+v", *query, tt.wantFilter)
+			}
+			var slugs []string
+			for _, p := range page.Items {
+				slugs = append(slugs, p.Slug)
+			}
+			if strings.Join(slugs, ",") != strings.Join(tt.wantSlugs, ",") || page.Total != int64(len(tt.wantSlugs)) {
+				t.Errorf("listed %v of %d, want %v", slugs, page.Total, tt.wantSlugs)
+			}
+		})
+	}
+
+	// Hiding inactive products from the public never applies to admins,
+	// and the list is never served without the admin token
+	for _, token := range []string{"", "wrong"} {
+		*query = domain.AdminProductQuery{}
+		if rec, _ := list("", token); rec.Code != http.StatusForbidden || query.Limit != 0 {
+			t.Errorf("token %q: status %d, want 403 before the service", token, rec.Code)
+		}
+	}
+}
+
+// balanceUserService keeps one user's balance and returns the user as each
+// mutation left it.
+type balanceUserService struct {
+	UserService
+	user *domain.User
+}
+
+func (f balanceUserService) AddCoins(ctx context.Context, userID string, coins int64, reason, idempotencyKey string) (*domain.User, bool, error) {
+	f.user.CoinsBalance += coins
+	updated := *f.user
+	return &updated, false, nil
+}
+
+func (f balanceUserService) DeductCoins(ctx context.Context, userID string, coins int64, reason, idempotencyKey string) (*domain.User, bool, error) {
+	if f.user.CoinsBalance < coins {
+		return nil, false, domain.ErrInsufficientCoinsBalance
+	}
+	f.user.CoinsBalance -= coins
+	updated := *f.user
+	return &updated, false, nil
+}
+
+func TestCoinMutationResponsesCarryNewBalance(t *testing.T) {
+	const userID = "0190c2a8-7f1e-7a3b-9c4d-000000000001"
+	user := &domain.User{ID: userID, Email: "ada@example.com", Status: domain.StatusActive, CoinsBalance: 100}
+	e := echo.New()
+	srv := NewServer(balanceUserService{user: user}, nil, nil, "")
+	e.POST("/api/users/:id/coins", srv.AddCoins)
+	e.POST("/api/users/:id/coins/deduct", srv.DeductCoins)
+
+	steps := []struct {
+		path        string
+		coins       int64
+		wantStatus  int
+		wantBalance int64
+	}{
+		{"/coins", 50, http.StatusOK, 150},
+		{"/coins/deduct", 30, http.StatusOK, 120},
+		{"/coins/deduct", 500, http.StatusBadRequest, 120},
+		{"/coins", 1, http.StatusOK, 121},
+		{"/coins/deduct", 121, http.StatusOK, 0},
+	}
+	for _, step := range steps {
+		req := httptest.NewRequest(http.MethodPost, "/api/users/"+userID+step.path, strings.NewReader(fmt.Sprintf(`{"coins": %d}`, step.coins)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		if rec.Code != step.wantStatus {
+			t.Fatalf("%s %d: status %d, want %d: %s", step.path, step.coins, rec.Code, step.wantStatus, rec.Body)
+		}
+		if user.CoinsBalance != step.wantBalance {
+			t.Fatalf("%s %d: balance %d, want %d", step.path, step.coins, user.CoinsBalance, step.wantBalance)
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		var body struct {
+			Balance      int64 `json:"balance"`
+			CoinsBalance int64 `json:"coins_balance"`
+			User         struct {
+				CoinsBalance int64 `json:"coins_balance"`
+			} `json:"user"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if body.Balance != step.wantBalance || body.CoinsBalance != step.wantBalance || body.User.CoinsBalance != step.wantBalance {
+			t.Errorf("%s %d: balance %d, coins_balance %d, user balance %d; want %d in all",
+				step.path, step.coins, body.Balance, body.CoinsBalance, body.User.CoinsBalance, step.wantBalance)
+		}
+	}
+}
+
+func TestProductContentTooLargeIsBadRequest(t *testing.T) {
+	status, msg := handleProductError(&domain.ProductContentTooLargeError{Bytes: 65, MaxBytes: 64})
+	if status != http.StatusBadRequest || !strings.Contains(msg, "65 bytes combined, at most 64 allowed") {
+		t.Errorf("got %d %q, want 400 naming the size and the cap", status, msg)
+	}
+}
+
+// adminActionUserService keeps the admin actions coin additions would
+// record, by the repository's rule: an admin acting on someone else, with a
+// known actor.
+type adminActionUserService struct {
+	UserService
+	actions *[]domain.AdminAction
+}
+
+func (f adminActionUserService) AddCoins(ctx context.Context, userID string, coins int64, reason, idempotencyKey string) (*domain.User, bool, error) {
+	if actor := reqctx.Actor(ctx); actor != "" && actor != userID && reqctx.IsAdmin(ctx) {
+		*f.actions = append([]domain.AdminAction{{
+			ID:      int64(len(*f.actions) + 1),
+			UserID:  userID,
+			Actor:   actor,
+			Action:  domain.AdminActionCoinsAdded,
+			Details: json.RawMessage(fmt.Sprintf(`{"coins":%d}`, coins)),
+		}}, *f.actions...)
+	}
+	return &domain.User{ID: userID, Status: domain.StatusActive}, false, nil
+}
+
+func (f adminActionUserService) ListAdminActions(ctx context.Context, userID string, limit, offset int) (domain.Page[domain.AdminAction], error) {
+	var mine []domain.AdminAction
+	for _, a := range *f.actions {
+		if a.UserID == userID {
+			mine = append(mine, a)
+		}
+	}
+	total := int64(len(mine))
+	mine = mine[min(offset, len(mine)):]
+	return domain.Page[domain.AdminAction]{Items: mine[:min(limit, len(mine))], Total: total, Limit: limit, Offset: offset}, nil
+}
+
+func TestAdminActionsExcludeSelfService(t *testing.T) {
+	const (
+		adminToken = "admin-secret"
+		member     = "0190c2a8-7f1e-7a3b-9c4d-000000000001"
+		operator   = "0190c2a8-7f1e-7a3b-9c4d-000000000002"
+	)
+	var actions []domain.AdminAction
+	principals := StaticTokenPrincipals(map[string]string{AdminRole: "admin-role-token", "support": "support-token"}, adminToken)
+	srv := NewServer(adminActionUserService{actions: &actions}, nil, nil, adminToken)
+
+	// Wired up as in main
+	e := echo.New()
+	e.Use(RequestContext())
+	e.Use(IdentifyAdmin(principals))
+	e.POST("/api/users/:id/coins", srv.AddCoins)
+	e.GET("/api/users/:id/admin-actions", srv.ListAdminActions, RequireAdminToken(adminToken))
+
+	callers := []struct {
+		name       string
+		actor      string
+		header     string
+		wantRecord bool
+	}{
+		{"admin token on another user", operator, AdminTokenHeader + ":" + adminToken, true},
+		{"admin role on another user", operator, RoleTokenHeader + ":Bearer admin-role-token", true},
+		{"admin on themselves", member, AdminTokenHeader + ":" + adminToken, false},
+		{"admin without an actor", "", AdminTokenHeader + ":" + adminToken, false},
+		{"other role on another user", operator, RoleTokenHeader + ":Bearer support-token", false},
+		{"wrong admin token", operator, AdminTokenHeader + ":guess", false},
+		{"self service", member, "", false},
+	}
+	var want []string
+	for i, caller := range callers {
+		req := httptest.NewRequest(http.MethodPost, "/api/users/"+member+"/coins", strings.NewReader(fmt.Sprintf(`{"coins":%d,"reason":"purchase"}`, i+1)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if caller.actor != "" {
+			req.Header.Set(UserIDHeader, caller.actor)
+		}
+		if name, value, ok := strings.Cut(caller.header, ":"); ok {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", caller.name, rec.Code, rec.Body)
+		}
+		if caller.wantRecord {
+			want = append([]string{fmt.Sprintf(`{"coins":%d}`, i+1)}, want...)
+		}
+	}
+
+	list := func(query, token string) (int, Page[domain.AdminAction]) {
+		req := httptest.NewRequest(http.MethodGet, "/api/users/"+member+"/admin-actions"+query, nil)
+		if token != "" {
+			req.Header.Set(AdminTokenHeader, token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		var page Page[domain.AdminAction]
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+				t.Fatalf("decode admin actions: %v", err)
+			}
+		}
+		return rec.Code, page
+	}
+
+	code, page := list("", adminToken)
+	if code != http.StatusOK || page.Total != int64(len(want)) || len(page.Items) != len(want) {
+		t.Fatalf("got %d with %+v, want the %d admin actions", code, page, len(want))
+	}
+	for i, a := range page.Items {
+		if a.Actor != operator || a.Action != domain.AdminActionCoinsAdded || string(a.Details) != want[i] {
+			t.Errorf("action %d: %+v, want %s by %s, newest first", i, a, want[i], operator)
+		}
+	}
+	if code, page := list("?limit=1&offset=1", adminToken); code != http.StatusOK || page.Total != 2 || len(page.Items) != 1 || string(page.Items[0].Details) != want[1] {
+		t.Errorf("second page: got %d with %+v, want the older action", code, page)
+	}
+
+	// Only admins see the list
+	for _, token := range []string{"", "guess"} {
+		if code, _ := list("", token); code != http.StatusForbidden {
+			t.Errorf("token %q: got %d, want 403", token, code)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+	"user-service/internal/config"
+	"user-service/internal/domain"
+	"user-service/internal/jobs"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/labstack/echo/v4"
+)
+
+// LeaderStatus reports whether this instance runs the singleton background workers.
+type LeaderStatus interface {
+	IsLeader() bool
+}
+
+// ConsistencyChecker finds, and optionally repairs, users whose entitlement
+// flags disagree with their end times.
+type ConsistencyChecker interface {
+	Check(ctx context.Context, repair bool) (*domain.EntitlementConsistencyReport, error)
+	ReconcileBatch(ctx context.Context, limit int) (*domain.ReconcileBatchReport, error)
+}
+
+// JobStates reports the saved progress of background jobs.
+type JobStates interface {
+	States(ctx context.Context) ([]jobs.State, error)
+}
+
+type systemServer struct {
+	configHolder *config.Holder
+	leader       LeaderStatus
+	jobs         JobStates
+	consistency  ConsistencyChecker
+}
+
+func NewSystemServer(configHolder *config.Holder, leader LeaderStatus, jobStates JobStates, consistency ConsistencyChecker) *systemServer {
+	return &systemServer{
+		configHolder: configHolder,
+		leader:       leader,
+		jobs:         jobStates,
+		consistency:  consistency,
+	}
+}
+
+func (s *systemServer) Info(c echo.Context) error {
+	hostname, _ := os.Hostname()
+
+	return c.JSON(http.StatusOK, SystemInfoResponse{
+		Hostname: hostname,
+		Leader:   s.leader.IsLeader(),
+	})
+}
+
+// limitsMaxAge is how long clients may cache the limits response.
+const limitsMaxAge = time.Hour
+
+// Limits returns the validation limits so clients don't hardcode them. The
+// configurable ones are read from the current configuration.
+func (s *systemServer) Limits(c echo.Context) error {
+	cfg := s.configHolder.Current()
+
+	c.Response().Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(limitsMaxAge/time.Second)))
+	return c.JSON(http.StatusOK, domain.ValidationLimits(cfg.Validation.MinNameLength, cfg.Catalog.MaxProductsPerCategory, cfg.Catalog.MaxProductContentBytes, cfg.Validation.InvalidInputPolicy, cfg.User.TrialLength))
+}
+
+func (s *systemServer) ReloadConfig(c echo.Context) error {
+	ignored, err := s.configHolder.Reload()
+	if err != nil {
+		// Validation messages name env variables and values, never secrets
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{
+			"error": "configuration rejected: " + err.Error(),
+		})
+	}
+
+	if ignored == nil {
+		ignored = []string{}
+	}
+
+	return c.JSON(http.StatusOK, ReloadConfigResponse{
+		Reloaded:        true,
+		RequiresRestart: ignored,
+	})
+}
+
+// Jobs lists background jobs with their status and progress. State is read
+// from the database, so every replica reports the leader's jobs.
+func (s *systemServer) Jobs(c echo.Context) error {
+	states, err := s.jobs.States(c.Request().Context())
+	if err != nil {
+		log.WithError(err).Error("Failed to list background jobs")
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "internal server error",
+		})
+	}
+
+	return c.JSON(http.StatusOK, JobsResponse{
+		Jobs: states,
+	})
+}
+
+// ConsistencyCheck reports users whose subscription or trial flags disagree
+// with their end times. It is a dry run unless repair=true.
+func (s *systemServer) ConsistencyCheck(c echo.Context) error {
+	repair := false
+	if raw := c.QueryParam("repair"); raw != "" {
+		var err error
+		if repair, err = strconv.ParseBool(raw); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": "repair must be true or false",
+			})
+		}
+	}
+
+	report, err := s.consistency.Check(c.Request().Context(), repair)
+	if err != nil {
+		log.WithError(err).Error("Entitlement consistency check failed")
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "internal server error",
+		})
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// ReconcileBatch fixes one batch of users whose entitlement flags are set
+// although the subscription or trial has ended, for one-off cleanups between
+// expiry sweeps.
+func (s *systemServer) ReconcileBatch(c echo.Context) error {
+	limit := domain.DefaultReconcileBatchSize
+	if raw := c.QueryParam("limit"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 || v > domain.MaxReconcileBatchSize {
+			return c.JSON(http.StatusBadRequest, map[string]string{
+				"error": fmt.Sprintf("limit must be between 1 and %d", domain.MaxReconcileBatchSize),
+			})
+		}
+		limit = v
+	}
+
+	report, err := s.consistency.ReconcileBatch(c.Request().Context(), limit)
+	if err != nil {
+		log.WithError(err).Error("Entitlement reconcile batch failed")
+		return c.JSON(http.StatusInternalServerError, map[string]string{
+			"error": "internal server error",
+		})
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
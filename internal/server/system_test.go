@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+	"user-service/internal/config"
+	"user-service/internal/domain"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestLimitsPublishesValidationConstants(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Validation.MinNameLength = 2
+	cfg.Validation.InvalidInputPolicy = "clamp"
+	cfg.Catalog.MaxProductsPerCategory = 250
+	cfg.Catalog.MaxProductContentBytes = 8192
+	cfg.User.TrialLength = 72 * time.Hour
+
+	e := echo.New()
+	e.GET("/api/system/limits", NewSystemServer(config.NewHolder(cfg, ""), nil, nil, nil).Limits)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/system/limits", nil))
+
+	if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != "public, max-age=3600" {
+		t.Fatalf("got %d with Cache-Control %q, want 200 cacheable for an hour", rec.Code, rec.Header().Get("Cache-Control"))
+	}
+	var got domain.Limits
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode limits: %v", err)
+	}
+	if want := domain.ValidationLimits(2, 250, 8192, "clamp", 72*time.Hour); !reflect.DeepEqual(got, want) {
+		t.Errorf("limits\n got %+v\nwant %+v", got, want)
+	}
+
+	// Spot-check the wire names clients read
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &raw); err != nil {
+		t.Fatalf("decode limits: %v", err)
+	}
+	checks := []struct {
+		group, key string
+		want       float64
+	}{
+		{"user", "max_email_length", domain.MaxEmailLength},
+		{"user", "min_name_length", 2},
+		{"coins", "max_amount", domain.MaxCoinsAmount},
+		{"coins", "max_reason_length", domain.MaxCoinReasonLength},
+		{"list", "max_limit", domain.MaxListLimit},
+		{"product", "max_price_coins", domain.MaxProductPrice},
+		{"product", "max_import_rows", domain.MaxProductImportRows},
+		{"product", "max_per_category", 250},
+		{"category", "max_slug_lookup", domain.MaxCategorySlugLookup},
+		{"report", "max_burn_rate_window_days", domain.MaxBurnRateWindowDays},
+		{"report", "max_product_stats_days", domain.MaxProductStatsDays},
+		{"audit", "max_replay_rate", domain.MaxAuditReplayRate},
+		{"reconcile", "max_batch_size", domain.MaxReconcileBatchSize},
+		{"subscription", "trial_seconds", 72 * 3600},
+	}
+	group := func(name string) map[string]any {
+		var fields map[string]any
+		if err := json.Unmarshal(raw[name], &fields); err != nil {
+			t.Fatalf("decode %s limits: %v", name, err)
+		}
+		return fields
+	}
+	for _, c := range checks {
+		if v, ok := group(c.group)[c.key].(float64); !ok || v != c.want {
+			t.Errorf("%s.%s = %v, want %v", c.group, c.key, group(c.group)[c.key], c.want)
+		}
+	}
+	if got := group("coins")["reason_pattern"]; got != "^[a-z0-9_]+$" {
+		t.Errorf("coins.reason_pattern = %v", got)
+	}
+	if string(raw["max_idempotency_key_length"]) != "255" {
+		t.Errorf("max_idempotency_key_length = %s, want 255", raw["max_idempotency_key_length"])
+	}
+}
+
+// reconcilingChecker reports a batch fixed up to its limit.
+type reconcilingChecker struct {
+	ConsistencyChecker
+	limits *[]int
+}
+
+func (f reconcilingChecker) ReconcileBatch(ctx context.Context, limit int) (*domain.ReconcileBatchReport, error) {
+	*f.limits = append(*f.limits, limit)
+	return &domain.ReconcileBatchReport{Limit: limit, Fixed: 3, More: limit == 3}, nil
+}
+
+func TestReconcileBatchLimit(t *testing.T) {
+	var limits []int
+	e := echo.New()
+	e.POST("/api/admin/users/reconcile-batch", NewSystemServer(config.NewHolder(&config.Config{}, ""), nil, nil, reconcilingChecker{limits: &limits}).ReconcileBatch)
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantLimit  int
+	}{
+		{"", http.StatusOK, domain.DefaultReconcileBatchSize},
+		{"?limit=3", http.StatusOK, 3},
+		{"?limit=5000", http.StatusOK, domain.MaxReconcileBatchSize},
+		{"?limit=5001", http.StatusBadRequest, 0},
+		{"?limit=0", http.StatusBadRequest, 0},
+		{"?limit=-1", http.StatusBadRequest, 0},
+		{"?limit=many", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		limits = nil
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/admin/users/reconcile-batch"+tt.query, nil))
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%q: got %d, want %d", tt.query, rec.Code, tt.wantStatus)
+			continue
+		}
+		if tt.wantStatus != http.StatusOK {
+			if len(limits) != 0 {
+				t.Errorf("%q: rejected limit still ran a batch", tt.query)
+			}
+			continue
+		}
+		var report domain.ReconcileBatchReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatalf("decode report: %v", err)
+		}
+		if len(limits) != 1 || limits[0] != tt.wantLimit || report.Limit != tt.wantLimit || report.Fixed != 3 || report.More != (tt.wantLimit == 3) {
+			t.Errorf("%q: ran %v and reported %+v, want one batch of %d", tt.query, limits, report, tt.wantLimit)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/jobs"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type AccountErasureRepository interface {
+	EraseDueDeletions(ctx context.Context, now time.Time, limit int) ([]string, error)
+}
+
+// AccountErasureJob erases the accounts whose deletion grace period has
+// ended, a batch at a time, and records an event for each. Erasure is
+// decided by the repository's conditional UPDATE, so a cancellation that
+// commits first keeps the account.
+func AccountErasureJob(repo AccountErasureRepository, auditService *AuditService, batchSize int, interval time.Duration) jobs.Job {
+	return jobs.Job{
+		Name:     "account_erasure",
+		Interval: interval,
+		Step: func(ctx context.Context, checkpoint string) (string, int64, bool, error) {
+			erased, err := repo.EraseDueDeletions(ctx, time.Now().UTC(), batchSize)
+			if err != nil {
+				return checkpoint, 0, false, err
+			}
+
+			for _, userID := range erased {
+				log.WithField("user_id", userID).Info("Account erased after deletion grace period")
+				if err := auditService.RecordAccountDeletionEvent(ctx, userID, domain.AuditUserErased, nil); err != nil {
+					log.WithError(err).WithField("user_id", userID).Warn("Failed to record audit event for account erasure")
+				}
+			}
+
+			return "", int64(len(erased)), len(erased) < batchSize, nil
+		},
+	}
+}
@@ -5,38 +5,88 @@ import (
 	"time"
 
 	"user-service/internal/domain"
+	"user-service/internal/metrics"
+	"user-service/internal/pii"
+	"user-service/internal/reqctx"
+
+	"github.com/google/uuid"
 )
 
 type AuditPublisher interface {
 	Publish(ctx context.Context, event domain.AuditEvent) error
 }
 
+// AuditEventSaver keeps events in the local audit store.
+type AuditEventSaver interface {
+	SaveEvent(ctx context.Context, event domain.AuditEvent) error
+}
+
 type AuditService struct {
 	publisher AuditPublisher
+	filter    domain.AuditEventFilter
+	// filteredStore, when set, keeps the events the filter holds back.
+	filteredStore AuditEventSaver
+	// pii, when set, redacts emails and names from event payloads.
+	pii *pii.Cipher
 }
 
 func NewAuditService(publisher AuditPublisher) *AuditService {
 	return &AuditService{publisher: publisher}
 }
 
-func (s *AuditService) RecordUserCreated(ctx context.Context, user *domain.User) error {
+// SetEventFilter holds back the event types filter rejects. They are counted
+// and, when filteredStore is not nil, written only to the local store. It is
+// meant to be called once at startup, before any event is recorded.
+func (s *AuditService) SetEventFilter(filter domain.AuditEventFilter, filteredStore AuditEventSaver) {
+	s.filter = filter
+	s.filteredStore = filteredStore
+}
+
+// SetPIICipher makes events carry the hash of emails instead of the email
+// and no names, as stored events must not undo their encryption at rest. It
+// is meant to be called once at startup, before any event is recorded.
+func (s *AuditService) SetPIICipher(c *pii.Cipher) {
+	s.pii = c
+}
+
+// publish sends event to the publisher unless the event filter holds it back.
+func (s *AuditService) publish(ctx context.Context, event domain.AuditEvent) error {
+	if s.filter.Allows(event.EventType) {
+		return s.publisher.Publish(ctx, event)
+	}
+
+	metrics.AuditEventsFiltered.Add(event.EventType, 1)
+	if s.filteredStore == nil {
+		return nil
+	}
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
+	return s.filteredStore.SaveEvent(ctx, event)
+}
+
+// RecordUserCreated records a new user; signupBonus is the signup grant they
+// received, 0 when it was skipped.
+func (s *AuditService) RecordUserCreated(ctx context.Context, user *domain.User, signupBonus int64) error {
 	if s == nil || s.publisher == nil || user == nil {
 		return nil
 	}
 
 	event := domain.AuditEvent{
 		Service:    "user-service",
-		EventType:  "user_created",
+		EventType:  domain.AuditUserCreated,
 		EntityID:   user.ID,
 		Actor:      user.ID,
 		OccurredAt: time.Now().UTC(),
 		Payload: map[string]interface{}{
-			"email":            user.Email,
-			"name":             user.Name,
-			"coins_balance":    user.CoinsBalance,
-			"is_trial":         user.IsTrial,
-			"has_subscription": user.HasSubscription,
-			"status":           user.Status,
+			"email":                user.Email,
+			"name":                 user.Name,
+			"coins_balance":        user.CoinsBalance,
+			"is_trial":             user.IsTrial,
+			"has_subscription":     user.HasSubscription,
+			"status":               user.Status,
+			"signup_bonus":         signupBonus,
+			"signup_bonus_granted": signupBonus > 0,
 		},
 	}
 
@@ -46,8 +96,9 @@ func (s *AuditService) RecordUserCreated(ctx context.Context, user *domain.User)
 	if user.SubscriptionEndsAt != nil {
 		event.Payload["subscription_ends_at"] = user.SubscriptionEndsAt
 	}
+	event.Payload = s.pii.Redact(event.Payload)
 
-	return s.publisher.Publish(ctx, event)
+	return s.publish(ctx, event)
 }
 
 func (s *AuditService) RecordUserUpdated(ctx context.Context, userID string, changes map[string]interface{}) error {
@@ -57,16 +108,16 @@ func (s *AuditService) RecordUserUpdated(ctx context.Context, userID string, cha
 
 	event := domain.AuditEvent{
 		Service:    "user-service",
-		EventType:  "user_updated",
+		EventType:  domain.AuditUserUpdated,
 		EntityID:   userID,
 		Actor:      userID,
 		OccurredAt: time.Now().UTC(),
 		Payload: map[string]interface{}{
-			"changes": changes,
+			"changes": s.pii.Redact(changes),
 		},
 	}
 
-	return s.publisher.Publish(ctx, event)
+	return s.publish(ctx, event)
 }
 
 func (s *AuditService) RecordCoinsAdded(ctx context.Context, userID string, amount int64) error {
@@ -76,7 +127,7 @@ func (s *AuditService) RecordCoinsAdded(ctx context.Context, userID string, amou
 
 	event := domain.AuditEvent{
 		Service:    "user-service",
-		EventType:  "user_coins_added",
+		EventType:  domain.AuditUserCoinsAdded,
 		EntityID:   userID,
 		Actor:      userID,
 		OccurredAt: time.Now().UTC(),
@@ -85,7 +136,7 @@ func (s *AuditService) RecordCoinsAdded(ctx context.Context, userID string, amou
 		},
 	}
 
-	return s.publisher.Publish(ctx, event)
+	return s.publish(ctx, event)
 }
 
 func (s *AuditService) RecordCoinsDeducted(ctx context.Context, userID string, amount int64) error {
@@ -95,7 +146,7 @@ func (s *AuditService) RecordCoinsDeducted(ctx context.Context, userID string, a
 
 	event := domain.AuditEvent{
 		Service:    "user-service",
-		EventType:  "user_coins_deducted",
+		EventType:  domain.AuditUserCoinsDeducted,
 		EntityID:   userID,
 		Actor:      userID,
 		OccurredAt: time.Now().UTC(),
@@ -104,7 +155,51 @@ func (s *AuditService) RecordCoinsDeducted(ctx context.Context, userID string, a
 		},
 	}
 
-	return s.publisher.Publish(ctx, event)
+	return s.publish(ctx, event)
+}
+
+// RecordCoinsDepleted records that a deduction of amount took the user's
+// balance to zero. It is published alongside the deduction event.
+func (s *AuditService) RecordCoinsDepleted(ctx context.Context, userID string, amount int64) error {
+	if s == nil || s.publisher == nil {
+		return nil
+	}
+
+	event := domain.AuditEvent{
+		Service:    "user-service",
+		EventType:  domain.AuditUserCoinsDepleted,
+		EntityID:   userID,
+		Actor:      userID,
+		OccurredAt: time.Now().UTC(),
+		Payload: map[string]interface{}{
+			"last_deduction": amount,
+			"coins_balance":  0,
+		},
+	}
+
+	return s.publish(ctx, event)
+}
+
+// RecordCoinsTransferred records that amount coins moved from fromID to
+// toID. The sender is the entity of the event.
+func (s *AuditService) RecordCoinsTransferred(ctx context.Context, fromID, toID string, amount int64) error {
+	if s == nil || s.publisher == nil {
+		return nil
+	}
+
+	event := domain.AuditEvent{
+		Service:    "user-service",
+		EventType:  domain.AuditUserCoinsTransferred,
+		EntityID:   fromID,
+		Actor:      fromID,
+		OccurredAt: time.Now().UTC(),
+		Payload: map[string]interface{}{
+			"amount":     amount,
+			"to_user_id": toID,
+		},
+	}
+
+	return s.publish(ctx, event)
 }
 
 func (s *AuditService) RecordSubscriptionEvent(ctx context.Context, userID, eventType string, duration time.Duration, endsAt time.Time) error {
@@ -124,5 +219,173 @@ func (s *AuditService) RecordSubscriptionEvent(ctx context.Context, userID, even
 		},
 	}
 
-	return s.publisher.Publish(ctx, event)
+	return s.publish(ctx, event)
+}
+
+func (s *AuditService) RecordCoinsGranted(ctx context.Context, userID, campaignID string, amount int64, reason string) error {
+	if s == nil || s.publisher == nil {
+		return nil
+	}
+
+	event := domain.AuditEvent{
+		Service:    "user-service",
+		EventType:  domain.AuditUserCoinsGranted,
+		EntityID:   userID,
+		OccurredAt: time.Now().UTC(),
+		Payload: map[string]interface{}{
+			"amount":      amount,
+			"reason":      reason,
+			"campaign_id": campaignID,
+		},
+	}
+
+	return s.publish(ctx, event)
+}
+
+func (s *AuditService) RecordEmailVerificationEvent(ctx context.Context, userID, eventType string) error {
+	if s == nil || s.publisher == nil {
+		return nil
+	}
+
+	event := domain.AuditEvent{
+		Service:    "user-service",
+		EventType:  eventType,
+		EntityID:   userID,
+		Actor:      userID,
+		OccurredAt: time.Now().UTC(),
+		Payload:    map[string]interface{}{},
+	}
+
+	return s.publish(ctx, event)
+}
+
+// RecordAccountDeletionEvent records a step of an account deletion;
+// scheduledFor is set while the erasure is pending.
+func (s *AuditService) RecordAccountDeletionEvent(ctx context.Context, userID, eventType string, scheduledFor *time.Time) error {
+	if s == nil || s.publisher == nil {
+		return nil
+	}
+
+	event := domain.AuditEvent{
+		Service:    "user-service",
+		EventType:  eventType,
+		EntityID:   userID,
+		Actor:      reqctx.Actor(ctx),
+		OccurredAt: time.Now().UTC(),
+		Payload:    map[string]interface{}{},
+	}
+	if scheduledFor != nil {
+		event.Payload["scheduled_for"] = scheduledFor
+	}
+
+	return s.publish(ctx, event)
+}
+
+// RecordEntitlementRepaired records that a consistency check cleared the
+// subscription or trial flag of a user for the given issues.
+func (s *AuditService) RecordEntitlementRepaired(ctx context.Context, userID string, issues []string) error {
+	if s == nil || s.publisher == nil {
+		return nil
+	}
+
+	event := domain.AuditEvent{
+		Service:    "user-service",
+		EventType:  domain.AuditEntitlementRepaired,
+		EntityID:   userID,
+		Actor:      reqctx.Actor(ctx),
+		OccurredAt: time.Now().UTC(),
+		Payload: map[string]interface{}{
+			"issues": issues,
+		},
+	}
+
+	return s.publish(ctx, event)
+}
+
+func (s *AuditService) RecordOrderCompleted(ctx context.Context, order *domain.Order) error {
+	if s == nil || s.publisher == nil || order == nil {
+		return nil
+	}
+
+	items := make([]map[string]interface{}, 0, len(order.Items))
+	for _, item := range order.Items {
+		items = append(items, map[string]interface{}{
+			"product_id":       item.ProductID,
+			"quantity":         item.Quantity,
+			"unit_price_coins": item.UnitPriceCoins,
+		})
+	}
+
+	// Keyed by user so the event is ordered with the user's other balance changes
+	event := domain.AuditEvent{
+		Service:    "user-service",
+		EventType:  domain.AuditOrderCompleted,
+		EntityID:   order.UserID,
+		Actor:      order.UserID,
+		OccurredAt: time.Now().UTC(),
+		Payload: map[string]interface{}{
+			"order_id":    order.ID,
+			"total_coins": order.TotalCoins,
+			"items":       items,
+		},
+	}
+
+	return s.publish(ctx, event)
+}
+
+// RecordProductPurchased records a single product bought through the purchase
+// endpoint. The order it created is recorded separately as order_completed.
+func (s *AuditService) RecordProductPurchased(ctx context.Context, purchase *domain.Purchase) error {
+	if s == nil || s.publisher == nil || purchase == nil {
+		return nil
+	}
+
+	event := domain.AuditEvent{
+		Service:    "user-service",
+		EventType:  domain.AuditProductPurchased,
+		EntityID:   purchase.UserID,
+		Actor:      purchase.UserID,
+		OccurredAt: time.Now().UTC(),
+		Payload: map[string]interface{}{
+			"purchase_id": purchase.ID,
+			"order_id":    purchase.OrderID,
+			"product_id":  purchase.ProductID,
+			"price_coins": purchase.PriceCoins,
+		},
+	}
+
+	return s.publish(ctx, event)
+}
+
+func (s *AuditService) RecordOrderRefunded(ctx context.Context, refund *domain.OrderRefund) error {
+	if s == nil || s.publisher == nil || refund == nil {
+		return nil
+	}
+
+	items := make([]map[string]interface{}, 0, len(refund.Items))
+	for _, item := range refund.Items {
+		items = append(items, map[string]interface{}{
+			"order_item_id":    item.ID,
+			"product_id":       item.ProductID,
+			"quantity":         item.Quantity,
+			"unit_price_coins": item.UnitPriceCoins,
+			"total_coins":      item.TotalCoins,
+		})
+	}
+
+	event := domain.AuditEvent{
+		Service:    "user-service",
+		EventType:  domain.AuditOrderRefunded,
+		EntityID:   refund.UserID,
+		OccurredAt: time.Now().UTC(),
+		Payload: map[string]interface{}{
+			"order_id":     refund.OrderID,
+			"refund_id":    refund.ID,
+			"amount_coins": refund.AmountCoins,
+			"order_status": refund.OrderStatus,
+			"items":        items,
+		},
+	}
+
+	return s.publish(ctx, event)
 }
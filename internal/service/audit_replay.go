@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+	"user-service/internal/domain"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// auditReplayBatchSize is how many stored events are read per query.
+	auditReplayBatchSize = 200
+	// maxReplayFailedIDs caps the failed event IDs kept in the replay status.
+	maxReplayFailedIDs = 100
+	// auditReplayPublishTimeout bounds a single re-publish.
+	auditReplayPublishTimeout = 15 * time.Second
+)
+
+type AuditEventStore interface {
+	ListEvents(ctx context.Context, from, to time.Time, eventType string, afterOccurredAt time.Time, afterID string, limit int) ([]domain.AuditEvent, error)
+}
+
+// ReplayPublisher re-publishes a stored event without changing its ID or OccurredAt.
+type ReplayPublisher interface {
+	Replay(ctx context.Context, event domain.AuditEvent) error
+}
+
+// auditReplayService re-publishes stored audit events in the background, one
+// replay at a time, throttled to the requested rate.
+type auditReplayService struct {
+	store  AuditEventStore
+	target ReplayPublisher
+	// filter keeps a replay from publishing events that were held back.
+	filter domain.AuditEventFilter
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	status *domain.AuditReplayStatus
+}
+
+// NewAuditReplayService replays into target; a nil target disables replay.
+func NewAuditReplayService(store AuditEventStore, target ReplayPublisher) *auditReplayService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &auditReplayService{
+		store:  store,
+		target: target,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// SetEventFilter makes replays skip the event types filter rejects. It is
+// meant to be called once at startup.
+func (s *auditReplayService) SetEventFilter(filter domain.AuditEventFilter) {
+	s.filter = filter
+}
+
+// StartReplay validates req and starts replaying in the background. Only one
+// replay runs at a time; progress is reported by ReplayStatus.
+func (s *auditReplayService) StartReplay(req domain.AuditReplayRequest) (*domain.AuditReplayStatus, error) {
+	if req.RatePerSecond == 0 {
+		req.RatePerSecond = domain.DefaultAuditReplayRate
+	}
+	if err := domain.ValidateAuditReplayRequest(req); err != nil {
+		return nil, err
+	}
+
+	if s.target == nil {
+		return nil, domain.ErrReplayUnavailable
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.status != nil && s.status.Running {
+		return nil, domain.ErrReplayInProgress
+	}
+	if s.ctx.Err() != nil {
+		return nil, s.ctx.Err()
+	}
+
+	s.status = &domain.AuditReplayStatus{
+		Request:   req,
+		Running:   true,
+		StartedAt: time.Now().UTC(),
+	}
+	status := s.snapshot()
+
+	s.wg.Go(func() { s.run(req) })
+
+	log.WithFields(log.Fields{
+		"from":            req.From,
+		"to":              req.To,
+		"event_type":      req.EventType,
+		"rate_per_second": req.RatePerSecond,
+	}).Info("Audit replay started")
+
+	return status, nil
+}
+
+// ReplayStatus returns the progress of the running or last replay, or nil if
+// none has been started.
+func (s *auditReplayService) ReplayStatus() *domain.AuditReplayStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot()
+}
+
+// Close stops a running replay and waits for it to finish.
+func (s *auditReplayService) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// snapshot copies the status; callers hold mu.
+func (s *auditReplayService) snapshot() *domain.AuditReplayStatus {
+	if s.status == nil {
+		return nil
+	}
+	status := *s.status
+	status.FailedIDs = append([]string(nil), s.status.FailedIDs...)
+	return &status
+}
+
+func (s *auditReplayService) run(req domain.AuditReplayRequest) {
+	ticker := time.NewTicker(time.Second / time.Duration(req.RatePerSecond))
+	defer ticker.Stop()
+
+	var afterOccurredAt time.Time
+	var afterID string
+	err := func() error {
+		for {
+			events, err := s.store.ListEvents(s.ctx, req.From, req.To, req.EventType, afterOccurredAt, afterID, auditReplayBatchSize)
+			if err != nil {
+				return err
+			}
+			if len(events) == 0 {
+				return nil
+			}
+
+			for _, event := range events {
+				if !s.filter.Allows(event.EventType) {
+					s.mu.Lock()
+					s.status.Skipped++
+					s.mu.Unlock()
+					continue
+				}
+				select {
+				case <-ticker.C:
+				case <-s.ctx.Done():
+					return s.ctx.Err()
+				}
+				s.replayOne(event)
+			}
+
+			last := events[len(events)-1]
+			afterOccurredAt, afterID = last.OccurredAt, last.ID
+
+			progress := s.ReplayStatus()
+			log.WithFields(log.Fields{
+				"published":   progress.Published,
+				"failed":      progress.Failed,
+				"occurred_at": afterOccurredAt,
+			}).Info("Audit replay progress")
+		}
+	}()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	s.status.Running = false
+	s.status.FinishedAt = &now
+	if err != nil {
+		s.status.Error = err.Error()
+	}
+
+	entry := log.WithFields(log.Fields{
+		"published": s.status.Published,
+		"failed":    s.status.Failed,
+	})
+	if err != nil {
+		entry.WithError(err).Error("Audit replay stopped")
+	} else {
+		entry.Info("Audit replay finished")
+	}
+}
+
+func (s *auditReplayService) replayOne(event domain.AuditEvent) {
+	ctx, cancel := context.WithTimeout(s.ctx, auditReplayPublishTimeout)
+	err := s.target.Replay(ctx, event)
+	cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.status.Published++
+		return
+	}
+
+	log.WithError(err).WithFields(log.Fields{
+		"event_id":   event.ID,
+		"event_type": event.EventType,
+	}).Warn("Failed to replay audit event")
+	s.status.Failed++
+	if len(s.status.FailedIDs) < maxReplayFailedIDs {
+		s.status.FailedIDs = append(s.status.FailedIDs, event.ID)
+	}
+}
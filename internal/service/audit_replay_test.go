@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+	"user-service/internal/domain"
+)
+
+// fakeAuditStore pages through its events by (OccurredAt, ID) as the
+// audit_events query does.
+type fakeAuditStore struct {
+	events []domain.AuditEvent
+	pages  int
+}
+
+func (f *fakeAuditStore) ListEvents(ctx context.Context, from, to time.Time, eventType string, afterOccurredAt time.Time, afterID string, limit int) ([]domain.AuditEvent, error) {
+	f.pages++
+	var page []domain.AuditEvent
+	for _, e := range f.events {
+		if e.OccurredAt.Before(from) || !e.OccurredAt.Before(to) || (eventType != "" && e.EventType != eventType) {
+			continue
+		}
+		if !afterOccurredAt.IsZero() && (e.OccurredAt.Before(afterOccurredAt) || e.OccurredAt.Equal(afterOccurredAt) && e.ID <= afterID) {
+			continue
+		}
+		if len(page) == limit {
+			break
+		}
+		page = append(page, e)
+	}
+	return page, nil
+}
+
+// capturingReplayPublisher records what it is asked to publish and when.
+// Only Replay marks messages as replayed, so everything must come through it.
+type capturingReplayPublisher struct {
+	fail map[string]bool
+
+	mu        sync.Mutex
+	replayed  []domain.AuditEvent
+	at        []time.Time
+	published int
+}
+
+func (c *capturingReplayPublisher) Replay(ctx context.Context, event domain.AuditEvent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.replayed = append(c.replayed, event)
+	c.at = append(c.at, time.Now())
+	if c.fail[event.ID] {
+		return errors.New("broker unreachable")
+	}
+	return nil
+}
+
+func (c *capturingReplayPublisher) Publish(ctx context.Context, event domain.AuditEvent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published++
+	return nil
+}
+
+// storedEvents returns n events a minute apart from start, cycling through types.
+func storedEvents(start time.Time, n int, types ...string) []domain.AuditEvent {
+	events := make([]domain.AuditEvent, n)
+	for i := range events {
+		events[i] = domain.AuditEvent{
+			ID:         fmt.Sprintf("0190c2a8-7f1e-7a3b-9c4d-%012d", i),
+			EventType:  types[i%len(types)],
+			EntityID:   fmt.Sprintf("user-%d", i%7),
+			OccurredAt: start.Add(time.Duration(i) * time.Minute),
+		}
+	}
+	return events
+}
+
+// waitForReplay polls the replay status until it stops running.
+func waitForReplay(t *testing.T, s *auditReplayService) *domain.AuditReplayStatus {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		status := s.ReplayStatus()
+		if !status.Running {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("replay still running: %+v", status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReplayKeepsEventsAndUsesReplayPath(t *testing.T) {
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	store := &fakeAuditStore{events: storedEvents(start, 2*auditReplayBatchSize+50, domain.AuditUserCreated, domain.AuditUserCoinsAdded)}
+	target := &capturingReplayPublisher{fail: map[string]bool{store.events[3].ID: true}}
+	s := NewAuditReplayService(store, target)
+	defer s.Close()
+
+	// The last ten events fall outside the range
+	to := start.Add(time.Duration(len(store.events)-10) * time.Minute)
+	if _, err := s.StartReplay(domain.AuditReplayRequest{From: start, To: to, RatePerSecond: domain.MaxAuditReplayRate}); err != nil {
+		t.Fatalf("StartReplay: %v", err)
+	}
+	status := waitForReplay(t, s)
+
+	want := len(store.events) - 10
+	if status.Published != int64(want-1) || status.Failed != 1 || status.Error != "" {
+		t.Errorf("published %d, failed %d, error %q; want %d, 1 and none", status.Published, status.Failed, status.Error, want-1)
+	}
+	if len(status.FailedIDs) != 1 || status.FailedIDs[0] != store.events[3].ID {
+		t.Errorf("failed IDs %v, want [%s]", status.FailedIDs, store.events[3].ID)
+	}
+	if target.published != 0 {
+		t.Errorf("%d events published without the replayed header", target.published)
+	}
+	if len(target.replayed) != want {
+		t.Fatalf("%d events replayed, want %d", len(target.replayed), want)
+	}
+	// Consumers dedupe on ID, so every event goes out as it was stored
+	for i, got := range target.replayed {
+		if stored := store.events[i]; got.ID != stored.ID || !got.OccurredAt.Equal(stored.OccurredAt) || got.EventType != stored.EventType {
+			t.Fatalf("replay %d: %s %s at %v, want %s %s at %v",
+				i, got.ID, got.EventType, got.OccurredAt, stored.ID, stored.EventType, stored.OccurredAt)
+		}
+	}
+	// Two full pages, a short one and the empty one that ends the replay
+	if store.pages != 4 {
+		t.Errorf("read %d pages, want 4 for %d events in pages of %d", store.pages, want, auditReplayBatchSize)
+	}
+}
+
+func TestReplayIsThrottled(t *testing.T) {
+	const rate, events = 50, 11
+	interval := time.Second / rate
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	store := &fakeAuditStore{events: storedEvents(start, events, domain.AuditUserCreated)}
+	target := &capturingReplayPublisher{}
+	s := NewAuditReplayService(store, target)
+	defer s.Close()
+
+	began := time.Now()
+	if _, err := s.StartReplay(domain.AuditReplayRequest{From: start, To: start.Add(time.Hour), RatePerSecond: rate}); err != nil {
+		t.Fatalf("StartReplay: %v", err)
+	}
+	waitForReplay(t, s)
+
+	if len(target.at) != events {
+		t.Fatalf("%d events replayed, want %d", len(target.at), events)
+	}
+	// Each event waits for a tick, so none goes out before its slot
+	for i, at := range target.at {
+		if earliest := time.Duration(i+1) * interval; at.Sub(began) < earliest-interval/2 {
+			t.Errorf("event %d replayed after %v, want no sooner than %v", i, at.Sub(began), earliest)
+		}
+	}
+}
+
+func TestReplaySkipsFilteredTypesAndRunsOneAtATime(t *testing.T) {
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	store := &fakeAuditStore{events: storedEvents(start, 30, domain.AuditUserCreated, domain.AuditUserCoinsAdded, domain.AuditUserUpdated)}
+	target := &capturingReplayPublisher{}
+	s := NewAuditReplayService(store, target)
+	s.SetEventFilter(domain.NewAuditEventFilter(nil, []string{domain.AuditUserUpdated}))
+	defer s.Close()
+
+	req := domain.AuditReplayRequest{From: start, To: start.Add(time.Hour), RatePerSecond: 100}
+	if _, err := s.StartReplay(req); err != nil {
+		t.Fatalf("StartReplay: %v", err)
+	}
+	if _, err := s.StartReplay(req); err != domain.ErrReplayInProgress {
+		t.Errorf("second StartReplay: got %v, want ErrReplayInProgress", err)
+	}
+	status := waitForReplay(t, s)
+
+	if status.Published != 20 || status.Skipped != 10 {
+		t.Errorf("published %d, skipped %d; want 20 and 10", status.Published, status.Skipped)
+	}
+	for _, e := range target.replayed {
+		if e.EventType == domain.AuditUserUpdated {
+			t.Fatalf("filtered event %s replayed", e.ID)
+		}
+	}
+
+	// Only the requested type is replayed
+	target.replayed = nil
+	req.EventType = domain.AuditUserCreated
+	if _, err := s.StartReplay(req); err != nil {
+		t.Fatalf("StartReplay by type: %v", err)
+	}
+	if status := waitForReplay(t, s); status.Published != 10 {
+		t.Errorf("replayed %d events of one type, want 10", status.Published)
+	}
+}
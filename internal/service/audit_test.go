@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/publisher"
+)
+
+// gatedPublisher holds every delivery until release is closed, as a
+// backed-up broker would, and keeps what it delivered.
+type gatedPublisher struct {
+	release chan struct{}
+
+	mu        sync.Mutex
+	delivered []domain.AuditEvent
+}
+
+func (g *gatedPublisher) Publish(ctx context.Context, event domain.AuditEvent) error {
+	<-g.release
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.delivered = append(g.delivered, event)
+	return nil
+}
+
+func TestOccurredAtSurvivesAsyncPublishing(t *testing.T) {
+	const userID = "0190c2a8-7f1e-7a3b-9c4d-000000000001"
+	sink := &gatedPublisher{release: make(chan struct{})}
+	async := publisher.NewAsyncAuditPublisher(sink, 2, 8)
+	audit := NewAuditService(async)
+	ctx := context.Background()
+
+	before := time.Now().UTC()
+	if err := audit.RecordCoinsAdded(ctx, userID, 10); err != nil {
+		t.Fatalf("RecordCoinsAdded: %v", err)
+	}
+	if err := audit.RecordCoinsDeducted(ctx, userID, 5); err != nil {
+		t.Fatalf("RecordCoinsDeducted: %v", err)
+	}
+	recorded := time.Now().UTC()
+
+	// Deliver well after the actions completed
+	time.Sleep(50 * time.Millisecond)
+	close(sink.release)
+	async.Close()
+
+	if len(sink.delivered) != 2 {
+		t.Fatalf("%d events delivered, want 2", len(sink.delivered))
+	}
+	for _, event := range sink.delivered {
+		if event.OccurredAt.Before(before) || event.OccurredAt.After(recorded) {
+			t.Errorf("%s occurred at %v, want the time it was recorded, between %v and %v",
+				event.EventType, event.OccurredAt, before, recorded)
+		}
+	}
+	if sink.delivered[1].OccurredAt.Before(sink.delivered[0].OccurredAt) {
+		t.Errorf("events of one user delivered with decreasing times %v, %v", sink.delivered[0].OccurredAt, sink.delivered[1].OccurredAt)
+	}
+}
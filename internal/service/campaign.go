@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/semaphore"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// batchRetryAttempts is how many times a failing grant batch is retried before
+// its users are counted as failed and the campaign moves on.
+const batchRetryAttempts = 3
+
+type CampaignRepository interface {
+	CountMatchingUsers(ctx context.Context, filter domain.CoinCampaignFilter) (int64, error)
+	Create(ctx context.Context, campaign *domain.CoinCampaign) error
+	GetByID(ctx context.Context, id string) (*domain.CoinCampaign, error)
+	ListByStatus(ctx context.Context, status string) ([]domain.CoinCampaign, error)
+	NextBatch(ctx context.Context, campaign *domain.CoinCampaign, limit int) ([]string, error)
+	GrantBatch(ctx context.Context, campaign *domain.CoinCampaign, userIDs []string) ([]string, error)
+	SkipBatch(ctx context.Context, campaign *domain.CoinCampaign, userIDs []string) error
+	MarkCompleted(ctx context.Context, id string) error
+}
+
+// campaignService runs coin grant campaigns as background jobs. Progress is
+// persisted after every batch so a campaign interrupted by shutdown or a crash
+// resumes from its cursor on the next Start. Jobs only run between Start and
+// the cancellation of its context; campaigns created on an instance that isn't
+// running jobs are picked up by the next Start on the one that is.
+type campaignService struct {
+	campaignRepo CampaignRepository
+	auditService *AuditService
+	batchSize    atomic.Int64
+	// heavyOps bounds the pool connections held by campaign batches; nil
+	// leaves them unbounded.
+	heavyOps *semaphore.Weighted
+	// retryDelay times the attempt number is how long a failing batch waits
+	// before its next attempt.
+	retryDelay time.Duration
+
+	mu      sync.Mutex
+	jobsCtx context.Context
+	running map[string]bool
+	wg      sync.WaitGroup
+}
+
+func NewCampaignService(campaignRepo CampaignRepository, auditService *AuditService, batchSize int) *campaignService {
+	s := &campaignService{
+		campaignRepo: campaignRepo,
+		auditService: auditService,
+		retryDelay:   time.Second,
+		running:      make(map[string]bool),
+	}
+	s.SetBatchSize(batchSize)
+	return s
+}
+
+// SetHeavyOps makes every campaign batch hold a connection of heavyOps
+// while it is loaded and granted. It is meant to be called once at startup,
+// before Start.
+func (s *campaignService) SetHeavyOps(heavyOps *semaphore.Weighted) {
+	s.heavyOps = heavyOps
+}
+
+// SetBatchSize changes the number of users granted per transaction. Running
+// campaigns pick it up from their next batch.
+func (s *campaignService) SetBatchSize(batchSize int) {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	s.batchSize.Store(int64(batchSize))
+}
+
+// Start launches every running campaign that isn't already being processed,
+// including ones left over from a previous process. Jobs run until they finish
+// or ctx is cancelled. Start may be called repeatedly to pick up new campaigns.
+func (s *campaignService) Start(ctx context.Context) error {
+	s.mu.Lock()
+	s.jobsCtx = ctx
+	s.mu.Unlock()
+
+	campaigns, err := s.campaignRepo.ListByStatus(ctx, domain.CampaignStatusRunning)
+	if err != nil {
+		return err
+	}
+
+	for i := range campaigns {
+		if s.launch(&campaigns[i]) {
+			log.WithFields(log.Fields{
+				"campaign_id": campaigns[i].ID,
+				"processed":   campaigns[i].Processed,
+				"total":       campaigns[i].Total,
+			}).Info("Resuming coin grant campaign")
+		}
+	}
+
+	return nil
+}
+
+// Wait blocks until all running campaign jobs have returned.
+func (s *campaignService) Wait() {
+	s.wg.Wait()
+}
+
+func (s *campaignService) CreateCoinGrant(ctx context.Context, req domain.CreateCoinCampaignRequest) (*domain.CoinCampaign, error) {
+	if req.Amount <= 0 {
+		return nil, domain.ErrInvalidCoinsAmount
+	}
+	if req.Amount > domain.MaxCoinsAmount {
+		return nil, domain.ErrCoinsAmountTooLarge
+	}
+	if err := domain.ValidateCampaignReason(req.Reason); err != nil {
+		return nil, err
+	}
+	if req.Filter.Status != nil {
+		if err := ValidateStatus(*req.Filter.Status); err != nil {
+			return nil, err
+		}
+	}
+	if err := domain.ValidateCampaignFilter(req.Filter); err != nil {
+		return nil, err
+	}
+
+	// Pin the cohort to users that exist now so sign-ups during a long run
+	// don't change the total.
+	filter := req.Filter
+	if filter.CreatedBefore == nil {
+		now := time.Now().UTC()
+		filter.CreatedBefore = &now
+	}
+
+	total, err := s.campaignRepo.CountMatchingUsers(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	campaign := &domain.CoinCampaign{
+		ID:     uuid.New().String(),
+		Filter: filter,
+		Amount: req.Amount,
+		Reason: req.Reason,
+		Status: domain.CampaignStatusRunning,
+		Total:  total,
+	}
+
+	if err := s.campaignRepo.Create(ctx, campaign); err != nil {
+		log.WithError(err).Error("Failed to create coin grant campaign")
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"campaign_id": campaign.ID,
+		"amount":      campaign.Amount,
+		"total":       campaign.Total,
+	}).Info("Coin grant campaign created")
+
+	job := *campaign
+	if !s.launch(&job) {
+		log.WithField("campaign_id", campaign.ID).Info("Campaign queued for the worker leader")
+	}
+
+	return campaign, nil
+}
+
+func (s *campaignService) GetCampaign(ctx context.Context, id string) (*domain.CoinCampaign, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, domain.ErrInvalidUUID
+	}
+
+	return s.campaignRepo.GetByID(ctx, id)
+}
+
+// launch starts a job for campaign unless one is already running or this
+// instance isn't running jobs. It reports whether a job was started.
+func (s *campaignService) launch(campaign *domain.CoinCampaign) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx := s.jobsCtx
+	if ctx == nil || ctx.Err() != nil || s.running[campaign.ID] {
+		return false
+	}
+	s.running[campaign.ID] = true
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.running, campaign.ID)
+			s.mu.Unlock()
+		}()
+		s.run(ctx, campaign)
+	}()
+	return true
+}
+
+func (s *campaignService) run(ctx context.Context, campaign *domain.CoinCampaign) {
+	logger := log.WithField("campaign_id", campaign.ID)
+
+	for {
+		if ctx.Err() != nil {
+			logger.WithField("processed", campaign.Processed).Info("Coin grant campaign paused")
+			return
+		}
+
+		if err := s.heavyOps.Acquire(ctx, 1); err != nil {
+			continue
+		}
+		userIDs, err := s.campaignRepo.NextBatch(ctx, campaign, int(s.batchSize.Load()))
+		if err != nil {
+			s.heavyOps.Release(1)
+			logger.WithError(err).Error("Failed to load campaign batch, campaign will resume on next start")
+			return
+		}
+		if len(userIDs) == 0 {
+			s.heavyOps.Release(1)
+			break
+		}
+
+		granted, err := s.grantWithRetry(ctx, campaign, userIDs)
+		s.heavyOps.Release(1)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+			logger.WithError(err).WithField("batch_size", len(userIDs)).Error("Campaign batch failed, skipping")
+			if err := s.campaignRepo.SkipBatch(ctx, campaign, userIDs); err != nil {
+				logger.WithError(err).Error("Failed to record skipped campaign batch, campaign will resume on next start")
+				return
+			}
+			continue
+		}
+
+		for _, userID := range granted {
+			if err := s.auditService.RecordCoinsGranted(ctx, userID, campaign.ID, campaign.Amount, campaign.Reason); err != nil {
+				logger.WithError(err).WithField("user_id", userID).Warn("Failed to record audit event for campaign grant")
+			}
+		}
+
+		logger.WithFields(log.Fields{
+			"processed": campaign.Processed,
+			"total":     campaign.Total,
+		}).Info("Campaign batch granted")
+	}
+
+	if err := s.campaignRepo.MarkCompleted(ctx, campaign.ID); err != nil {
+		logger.WithError(err).Error("Failed to mark campaign completed")
+		return
+	}
+
+	logger.WithFields(log.Fields{
+		"processed": campaign.Processed,
+		"failed":    campaign.Failed,
+	}).Info("Coin grant campaign completed")
+}
+
+func (s *campaignService) grantWithRetry(ctx context.Context, campaign *domain.CoinCampaign, userIDs []string) ([]string, error) {
+	var err error
+	for attempt := 1; attempt <= batchRetryAttempts; attempt++ {
+		var granted []string
+		granted, err = s.campaignRepo.GrantBatch(ctx, campaign, userIDs)
+		if err == nil {
+			return granted, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Duration(attempt) * s.retryDelay):
+		}
+	}
+	return nil, err
+}
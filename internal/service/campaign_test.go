@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+	"user-service/internal/domain"
+)
+
+// fakeCampaignRepo keeps one campaign and its grants as the database would:
+// a batch's grants and cursor move together or not at all, and a restart
+// sees only what was committed.
+type fakeCampaignRepo struct {
+	mu       sync.Mutex
+	users    []string
+	stored   domain.CoinCampaign
+	credits  map[string]int
+	attempts map[string]int
+	// grant, when set, runs before a batch commits and returns an error to
+	// fail the batch without committing it.
+	grant func(userIDs []string) error
+}
+
+func (f *fakeCampaignRepo) CountMatchingUsers(ctx context.Context, filter domain.CoinCampaignFilter) (int64, error) {
+	return int64(len(f.users)), nil
+}
+
+func (f *fakeCampaignRepo) Create(ctx context.Context, campaign *domain.CoinCampaign) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stored = *campaign
+	return nil
+}
+
+func (f *fakeCampaignRepo) GetByID(ctx context.Context, id string) (*domain.CoinCampaign, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored := f.stored
+	return &stored, nil
+}
+
+func (f *fakeCampaignRepo) ListByStatus(ctx context.Context, status string) ([]domain.CoinCampaign, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stored.Status != status {
+		return nil, nil
+	}
+	return []domain.CoinCampaign{f.stored}, nil
+}
+
+func (f *fakeCampaignRepo) NextBatch(ctx context.Context, campaign *domain.CoinCampaign, limit int) ([]string, error) {
+	var batch []string
+	for _, id := range f.users {
+		if campaign.LastUserID != nil && id <= *campaign.LastUserID {
+			continue
+		}
+		if len(batch) == limit {
+			break
+		}
+		batch = append(batch, id)
+	}
+	return batch, nil
+}
+
+func (f *fakeCampaignRepo) GrantBatch(ctx context.Context, campaign *domain.CoinCampaign, userIDs []string) ([]string, error) {
+	f.mu.Lock()
+	for _, id := range userIDs {
+		f.attempts[id]++
+	}
+	f.mu.Unlock()
+	if f.grant != nil {
+		if err := f.grant(userIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, id := range userIDs {
+		f.credits[id]++
+	}
+	last := userIDs[len(userIDs)-1]
+	f.stored.Processed += int64(len(userIDs))
+	f.stored.LastUserID = &last
+	campaign.Processed, campaign.LastUserID = f.stored.Processed, f.stored.LastUserID
+	return userIDs, nil
+}
+
+func (f *fakeCampaignRepo) SkipBatch(ctx context.Context, campaign *domain.CoinCampaign, userIDs []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	last := userIDs[len(userIDs)-1]
+	f.stored.Processed += int64(len(userIDs))
+	f.stored.Failed += int64(len(userIDs))
+	f.stored.LastUserID = &last
+	campaign.Processed, campaign.Failed, campaign.LastUserID = f.stored.Processed, f.stored.Failed, f.stored.LastUserID
+	return nil
+}
+
+func (f *fakeCampaignRepo) MarkCompleted(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stored.Status = domain.CampaignStatusCompleted
+	return nil
+}
+
+func TestCampaignResumesAfterKill(t *testing.T) {
+	repo := &fakeCampaignRepo{credits: map[string]int{}, attempts: map[string]int{}}
+	for i := 0; i < 9; i++ {
+		repo.users = append(repo.users, fmt.Sprintf("0190c2a8-7f1e-7a3b-9c4d-%012d", i))
+	}
+	batches := [][]string{repo.users[0:2], repo.users[2:4], repo.users[4:6], repo.users[6:8], repo.users[8:9]}
+	failing := batches[2]
+
+	// The first process is killed while its second batch is in flight, so
+	// that batch never commits
+	ctx, kill := context.WithCancel(context.Background())
+	defer kill()
+	repo.grant = func(userIDs []string) error {
+		if userIDs[0] == batches[1][0] {
+			kill()
+			return context.Canceled
+		}
+		return nil
+	}
+	sink := &capturingPublisher{}
+	first := NewCampaignService(repo, NewAuditService(sink), 2)
+	if err := first.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	campaign, err := first.CreateCoinGrant(ctx, domain.CreateCoinCampaignRequest{Amount: 25, Reason: "spring promo"})
+	if err != nil {
+		t.Fatalf("CreateCoinGrant: %v", err)
+	}
+	first.Wait()
+
+	paused, _ := repo.GetByID(context.Background(), campaign.ID)
+	if paused.Status != domain.CampaignStatusRunning || paused.Processed != 2 || paused.Failed != 0 || *paused.LastUserID != batches[0][1] {
+		t.Fatalf("after the kill: %+v, want the first batch committed and still running", paused)
+	}
+
+	// The next process resumes from the cursor; one batch keeps failing and
+	// is skipped once its retries run out
+	repo.grant = func(userIDs []string) error {
+		if userIDs[0] == failing[0] {
+			return errors.New("deadlock detected")
+		}
+		return nil
+	}
+	second := NewCampaignService(repo, NewAuditService(sink), 2)
+	second.retryDelay = time.Millisecond
+	if err := second.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	second.Wait()
+
+	done, _ := repo.GetByID(context.Background(), campaign.ID)
+	if done.Status != domain.CampaignStatusCompleted || done.Processed != int64(len(repo.users)) || done.Failed != int64(len(failing)) {
+		t.Errorf("after the resume: %+v, want all %d processed and %d failed", done, len(repo.users), len(failing))
+	}
+
+	// Nobody is granted twice, and the committed batch is not sent again
+	for _, id := range repo.users {
+		want := 1
+		if id == failing[0] || id == failing[1] {
+			want = 0
+		}
+		if repo.credits[id] != want {
+			t.Errorf("%s credited %d times, want %d", id, repo.credits[id], want)
+		}
+	}
+	for _, id := range batches[0] {
+		if repo.attempts[id] != 1 {
+			t.Errorf("%s of the committed batch sent %d times, want once", id, repo.attempts[id])
+		}
+	}
+	for _, id := range batches[1] {
+		if repo.attempts[id] != 2 {
+			t.Errorf("%s of the interrupted batch sent %d times, want twice", id, repo.attempts[id])
+		}
+	}
+	for _, id := range failing {
+		if repo.attempts[id] != batchRetryAttempts {
+			t.Errorf("%s of the failing batch sent %d times, want %d", id, repo.attempts[id], batchRetryAttempts)
+		}
+	}
+
+	// One grant event per credited user
+	var audited []string
+	for _, event := range sink.events {
+		audited = append(audited, event.EntityID)
+	}
+	sort.Strings(audited)
+	var wantAudited []string
+	for _, id := range repo.users {
+		if repo.credits[id] == 1 {
+			wantAudited = append(wantAudited, id)
+		}
+	}
+	if fmt.Sprint(audited) != fmt.Sprint(wantAudited) {
+		t.Errorf("audited %v, want %v", audited, wantAudited)
+	}
+}
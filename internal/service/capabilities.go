@@ -0,0 +1,78 @@
+package service
+
+import "user-service/internal/domain"
+
+// capabilityRequirement is one condition of a capability rule. reason is
+// reported when it is the first unmet condition.
+type capabilityRequirement struct {
+	met    func(d *domain.AccessDecision, user *domain.User) bool
+	reason string
+}
+
+var (
+	requireActiveUser = capabilityRequirement{
+		met:    func(d *domain.AccessDecision, _ *domain.User) bool { return d.Status.Passed },
+		reason: domain.AccessReasonUserNotActive,
+	}
+	requireVerifiedEmail = capabilityRequirement{
+		met:    func(d *domain.AccessDecision, _ *domain.User) bool { return d.EmailVerification.Passed },
+		reason: domain.AccessReasonEmailNotVerified,
+	}
+	requireSubscriptionOrTrial = capabilityRequirement{
+		met:    func(d *domain.AccessDecision, _ *domain.User) bool { return d.Subscription.Active || d.Trial.Active },
+		reason: domain.AccessReasonNoEntitlement,
+	}
+	requireSubscription = capabilityRequirement{
+		met:    func(d *domain.AccessDecision, _ *domain.User) bool { return d.Subscription.Active },
+		reason: domain.AccessReasonNoSubscription,
+	}
+	requireCoins = capabilityRequirement{
+		met:    func(_ *domain.AccessDecision, user *domain.User) bool { return user.CoinsBalance > 0 },
+		reason: domain.AccessReasonNoCoins,
+	}
+)
+
+// capabilityRules is the table of capabilities and what each requires, in
+// the order its requirements are checked.
+var capabilityRules = []struct {
+	name     string
+	grant    func(c *domain.Capabilities)
+	requires []capabilityRequirement
+}{
+	{
+		name:     domain.CapabilityRead,
+		grant:    func(c *domain.Capabilities) { c.CanRead = true },
+		requires: []capabilityRequirement{requireActiveUser, requireVerifiedEmail, requireSubscriptionOrTrial},
+	},
+	{
+		name:     domain.CapabilityCreate,
+		grant:    func(c *domain.Capabilities) { c.CanCreate = true },
+		requires: []capabilityRequirement{requireActiveUser, requireVerifiedEmail, requireSubscription},
+	},
+	{
+		name:     domain.CapabilityPurchase,
+		grant:    func(c *domain.Capabilities) { c.CanPurchase = true },
+		requires: []capabilityRequirement{requireActiveUser, requireVerifiedEmail, requireCoins},
+	},
+}
+
+// evaluateCapabilities applies capabilityRules to the checks already made in
+// d for user.
+func evaluateCapabilities(d *domain.AccessDecision, user *domain.User) domain.Capabilities {
+	caps := domain.Capabilities{Reasons: make(map[string]string)}
+	for _, rule := range capabilityRules {
+		denied := ""
+		for _, req := range rule.requires {
+			if !req.met(d, user) {
+				denied = req.reason
+				break
+			}
+		}
+		if denied != "" {
+			caps.Reasons[rule.name] = denied
+			continue
+		}
+		rule.grant(&caps)
+	}
+	return caps
+}
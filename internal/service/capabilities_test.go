@@ -0,0 +1,96 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+	"user-service/internal/domain"
+)
+
+// entitlement is a state of a user's trial or subscription.
+type entitlement struct {
+	name   string
+	flag   bool
+	endsAt func(now time.Time) *time.Time
+	active bool
+}
+
+var entitlements = []entitlement{
+	{"none", false, func(time.Time) *time.Time { return nil }, false},
+	{"active", true, func(now time.Time) *time.Time { t := now.Add(24 * time.Hour); return &t }, true},
+	{"expired", true, func(now time.Time) *time.Time { t := now.Add(-24 * time.Hour); return &t }, false},
+}
+
+func TestCapabilitiesMatrix(t *testing.T) {
+	svc := NewUserService(nil, nil, nil, UserServiceConfig{RequireEmailVerification: true})
+	now := time.Now().UTC()
+
+	for _, status := range []domain.UserStatus{domain.StatusActive, domain.StatusSuspended, domain.StatusInactive} {
+		for _, trial := range entitlements {
+			for _, subscription := range entitlements {
+				for _, verified := range []bool{true, false} {
+					for _, coins := range []int64{0, 50} {
+						name := fmt.Sprintf("%s/trial %s/subscription %s/verified %v/coins %d", status, trial.name, subscription.name, verified, coins)
+						user := &domain.User{
+							Status:             status,
+							IsTrial:            trial.flag,
+							TrialEndsAt:        trial.endsAt(now),
+							HasSubscription:    subscription.flag,
+							SubscriptionEndsAt: subscription.endsAt(now),
+							EmailVerified:      verified,
+							CoinsBalance:       coins,
+						}
+
+						allowed := status == domain.StatusActive && verified
+						wantRead := allowed && (trial.active || subscription.active)
+						wantCreate := allowed && subscription.active
+						wantPurchase := allowed && coins > 0
+						var wantReason string
+						switch {
+						case status != domain.StatusActive:
+							wantReason = domain.AccessReasonUserNotActive
+						case !verified:
+							wantReason = domain.AccessReasonEmailNotVerified
+						case subscription.active:
+							wantReason = domain.AccessReasonSubscriptionActive
+						case trial.active:
+							wantReason = domain.AccessReasonTrialActive
+						default:
+							wantReason = domain.AccessReasonNoEntitlement
+						}
+
+						d := svc.decideAccess(user, now)
+						caps := d.Capabilities
+						if caps.CanRead != wantRead || caps.CanCreate != wantCreate || caps.CanPurchase != wantPurchase {
+							t.Errorf("%s: read %v, create %v, purchase %v; want %v, %v, %v",
+								name, caps.CanRead, caps.CanCreate, caps.CanPurchase, wantRead, wantCreate, wantPurchase)
+						}
+						if d.Reason != wantReason {
+							t.Errorf("%s: explained as %s, want %s", name, d.Reason, wantReason)
+						}
+						if d.HasAccess != (wantRead || wantCreate) {
+							t.Errorf("%s: has access %v", name, d.HasAccess)
+						}
+						if d.Status.Passed != (status == domain.StatusActive) || d.EmailVerification.Passed != verified ||
+							d.Trial.Active != trial.active || d.Subscription.Active != subscription.active {
+							t.Errorf("%s: explained checks %+v", name, d)
+						}
+						for capability, granted := range map[string]bool{
+							domain.CapabilityRead:     wantRead,
+							domain.CapabilityCreate:   wantCreate,
+							domain.CapabilityPurchase: wantPurchase,
+						} {
+							if _, denied := caps.Reasons[capability]; denied == granted {
+								t.Errorf("%s: %s granted %v, reasons %v", name, capability, granted, caps.Reasons)
+							}
+						}
+						// Capabilities is the same decision made at the current time
+						if got := svc.Capabilities(user); got.CanRead != caps.CanRead || got.CanCreate != caps.CanCreate || got.CanPurchase != caps.CanPurchase {
+							t.Errorf("%s: Capabilities %+v, decision %+v", name, got, caps)
+						}
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+	"time"
+	"user-service/internal/jobs"
+	"user-service/internal/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type CoinLedgerPruneRepository interface {
+	PruneCoinLedger(ctx context.Context, afterID string, cutoff time.Time, limit int) (string, int, int64, error)
+}
+
+// CoinLedgerPruneJob folds the coin ledger entries older than the retention
+// configured when each batch runs into an opening balance entry per user, so
+// the ledger stops growing without bound while balances still reconcile
+// against it. A retention of zero keeps every entry. It walks users in ID
+// order, checkpointing the last ID.
+func CoinLedgerPruneJob(repo CoinLedgerPruneRepository, retention func() time.Duration, batchSize int, interval time.Duration) jobs.Job {
+	return jobs.Job{
+		Name:     "coin_ledger_prune",
+		Interval: interval,
+		Step: func(ctx context.Context, checkpoint string) (string, int64, bool, error) {
+			keep := retention()
+			if keep <= 0 {
+				return "", 0, true, nil
+			}
+			lastID, users, pruned, err := repo.PruneCoinLedger(ctx, checkpoint, time.Now().UTC().Add(-keep), batchSize)
+			if err != nil {
+				return checkpoint, 0, false, err
+			}
+			if pruned > 0 {
+				metrics.CoinLedgerEntriesPruned.Add(pruned)
+				log.WithFields(log.Fields{
+					"users":   users,
+					"entries": pruned,
+				}).Info("Pruned coin ledger entries past retention")
+			}
+			if lastID == "" || users < batchSize {
+				return "", pruned, true, nil
+			}
+			return lastID, pruned, false, nil
+		},
+	}
+}
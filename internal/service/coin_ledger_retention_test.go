@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeCoinLedgerPruneRepo struct {
+	cutoffs []time.Time
+	lastID  string
+	users   int
+}
+
+func (f *fakeCoinLedgerPruneRepo) PruneCoinLedger(ctx context.Context, afterID string, cutoff time.Time, limit int) (string, int, int64, error) {
+	f.cutoffs = append(f.cutoffs, cutoff)
+	return f.lastID, f.users, int64(f.users), nil
+}
+
+func TestCoinLedgerPruneKeepsEverythingWithoutRetention(t *testing.T) {
+	repo := &fakeCoinLedgerPruneRepo{}
+	job := CoinLedgerPruneJob(repo, func() time.Duration { return 0 }, 10, time.Hour)
+
+	if _, _, done, err := job.Step(context.Background(), ""); err != nil || !done {
+		t.Fatalf("Step: done %v, err %v", done, err)
+	}
+	if len(repo.cutoffs) != 0 {
+		t.Fatalf("pruned with cutoffs %v, want nothing pruned", repo.cutoffs)
+	}
+}
+
+func TestCoinLedgerPruneUsesConfiguredRetention(t *testing.T) {
+	repo := &fakeCoinLedgerPruneRepo{lastID: "user-10", users: 10}
+	retention := 400 * 24 * time.Hour
+	job := CoinLedgerPruneJob(repo, func() time.Duration { return retention }, 10, time.Hour)
+
+	// A full batch checkpoints and continues
+	next, _, done, err := job.Step(context.Background(), "")
+	if err != nil || done || next != "user-10" {
+		t.Fatalf("Step: next %q, done %v, err %v; want to continue from user-10", next, done, err)
+	}
+	if got := time.Since(repo.cutoffs[0]); got < retention || got > retention+time.Minute {
+		t.Errorf("cutoff %v ago, want %v", got, retention)
+	}
+
+	// A short batch finishes the run, with the retention read again
+	retention = 500 * 24 * time.Hour
+	repo.users = 3
+	if _, _, done, err := job.Step(context.Background(), next); err != nil || !done {
+		t.Fatalf("Step: done %v, err %v", done, err)
+	}
+	if got := time.Since(repo.cutoffs[1]); got < retention || got > retention+time.Minute {
+		t.Errorf("cutoff %v ago, want %v", got, retention)
+	}
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"time"
+	"user-service/internal/domain"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type EntitlementConsistencyRepository interface {
+	FindEntitlementInconsistencies(ctx context.Context, afterID string, staleBefore time.Time, limit int) ([]domain.EntitlementInconsistency, error)
+	RepairEntitlements(ctx context.Context, userIDs []string, staleBefore time.Time) ([]string, error)
+	ExpireEntitlements(ctx context.Context, afterID string, limit int) (string, int64, error)
+}
+
+// EntitlementConsistencyChecker finds users whose subscription or trial flag
+// disagrees with its end time and can clear those flags. A flag counts as
+// inconsistent when its end time is missing or more than staleAfter in the
+// past, i.e. long enough that the expiry sweep should have cleared it.
+type EntitlementConsistencyChecker struct {
+	repo         EntitlementConsistencyRepository
+	auditService *AuditService
+	batchSize    int
+	staleAfter   time.Duration
+}
+
+func NewEntitlementConsistencyChecker(repo EntitlementConsistencyRepository, auditService *AuditService, batchSize int, staleAfter time.Duration) *EntitlementConsistencyChecker {
+	return &EntitlementConsistencyChecker{
+		repo:         repo,
+		auditService: auditService,
+		batchSize:    batchSize,
+		staleAfter:   staleAfter,
+	}
+}
+
+// Check scans all users a batch at a time. With repair it clears the
+// inconsistent flags of each batch and records an event per repaired user;
+// without, it only reports.
+func (c *EntitlementConsistencyChecker) Check(ctx context.Context, repair bool) (*domain.EntitlementConsistencyReport, error) {
+	report := &domain.EntitlementConsistencyReport{
+		Repair:  repair,
+		ByIssue: make(map[string]int64),
+		Sample:  []domain.EntitlementInconsistency{},
+	}
+	staleBefore := time.Now().UTC().Add(-c.staleAfter)
+
+	afterID := ""
+	for {
+		batch, err := c.repo.FindEntitlementInconsistencies(ctx, afterID, staleBefore, c.batchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		issues := make(map[string][]string, len(batch))
+		ids := make([]string, 0, len(batch))
+		for _, item := range batch {
+			report.Found++
+			for _, issue := range item.Issues {
+				report.ByIssue[issue]++
+			}
+			if len(report.Sample) < domain.MaxConsistencySample {
+				report.Sample = append(report.Sample, item)
+			}
+			issues[item.UserID] = item.Issues
+			ids = append(ids, item.UserID)
+			afterID = item.UserID
+		}
+
+		if repair && len(ids) > 0 {
+			repaired, err := c.repo.RepairEntitlements(ctx, ids, staleBefore)
+			if err != nil {
+				return nil, err
+			}
+			report.Repaired += int64(len(repaired))
+			for _, userID := range repaired {
+				if err := c.auditService.RecordEntitlementRepaired(ctx, userID, issues[userID]); err != nil {
+					log.WithError(err).WithField("user_id", userID).Warn("Failed to record audit event for entitlement repair")
+				}
+			}
+		}
+
+		if len(batch) < c.batchSize {
+			break
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"repair":   repair,
+		"found":    report.Found,
+		"repaired": report.Repaired,
+	}).Info("Entitlement consistency check finished")
+
+	return report, nil
+}
+
+// ReconcileBatch clears, in one statement, the flags of up to limit users
+// whose subscription or trial has ended by now. It is the on-demand
+// counterpart of the expiry sweep; fixed users no longer match, so repeated
+// calls make progress without a cursor.
+func (c *EntitlementConsistencyChecker) ReconcileBatch(ctx context.Context, limit int) (*domain.ReconcileBatchReport, error) {
+	_, fixed, err := c.repo.ExpireEntitlements(ctx, "", limit)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"limit": limit,
+		"fixed": fixed,
+	}).Info("Entitlement reconcile batch finished")
+
+	return &domain.ReconcileBatchReport{
+		Limit: limit,
+		Fixed: fixed,
+		More:  fixed == int64(limit),
+	}, nil
+}
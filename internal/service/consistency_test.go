@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+	"user-service/internal/domain"
+)
+
+// entitlementRow is the stored state of one user's subscription and trial.
+type entitlementRow struct {
+	id              string
+	hasSubscription bool
+	subscriptionEnd *time.Time
+	isTrial         bool
+	trialEnd        *time.Time
+}
+
+// fakeEntitlementRepo applies the repository's consistency and repair rules
+// to rows kept in ID order.
+type fakeEntitlementRepo struct {
+	rows []*entitlementRow
+	// fixedBehind lists users a concurrent writer fixes between the scan
+	// and the repair of their batch.
+	fixedBehind map[string]bool
+}
+
+func (f *fakeEntitlementRepo) issues(row *entitlementRow, staleBefore time.Time) []string {
+	var issues []string
+	if row.hasSubscription && row.subscriptionEnd == nil {
+		issues = append(issues, domain.InconsistencySubscriptionNoEnd)
+	}
+	if row.hasSubscription && row.subscriptionEnd != nil && row.subscriptionEnd.Before(staleBefore) {
+		issues = append(issues, domain.InconsistencySubscriptionExpired)
+	}
+	if row.isTrial && row.trialEnd == nil {
+		issues = append(issues, domain.InconsistencyTrialNoEnd)
+	}
+	if row.isTrial && row.trialEnd != nil && row.trialEnd.Before(staleBefore) {
+		issues = append(issues, domain.InconsistencyTrialExpired)
+	}
+	return issues
+}
+
+func (f *fakeEntitlementRepo) FindEntitlementInconsistencies(ctx context.Context, afterID string, staleBefore time.Time, limit int) ([]domain.EntitlementInconsistency, error) {
+	var found []domain.EntitlementInconsistency
+	for _, row := range f.rows {
+		if row.id <= afterID || len(found) == limit {
+			continue
+		}
+		if issues := f.issues(row, staleBefore); issues != nil {
+			found = append(found, domain.EntitlementInconsistency{UserID: row.id, Issues: issues})
+		}
+	}
+	return found, nil
+}
+
+func (f *fakeEntitlementRepo) RepairEntitlements(ctx context.Context, userIDs []string, staleBefore time.Time) ([]string, error) {
+	now := time.Now()
+	alive := func(end *time.Time) bool { return end != nil && end.After(now) }
+	var repaired []string
+	for _, row := range f.rows {
+		if f.fixedBehind[row.id] {
+			row.hasSubscription, row.isTrial = false, false
+		}
+		for _, id := range userIDs {
+			if id != row.id || f.issues(row, staleBefore) == nil {
+				continue
+			}
+			row.hasSubscription = row.hasSubscription && alive(row.subscriptionEnd)
+			row.isTrial = row.isTrial && alive(row.trialEnd)
+			repaired = append(repaired, row.id)
+		}
+	}
+	return repaired, nil
+}
+
+func (f *fakeEntitlementRepo) ExpireEntitlements(ctx context.Context, afterID string, limit int) (string, int64, error) {
+	now := time.Now()
+	ended := func(end *time.Time) bool { return end != nil && !end.After(now) }
+	var lastID string
+	var updated int64
+	for _, row := range f.rows {
+		if row.id <= afterID || updated == int64(limit) {
+			continue
+		}
+		expiredSubscription, expiredTrial := row.hasSubscription && ended(row.subscriptionEnd), row.isTrial && ended(row.trialEnd)
+		if !expiredSubscription && !expiredTrial {
+			continue
+		}
+		row.hasSubscription = row.hasSubscription && !expiredSubscription
+		row.isTrial = row.isTrial && !expiredTrial
+		lastID = row.id
+		updated++
+	}
+	return lastID, updated, nil
+}
+
+// capturingPublisher keeps the events it is given.
+type capturingPublisher struct {
+	mu     sync.Mutex
+	events []domain.AuditEvent
+}
+
+func (c *capturingPublisher) Publish(ctx context.Context, event domain.AuditEvent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, event)
+	return nil
+}
+
+// seedEntitlements returns one row per inconsistency class, one with two
+// issues, and consistent rows the check must leave alone, with the issues
+// each should be reported for.
+func seedEntitlements(now time.Time) ([]*entitlementRow, map[string][]string) {
+	at := func(d time.Duration) *time.Time {
+		v := now.Add(d)
+		return &v
+	}
+	rows := []*entitlementRow{
+		{hasSubscription: true},
+		{hasSubscription: true, subscriptionEnd: at(-72 * time.Hour)},
+		{isTrial: true},
+		{isTrial: true, trialEnd: at(-72 * time.Hour)},
+		{hasSubscription: true, isTrial: true, trialEnd: at(-48 * time.Hour)},
+		// Within the stale window, left to the expiry sweep
+		{hasSubscription: true, subscriptionEnd: at(-time.Hour)},
+		{isTrial: true, trialEnd: at(-time.Hour)},
+		{hasSubscription: true, subscriptionEnd: at(time.Hour)},
+		{isTrial: true, trialEnd: at(time.Hour)},
+		{subscriptionEnd: at(-72 * time.Hour), trialEnd: at(-72 * time.Hour)},
+	}
+	issues := [][]string{
+		{domain.InconsistencySubscriptionNoEnd},
+		{domain.InconsistencySubscriptionExpired},
+		{domain.InconsistencyTrialNoEnd},
+		{domain.InconsistencyTrialExpired},
+		{domain.InconsistencySubscriptionNoEnd, domain.InconsistencyTrialExpired},
+	}
+	want := map[string][]string{}
+	for i, row := range rows {
+		row.id = fmt.Sprintf("0190c2a8-7f1e-7a3b-9c4d-%012d", i)
+		if i < len(issues) {
+			want[row.id] = issues[i]
+		}
+	}
+	return rows, want
+}
+
+func TestConsistencyCheckReportsEachClass(t *testing.T) {
+	rows, want := seedEntitlements(time.Now())
+	repo := &fakeEntitlementRepo{rows: rows}
+	sink := &capturingPublisher{}
+	// A batch smaller than the findings makes the check page
+	checker := NewEntitlementConsistencyChecker(repo, NewAuditService(sink), 2, 24*time.Hour)
+
+	report, err := checker.Check(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	wantByIssue := map[string]int64{
+		domain.InconsistencySubscriptionNoEnd:   2,
+		domain.InconsistencySubscriptionExpired: 1,
+		domain.InconsistencyTrialNoEnd:          1,
+		domain.InconsistencyTrialExpired:        2,
+	}
+	if report.Repair || report.Found != int64(len(want)) || report.Repaired != 0 || !reflect.DeepEqual(report.ByIssue, wantByIssue) {
+		t.Errorf("dry run: got %+v, want %d found by %v and nothing repaired", report, len(want), wantByIssue)
+	}
+	for _, item := range report.Sample {
+		if !reflect.DeepEqual(item.Issues, want[item.UserID]) {
+			t.Errorf("%s: issues %v, want %v", item.UserID, item.Issues, want[item.UserID])
+		}
+	}
+	if len(report.Sample) != len(want) {
+		t.Errorf("sample of %d, want all %d", len(report.Sample), len(want))
+	}
+
+	// A dry run changes nothing and records nothing
+	if again, _ := checker.Check(context.Background(), false); again.Found != report.Found {
+		t.Errorf("second dry run found %d, want %d", again.Found, report.Found)
+	}
+	if len(sink.events) != 0 {
+		t.Errorf("dry run recorded %d events", len(sink.events))
+	}
+}
+
+func TestConsistencyRepairClearsFlagsAndAudits(t *testing.T) {
+	now := time.Now()
+	rows, want := seedEntitlements(now)
+	before := make([]entitlementRow, len(rows))
+	for i, row := range rows {
+		before[i] = *row
+	}
+	// One user is fixed by someone else before the repair reaches it
+	behind := rows[1].id
+	repo := &fakeEntitlementRepo{rows: rows, fixedBehind: map[string]bool{behind: true}}
+	sink := &capturingPublisher{}
+	checker := NewEntitlementConsistencyChecker(repo, NewAuditService(sink), 2, 24*time.Hour)
+
+	report, err := checker.Check(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if !report.Repair || report.Found != int64(len(want)) || report.Repaired != int64(len(want)-1) {
+		t.Errorf("repair: found %d, repaired %d, want %d and %d", report.Found, report.Repaired, len(want), len(want)-1)
+	}
+
+	for i, row := range rows {
+		if _, broken := want[row.id]; !broken {
+			if *row != before[i] {
+				t.Errorf("%s: consistent row changed from %+v to %+v", row.id, before[i], *row)
+			}
+			continue
+		}
+		if row.hasSubscription || row.isTrial {
+			t.Errorf("%s: flags still set after repair: %+v", row.id, *row)
+		}
+	}
+
+	// One event per repaired user, carrying its issues
+	var audited []string
+	for _, event := range sink.events {
+		if event.EventType != domain.AuditEntitlementRepaired {
+			t.Errorf("recorded %s, want %s", event.EventType, domain.AuditEntitlementRepaired)
+		}
+		if got := event.Payload["issues"]; !reflect.DeepEqual(got, want[event.EntityID]) {
+			t.Errorf("%s: event issues %v, want %v", event.EntityID, got, want[event.EntityID])
+		}
+		audited = append(audited, event.EntityID)
+	}
+	var wantAudited []string
+	for id := range want {
+		if id != behind {
+			wantAudited = append(wantAudited, id)
+		}
+	}
+	sort.Strings(audited)
+	sort.Strings(wantAudited)
+	if !reflect.DeepEqual(audited, wantAudited) {
+		t.Errorf("audited %v, want %v", audited, wantAudited)
+	}
+
+	// Nothing is left for a second pass
+	if again, err := checker.Check(context.Background(), true); err != nil || again.Found != 0 || again.Repaired != 0 {
+		t.Errorf("second repair: %+v, %v, want nothing found", again, err)
+	}
+}
+
+func TestReconcileBatchFixesEndedEntitlements(t *testing.T) {
+	now := time.Now()
+	rows, _ := seedEntitlements(now)
+	before := make([]entitlementRow, len(rows))
+	for i, row := range rows {
+		before[i] = *row
+	}
+	checker := NewEntitlementConsistencyChecker(&fakeEntitlementRepo{rows: rows}, nil, 100, 24*time.Hour)
+
+	// Flags whose end has passed, however recently; a missing end is left
+	// to the consistency check
+	var wantFixed int64
+	for _, row := range before {
+		if row.hasSubscription && row.subscriptionEnd != nil && row.subscriptionEnd.Before(now) ||
+			row.isTrial && row.trialEnd != nil && row.trialEnd.Before(now) {
+			wantFixed++
+		}
+	}
+
+	// Without a cursor, repeated full batches still make progress
+	var fixed int64
+	var reports []domain.ReconcileBatchReport
+	for i := 0; i < 10; i++ {
+		report, err := checker.ReconcileBatch(context.Background(), 2)
+		if err != nil {
+			t.Fatalf("ReconcileBatch: %v", err)
+		}
+		reports = append(reports, *report)
+		fixed += report.Fixed
+		if !report.More {
+			break
+		}
+	}
+	if fixed != wantFixed {
+		t.Errorf("fixed %d users over %+v, want %d", fixed, reports, wantFixed)
+	}
+	if last := reports[len(reports)-1]; last.More || last.Fixed == 2 {
+		t.Errorf("last batch %+v still reports more", last)
+	}
+	for _, report := range reports[:len(reports)-1] {
+		if report.Limit != 2 || report.Fixed != 2 || !report.More {
+			t.Errorf("full batch reported as %+v", report)
+		}
+	}
+
+	for i, row := range rows {
+		was := before[i]
+		wantSubscription := was.hasSubscription && (was.subscriptionEnd == nil || was.subscriptionEnd.After(now))
+		wantTrial := was.isTrial && (was.trialEnd == nil || was.trialEnd.After(now))
+		if row.hasSubscription != wantSubscription || row.isTrial != wantTrial {
+			t.Errorf("%+v reconciled to %+v", was, *row)
+		}
+	}
+
+	if report, err := checker.ReconcileBatch(context.Background(), 2); err != nil || report.Fixed != 0 || report.More {
+		t.Errorf("batch after reconcile: %+v, %v, want nothing fixed", report, err)
+	}
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"context"
+	"time"
+	"user-service/internal/jobs"
+)
+
+type EntitlementExpiryRepository interface {
+	ExpireEntitlements(ctx context.Context, afterID string, limit int) (string, int64, error)
+}
+
+// ExpirySweepJob clears the subscription and trial flags of users whose
+// entitlement has ended, so stored flags match what access checks compute
+// from the end times. It walks users in ID order, checkpointing the last ID.
+func ExpirySweepJob(repo EntitlementExpiryRepository, batchSize int, interval time.Duration) jobs.Job {
+	return jobs.Job{
+		Name:     "entitlement_expiry_sweep",
+		Interval: interval,
+		Step: func(ctx context.Context, checkpoint string) (string, int64, bool, error) {
+			lastID, updated, err := repo.ExpireEntitlements(ctx, checkpoint, batchSize)
+			if err != nil {
+				return checkpoint, 0, false, err
+			}
+			if lastID == "" || updated < int64(batchSize) {
+				return "", updated, true, nil
+			}
+			return lastID, updated, false, nil
+		},
+	}
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"time"
+	"user-service/internal/janitor"
+)
+
+// idempotencyCleanupBatch bounds each delete so cleanup never holds long locks.
+const idempotencyCleanupBatch = 1000
+
+// idempotencyService owns the lifecycle of stored idempotency keys. A key is
+// only honored until it expires; after that the same key is a fresh request.
+type idempotencyService struct {
+	keyTTL          time.Duration
+	cleanupInterval time.Duration
+}
+
+func NewIdempotencyService(keyTTL, cleanupInterval time.Duration) *idempotencyService {
+	return &idempotencyService{
+		keyTTL:          keyTTL,
+		cleanupInterval: cleanupInterval,
+	}
+}
+
+// KeyTTL is how long a stored key is honored.
+func (s *idempotencyService) KeyTTL() time.Duration {
+	return s.keyTTL
+}
+
+// CleanupPolicy has the janitor delete keys once they expire.
+func (s *idempotencyService) CleanupPolicy() janitor.Policy {
+	return janitor.Policy{
+		Name:      "idempotency_keys",
+		Table:     "idempotency_keys",
+		AgeColumn: "expires_at",
+		BatchSize: idempotencyCleanupBatch,
+		Interval:  s.cleanupInterval,
+	}
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"time"
+	"user-service/internal/jobs"
+	"user-service/internal/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type LegacyTrialRepository interface {
+	BackfillTrialEnds(ctx context.Context, afterID string, trialLength time.Duration, limit int) (string, int64, error)
+}
+
+// LegacyTrialBackfillJob gives users imported with is_trial set but no
+// trial_ends_at the end a trial started at their creation would have had,
+// using the trial length configured when each batch runs. Until then access
+// checks apply the legacy trial policy. It walks users in ID order,
+// checkpointing the last ID.
+func LegacyTrialBackfillJob(repo LegacyTrialRepository, trialLength func() time.Duration, batchSize int, interval time.Duration) jobs.Job {
+	return jobs.Job{
+		Name:     "legacy_trial_backfill",
+		Interval: interval,
+		Step: func(ctx context.Context, checkpoint string) (string, int64, bool, error) {
+			lastID, updated, err := repo.BackfillTrialEnds(ctx, checkpoint, trialLength(), batchSize)
+			if err != nil {
+				return checkpoint, 0, false, err
+			}
+			if updated > 0 {
+				metrics.LegacyTrialsBackfilled.Add(updated)
+				log.WithField("users", updated).Warn("Backfilled trial end for legacy trial users")
+			}
+			if lastID == "" || updated < int64(batchSize) {
+				return "", updated, true, nil
+			}
+			return lastID, updated, false, nil
+		},
+	}
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeLegacyTrialRepo struct {
+	trialLengths []time.Duration
+}
+
+func (f *fakeLegacyTrialRepo) BackfillTrialEnds(ctx context.Context, afterID string, trialLength time.Duration, limit int) (string, int64, error) {
+	f.trialLengths = append(f.trialLengths, trialLength)
+	return "", 0, nil
+}
+
+func TestLegacyTrialBackfillUsesConfiguredTrialLength(t *testing.T) {
+	repo := &fakeLegacyTrialRepo{}
+	trialLength := 24 * time.Hour
+	job := LegacyTrialBackfillJob(repo, func() time.Duration { return trialLength }, 10, time.Hour)
+
+	if _, _, done, err := job.Step(context.Background(), ""); err != nil || !done {
+		t.Fatalf("Step: done %v, err %v", done, err)
+	}
+	trialLength = 7 * 24 * time.Hour
+	if _, _, _, err := job.Step(context.Background(), ""); err != nil {
+		t.Fatalf("Step: %v", err)
+	}
+
+	want := []time.Duration{24 * time.Hour, 7 * 24 * time.Hour}
+	if len(repo.trialLengths) != len(want) || repo.trialLengths[0] != want[0] || repo.trialLengths[1] != want[1] {
+		t.Fatalf("trial lengths %v, want %v", repo.trialLengths, want)
+	}
+}
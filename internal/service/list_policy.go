@@ -0,0 +1,18 @@
+package service
+
+import "sync/atomic"
+
+// listPolicy holds the invalid input policy a service applies to list pages.
+// The zero value rejects.
+type listPolicy struct {
+	policy atomic.Value
+}
+
+func (p *listPolicy) set(policy string) {
+	p.policy.Store(policy)
+}
+
+func (p *listPolicy) get() string {
+	policy, _ := p.policy.Load().(string)
+	return policy
+}
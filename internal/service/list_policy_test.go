@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"user-service/internal/domain"
+)
+
+// pageRecorder remembers the page a list repository was asked for.
+type pageRecorder struct {
+	limit, offset int
+	calls         int
+}
+
+func (p *pageRecorder) record(limit, offset int) {
+	p.limit, p.offset = limit, offset
+	p.calls++
+}
+
+type pagedUserRepo struct {
+	UserRepository
+	pageRecorder
+}
+
+func (r *pagedUserRepo) List(ctx context.Context, filter domain.UserListFilter, limit, offset int) ([]domain.User, error) {
+	r.record(limit, offset)
+	return nil, nil
+}
+
+func (r *pagedUserRepo) Count(ctx context.Context, filter domain.UserListFilter) (int64, error) {
+	return 0, nil
+}
+
+type pagedProductRepo struct {
+	ProductRepository
+	pageRecorder
+}
+
+func (r *pagedProductRepo) ListProducts(ctx context.Context, categoryID *string, onlyActive bool, sort string, limit, offset int) ([]domain.Product, int64, error) {
+	r.record(limit, offset)
+	return nil, 0, nil
+}
+
+func (r *pagedProductRepo) ListAll(ctx context.Context, q domain.AdminProductQuery) ([]domain.Product, int64, error) {
+	r.record(q.Limit, q.Offset)
+	return nil, 0, nil
+}
+
+type pagedReportRepo struct {
+	ReportRepository
+	pageRecorder
+}
+
+func (r *pagedReportRepo) CatalogStats(ctx context.Context, categoryID *string, rng domain.StatsRange, limit, offset int) ([]domain.ProductStats, int64, error) {
+	r.record(limit, offset)
+	return nil, 0, nil
+}
+
+// pagedList lists one resource through its service and reports the page
+// its repository was asked for and the limit and offset the service
+// returned.
+type pagedList struct {
+	name string
+	list func(policy string, limit, offset int) (asked pageRecorder, served [2]int, err error)
+}
+
+func pagedLists() []pagedList {
+	categoryID := "0190f1a2-0000-7000-8000-000000000001"
+	return []pagedList{
+		{"users", func(policy string, limit, offset int) (pageRecorder, [2]int, error) {
+			repo := &pagedUserRepo{}
+			s := NewUserService(repo, nil, nil, UserServiceConfig{InvalidInputPolicy: policy})
+			page, err := s.ListUsers(context.Background(), domain.UserListFilter{}, limit, offset)
+			return repo.pageRecorder, [2]int{page.Limit, page.Offset}, err
+		}},
+		{"products", func(policy string, limit, offset int) (pageRecorder, [2]int, error) {
+			repo := &pagedProductRepo{}
+			s := NewProductService(repo, 1)
+			s.SetInvalidInputPolicy(policy)
+			page, err := s.ListProducts(context.Background(), nil, true, "", limit, offset)
+			return repo.pageRecorder, [2]int{page.Limit, page.Offset}, err
+		}},
+		{"admin products", func(policy string, limit, offset int) (pageRecorder, [2]int, error) {
+			repo := &pagedProductRepo{}
+			s := NewProductService(repo, 1)
+			s.SetInvalidInputPolicy(policy)
+			page, err := s.ListAllProducts(context.Background(), domain.AdminProductQuery{Limit: limit, Offset: offset})
+			return repo.pageRecorder, [2]int{page.Limit, page.Offset}, err
+		}},
+		{"category products", func(policy string, limit, offset int) (pageRecorder, [2]int, error) {
+			repo := &pagedProductRepo{}
+			s := NewProductService(repo, 1)
+			s.SetInvalidInputPolicy(policy)
+			page, err := s.ListProducts(context.Background(), &categoryID, true, "", limit, offset)
+			return repo.pageRecorder, [2]int{page.Limit, page.Offset}, err
+		}},
+		{"category stats", func(policy string, limit, offset int) (pageRecorder, [2]int, error) {
+			repo := &pagedReportRepo{}
+			s := NewReportService(repo)
+			s.SetInvalidInputPolicy(policy)
+			page, err := s.CatalogStats(context.Background(), &categoryID, domain.StatsRange{}, limit, offset)
+			return repo.pageRecorder, [2]int{page.Limit, page.Offset}, err
+		}},
+	}
+}
+
+func TestListPolicyIsUniformAcrossLists(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        string
+		limit, offset int
+		wantErr       error
+		wantLimit     int
+		wantOffset    int
+	}{
+		{"reject in range", domain.InvalidInputReject, 20, 40, nil, 20, 40},
+		{"reject default limit", domain.InvalidInputReject, 0, -5, nil, 10, 0},
+		{"reject limit too large", domain.InvalidInputReject, domain.MaxListLimit + 1, 0, domain.ErrListLimitTooLarge, 0, 0},
+		{"reject offset too large", domain.InvalidInputReject, 20, domain.MaxListOffset + 1, domain.ErrListOffsetTooLarge, 0, 0},
+		{"clamp in range", domain.InvalidInputClamp, 20, 40, nil, 20, 40},
+		{"clamp default limit", domain.InvalidInputClamp, 0, -5, nil, 10, 0},
+		{"clamp limit too large", domain.InvalidInputClamp, domain.MaxListLimit + 1, 0, nil, domain.MaxListLimit, 0},
+		{"clamp offset too large", domain.InvalidInputClamp, 20, domain.MaxListOffset + 1, nil, 20, domain.MaxListOffset},
+	}
+
+	for _, tt := range tests {
+		for _, list := range pagedLists() {
+			t.Run(tt.name+"/"+list.name, func(t *testing.T) {
+				page, served, err := list.list(tt.policy, tt.limit, tt.offset)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				if tt.wantErr != nil {
+					if page.calls != 0 {
+						t.Errorf("rejected page reached the repository")
+					}
+					return
+				}
+				if page.limit != tt.wantLimit || page.offset != tt.wantOffset {
+					t.Errorf("repository page = %d/%d, want %d/%d", page.limit, page.offset, tt.wantLimit, tt.wantOffset)
+				}
+				// Handlers echo the returned page, so it must be the one served
+				if served != [2]int{page.limit, page.offset} {
+					t.Errorf("returned page = %d/%d, served %d/%d", served[0], served[1], page.limit, page.offset)
+				}
+			})
+		}
+	}
+}
+
+func TestListUsersCoinRange(t *testing.T) {
+	coins := func(v int64) *int64 { return &v }
+	tests := []struct {
+		name    string
+		filter  domain.UserListFilter
+		wantErr error
+	}{
+		{"only min", domain.UserListFilter{MinCoins: coins(100)}, nil},
+		{"only max", domain.UserListFilter{MaxCoins: coins(100)}, nil},
+		{"min equals max", domain.UserListFilter{MinCoins: coins(100), MaxCoins: coins(100)}, nil},
+		{"min below max", domain.UserListFilter{MinCoins: coins(10), MaxCoins: coins(100)}, nil},
+		{"min above max", domain.UserListFilter{MinCoins: coins(101), MaxCoins: coins(100)}, domain.ErrInvalidCoinsRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &pagedUserRepo{}
+			s := NewUserService(repo, nil, nil, UserServiceConfig{})
+			_, err := s.ListUsers(context.Background(), tt.filter, 10, 0)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			wantCalls := 1
+			if tt.wantErr != nil {
+				wantCalls = 0
+			}
+			if repo.calls != wantCalls {
+				t.Errorf("repository listed %d times, want %d", repo.calls, wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"user-service/internal/domain"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+type OrderRepository interface {
+	Checkout(ctx context.Context, userID string, items []domain.CheckoutItem) (*domain.Order, error)
+	GetByID(ctx context.Context, id string) (*domain.Order, error)
+	ListByUser(ctx context.Context, userID string, limit, offset int) ([]domain.Order, int64, error)
+	Refund(ctx context.Context, orderID string, itemIDs []string) (*domain.OrderRefund, error)
+	PurchaseQuote(ctx context.Context, userID, productID string) (*domain.PurchaseQuote, error)
+}
+
+type orderService struct {
+	orderRepo    OrderRepository
+	auditService *AuditService
+	listPolicy   listPolicy
+}
+
+func NewOrderService(orderRepo OrderRepository, auditService *AuditService) *orderService {
+	return &orderService{
+		orderRepo:    orderRepo,
+		auditService: auditService,
+	}
+}
+
+// SetInvalidInputPolicy sets whether list pages beyond the maxima are
+// rejected or clamped; it is safe to call while serving requests.
+func (s *orderService) SetInvalidInputPolicy(policy string) {
+	s.listPolicy.set(policy)
+}
+
+func (s *orderService) Checkout(ctx context.Context, userID string, req domain.CheckoutRequest) (*domain.Order, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, domain.ErrInvalidUUID
+	}
+	for i, item := range req.Items {
+		if _, err := uuid.Parse(item.ProductID); err != nil {
+			return nil, &domain.LineItemError{Index: i, ProductID: item.ProductID, Err: domain.ErrInvalidUUID}
+		}
+	}
+	if err := domain.ValidateCheckoutRequest(req); err != nil {
+		return nil, err
+	}
+
+	order, err := s.orderRepo.Checkout(ctx, userID, req.Items)
+	if err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Checkout failed")
+		return nil, err
+	}
+
+	if err := s.auditService.RecordOrderCompleted(ctx, order); err != nil {
+		log.WithError(err).WithField("order_id", order.ID).Warn("Failed to record audit event for completed order")
+	}
+
+	return order, nil
+}
+
+func (s *orderService) ListUserOrders(ctx context.Context, userID string, limit, offset int) ([]domain.Order, int64, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, 0, domain.ErrInvalidUUID
+	}
+	limit, offset, err := domain.ListPage(s.listPolicy.get(), limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return s.orderRepo.ListByUser(ctx, userID, limit, offset)
+}
+
+// GetOrder returns an order. When ownerID is set, orders belonging to anyone
+// else are reported as not found so their existence isn't revealed.
+func (s *orderService) GetOrder(ctx context.Context, orderID string, ownerID *string) (*domain.Order, error) {
+	if _, err := uuid.Parse(orderID); err != nil {
+		return nil, domain.ErrOrderNotFound
+	}
+
+	order, err := s.orderRepo.GetByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if ownerID != nil && order.UserID != *ownerID {
+		return nil, domain.ErrOrderNotFound
+	}
+
+	return order, nil
+}
+
+func (s *orderService) RefundOrder(ctx context.Context, orderID string, req domain.RefundOrderRequest) (*domain.OrderRefund, error) {
+	if _, err := uuid.Parse(orderID); err != nil {
+		return nil, domain.ErrOrderNotFound
+	}
+	for _, id := range req.OrderItemIDs {
+		if _, err := uuid.Parse(id); err != nil {
+			return nil, domain.ErrOrderItemNotFound
+		}
+	}
+
+	refund, err := s.orderRepo.Refund(ctx, orderID, req.OrderItemIDs)
+	if err != nil {
+		log.WithError(err).WithField("order_id", orderID).Error("Refund failed")
+		return nil, err
+	}
+
+	if err := s.auditService.RecordOrderRefunded(ctx, refund); err != nil {
+		log.WithError(err).WithField("order_id", orderID).Warn("Failed to record audit event for order refund")
+	}
+
+	return refund, nil
+}
+
+// CanPurchase previews whether the user can afford one unit of the product.
+// The quote is still returned with ErrProductInactive or ErrOutOfStock.
+func (s *orderService) CanPurchase(ctx context.Context, userID, productID string) (*domain.PurchaseQuote, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, domain.ErrInvalidUUID
+	}
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, domain.ErrProductNotFound
+	}
+
+	return s.orderRepo.PurchaseQuote(ctx, userID, productID)
+}
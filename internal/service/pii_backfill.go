@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"time"
+	"user-service/internal/jobs"
+	"user-service/internal/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type PIIBackfillRepository interface {
+	EncryptPIIBatch(ctx context.Context, afterID string, limit int) (string, int64, error)
+}
+
+// PIIBackfillJob encrypts the email and name of users stored before PII
+// encryption was turned on and gives them an email hash. Until then they are
+// read and looked up by their plaintext email. It walks users in ID order,
+// checkpointing the last ID, so an interrupted run resumes where it stopped.
+func PIIBackfillJob(repo PIIBackfillRepository, batchSize int, interval time.Duration) jobs.Job {
+	return jobs.Job{
+		Name:     "pii_backfill",
+		Interval: interval,
+		Step: func(ctx context.Context, checkpoint string) (string, int64, bool, error) {
+			lastID, encrypted, err := repo.EncryptPIIBatch(ctx, checkpoint, batchSize)
+			if err != nil {
+				return checkpoint, 0, false, err
+			}
+			if encrypted > 0 {
+				metrics.PIIUsersEncrypted.Add(encrypted)
+				log.WithField("users", encrypted).Info("Encrypted personal data of stored users")
+			}
+			if lastID == "" || encrypted < int64(batchSize) {
+				return "", encrypted, true, nil
+			}
+			return lastID, encrypted, false, nil
+		},
+	}
+}
@@ -2,48 +2,119 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
 	"user-service/internal/domain"
+	"user-service/internal/janitor"
+	"user-service/internal/publicid"
+	"user-service/internal/semaphore"
 
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 )
 
 type ProductRepository interface {
-	ListProducts(ctx context.Context, categoryID *string, onlyActive bool, limit, offset int) ([]domain.Product, error)
+	ListProducts(ctx context.Context, categoryID *string, onlyActive bool, sort string, limit, offset int) ([]domain.Product, int64, error)
 	GetByID(ctx context.Context, id string) (*domain.Product, error)
 	GetBySlug(ctx context.Context, slug string) (*domain.Product, error)
-	Create(ctx context.Context, req domain.CreateProductRequest) (*domain.Product, error)
-	Update(ctx context.Context, id string, req domain.UpdateProductRequest) (*domain.Product, error)
+	Create(ctx context.Context, req domain.CreateProductRequest, maxPerCategory int) (*domain.Product, error)
+	Update(ctx context.Context, id string, req domain.UpdateProductRequest, maxPerCategory int) (*domain.Product, error)
 	Delete(ctx context.Context, id string) error
+	UpdateCategoryPrices(ctx context.Context, categoryID string, req domain.BulkPriceUpdateRequest) (int64, error)
+	ReserveSlug(ctx context.Context, slug, owner string, expiresAt time.Time) (*domain.SlugReservation, error)
+	ReleaseSlug(ctx context.Context, slug, owner string) error
+	ListAll(ctx context.Context, q domain.AdminProductQuery) ([]domain.Product, int64, error)
+	GetCategoryMetadataSchema(ctx context.Context, categoryID string) (json.RawMessage, error)
+	IsCategoryActive(ctx context.Context, categoryID string) (bool, error)
+	GetProductCategory(ctx context.Context, productID string) (*domain.ProductCategory, error)
 }
 
 type productService struct {
-	productRepo ProductRepository
+	productRepo   ProductRepository
+	minNameLength atomic.Int64
+	// maxPerCategory caps the products of one category; 0 means unlimited.
+	maxPerCategory atomic.Int64
+	// maxContentBytes caps description plus metadata; 0 means unlimited.
+	maxContentBytes atomic.Int64
+	// fallbackCategoryID is used for products created without a category;
+	// empty when the fallback category is disabled.
+	fallbackCategoryID string
+	// activeByDefault is the is_active of products created without one.
+	activeByDefault bool
+	// rejectInactiveCategory refuses new products in inactive categories.
+	rejectInactiveCategory bool
+	// heavyOps bounds the pool connections held by bulk operations; nil
+	// leaves them unbounded.
+	heavyOps   *semaphore.Weighted
+	listPolicy listPolicy
+	ids        publicid.Generator
 }
 
-func NewProductService(productRepo ProductRepository) *productService {
-	return &productService{
+func NewProductService(productRepo ProductRepository, minNameLength int) *productService {
+	s := &productService{
 		productRepo: productRepo,
+		ids:         publicid.UUIDv7{},
 	}
+	s.SetMinNameLength(minNameLength)
+	return s
 }
 
-func (s *productService) ListProducts(ctx context.Context, categoryID *string, onlyActive bool, limit, offset int) ([]domain.Product, error) {
-	if limit <= 0 {
-		limit = 10
+// SetIDGenerator replaces how new product IDs are generated. It is meant to
+// be called once at startup, before serving requests.
+func (s *productService) SetIDGenerator(ids publicid.Generator) {
+	s.ids = ids
+}
+
+// newID returns the ID a new product is stored under.
+func (s *productService) newID() (string, error) {
+	id, err := s.ids.NewID()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate product id: %w", err)
+	}
+	return id, nil
+}
+
+// SetMinNameLength changes the minimum accepted name length; it is safe to call while serving requests.
+func (s *productService) SetMinNameLength(minLength int) {
+	if minLength < domain.DefaultMinNameLength {
+		minLength = domain.DefaultMinNameLength
 	}
-	if limit > domain.MaxListLimit {
-		limit = domain.MaxListLimit
+	s.minNameLength.Store(int64(minLength))
+}
+
+func (s *productService) ListProducts(ctx context.Context, categoryID *string, onlyActive bool, sort string, limit, offset int) (domain.Page[domain.Product], error) {
+	if err := domain.ValidateProductListSort(sort); err != nil {
+		return domain.Page[domain.Product]{}, err
 	}
-	if offset < 0 {
-		offset = 0
+	limit, offset, err := domain.ListPage(s.listPolicy.get(), limit, offset)
+	if err != nil {
+		return domain.Page[domain.Product]{}, err
 	}
 
-	products, err := s.productRepo.ListProducts(ctx, categoryID, onlyActive, limit, offset)
+	products, total, err := s.productRepo.ListProducts(ctx, categoryID, onlyActive, sort, limit, offset)
 	if err != nil {
 		log.WithError(err).Error("Failed to list products")
+		return domain.Page[domain.Product]{}, err
+	}
+	return domain.Page[domain.Product]{Items: products, Total: total, Limit: limit, Offset: offset}, nil
+}
+
+// ExpandCategory embeds the category of product. A missing category is a
+// data integrity problem, not the caller's: it is logged and left nil.
+func (s *productService) ExpandCategory(ctx context.Context, product *domain.Product) (*domain.ProductWithCategory, error) {
+	category, err := s.productRepo.GetProductCategory(ctx, product.ID)
+	if err != nil {
 		return nil, err
 	}
-	return products, nil
+	if category == nil {
+		log.WithFields(log.Fields{
+			"product_id":  product.ID,
+			"category_id": product.CategoryID,
+		}).Warn("Product points at a missing category")
+	}
+	return &domain.ProductWithCategory{Product: *product, Category: category}, nil
 }
 
 func (s *productService) GetProductByID(ctx context.Context, id string) (*domain.Product, error) {
@@ -58,7 +129,9 @@ func (s *productService) GetProductByID(ctx context.Context, id string) (*domain
 	return product, nil
 }
 
-func (s *productService) GetProductBySlug(ctx context.Context, slug string) (*domain.Product, error) {
+// GetProductBySlug returns the product with slug. Unless includeInactive is
+// set, an inactive product is reported as not found.
+func (s *productService) GetProductBySlug(ctx context.Context, slug string, includeInactive bool) (*domain.Product, error) {
 	if err := domain.ValidateProductSlug(slug); err != nil {
 		return nil, err
 	}
@@ -67,23 +140,64 @@ func (s *productService) GetProductBySlug(ctx context.Context, slug string) (*do
 	if err != nil {
 		return nil, err
 	}
+	if !includeInactive && !product.IsActive {
+		return nil, domain.ErrProductNotFound
+	}
 	return product, nil
 }
 
-func (s *productService) CreateProduct(ctx context.Context, req domain.CreateProductRequest) (*domain.Product, error) {
-	if req.CategoryID == "" {
-		return nil, domain.ErrInvalidUUID
-	}
-	if _, err := uuid.Parse(req.CategoryID); err != nil {
-		return nil, domain.ErrInvalidUUID
-	}
-	if err := domain.ValidateProductSlug(req.Slug); err != nil {
-		return nil, err
+// SetMaxProductsPerCategory changes the per-category product cap; 0 removes
+// it. It is safe to call while serving requests.
+func (s *productService) SetMaxProductsPerCategory(maxProducts int) {
+	if maxProducts < 0 {
+		maxProducts = 0
 	}
-	if err := domain.ValidateProductName(req.Name); err != nil {
-		return nil, err
+	s.maxPerCategory.Store(int64(maxProducts))
+}
+
+// SetMaxProductContentBytes changes the cap on a product's description and
+// metadata combined; 0 removes it. It is safe to call while serving requests.
+func (s *productService) SetMaxProductContentBytes(maxBytes int) {
+	if maxBytes < 0 {
+		maxBytes = 0
 	}
-	if err := domain.ValidateProductPrice(req.PriceCoins); err != nil {
+	s.maxContentBytes.Store(int64(maxBytes))
+}
+
+// SetFallbackCategory makes products created without a category land in
+// categoryID. It is meant to be called once at startup, before serving requests.
+func (s *productService) SetFallbackCategory(categoryID string) {
+	s.fallbackCategoryID = categoryID
+}
+
+// SetActiveByDefault sets whether products created without is_active are
+// active. It is meant to be called once at startup, before serving requests.
+func (s *productService) SetActiveByDefault(active bool) {
+	s.activeByDefault = active
+}
+
+// SetRejectInactiveCategory sets whether products may be created in
+// inactive categories, where they are never listed. It is meant to be called
+// once at startup, before serving requests.
+func (s *productService) SetRejectInactiveCategory(reject bool) {
+	s.rejectInactiveCategory = reject
+}
+
+// SetInvalidInputPolicy sets whether list pages beyond the maxima are
+// rejected or clamped; it is safe to call while serving requests.
+func (s *productService) SetInvalidInputPolicy(policy string) {
+	s.listPolicy.set(policy)
+}
+
+// SetHeavyOps makes bulk imports and price updates hold a connection of
+// heavyOps while they run. It is meant to be called once at startup, before
+// serving requests.
+func (s *productService) SetHeavyOps(heavyOps *semaphore.Weighted) {
+	s.heavyOps = heavyOps
+}
+
+func (s *productService) CreateProduct(ctx context.Context, req domain.CreateProductRequest) (*domain.Product, error) {
+	if err := s.validateCreate(ctx, &req); err != nil {
 		return nil, err
 	}
 
@@ -96,7 +210,7 @@ func (s *productService) CreateProduct(ctx context.Context, req domain.CreatePro
 		return nil, domain.ErrProductSlugExists
 	}
 
-	product, err := s.productRepo.Create(ctx, req)
+	product, err := s.productRepo.Create(ctx, req, int(s.maxPerCategory.Load()))
 	if err != nil {
 		log.WithError(err).WithFields(log.Fields{
 			"slug":        req.Slug,
@@ -109,13 +223,180 @@ func (s *productService) CreateProduct(ctx context.Context, req domain.CreatePro
 	return product, nil
 }
 
+// validateCreate checks req and fills in the fallback category, the default
+// is_active and the new product's ID.
+func (s *productService) validateCreate(ctx context.Context, req *domain.CreateProductRequest) error {
+	if req.IsActive == nil {
+		active := s.activeByDefault
+		req.IsActive = &active
+	}
+	if req.CategoryID == "" {
+		req.CategoryID = s.fallbackCategoryID
+	}
+	if req.CategoryID == "" {
+		return domain.ErrInvalidUUID
+	}
+	if _, err := uuid.Parse(req.CategoryID); err != nil {
+		return domain.ErrInvalidUUID
+	}
+	if err := domain.ValidateProductSlug(req.Slug); err != nil {
+		return err
+	}
+	if err := domain.ValidateProductName(req.Name, int(s.minNameLength.Load())); err != nil {
+		return err
+	}
+	if err := domain.ValidateProductPrice(req.PriceCoins); err != nil {
+		return err
+	}
+	if err := domain.ValidateProductStock(req.Stock); err != nil {
+		return err
+	}
+	if err := domain.ValidateProductContentSize(req.Description, req.Metadata, int(s.maxContentBytes.Load())); err != nil {
+		return err
+	}
+	if s.rejectInactiveCategory {
+		active, err := s.productRepo.IsCategoryActive(ctx, req.CategoryID)
+		if err != nil {
+			return err
+		}
+		if !active {
+			return domain.ErrCategoryInactive
+		}
+	}
+	if err := s.checkMetadata(ctx, req.CategoryID, req.Metadata); err != nil {
+		return err
+	}
+
+	id, err := s.newID()
+	if err != nil {
+		return err
+	}
+	req.ID = id
+	return nil
+}
+
+// ImportProducts creates every product of the batch independently, so one bad
+// row doesn't stop the rest. Rows without a slug get one derived from their
+// name; collisions within the batch or with existing products are resolved
+// by numbering, and the slug each row ended up with is reported back.
+func (s *productService) ImportProducts(ctx context.Context, req domain.ProductImportRequest) ([]domain.ProductImportResult, error) {
+	if len(req.Products) == 0 || len(req.Products) > domain.MaxProductImportRows {
+		return nil, domain.ErrInvalidProductImport
+	}
+
+	// Rows are written one after another, so the import holds one connection
+	if err := s.heavyOps.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	defer s.heavyOps.Release(1)
+
+	allocator := newSlugAllocator(s.productRepo)
+	maxPerCategory := int(s.maxPerCategory.Load())
+
+	// Explicit slugs are claimed up front, so generated ones never take them.
+	for _, row := range req.Products {
+		if row.Slug != "" {
+			allocator.claim(row.Slug)
+		}
+	}
+
+	results := make([]domain.ProductImportResult, len(req.Products))
+	seen := make(map[string]bool)
+	for i, row := range req.Products {
+		result := &results[i]
+		result.Index = i
+
+		generated := row.Slug == ""
+		if generated {
+			row.Slug = domain.Slugify(row.Name)
+		}
+		if err := s.validateCreate(ctx, &row); err != nil {
+			result.Err = err
+			continue
+		}
+
+		var product *domain.Product
+		var err error
+		if generated {
+			product, err = allocator.create(ctx, row, row.Slug, maxPerCategory)
+		} else if seen[row.Slug] {
+			err = domain.ErrProductSlugExists
+		} else {
+			seen[row.Slug] = true
+			product, err = s.productRepo.Create(ctx, row, maxPerCategory)
+		}
+		if err != nil {
+			result.Slug = row.Slug
+			result.Err = err
+			continue
+		}
+		result.Slug = product.Slug
+		result.Product = product
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	log.WithFields(log.Fields{
+		"rows":   len(results),
+		"failed": failed,
+	}).Info("Products imported")
+
+	return results, nil
+}
+
+// CloneProduct copies the product into a new inactive product with the same
+// category, price, and metadata. The copy gets the first free slug among
+// "<slug>-copy", "<slug>-copy-2", and so on.
+func (s *productService) CloneProduct(ctx context.Context, id string) (*domain.Product, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, domain.ErrInvalidUUID
+	}
+
+	source, err := s.productRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	cloneID, err := s.newID()
+	if err != nil {
+		return nil, err
+	}
+	inactive := false
+	req := domain.CreateProductRequest{
+		ID:          cloneID,
+		CategoryID:  source.CategoryID,
+		Name:        source.Name,
+		Description: source.Description,
+		PriceCoins:  source.PriceCoins,
+		Metadata:    source.Metadata,
+		IsActive:    &inactive,
+		Stock:       source.Stock,
+	}
+	product, err := newSlugAllocator(s.productRepo).create(ctx, req, domain.CloneSlug(source.Slug), int(s.maxPerCategory.Load()))
+	if err != nil {
+		log.WithError(err).WithField("product_id", id).Error("Failed to clone product")
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"source_id": id,
+		"clone_id":  product.ID,
+		"slug":      product.Slug,
+	}).Info("Product cloned")
+	return product, nil
+}
+
 func (s *productService) UpdateProduct(ctx context.Context, id string, req domain.UpdateProductRequest) (*domain.Product, error) {
 	if id == "" {
 		return nil, domain.ErrInvalidUUID
 	}
 
 	if req.Name != nil {
-		if err := domain.ValidateProductName(*req.Name); err != nil {
+		if err := domain.ValidateProductName(*req.Name, int(s.minNameLength.Load())); err != nil {
 			return nil, err
 		}
 	}
@@ -124,8 +405,39 @@ func (s *productService) UpdateProduct(ctx context.Context, id string, req domai
 			return nil, err
 		}
 	}
+	if err := domain.ValidateProductStock(req.Stock); err != nil {
+		return nil, err
+	}
+	maxContentBytes := int(s.maxContentBytes.Load())
+	checkContent := maxContentBytes > 0 && (req.Description != nil || req.Metadata != nil)
+	if req.CategoryID != nil || req.Metadata != nil || checkContent {
+		current, err := s.productRepo.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		categoryID, description, metadata := current.CategoryID, current.Description, current.Metadata
+		if req.CategoryID != nil {
+			categoryID = *req.CategoryID
+		}
+		if req.Description != nil {
+			description = *req.Description
+		}
+		if req.Metadata != nil {
+			metadata = *req.Metadata
+		}
+		if checkContent {
+			if err := domain.ValidateProductContentSize(description, metadata, maxContentBytes); err != nil {
+				return nil, err
+			}
+		}
+		if req.CategoryID != nil || req.Metadata != nil {
+			if err := s.checkMetadata(ctx, categoryID, metadata); err != nil {
+				return nil, err
+			}
+		}
+	}
 
-	product, err := s.productRepo.Update(ctx, id, req)
+	product, err := s.productRepo.Update(ctx, id, req, int(s.maxPerCategory.Load()))
 	if err != nil {
 		log.WithError(err).WithField("product_id", id).Error("Failed to update product")
 		return nil, err
@@ -134,6 +446,15 @@ func (s *productService) UpdateProduct(ctx context.Context, id string, req domai
 	return product, nil
 }
 
+// checkMetadata validates metadata against the schema of the category, if it has one.
+func (s *productService) checkMetadata(ctx context.Context, categoryID, metadata string) error {
+	schema, err := s.productRepo.GetCategoryMetadataSchema(ctx, categoryID)
+	if err != nil {
+		return err
+	}
+	return validateMetadata(schema, metadata)
+}
+
 func (s *productService) DeleteProduct(ctx context.Context, id string) error {
 	if id == "" {
 		return domain.ErrInvalidUUID
@@ -146,4 +467,112 @@ func (s *productService) DeleteProduct(ctx context.Context, id string) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+func (s *productService) UpdateCategoryPrices(ctx context.Context, categoryID string, req domain.BulkPriceUpdateRequest) (int64, error) {
+	if _, err := uuid.Parse(categoryID); err != nil {
+		return 0, domain.ErrInvalidUUID
+	}
+	if err := domain.ValidateBulkPriceUpdate(req); err != nil {
+		return 0, err
+	}
+
+	if err := s.heavyOps.Acquire(ctx, 1); err != nil {
+		return 0, err
+	}
+	updated, err := s.productRepo.UpdateCategoryPrices(ctx, categoryID, req)
+	s.heavyOps.Release(1)
+	if err != nil {
+		log.WithError(err).WithField("category_id", categoryID).Error("Failed to update category prices")
+		return 0, err
+	}
+
+	log.WithFields(log.Fields{
+		"category_id": categoryID,
+		"updated":     updated,
+	}).Info("Category prices updated")
+
+	return updated, nil
+}
+
+// SlugReservationCleanupPolicy names the table and column the janitor trims
+// for expired slug reservations; the retention numbers come from configuration.
+func SlugReservationCleanupPolicy() janitor.Policy {
+	return janitor.Policy{
+		Name:      "slug_reservations",
+		Table:     "slug_reservations",
+		AgeColumn: "expires_at",
+	}
+}
+
+func (s *productService) ReserveSlug(ctx context.Context, req domain.ReserveSlugRequest) (*domain.SlugReservation, error) {
+	if err := domain.ValidateProductSlug(req.Slug); err != nil {
+		return nil, err
+	}
+	if err := domain.ValidateSlugOwner(req.Owner); err != nil {
+		return nil, err
+	}
+
+	ttl := domain.DefaultSlugReservationTTL
+	if req.TTLSeconds != 0 {
+		if req.TTLSeconds < 0 || req.TTLSeconds > int64(domain.MaxSlugReservationTTL/time.Second) {
+			return nil, domain.ErrInvalidReservationTTL
+		}
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+
+	existing, err := s.productRepo.GetBySlug(ctx, req.Slug)
+	if err != nil && err != domain.ErrProductNotFound {
+		log.WithError(err).WithField("slug", req.Slug).Error("Failed to check product existence")
+		return nil, err
+	}
+	if existing != nil {
+		return nil, domain.ErrProductSlugExists
+	}
+
+	reservation, err := s.productRepo.ReserveSlug(ctx, req.Slug, req.Owner, time.Now().Add(ttl))
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"slug":       reservation.Slug,
+		"owner":      reservation.Owner,
+		"expires_at": reservation.ExpiresAt,
+	}).Info("Slug reserved")
+
+	return reservation, nil
+}
+
+func (s *productService) ReleaseSlug(ctx context.Context, req domain.ReleaseSlugRequest) error {
+	if err := domain.ValidateProductSlug(req.Slug); err != nil {
+		return err
+	}
+	if err := domain.ValidateSlugOwner(req.Owner); err != nil {
+		return err
+	}
+
+	return s.productRepo.ReleaseSlug(ctx, req.Slug, req.Owner)
+}
+
+func (s *productService) ListAllProducts(ctx context.Context, q domain.AdminProductQuery) (domain.Page[domain.Product], error) {
+	if q.SortBy == "" {
+		q.SortBy = "created_at"
+		q.Descending = true
+	}
+	if err := domain.ValidateProductSortField(q.SortBy); err != nil {
+		return domain.Page[domain.Product]{}, err
+	}
+	var err error
+	q.Limit, q.Offset, err = domain.ListPage(s.listPolicy.get(), q.Limit, q.Offset)
+	if err != nil {
+		return domain.Page[domain.Product]{}, err
+	}
+
+	products, total, err := s.productRepo.ListAll(ctx, q)
+	if err != nil {
+		log.WithError(err).Error("Failed to list all products")
+		return domain.Page[domain.Product]{}, err
+	}
+	return domain.Page[domain.Product]{Items: products, Total: total, Limit: q.Limit, Offset: q.Offset}, nil
+}
@@ -2,7 +2,12 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
 	"user-service/internal/domain"
+	"user-service/internal/jsonschema"
+	"user-service/internal/publicid"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -11,19 +16,91 @@ type ProductCategoryRepository interface {
 	ListCategories(ctx context.Context, onlyActive bool) ([]domain.ProductCategory, error)
 	GetByID(ctx context.Context, id string) (*domain.ProductCategory, error)
 	GetBySlug(ctx context.Context, slug string) (*domain.ProductCategory, error)
+	GetBySlugs(ctx context.Context, slugs []string) ([]domain.ProductCategory, error)
 	Create(ctx context.Context, req domain.CreateCategoryRequest) (*domain.ProductCategory, error)
+	Upsert(ctx context.Context, req domain.CreateCategoryRequest) (*domain.ProductCategory, bool, error)
 	Update(ctx context.Context, id string, req domain.UpdateCategoryRequest) (*domain.ProductCategory, error)
-	Delete(ctx context.Context, id string) error
+	Delete(ctx context.Context, id string, reassignTo string) error
+	CountActiveProducts(ctx context.Context) (map[string]int64, error)
+	CompactPositions(ctx context.Context) (int64, error)
 }
 
 type productCategoryService struct {
-	categoryRepo ProductCategoryRepository
+	categoryRepo  ProductCategoryRepository
+	minNameLength atomic.Int64
+	// fallbackID is the category that takes the products of deleted
+	// categories; empty when the fallback category is disabled.
+	fallbackID string
+	ids        publicid.Generator
 }
 
-func NewProductCategoryService(categoryRepo ProductCategoryRepository) *productCategoryService {
-	return &productCategoryService{
+func NewProductCategoryService(categoryRepo ProductCategoryRepository, minNameLength int) *productCategoryService {
+	s := &productCategoryService{
 		categoryRepo: categoryRepo,
+		ids:          publicid.UUIDv7{},
 	}
+	s.SetMinNameLength(minNameLength)
+	return s
+}
+
+// SetIDGenerator replaces how new category IDs are generated. It is meant to
+// be called once at startup, before serving requests.
+func (s *productCategoryService) SetIDGenerator(ids publicid.Generator) {
+	s.ids = ids
+}
+
+// newID returns the ID a new category is stored under.
+func (s *productCategoryService) newID() (string, error) {
+	id, err := s.ids.NewID()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate category id: %w", err)
+	}
+	return id, nil
+}
+
+// SetMinNameLength changes the minimum accepted name length; it is safe to call while serving requests.
+func (s *productCategoryService) SetMinNameLength(minLength int) {
+	if minLength < domain.DefaultMinNameLength {
+		minLength = domain.DefaultMinNameLength
+	}
+	s.minNameLength.Store(int64(minLength))
+}
+
+// EnsureFallbackCategory makes sure the category with slug exists, creating
+// it if needed, and makes it the home for products of deleted categories. It
+// is meant to be called once at startup, before serving requests.
+func (s *productCategoryService) EnsureFallbackCategory(ctx context.Context, slug string) (*domain.ProductCategory, error) {
+	if err := domain.ValidateCategorySlug(slug); err != nil {
+		return nil, err
+	}
+
+	category, err := s.categoryRepo.GetBySlug(ctx, slug)
+	if err == domain.ErrCategoryNotFound {
+		var id string
+		if id, err = s.newID(); err != nil {
+			return nil, err
+		}
+		category, err = s.categoryRepo.Create(ctx, domain.CreateCategoryRequest{
+			ID:       id,
+			Slug:     slug,
+			Name:     "Uncategorized",
+			IsActive: true,
+			// Take position 0 without disturbing the order of the others
+			OnConflict: domain.PositionConflictShift,
+		})
+		if err != nil {
+			// Another replica may have created it at the same time
+			category, err = s.categoryRepo.GetBySlug(ctx, slug)
+		} else {
+			log.WithField("slug", slug).Info("Created fallback product category")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.fallbackID = category.ID
+	return category, nil
 }
 
 func (s *productCategoryService) ListCategories(ctx context.Context, onlyActive bool) ([]domain.ProductCategory, error) {
@@ -47,7 +124,9 @@ func (s *productCategoryService) GetCategoryByID(ctx context.Context, id string)
 	return category, nil
 }
 
-func (s *productCategoryService) GetCategoryBySlug(ctx context.Context, slug string) (*domain.ProductCategory, error) {
+// GetCategoryBySlug returns the category with slug. Unless includeInactive
+// is set, an inactive category is reported as not found.
+func (s *productCategoryService) GetCategoryBySlug(ctx context.Context, slug string, includeInactive bool) (*domain.ProductCategory, error) {
 	if err := domain.ValidateCategorySlug(slug); err != nil {
 		return nil, err
 	}
@@ -56,16 +135,49 @@ func (s *productCategoryService) GetCategoryBySlug(ctx context.Context, slug str
 	if err != nil {
 		return nil, err
 	}
+	if !includeInactive && !category.IsActive {
+		return nil, domain.ErrCategoryNotFound
+	}
 	return category, nil
 }
 
+// GetCategoriesBySlugs returns the categories with the given slugs, keyed by
+// slug. Missing slugs, and inactive categories unless includeInactive is
+// set, are absent from the result.
+func (s *productCategoryService) GetCategoriesBySlugs(ctx context.Context, slugs []string, includeInactive bool) (map[string]domain.ProductCategory, error) {
+	slugs, err := domain.NormalizeCategorySlugs(slugs)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := s.categoryRepo.GetBySlugs(ctx, slugs)
+	if err != nil {
+		log.WithError(err).WithField("slugs", len(slugs)).Error("Failed to get product categories by slugs")
+		return nil, err
+	}
+
+	bySlug := make(map[string]domain.ProductCategory, len(categories))
+	for _, category := range categories {
+		if includeInactive || category.IsActive {
+			bySlug[category.Slug] = category
+		}
+	}
+	return bySlug, nil
+}
+
 func (s *productCategoryService) CreateCategory(ctx context.Context, req domain.CreateCategoryRequest) (*domain.ProductCategory, error) {
 	if err := domain.ValidateCategorySlug(req.Slug); err != nil {
 		return nil, err
 	}
-	if err := domain.ValidateCategoryName(req.Name); err != nil {
+	if err := domain.ValidateCategoryName(req.Name, int(s.minNameLength.Load())); err != nil {
 		return nil, err
 	}
+	if err := validateMetadataSchema(req.MetadataSchema); err != nil {
+		return nil, err
+	}
+	if req.OnConflict == "" {
+		req.OnConflict = domain.PositionConflictError
+	}
 
 	existing, err := s.categoryRepo.GetBySlug(ctx, req.Slug)
 	if err != nil && err != domain.ErrCategoryNotFound {
@@ -76,6 +188,9 @@ func (s *productCategoryService) CreateCategory(ctx context.Context, req domain.
 		return nil, domain.ErrCategorySlugExists
 	}
 
+	if req.ID, err = s.newID(); err != nil {
+		return nil, err
+	}
 	category, err := s.categoryRepo.Create(ctx, req)
 	if err != nil {
 		log.WithError(err).WithFields(log.Fields{
@@ -88,16 +203,54 @@ func (s *productCategoryService) CreateCategory(ctx context.Context, req domain.
 	return category, nil
 }
 
+// EnsureCategory creates the category with req.Slug, or brings an existing
+// one in line with req, so provisioning can be re-run safely. It reports
+// whether the category was created.
+func (s *productCategoryService) EnsureCategory(ctx context.Context, req domain.CreateCategoryRequest) (*domain.ProductCategory, bool, error) {
+	if err := domain.ValidateCategorySlug(req.Slug); err != nil {
+		return nil, false, err
+	}
+	if err := domain.ValidateCategoryName(req.Name, int(s.minNameLength.Load())); err != nil {
+		return nil, false, err
+	}
+	if err := validateMetadataSchema(req.MetadataSchema); err != nil {
+		return nil, false, err
+	}
+	if req.OnConflict == "" {
+		req.OnConflict = domain.PositionConflictError
+	}
+
+	// Only used if the category is created
+	id, err := s.newID()
+	if err != nil {
+		return nil, false, err
+	}
+	req.ID = id
+	category, created, err := s.categoryRepo.Upsert(ctx, req)
+	if err != nil {
+		log.WithError(err).WithField("slug", req.Slug).Error("Failed to ensure product category")
+		return nil, false, err
+	}
+
+	return category, created, nil
+}
+
 func (s *productCategoryService) UpdateCategory(ctx context.Context, id string, req domain.UpdateCategoryRequest) (*domain.ProductCategory, error) {
 	if id == "" {
 		return nil, domain.ErrInvalidUUID
 	}
 
 	if req.Name != nil {
-		if err := domain.ValidateCategoryName(*req.Name); err != nil {
+		if err := domain.ValidateCategoryName(*req.Name, int(s.minNameLength.Load())); err != nil {
 			return nil, err
 		}
 	}
+	if err := validateMetadataSchema(req.MetadataSchema); err != nil {
+		return nil, err
+	}
+	if req.OnConflict == "" {
+		req.OnConflict = domain.PositionConflictError
+	}
 
 	category, err := s.categoryRepo.Update(ctx, id, req)
 	if err != nil {
@@ -113,11 +266,66 @@ func (s *productCategoryService) DeleteCategory(ctx context.Context, id string)
 		return domain.ErrInvalidUUID
 	}
 
-	err := s.categoryRepo.Delete(ctx, id)
+	if s.fallbackID != "" && id == s.fallbackID {
+		return domain.ErrCategoryProtected
+	}
+
+	err := s.categoryRepo.Delete(ctx, id, s.fallbackID)
 	if err != nil {
 		log.WithError(err).WithField("category_id", id).Error("Failed to delete product category")
 		return err
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// CompactPositions renumbers categories 1..N in display order.
+func (s *productCategoryService) CompactPositions(ctx context.Context) (int64, error) {
+	updated, err := s.categoryRepo.CompactPositions(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	log.WithField("updated", updated).Info("Product category positions compacted")
+	return updated, nil
+}
+
+func (s *productCategoryService) CountActiveProducts(ctx context.Context) (map[string]int64, error) {
+	counts, err := s.categoryRepo.CountActiveProducts(ctx)
+	if err != nil {
+		log.WithError(err).Error("Failed to count products per category")
+		return nil, err
+	}
+	return counts, nil
+}
+
+// validateMetadataSchema rejects schemas the validator cannot apply. An absent
+// or null schema is valid and disables metadata validation.
+func validateMetadataSchema(raw json.RawMessage) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	if _, err := jsonschema.Compile(raw); err != nil {
+		return &domain.SchemaError{Err: domain.ErrInvalidMetadataSchema, Detail: err.Error()}
+	}
+	return nil
+}
+
+// validateMetadata checks metadata against a category's schema. Missing
+// metadata is checked as an empty object, so required properties are enforced.
+func validateMetadata(schema json.RawMessage, metadata string) error {
+	if len(schema) == 0 {
+		return nil
+	}
+	compiled, err := jsonschema.Compile(schema)
+	if err != nil {
+		return &domain.SchemaError{Err: domain.ErrInvalidMetadataSchema, Detail: err.Error()}
+	}
+	if metadata == "" {
+		metadata = "{}"
+	}
+	if err := compiled.ValidateJSON([]byte(metadata)); err != nil {
+		return &domain.SchemaError{Err: domain.ErrInvalidProductMetadata, Detail: err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,817 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"user-service/internal/domain"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+// fakeProductRepo stores created products by slug.
+type fakeProductRepo struct {
+	ProductRepository
+	bySlug map[string]*domain.Product
+	byID   map[string]*domain.Product
+	// activeCategories holds the is_active of known categories; the
+	// lookups are counted in categoryLookups.
+	activeCategories map[string]bool
+	categoryLookups  int
+}
+
+func newFakeProductRepo() *fakeProductRepo {
+	return &fakeProductRepo{bySlug: map[string]*domain.Product{}, byID: map[string]*domain.Product{}}
+}
+
+func (f *fakeProductRepo) GetBySlug(ctx context.Context, slug string) (*domain.Product, error) {
+	if p, ok := f.bySlug[slug]; ok {
+		return p, nil
+	}
+	return nil, domain.ErrProductNotFound
+}
+
+func (f *fakeProductRepo) IsCategoryActive(ctx context.Context, categoryID string) (bool, error) {
+	f.categoryLookups++
+	active, ok := f.activeCategories[categoryID]
+	if !ok {
+		return false, domain.ErrCategoryNotFound
+	}
+	return active, nil
+}
+
+func (f *fakeProductRepo) GetByID(ctx context.Context, id string) (*domain.Product, error) {
+	if p, ok := f.byID[id]; ok {
+		return p, nil
+	}
+	return nil, domain.ErrProductNotFound
+}
+
+func (f *fakeProductRepo) Create(ctx context.Context, req domain.CreateProductRequest, maxPerCategory int) (*domain.Product, error) {
+	if _, ok := f.bySlug[req.Slug]; ok {
+		return nil, domain.ErrProductSlugExists
+	}
+	p := &domain.Product{
+		ID:          req.ID,
+		CategoryID:  req.CategoryID,
+		Slug:        req.Slug,
+		Name:        req.Name,
+		Description: req.Description,
+		PriceCoins:  req.PriceCoins,
+		Metadata:    req.Metadata,
+		IsActive:    *req.IsActive,
+		Stock:       req.Stock,
+	}
+	f.bySlug[p.Slug] = p
+	f.byID[p.ID] = p
+	return p, nil
+}
+
+func (f *fakeProductRepo) Update(ctx context.Context, id string, req domain.UpdateProductRequest, maxPerCategory int) (*domain.Product, error) {
+	p, ok := f.byID[id]
+	if !ok {
+		return nil, domain.ErrProductNotFound
+	}
+	if req.CategoryID != nil {
+		p.CategoryID = *req.CategoryID
+	}
+	if req.Name != nil {
+		p.Name = *req.Name
+	}
+	if req.Description != nil {
+		p.Description = *req.Description
+	}
+	if req.PriceCoins != nil {
+		p.PriceCoins = *req.PriceCoins
+	}
+	if req.Metadata != nil {
+		p.Metadata = *req.Metadata
+	}
+	if req.IsActive != nil {
+		p.IsActive = *req.IsActive
+	}
+	if req.Stock != nil {
+		p.Stock = req.Stock
+	}
+	return p, nil
+}
+
+func (f *fakeProductRepo) GetCategoryMetadataSchema(ctx context.Context, categoryID string) (json.RawMessage, error) {
+	return nil, nil
+}
+
+// assertTimeOrderedIDs checks ids are distinct version 7 UUIDs in order.
+func assertTimeOrderedIDs(t *testing.T, ids ...string) {
+	t.Helper()
+	for i, id := range ids {
+		u, err := uuid.Parse(id)
+		if err != nil || u.Version() != 7 {
+			t.Fatalf("ID %q is not a version 7 UUID", id)
+		}
+		if i > 0 && id <= ids[i-1] {
+			t.Errorf("ID %s is not after %s", id, ids[i-1])
+		}
+	}
+}
+
+func TestNewProductsGetTimeOrderedIDs(t *testing.T) {
+	ctx := context.Background()
+	svc := NewProductService(newFakeProductRepo(), 1)
+	categoryID := uuid.NewString()
+
+	created, err := svc.CreateProduct(ctx, domain.CreateProductRequest{CategoryID: categoryID, Slug: "book", Name: "Book", PriceCoins: 10})
+	if err != nil {
+		t.Fatalf("CreateProduct: %v", err)
+	}
+	results, err := svc.ImportProducts(ctx, domain.ProductImportRequest{Products: []domain.CreateProductRequest{
+		{CategoryID: categoryID, Slug: "pen", Name: "Pen", PriceCoins: 2},
+		{CategoryID: categoryID, Name: "Pen", PriceCoins: 3},
+	}})
+	if err != nil {
+		t.Fatalf("ImportProducts: %v", err)
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatalf("import row %d: %v", r.Index, r.Err)
+		}
+	}
+	clone, err := svc.CloneProduct(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("CloneProduct: %v", err)
+	}
+
+	assertTimeOrderedIDs(t, created.ID, results[0].Product.ID, results[1].Product.ID, clone.ID)
+}
+
+type failingIDs struct{}
+
+func (failingIDs) NewID() (string, error) { return "", errors.New("entropy exhausted") }
+
+func TestProductIDGeneratorFailure(t *testing.T) {
+	repo := newFakeProductRepo()
+	svc := NewProductService(repo, 1)
+	svc.SetIDGenerator(failingIDs{})
+
+	_, err := svc.CreateProduct(context.Background(), domain.CreateProductRequest{CategoryID: uuid.NewString(), Slug: "book", Name: "Book", PriceCoins: 10})
+	if err == nil {
+		t.Fatal("CreateProduct succeeded without an ID")
+	}
+	if len(repo.bySlug) != 0 {
+		t.Errorf("%d products created", len(repo.bySlug))
+	}
+}
+
+// fakeCategoryRepo stores created categories by slug.
+type fakeCategoryRepo struct {
+	ProductCategoryRepository
+	bySlug map[string]*domain.ProductCategory
+	// lookups records the slugs of each GetBySlugs call.
+	lookups [][]string
+}
+
+func (f *fakeCategoryRepo) GetBySlugs(ctx context.Context, slugs []string) ([]domain.ProductCategory, error) {
+	f.lookups = append(f.lookups, slugs)
+	var found []domain.ProductCategory
+	for _, slug := range slugs {
+		if c, ok := f.bySlug[slug]; ok {
+			found = append(found, *c)
+		}
+	}
+	return found, nil
+}
+
+func (f *fakeCategoryRepo) GetBySlug(ctx context.Context, slug string) (*domain.ProductCategory, error) {
+	if c, ok := f.bySlug[slug]; ok {
+		return c, nil
+	}
+	return nil, domain.ErrCategoryNotFound
+}
+
+func (f *fakeCategoryRepo) Create(ctx context.Context, req domain.CreateCategoryRequest) (*domain.ProductCategory, error) {
+	c := &domain.ProductCategory{ID: req.ID, Slug: req.Slug, Name: req.Name, CreatedAt: time.Now()}
+	f.bySlug[c.Slug] = c
+	return c, nil
+}
+
+func (f *fakeCategoryRepo) Upsert(ctx context.Context, req domain.CreateCategoryRequest) (*domain.ProductCategory, bool, error) {
+	if c, ok := f.bySlug[req.Slug]; ok {
+		c.Name = req.Name
+		return c, false, nil
+	}
+	c, err := f.Create(ctx, req)
+	return c, true, err
+}
+
+func TestNewCategoriesGetTimeOrderedIDs(t *testing.T) {
+	ctx := context.Background()
+	svc := NewProductCategoryService(&fakeCategoryRepo{bySlug: map[string]*domain.ProductCategory{}}, 1)
+
+	fallback, err := svc.EnsureFallbackCategory(ctx, "uncategorized")
+	if err != nil {
+		t.Fatalf("EnsureFallbackCategory: %v", err)
+	}
+	books, err := svc.CreateCategory(ctx, domain.CreateCategoryRequest{Slug: "books", Name: "Books"})
+	if err != nil {
+		t.Fatalf("CreateCategory: %v", err)
+	}
+	pens, created, err := svc.EnsureCategory(ctx, domain.CreateCategoryRequest{Slug: "pens", Name: "Pens"})
+	if err != nil || !created {
+		t.Fatalf("EnsureCategory: created %v, %v", created, err)
+	}
+	assertTimeOrderedIDs(t, fallback.ID, books.ID, pens.ID)
+
+	// Re-running keeps the category's ID
+	again, created, err := svc.EnsureCategory(ctx, domain.CreateCategoryRequest{Slug: "pens", Name: "Pens and pencils"})
+	if err != nil || created || again.ID != pens.ID {
+		t.Fatalf("second EnsureCategory: ID %s, created %v, %v; want %s", again.ID, created, err, pens.ID)
+	}
+}
+
+type repricingProductRepo struct {
+	ProductRepository
+	calls int
+}
+
+func (r *repricingProductRepo) UpdateCategoryPrices(ctx context.Context, categoryID string, req domain.BulkPriceUpdateRequest) (int64, error) {
+	r.calls++
+	return 3, nil
+}
+
+func TestUpdateCategoryPricesValidation(t *testing.T) {
+	const categoryID = "0190f1a2-0000-7000-8000-000000000001"
+	percent := func(p int) *int { return &p }
+	coins := func(c int64) *int64 { return &c }
+
+	tests := []struct {
+		name    string
+		req     domain.BulkPriceUpdateRequest
+		wantErr error
+	}{
+		{"percent off", domain.BulkPriceUpdateRequest{Percent: percent(-20)}, nil},
+		{"largest cut", domain.BulkPriceUpdateRequest{Percent: percent(-99)}, nil},
+		{"largest raise", domain.BulkPriceUpdateRequest{Percent: percent(1000)}, nil},
+		{"absolute", domain.BulkPriceUpdateRequest{SetCoins: coins(500)}, nil},
+		{"absolute maximum", domain.BulkPriceUpdateRequest{SetCoins: coins(domain.MaxProductPrice)}, nil},
+		{"zero percent", domain.BulkPriceUpdateRequest{Percent: percent(0)}, domain.ErrInvalidPriceAdjustment},
+		{"free", domain.BulkPriceUpdateRequest{Percent: percent(-100)}, domain.ErrInvalidPriceAdjustment},
+		{"raise too large", domain.BulkPriceUpdateRequest{Percent: percent(1001)}, domain.ErrInvalidPriceAdjustment},
+		{"neither", domain.BulkPriceUpdateRequest{}, domain.ErrInvalidPriceAdjustment},
+		{"both", domain.BulkPriceUpdateRequest{Percent: percent(-20), SetCoins: coins(500)}, domain.ErrInvalidPriceAdjustment},
+		{"absolute below minimum", domain.BulkPriceUpdateRequest{SetCoins: coins(0)}, domain.ErrInvalidPrice},
+		{"absolute above maximum", domain.BulkPriceUpdateRequest{SetCoins: coins(domain.MaxProductPrice + 1)}, domain.ErrInvalidPrice},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &repricingProductRepo{}
+			svc := NewProductService(repo, 1)
+			updated, err := svc.UpdateCategoryPrices(context.Background(), categoryID, tt.req)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if repo.calls != 0 {
+					t.Error("invalid adjustment reached the repository")
+				}
+				return
+			}
+			if updated != 3 || repo.calls != 1 {
+				t.Errorf("updated %d in %d calls, want 3 in one", updated, repo.calls)
+			}
+		})
+	}
+
+	if _, err := NewProductService(&repricingProductRepo{}, 1).UpdateCategoryPrices(context.Background(), "books", domain.BulkPriceUpdateRequest{Percent: percent(-20)}); err != domain.ErrInvalidUUID {
+		t.Errorf("category slug: %v, want ErrInvalidUUID", err)
+	}
+}
+
+// adminListRepo records the admin list query it was given.
+type adminListRepo struct {
+	ProductRepository
+	query *domain.AdminProductQuery
+}
+
+func (r *adminListRepo) ListAll(ctx context.Context, q domain.AdminProductQuery) ([]domain.Product, int64, error) {
+	r.query = &q
+	return nil, 0, nil
+}
+
+func TestListAllProductsQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   domain.AdminProductQuery
+		want    domain.AdminProductQuery
+		wantErr error
+	}{
+		{"defaults to newest first, inactive included",
+			domain.AdminProductQuery{},
+			domain.AdminProductQuery{SortBy: "created_at", Descending: true, Limit: 10}, nil},
+		{"only active kept",
+			domain.AdminProductQuery{OnlyActive: true, Limit: 20},
+			domain.AdminProductQuery{OnlyActive: true, SortBy: "created_at", Descending: true, Limit: 20}, nil},
+		{"explicit sort kept",
+			domain.AdminProductQuery{SortBy: "price_coins", Limit: 5, Offset: 15},
+			domain.AdminProductQuery{SortBy: "price_coins", Limit: 5, Offset: 15}, nil},
+		{"unknown sort rejected",
+			domain.AdminProductQuery{SortBy: "price_coins; DROP TABLE products"},
+			domain.AdminProductQuery{}, domain.ErrInvalidSortField},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &adminListRepo{}
+			_, err := NewProductService(repo, 1).ListAllProducts(context.Background(), tt.query)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if repo.query != nil {
+					t.Errorf("rejected query reached the repository")
+				}
+				return
+			}
+			if *repo.query != tt.want {
+				t.Errorf("repository queried with %+v, want %+v", *repo.query, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateWithoutCategoryUsesFallback(t *testing.T) {
+	const slug = "uncategorized"
+	chosen := "0190f1a2-0000-7000-8000-000000000001"
+
+	for _, enabled := range []bool{false, true} {
+		ctx := context.Background()
+		categoryRepo := &fakeCategoryRepo{bySlug: map[string]*domain.ProductCategory{}}
+		categories := NewProductCategoryService(categoryRepo, 1)
+		products := NewProductService(newFakeProductRepo(), 1)
+
+		// As main wires it up when the feature is on
+		var fallbackID string
+		if enabled {
+			fallback, err := categories.EnsureFallbackCategory(ctx, slug)
+			if err != nil {
+				t.Fatalf("EnsureFallbackCategory: %v", err)
+			}
+			products.SetFallbackCategory(fallback.ID)
+			fallbackID = fallback.ID
+
+			// A restart finds the category instead of creating another
+			again, err := categories.EnsureFallbackCategory(ctx, slug)
+			if err != nil || again.ID != fallback.ID || len(categoryRepo.bySlug) != 1 {
+				t.Fatalf("second EnsureFallbackCategory: %v, %v with %d categories", again, err, len(categoryRepo.bySlug))
+			}
+		}
+
+		uncategorized, err := products.CreateProduct(ctx, domain.CreateProductRequest{Slug: "loose", Name: "Loose", PriceCoins: 10})
+		if enabled {
+			if err != nil || uncategorized.CategoryID != fallbackID {
+				t.Errorf("enabled: created %v, %v; want it in %s", uncategorized, err, fallbackID)
+			}
+		} else if err != domain.ErrInvalidUUID {
+			t.Errorf("disabled: created %v, %v; want ErrInvalidUUID", uncategorized, err)
+		}
+
+		// A given category is never replaced by the fallback
+		placed, err := products.CreateProduct(ctx, domain.CreateProductRequest{CategoryID: chosen, Slug: "placed", Name: "Placed", PriceCoins: 10})
+		if err != nil || placed.CategoryID != chosen {
+			t.Errorf("enabled %v: created %v, %v; want it in %s", enabled, placed, err, chosen)
+		}
+	}
+}
+
+func TestCloneProduct(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeProductRepo()
+	svc := NewProductService(repo, 1)
+	stock := int64(4)
+	active := true
+	source, err := svc.CreateProduct(ctx, domain.CreateProductRequest{
+		CategoryID:  uuid.NewString(),
+		Slug:        "desk-lamp",
+		Name:        "Desk lamp",
+		Description: "Warm light",
+		PriceCoins:  40,
+		Metadata:    `{"watts":6}`,
+		IsActive:    &active,
+		Stock:       &stock,
+	})
+	if err != nil {
+		t.Fatalf("CreateProduct: %v", err)
+	}
+	// Someone already made a copy by hand
+	if _, err := svc.CreateProduct(ctx, domain.CreateProductRequest{CategoryID: source.CategoryID, Slug: "desk-lamp-copy", Name: "Desk lamp", PriceCoins: 40}); err != nil {
+		t.Fatalf("CreateProduct: %v", err)
+	}
+
+	var slugs []string
+	for range 2 {
+		clone, err := svc.CloneProduct(ctx, source.ID)
+		if err != nil {
+			t.Fatalf("CloneProduct: %v", err)
+		}
+		if clone.ID == source.ID || clone.IsActive {
+			t.Errorf("clone %s active %v, want a new inactive product", clone.ID, clone.IsActive)
+		}
+		if clone.CategoryID != source.CategoryID || clone.Name != source.Name || clone.Description != source.Description ||
+			clone.PriceCoins != source.PriceCoins || clone.Metadata != source.Metadata || *clone.Stock != stock {
+			t.Errorf("clone %+v does not copy %+v", clone, source)
+		}
+		slugs = append(slugs, clone.Slug)
+	}
+	if slugs[0] != "desk-lamp-copy-2" || slugs[1] != "desk-lamp-copy-3" {
+		t.Errorf("clone slugs %v, want the first free ones after desk-lamp-copy", slugs)
+	}
+	if !repo.byID[source.ID].IsActive || repo.byID[source.ID].Slug != "desk-lamp" {
+		t.Errorf("source changed by cloning: %+v", repo.byID[source.ID])
+	}
+
+	// A slug at the length limit is shortened to fit the suffix
+	long, err := svc.CreateProduct(ctx, domain.CreateProductRequest{CategoryID: source.CategoryID, Slug: strings.Repeat("a", 50), Name: "Long", PriceCoins: 1})
+	if err != nil {
+		t.Fatalf("CreateProduct: %v", err)
+	}
+	long45 := strings.Repeat("a", 45)
+	seen := map[string]bool{long.Slug: true}
+	for i := range 2 {
+		clone, err := svc.CloneProduct(ctx, long.ID)
+		if err != nil {
+			t.Fatalf("CloneProduct of a long slug: %v", err)
+		}
+		if len(clone.Slug) > 50 || !strings.HasPrefix(clone.Slug, long45[:43]) || seen[clone.Slug] {
+			t.Errorf("clone %d of a long slug got %s, want a new slug of at most 50 characters", i, clone.Slug)
+		}
+		if i == 0 && clone.Slug != long45+"-copy" {
+			t.Errorf("first clone of a long slug got %s, want %s-copy", clone.Slug, long45)
+		}
+		seen[clone.Slug] = true
+	}
+
+	if _, err := svc.CloneProduct(ctx, "lamp"); err != domain.ErrInvalidUUID {
+		t.Errorf("CloneProduct of a malformed ID: got %v, want ErrInvalidUUID", err)
+	}
+	if _, err := svc.CloneProduct(ctx, uuid.NewString()); err != domain.ErrProductNotFound {
+		t.Errorf("CloneProduct of a missing product: got %v, want ErrProductNotFound", err)
+	}
+}
+
+func TestProductContentCap(t *testing.T) {
+	const limit = 64
+	ctx := context.Background()
+	repo := newFakeProductRepo()
+	svc := NewProductService(repo, 1)
+	svc.SetMaxProductContentBytes(limit)
+	categoryID := uuid.NewString()
+	// metadata returns a JSON object of exactly n bytes.
+	metadata := func(n int) string { return `{"k":"` + strings.Repeat("m", n-8) + `"}` }
+	create := func(slug string, description, meta string) (*domain.Product, error) {
+		return svc.CreateProduct(ctx, domain.CreateProductRequest{
+			CategoryID: categoryID, Slug: slug, Name: "Lamp", PriceCoins: 10,
+			Description: description, Metadata: meta,
+		})
+	}
+
+	if _, err := create("at-limit", strings.Repeat("d", 40), metadata(24)); err != nil {
+		t.Fatalf("create at the limit: %v", err)
+	}
+	var tooLarge *domain.ProductContentTooLargeError
+	if _, err := create("over-limit", strings.Repeat("d", 40), metadata(25)); !errors.As(err, &tooLarge) || tooLarge.Bytes != limit+1 {
+		t.Errorf("create one byte over: got %v, want ProductContentTooLargeError for %d bytes", err, limit+1)
+	}
+	if _, ok := repo.bySlug["over-limit"]; ok {
+		t.Errorf("oversized product stored")
+	}
+
+	product, err := create("lamp", strings.Repeat("d", 30), metadata(20))
+	if err != nil {
+		t.Fatalf("CreateProduct: %v", err)
+	}
+	description := func(n int) *string { d := strings.Repeat("d", n); return &d }
+	meta := func(n int) *string { m := metadata(n); return &m }
+	updates := []struct {
+		name    string
+		req     domain.UpdateProductRequest
+		wantErr bool
+	}{
+		// The stored field counts toward the cap when only the other one changes
+		{"description up to the limit", domain.UpdateProductRequest{Description: description(44)}, false},
+		{"description past the limit", domain.UpdateProductRequest{Description: description(45)}, true},
+		{"metadata past the limit", domain.UpdateProductRequest{Metadata: meta(21)}, true},
+		{"both at the limit", domain.UpdateProductRequest{Description: description(32), Metadata: meta(32)}, false},
+		{"both past the limit", domain.UpdateProductRequest{Description: description(33), Metadata: meta(32)}, true},
+	}
+	for _, u := range updates {
+		before := *repo.byID[product.ID]
+		_, err := svc.UpdateProduct(ctx, product.ID, u.req)
+		if u.wantErr != errors.Is(err, domain.ErrProductContentTooLarge) || !u.wantErr && err != nil {
+			t.Errorf("%s: got %v, want too large %v", u.name, err, u.wantErr)
+		}
+		if after := repo.byID[product.ID]; u.wantErr && (after.Description != before.Description || after.Metadata != before.Metadata) {
+			t.Errorf("%s: rejected update was stored", u.name)
+		}
+	}
+
+	// Lifting the cap takes effect on the next request
+	svc.SetMaxProductContentBytes(0)
+	if _, err := svc.UpdateProduct(ctx, product.ID, domain.UpdateProductRequest{Description: description(10 * limit)}); err != nil {
+		t.Errorf("update with the cap lifted: %v", err)
+	}
+}
+
+func TestEnsureCategory(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeCategoryRepo{bySlug: map[string]*domain.ProductCategory{}}
+	svc := NewProductCategoryService(repo, 1)
+
+	first, created, err := svc.EnsureCategory(ctx, domain.CreateCategoryRequest{Slug: "board-games", Name: "Board games"})
+	if err != nil || !created {
+		t.Fatalf("first EnsureCategory: created %v, %v", created, err)
+	}
+	second, created, err := svc.EnsureCategory(ctx, domain.CreateCategoryRequest{Slug: "board-games", Name: "Tabletop games"})
+	if err != nil || created {
+		t.Fatalf("second EnsureCategory: created %v, %v", created, err)
+	}
+	if second.ID != first.ID || second.Name != "Tabletop games" || len(repo.bySlug) != 1 {
+		t.Errorf("second EnsureCategory returned %+v with %d categories, want %s renamed", second, len(repo.bySlug), first.ID)
+	}
+
+	// Invalid input never reaches the repository
+	invalid := []struct {
+		req  domain.CreateCategoryRequest
+		want error
+	}{
+		{domain.CreateCategoryRequest{Slug: "board games", Name: "Board games"}, domain.ErrInvalidCategorySlug},
+		{domain.CreateCategoryRequest{Slug: "card-games", Name: "  "}, domain.ErrInvalidCategoryName},
+		{domain.CreateCategoryRequest{Slug: "card-games", Name: "Card games", MetadataSchema: []byte(`{"type":`)}, domain.ErrInvalidMetadataSchema},
+	}
+	for _, tt := range invalid {
+		if _, _, err := svc.EnsureCategory(ctx, tt.req); !errors.Is(err, tt.want) {
+			t.Errorf("EnsureCategory(%+v): got %v, want %v", tt.req, err, tt.want)
+		}
+	}
+	if len(repo.bySlug) != 1 {
+		t.Errorf("invalid requests stored categories: %v", repo.bySlug)
+	}
+}
+
+func TestGetBySlugHidesInactive(t *testing.T) {
+	ctx := context.Background()
+	products := newFakeProductRepo()
+	products.bySlug["retired"] = &domain.Product{ID: uuid.NewString(), Slug: "retired"}
+	categories := &fakeCategoryRepo{bySlug: map[string]*domain.ProductCategory{
+		"retired": {ID: uuid.NewString(), Slug: "retired"},
+	}}
+	productSvc := NewProductService(products, 1)
+	categorySvc := NewProductCategoryService(categories, 1)
+
+	if _, err := productSvc.GetProductBySlug(ctx, "retired", false); err != domain.ErrProductNotFound {
+		t.Errorf("public product lookup: got %v, want ErrProductNotFound", err)
+	}
+	if p, err := productSvc.GetProductBySlug(ctx, "retired", true); err != nil || p.Slug != "retired" {
+		t.Errorf("admin product lookup: got %v, %v", p, err)
+	}
+	if _, err := categorySvc.GetCategoryBySlug(ctx, "retired", false); err != domain.ErrCategoryNotFound {
+		t.Errorf("public category lookup: got %v, want ErrCategoryNotFound", err)
+	}
+	if c, err := categorySvc.GetCategoryBySlug(ctx, "retired", true); err != nil || c.Slug != "retired" {
+		t.Errorf("admin category lookup: got %v, %v", c, err)
+	}
+}
+
+func TestGetCategoriesBySlugs(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeCategoryRepo{bySlug: map[string]*domain.ProductCategory{
+		"books":   {ID: uuid.NewString(), Slug: "books", IsActive: true},
+		"pens":    {ID: uuid.NewString(), Slug: "pens", IsActive: true},
+		"retired": {ID: uuid.NewString(), Slug: "retired"},
+	}}
+	svc := NewProductCategoryService(repo, 1)
+	requested := []string{"books", " pens ", "missing", "books", "retired", "also-missing"}
+
+	tests := []struct {
+		includeInactive bool
+		want            []string
+	}{
+		{false, []string{"books", "pens"}},
+		{true, []string{"books", "pens", "retired"}},
+	}
+	for _, tt := range tests {
+		got, err := svc.GetCategoriesBySlugs(ctx, requested, tt.includeInactive)
+		if err != nil {
+			t.Fatalf("GetCategoriesBySlugs: %v", err)
+		}
+		var slugs []string
+		for slug, c := range got {
+			if c.Slug != slug || c.ID != repo.bySlug[slug].ID {
+				t.Errorf("%s keys category %+v", slug, c)
+			}
+			slugs = append(slugs, slug)
+		}
+		sort.Strings(slugs)
+		if !reflect.DeepEqual(slugs, tt.want) {
+			t.Errorf("includeInactive %v: got %v, want %v", tt.includeInactive, slugs, tt.want)
+		}
+	}
+	// Slugs reach the repository trimmed and once each
+	if want := []string{"books", "pens", "missing", "retired", "also-missing"}; !reflect.DeepEqual(repo.lookups[0], want) {
+		t.Errorf("looked up %v, want %v", repo.lookups[0], want)
+	}
+
+	// None found is an empty result, not an error
+	if got, err := svc.GetCategoriesBySlugs(ctx, []string{"missing"}, true); err != nil || len(got) != 0 {
+		t.Errorf("only missing slugs: got %v, %v, want an empty result", got, err)
+	}
+
+	tooMany := make([]string, domain.MaxCategorySlugLookup+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("category-%d", i)
+	}
+	invalid := []struct {
+		name  string
+		slugs []string
+		want  error
+	}{
+		{"none", nil, domain.ErrInvalidSlugLookup},
+		{"too many", tooMany, domain.ErrInvalidSlugLookup},
+		{"malformed", []string{"books", "Board Games"}, domain.ErrInvalidCategorySlug},
+		{"blank", []string{"books", "  "}, domain.ErrInvalidCategorySlug},
+	}
+	lookups := len(repo.lookups)
+	for _, tt := range invalid {
+		if _, err := svc.GetCategoriesBySlugs(ctx, tt.slugs, true); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if len(repo.lookups) != lookups {
+		t.Errorf("invalid lookups reached the repository: %v", repo.lookups[lookups:])
+	}
+	// Duplicates count once towards the cap
+	repeated := make([]string, domain.MaxCategorySlugLookup+1)
+	for i := range repeated {
+		repeated[i] = "books"
+	}
+	if got, err := svc.GetCategoriesBySlugs(ctx, repeated, true); err != nil || len(got) != 1 {
+		t.Errorf("repeated slug: got %v, %v, want books", got, err)
+	}
+}
+
+func TestCreateProductActiveDefault(t *testing.T) {
+	ctx := context.Background()
+	categoryID := uuid.NewString()
+	tests := []struct {
+		isActive        string
+		activeByDefault bool
+		want            bool
+	}{
+		{"", true, true},
+		{"", false, false},
+		{`,"is_active":true`, true, true},
+		{`,"is_active":true`, false, true},
+		{`,"is_active":false`, true, false},
+		{`,"is_active":false`, false, false},
+	}
+	for i, tt := range tests {
+		svc := NewProductService(newFakeProductRepo(), 1)
+		svc.SetActiveByDefault(tt.activeByDefault)
+		// Decode as the handler does, so an omitted field stays nil
+		var req domain.CreateProductRequest
+		body := fmt.Sprintf(`{"category_id":%q,"slug":"lamp-%d","name":"Lamp","price_coins":10%s}`, categoryID, i, tt.isActive)
+		if err := json.Unmarshal([]byte(body), &req); err != nil {
+			t.Fatalf("decode %s: %v", body, err)
+		}
+
+		product, err := svc.CreateProduct(ctx, req)
+		if err != nil {
+			t.Fatalf("CreateProduct(%s): %v", body, err)
+		}
+		if product.IsActive != tt.want {
+			t.Errorf("create with %q, default %v: active %v, want %v", tt.isActive, tt.activeByDefault, product.IsActive, tt.want)
+		}
+
+		// Import rows follow the same rule
+		req.Slug += "-imported"
+		results, err := svc.ImportProducts(ctx, domain.ProductImportRequest{Products: []domain.CreateProductRequest{req}})
+		if err != nil || results[0].Err != nil {
+			t.Fatalf("ImportProducts: %v, %v", err, results[0].Err)
+		}
+		if results[0].Product.IsActive != tt.want {
+			t.Errorf("import with %q, default %v: active %v, want %v", tt.isActive, tt.activeByDefault, results[0].Product.IsActive, tt.want)
+		}
+	}
+}
+
+// categoryJoinRepo returns the category joined to each product by ID.
+type categoryJoinRepo struct {
+	ProductRepository
+	categories map[string]*domain.ProductCategory
+	err        error
+}
+
+func (f categoryJoinRepo) GetProductCategory(ctx context.Context, productID string) (*domain.ProductCategory, error) {
+	return f.categories[productID], f.err
+}
+
+func TestExpandCategory(t *testing.T) {
+	ctx := context.Background()
+	hidden := &domain.ProductCategory{ID: uuid.NewString(), Slug: "hidden"}
+	listed := &domain.ProductCategory{ID: uuid.NewString(), Slug: "listed", IsActive: true}
+	inHidden := &domain.Product{ID: uuid.NewString(), CategoryID: hidden.ID, Slug: "in-hidden"}
+	inListed := &domain.Product{ID: uuid.NewString(), CategoryID: listed.ID, Slug: "in-listed"}
+	orphan := &domain.Product{ID: uuid.NewString(), CategoryID: uuid.NewString(), Slug: "orphan"}
+	svc := NewProductService(categoryJoinRepo{categories: map[string]*domain.ProductCategory{
+		inHidden.ID: hidden,
+		inListed.ID: listed,
+	}}, 1)
+
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+
+	for _, tt := range []struct {
+		product *domain.Product
+		want    *domain.ProductCategory
+	}{
+		{inListed, listed},
+		{inHidden, hidden},
+	} {
+		got, err := svc.ExpandCategory(ctx, tt.product)
+		if err != nil {
+			t.Fatalf("ExpandCategory(%s): %v", tt.product.Slug, err)
+		}
+		if got.Product.ID != tt.product.ID || got.Category != tt.want {
+			t.Errorf("ExpandCategory(%s) = %+v, want category %s", tt.product.Slug, got, tt.want.Slug)
+		}
+	}
+	if len(hook.AllEntries()) != 0 {
+		t.Errorf("expanding existing categories logged %v", hook.AllEntries())
+	}
+
+	// A missing category is warned about, not failed on
+	got, err := svc.ExpandCategory(ctx, orphan)
+	if err != nil || got.Product.ID != orphan.ID || got.Category != nil {
+		t.Fatalf("ExpandCategory(orphan) = %+v, %v, want the product with no category", got, err)
+	}
+	entry := hook.LastEntry()
+	if entry == nil || entry.Level != log.WarnLevel || entry.Data["category_id"] != orphan.CategoryID || entry.Data["product_id"] != orphan.ID {
+		t.Errorf("missing category logged %+v, want a warning naming the product and category", entry)
+	}
+
+	// Failing to read the category is still an error
+	dbErr := errors.New("connection reset")
+	failing := NewProductService(categoryJoinRepo{err: dbErr}, 1)
+	if _, err := failing.ExpandCategory(ctx, inListed); !errors.Is(err, dbErr) {
+		t.Errorf("ExpandCategory with a failing repository: got %v, want %v", err, dbErr)
+	}
+}
+
+func TestRejectInactiveCategory(t *testing.T) {
+	ctx := context.Background()
+	active, inactive, unknown := uuid.NewString(), uuid.NewString(), uuid.NewString()
+	tests := []struct {
+		reject     bool
+		categoryID string
+		want       error
+	}{
+		{true, inactive, domain.ErrCategoryInactive},
+		{true, active, nil},
+		{true, unknown, domain.ErrCategoryNotFound},
+		// Off, the category is not looked up and anything goes, as before
+		{false, inactive, nil},
+		{false, active, nil},
+	}
+	for _, tt := range tests {
+		repo := newFakeProductRepo()
+		repo.activeCategories = map[string]bool{active: true, inactive: false}
+		svc := NewProductService(repo, 1)
+		svc.SetRejectInactiveCategory(tt.reject)
+		req := domain.CreateProductRequest{CategoryID: tt.categoryID, Slug: "lamp", Name: "Lamp", PriceCoins: 10}
+
+		_, err := svc.CreateProduct(ctx, req)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("reject %v, category %s: CreateProduct got %v, want %v", tt.reject, tt.categoryID, err, tt.want)
+		}
+		if created := len(repo.bySlug) == 1; created != (tt.want == nil) {
+			t.Errorf("reject %v, category %s: created %v", tt.reject, tt.categoryID, created)
+		}
+		if !tt.reject && repo.categoryLookups != 0 {
+			t.Errorf("category looked up %d times with the flag off", repo.categoryLookups)
+		}
+
+		// Import rows are held to the same rule, row by row
+		req.Slug = "imported-lamp"
+		results, err := svc.ImportProducts(ctx, domain.ProductImportRequest{Products: []domain.CreateProductRequest{req}})
+		if err != nil {
+			t.Fatalf("ImportProducts: %v", err)
+		}
+		if !errors.Is(results[0].Err, tt.want) {
+			t.Errorf("reject %v, category %s: import row got %v, want %v", tt.reject, tt.categoryID, results[0].Err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+	"user-service/internal/domain"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxBufferedViewProducts caps the distinct products buffered between
+	// flushes, so views of made-up IDs can't grow memory without bound.
+	maxBufferedViewProducts = 10000
+	// viewFlushTimeout bounds a single flush, including the one at shutdown.
+	viewFlushTimeout = 10 * time.Second
+)
+
+type ProductViewRepository interface {
+	AddViewCounts(ctx context.Context, counts map[string]int64) error
+}
+
+// productViewCounter coalesces product views in memory and writes them in one
+// statement every flushInterval, or sooner once flushThreshold views are
+// pending, so a popular product doesn't turn into a row-lock hotspot.
+type productViewCounter struct {
+	repo           ProductViewRepository
+	flushInterval  time.Duration
+	flushThreshold int64
+
+	mu      sync.Mutex
+	pending map[string]int64
+	views   int64
+
+	flushNow chan struct{}
+}
+
+func NewProductViewCounter(repo ProductViewRepository, flushInterval time.Duration, flushThreshold int) *productViewCounter {
+	if flushThreshold <= 0 {
+		flushThreshold = 1
+	}
+	return &productViewCounter{
+		repo:           repo,
+		flushInterval:  flushInterval,
+		flushThreshold: int64(flushThreshold),
+		pending:        make(map[string]int64),
+		flushNow:       make(chan struct{}, 1),
+	}
+}
+
+// RecordView counts one view of productID. The product is not looked up;
+// views of unknown or deleted products are dropped when flushed.
+func (c *productViewCounter) RecordView(productID string) error {
+	if _, err := uuid.Parse(productID); err != nil {
+		return domain.ErrInvalidUUID
+	}
+
+	c.mu.Lock()
+	_, known := c.pending[productID]
+	full := !known && len(c.pending) >= maxBufferedViewProducts
+	if !full {
+		c.pending[productID]++
+		c.views++
+	}
+	due := full || c.views >= c.flushThreshold
+	c.mu.Unlock()
+
+	if due {
+		select {
+		case c.flushNow <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Run flushes pending views periodically until ctx is done, then flushes
+// whatever is left one last time.
+func (c *productViewCounter) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), viewFlushTimeout)
+			c.flush(flushCtx)
+			cancel()
+			return
+		case <-ticker.C:
+		case <-c.flushNow:
+		}
+		// select picks at random among ready cases; a flush due at shutdown
+		// is left to the final one, which outlives ctx
+		if ctx.Err() != nil {
+			continue
+		}
+
+		flushCtx, cancel := context.WithTimeout(ctx, viewFlushTimeout)
+		c.flush(flushCtx)
+		cancel()
+	}
+}
+
+// flush writes the pending views. On failure they are put back to be retried
+// with the next flush.
+func (c *productViewCounter) flush(ctx context.Context) {
+	c.mu.Lock()
+	counts, views := c.pending, c.views
+	if views == 0 {
+		c.mu.Unlock()
+		return
+	}
+	c.pending, c.views = make(map[string]int64, len(counts)), 0
+	c.mu.Unlock()
+
+	err := c.repo.AddViewCounts(ctx, counts)
+	if err == nil {
+		log.WithFields(log.Fields{
+			"products": len(counts),
+			"views":    views,
+		}).Debug("Product views flushed")
+		return
+	}
+
+	log.WithError(err).WithFields(log.Fields{
+		"products": len(counts),
+		"views":    views,
+	}).Error("Failed to flush product views")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, n := range counts {
+		if _, known := c.pending[id]; !known && len(c.pending) >= maxBufferedViewProducts {
+			continue
+		}
+		c.pending[id] += n
+		c.views += n
+	}
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+	"user-service/internal/domain"
+)
+
+// fakeViewRepo keeps every flush it gets, failing the first failures of them.
+type fakeViewRepo struct {
+	mu       sync.Mutex
+	failures int
+	flushes  []map[string]int64
+	// canceled counts flushes handed an already canceled context.
+	canceled int
+}
+
+func (f *fakeViewRepo) AddViewCounts(ctx context.Context, counts map[string]int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if ctx.Err() != nil {
+		f.canceled++
+	}
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("database unavailable")
+	}
+	f.flushes = append(f.flushes, counts)
+	return nil
+}
+
+// totals sums the views written per product over all flushes.
+func (f *fakeViewRepo) totals() map[string]int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	totals := map[string]int64{}
+	for _, flush := range f.flushes {
+		for id, n := range flush {
+			totals[id] += n
+		}
+	}
+	return totals
+}
+
+func (f *fakeViewRepo) flushCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.flushes)
+}
+
+const (
+	viewedA = "0190f1a2-0000-7000-8000-00000000000a"
+	viewedB = "0190f1a2-0000-7000-8000-00000000000b"
+)
+
+func recordViews(t *testing.T, c *productViewCounter, productID string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := c.RecordView(productID); err != nil {
+			t.Fatalf("RecordView: %v", err)
+		}
+	}
+}
+
+func TestViewsCoalesceIntoOneWrite(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeViewRepo{}
+	c := NewProductViewCounter(repo, time.Hour, 1000)
+
+	recordViews(t, c, viewedA, 7)
+	recordViews(t, c, viewedB, 3)
+	c.flush(ctx)
+	c.flush(ctx)
+
+	if len(repo.flushes) != 1 {
+		t.Fatalf("%d writes, want 1 for all pending views and none with nothing pending", len(repo.flushes))
+	}
+	if got := repo.flushes[0]; len(got) != 2 || got[viewedA] != 7 || got[viewedB] != 3 {
+		t.Errorf("wrote %v, want 7 views of A and 3 of B", got)
+	}
+
+	if err := c.RecordView("not-a-uuid"); err != domain.ErrInvalidUUID {
+		t.Errorf("RecordView of a malformed ID: got %v, want ErrInvalidUUID", err)
+	}
+}
+
+func TestFailedViewFlushIsRetried(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeViewRepo{failures: 1}
+	c := NewProductViewCounter(repo, time.Hour, 1000)
+
+	recordViews(t, c, viewedA, 7)
+	c.flush(ctx)
+	// Views recorded after the failed write join the ones put back
+	recordViews(t, c, viewedA, 2)
+	recordViews(t, c, viewedB, 1)
+	c.flush(ctx)
+
+	if len(repo.flushes) != 1 {
+		t.Fatalf("%d successful writes, want 1", len(repo.flushes))
+	}
+	if got := repo.flushes[0]; got[viewedA] != 9 || got[viewedB] != 1 {
+		t.Errorf("wrote %v, want 9 views of A and 1 of B", got)
+	}
+}
+
+func TestViewThresholdTriggersFlush(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := &fakeViewRepo{}
+	c := NewProductViewCounter(repo, time.Hour, 5)
+	go c.Run(ctx)
+
+	recordViews(t, c, viewedA, 4)
+	time.Sleep(20 * time.Millisecond)
+	if n := repo.flushCount(); n != 0 {
+		t.Fatalf("%d writes below the threshold, want 0", n)
+	}
+
+	recordViews(t, c, viewedA, 1)
+	deadline := time.Now().Add(5 * time.Second)
+	for repo.flushCount() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("threshold reached without a write")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := repo.totals()[viewedA]; got != 5 {
+		t.Errorf("wrote %d views, want 5", got)
+	}
+}
+
+func TestViewsFlushOnShutdown(t *testing.T) {
+	const writers, perWriter = 20, 250
+	repo := &fakeViewRepo{}
+	c := NewProductViewCounter(repo, time.Hour, 37)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		productID := viewedA
+		if w%2 == 1 {
+			productID = viewedB
+		}
+		wg.Go(func() { recordViews(t, c, productID, perWriter) })
+	}
+	wg.Wait()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Run did not return after shutdown")
+	}
+
+	// Every view is written exactly once, however the flushes split them
+	want := int64(writers / 2 * perWriter)
+	if got := repo.totals(); got[viewedA] != want || got[viewedB] != want {
+		t.Errorf("wrote %v, want %d views of each product", got, want)
+	}
+	if repo.canceled != 0 {
+		t.Errorf("%d flushes got a canceled context; the last one must outlive shutdown", repo.canceled)
+	}
+	if c.views != 0 || len(c.pending) != 0 {
+		t.Errorf("%d views of %d products left pending after shutdown", c.views, len(c.pending))
+	}
+}
+
+func TestBufferedViewProductsAreCapped(t *testing.T) {
+	repo := &fakeViewRepo{}
+	c := NewProductViewCounter(repo, time.Hour, 1<<30)
+	for i := 0; i < maxBufferedViewProducts+10; i++ {
+		if err := c.RecordView(fmt.Sprintf("0190f1a2-0000-7000-8000-%012d", i)); err != nil {
+			t.Fatalf("RecordView: %v", err)
+		}
+	}
+	if len(c.pending) != maxBufferedViewProducts || c.views != maxBufferedViewProducts {
+		t.Errorf("buffered %d views of %d products, want the cap of %d", c.views, len(c.pending), maxBufferedViewProducts)
+	}
+	// A full buffer asks for an early flush
+	select {
+	case <-c.flushNow:
+	default:
+		t.Errorf("full buffer did not request a flush")
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"user-service/internal/domain"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+type PurchaseRepository interface {
+	Purchase(ctx context.Context, userID, productID string) (*domain.Purchase, *domain.Order, error)
+	ListPurchasesByUser(ctx context.Context, userID string, limit, offset int) ([]domain.Purchase, int64, error)
+}
+
+// ProductLookup finds the product a purchase names by slug.
+type ProductLookup interface {
+	GetProductBySlug(ctx context.Context, slug string, includeInactive bool) (*domain.Product, error)
+}
+
+// UserLookup finds the user whose purchases are listed.
+type UserLookup interface {
+	GetByID(ctx context.Context, id string, includeDeleted bool) (*domain.User, error)
+}
+
+type purchaseService struct {
+	purchaseRepo PurchaseRepository
+	products     ProductLookup
+	users        UserLookup
+	auditService *AuditService
+	listPolicy   listPolicy
+}
+
+// NewPurchaseService creates the service behind single product purchases.
+// A purchase is a checkout of one unit, so the product lookup, the balance
+// deduction, the order and the purchase row are written in one transaction,
+// and the order shows up in the user's orders and refunds like any other.
+func NewPurchaseService(purchaseRepo PurchaseRepository, products ProductLookup, users UserLookup, auditService *AuditService) *purchaseService {
+	return &purchaseService{
+		purchaseRepo: purchaseRepo,
+		products:     products,
+		users:        users,
+		auditService: auditService,
+	}
+}
+
+// SetInvalidInputPolicy sets whether list pages beyond the maxima are
+// rejected or clamped; it is safe to call while serving requests.
+func (s *purchaseService) SetInvalidInputPolicy(policy string) {
+	s.listPolicy.set(policy)
+}
+
+// Purchase buys one unit of the product for the user at its current price.
+// It fails with ErrProductInactive for a disabled product and with
+// ErrInsufficientCoinsBalance when the user can't afford it.
+func (s *purchaseService) Purchase(ctx context.Context, userID string, req domain.PurchaseRequest) (*domain.Purchase, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, domain.ErrInvalidUUID
+	}
+	if (req.ProductID == "") == (req.Slug == "") {
+		return nil, domain.ErrPurchaseProductRequired
+	}
+
+	productID := req.ProductID
+	if req.Slug != "" {
+		// Inactive products are resolved so the purchase reports them as such
+		product, err := s.products.GetProductBySlug(ctx, req.Slug, true)
+		if err != nil {
+			if errors.Is(err, domain.ErrInvalidProductSlug) {
+				return nil, domain.ErrProductNotFound
+			}
+			return nil, err
+		}
+		productID = product.ID
+	} else if _, err := uuid.Parse(productID); err != nil {
+		return nil, domain.ErrProductNotFound
+	}
+
+	purchase, order, err := s.purchaseRepo.Purchase(ctx, userID, productID)
+	if err != nil {
+		// With a single item there is no line to point at
+		var lineErr *domain.LineItemError
+		if errors.As(err, &lineErr) {
+			err = lineErr.Err
+		}
+		log.WithError(err).WithFields(log.Fields{
+			"user_id":    userID,
+			"product_id": productID,
+		}).Error("Purchase failed")
+		return nil, err
+	}
+
+	if err := s.auditService.RecordOrderCompleted(ctx, order); err != nil {
+		log.WithError(err).WithField("order_id", order.ID).Warn("Failed to record audit event for completed order")
+	}
+	if err := s.auditService.RecordProductPurchased(ctx, purchase); err != nil {
+		log.WithError(err).WithField("purchase_id", purchase.ID).Warn("Failed to record audit event for product purchase")
+	}
+
+	return purchase, nil
+}
+
+// ListUserPurchases returns a page of the user's purchases, newest first,
+// and how many there are in total. An unknown or deleted user is reported
+// as ErrUserNotFound.
+func (s *purchaseService) ListUserPurchases(ctx context.Context, userID string, limit, offset int) (domain.Page[domain.Purchase], error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return domain.Page[domain.Purchase]{}, domain.ErrInvalidUUID
+	}
+	limit, offset, err := domain.ListPage(s.listPolicy.get(), limit, offset)
+	if err != nil {
+		return domain.Page[domain.Purchase]{}, err
+	}
+
+	// An unknown user is reported as such rather than as an empty history
+	if _, err := s.users.GetByID(ctx, userID, false); err != nil {
+		return domain.Page[domain.Purchase]{}, err
+	}
+
+	purchases, total, err := s.purchaseRepo.ListPurchasesByUser(ctx, userID, limit, offset)
+	if err != nil {
+		return domain.Page[domain.Purchase]{}, err
+	}
+	return domain.Page[domain.Purchase]{Items: purchases, Total: total, Limit: limit, Offset: offset}, nil
+}
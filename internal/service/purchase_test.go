@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"user-service/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+type fakePurchaseRepo struct {
+	purchases []domain.Purchase
+}
+
+func (f *fakePurchaseRepo) Purchase(ctx context.Context, userID, productID string) (*domain.Purchase, *domain.Order, error) {
+	return nil, nil, errors.New("not implemented")
+}
+
+func (f *fakePurchaseRepo) ListPurchasesByUser(ctx context.Context, userID string, limit, offset int) ([]domain.Purchase, int64, error) {
+	return f.purchases, int64(len(f.purchases)), nil
+}
+
+type fakeUserLookup map[string]*domain.User
+
+func (f fakeUserLookup) GetByID(ctx context.Context, id string, includeDeleted bool) (*domain.User, error) {
+	user, ok := f[id]
+	if !ok {
+		return nil, domain.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func TestListUserPurchasesUnknownUser(t *testing.T) {
+	svc := NewPurchaseService(&fakePurchaseRepo{}, nil, fakeUserLookup{}, NewAuditService(nil))
+
+	_, err := svc.ListUserPurchases(context.Background(), uuid.NewString(), 10, 0)
+	if !errors.Is(err, domain.ErrUserNotFound) {
+		t.Fatalf("got %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestListUserPurchasesKnownUser(t *testing.T) {
+	userID := uuid.NewString()
+	repo := &fakePurchaseRepo{purchases: []domain.Purchase{{ID: uuid.NewString(), UserID: userID}}}
+	svc := NewPurchaseService(repo, nil, fakeUserLookup{userID: {ID: userID}}, NewAuditService(nil))
+
+	page, err := svc.ListUserPurchases(context.Background(), userID, 10, 0)
+	if err != nil {
+		t.Fatalf("ListUserPurchases: %v", err)
+	}
+	if page.Total != 1 || len(page.Items) != 1 {
+		t.Fatalf("got %d purchases of %d, want 1 of 1", len(page.Items), page.Total)
+	}
+}
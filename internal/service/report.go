@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/semaphore"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// coinTotalsTTL is how long aggregate coin totals are served from memory.
+// The queries scan whole tables, so repeated dashboard refreshes share one result.
+const coinTotalsTTL = 30 * time.Second
+
+// statsCacheMaxEntries bounds the cached product stats. Every product, range
+// and page is an entry of its own; once full, new results are not cached
+// until entries expire.
+const statsCacheMaxEntries = 1000
+
+type ReportRepository interface {
+	CoinTotals(ctx context.Context) (*domain.CoinTotals, error)
+	BurnRate(ctx context.Context, userID string, windowDays int) (*domain.BurnRate, error)
+	CoinSummary(ctx context.Context, userID string, rng domain.StatsRange) (*domain.CoinSummary, error)
+	ProductStats(ctx context.Context, productID string, rng domain.StatsRange) (*domain.ProductStats, error)
+	CatalogStats(ctx context.Context, categoryID *string, rng domain.StatsRange, limit, offset int) ([]domain.ProductStats, int64, error)
+}
+
+type reportService struct {
+	repo ReportRepository
+	// heavyOps bounds the pool connections held by whole-table aggregates;
+	// nil leaves them unbounded.
+	heavyOps *semaphore.Weighted
+
+	mu         sync.Mutex
+	coinTotals *domain.CoinTotals
+	expiresAt  time.Time
+
+	// statsTTL is how long product stats are served from statsCache; 0
+	// disables caching.
+	statsTTL   time.Duration
+	statsMu    sync.Mutex
+	statsCache map[string]statsCacheEntry
+	listPolicy listPolicy
+}
+
+type statsCacheEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+func NewReportService(repo ReportRepository) *reportService {
+	return &reportService{repo: repo, statsCache: make(map[string]statsCacheEntry)}
+}
+
+// SetStatsCacheTTL sets how long product stats are served from memory; 0
+// disables caching. It is meant to be called once at startup, before serving
+// requests.
+func (s *reportService) SetStatsCacheTTL(ttl time.Duration) {
+	s.statsTTL = ttl
+}
+
+// SetInvalidInputPolicy sets whether stats pages beyond the list maxima are
+// rejected or clamped; it is safe to call while serving requests.
+func (s *reportService) SetInvalidInputPolicy(policy string) {
+	s.listPolicy.set(policy)
+}
+
+// SetHeavyOps makes coin total aggregation hold a connection of heavyOps
+// while it runs. It is meant to be called once at startup, before serving
+// requests.
+func (s *reportService) SetHeavyOps(heavyOps *semaphore.Weighted) {
+	s.heavyOps = heavyOps
+}
+
+// CoinTotals returns the system-wide coin aggregates, at most coinTotalsTTL old.
+func (s *reportService) CoinTotals(ctx context.Context) (*domain.CoinTotals, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.coinTotals != nil && time.Now().Before(s.expiresAt) {
+		return s.coinTotals, nil
+	}
+
+	if err := s.heavyOps.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	totals, err := s.repo.CoinTotals(ctx)
+	s.heavyOps.Release(1)
+	if err != nil {
+		log.WithError(err).Error("Failed to aggregate coin totals")
+		return nil, err
+	}
+
+	s.coinTotals = totals
+	s.expiresAt = time.Now().Add(coinTotalsTTL)
+	return totals, nil
+}
+
+// BurnRate reports how many coins userID spent over the last windowDays days.
+func (s *reportService) BurnRate(ctx context.Context, userID string, windowDays int) (*domain.BurnRate, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, domain.ErrInvalidUUID
+	}
+	if err := domain.ValidateBurnRateWindow(windowDays); err != nil {
+		return nil, err
+	}
+
+	rate, err := s.repo.BurnRate(ctx, userID, windowDays)
+	if err != nil {
+		if err != domain.ErrUserNotFound {
+			log.WithError(err).WithField("user_id", userID).Error("Failed to compute burn rate")
+		}
+		return nil, err
+	}
+	return rate, nil
+}
+
+// CoinSummary reports the coins credited to and debited from userID over
+// rng, by ledger category.
+func (s *reportService) CoinSummary(ctx context.Context, userID string, rng domain.StatsRange) (*domain.CoinSummary, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, domain.ErrInvalidUUID
+	}
+
+	summary, err := s.repo.CoinSummary(ctx, userID, rng)
+	if err != nil {
+		if err != domain.ErrUserNotFound {
+			log.WithError(err).WithField("user_id", userID).Error("Failed to summarize coins")
+		}
+		return nil, err
+	}
+	return summary, nil
+}
+
+// ProductStats reports the views, purchases and revenue of productID over rng.
+func (s *reportService) ProductStats(ctx context.Context, productID string, rng domain.StatsRange) (*domain.ProductStats, error) {
+	if _, err := uuid.Parse(productID); err != nil {
+		return nil, domain.ErrInvalidUUID
+	}
+
+	key := fmt.Sprintf("product:%s:%s:%s", productID, rng.From.Format(domain.StatsDateLayout), rng.To.Format(domain.StatsDateLayout))
+	if cached, ok := s.cachedStats(key); ok {
+		return cached.(*domain.ProductStats), nil
+	}
+
+	stats, err := s.repo.ProductStats(ctx, productID, rng)
+	if err != nil {
+		if err != domain.ErrProductNotFound {
+			log.WithError(err).WithField("product_id", productID).Error("Failed to aggregate product stats")
+		}
+		return nil, err
+	}
+	s.cacheStats(key, stats)
+	return stats, nil
+}
+
+// CatalogStats reports a page of the stats over rng of the products, in
+// categoryID when given, that were viewed or bought in it, best selling
+// first, and how many there are in total. The aggregate covers the whole
+// catalog, so it holds a heavy operation connection.
+func (s *reportService) CatalogStats(ctx context.Context, categoryID *string, rng domain.StatsRange, limit, offset int) (domain.Page[domain.ProductStats], error) {
+	if categoryID != nil {
+		if _, err := uuid.Parse(*categoryID); err != nil {
+			return domain.Page[domain.ProductStats]{}, domain.ErrInvalidUUID
+		}
+	}
+	limit, offset, err := domain.ListPage(s.listPolicy.get(), limit, offset)
+	if err != nil {
+		return domain.Page[domain.ProductStats]{}, err
+	}
+
+	category := ""
+	if categoryID != nil {
+		category = *categoryID
+	}
+	key := fmt.Sprintf("catalog:%s:%s:%s:%d:%d", category, rng.From.Format(domain.StatsDateLayout), rng.To.Format(domain.StatsDateLayout), limit, offset)
+	if cached, ok := s.cachedStats(key); ok {
+		return cached.(domain.Page[domain.ProductStats]), nil
+	}
+
+	if err := s.heavyOps.Acquire(ctx, 1); err != nil {
+		return domain.Page[domain.ProductStats]{}, err
+	}
+	items, total, err := s.repo.CatalogStats(ctx, categoryID, rng, limit, offset)
+	s.heavyOps.Release(1)
+	if err != nil {
+		if err != domain.ErrCategoryNotFound {
+			log.WithError(err).Error("Failed to aggregate catalog stats")
+		}
+		return domain.Page[domain.ProductStats]{}, err
+	}
+	page := domain.Page[domain.ProductStats]{Items: items, Total: total, Limit: limit, Offset: offset}
+	s.cacheStats(key, page)
+	return page, nil
+}
+
+func (s *reportService) cachedStats(key string) (interface{}, bool) {
+	if s.statsTTL <= 0 {
+		return nil, false
+	}
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	entry, ok := s.statsCache[key]
+	if !ok || !time.Now().Before(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (s *reportService) cacheStats(key string, value interface{}) {
+	if s.statsTTL <= 0 {
+		return
+	}
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	now := time.Now()
+	if len(s.statsCache) >= statsCacheMaxEntries {
+		for k, entry := range s.statsCache {
+			if !now.Before(entry.expiresAt) {
+				delete(s.statsCache, k)
+			}
+		}
+		if len(s.statsCache) >= statsCacheMaxEntries {
+			return
+		}
+	}
+	s.statsCache[key] = statsCacheEntry{value: value, expiresAt: now.Add(s.statsTTL)}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"user-service/internal/domain"
+)
+
+// countingReportRepo returns fixed stats and counts the aggregates it runs.
+type countingReportRepo struct {
+	ReportRepository
+	productCalls int
+	catalogCalls int
+	err          error
+}
+
+func (r *countingReportRepo) ProductStats(ctx context.Context, productID string, rng domain.StatsRange) (*domain.ProductStats, error) {
+	r.productCalls++
+	if r.err != nil {
+		return nil, r.err
+	}
+	stats := &domain.ProductStats{ProductID: productID, Views: 40, Purchases: 2}
+	stats.SetRange(rng)
+	return stats, nil
+}
+
+func (r *countingReportRepo) CatalogStats(ctx context.Context, categoryID *string, rng domain.StatsRange, limit, offset int) ([]domain.ProductStats, int64, error) {
+	r.catalogCalls++
+	if r.err != nil {
+		return nil, 0, r.err
+	}
+	return []domain.ProductStats{{ProductID: "0190c2a8-7f1e-7a3b-9c4d-000000000001"}}, 1, nil
+}
+
+func TestProductStatsCache(t *testing.T) {
+	const product, other = "0190c2a8-7f1e-7a3b-9c4d-000000000001", "0190c2a8-7f1e-7a3b-9c4d-000000000002"
+	ctx := context.Background()
+	now := time.Now()
+	week, _ := domain.ParseStatsRange("", "", now)
+	day, _ := domain.ParseStatsRange(now.UTC().Format(domain.StatsDateLayout), "", now)
+
+	repo := &countingReportRepo{}
+	svc := NewReportService(repo)
+	svc.SetStatsCacheTTL(time.Minute)
+
+	first, err := svc.ProductStats(ctx, product, week)
+	if err != nil || first.ConversionRate != 0.05 {
+		t.Fatalf("ProductStats: %+v, %v", first, err)
+	}
+	if again, _ := svc.ProductStats(ctx, product, week); again != first || repo.productCalls != 1 {
+		t.Errorf("repeat within the TTL ran %d aggregates, want 1", repo.productCalls)
+	}
+	// Each product and range is cached apart
+	svc.ProductStats(ctx, other, week)
+	svc.ProductStats(ctx, product, day)
+	if repo.productCalls != 3 {
+		t.Errorf("other product and range ran %d aggregates, want 3", repo.productCalls)
+	}
+
+	// Invalid IDs never reach the repository
+	if _, err := svc.ProductStats(ctx, "not-a-uuid", week); !errors.Is(err, domain.ErrInvalidUUID) || repo.productCalls != 3 {
+		t.Errorf("invalid ID: got %v after %d aggregates, want ErrInvalidUUID", err, repo.productCalls)
+	}
+
+	// Errors are not cached
+	repo.err = domain.ErrProductNotFound
+	const missing = "0190c2a8-7f1e-7a3b-9c4d-000000000003"
+	for i := 0; i < 2; i++ {
+		if _, err := svc.ProductStats(ctx, missing, week); !errors.Is(err, domain.ErrProductNotFound) {
+			t.Errorf("missing product: got %v, want ErrProductNotFound", err)
+		}
+	}
+	if repo.productCalls != 5 {
+		t.Errorf("missing product ran %d aggregates, want 5", repo.productCalls)
+	}
+
+	// Expired entries are refreshed
+	svc.statsMu.Lock()
+	for key, entry := range svc.statsCache {
+		entry.expiresAt = now.Add(-time.Second)
+		svc.statsCache[key] = entry
+	}
+	svc.statsMu.Unlock()
+	repo.err = nil
+	svc.ProductStats(ctx, product, week)
+	if repo.productCalls != 6 {
+		t.Errorf("expired entry ran %d aggregates, want 6", repo.productCalls)
+	}
+}
+
+func TestProductStatsCacheDisabled(t *testing.T) {
+	ctx := context.Background()
+	rng, _ := domain.ParseStatsRange("", "", time.Now())
+	repo := &countingReportRepo{}
+	svc := NewReportService(repo)
+
+	for i := 0; i < 3; i++ {
+		svc.ProductStats(ctx, "0190c2a8-7f1e-7a3b-9c4d-000000000001", rng)
+		svc.CatalogStats(ctx, nil, rng, 10, 0)
+	}
+	if repo.productCalls != 3 || repo.catalogCalls != 3 || len(svc.statsCache) != 0 {
+		t.Errorf("without a TTL: %d product and %d catalog aggregates, %d cached, want 3, 3 and none",
+			repo.productCalls, repo.catalogCalls, len(svc.statsCache))
+	}
+}
+
+func TestCatalogStatsCache(t *testing.T) {
+	ctx := context.Background()
+	rng, _ := domain.ParseStatsRange("", "", time.Now())
+	category := "0190c2a8-7f1e-7a3b-9c4d-000000000010"
+	repo := &countingReportRepo{}
+	svc := NewReportService(repo)
+	svc.SetStatsCacheTTL(time.Minute)
+
+	first, err := svc.CatalogStats(ctx, nil, rng, 10, 0)
+	if err != nil || len(first.Items) != 1 || first.Total != 1 {
+		t.Fatalf("CatalogStats: %v of %d, %v", first.Items, first.Total, err)
+	}
+	pages := []struct {
+		name     string
+		category *string
+		limit    int
+		offset   int
+	}{
+		{"same page", nil, 10, 0},
+		// The default limit is the same page as asking for it
+		{"default limit", nil, 0, 0},
+		{"category", &category, 10, 0},
+		{"limit", nil, 5, 0},
+		{"offset", nil, 10, 10},
+	}
+	wantCalls := []int{1, 1, 2, 3, 4}
+	for i, page := range pages {
+		served, err := svc.CatalogStats(ctx, page.category, rng, page.limit, page.offset)
+		if err != nil {
+			t.Fatalf("%s: %v", page.name, err)
+		}
+		// A cached page reports the limit it was served with too
+		want := page.limit
+		if want == 0 {
+			want = 10
+		}
+		if served.Limit != want || served.Offset != page.offset {
+			t.Errorf("%s: served %d/%d, want %d/%d", page.name, served.Limit, served.Offset, want, page.offset)
+		}
+		if repo.catalogCalls != wantCalls[i] {
+			t.Errorf("%s: %d aggregates, want %d", page.name, repo.catalogCalls, wantCalls[i])
+		}
+	}
+
+	// Rejected input never reaches the repository
+	bad := "not-a-uuid"
+	if _, err := svc.CatalogStats(ctx, &bad, rng, 10, 0); !errors.Is(err, domain.ErrInvalidUUID) {
+		t.Errorf("invalid category: got %v, want ErrInvalidUUID", err)
+	}
+	if _, err := svc.CatalogStats(ctx, nil, rng, domain.MaxListLimit+1, 0); !errors.Is(err, domain.ErrListLimitTooLarge) {
+		t.Errorf("limit too large: got %v, want ErrListLimitTooLarge", err)
+	}
+	if repo.catalogCalls != 4 {
+		t.Errorf("rejected input ran %d aggregates, want 4", repo.catalogCalls)
+	}
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	"user-service/internal/domain"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type SeedRepository interface {
+	SetEntitlements(ctx context.Context, userID string, e domain.SeedEntitlements) error
+}
+
+// seedEntitlementStates are the trial and subscription states seeded users
+// are spread over, including the lapsed ones access checks must deny.
+var seedEntitlementStates = []func(now time.Time) domain.SeedEntitlements{
+	// In trial
+	func(now time.Time) domain.SeedEntitlements {
+		ends := now.Add(domain.TrialDuration)
+		return domain.SeedEntitlements{IsTrial: true, TrialEndsAt: &ends}
+	},
+	// Trial ended, not yet swept
+	func(now time.Time) domain.SeedEntitlements {
+		ended := now.Add(-24 * time.Hour)
+		return domain.SeedEntitlements{IsTrial: true, TrialEndsAt: &ended}
+	},
+	// Legacy trial without an end time
+	func(time.Time) domain.SeedEntitlements {
+		return domain.SeedEntitlements{IsTrial: true}
+	},
+	// Subscribed
+	func(now time.Time) domain.SeedEntitlements {
+		ends := now.Add(30 * 24 * time.Hour)
+		return domain.SeedEntitlements{HasSubscription: true, SubscriptionEndsAt: &ends}
+	},
+	// Subscription ended, not yet swept
+	func(now time.Time) domain.SeedEntitlements {
+		ended := now.Add(-24 * time.Hour)
+		return domain.SeedEntitlements{HasSubscription: true, SubscriptionEndsAt: &ended}
+	},
+	// Neither
+	func(time.Time) domain.SeedEntitlements {
+		return domain.SeedEntitlements{}
+	},
+}
+
+var seedBalances = []int64{0, 50, 250, 1000, 5000}
+
+var seedPrices = []int64{50, 199, 500, 1250, 9999}
+
+// seedCategories are the seeded categories. Products are only seeded into
+// active ones, as inactive categories may refuse new products.
+var seedCategories = []struct {
+	req         domain.CreateCategoryRequest
+	productName string
+	metadata    func(i int) string
+}{
+	{
+		req: domain.CreateCategoryRequest{
+			Slug:           "seed-games",
+			Name:           "Games",
+			Description:    "Seeded games with a required platform",
+			Position:       900,
+			IsActive:       true,
+			MetadataSchema: json.RawMessage(`{"type":"object","properties":{"platform":{"type":"string","enum":["pc","console"]}},"required":["platform"]}`),
+		},
+		productName: "Game",
+		metadata: func(i int) string {
+			if i%2 == 0 {
+				return `{"platform":"pc"}`
+			}
+			return `{"platform":"console"}`
+		},
+	},
+	{
+		req: domain.CreateCategoryRequest{
+			Slug:        "seed-books",
+			Name:        "Books",
+			Description: "Seeded books",
+			Position:    901,
+			IsActive:    true,
+		},
+		productName: "Book",
+		metadata: func(i int) string {
+			return fmt.Sprintf(`{"pages":%d}`, 100+i*50)
+		},
+	},
+	{
+		req: domain.CreateCategoryRequest{
+			Slug:        "seed-archive",
+			Name:        "Archive",
+			Description: "Seeded inactive category",
+			Position:    902,
+			IsActive:    false,
+		},
+	},
+}
+
+// Seeder fills the database with a fixed development dataset through the
+// services, so their validation and audit paths run as for real traffic.
+// Users are keyed by email and catalog rows by slug: running it again
+// brings existing rows back to the dataset instead of duplicating them.
+type Seeder struct {
+	users        *userService
+	categories   *productCategoryService
+	products     *productService
+	entitlements SeedRepository
+}
+
+func NewSeeder(users *userService, categories *productCategoryService, products *productService, entitlements SeedRepository) *Seeder {
+	return &Seeder{
+		users:        users,
+		categories:   categories,
+		products:     products,
+		entitlements: entitlements,
+	}
+}
+
+// Seed writes users seeded users and productsPerCategory products into each
+// active seeded category.
+func (s *Seeder) Seed(ctx context.Context, users, productsPerCategory int) (*domain.SeedReport, error) {
+	report := &domain.SeedReport{}
+	now := time.Now().UTC()
+
+	for i := 0; i < users; i++ {
+		if err := s.seedUser(ctx, i, now, report); err != nil {
+			return report, fmt.Errorf("seed user %d: %w", i, err)
+		}
+	}
+
+	for _, c := range seedCategories {
+		category, created, err := s.categories.EnsureCategory(ctx, withShift(c.req))
+		if err != nil {
+			return report, fmt.Errorf("seed category %s: %w", c.req.Slug, err)
+		}
+		if created {
+			report.CategoriesCreated++
+		} else {
+			report.CategoriesUpdated++
+		}
+		if !c.req.IsActive {
+			continue
+		}
+		for i := 0; i < productsPerCategory; i++ {
+			if err := s.seedProduct(ctx, category.ID, c.req.Slug, c.productName, c.metadata(i), i, report); err != nil {
+				return report, fmt.Errorf("seed product %d of %s: %w", i, c.req.Slug, err)
+			}
+		}
+	}
+
+	log.WithField("report", report).Info("Seeding finished")
+	return report, nil
+}
+
+// withShift makes a seeded category push aside whatever holds its position.
+func withShift(req domain.CreateCategoryRequest) domain.CreateCategoryRequest {
+	req.OnConflict = domain.PositionConflictShift
+	return req
+}
+
+// seedUser spreads users over every combination of status, entitlement
+// state and email verification, with a few different balances.
+func (s *Seeder) seedUser(ctx context.Context, i int, now time.Time, report *domain.SeedReport) error {
+	statuses := domain.ValidStatuses()
+	status := statuses[i%len(statuses)]
+	entitlements := seedEntitlementStates[(i/len(statuses))%len(seedEntitlementStates)](now)
+	entitlements.EmailVerified = (i/(len(statuses)*len(seedEntitlementStates)))%2 == 0
+	balance := seedBalances[i%len(seedBalances)]
+
+	email := fmt.Sprintf("seed-user-%03d@example.com", i)
+	name := fmt.Sprintf("Seed User %03d", i)
+
+	user, err := s.users.GetUserByEmail(ctx, email)
+	switch {
+	case errors.Is(err, domain.ErrUserNotFound):
+		user, err = s.users.CreateUser(ctx, domain.CreateUserRequest{Email: email, Name: name})
+		if err != nil {
+			return err
+		}
+		report.UsersCreated++
+	case err != nil:
+		return err
+	default:
+		report.UsersUpdated++
+	}
+
+	if diff := balance - user.CoinsBalance; diff > 0 {
+		if _, _, err := s.users.AddCoins(ctx, user.ID, diff, "", ""); err != nil {
+			return err
+		}
+	} else if diff < 0 {
+		if _, _, err := s.users.DeductCoins(ctx, user.ID, -diff, "", ""); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.users.UpdateUser(ctx, user.ID, domain.UpdateUserRequest{Name: name, Status: &status}); err != nil {
+		return err
+	}
+	return s.entitlements.SetEntitlements(ctx, user.ID, entitlements)
+}
+
+// seedProduct creates or updates the i-th product of a category, varying
+// price, metadata, stock and whether it is active.
+func (s *Seeder) seedProduct(ctx context.Context, categoryID, categorySlug, productName, metadata string, i int, report *domain.SeedReport) error {
+	slug := fmt.Sprintf("%s-%02d", categorySlug, i+1)
+	name := fmt.Sprintf("%s %02d", productName, i+1)
+	description := fmt.Sprintf("Seeded %s number %d", productName, i+1)
+	price := seedPrices[i%len(seedPrices)]
+	active := i%4 != 3
+	var stock *int64
+	if i%2 == 1 {
+		n := int64(i * 10)
+		stock = &n
+	}
+
+	existing, err := s.products.GetProductBySlug(ctx, slug, true)
+	switch {
+	case errors.Is(err, domain.ErrProductNotFound):
+		_, err := s.products.CreateProduct(ctx, domain.CreateProductRequest{
+			CategoryID:  categoryID,
+			Slug:        slug,
+			Name:        name,
+			Description: description,
+			PriceCoins:  price,
+			Metadata:    metadata,
+			IsActive:    &active,
+			Stock:       stock,
+		})
+		if err != nil {
+			return err
+		}
+		report.ProductsCreated++
+		return nil
+	case err != nil:
+		return err
+	}
+
+	_, err = s.products.UpdateProduct(ctx, existing.ID, domain.UpdateProductRequest{
+		CategoryID:  &categoryID,
+		Name:        &name,
+		Description: &description,
+		PriceCoins:  &price,
+		Metadata:    &metadata,
+		IsActive:    &active,
+		Stock:       stock,
+	})
+	if err != nil {
+		return err
+	}
+	report.ProductsUpdated++
+	return nil
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+	"user-service/internal/domain"
+)
+
+// SetEntitlements lets fakeUserRepo serve as the seeder's SeedRepository.
+func (f *fakeUserRepo) SetEntitlements(ctx context.Context, userID string, e domain.SeedEntitlements) error {
+	u, ok := f.users[userID]
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	u.IsTrial, u.TrialEndsAt = e.IsTrial, e.TrialEndsAt
+	u.HasSubscription, u.SubscriptionEndsAt = e.HasSubscription, e.SubscriptionEndsAt
+	u.EmailVerified = e.EmailVerified
+	return nil
+}
+
+type seedFixture struct {
+	users    *fakeUserRepo
+	products *fakeProductRepo
+	service  *userService
+	seeder   *Seeder
+}
+
+func newSeedFixture() *seedFixture {
+	users := newFakeUserRepo()
+	products := newFakeProductRepo()
+	svc := NewUserService(users, &fakeAuditRecorder{}, nil, UserServiceConfig{
+		SignupBonusCoins:         100,
+		MinNameLength:            2,
+		TrialLength:              domain.TrialDuration,
+		RequireEmailVerification: true,
+		LegacyTrialPolicy:        domain.LegacyTrialDeny,
+	})
+	categories := NewProductCategoryService(&fakeCategoryRepo{bySlug: map[string]*domain.ProductCategory{}}, 2)
+	return &seedFixture{
+		users:    users,
+		products: products,
+		service:  svc,
+		seeder:   NewSeeder(svc, categories, NewProductService(products, 2), users),
+	}
+}
+
+// seededState describes every seeded row by its fixed key, leaving out IDs
+// and the timestamps each run derives from its own clock.
+func (f *seedFixture) seededState() map[string]string {
+	state := map[string]string{}
+	for _, u := range f.users.users {
+		state[u.Email] = fmt.Sprintf("%s %s %d trial=%v/%v sub=%v/%v verified=%v",
+			u.Name, u.Status, u.CoinsBalance,
+			u.IsTrial, u.TrialEndsAt != nil, u.HasSubscription, u.SubscriptionEndsAt != nil, u.EmailVerified)
+	}
+	for _, p := range f.products.bySlug {
+		stock := "unlimited"
+		if p.Stock != nil {
+			stock = fmt.Sprint(*p.Stock)
+		}
+		state[p.Slug] = fmt.Sprintf("%s %s %d %s active=%v stock=%s", p.CategoryID, p.Name, p.PriceCoins, p.Metadata, p.IsActive, stock)
+	}
+	return state
+}
+
+func TestSeedIsIdempotent(t *testing.T) {
+	const users, productsPerCategory = 12, 4
+	ctx := context.Background()
+	f := newSeedFixture()
+
+	first, err := f.seeder.Seed(ctx, users, productsPerCategory)
+	if err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	wantFirst := domain.SeedReport{UsersCreated: users, CategoriesCreated: 3, ProductsCreated: 2 * productsPerCategory}
+	if *first != wantFirst {
+		t.Errorf("first run report %+v, want %+v", *first, wantFirst)
+	}
+	seeded := f.seededState()
+
+	// Drift the dataset the way hand testing would
+	for _, u := range f.users.users {
+		u.CoinsBalance += 7
+		u.Status = domain.StatusSuspended
+		u.HasSubscription = !u.HasSubscription
+		break
+	}
+	for _, p := range f.products.bySlug {
+		p.PriceCoins = 1
+		p.IsActive = !p.IsActive
+		break
+	}
+
+	second, err := f.seeder.Seed(ctx, users, productsPerCategory)
+	if err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	wantSecond := domain.SeedReport{UsersUpdated: users, CategoriesUpdated: 3, ProductsUpdated: 2 * productsPerCategory}
+	if *second != wantSecond {
+		t.Errorf("second run report %+v, want %+v", *second, wantSecond)
+	}
+	if len(f.users.users) != users || len(f.products.bySlug) != 2*productsPerCategory {
+		t.Fatalf("second run left %d users and %d products, want %d and %d",
+			len(f.users.users), len(f.products.bySlug), users, 2*productsPerCategory)
+	}
+	reseeded := f.seededState()
+	for key, want := range seeded {
+		if got := reseeded[key]; got != want {
+			t.Errorf("%s after re-run = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestSeedCoversAccessMatrix(t *testing.T) {
+	ctx := context.Background()
+	f := newSeedFixture()
+	if _, err := f.seeder.Seed(ctx, domain.DefaultSeedUsers, 0); err != nil {
+		t.Fatalf("Seed: %v", err)
+	}
+
+	reasons := map[string]int{}
+	capabilityDenials := map[string]int{}
+	access := map[bool]int{}
+	for _, u := range f.users.users {
+		d := f.service.ExplainAccess(u)
+		reasons[d.Reason]++
+		access[d.HasAccess]++
+		for _, reason := range d.Capabilities.Reasons {
+			capabilityDenials[reason]++
+		}
+	}
+
+	for _, reason := range []string{
+		domain.AccessReasonSubscriptionActive,
+		domain.AccessReasonTrialActive,
+		domain.AccessReasonUserNotActive,
+		domain.AccessReasonEmailNotVerified,
+		domain.AccessReasonTrialWithoutEnd,
+		domain.AccessReasonNoEntitlement,
+	} {
+		if reasons[reason] == 0 {
+			t.Errorf("no seeded user is decided by %s; got %v", reason, reasons)
+		}
+	}
+	for _, reason := range []string{domain.AccessReasonNoSubscription, domain.AccessReasonNoCoins} {
+		if capabilityDenials[reason] == 0 {
+			t.Errorf("no seeded user has a capability denied by %s; got %v", reason, capabilityDenials)
+		}
+	}
+	if access[true] == 0 || access[false] == 0 {
+		t.Errorf("seeded users with and without access: %v, want both", access)
+	}
+
+	// Lapsed entitlements must be among the denials, not just absent ones
+	var lapsedTrial, lapsedSubscription bool
+	now := time.Now()
+	for _, u := range f.users.users {
+		if u.Status != domain.StatusActive || !u.EmailVerified {
+			continue
+		}
+		if u.IsTrial && u.TrialEndsAt != nil && u.TrialEndsAt.Before(now) && !f.service.ExplainAccess(u).HasAccess {
+			lapsedTrial = true
+		}
+		if u.HasSubscription && u.SubscriptionEndsAt != nil && u.SubscriptionEndsAt.Before(now) && !f.service.ExplainAccess(u).HasAccess {
+			lapsedSubscription = true
+		}
+	}
+	if !lapsedTrial || !lapsedSubscription {
+		t.Errorf("denied lapsed trial %v, denied lapsed subscription %v; want both seeded", lapsedTrial, lapsedSubscription)
+	}
+}
@@ -2,11 +2,17 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"regexp"
+	"sync/atomic"
 	"time"
 	"user-service/internal/domain"
+	"user-service/internal/janitor"
+	"user-service/internal/metrics"
+	"user-service/internal/publicid"
 
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
@@ -15,99 +21,195 @@ import (
 // UserRepository defines the interface for user data access
 type UserRepository interface {
 	Create(ctx context.Context, user *domain.User) error
-	GetByID(ctx context.Context, id string) (*domain.User, error)
-	GetByEmail(ctx context.Context, email string) (*domain.User, error)
+	GetByID(ctx context.Context, id string, includeDeleted bool) (*domain.User, error)
+	GetByEmail(ctx context.Context, email string, includeDeleted bool) (*domain.User, error)
 	Update(ctx context.Context, userID string, fields *domain.UpdateUserFields) error
-	AddCoinsAtomic(ctx context.Context, userID string, coins int64) error
-	DeductCoinsAtomic(ctx context.Context, userID string, coins int64) error
-	ActivateSubscriptionAtomic(ctx context.Context, userID string, isTrial bool, trialEndsAt *time.Time, subscriptionEndsAt *time.Time) error
-	RenewSubscriptionAtomic(ctx context.Context, userID string, subscriptionEndsAt *time.Time) error
+	AddCoinsAtomic(ctx context.Context, userID string, coins int64, reason, idempotencyKey string) (*domain.User, bool, error)
+	DeductCoinsAtomic(ctx context.Context, userID string, coins int64, reason, idempotencyKey string) (*domain.User, bool, error)
+	TransferCoins(ctx context.Context, fromID, toID string, coins int64) (*domain.User, *domain.User, error)
+	ActivateSubscriptionAtomic(ctx context.Context, userID string, duration time.Duration, bonusCoins int64, idempotencyKey string) (*domain.User, bool, error)
+	CreateWithSubscription(ctx context.Context, user *domain.User, bonusCoins int64, subscriptionEndsAt time.Time) (*domain.User, error)
+	RequestDeletion(ctx context.Context, userID string, requestedAt, scheduledFor time.Time) (*domain.User, error)
+	CancelDeletion(ctx context.Context, userID string, now time.Time) (*domain.User, error)
+	RenewSubscriptionAtomic(ctx context.Context, userID string, duration time.Duration, bonusCoins int64, idempotencyKey string) (*domain.User, bool, error)
 	Delete(ctx context.Context, id string) error
-	List(ctx context.Context, limit, offset int) ([]domain.User, error)
+	HardDelete(ctx context.Context, id string) error
+	Restore(ctx context.Context, id string) (*domain.User, error)
+	List(ctx context.Context, filter domain.UserListFilter, limit, offset int) ([]domain.User, error)
+	Count(ctx context.Context, filter domain.UserListFilter) (int64, error)
+	CreateEmailVerificationToken(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error
+	ConfirmEmailVerification(ctx context.Context, userID, tokenHash string) error
+	ListCoinTransactions(ctx context.Context, userID string, limit, offset int) ([]domain.CoinTransaction, int64, error)
+	VerifyCoinTransactions(ctx context.Context, userID string, limit, offset int) ([]domain.CoinLedgerDiscrepancy, error)
+	ListAdminActions(ctx context.Context, userID string, limit, offset int) ([]domain.AdminAction, int64, error)
+}
+
+// VerificationSender delivers email verification tokens to users
+type VerificationSender interface {
+	SendVerification(ctx context.Context, user *domain.User, token string) error
+}
+
+// UserAuditRecorder records the audit events of user operations. It is
+// satisfied by *AuditService; failures are logged by the caller and never
+// fail the operation itself.
+type UserAuditRecorder interface {
+	RecordUserCreated(ctx context.Context, user *domain.User, signupBonus int64) error
+	RecordUserUpdated(ctx context.Context, userID string, changes map[string]interface{}) error
+	RecordCoinsAdded(ctx context.Context, userID string, amount int64) error
+	RecordCoinsDeducted(ctx context.Context, userID string, amount int64) error
+	RecordCoinsDepleted(ctx context.Context, userID string, amount int64) error
+	RecordCoinsTransferred(ctx context.Context, fromID, toID string, amount int64) error
+	RecordSubscriptionEvent(ctx context.Context, userID, eventType string, duration time.Duration, endsAt time.Time) error
+	RecordEmailVerificationEvent(ctx context.Context, userID, eventType string) error
+	RecordAccountDeletionEvent(ctx context.Context, userID, eventType string, scheduledFor *time.Time) error
+}
+
+// subscriptionBonusCoins are credited when a subscription is activated.
+const subscriptionBonusCoins = 5000
+
+// UserServiceConfig holds the tunable behaviour of the user service
+type UserServiceConfig struct {
+	// RequireEmailVerification denies access to users that have not verified their email
+	RequireEmailVerification bool
+	EmailVerificationTTL     time.Duration
+	// MinNameLength is the minimum number of characters in a user name
+	MinNameLength int
+	// SignupBonusCoins are credited to new users that don't opt out
+	SignupBonusCoins int64
+	// DeletionGracePeriod is how long a deletion request can be cancelled
+	DeletionGracePeriod time.Duration
+	// LegacyTrialPolicy decides whether a trial without an end time gives access
+	LegacyTrialPolicy string
+	// TrialLength is how long the trial of a new user lasts
+	TrialLength time.Duration
+	// InvalidInputPolicy decides whether pages beyond the list maxima are
+	// rejected or clamped
+	InvalidInputPolicy string
 }
 
 type userService struct {
-	userRepository UserRepository
-	auditService   *AuditService
+	userRepository     UserRepository
+	auditService       UserAuditRecorder
+	verificationSender VerificationSender
+	ids                publicid.Generator
+	cfg                atomic.Pointer[UserServiceConfig]
 }
 
-func NewUserService(userRepository UserRepository, auditService *AuditService) *userService {
-	return &userService{
-		userRepository: userRepository,
-		auditService:   auditService,
+func NewUserService(userRepository UserRepository, auditService UserAuditRecorder, verificationSender VerificationSender, cfg UserServiceConfig) *userService {
+	s := &userService{
+		userRepository:     userRepository,
+		auditService:       auditService,
+		verificationSender: verificationSender,
+		ids:                publicid.UUIDv7{},
 	}
+	s.SetConfig(cfg)
+	return s
+}
+
+// SetIDGenerator replaces how new user IDs are generated. It is meant to be
+// called once at startup, before serving requests.
+func (s *userService) SetIDGenerator(ids publicid.Generator) {
+	s.ids = ids
+}
+
+// SetConfig replaces the service configuration; it is safe to call while serving requests
+func (s *userService) SetConfig(cfg UserServiceConfig) {
+	s.cfg.Store(&cfg)
+}
+
+func (s *userService) config() UserServiceConfig {
+	return *s.cfg.Load()
 }
 
 // ValidateStatus validates user status
-func ValidateStatus(status string) error {
-	validStatuses := domain.ValidStatuses()
-	for _, validStatus := range validStatuses {
-		if status == validStatus {
-			return nil
-		}
+func ValidateStatus(status domain.UserStatus) error {
+	if !status.Valid() {
+		return domain.ErrInvalidStatus
 	}
-	return domain.ErrInvalidStatus
+	return nil
 }
 
-func (s *userService) CreateUser(ctx context.Context, req domain.CreateUserRequest) (*domain.User, error) {
+// signupBonus is the coins req's user starts with.
+func (s *userService) signupBonus(req domain.CreateUserRequest) int64 {
+	if req.SkipSignupBonus {
+		return 0
+	}
+	return s.config().SignupBonusCoins
+}
+
+// newUser validates req and returns the user it describes with the signup
+// trial and bonus applied; it is not stored yet.
+func (s *userService) newUser(ctx context.Context, req domain.CreateUserRequest) (*domain.User, error) {
 	if req.Email == "" {
 		return nil, domain.ErrEmailRequired
 	}
 	if len(req.Email) > domain.MaxEmailLength {
 		return nil, domain.ErrEmailTooLong
 	}
+	req.Name = domain.NormalizeName(req.Name)
 	if req.Name == "" {
 		return nil, domain.ErrNameRequired
 	}
 	if len(req.Name) > domain.MaxNameLength {
 		return nil, domain.ErrNameTooLong
 	}
+	if !domain.NameMeetsMinimum(req.Name, s.config().MinNameLength) {
+		return nil, domain.ErrInvalidName
+	}
 
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-	if !emailRegex.MatchString(req.Email) {
+	if !domain.IsValidEmailFormat(req.Email) {
 		return nil, domain.ErrInvalidEmailFormat
 	}
 
-	existingUserByEmail, err := s.userRepository.GetByEmail(ctx, req.Email)
+	// Soft-deleted users keep their email until they are hard-deleted
+	existingUserByEmail, err := s.userRepository.GetByEmail(ctx, req.Email, true)
 	if err == nil && existingUserByEmail != nil {
 		return nil, domain.ErrEmailAlreadyExists
 	}
 
-	userID := uuid.New().String()
-
-	trialEndsAt := time.Now().Add(3 * 24 * time.Hour) // 3 days
+	id, err := s.ids.NewID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate user id: %w", err)
+	}
+	trialEndsAt := time.Now().Add(s.config().TrialLength)
 
-	user := &domain.User{
-		ID:                  userID,
+	return &domain.User{
+		ID:                  id,
 		Email:               req.Email,
 		Name:                req.Name,
-		CoinsBalance:        200,
+		CoinsBalance:        s.signupBonus(req),
 		TotalCoinsPurchased: 0,
 		IsTrial:             true,
 		TrialEndsAt:         &trialEndsAt,
 		HasSubscription:     false,
 		SubscriptionEndsAt:  nil,
 		Status:              domain.StatusActive,
+	}, nil
+}
+
+func (s *userService) CreateUser(ctx context.Context, req domain.CreateUserRequest) (*domain.User, error) {
+	user, err := s.newUser(ctx, req)
+	if err != nil {
+		return nil, err
 	}
 
 	if err := s.userRepository.Create(ctx, user); err != nil {
-		log.WithError(err).WithField("user_id", userID).Error("Failed to create user")
+		log.WithError(err).WithField("user_id", user.ID).Error("Failed to create user")
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
-	log.WithFields(log.Fields{
-		"user_id": user.ID,
-		"email":   user.Email,
-	}).Info("User successfully created")
+	log.WithField("user_id", user.ID).Info("User successfully created")
 
-	if err := s.auditService.RecordUserCreated(ctx, user); err != nil {
+	if err := s.auditService.RecordUserCreated(ctx, user, user.CoinsBalance); err != nil {
 		log.WithError(err).WithField("user_id", user.ID).Warn("Failed to record audit event for user creation")
 	}
 
 	return user, nil
 }
 
-func (s *userService) GetUser(ctx context.Context, id string) (*domain.User, error) {
+// GetUser returns the user. Soft-deleted users are reported as not found
+// unless includeDeleted is set.
+func (s *userService) GetUser(ctx context.Context, id string, includeDeleted bool) (*domain.User, error) {
 	if id == "" {
 		return nil, domain.ErrUserIDRequired
 	}
@@ -115,7 +217,7 @@ func (s *userService) GetUser(ctx context.Context, id string) (*domain.User, err
 		return nil, domain.ErrInvalidUUID
 	}
 
-	user, err := s.userRepository.GetByID(ctx, id)
+	user, err := s.userRepository.GetByID(ctx, id, includeDeleted)
 	if err != nil {
 		return nil, err
 	}
@@ -128,7 +230,7 @@ func (s *userService) GetUserByEmail(ctx context.Context, email string) (*domain
 		return nil, domain.ErrEmailRequired
 	}
 
-	user, err := s.userRepository.GetByEmail(ctx, email)
+	user, err := s.userRepository.GetByEmail(ctx, email, false)
 	if err != nil {
 		return nil, err
 	}
@@ -144,7 +246,7 @@ func (s *userService) UpdateUser(ctx context.Context, id string, req domain.Upda
 		return nil, domain.ErrInvalidUUID
 	}
 
-	user, err := s.userRepository.GetByID(ctx, id)
+	user, err := s.userRepository.GetByID(ctx, id, false)
 	if err != nil {
 		return nil, fmt.Errorf("user not found: %w", err)
 	}
@@ -158,24 +260,33 @@ func (s *userService) UpdateUser(ctx context.Context, id string, req domain.Upda
 		if len(req.Email) > domain.MaxEmailLength {
 			return nil, domain.ErrEmailTooLong
 		}
-		emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-		if !emailRegex.MatchString(req.Email) {
+		if !domain.IsValidEmailFormat(req.Email) {
 			return nil, domain.ErrInvalidEmailFormat
 		}
-		existingUser, err := s.userRepository.GetByEmail(ctx, req.Email)
+		existingUser, err := s.userRepository.GetByEmail(ctx, req.Email, true)
 		if err == nil && existingUser != nil {
 			return nil, domain.ErrEmailAlreadyExists
 		}
 		updateFields.Email = &req.Email
 		changes["email"] = req.Email
 		user.Email = req.Email
+		user.EmailVerified = false
 	}
 
 	// Prepare name update
+	if req.Name != "" {
+		req.Name = domain.NormalizeName(req.Name)
+		if req.Name == "" {
+			return nil, domain.ErrNameRequired
+		}
+	}
 	if req.Name != "" && req.Name != user.Name {
 		if len(req.Name) > domain.MaxNameLength {
 			return nil, domain.ErrNameTooLong
 		}
+		if !domain.NameMeetsMinimum(req.Name, s.config().MinNameLength) {
+			return nil, domain.ErrInvalidName
+		}
 		updateFields.Name = &req.Name
 		changes["name"] = req.Name
 		user.Name = req.Name
@@ -230,48 +341,233 @@ func (s *userService) DeleteUser(ctx context.Context, id string) error {
 	return nil
 }
 
-func (s *userService) ListUsers(ctx context.Context, limit, offset int) ([]domain.User, error) {
-	if limit <= 0 {
-		limit = 10
+// HardDeleteUser removes the user for good, soft-deleted or not.
+func (s *userService) HardDeleteUser(ctx context.Context, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return domain.ErrInvalidUUID
+	}
+
+	if err := s.userRepository.HardDelete(ctx, id); err != nil {
+		log.WithError(err).WithField("user_id", id).Error("Failed to hard-delete user")
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	log.WithField("user_id", id).Info("User successfully hard-deleted")
+	return nil
+}
+
+// RestoreUser undoes a soft delete and makes the user active again.
+func (s *userService) RestoreUser(ctx context.Context, id string) (*domain.User, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, domain.ErrInvalidUUID
 	}
-	if limit > domain.MaxListLimit {
-		return nil, domain.ErrListLimitTooLarge
+
+	user, err := s.userRepository.Restore(ctx, id)
+	if err != nil {
+		return nil, err
 	}
-	if offset < 0 {
-		offset = 0
+
+	log.WithField("user_id", id).Info("User successfully restored")
+	return user, nil
+}
+
+// RequestDeletion schedules the user's account for erasure after the grace
+// period and makes it inactive meanwhile.
+func (s *userService) RequestDeletion(ctx context.Context, id string) (*domain.User, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, domain.ErrInvalidUUID
 	}
-	if offset > domain.MaxListOffset {
-		return nil, domain.ErrListOffsetTooLarge
+
+	gracePeriod := s.config().DeletionGracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = domain.DefaultDeletionGracePeriod
 	}
+	now := time.Now().UTC()
 
-	users, err := s.userRepository.List(ctx, limit, offset)
+	user, err := s.userRepository.RequestDeletion(ctx, id, now, now.Add(gracePeriod))
 	if err != nil {
-		return nil, fmt.Errorf("failed to list users: %w", err)
+		log.WithError(err).WithField("user_id", id).Warn("Failed to request account deletion")
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"user_id":       id,
+		"scheduled_for": user.DeletionScheduledFor,
+	}).Info("Account deletion requested")
+
+	if err := s.auditService.RecordAccountDeletionEvent(ctx, id, domain.AuditDeletionRequested, user.DeletionScheduledFor); err != nil {
+		log.WithError(err).WithField("user_id", id).Warn("Failed to record audit event for deletion request")
 	}
 
-	return users, nil
+	return user, nil
 }
 
-func (s *userService) AddCoins(ctx context.Context, userID string, coins int64) error {
+// CancelDeletion withdraws a pending deletion request while its grace period
+// lasts and restores the account's previous status.
+func (s *userService) CancelDeletion(ctx context.Context, id string) (*domain.User, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, domain.ErrInvalidUUID
+	}
+
+	user, err := s.userRepository.CancelDeletion(ctx, id, time.Now().UTC())
+	if err != nil {
+		log.WithError(err).WithField("user_id", id).Warn("Failed to cancel account deletion")
+		return nil, err
+	}
+
+	log.WithField("user_id", id).Info("Account deletion cancelled")
+
+	if err := s.auditService.RecordAccountDeletionEvent(ctx, id, domain.AuditDeletionCancelled, nil); err != nil {
+		log.WithError(err).WithField("user_id", id).Warn("Failed to record audit event for deletion cancellation")
+	}
+
+	return user, nil
+}
+
+// ListUsers returns a page of the users matching filter and how many match
+// in total.
+func (s *userService) ListUsers(ctx context.Context, filter domain.UserListFilter, limit, offset int) (domain.Page[domain.User], error) {
+	limit, offset, err := domain.ListPage(s.config().InvalidInputPolicy, limit, offset)
+	if err != nil {
+		return domain.Page[domain.User]{}, err
+	}
+
+	if filter.MinCoins != nil && filter.MaxCoins != nil && *filter.MinCoins > *filter.MaxCoins {
+		return domain.Page[domain.User]{}, domain.ErrInvalidCoinsRange
+	}
+	for _, status := range filter.Statuses {
+		if !status.Valid() {
+			return domain.Page[domain.User]{}, domain.ErrInvalidStatus
+		}
+	}
+
+	users, err := s.userRepository.List(ctx, filter, limit, offset)
+	if err != nil {
+		return domain.Page[domain.User]{}, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	total, err := s.userRepository.Count(ctx, filter)
+	if err != nil {
+		return domain.Page[domain.User]{}, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	return domain.Page[domain.User]{Items: users, Total: total, Limit: limit, Offset: offset}, nil
+}
+
+// ListCoinTransactions returns a page of the user's coin ledger, newest
+// first, and the number of entries in total.
+func (s *userService) ListCoinTransactions(ctx context.Context, userID string, limit, offset int) (domain.Page[domain.CoinTransaction], error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return domain.Page[domain.CoinTransaction]{}, domain.ErrInvalidUUID
+	}
+	limit, offset, err := domain.ListPage(s.config().InvalidInputPolicy, limit, offset)
+	if err != nil {
+		return domain.Page[domain.CoinTransaction]{}, err
+	}
+
+	// An unknown user is reported as such rather than as an empty ledger
+	if _, err := s.userRepository.GetByID(ctx, userID, false); err != nil {
+		return domain.Page[domain.CoinTransaction]{}, err
+	}
+
+	transactions, total, err := s.userRepository.ListCoinTransactions(ctx, userID, limit, offset)
+	if err != nil {
+		return domain.Page[domain.CoinTransaction]{}, fmt.Errorf("failed to list coin transactions: %w", err)
+	}
+	return domain.Page[domain.CoinTransaction]{Items: transactions, Total: total, Limit: limit, Offset: offset}, nil
+}
+
+// VerifyCoinTransactions returns the discrepancies in the page of the user's
+// coin ledger that ListCoinTransactions returns for the same limit and
+// offset. Any found are counted and logged: they mean a balance changed
+// without its ledger entry, which the ledger writes are meant to rule out.
+func (s *userService) VerifyCoinTransactions(ctx context.Context, userID string, limit, offset int) ([]domain.CoinLedgerDiscrepancy, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, domain.ErrInvalidUUID
+	}
+	limit, offset, err := domain.ListPage(s.config().InvalidInputPolicy, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	discrepancies, err := s.userRepository.VerifyCoinTransactions(ctx, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify coin transactions: %w", err)
+	}
+	if len(discrepancies) > 0 {
+		metrics.CoinLedgerDiscrepancies.Add(int64(len(discrepancies)))
+		log.WithFields(log.Fields{
+			"user_id":       userID,
+			"discrepancies": len(discrepancies),
+			"first_id":      discrepancies[0].TransactionID,
+		}).Error("Coin ledger balance does not follow from the previous entry")
+	}
+	return discrepancies, nil
+}
+
+// ListAdminActions returns a page of the changes admins made to the user,
+// newest first, and how many there are in total. Deleted users are included
+// so an admin can see who deleted them.
+func (s *userService) ListAdminActions(ctx context.Context, userID string, limit, offset int) (domain.Page[domain.AdminAction], error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return domain.Page[domain.AdminAction]{}, domain.ErrInvalidUUID
+	}
+	limit, offset, err := domain.ListPage(s.config().InvalidInputPolicy, limit, offset)
+	if err != nil {
+		return domain.Page[domain.AdminAction]{}, err
+	}
+
+	if _, err := s.userRepository.GetByID(ctx, userID, true); err != nil {
+		return domain.Page[domain.AdminAction]{}, err
+	}
+
+	actions, total, err := s.userRepository.ListAdminActions(ctx, userID, limit, offset)
+	if err != nil {
+		return domain.Page[domain.AdminAction]{}, fmt.Errorf("failed to list admin actions: %w", err)
+	}
+	return domain.Page[domain.AdminAction]{Items: actions, Total: total, Limit: limit, Offset: offset}, nil
+}
+
+// AddCoins changes the user's balance and returns the user as updated.
+// reason is recorded in the ledger; empty means a coin purchase. With an
+// idempotencyKey, a retry of a request already made with that key returns
+// the first result and true without adding again.
+func (s *userService) AddCoins(ctx context.Context, userID string, coins int64, reason, idempotencyKey string) (*domain.User, bool, error) {
 	if userID == "" {
-		return domain.ErrUserIDRequired
+		return nil, false, domain.ErrUserIDRequired
 	}
 	if _, err := uuid.Parse(userID); err != nil {
-		return domain.ErrInvalidUUID
+		return nil, false, domain.ErrInvalidUUID
 	}
 	if coins <= 0 {
-		return domain.ErrInvalidCoinsAmount
+		return nil, false, domain.ErrInvalidCoinsAmount
 	}
 	if coins > domain.MaxCoinsAmount {
-		return domain.ErrCoinsAmountTooLarge
+		return nil, false, domain.ErrCoinsAmountTooLarge
+	}
+	if err := domain.ValidateIdempotencyKey(idempotencyKey); err != nil {
+		return nil, false, err
+	}
+	if reason != "" {
+		if err := domain.ValidateCoinReason(reason); err != nil {
+			return nil, false, err
+		}
 	}
 
-	if err := s.userRepository.AddCoinsAtomic(ctx, userID, coins); err != nil {
+	if reason == "" {
+		reason = domain.CoinReasonPurchase
+	}
+	user, replayed, err := s.userRepository.AddCoinsAtomic(ctx, userID, coins, reason, idempotencyKey)
+	if err != nil {
 		log.WithError(err).WithFields(log.Fields{
 			"user_id": userID,
 			"coins":   coins,
 		}).Error("Failed to add coins to user")
-		return err
+		return nil, false, err
+	}
+	if replayed {
+		log.WithField("user_id", userID).Info("Replayed coin request with a used idempotency key")
+		return user, true, nil
 	}
 
 	log.WithFields(log.Fields{
@@ -283,29 +579,48 @@ func (s *userService) AddCoins(ctx context.Context, userID string, coins int64)
 		log.WithError(err).WithField("user_id", userID).Warn("Failed to record audit event for coins added")
 	}
 
-	return nil
+	return user, false, nil
 }
 
-func (s *userService) DeductCoins(ctx context.Context, userID string, coins int64) error {
+// DeductCoins changes the user's balance and returns the user as updated.
+// An empty reason means spending; reason and idempotencyKey otherwise work
+// as for AddCoins.
+func (s *userService) DeductCoins(ctx context.Context, userID string, coins int64, reason, idempotencyKey string) (*domain.User, bool, error) {
 	if userID == "" {
-		return domain.ErrUserIDRequired
+		return nil, false, domain.ErrUserIDRequired
 	}
 	if _, err := uuid.Parse(userID); err != nil {
-		return domain.ErrInvalidUUID
+		return nil, false, domain.ErrInvalidUUID
 	}
 	if coins <= 0 {
-		return domain.ErrInvalidCoinsAmount
+		return nil, false, domain.ErrInvalidCoinsAmount
 	}
 	if coins > domain.MaxCoinsAmount {
-		return domain.ErrCoinsAmountTooLarge
+		return nil, false, domain.ErrCoinsAmountTooLarge
+	}
+	if err := domain.ValidateIdempotencyKey(idempotencyKey); err != nil {
+		return nil, false, err
+	}
+	if reason != "" {
+		if err := domain.ValidateCoinReason(reason); err != nil {
+			return nil, false, err
+		}
 	}
 
-	if err := s.userRepository.DeductCoinsAtomic(ctx, userID, coins); err != nil {
+	if reason == "" {
+		reason = domain.CoinReasonSpend
+	}
+	user, replayed, err := s.userRepository.DeductCoinsAtomic(ctx, userID, coins, reason, idempotencyKey)
+	if err != nil {
 		log.WithError(err).WithFields(log.Fields{
 			"user_id": userID,
 			"coins":   coins,
 		}).Error("Failed to deduct coins from user")
-		return err
+		return nil, false, err
+	}
+	if replayed {
+		log.WithField("user_id", userID).Info("Replayed coin request with a used idempotency key")
+		return user, true, nil
 	}
 
 	log.WithFields(log.Fields{
@@ -316,137 +631,402 @@ func (s *userService) DeductCoins(ctx context.Context, userID string, coins int6
 	if err := s.auditService.RecordCoinsDeducted(ctx, userID, coins); err != nil {
 		log.WithError(err).WithField("user_id", userID).Warn("Failed to record audit event for coins deducted")
 	}
+	// A deduction only succeeds with coins to take, so a zero balance after
+	// it is always the transition to zero
+	if user.CoinsBalance == 0 {
+		if err := s.auditService.RecordCoinsDepleted(ctx, userID, coins); err != nil {
+			log.WithError(err).WithField("user_id", userID).Warn("Failed to record audit event for coins depleted")
+		}
+	}
 
-	return nil
+	return user, false, nil
 }
 
-func (s *userService) ActivateSubscription(ctx context.Context, userID string, duration time.Duration) error {
+// TransferCoins moves coins from one user to another and returns the sender
+// as updated. Both users must be active and the sender must have the coins;
+// either both balances change or neither does.
+func (s *userService) TransferCoins(ctx context.Context, fromID, toID string, coins int64) (*domain.User, error) {
+	if fromID == "" || toID == "" {
+		return nil, domain.ErrUserIDRequired
+	}
+	from, err := uuid.Parse(fromID)
+	if err != nil {
+		return nil, domain.ErrInvalidUUID
+	}
+	to, err := uuid.Parse(toID)
+	if err != nil {
+		return nil, domain.ErrInvalidUUID
+	}
+	if from == to {
+		return nil, domain.ErrCannotTransferToSelf
+	}
+	if coins <= 0 {
+		return nil, domain.ErrInvalidCoinsAmount
+	}
+	if coins > domain.MaxCoinsAmount {
+		return nil, domain.ErrCoinsAmountTooLarge
+	}
+
+	sender, _, err := s.userRepository.TransferCoins(ctx, from.String(), to.String(), coins)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"from_user_id": fromID,
+			"to_user_id":   toID,
+			"coins":        coins,
+		}).Error("Failed to transfer coins")
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"from_user_id":      fromID,
+		"to_user_id":        toID,
+		"coins_transferred": coins,
+	}).Info("Coins successfully transferred")
+
+	if err := s.auditService.RecordCoinsTransferred(ctx, fromID, toID, coins); err != nil {
+		log.WithError(err).WithField("user_id", fromID).Warn("Failed to record audit event for coins transferred")
+	}
+	if sender.CoinsBalance == 0 {
+		if err := s.auditService.RecordCoinsDepleted(ctx, fromID, coins); err != nil {
+			log.WithError(err).WithField("user_id", fromID).Warn("Failed to record audit event for coins depleted")
+		}
+	}
+
+	return sender, nil
+}
+
+func (s *userService) ActivateSubscription(ctx context.Context, userID string, duration time.Duration, idempotencyKey string) (*domain.User, bool, error) {
 	if userID == "" {
-		return domain.ErrUserIDRequired
+		return nil, false, domain.ErrUserIDRequired
 	}
 	if _, err := uuid.Parse(userID); err != nil {
-		return domain.ErrInvalidUUID
+		return nil, false, domain.ErrInvalidUUID
 	}
 	if duration <= 0 {
-		return domain.ErrInvalidSubscriptionDuration
+		return nil, false, domain.ErrInvalidSubscriptionDuration
 	}
 
 	maxDuration := time.Duration(domain.MaxSubscriptionDurationHours) * time.Hour
 	if duration > maxDuration {
-		return domain.ErrSubscriptionDurationTooLong
+		return nil, false, domain.ErrSubscriptionDurationTooLong
 	}
-
-	user, err := s.userRepository.GetByID(ctx, userID)
-	if err != nil {
-		return fmt.Errorf("user not found: %w", err)
+	if err := domain.ValidateIdempotencyKey(idempotencyKey); err != nil {
+		return nil, false, err
 	}
 
-	subscriptionEndsAt := time.Now().Add(duration)
-	isTrial := false
-
-	if err := s.userRepository.AddCoinsAtomic(ctx, userID, 5000); err != nil {
-		log.WithError(err).WithField("user_id", userID).Error("Failed to add coins for subscription")
-		return fmt.Errorf("failed to add coins: %w", err)
+	if _, err := s.userRepository.GetByID(ctx, userID, false); err != nil {
+		return nil, false, fmt.Errorf("user not found: %w", err)
 	}
 
-	if err := s.userRepository.ActivateSubscriptionAtomic(ctx, userID, isTrial, user.TrialEndsAt, &subscriptionEndsAt); err != nil {
+	user, replayed, err := s.userRepository.ActivateSubscriptionAtomic(ctx, userID, duration, subscriptionBonusCoins, idempotencyKey)
+	if err != nil {
 		if errors.Is(err, domain.ErrSubscriptionAlreadyActive) {
-			return domain.ErrSubscriptionAlreadyActive
+			return nil, false, domain.ErrSubscriptionAlreadyActive
 		}
 		log.WithError(err).WithField("user_id", userID).Error("Failed to activate subscription")
-		return fmt.Errorf("failed to activate subscription: %w", err)
+		return nil, false, fmt.Errorf("failed to activate subscription: %w", err)
+	}
+	if replayed {
+		log.WithField("user_id", userID).Info("Replayed subscription activation with a used idempotency key")
+		return user, true, nil
 	}
 
 	log.WithFields(log.Fields{
 		"user_id":              userID,
-		"coins_added":          5000,
-		"subscription_ends_at": subscriptionEndsAt,
+		"coins_added":          subscriptionBonusCoins,
+		"subscription_ends_at": user.SubscriptionEndsAt,
 	}).Info("Subscription successfully activated")
 
-	if err := s.auditService.RecordSubscriptionEvent(ctx, userID, "user_subscription_activated", duration, subscriptionEndsAt); err != nil {
+	if err := s.auditService.RecordSubscriptionEvent(ctx, userID, domain.AuditSubscriptionActivated, duration, *user.SubscriptionEndsAt); err != nil {
 		log.WithError(err).WithField("user_id", userID).Warn("Failed to record audit event for subscription activation")
 	}
 
-	return nil
+	return user, false, nil
 }
 
-func (s *userService) RenewSubscription(ctx context.Context, userID string, duration time.Duration) error {
+// ProvisionUser creates a user whose subscription is already active, as if
+// CreateUser and ActivateSubscription had run back to back, but in a single
+// transaction: either both happen or neither does.
+func (s *userService) ProvisionUser(ctx context.Context, req domain.CreateUserRequest, duration time.Duration) (*domain.User, error) {
+	if duration <= 0 {
+		return nil, domain.ErrInvalidSubscriptionDuration
+	}
+	if duration > time.Duration(domain.MaxSubscriptionDurationHours)*time.Hour {
+		return nil, domain.ErrSubscriptionDurationTooLong
+	}
+
+	user, err := s.newUser(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptionEndsAt := time.Now().Add(duration)
+	provisioned, err := s.userRepository.CreateWithSubscription(ctx, user, subscriptionBonusCoins, subscriptionEndsAt)
+	if err != nil {
+		if errors.Is(err, domain.ErrEmailAlreadyExists) {
+			return nil, err
+		}
+		log.WithError(err).WithField("user_id", user.ID).Error("Failed to provision user")
+		return nil, fmt.Errorf("failed to provision user: %w", err)
+	}
+
+	log.WithFields(log.Fields{
+		"user_id":              provisioned.ID,
+		"subscription_ends_at": subscriptionEndsAt,
+	}).Info("User successfully provisioned")
+
+	// user holds only the signup bonus; provisioned has the subscription's too
+	if err := s.auditService.RecordUserCreated(ctx, provisioned, user.CoinsBalance); err != nil {
+		log.WithError(err).WithField("user_id", provisioned.ID).Warn("Failed to record audit event for user creation")
+	}
+	if err := s.auditService.RecordSubscriptionEvent(ctx, provisioned.ID, domain.AuditSubscriptionActivated, duration, subscriptionEndsAt); err != nil {
+		log.WithError(err).WithField("user_id", provisioned.ID).Warn("Failed to record audit event for subscription activation")
+	}
+
+	return provisioned, nil
+}
+
+func (s *userService) RenewSubscription(ctx context.Context, userID string, duration time.Duration, idempotencyKey string) (*domain.User, bool, error) {
 	if userID == "" {
-		return domain.ErrUserIDRequired
+		return nil, false, domain.ErrUserIDRequired
 	}
 	if _, err := uuid.Parse(userID); err != nil {
-		return domain.ErrInvalidUUID
+		return nil, false, domain.ErrInvalidUUID
 	}
 	if duration <= 0 {
-		return domain.ErrInvalidSubscriptionDuration
+		return nil, false, domain.ErrInvalidSubscriptionDuration
 	}
 
 	maxDuration := time.Duration(domain.MaxSubscriptionDurationHours) * time.Hour
 	if duration > maxDuration {
-		return domain.ErrSubscriptionDurationTooLong
+		return nil, false, domain.ErrSubscriptionDurationTooLong
 	}
-
-	user, err := s.userRepository.GetByID(ctx, userID)
-	if err != nil {
-		return fmt.Errorf("user not found: %w", err)
-	}
-
-	var newEndsAt time.Time
-	if user.SubscriptionEndsAt != nil && user.SubscriptionEndsAt.After(time.Now()) {
-		newEndsAt = user.SubscriptionEndsAt.Add(duration)
-	} else {
-		newEndsAt = time.Now().Add(duration)
+	if err := domain.ValidateIdempotencyKey(idempotencyKey); err != nil {
+		return nil, false, err
 	}
 
-	if err := s.userRepository.AddCoinsAtomic(ctx, userID, 5000); err != nil {
-		log.WithError(err).WithField("user_id", userID).Error("Failed to add coins for subscription")
-		return fmt.Errorf("failed to add coins: %w", err)
+	if _, err := s.userRepository.GetByID(ctx, userID, false); err != nil {
+		return nil, false, fmt.Errorf("user not found: %w", err)
 	}
 
-	if err := s.userRepository.RenewSubscriptionAtomic(ctx, userID, &newEndsAt); err != nil {
+	user, replayed, err := s.userRepository.RenewSubscriptionAtomic(ctx, userID, duration, subscriptionBonusCoins, idempotencyKey)
+	if err != nil {
 		log.WithError(err).WithField("user_id", userID).Error("Failed to renew subscription")
-		return fmt.Errorf("failed to renew subscription: %w", err)
+		return nil, false, fmt.Errorf("failed to renew subscription: %w", err)
+	}
+	if replayed {
+		log.WithField("user_id", userID).Info("Replayed subscription renewal with a used idempotency key")
+		return user, true, nil
 	}
 
 	log.WithFields(log.Fields{
 		"user_id":              userID,
-		"coins_added":          5000,
-		"subscription_ends_at": newEndsAt,
+		"coins_added":          subscriptionBonusCoins,
+		"subscription_ends_at": user.SubscriptionEndsAt,
 	}).Info("Subscription successfully renewed")
 
-	if err := s.auditService.RecordSubscriptionEvent(ctx, userID, "user_subscription_renewed", duration, newEndsAt); err != nil {
+	if err := s.auditService.RecordSubscriptionEvent(ctx, userID, domain.AuditSubscriptionRenewed, duration, *user.SubscriptionEndsAt); err != nil {
 		log.WithError(err).WithField("user_id", userID).Warn("Failed to record audit event for subscription renewal")
 	}
 
-	return nil
+	return user, false, nil
 }
 
 // HasAccessByUser checks if user has access to functionality
 // Access is granted if:
 // 1. status == "active"
-// 2. AND (has active subscription OR trial is active)
+// 2. AND email is verified, when RequireEmailVerification is set
+// 3. AND (has active subscription OR trial is active)
 func (s *userService) HasAccessByUser(user *domain.User) bool {
+	return s.hasAccessAt(user, time.Now())
+}
+
+func (s *userService) hasAccessAt(user *domain.User, now time.Time) bool {
 	if user == nil {
 		return false
 	}
+	return s.decideAccess(user, now).HasAccess
+}
 
-	if user.Status != domain.StatusActive {
-		return false
+// Capabilities evaluates what user may do now.
+func (s *userService) Capabilities(user *domain.User) domain.Capabilities {
+	return s.decideAccess(user, time.Now()).Capabilities
+}
+
+// ExplainAccess evaluates access for user now and returns every check that
+// went into the decision.
+func (s *userService) ExplainAccess(user *domain.User) domain.AccessDecision {
+	return s.decideAccess(user, time.Now().UTC())
+}
+
+// decideAccess is the single implementation of the access rules; HasAccessByUser
+// and ExplainAccess both derive from it so they can't diverge.
+func (s *userService) decideAccess(user *domain.User, now time.Time) domain.AccessDecision {
+	var d domain.AccessDecision
+	d.EvaluatedAt = now
+
+	d.Status.Value = user.Status
+	d.Status.Passed = user.Status == domain.StatusActive
+
+	d.EmailVerification.Required = s.config().RequireEmailVerification
+	d.EmailVerification.Verified = user.EmailVerified
+	d.EmailVerification.Passed = !d.EmailVerification.Required || user.EmailVerified
+
+	d.Subscription = accessWindow(user.HasSubscription, user.SubscriptionEndsAt, now)
+	d.Trial = accessWindow(user.IsTrial, user.TrialEndsAt, now)
+	legacyTrial := user.IsTrial && user.TrialEndsAt == nil
+	if legacyTrial {
+		policy := s.config().LegacyTrialPolicy
+		metrics.LegacyTrialAccessChecks.Add(policy, 1)
+		d.Trial.Active = policy == domain.LegacyTrialGrant
+	}
+
+	switch {
+	case !d.Status.Passed:
+		d.Reason = domain.AccessReasonUserNotActive
+	case !d.EmailVerification.Passed:
+		d.Reason = domain.AccessReasonEmailNotVerified
+	case d.Subscription.Active:
+		d.HasAccess = true
+		d.Reason = domain.AccessReasonSubscriptionActive
+	case d.Trial.Active:
+		d.HasAccess = true
+		d.Reason = domain.AccessReasonTrialActive
+	case legacyTrial:
+		d.Reason = domain.AccessReasonTrialWithoutEnd
+	default:
+		d.Reason = domain.AccessReasonNoEntitlement
+	}
+
+	d.Capabilities = evaluateCapabilities(&d, user)
+	d.HasAccess = d.Capabilities.CanRead || d.Capabilities.CanCreate
+
+	return d
+}
+
+func accessWindow(flag bool, endsAt *time.Time, now time.Time) domain.AccessWindow {
+	w := domain.AccessWindow{Flag: flag, EndsAt: endsAt}
+	if endsAt != nil {
+		w.InFuture = endsAt.After(now) || endsAt.Equal(now)
 	}
+	w.Active = w.Flag && w.InFuture
+	return w
+}
 
-	now := time.Now()
+// VerificationTokenCleanupPolicy names the table and column the janitor trims
+// for expired email verification tokens; the retention numbers come from configuration.
+func VerificationTokenCleanupPolicy() janitor.Policy {
+	return janitor.Policy{
+		Name:      "email_verification_tokens",
+		Table:     "email_verification_tokens",
+		AgeColumn: "expires_at",
+	}
+}
 
-	if user.HasSubscription && user.SubscriptionEndsAt != nil {
-		if user.SubscriptionEndsAt.After(now) || user.SubscriptionEndsAt.Equal(now) {
-			return true
-		}
+func (s *userService) SendEmailVerification(ctx context.Context, userID string) error {
+	if userID == "" {
+		return domain.ErrUserIDRequired
+	}
+	if _, err := uuid.Parse(userID); err != nil {
+		return domain.ErrInvalidUUID
+	}
+
+	user, err := s.userRepository.GetByID(ctx, userID, false)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return domain.ErrEmailAlreadyVerified
+	}
+
+	token, err := generateVerificationToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate verification token: %w", err)
+	}
+
+	expiresAt := time.Now().Add(s.config().EmailVerificationTTL)
+	if err := s.userRepository.CreateEmailVerificationToken(ctx, userID, hashVerificationToken(token), expiresAt); err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to store email verification token")
+		return err
+	}
+
+	if err := s.verificationSender.SendVerification(ctx, user, token); err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to send email verification")
+		return fmt.Errorf("failed to send verification: %w", err)
 	}
 
-	if user.IsTrial && user.TrialEndsAt != nil {
-		if user.TrialEndsAt.After(now) || user.TrialEndsAt.Equal(now) {
-			return true
+	if err := s.auditService.RecordEmailVerificationEvent(ctx, userID, domain.AuditEmailVerificationSent); err != nil {
+		log.WithError(err).WithField("user_id", userID).Warn("Failed to record audit event for email verification sent")
+	}
+
+	return nil
+}
+
+func (s *userService) ConfirmEmailVerification(ctx context.Context, userID, token string) error {
+	if userID == "" {
+		return domain.ErrUserIDRequired
+	}
+	if _, err := uuid.Parse(userID); err != nil {
+		return domain.ErrInvalidUUID
+	}
+	if token == "" {
+		return domain.ErrInvalidVerificationToken
+	}
+
+	if err := s.userRepository.ConfirmEmailVerification(ctx, userID, hashVerificationToken(token)); err != nil {
+		return err
+	}
+
+	if err := s.auditService.RecordEmailVerificationEvent(ctx, userID, domain.AuditEmailVerified); err != nil {
+		log.WithError(err).WithField("user_id", userID).Warn("Failed to record audit event for email verification")
+	}
+
+	return nil
+}
+
+// generateVerificationToken returns a random hex token to send to the user
+func generateVerificationToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// hashVerificationToken returns the form of a token stored in the database,
+// so a leaked table cannot be used to verify addresses
+func hashVerificationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *userService) GetSubscriptionStatus(ctx context.Context, userID string) (*domain.SubscriptionStatus, error) {
+	user, err := s.GetUser(ctx, userID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	status := &domain.SubscriptionStatus{
+		Now:                now,
+		HasAccess:          s.hasAccessAt(user, now),
+		SubscriptionEndsAt: user.SubscriptionEndsAt,
+		TrialEndsAt:        user.TrialEndsAt,
+	}
+
+	if status.HasAccess {
+		// Access lasts until the later of the active subscription and trial
+		var endsAt time.Time
+		if user.HasSubscription && user.SubscriptionEndsAt != nil && user.SubscriptionEndsAt.After(endsAt) {
+			endsAt = *user.SubscriptionEndsAt
+		}
+		if user.IsTrial && user.TrialEndsAt != nil && user.TrialEndsAt.After(endsAt) {
+			endsAt = *user.TrialEndsAt
+		}
+		if endsAt.After(now) {
+			status.SecondsRemaining = int64(endsAt.Sub(now) / time.Second)
 		}
 	}
 
-	return false
+	return status, nil
 }
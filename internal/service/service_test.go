@@ -0,0 +1,672 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"user-service/internal/domain"
+	"user-service/internal/metrics"
+)
+
+// fakeUserRepo keeps users in memory. Methods a test doesn't override fall
+// through to the nil embedded interface and panic.
+type fakeUserRepo struct {
+	UserRepository
+	users         map[string]*domain.User
+	discrepancies []domain.CoinLedgerDiscrepancy
+	// activationErr fails CreateWithSubscription as a failed activation
+	// does, leaving no user behind.
+	activationErr error
+	// usedKeys holds the idempotency keys of applied deductions.
+	usedKeys map[string]bool
+	// verificationTokens maps user IDs to their pending token hash.
+	verificationTokens map[string]string
+}
+
+func newFakeUserRepo(users ...*domain.User) *fakeUserRepo {
+	f := &fakeUserRepo{users: map[string]*domain.User{}, usedKeys: map[string]bool{}, verificationTokens: map[string]string{}}
+	for _, u := range users {
+		f.users[u.ID] = u
+	}
+	return f
+}
+
+func (f *fakeUserRepo) GetByID(ctx context.Context, id string, includeDeleted bool) (*domain.User, error) {
+	u, ok := f.users[id]
+	if !ok {
+		return nil, domain.ErrUserNotFound
+	}
+	copied := *u
+	return &copied, nil
+}
+
+func (f *fakeUserRepo) GetByEmail(ctx context.Context, email string, includeDeleted bool) (*domain.User, error) {
+	for _, u := range f.users {
+		if u.Email == email {
+			copied := *u
+			return &copied, nil
+		}
+	}
+	return nil, domain.ErrUserNotFound
+}
+
+func (f *fakeUserRepo) Create(ctx context.Context, user *domain.User) error {
+	copied := *user
+	f.users[user.ID] = &copied
+	return nil
+}
+
+func (f *fakeUserRepo) CreateWithSubscription(ctx context.Context, user *domain.User, bonusCoins int64, subscriptionEndsAt time.Time) (*domain.User, error) {
+	if f.activationErr != nil {
+		return nil, f.activationErr
+	}
+	provisioned := *user
+	provisioned.CoinsBalance += bonusCoins
+	provisioned.IsTrial = false
+	provisioned.HasSubscription = true
+	provisioned.SubscriptionEndsAt = &subscriptionEndsAt
+	f.users[user.ID] = &provisioned
+	copied := provisioned
+	return &copied, nil
+}
+
+func (f *fakeUserRepo) DeductCoinsAtomic(ctx context.Context, userID string, coins int64, reason, idempotencyKey string) (*domain.User, bool, error) {
+	u, ok := f.users[userID]
+	if !ok {
+		return nil, false, domain.ErrUserNotFound
+	}
+	if idempotencyKey != "" && f.usedKeys[idempotencyKey] {
+		copied := *u
+		return &copied, true, nil
+	}
+	if u.CoinsBalance < coins {
+		return nil, false, domain.ErrInsufficientCoinsBalance
+	}
+	u.CoinsBalance -= coins
+	if idempotencyKey != "" {
+		f.usedKeys[idempotencyKey] = true
+	}
+	copied := *u
+	return &copied, false, nil
+}
+
+func (f *fakeUserRepo) AddCoinsAtomic(ctx context.Context, userID string, coins int64, reason, idempotencyKey string) (*domain.User, bool, error) {
+	u, ok := f.users[userID]
+	if !ok {
+		return nil, false, domain.ErrUserNotFound
+	}
+	u.CoinsBalance += coins
+	copied := *u
+	return &copied, false, nil
+}
+
+func (f *fakeUserRepo) Update(ctx context.Context, userID string, fields *domain.UpdateUserFields) error {
+	u, ok := f.users[userID]
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	if fields.Email != nil {
+		u.Email = *fields.Email
+	}
+	if fields.Name != nil {
+		u.Name = *fields.Name
+	}
+	if fields.Status != nil {
+		u.Status = *fields.Status
+	}
+	return nil
+}
+
+func (f *fakeUserRepo) CreateEmailVerificationToken(ctx context.Context, userID, tokenHash string, expiresAt time.Time) error {
+	f.verificationTokens[userID] = tokenHash
+	return nil
+}
+
+func (f *fakeUserRepo) ConfirmEmailVerification(ctx context.Context, userID, tokenHash string) error {
+	if hash, ok := f.verificationTokens[userID]; !ok || hash != tokenHash {
+		return domain.ErrInvalidVerificationToken
+	}
+	delete(f.verificationTokens, userID)
+	f.users[userID].EmailVerified = true
+	return nil
+}
+
+func (f *fakeUserRepo) TransferCoins(ctx context.Context, fromID, toID string, coins int64) (*domain.User, *domain.User, error) {
+	from, ok := f.users[fromID]
+	if !ok {
+		return nil, nil, domain.ErrUserNotFound
+	}
+	to, ok := f.users[toID]
+	if !ok {
+		return nil, nil, domain.ErrUserNotFound
+	}
+	if from.CoinsBalance < coins {
+		return nil, nil, domain.ErrInsufficientCoinsBalance
+	}
+	from.CoinsBalance -= coins
+	to.CoinsBalance += coins
+	sender, recipient := *from, *to
+	return &sender, &recipient, nil
+}
+
+func (f *fakeUserRepo) VerifyCoinTransactions(ctx context.Context, userID string, limit, offset int) ([]domain.CoinLedgerDiscrepancy, error) {
+	return f.discrepancies, nil
+}
+
+func TestVerifyCoinTransactionsCountsDiscrepancies(t *testing.T) {
+	const userID = "0190c2a8-7f1e-7a3b-9c4d-000000000001"
+	repo := newFakeUserRepo()
+	svc := NewUserService(repo, nil, nil, UserServiceConfig{})
+
+	before := metrics.CoinLedgerDiscrepancies.Value()
+	if _, err := svc.VerifyCoinTransactions(context.Background(), userID, 10, 0); err != nil {
+		t.Fatalf("VerifyCoinTransactions: %v", err)
+	}
+	if got := metrics.CoinLedgerDiscrepancies.Value() - before; got != 0 {
+		t.Errorf("clean ledger counted %d discrepancies", got)
+	}
+
+	repo.discrepancies = []domain.CoinLedgerDiscrepancy{
+		{TransactionID: 4, PreviousID: 2, Expected: 60, BalanceAfter: 110, Gap: 50},
+		{TransactionID: 7, PreviousID: 6, Expected: 10, BalanceAfter: 0, Gap: -10},
+	}
+	got, err := svc.VerifyCoinTransactions(context.Background(), userID, 10, 0)
+	if err != nil || len(got) != 2 {
+		t.Fatalf("VerifyCoinTransactions: %v, %v; want both discrepancies", got, err)
+	}
+	if counted := metrics.CoinLedgerDiscrepancies.Value() - before; counted != 2 {
+		t.Errorf("counted %d discrepancies, want 2", counted)
+	}
+
+	if _, err := svc.VerifyCoinTransactions(context.Background(), "not-a-uuid", 10, 0); err != domain.ErrInvalidUUID {
+		t.Errorf("invalid ID: %v, want ErrInvalidUUID", err)
+	}
+}
+
+// fakeAuditRecorder records the audit event types of the calls it gets, and
+// the signup bonus of each user created, and fails every one of them with
+// err when set.
+type fakeAuditRecorder struct {
+	UserAuditRecorder
+	events        []string
+	signupBonuses []int64
+	err           error
+}
+
+func (f *fakeAuditRecorder) record(eventType string) error {
+	f.events = append(f.events, eventType)
+	return f.err
+}
+
+func (f *fakeAuditRecorder) RecordUserCreated(ctx context.Context, user *domain.User, signupBonus int64) error {
+	f.signupBonuses = append(f.signupBonuses, signupBonus)
+	return f.record(domain.AuditUserCreated)
+}
+
+func (f *fakeAuditRecorder) RecordSubscriptionEvent(ctx context.Context, userID, eventType string, duration time.Duration, endsAt time.Time) error {
+	return f.record(eventType)
+}
+
+func (f *fakeAuditRecorder) RecordUserUpdated(ctx context.Context, userID string, changes map[string]interface{}) error {
+	return f.record(domain.AuditUserUpdated)
+}
+
+func (f *fakeAuditRecorder) RecordCoinsAdded(ctx context.Context, userID string, amount int64) error {
+	return f.record(domain.AuditUserCoinsAdded)
+}
+
+func (f *fakeAuditRecorder) RecordEmailVerificationEvent(ctx context.Context, userID, eventType string) error {
+	return f.record(eventType)
+}
+
+func (f *fakeAuditRecorder) RecordCoinsDeducted(ctx context.Context, userID string, amount int64) error {
+	return f.record(domain.AuditUserCoinsDeducted)
+}
+
+func (f *fakeAuditRecorder) RecordCoinsDepleted(ctx context.Context, userID string, amount int64) error {
+	return f.record(domain.AuditUserCoinsDepleted)
+}
+
+func (f *fakeAuditRecorder) RecordCoinsTransferred(ctx context.Context, fromID, toID string, amount int64) error {
+	return f.record(domain.AuditUserCoinsTransferred)
+}
+
+// count returns how many recorded events have eventType.
+func (f *fakeAuditRecorder) count(eventType string) int {
+	n := 0
+	for _, e := range f.events {
+		if e == eventType {
+			n++
+		}
+	}
+	return n
+}
+
+func TestUserOperationsRecordAuditEvents(t *testing.T) {
+	for _, failing := range []bool{false, true} {
+		audit := &fakeAuditRecorder{}
+		if failing {
+			audit.err = errors.New("broker unreachable")
+		}
+		repo := newFakeUserRepo()
+		svc := NewUserService(repo, audit, nil, UserServiceConfig{SignupBonusCoins: 100, MinNameLength: 2})
+		ctx := context.Background()
+
+		user, err := svc.CreateUser(ctx, domain.CreateUserRequest{Email: "ada@example.com", Name: "Ada"})
+		if err != nil {
+			t.Fatalf("failing recorder %v: CreateUser: %v", failing, err)
+		}
+		if _, ok := repo.users[user.ID]; !ok {
+			t.Errorf("failing recorder %v: user not stored", failing)
+		}
+		if _, _, err := svc.DeductCoins(ctx, user.ID, 40, "", ""); err != nil {
+			t.Fatalf("failing recorder %v: DeductCoins: %v", failing, err)
+		}
+		if got := repo.users[user.ID].CoinsBalance; got != 60 {
+			t.Errorf("failing recorder %v: balance %d, want 60", failing, got)
+		}
+
+		want := []string{domain.AuditUserCreated, domain.AuditUserCoinsDeducted}
+		if len(audit.events) != len(want) || audit.events[0] != want[0] || audit.events[1] != want[1] {
+			t.Errorf("failing recorder %v: events %v, want %v", failing, audit.events, want)
+		}
+	}
+}
+
+func TestCoinsDepletedOnlyOnTransitionToZero(t *testing.T) {
+	const (
+		aliceID = "0190c2a8-7f1e-7a3b-9c4d-000000000001"
+		bobID   = "0190c2a8-7f1e-7a3b-9c4d-000000000002"
+	)
+	ctx := context.Background()
+
+	t.Run("deduct", func(t *testing.T) {
+		audit := &fakeAuditRecorder{}
+		repo := newFakeUserRepo(&domain.User{ID: aliceID, CoinsBalance: 100})
+		svc := NewUserService(repo, audit, nil, UserServiceConfig{})
+
+		steps := []struct {
+			name         string
+			coins        int64
+			key          string
+			wantErr      error
+			wantDepleted int
+		}{
+			{"leaves a balance", 40, "", nil, 0},
+			{"reaches zero", 60, "drain", nil, 1},
+			{"replay of the draining deduction", 60, "drain", nil, 1},
+			{"from an empty balance", 1, "", domain.ErrInsufficientCoinsBalance, 1},
+		}
+		for _, step := range steps {
+			_, _, err := svc.DeductCoins(ctx, aliceID, step.coins, "", step.key)
+			if err != step.wantErr {
+				t.Fatalf("%s: err = %v, want %v", step.name, err, step.wantErr)
+			}
+			if got := audit.count(domain.AuditUserCoinsDepleted); got != step.wantDepleted {
+				t.Errorf("%s: %d depleted events, want %d", step.name, got, step.wantDepleted)
+			}
+		}
+	})
+
+	t.Run("transfer", func(t *testing.T) {
+		audit := &fakeAuditRecorder{}
+		repo := newFakeUserRepo(&domain.User{ID: aliceID, CoinsBalance: 100}, &domain.User{ID: bobID})
+		svc := NewUserService(repo, audit, nil, UserServiceConfig{})
+
+		if _, err := svc.TransferCoins(ctx, aliceID, bobID, 30); err != nil {
+			t.Fatalf("partial transfer: %v", err)
+		}
+		if got := audit.count(domain.AuditUserCoinsDepleted); got != 0 {
+			t.Errorf("partial transfer: %d depleted events, want 0", got)
+		}
+		if _, err := svc.TransferCoins(ctx, aliceID, bobID, 70); err != nil {
+			t.Fatalf("draining transfer: %v", err)
+		}
+		if got := audit.count(domain.AuditUserCoinsDepleted); got != 1 {
+			t.Errorf("draining transfer: %d depleted events, want 1", got)
+		}
+		// The recipient went from zero up, which is no depletion either way
+		if _, err := svc.TransferCoins(ctx, bobID, aliceID, 50); err != nil {
+			t.Fatalf("return transfer: %v", err)
+		}
+		if got := audit.count(domain.AuditUserCoinsDepleted); got != 1 {
+			t.Errorf("return transfer: %d depleted events, want 1", got)
+		}
+	})
+}
+
+func TestProvisionUser(t *testing.T) {
+	req := domain.CreateUserRequest{Email: "ada@example.com", Name: "Ada"}
+	cfg := UserServiceConfig{SignupBonusCoins: 100, MinNameLength: 2}
+
+	t.Run("provisioned", func(t *testing.T) {
+		repo := newFakeUserRepo()
+		audit := &fakeAuditRecorder{}
+		svc := NewUserService(repo, audit, nil, cfg)
+
+		user, err := svc.ProvisionUser(context.Background(), req, 30*24*time.Hour)
+		if err != nil {
+			t.Fatalf("ProvisionUser: %v", err)
+		}
+		if !user.HasSubscription || user.IsTrial || user.CoinsBalance != 100+subscriptionBonusCoins {
+			t.Errorf("provisioned %+v, want a subscribed user with both bonuses", user)
+		}
+		if until := time.Until(*user.SubscriptionEndsAt); until < 29*24*time.Hour || until > 30*24*time.Hour {
+			t.Errorf("subscription ends in %v, want 30 days", until)
+		}
+		want := []string{domain.AuditUserCreated, domain.AuditSubscriptionActivated}
+		if len(audit.events) != 2 || audit.events[0] != want[0] || audit.events[1] != want[1] {
+			t.Errorf("events %v, want %v", audit.events, want)
+		}
+		if len(audit.signupBonuses) != 1 || audit.signupBonuses[0] != 100 {
+			t.Errorf("audited signup bonuses %v, want [100]", audit.signupBonuses)
+		}
+	})
+
+	t.Run("activation fails", func(t *testing.T) {
+		repo := newFakeUserRepo()
+		repo.activationErr = errors.New("activate subscription: bigint out of range")
+		audit := &fakeAuditRecorder{}
+		svc := NewUserService(repo, audit, nil, cfg)
+
+		if _, err := svc.ProvisionUser(context.Background(), req, 30*24*time.Hour); !errors.Is(err, repo.activationErr) {
+			t.Fatalf("ProvisionUser: %v, want the activation error", err)
+		}
+		if len(repo.users) != 0 {
+			t.Errorf("%d users stored, want none", len(repo.users))
+		}
+		if len(audit.events) != 0 {
+			t.Errorf("events %v recorded for a user that was never created", audit.events)
+		}
+	})
+}
+
+func TestExplainAccessDenialReasons(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		cfg    UserServiceConfig
+		user   domain.User
+		reason string
+	}{
+		{"suspended", UserServiceConfig{}, domain.User{Status: domain.StatusSuspended, IsTrial: true, TrialEndsAt: &future}, domain.AccessReasonUserNotActive},
+		{"inactive", UserServiceConfig{}, domain.User{Status: domain.StatusInactive, HasSubscription: true, SubscriptionEndsAt: &future}, domain.AccessReasonUserNotActive},
+		{"email not verified", UserServiceConfig{RequireEmailVerification: true}, domain.User{Status: domain.StatusActive, HasSubscription: true, SubscriptionEndsAt: &future}, domain.AccessReasonEmailNotVerified},
+		{"legacy trial denied", UserServiceConfig{LegacyTrialPolicy: domain.LegacyTrialDeny}, domain.User{Status: domain.StatusActive, IsTrial: true}, domain.AccessReasonTrialWithoutEnd},
+		{"trial expired", UserServiceConfig{}, domain.User{Status: domain.StatusActive, IsTrial: true, TrialEndsAt: &past}, domain.AccessReasonNoEntitlement},
+		{"subscription expired", UserServiceConfig{}, domain.User{Status: domain.StatusActive, HasSubscription: true, SubscriptionEndsAt: &past}, domain.AccessReasonNoEntitlement},
+		{"subscription flag without end", UserServiceConfig{}, domain.User{Status: domain.StatusActive, HasSubscription: true}, domain.AccessReasonNoEntitlement},
+		{"nothing", UserServiceConfig{}, domain.User{Status: domain.StatusActive}, domain.AccessReasonNoEntitlement},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := NewUserService(nil, nil, nil, tt.cfg)
+			d := svc.ExplainAccess(&tt.user)
+			if d.HasAccess || d.Reason != tt.reason {
+				t.Errorf("access %v for %s, want denied for %s", d.HasAccess, d.Reason, tt.reason)
+			}
+			if svc.HasAccessByUser(&tt.user) {
+				t.Error("HasAccessByUser granted what ExplainAccess denied")
+			}
+			if d.EvaluatedAt.IsZero() || d.GracePeriod.Applicable {
+				t.Errorf("evaluated at %v, grace period %v", d.EvaluatedAt, d.GracePeriod.Applicable)
+			}
+		})
+	}
+}
+
+func TestExplainAccessCapabilityDenials(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	svc := NewUserService(nil, nil, nil, UserServiceConfig{})
+
+	// A trial user can read but not create, and can't purchase without coins
+	d := svc.ExplainAccess(&domain.User{Status: domain.StatusActive, IsTrial: true, TrialEndsAt: &future})
+	if !d.HasAccess || d.Reason != domain.AccessReasonTrialActive {
+		t.Fatalf("access %v for %s, want granted for the trial", d.HasAccess, d.Reason)
+	}
+	want := map[string]string{
+		domain.CapabilityCreate:   domain.AccessReasonNoSubscription,
+		domain.CapabilityPurchase: domain.AccessReasonNoCoins,
+	}
+	if len(d.Capabilities.Reasons) != len(want) {
+		t.Fatalf("reasons %v, want %v", d.Capabilities.Reasons, want)
+	}
+	for capability, reason := range want {
+		if d.Capabilities.Reasons[capability] != reason {
+			t.Errorf("%s denied for %q, want %q", capability, d.Capabilities.Reasons[capability], reason)
+		}
+	}
+}
+
+func TestCreateUserSignupBonus(t *testing.T) {
+	for _, skip := range []bool{false, true} {
+		audit := &fakeAuditRecorder{}
+		repo := newFakeUserRepo()
+		svc := NewUserService(repo, audit, nil, UserServiceConfig{SignupBonusCoins: 100, MinNameLength: 2})
+
+		user, err := svc.CreateUser(context.Background(), domain.CreateUserRequest{Email: "ada@example.com", Name: "Ada", SkipSignupBonus: skip})
+		if err != nil {
+			t.Fatalf("skip %v: CreateUser: %v", skip, err)
+		}
+		want := int64(100)
+		if skip {
+			want = 0
+		}
+		if user.CoinsBalance != want || repo.users[user.ID].CoinsBalance != want {
+			t.Errorf("skip %v: balance %d, stored %d, want %d", skip, user.CoinsBalance, repo.users[user.ID].CoinsBalance, want)
+		}
+		if len(audit.signupBonuses) != 1 || audit.signupBonuses[0] != want {
+			t.Errorf("skip %v: audited signup bonuses %v, want [%d]", skip, audit.signupBonuses, want)
+		}
+	}
+}
+
+// fakeVerificationSender keeps the last token sent to each user.
+type fakeVerificationSender struct {
+	tokens map[string]string
+}
+
+func (f *fakeVerificationSender) SendVerification(ctx context.Context, user *domain.User, token string) error {
+	f.tokens[user.ID] = token
+	return nil
+}
+
+func TestAccessDeniedUntilEmailVerified(t *testing.T) {
+	for _, required := range []bool{false, true} {
+		ctx := context.Background()
+		repo := newFakeUserRepo()
+		audit := &fakeAuditRecorder{}
+		sender := &fakeVerificationSender{tokens: map[string]string{}}
+		svc := NewUserService(repo, audit, sender, UserServiceConfig{
+			MinNameLength:            2,
+			TrialLength:              domain.TrialDuration,
+			RequireEmailVerification: required,
+			EmailVerificationTTL:     time.Hour,
+		})
+
+		user, err := svc.CreateUser(ctx, domain.CreateUserRequest{Email: "ada@example.com", Name: "Ada"})
+		if err != nil {
+			t.Fatalf("required %v: CreateUser: %v", required, err)
+		}
+		if user.EmailVerified {
+			t.Fatalf("required %v: new user starts verified", required)
+		}
+		d := svc.ExplainAccess(repo.users[user.ID])
+		if d.HasAccess == required {
+			t.Errorf("required %v: unverified user access %v (%s)", required, d.HasAccess, d.Reason)
+		}
+		if required && d.Reason != domain.AccessReasonEmailNotVerified {
+			t.Errorf("unverified user denied for %s, want %s", d.Reason, domain.AccessReasonEmailNotVerified)
+		}
+
+		if err := svc.SendEmailVerification(ctx, user.ID); err != nil {
+			t.Fatalf("required %v: SendEmailVerification: %v", required, err)
+		}
+		if err := svc.ConfirmEmailVerification(ctx, user.ID, "not-the-token"); err != domain.ErrInvalidVerificationToken {
+			t.Errorf("required %v: wrong token: %v, want ErrInvalidVerificationToken", required, err)
+		}
+		if svc.HasAccessByUser(repo.users[user.ID]) != !required {
+			t.Errorf("required %v: a wrong token changed access", required)
+		}
+		if err := svc.ConfirmEmailVerification(ctx, user.ID, sender.tokens[user.ID]); err != nil {
+			t.Fatalf("required %v: ConfirmEmailVerification: %v", required, err)
+		}
+		if d := svc.ExplainAccess(repo.users[user.ID]); !d.HasAccess || d.Reason != domain.AccessReasonTrialActive {
+			t.Errorf("required %v: verified user access %v (%s), want the trial", required, d.HasAccess, d.Reason)
+		}
+
+		want := []string{domain.AuditUserCreated, domain.AuditEmailVerificationSent, domain.AuditEmailVerified}
+		if len(audit.events) != len(want) || audit.events[1] != want[1] || audit.events[2] != want[2] {
+			t.Errorf("required %v: events %v, want %v", required, audit.events, want)
+		}
+	}
+}
+
+func TestGetSubscriptionStatus(t *testing.T) {
+	const userID = "0190c2a8-7f1e-7a3b-9c4d-000000000001"
+	now := time.Now().UTC()
+	at := func(d time.Duration) *time.Time { ts := now.Add(d); return &ts }
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name       string
+		user       domain.User
+		wantAccess bool
+		// wantRemaining is the expected seconds_remaining, give or take
+		// the time the test takes
+		wantRemaining time.Duration
+	}{
+		{"active subscription", domain.User{HasSubscription: true, SubscriptionEndsAt: at(10 * day)}, true, 10 * day},
+		{"subscription outlasting the trial", domain.User{HasSubscription: true, SubscriptionEndsAt: at(10 * day), IsTrial: true, TrialEndsAt: at(2 * day)}, true, 10 * day},
+		{"trial outlasting the subscription", domain.User{HasSubscription: true, SubscriptionEndsAt: at(day), IsTrial: true, TrialEndsAt: at(5 * day)}, true, 5 * day},
+		{"expired subscription", domain.User{HasSubscription: true, SubscriptionEndsAt: at(-day)}, false, 0},
+		{"expired subscription and active trial", domain.User{HasSubscription: true, SubscriptionEndsAt: at(-day), IsTrial: true, TrialEndsAt: at(3 * day)}, true, 3 * day},
+		{"trial only", domain.User{IsTrial: true, TrialEndsAt: at(3 * day)}, true, 3 * day},
+		{"expired trial", domain.User{IsTrial: true, TrialEndsAt: at(-time.Hour)}, false, 0},
+		{"neither", domain.User{}, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := tt.user
+			user.ID, user.Status = userID, domain.StatusActive
+			svc := NewUserService(newFakeUserRepo(&user), nil, nil, UserServiceConfig{})
+
+			before := time.Now().UTC()
+			status, err := svc.GetSubscriptionStatus(context.Background(), userID)
+			if err != nil {
+				t.Fatalf("GetSubscriptionStatus: %v", err)
+			}
+			if status.Now.Before(before) || status.Now.After(time.Now().UTC()) || status.Now.Location() != time.UTC {
+				t.Errorf("now %v, want the server's current UTC time", status.Now)
+			}
+			if status.HasAccess != tt.wantAccess {
+				t.Errorf("has_access %v, want %v", status.HasAccess, tt.wantAccess)
+			}
+			remaining := time.Duration(status.SecondsRemaining) * time.Second
+			if remaining > tt.wantRemaining || remaining < tt.wantRemaining-5*time.Second {
+				t.Errorf("seconds_remaining %d, want about %d", status.SecondsRemaining, int64(tt.wantRemaining/time.Second))
+			}
+			if status.SubscriptionEndsAt != user.SubscriptionEndsAt || status.TrialEndsAt != user.TrialEndsAt {
+				t.Errorf("ends at %v and %v, want the user's %v and %v",
+					status.SubscriptionEndsAt, status.TrialEndsAt, user.SubscriptionEndsAt, user.TrialEndsAt)
+			}
+		})
+	}
+
+	svc := NewUserService(newFakeUserRepo(), nil, nil, UserServiceConfig{})
+	if _, err := svc.GetSubscriptionStatus(context.Background(), userID); err != domain.ErrUserNotFound {
+		t.Errorf("unknown user: %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestUserNameMinimum(t *testing.T) {
+	tests := []struct {
+		name      string
+		minLength int
+		wantErr   error
+	}{
+		{"A", 0, nil},
+		{"A", 2, domain.ErrInvalidName},
+		{" A ", 2, domain.ErrInvalidName},
+		{"Al", 2, nil},
+		{"...", 0, domain.ErrInvalidName},
+		{"!?!?", 2, domain.ErrInvalidName},
+		{"- _ -", 2, domain.ErrInvalidName},
+		{"   ", 2, domain.ErrNameRequired},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		repo := newFakeUserRepo()
+		svc := NewUserService(repo, &fakeAuditRecorder{}, nil, UserServiceConfig{MinNameLength: tt.minLength})
+
+		_, err := svc.CreateUser(ctx, domain.CreateUserRequest{Email: "ada@example.com", Name: tt.name})
+		if err != tt.wantErr {
+			t.Errorf("create %q with minimum %d: %v, want %v", tt.name, tt.minLength, err, tt.wantErr)
+		}
+
+		user, err := svc.CreateUser(ctx, domain.CreateUserRequest{Email: "grace@example.com", Name: "Grace"})
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		_, err = svc.UpdateUser(ctx, user.ID, domain.UpdateUserRequest{Name: tt.name})
+		if err != tt.wantErr {
+			t.Errorf("rename to %q with minimum %d: %v, want %v", tt.name, tt.minLength, err, tt.wantErr)
+		}
+		if tt.wantErr != nil && repo.users[user.ID].Name != "Grace" {
+			t.Errorf("rejected rename to %q stored %q", tt.name, repo.users[user.ID].Name)
+		}
+	}
+}
+
+func TestUnicodeUserNames(t *testing.T) {
+	const zwj, rlo, zwsp = "\u200d", "\u202e", "\u200b"
+	tests := []struct {
+		name    string
+		stored  string
+		wantErr error
+	}{
+		{"مريم الأحمد", "مريم الأحمد", nil},
+		{"דוד  כהן", "דוד כהן", nil},
+		{"Ada 👩" + zwj + "💻", "Ada 👩" + zwj + "💻", nil},
+		{rlo + "Mallory", "Mallory", nil},
+		{strings.Repeat("я", domain.MaxNameLength/2), strings.Repeat("я", domain.MaxNameLength/2), nil},
+		// The limit counts bytes, so a Cyrillic name reaches it at half the characters
+		{strings.Repeat("я", domain.MaxNameLength/2+1), "", domain.ErrNameTooLong},
+		{"👨" + zwj + "👩" + zwj + "👧", "", domain.ErrInvalidName},
+		{zwsp + rlo, "", domain.ErrNameRequired},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		repo := newFakeUserRepo()
+		svc := NewUserService(repo, &fakeAuditRecorder{}, nil, UserServiceConfig{})
+
+		created, err := svc.CreateUser(ctx, domain.CreateUserRequest{Email: "ada@example.com", Name: tt.name})
+		if err != tt.wantErr {
+			t.Errorf("create %q: %v, want %v", tt.name, err, tt.wantErr)
+		} else if err == nil && (created.Name != tt.stored || repo.users[created.ID].Name != tt.stored) {
+			t.Errorf("create %q returned %q and stored %q, want %q", tt.name, created.Name, repo.users[created.ID].Name, tt.stored)
+		}
+
+		user, err := svc.CreateUser(ctx, domain.CreateUserRequest{Email: "grace@example.com", Name: "Grace"})
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		updated, err := svc.UpdateUser(ctx, user.ID, domain.UpdateUserRequest{Name: tt.name})
+		if err != tt.wantErr {
+			t.Errorf("rename to %q: %v, want %v", tt.name, err, tt.wantErr)
+		} else if err == nil && updated.Name != tt.stored {
+			t.Errorf("rename to %q returned %q, want %q", tt.name, updated.Name, tt.stored)
+		}
+		want := tt.stored
+		if tt.wantErr != nil {
+			want = "Grace"
+		}
+		if got := repo.users[user.ID].Name; got != want {
+			t.Errorf("rename to %q stored %q, want %q", tt.name, got, want)
+		}
+	}
+}
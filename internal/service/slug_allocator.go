@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"user-service/internal/domain"
+)
+
+// slugAllocator creates products with generated slugs. It tries base, then
+// "<base>-2", "<base>-3", and so on, skipping slugs already handed out in the
+// same batch and moving on when the insert finds the slug taken or reserved,
+// so two rows that derive the same slug, or a concurrent create, don't fail
+// the batch.
+type slugAllocator struct {
+	productRepo ProductRepository
+	// claimed holds the slugs used or found taken so far in this batch.
+	claimed map[string]bool
+}
+
+func newSlugAllocator(productRepo ProductRepository) *slugAllocator {
+	return &slugAllocator{
+		productRepo: productRepo,
+		claimed:     make(map[string]bool),
+	}
+}
+
+// claim marks slug as used by the batch. It reports false if it already was.
+func (a *slugAllocator) claim(slug string) bool {
+	if a.claimed[slug] {
+		return false
+	}
+	a.claimed[slug] = true
+	return true
+}
+
+// create inserts req under the first free candidate derived from base.
+func (a *slugAllocator) create(ctx context.Context, req domain.CreateProductRequest, base string, maxPerCategory int) (*domain.Product, error) {
+	for n := 1; n <= domain.MaxSlugAttempts; n++ {
+		req.Slug = domain.SuffixedSlug(base, n)
+		if !a.claim(req.Slug) {
+			continue
+		}
+
+		product, err := a.productRepo.Create(ctx, req, maxPerCategory)
+		if errors.Is(err, domain.ErrProductSlugExists) || errors.Is(err, domain.ErrSlugReserved) {
+			continue
+		}
+		return product, err
+	}
+	return nil, domain.ErrNoFreeSlug
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"user-service/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+// conflictingProductRepo simulates what the products table and the slug
+// reservations do to an insert: taken slugs fail with ErrProductSlugExists,
+// reserved ones with ErrSlugReserved, and a racing slug fails once as if a
+// concurrent create had inserted it first.
+type conflictingProductRepo struct {
+	*fakeProductRepo
+	reserved map[string]bool
+	racing   map[string]bool
+	// failWith is returned for every insert when set.
+	failWith error
+	attempts []string
+}
+
+func newConflictingProductRepo(taken ...string) *conflictingProductRepo {
+	r := &conflictingProductRepo{fakeProductRepo: newFakeProductRepo(), reserved: map[string]bool{}, racing: map[string]bool{}}
+	for _, slug := range taken {
+		r.bySlug[slug] = &domain.Product{ID: uuid.NewString(), Slug: slug}
+	}
+	return r
+}
+
+func (r *conflictingProductRepo) Create(ctx context.Context, req domain.CreateProductRequest, maxPerCategory int) (*domain.Product, error) {
+	r.attempts = append(r.attempts, req.Slug)
+	switch {
+	case r.failWith != nil:
+		return nil, r.failWith
+	case r.reserved[req.Slug]:
+		return nil, domain.ErrSlugReserved
+	case r.racing[req.Slug]:
+		delete(r.racing, req.Slug)
+		r.bySlug[req.Slug] = &domain.Product{ID: uuid.NewString(), Slug: req.Slug}
+		return nil, domain.ErrProductSlugExists
+	}
+	return r.fakeProductRepo.Create(ctx, req, maxPerCategory)
+}
+
+func allocatorRequest() domain.CreateProductRequest {
+	active := true
+	return domain.CreateProductRequest{ID: uuid.NewString(), CategoryID: uuid.NewString(), Name: "Gold Pack", PriceCoins: 10, IsActive: &active}
+}
+
+func TestSlugAllocatorConflicts(t *testing.T) {
+	tests := []struct {
+		name         string
+		taken        []string
+		reserved     []string
+		racing       []string
+		wantSlug     string
+		wantAttempts []string
+	}{
+		{"free", nil, nil, nil, "gold-pack", []string{"gold-pack"}},
+		{"taken", []string{"gold-pack"}, nil, nil, "gold-pack-2", []string{"gold-pack", "gold-pack-2"}},
+		{
+			"taken and reserved", []string{"gold-pack", "gold-pack-2"}, []string{"gold-pack-3"}, nil,
+			"gold-pack-4", []string{"gold-pack", "gold-pack-2", "gold-pack-3", "gold-pack-4"},
+		},
+		{"lost a race", nil, nil, []string{"gold-pack"}, "gold-pack-2", []string{"gold-pack", "gold-pack-2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newConflictingProductRepo(tt.taken...)
+			for _, slug := range tt.reserved {
+				repo.reserved[slug] = true
+			}
+			for _, slug := range tt.racing {
+				repo.racing[slug] = true
+			}
+
+			product, err := newSlugAllocator(repo).create(context.Background(), allocatorRequest(), "gold-pack", 0)
+			if err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			if product.Slug != tt.wantSlug {
+				t.Errorf("got slug %s, want %s", product.Slug, tt.wantSlug)
+			}
+			if strings.Join(repo.attempts, " ") != strings.Join(tt.wantAttempts, " ") {
+				t.Errorf("tried %v, want %v", repo.attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestSlugAllocatorSkipsSlugsClaimedInBatch(t *testing.T) {
+	ctx := context.Background()
+	repo := newConflictingProductRepo()
+	a := newSlugAllocator(repo)
+	a.claim("gold-pack-2")
+
+	var slugs []string
+	for range 3 {
+		product, err := a.create(ctx, allocatorRequest(), "gold-pack", 0)
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		slugs = append(slugs, product.Slug)
+	}
+	if got := strings.Join(slugs, " "); got != "gold-pack gold-pack-3 gold-pack-4" {
+		t.Errorf("got slugs %s, want gold-pack gold-pack-3 gold-pack-4", got)
+	}
+	// Slugs the batch already holds never reach the database
+	if len(repo.attempts) != 3 {
+		t.Errorf("tried %v, want one insert per product", repo.attempts)
+	}
+}
+
+func TestSlugAllocatorGivesUp(t *testing.T) {
+	ctx := context.Background()
+	var taken []string
+	for n := 1; n <= domain.MaxSlugAttempts; n++ {
+		taken = append(taken, domain.SuffixedSlug("gold-pack", n))
+	}
+	repo := newConflictingProductRepo(taken...)
+	if _, err := newSlugAllocator(repo).create(ctx, allocatorRequest(), "gold-pack", 0); err != domain.ErrNoFreeSlug {
+		t.Errorf("every candidate taken: got %v, want ErrNoFreeSlug", err)
+	}
+	if len(repo.attempts) != domain.MaxSlugAttempts {
+		t.Errorf("%d attempts, want %d", len(repo.attempts), domain.MaxSlugAttempts)
+	}
+
+	// Other failures are not slug conflicts and are not retried
+	repo = newConflictingProductRepo()
+	repo.failWith = domain.ErrCategoryFull
+	if _, err := newSlugAllocator(repo).create(ctx, allocatorRequest(), "gold-pack", 0); !errors.Is(err, domain.ErrCategoryFull) {
+		t.Errorf("full category: got %v, want ErrCategoryFull", err)
+	}
+	if len(repo.attempts) != 1 {
+		t.Errorf("tried %v after a non-conflict error, want one attempt", repo.attempts)
+	}
+}
+
+func TestSuffixedSlugFitsLimit(t *testing.T) {
+	base := strings.Repeat("ab-", 17)[:50]
+	for _, n := range []int{1, 2, 10, domain.MaxSlugAttempts} {
+		slug := domain.SuffixedSlug(base, n)
+		if len(slug) > 50 || domain.ValidateProductSlug(slug) != nil {
+			t.Errorf("candidate %d %q is not a valid slug", n, slug)
+		}
+	}
+	if got := domain.Slugify("  Gold  Pack! (2026) "); got != "gold-pack-2026" {
+		t.Errorf("Slugify = %q, want gold-pack-2026", got)
+	}
+	if got := domain.Slugify("Золото"); got != "product" {
+		t.Errorf("Slugify of a name with no ASCII = %q, want product", got)
+	}
+}
+
+func TestImportResolvesSlugCollisions(t *testing.T) {
+	ctx := context.Background()
+	repo := newConflictingProductRepo("gold-pack")
+	repo.racing["silver-pack"] = true
+	svc := NewProductService(repo, 1)
+	categoryID := uuid.NewString()
+
+	rows := []domain.CreateProductRequest{
+		{CategoryID: categoryID, Name: "Gold Pack", PriceCoins: 10},
+		{CategoryID: categoryID, Name: "Gold Pack", PriceCoins: 10},
+		{CategoryID: categoryID, Slug: "gold-pack-2", Name: "Gold Pack Two", PriceCoins: 10},
+		{CategoryID: categoryID, Name: "Silver Pack", PriceCoins: 5},
+		{CategoryID: categoryID, Slug: "bronze", Name: "Bronze", PriceCoins: 1},
+		{CategoryID: categoryID, Slug: "bronze", Name: "Bronze again", PriceCoins: 1},
+		{CategoryID: categoryID, Name: "Free Pack", PriceCoins: 0},
+	}
+	results, err := svc.ImportProducts(ctx, domain.ProductImportRequest{Products: rows})
+	if err != nil {
+		t.Fatalf("ImportProducts: %v", err)
+	}
+
+	want := []struct {
+		slug string
+		err  error
+	}{
+		{"gold-pack-3", nil},
+		{"gold-pack-4", nil},
+		{"gold-pack-2", nil},
+		{"silver-pack-2", nil},
+		{"bronze", nil},
+		{"bronze", domain.ErrProductSlugExists},
+		{"", domain.ErrInvalidPrice},
+	}
+	for i, r := range results {
+		if r.Index != i || r.Slug != want[i].slug || !errors.Is(r.Err, want[i].err) {
+			t.Errorf("row %d: index %d, slug %q, error %v; want slug %q, error %v", i, r.Index, r.Slug, r.Err, want[i].slug, want[i].err)
+		}
+		if (r.Product != nil) != (r.Err == nil) || r.Product != nil && r.Product.Slug != r.Slug {
+			t.Errorf("row %d: product %+v does not match slug %q and error %v", i, r.Product, r.Slug, r.Err)
+		}
+	}
+}
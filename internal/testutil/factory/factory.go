@@ -0,0 +1,211 @@
+// Package factory builds domain values for tests. Every builder returns a
+// value that passes domain validation as is, with unique emails and slugs,
+// and takes options for the states a test cares about.
+package factory
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+	"user-service/internal/domain"
+
+	"github.com/google/uuid"
+)
+
+// seq keeps emails and slugs unique across the values one test binary builds.
+var seq atomic.Int64
+
+func next() int64 {
+	return seq.Add(1)
+}
+
+// UserOption changes a user built by User.
+type UserOption func(*domain.User)
+
+// User returns an active, unverified user in the middle of a trial.
+func User(opts ...UserOption) *domain.User {
+	n := next()
+	now := time.Now().UTC()
+	trialEndsAt := now.Add(domain.TrialDuration)
+	user := &domain.User{
+		ID:          uuid.NewString(),
+		Email:       fmt.Sprintf("user%d@example.com", n),
+		Name:        fmt.Sprintf("Test User %d", n),
+		IsTrial:     true,
+		TrialEndsAt: &trialEndsAt,
+		Status:      domain.StatusActive,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	for _, opt := range opts {
+		opt(user)
+	}
+	return user
+}
+
+// WithEmail sets the user's email.
+func WithEmail(email string) UserOption {
+	return func(u *domain.User) {
+		u.Email = email
+	}
+}
+
+// WithStatus sets the user's status.
+func WithStatus(status domain.UserStatus) UserOption {
+	return func(u *domain.User) {
+		u.Status = status
+	}
+}
+
+// WithActiveSubscription gives the user a subscription ending at until, in
+// place of the trial.
+func WithActiveSubscription(until time.Time) UserOption {
+	return func(u *domain.User) {
+		u.HasSubscription = true
+		u.SubscriptionEndsAt = &until
+		u.IsTrial = false
+		u.TrialEndsAt = nil
+	}
+}
+
+// WithExpiredTrial makes the user's trial one that ended an hour ago.
+func WithExpiredTrial() UserOption {
+	return func(u *domain.User) {
+		ended := time.Now().UTC().Add(-time.Hour)
+		u.IsTrial = true
+		u.TrialEndsAt = &ended
+	}
+}
+
+// CategoryOption changes a category built by Category.
+type CategoryOption func(*domain.ProductCategory)
+
+// Category returns an active category.
+func Category(opts ...CategoryOption) *domain.ProductCategory {
+	n := next()
+	now := time.Now().UTC()
+	category := &domain.ProductCategory{
+		ID:        uuid.NewString(),
+		Slug:      fmt.Sprintf("category-%d", n),
+		Name:      fmt.Sprintf("Category %d", n),
+		IsActive:  true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for _, opt := range opts {
+		opt(category)
+	}
+	return category
+}
+
+// WithPosition sets the category's position.
+func WithPosition(position int) CategoryOption {
+	return func(c *domain.ProductCategory) {
+		c.Position = position
+	}
+}
+
+// InactiveCategory makes the category inactive.
+func InactiveCategory() CategoryOption {
+	return func(c *domain.ProductCategory) {
+		c.IsActive = false
+	}
+}
+
+// ProductOption changes a product built by Product.
+type ProductOption func(*domain.Product)
+
+// Product returns an active product with unlimited stock priced at 100
+// coins, in no category until WithCategory gives it one.
+func Product(opts ...ProductOption) *domain.Product {
+	n := next()
+	now := time.Now().UTC()
+	product := &domain.Product{
+		ID:         uuid.NewString(),
+		Slug:       fmt.Sprintf("product-%d", n),
+		Name:       fmt.Sprintf("Product %d", n),
+		PriceCoins: 100,
+		IsActive:   true,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	for _, opt := range opts {
+		opt(product)
+	}
+	return product
+}
+
+// WithCategory puts the product in the category categoryID.
+func WithCategory(categoryID string) ProductOption {
+	return func(p *domain.Product) {
+		p.CategoryID = categoryID
+	}
+}
+
+// WithPrice sets the product's price in coins.
+func WithPrice(price int64) ProductOption {
+	return func(p *domain.Product) {
+		p.PriceCoins = price
+	}
+}
+
+// WithStock limits the product to stock units.
+func WithStock(stock int64) ProductOption {
+	return func(p *domain.Product) {
+		p.Stock = &stock
+	}
+}
+
+// InactiveProduct makes the product inactive.
+func InactiveProduct() ProductOption {
+	return func(p *domain.Product) {
+		p.IsActive = false
+	}
+}
+
+// AuditEventOption changes an event built by AuditEvent.
+type AuditEventOption func(*domain.AuditEvent)
+
+// AuditEvent returns a user_created event for a new user ID, occurring now.
+func AuditEvent(opts ...AuditEventOption) *domain.AuditEvent {
+	event := &domain.AuditEvent{
+		ID:         uuid.NewString(),
+		Service:    "user-service",
+		EventType:  domain.AuditUserCreated,
+		EntityID:   uuid.NewString(),
+		OccurredAt: time.Now().UTC(),
+		Payload:    map[string]interface{}{},
+	}
+	for _, opt := range opts {
+		opt(event)
+	}
+	return event
+}
+
+// WithEventType sets the event's type.
+func WithEventType(eventType string) AuditEventOption {
+	return func(e *domain.AuditEvent) {
+		e.EventType = eventType
+	}
+}
+
+// WithEntity sets the ID of the entity the event is about.
+func WithEntity(entityID string) AuditEventOption {
+	return func(e *domain.AuditEvent) {
+		e.EntityID = entityID
+	}
+}
+
+// WithOccurredAt sets when the event occurred.
+func WithOccurredAt(at time.Time) AuditEventOption {
+	return func(e *domain.AuditEvent) {
+		e.OccurredAt = at
+	}
+}
+
+// WithPayload sets the event's payload.
+func WithPayload(payload map[string]interface{}) AuditEventOption {
+	return func(e *domain.AuditEvent) {
+		e.Payload = payload
+	}
+}
@@ -0,0 +1,93 @@
+package factory
+
+import (
+	"testing"
+	"time"
+	"user-service/internal/domain"
+)
+
+func TestDefaultsPassValidation(t *testing.T) {
+	user := User()
+	if !domain.IsValidEmailFormat(user.Email) || len(user.Email) > domain.MaxEmailLength {
+		t.Errorf("user email %q is invalid", user.Email)
+	}
+	if !domain.NameMeetsMinimum(user.Name, domain.DefaultMinNameLength) || len(user.Name) > domain.MaxNameLength {
+		t.Errorf("user name %q is invalid", user.Name)
+	}
+	if !user.Status.Valid() {
+		t.Errorf("user status %q is invalid", user.Status)
+	}
+	if !user.IsTrial || user.TrialEndsAt == nil || !user.TrialEndsAt.After(time.Now()) {
+		t.Errorf("user trial %v ending %v, want one in progress", user.IsTrial, user.TrialEndsAt)
+	}
+
+	category := Category()
+	if err := domain.ValidateCategorySlug(category.Slug); err != nil {
+		t.Errorf("category slug %q: %v", category.Slug, err)
+	}
+	if err := domain.ValidateCategoryName(category.Name, domain.DefaultMinNameLength); err != nil {
+		t.Errorf("category name %q: %v", category.Name, err)
+	}
+
+	product := Product()
+	if err := domain.ValidateProductSlug(product.Slug); err != nil {
+		t.Errorf("product slug %q: %v", product.Slug, err)
+	}
+	if err := domain.ValidateProductName(product.Name, domain.DefaultMinNameLength); err != nil {
+		t.Errorf("product name %q: %v", product.Name, err)
+	}
+	if err := domain.ValidateProductPrice(product.PriceCoins); err != nil {
+		t.Errorf("product price %d: %v", product.PriceCoins, err)
+	}
+	if err := domain.ValidateProductStock(product.Stock); err != nil {
+		t.Errorf("product stock: %v", err)
+	}
+
+	event := AuditEvent()
+	if !domain.IsKnownAuditEventType(event.EventType) {
+		t.Errorf("audit event type %q is unknown", event.EventType)
+	}
+}
+
+func TestValuesAreUnique(t *testing.T) {
+	if a, b := User(), User(); a.ID == b.ID || a.Email == b.Email {
+		t.Errorf("two users share an ID or email: %s %s", a.Email, b.Email)
+	}
+	if a, b := Product(), Product(); a.ID == b.ID || a.Slug == b.Slug {
+		t.Errorf("two products share an ID or slug: %s %s", a.Slug, b.Slug)
+	}
+	if a, b := Category(), Category(); a.ID == b.ID || a.Slug == b.Slug {
+		t.Errorf("two categories share an ID or slug: %s %s", a.Slug, b.Slug)
+	}
+}
+
+func TestUserOptions(t *testing.T) {
+	until := time.Now().Add(24 * time.Hour)
+	subscribed := User(WithActiveSubscription(until))
+	if !subscribed.HasSubscription || subscribed.SubscriptionEndsAt == nil || !subscribed.SubscriptionEndsAt.Equal(until) {
+		t.Errorf("subscription %v ending %v, want one ending %v", subscribed.HasSubscription, subscribed.SubscriptionEndsAt, until)
+	}
+	if subscribed.IsTrial {
+		t.Error("subscribed user is still on a trial")
+	}
+
+	expired := User(WithExpiredTrial())
+	if !expired.IsTrial || expired.TrialEndsAt == nil || !expired.TrialEndsAt.Before(time.Now()) {
+		t.Errorf("trial %v ending %v, want one that ended", expired.IsTrial, expired.TrialEndsAt)
+	}
+
+	if got := User(WithStatus(domain.StatusSuspended)).Status; got != domain.StatusSuspended {
+		t.Errorf("status %q, want suspended", got)
+	}
+}
+
+func TestProductOptions(t *testing.T) {
+	product := Product(WithCategory("c1"), WithPrice(30), WithStock(2), InactiveProduct())
+	if product.CategoryID != "c1" || product.PriceCoins != 30 || product.Stock == nil || *product.Stock != 2 || product.IsActive {
+		t.Errorf("product %+v, want inactive in c1 at 30 coins with 2 in stock", product)
+	}
+	category := Category(WithPosition(3), InactiveCategory())
+	if category.Position != 3 || category.IsActive {
+		t.Errorf("category %+v, want inactive at position 3", category)
+	}
+}
@@ -0,0 +1,100 @@
+// Package timing collects where a request spent its time, as named spans such
+// as database queries and Kafka publishes, so slow requests can be explained
+// in a single log line.
+package timing
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type contextKey struct{}
+
+type span struct {
+	name  string
+	total time.Duration
+	count int
+}
+
+// Recorder accumulates span durations for one request. Spans with the same
+// name are summed. It is safe for concurrent use.
+type Recorder struct {
+	mu    sync.Mutex
+	spans []span // nil until the first span, so requests that record nothing don't allocate
+}
+
+// WithRecorder returns a copy of ctx carrying a new Recorder.
+func WithRecorder(ctx context.Context) (context.Context, *Recorder) {
+	r := &Recorder{}
+	return context.WithValue(ctx, contextKey{}, r), r
+}
+
+// Record adds the time since start to the span name of the request in ctx.
+// It does nothing when ctx carries no Recorder. It is meant to be deferred
+// with start evaluated at the defer statement:
+//
+//	defer timing.Record(ctx, "db_get_by_id", time.Now())
+func Record(ctx context.Context, name string, start time.Time) {
+	r, _ := ctx.Value(contextKey{}).(*Recorder)
+	if r == nil {
+		return
+	}
+	r.add(name, time.Since(start))
+}
+
+func (r *Recorder) add(name string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.spans {
+		if r.spans[i].name == name {
+			r.spans[i].total += d
+			r.spans[i].count++
+			return
+		}
+	}
+	if r.spans == nil {
+		r.spans = make([]span, 0, 4)
+	}
+	r.spans = append(r.spans, span{name: name, total: d, count: 1})
+}
+
+// Total returns the summed duration of all spans. Spans that ran
+// concurrently are each counted in full.
+func (r *Recorder) Total() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var total time.Duration
+	for _, s := range r.spans {
+		total += s.total
+	}
+	return total
+}
+
+// Breakdown formats the spans in the order they were first recorded, for
+// example "db_get_by_id=12.1ms db_update=80ms kafka_publish=950ms". Spans
+// recorded more than once show their count, as in "db_get_by_id=24ms(x2)".
+func (r *Recorder) Breakdown() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b strings.Builder
+	for i, s := range r.spans {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(s.name)
+		b.WriteByte('=')
+		b.WriteString(s.total.Round(100 * time.Microsecond).String())
+		if s.count > 1 {
+			b.WriteString("(x")
+			b.WriteString(strconv.Itoa(s.count))
+			b.WriteByte(')')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,58 @@
+package timing
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecordSumsSpansByName(t *testing.T) {
+	ctx, r := WithRecorder(context.Background())
+	Record(ctx, "db_get", time.Now().Add(-12*time.Millisecond))
+	if total := r.Total(); total < 12*time.Millisecond || total > time.Second {
+		t.Fatalf("Total() = %v after a 12ms span", total)
+	}
+
+	_, r = WithRecorder(context.Background())
+	r.add("db_get", 12*time.Millisecond)
+	r.add("kafka_publish", 950*time.Millisecond)
+	r.add("db_get", 12*time.Millisecond)
+	r.add("serialize", 1234*time.Microsecond)
+
+	if got, want := r.Breakdown(), "db_get=24ms(x2) kafka_publish=950ms serialize=1.2ms"; got != want {
+		t.Errorf("Breakdown() = %q, want %q", got, want)
+	}
+	if got, want := r.Total(), 975234*time.Microsecond; got != want {
+		t.Errorf("Total() = %v, want %v", got, want)
+	}
+}
+
+func TestRecordWithoutRecorder(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now()
+	if allocs := testing.AllocsPerRun(100, func() { Record(ctx, "db_get", start) }); allocs != 0 {
+		t.Errorf("Record without a recorder allocates %v times", allocs)
+	}
+}
+
+func TestEmptyRecorder(t *testing.T) {
+	_, r := WithRecorder(context.Background())
+	if r.spans != nil || r.Breakdown() != "" || r.Total() != 0 {
+		t.Errorf("empty recorder has spans %v, breakdown %q, total %v", r.spans, r.Breakdown(), r.Total())
+	}
+}
+
+func TestRecordConcurrently(t *testing.T) {
+	ctx, r := WithRecorder(context.Background())
+	start := time.Now().Add(-time.Millisecond)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Go(func() { Record(ctx, "db_query", start) })
+	}
+	wg.Wait()
+
+	if len(r.spans) != 1 || r.spans[0].count != 50 {
+		t.Errorf("spans %+v, want one db_query span counted 50 times", r.spans)
+	}
+}
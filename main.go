@@ -3,15 +3,31 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
+	"user-service/internal/breaker"
+	"user-service/internal/cache"
 	"user-service/internal/config"
+	"user-service/internal/domain"
+	"user-service/internal/featureflag"
+	"user-service/internal/janitor"
+	"user-service/internal/jobs"
+	"user-service/internal/jsonenc"
+	"user-service/internal/leader"
+	"user-service/internal/metrics"
+	"user-service/internal/pii"
 	"user-service/internal/publisher"
 	"user-service/internal/repository"
+	"user-service/internal/reqctx"
+	"user-service/internal/semaphore"
 	"user-service/internal/server"
 	"user-service/internal/service"
 
@@ -25,9 +41,19 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 )
 
 func main() {
+	// exitCode is set by one-shot subcommands; exiting from a defer lets the
+	// other deferred closes run first
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
 	log.SetFormatter(&log.TextFormatter{
 		FullTimestamp: true,
 	})
@@ -48,26 +74,17 @@ func main() {
 	log.SetLevel(level)
 	log.WithField("level", level.String()).Info("Logger initialized")
 
-	if err := godotenv.Load("../.env"); err != nil {
+	const envFile = "../.env"
+	if err := godotenv.Load(envFile); err != nil {
 		log.Warn("Could not load .env file.")
 	}
 	cfg, err := config.Load()
 	if err != nil {
 		log.WithField("error", err).Fatal("Could not load configuration")
 	}
+	configHolder := config.NewHolder(cfg, envFile)
 	dbURL := cfg.DB.URL
 
-	log.Info("Starting database migration...")
-	m, err := migrate.New("file://db/migrations", dbURL)
-	if err != nil {
-		log.WithField("error", err).Fatal("Could not create migrate instance")
-	}
-
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		log.WithField("error", err).Fatal("Could not apply migration")
-	}
-	log.Info("Database migration finished successfully.")
-
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		log.WithField("error", err).Fatal("Could not connect to the database")
@@ -82,93 +99,542 @@ func main() {
 	if err := db.PingContext(pingCtx); err != nil {
 		log.WithField("error", err).Fatal("Could not ping the database")
 	}
+	healthConn, err := server.NewHealthConn(pingCtx, db)
+	if err != nil {
+		log.WithField("error", err).Fatal("Could not set aside the health check connection")
+	}
+
+	// Heavy operations share what's left of the pool once interactive
+	// requests, the health check and the leader have theirs
+	heavyOps := semaphore.NewWeighted(int64(cfg.HeavyOpConns()))
+	metrics.PublishFunc("db_heavy_ops_conns_in_use", func() interface{} {
+		return heavyOps.InUse()
+	})
 
 	log.Info("Successfully connected to the PostgreSQL database.")
 
-	// Create repository
-	userRepository := repository.NewPostgresUserRepository(db)
+	// Replicas starting together take turns; the first applies the migrations
+	// and the rest find nothing to do.
+	log.Info("Starting database migration...")
+	migrateCtx, migrateCancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	err = leader.WithLock(migrateCtx, db, leader.MigrationLockKey, func() error {
+		m, err := migrate.New("file://db/migrations", dbURL)
+		if err != nil {
+			return fmt.Errorf("could not create migrate instance: %w", err)
+		}
+		defer m.Close()
 
-	// Create audit publisher
-	kafkaBootstrap := os.Getenv("KAFKA_BOOTSTRAP_SERVERS")
-	if kafkaBootstrap == "" {
-		log.Fatal("FATAL: KAFKA_BOOTSTRAP_SERVERS environment variable is not set")
+		if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+			return fmt.Errorf("could not apply migration: %w", err)
+		}
+		return nil
+	})
+	migrateCancel()
+	if err != nil {
+		log.WithField("error", err).Fatal("Database migration failed")
 	}
+	log.Info("Database migration finished successfully.")
 
-	auditTopic := os.Getenv("KAFKA_AUDIT_TOPIC")
-	if auditTopic == "" {
-		auditTopic = "audit_events"
+	// Create repository
+	postgresUserRepository := repository.NewPostgresUserRepository(db)
+	var piiCipher *pii.Cipher
+	if cfg.PII.Configured() {
+		piiCipher, err = newPIICipher(cfg.PII)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid PII encryption keys")
+		}
+		postgresUserRepository.SetPIICipher(piiCipher, cfg.PII.EncryptionEnabled)
+		log.WithField("encrypt_writes", cfg.PII.EncryptionEnabled).Info("PII encryption keys loaded")
+	}
+	var userRepository service.UserRepository = postgresUserRepository
+	// userCache stays nil when the cache is disabled
+	var userCache *cache.UserRepository
+	if cfg.Cache.Enabled {
+		userCache = cache.NewUserRepository(userRepository, cache.Config{
+			TTL:                cfg.Cache.TTL,
+			MaxEntries:         cfg.Cache.MaxEntries,
+			ShadowMode:         cfg.Cache.ShadowMode,
+			ShadowSampleRate:   cfg.Cache.ShadowSampleRate,
+			UpdatedAtTolerance: cfg.Cache.UpdatedAtTolerance,
+		})
+		userRepository = userCache
+		log.WithField("shadow_mode", cfg.Cache.ShadowMode).Info("User cache enabled")
 	}
 
-	auditPublisher, err := publisher.NewAuditPublisher(kafkaBootstrap, auditTopic)
-	if err != nil {
-		log.WithField("error", err).Fatal("Could not create audit Kafka publisher")
+	// Create audit sinks
+	var auditSinks []publisher.Sink
+	// replayTarget stays nil without Kafka, which disables audit replay
+	var replayTarget service.ReplayPublisher
+	if cfg.Audit.HasSink(config.AuditSinkKafka) {
+		kafkaBootstrap := os.Getenv("KAFKA_BOOTSTRAP_SERVERS")
+		if kafkaBootstrap == "" {
+			log.Fatal("FATAL: KAFKA_BOOTSTRAP_SERVERS environment variable is not set")
+		}
+
+		auditTopic := os.Getenv("KAFKA_AUDIT_TOPIC")
+		if auditTopic == "" {
+			auditTopic = "audit_events"
+		}
+
+		auditPublisher, err := publisher.NewAuditPublisher(kafkaBootstrap, auditTopic)
+		if err != nil {
+			log.WithField("error", err).Fatal("Could not create audit Kafka publisher")
+		}
+		defer auditPublisher.Close()
+
+		if cfg.Audit.Required {
+			log.WithField("timeout", cfg.Audit.KafkaReadyTimeout).Info("Waiting for Kafka to become reachable...")
+			readyCtx, readyCancel := context.WithTimeout(context.Background(), cfg.Audit.KafkaReadyTimeout)
+			err := auditPublisher.WaitReady(readyCtx)
+			readyCancel()
+			if err != nil {
+				log.WithField("error", err).Fatal("Kafka is required for audit but is not reachable")
+			}
+			log.Info("Kafka is reachable.")
+		}
+
+		auditSinks = append(auditSinks, publisher.Sink{Name: config.AuditSinkKafka, Publisher: auditPublisher})
+		replayTarget = auditPublisher
+	}
+	if cfg.Audit.HasSink(config.AuditSinkLog) {
+		auditSinks = append(auditSinks, publisher.Sink{Name: config.AuditSinkLog, Publisher: publisher.NewLogAuditPublisher()})
+	}
+	if cfg.Audit.HasSink(config.AuditSinkHTTP) {
+		auditSinks = append(auditSinks, publisher.Sink{
+			Name:      config.AuditSinkHTTP,
+			Publisher: publisher.NewHTTPAuditPublisher(cfg.Audit.HTTPURL, cfg.Audit.HTTPTimeout),
+		})
 	}
-	defer auditPublisher.Close()
+	log.WithField("sinks", cfg.Audit.Sinks).Info("Audit sinks configured")
 
-	auditService := service.NewAuditService(auditPublisher)
+	var eventPublisher service.AuditPublisher = auditSinks[0].Publisher
+	if len(auditSinks) > 1 {
+		eventPublisher = publisher.NewMultiAuditPublisher(auditSinks...)
+	}
+	if cfg.Audit.Async {
+		asyncPublisher := publisher.NewAsyncAuditPublisher(eventPublisher, cfg.Audit.Workers, cfg.Audit.QueueDepth)
+		// Deferred after the sinks, so queued events drain before they close
+		defer asyncPublisher.Close()
+		eventPublisher = asyncPublisher
+	}
+	auditRepository := repository.NewPostgresAuditRepository(db)
+	if cfg.Audit.StoreEnabled {
+		eventPublisher = publisher.NewStoringAuditPublisher(auditRepository, eventPublisher)
+		log.Info("Audit event store enabled")
+	}
+	auditEventFilter := domain.NewAuditEventFilter(cfg.Audit.EventAllowlist, cfg.Audit.EventDenylist)
+	auditReplayService := service.NewAuditReplayService(auditRepository, replayTarget)
+	auditReplayService.SetEventFilter(auditEventFilter)
+	// Deferred after the Kafka publisher, so a running replay stops before it closes
+	defer auditReplayService.Close()
+
+	auditService := service.NewAuditService(eventPublisher)
+	if cfg.PII.EncryptionEnabled {
+		auditService.SetPIICipher(piiCipher)
+	}
+	// Held-back events are dropped unless they are to be kept locally
+	var filteredStore service.AuditEventSaver
+	if cfg.Audit.FilteredToStore {
+		filteredStore = auditRepository
+	}
+	auditService.SetEventFilter(auditEventFilter, filteredStore)
 
 	// Create service
-	userService := service.NewUserService(userRepository, auditService)
+	userService := service.NewUserService(userRepository, auditService, publisher.NewLogVerificationSender(), service.UserServiceConfig{
+		RequireEmailVerification: cfg.User.RequireEmailVerification,
+		EmailVerificationTTL:     cfg.User.EmailVerificationTTL,
+		MinNameLength:            cfg.Validation.MinNameLength,
+		SignupBonusCoins:         cfg.User.SignupBonusCoins,
+		DeletionGracePeriod:      cfg.User.DeletionGracePeriod,
+		LegacyTrialPolicy:        cfg.User.LegacyTrialPolicy,
+		TrialLength:              cfg.User.TrialLength,
+		InvalidInputPolicy:       cfg.Validation.InvalidInputPolicy,
+	})
+	consistencyChecker := service.NewEntitlementConsistencyChecker(postgresUserRepository, auditService, cfg.Consistency.BatchSize, cfg.Consistency.StaleAfter)
+
+	// "consistency-check [-repair]" runs the check once instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "consistency-check" {
+		if err := runConsistencyCheck(consistencyChecker, os.Args[2:]); err != nil {
+			log.WithError(err).Error("Entitlement consistency check failed")
+			exitCode = 1
+		}
+		return
+	}
+
+	// Create DB circuit breaker
+	var dbBreaker *breaker.Breaker
+	if cfg.Breaker.Enabled {
+		dbBreaker = breaker.New(breaker.Config{
+			Window:             cfg.Breaker.Window,
+			MinRequests:        cfg.Breaker.MinRequests,
+			ErrorRateThreshold: cfg.Breaker.ErrorRateThreshold,
+			CoolDown:           cfg.Breaker.CoolDown,
+			HalfOpenProbes:     cfg.Breaker.HalfOpenProbes,
+		}, nil)
+		metrics.PublishFunc("db_circuit_breaker_state", func() interface{} {
+			return dbBreaker.State().String()
+		})
+	}
 
 	// Create server
-	srv := server.NewServer(userService, db)
+	srv := server.NewServer(userService, healthConn, dbBreaker, cfg.Admin.APIToken)
 
 	// Create product repositories
 	categoryRepository := repository.NewPostgresProductCategoryRepository(db)
 	productRepository := repository.NewPostgresProductRepository(db)
 
 	// Create product services
-	categoryService := service.NewProductCategoryService(categoryRepository)
-	productService := service.NewProductService(productRepository)
+	categoryService := service.NewProductCategoryService(categoryRepository, cfg.Validation.MinNameLength)
+	productService := service.NewProductService(productRepository, cfg.Validation.MinNameLength)
+	productService.SetMaxProductsPerCategory(cfg.Catalog.MaxProductsPerCategory)
+	productService.SetMaxProductContentBytes(cfg.Catalog.MaxProductContentBytes)
+	productService.SetActiveByDefault(cfg.Catalog.ProductsActiveByDefault)
+	productService.SetRejectInactiveCategory(cfg.Catalog.RejectInactiveCategory)
+	productService.SetInvalidInputPolicy(cfg.Validation.InvalidInputPolicy)
+	productService.SetHeavyOps(heavyOps)
+
+	if cfg.Catalog.UncategorizedEnabled {
+		bootstrapCtx, bootstrapCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		fallback, err := categoryService.EnsureFallbackCategory(bootstrapCtx, cfg.Catalog.UncategorizedSlug)
+		bootstrapCancel()
+		if err != nil {
+			log.WithError(err).Fatal("Could not ensure fallback product category")
+		}
+		productService.SetFallbackCategory(fallback.ID)
+	}
+
+	// "seed [-users N] [-products N]" loads the development dataset instead
+	// of serving
+	if len(os.Args) > 1 && os.Args[1] == "seed" {
+		seeder := service.NewSeeder(userService, categoryService, productService, postgresUserRepository)
+		if err := runSeed(seeder, os.Args[2:]); err != nil {
+			log.WithError(err).Error("Seeding failed")
+			exitCode = 1
+		}
+		return
+	}
 
 	// Create product servers
-	categoryServer := server.NewProductCategoryServer(categoryService)
-	productServer := server.NewProductServer(productService)
+	categoryServer := server.NewProductCategoryServer(categoryService, cfg.Admin.APIToken, cfg.Catalog.HideInactiveBySlug)
+	productViewCounter := service.NewProductViewCounter(productRepository, cfg.Catalog.ViewFlushInterval, cfg.Catalog.ViewFlushThreshold)
+	viewsCtx, viewsCancel := context.WithCancel(context.Background())
+	defer viewsCancel()
+	viewsDone := make(chan struct{})
+	go func() {
+		defer close(viewsDone)
+		productViewCounter.Run(viewsCtx)
+	}()
+	productServer := server.NewProductServer(productService, productViewCounter, cfg.Admin.APIToken, cfg.Catalog.HideInactiveBySlug)
+
+	// Create campaign service and resume campaigns interrupted by a previous run
+	campaignRepository := repository.NewPostgresCampaignRepository(db)
+	campaignService := service.NewCampaignService(campaignRepository, auditService, cfg.Campaign.BatchSize)
+	campaignService.SetHeavyOps(heavyOps)
+	campaignServer := server.NewCampaignServer(campaignService)
+
+	// Create order service
+	orderRepository := repository.NewPostgresOrderRepository(db)
+	orderService := service.NewOrderService(orderRepository, auditService)
+	orderService.SetInvalidInputPolicy(cfg.Validation.InvalidInputPolicy)
+	orderServer := server.NewOrderServer(orderService, cfg.Admin.APIToken)
+	purchaseService := service.NewPurchaseService(orderRepository, productService, userRepository, auditService)
+	purchaseService.SetInvalidInputPolicy(cfg.Validation.InvalidInputPolicy)
+	purchaseServer := server.NewPurchaseServer(purchaseService)
+
+	// Create idempotency key service
+	idempotencyService := service.NewIdempotencyService(cfg.Idempotency.KeyTTL, cfg.Idempotency.CleanupInterval)
+	postgresUserRepository.SetIdempotencyKeyTTL(idempotencyService.KeyTTL())
+
+	// Register the tables the janitor keeps trimmed
+	tableJanitor := janitor.New(db, cfg.Janitor.BatchPause)
+	registerCleanup := func(p janitor.Policy) {
+		if err := tableJanitor.Register(p); err != nil {
+			log.WithError(err).Fatal("Invalid janitor policy")
+		}
+	}
+	tuned := func(p janitor.Policy, t config.JanitorPolicy) janitor.Policy {
+		p.MaxAge, p.BatchSize, p.Interval = t.MaxAge, t.BatchSize, t.Interval
+		return p
+	}
+	registerCleanup(idempotencyService.CleanupPolicy())
+	registerCleanup(tuned(service.VerificationTokenCleanupPolicy(), cfg.Janitor.EmailVerificationTokens))
+	registerCleanup(tuned(service.SlugReservationCleanupPolicy(), cfg.Janitor.SlugReservations))
+
+	// Register resumable background jobs
+	jobManager := jobs.NewManager(repository.NewPostgresJobRepository(db))
+	if err := jobManager.Register(service.ExpirySweepJob(postgresUserRepository, cfg.Jobs.ExpirySweepBatchSize, cfg.Jobs.ExpirySweepInterval)); err != nil {
+		log.WithError(err).Fatal("Invalid background job")
+	}
+	if err := jobManager.Register(service.LegacyTrialBackfillJob(postgresUserRepository, func() time.Duration {
+		return configHolder.Current().User.TrialLength
+	}, cfg.Jobs.LegacyTrialBackfillBatchSize, cfg.Jobs.LegacyTrialBackfillInterval)); err != nil {
+		log.WithError(err).Fatal("Invalid background job")
+	}
+	if cfg.PII.EncryptionEnabled {
+		if err := jobManager.Register(service.PIIBackfillJob(postgresUserRepository, cfg.Jobs.PIIBackfillBatchSize, cfg.Jobs.PIIBackfillInterval)); err != nil {
+			log.WithError(err).Fatal("Invalid background job")
+		}
+	}
+	if err := jobManager.Register(service.CoinLedgerPruneJob(postgresUserRepository, func() time.Duration {
+		return configHolder.Current().Janitor.CoinLedger.MaxAge
+	}, cfg.Janitor.CoinLedger.BatchSize, cfg.Janitor.CoinLedger.Interval)); err != nil {
+		log.WithError(err).Fatal("Invalid background job")
+	}
+	if err := jobManager.Register(service.AccountErasureJob(postgresUserRepository, auditService, cfg.Jobs.AccountErasureBatchSize, cfg.Jobs.AccountErasureInterval)); err != nil {
+		log.WithError(err).Fatal("Invalid background job")
+	}
+
+	// Singleton background workers run only on the elected leader
+	elector := leader.New(db, leader.WorkerLockKey, cfg.Leader.RenewInterval)
+	metrics.PublishFunc("leader", func() interface{} {
+		return elector.IsLeader()
+	})
+
+	const campaignRescanInterval = 30 * time.Second
+	runWorkers := func(ctx context.Context) {
+		if cfg.Janitor.Enabled {
+			go tableJanitor.Run(ctx)
+		}
+
+		// Jobs checkpoint when they stop, so wait for them before giving up leadership
+		var jobsWG sync.WaitGroup
+		jobsWG.Go(func() { jobManager.Run(ctx) })
+		defer jobsWG.Wait()
+
+		ticker := time.NewTicker(campaignRescanInterval)
+		defer ticker.Stop()
+		for {
+			if err := campaignService.Start(ctx); err != nil && ctx.Err() == nil {
+				log.WithError(err).Error("Could not resume coin grant campaigns")
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+
+	jobsCtx, jobsCancel := context.WithCancel(context.Background())
+	defer jobsCancel()
+	workersDone := make(chan struct{})
+	go func() {
+		defer close(workersDone)
+		if cfg.Leader.Enabled {
+			elector.Run(jobsCtx, runWorkers)
+		} else {
+			elector.RunUnelected(jobsCtx, runWorkers)
+		}
+	}()
+
+	// Create report service
+	reportService := service.NewReportService(repository.NewPostgresReportRepository(db))
+	reportService.SetHeavyOps(heavyOps)
+	reportService.SetStatsCacheTTL(cfg.Catalog.StatsCacheTTL)
+	reportService.SetInvalidInputPolicy(cfg.Validation.InvalidInputPolicy)
+	reportServer := server.NewReportServer(reportService)
+	auditServer := server.NewAuditServer(auditReplayService)
+
+	// Feature flags
+	featureFlags := featureflag.NewSet(cfg.FeatureFlags.Definitions)
+	featureFlagServer := server.NewFeatureFlagServer(featureFlags)
+
+	if cfg.Admin.APIToken == "" {
+		log.Warn("ADMIN_API_TOKEN is not set, admin endpoints are disabled")
+	}
+	requireAdmin := server.RequireAdminToken(cfg.Admin.APIToken)
+	requireBody := server.RequireBody()
+
+	// Push reloadable settings to the subsystems that use them
+	configHolder.OnReload(func(cfg *config.Config) {
+		userService.SetConfig(service.UserServiceConfig{
+			RequireEmailVerification: cfg.User.RequireEmailVerification,
+			EmailVerificationTTL:     cfg.User.EmailVerificationTTL,
+			MinNameLength:            cfg.Validation.MinNameLength,
+			SignupBonusCoins:         cfg.User.SignupBonusCoins,
+			DeletionGracePeriod:      cfg.User.DeletionGracePeriod,
+			LegacyTrialPolicy:        cfg.User.LegacyTrialPolicy,
+			TrialLength:              cfg.User.TrialLength,
+			InvalidInputPolicy:       cfg.Validation.InvalidInputPolicy,
+		})
+		categoryService.SetMinNameLength(cfg.Validation.MinNameLength)
+		productService.SetMinNameLength(cfg.Validation.MinNameLength)
+		productService.SetMaxProductsPerCategory(cfg.Catalog.MaxProductsPerCategory)
+		productService.SetMaxProductContentBytes(cfg.Catalog.MaxProductContentBytes)
+		productService.SetInvalidInputPolicy(cfg.Validation.InvalidInputPolicy)
+		orderService.SetInvalidInputPolicy(cfg.Validation.InvalidInputPolicy)
+		purchaseService.SetInvalidInputPolicy(cfg.Validation.InvalidInputPolicy)
+		reportService.SetInvalidInputPolicy(cfg.Validation.InvalidInputPolicy)
+		if userCache != nil {
+			userCache.SetConfig(cache.Config{
+				TTL:                cfg.Cache.TTL,
+				ShadowMode:         cfg.Cache.ShadowMode,
+				ShadowSampleRate:   cfg.Cache.ShadowSampleRate,
+				UpdatedAtTolerance: cfg.Cache.UpdatedAtTolerance,
+			})
+		}
+		if dbBreaker != nil {
+			dbBreaker.SetConfig(breaker.Config{
+				Window:             cfg.Breaker.Window,
+				MinRequests:        cfg.Breaker.MinRequests,
+				ErrorRateThreshold: cfg.Breaker.ErrorRateThreshold,
+				CoolDown:           cfg.Breaker.CoolDown,
+				HalfOpenProbes:     cfg.Breaker.HalfOpenProbes,
+			})
+		}
+		campaignService.SetBatchSize(cfg.Campaign.BatchSize)
+		featureFlags.SetDefinitions(cfg.FeatureFlags.Definitions)
+	})
+	systemServer := server.NewSystemServer(configHolder, elector, jobManager, consistencyChecker)
 
 	// Setup Echo
 	e := echo.New()
+	jsonEncoder, err := jsonenc.Lookup(cfg.JSON.Encoder)
+	if err != nil {
+		log.WithField("error", err).Fatal("Invalid JSON_ENCODER")
+	}
+	e.JSONSerializer = server.TimedJSONSerializer{Encoder: jsonEncoder, PublicIDs: cfg.PublicIDs.Output}
+	// Paths are matched case-sensitively, so /API/users is a 404. A trailing
+	// slash is dropped before routing, so /api/users/ reaches /api/users in
+	// every group and route ACLs see the canonical path.
+	e.Pre(middleware.RemoveTrailingSlash())
+	e.Use(server.RequestContext())
+	e.Use(server.RequestTiming(func() time.Duration {
+		return configHolder.Current().Logging.SlowRequestThreshold
+	}))
+	routeACL, err := server.ParseRouteACL(cfg.Admin.RouteACL)
+	if err != nil {
+		log.WithField("error", err).Fatal("Invalid ROUTE_ACL")
+	}
+	principals := server.StaticTokenPrincipals(cfg.Admin.RoleTokens, cfg.Admin.APIToken)
+	e.Use(server.RequireRouteRoles(routeACL, principals))
+	e.Use(server.IdentifyAdmin(principals))
+	e.Use(server.PublicIDs())
+	srv.SetEmailLookupGuard(server.NewEmailLookupGuard(server.EmailLookupConfig{
+		Protected:    cfg.EmailLookup.Protected,
+		RateLimit:    cfg.EmailLookup.RateLimit,
+		MinLatency:   cfg.EmailLookup.MinLatency,
+		TrustedRoles: cfg.EmailLookup.TrustedRoles,
+	}, principals))
 
 	// Health check
 	e.GET("/health", srv.HealthCheck)
 
+	// Metrics expose process and caller details, so they are admin-only
+	debug := e.Group("/debug", requireAdmin)
+	debug.GET("/vars", echo.WrapHandler(metrics.Handler()))
+
 	// CRUD endpoints
 	api := e.Group("/api")
+	api.Use(server.JSONContentType())
+	if dbBreaker != nil {
+		api.Use(server.CircuitBreaker(dbBreaker))
+	}
 	users := api.Group("/users")
-	users.POST("", srv.CreateUser)
+	users.POST("", srv.CreateUser, requireBody)
+	users.POST("/provision", srv.ProvisionUser, requireBody)
 	users.GET("/:id", srv.GetUser)
 	users.GET("/email/:email", srv.GetUserByEmail)
-	users.PUT("/:id", srv.UpdateUser)
+	users.PUT("/:id", srv.UpdateUser, requireBody)
 	users.DELETE("/:id", srv.DeleteUser)
+	users.POST("/:id/restore", srv.RestoreUser)
 	users.GET("", srv.ListUsers)
 
 	// Business logic endpoints
-	users.POST("/:id/coins", srv.AddCoins)
-	users.POST("/:id/coins/deduct", srv.DeductCoins)
+	users.POST("/:id/coins", srv.AddCoins, requireBody)
+	users.POST("/:id/coins/deduct", srv.DeductCoins, requireBody)
+	users.POST("/:id/coins/transfer", srv.TransferCoins, requireBody)
+	users.GET("/:id/coins/burn-rate", reportServer.BurnRate)
+	users.GET("/:id/coins/summary", reportServer.CoinSummary)
+	users.GET("/:id/coins/transactions", srv.ListCoinTransactions)
+	users.GET("/:id/admin-actions", srv.ListAdminActions, requireAdmin)
 	users.POST("/:id/subscription/activate", srv.ActivateSubscription)
 	users.POST("/:id/subscription/renew", srv.RenewSubscription)
 	users.GET("/:id/access", srv.HasAccess)
+	users.GET("/:id/capabilities", srv.Capabilities)
+	users.POST("/:id/deletion-request", srv.RequestDeletion)
+	users.DELETE("/:id/deletion-request", srv.CancelDeletion)
+	users.GET("/:id/subscription/status", srv.GetSubscriptionStatus)
+	users.POST("/:id/verify-email/send", srv.SendEmailVerification)
+	users.POST("/:id/verify-email/confirm", srv.ConfirmEmailVerification, requireBody)
+	users.POST("/:id/checkout", orderServer.Checkout, requireBody)
+	users.POST("/:id/purchases", purchaseServer.Purchase, requireBody)
+	users.GET("/:id/purchases", purchaseServer.ListUserPurchases)
+	// Alias kept for clients of the original singular route
+	users.POST("/:id/purchase", purchaseServer.Purchase, requireBody)
+	users.GET("/:id/orders", orderServer.ListUserOrders)
+	users.GET("/:id/flags", featureFlagServer.UserFlags)
+	users.GET("/:id/can-purchase/:product_id", orderServer.CanPurchase)
+	users.GET("/:id/shortfall", orderServer.Shortfall)
 
 	// Catalog endpoints
 	catalog := api.Group("/catalog")
+	catalog.GET("/stats", reportServer.CatalogStats, requireAdmin)
 
 	// Categories
 	categories := catalog.Group("/categories")
 	categories.GET("", categoryServer.ListCategories)
+	categories.GET("/counts", categoryServer.CountProducts)
 	categories.GET("/:id", categoryServer.GetCategoryByID)
 	categories.GET("/slug/:slug", categoryServer.GetCategoryBySlug)
-	categories.POST("", categoryServer.CreateCategory)
-	categories.PUT("/:id", categoryServer.UpdateCategory)
+	categories.POST("/by-slugs", categoryServer.GetCategoriesBySlugs, requireBody)
+	categories.POST("", categoryServer.CreateCategory, requireBody)
+	categories.POST("/compact-positions", categoryServer.CompactPositions)
+	categories.PUT("/:id", categoryServer.UpdateCategory, requireBody)
+	categories.PUT("/by-slug/:slug", categoryServer.EnsureCategory, requireBody)
 	categories.DELETE("/:id", categoryServer.DeleteCategory)
+	categories.POST("/:id/products/price", productServer.UpdateCategoryPrices, requireBody)
 
 	// Products
 	products := catalog.Group("/products")
 	products.GET("", productServer.ListProducts)
 	products.GET("/:id", productServer.GetProductByID)
 	products.GET("/slug/:slug", productServer.GetProductBySlug)
-	products.POST("", productServer.CreateProduct)
-	products.PUT("/:id", productServer.UpdateProduct)
+	products.GET("/:id/stats", reportServer.ProductStats, requireAdmin)
+	products.POST("", productServer.CreateProduct, requireBody)
+	products.POST("/import", productServer.ImportProducts, requireBody)
+	products.POST("/:id/view", productServer.RecordView)
+	products.POST("/:id/clone", productServer.CloneProduct)
+	products.PUT("/:id", productServer.UpdateProduct, requireBody)
 	products.DELETE("/:id", productServer.DeleteProduct)
 
+	// Slug reservations
+	slugs := catalog.Group("/slugs")
+	slugs.POST("/reserve", productServer.ReserveSlug, requireBody)
+	slugs.POST("/release", productServer.ReleaseSlug, requireBody)
+
+	// Orders
+	orders := api.Group("/orders")
+	orders.GET("/:order_id", orderServer.GetOrder)
+	orders.POST("/:order_id/refund", orderServer.RefundOrder, requireAdmin)
+
+	// Admin endpoints
+	admin := api.Group("/admin", requireAdmin)
+	admin.GET("/products", productServer.ListAllProducts)
+	admin.GET("/coins/totals", reportServer.CoinTotals)
+	admin.POST("/users/reconcile-batch", systemServer.ReconcileBatch)
+	admin.POST("/audit/replay", auditServer.StartReplay, requireBody)
+	admin.GET("/audit/replay", auditServer.ReplayStatus)
+
+	// Validation limits are public so clients can read them
+	api.GET("/system/limits", systemServer.Limits)
+
+	// Admin system endpoints
+	system := api.Group("/system", requireAdmin)
+	system.GET("/info", systemServer.Info)
+	system.GET("/jobs", systemServer.Jobs)
+	system.POST("/reload-config", systemServer.ReloadConfig)
+	system.POST("/consistency-check", systemServer.ConsistencyCheck)
+
+	// Admin campaign endpoints
+	campaigns := api.Group("/campaigns", requireAdmin)
+	campaigns.POST("/coin-grant", campaignServer.CreateCoinGrant, requireBody)
+	campaigns.GET("/:id", campaignServer.GetCampaign)
+
+	if err := routeACL.Check(e.Routes()); err != nil {
+		log.WithField("error", err).Fatal("Invalid ROUTE_ACL")
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -183,6 +649,16 @@ func main() {
 		}
 	}()
 
+	// Reload tunable configuration on SIGHUP
+	hupchan := make(chan os.Signal, 1)
+	signal.Notify(hupchan, syscall.SIGHUP)
+	go func() {
+		for range hupchan {
+			log.Info("SIGHUP received, reloading configuration")
+			configHolder.Reload()
+		}
+	}()
+
 	// Setup graceful shutdown
 	sigchan := make(chan os.Signal, 1)
 	signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
@@ -199,10 +675,94 @@ func main() {
 		log.WithField("error", err).Error("Error shutting down server")
 	}
 
+	// Write buffered product views before the database closes
+	viewsCancel()
+	<-viewsDone
+
+	// Stop background jobs; they persist progress and resume on next start
+	jobsCancel()
+	<-workersDone
+	campaignService.Wait()
+
 	// Close resources explicitly
+	healthConn.Close()
 	if err := db.Close(); err != nil {
 		log.WithError(err).Error("Error closing database")
 	}
 
 	log.Info("User service stopped")
 }
+
+// runConsistencyCheck is the consistency-check subcommand: it checks every
+// user once, repairing only with -repair, and prints the report as JSON.
+func runConsistencyCheck(checker *service.EntitlementConsistencyChecker, args []string) error {
+	flags := flag.NewFlagSet("consistency-check", flag.ContinueOnError)
+	repair := flags.Bool("repair", false, "clear inconsistent flags instead of only reporting them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	ctx = reqctx.WithActor(ctx, "consistency-check")
+
+	report, err := checker.Check(ctx, *repair)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// runSeed is the seed subcommand: it writes the development dataset, sized
+// by -users and -products, and prints what it created and updated as JSON.
+func runSeed(seeder *service.Seeder, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	users := flags.Int("users", domain.DefaultSeedUsers, "number of users to seed")
+	products := flags.Int("products", domain.DefaultSeedProductsPerCategory, "number of products to seed per active category")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *users < 0 || *products < 0 {
+		return fmt.Errorf("-users and -products must not be negative")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	ctx = reqctx.WithActor(ctx, "seed")
+
+	report, err := seeder.Seed(ctx, *users, *products)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// newPIICipher builds the cipher of user emails and names from cfg, reading
+// the key from the environment or its file.
+func newPIICipher(cfg config.PII) (*pii.Cipher, error) {
+	var key []byte
+	var err error
+	if cfg.KeyFile != "" {
+		key, err = pii.ReadKeyFile(cfg.KeyFile)
+	} else {
+		key, err = pii.ParseKey(cfg.Key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	keys, err := pii.NewStaticKeyProvider(cfg.KeyID, key)
+	if err != nil {
+		return nil, err
+	}
+	hashKey, err := pii.ParseKey(cfg.EmailHashKey)
+	if err != nil {
+		return nil, err
+	}
+	return pii.NewCipher(keys, hashKey)
+}